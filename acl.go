@@ -0,0 +1,40 @@
+package cloudstorage
+
+import (
+	"golang.org/x/net/context"
+)
+
+// ACL is the access of an object set with SetObjectACL.
+type ACL int
+
+const (
+	// ACLPrivate objects are only readable with the store's credentials.
+	ACLPrivate ACL = iota
+	// ACLPublicRead objects are readable by anyone.
+	ACLPublicRead
+)
+
+func (a ACL) String() string {
+	switch a {
+	case ACLPrivate:
+		return "private"
+	case ACLPublicRead:
+		return "public-read"
+	}
+	return "unknown"
+}
+
+// SetObjectACL sets the access of object name on stores implementing
+// StoreACLSetter, others return ErrNotImplemented.  ErrObjectNotFound is
+// returned for missing objects.
+//
+// gcs grants allUsers read access, s3 sets a canned ACL, localfs changes the
+// file mode.  Azure blobs take the public access level of their container,
+// an acl the container's level doesn't give fails with ErrNotImplemented.
+// Objects rewritten later get the store's default access again.
+func SetObjectACL(ctx context.Context, s Store, name string, acl ACL) error {
+	if a, ok := s.(StoreACLSetter); ok {
+		return a.SetObjectACL(ctx, name, acl)
+	}
+	return ErrNotImplemented
+}
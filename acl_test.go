@@ -0,0 +1,36 @@
+package cloudstorage_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/localfs"
+	"github.com/lytics/cloudstorage/mockstore"
+)
+
+func TestSetObjectACL(t *testing.T) {
+	ctx := context.Background()
+	store := mockstore.New()
+	store.Add("a.csv", []byte("a"), nil)
+	err := cloudstorage.SetObjectACL(ctx, store, "a.csv", cloudstorage.ACLPublicRead)
+	require.Equal(t, cloudstorage.ErrNotImplemented, err)
+
+	tmpDir := t.TempDir()
+	lstore, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    tmpDir + "/store",
+		TmpDir:     tmpDir + "/tmp",
+		KeyEncoder: cloudstorage.SafeKeyEncoder{},
+	})
+	require.NoError(t, err)
+	require.NoError(t, cloudstorage.WriteAll(ctx, lstore, "share/a b.csv", []byte("a"), nil))
+	require.NoError(t, cloudstorage.SetObjectACL(ctx, lstore, "share/a b.csv", cloudstorage.ACLPublicRead))
+	err = cloudstorage.SetObjectACL(ctx, lstore, "share/missing.csv", cloudstorage.ACLPublicRead)
+	require.Equal(t, cloudstorage.ErrObjectNotFound, err)
+
+	require.Equal(t, "public-read", cloudstorage.ACLPublicRead.String())
+}
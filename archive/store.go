@@ -0,0 +1,458 @@
+// Package archive is a read-only cloudstorage.Store over the entries of a
+// zip or tar(.gz) archive object held in another store.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pborman/uuid"
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+const (
+	// StoreType = "archive"
+	StoreType = "archive"
+)
+
+var (
+	// ErrReadOnly is returned for any write to an archive store.
+	ErrReadOnly = fmt.Errorf("archive store is read-only")
+	// ErrUnknownFormat is returned for archives that are not zip, tar, tar.gz or tgz.
+	ErrUnknownFormat = fmt.Errorf("unknown archive format, expected .zip, .tar, .tar.gz or .tgz")
+)
+
+type format int
+
+const (
+	formatZip format = iota
+	formatTar
+	formatTarGz
+)
+
+type (
+	// Store is a read-only view of the entries of an archive object.  Zip
+	// archives need random access so the archive (not its entries) is
+	// copied to the local cache, tar archives are streamed from the source
+	// store on every read.
+	Store struct {
+		ID        string
+		src       cloudstorage.StoreReader
+		name      string
+		format    format
+		cachepath string
+		zipFile   *os.File
+		zip       *zip.Reader
+		entries   map[string]*entry
+		names     []string
+	}
+
+	entry struct {
+		name    string
+		size    int64
+		updated time.Time
+		zf      *zip.File
+	}
+
+	object struct {
+		s          *Store
+		e          *entry
+		cachedcopy *os.File
+		cachepath  string
+		opened     bool
+	}
+)
+
+// NewStore mounts the archive object name from src.  tmpDir is used for
+// cached copies of opened entries (and zip archives).
+func NewStore(ctx context.Context, src cloudstorage.StoreReader, name, tmpDir string) (*Store, error) {
+
+	s := &Store{
+		src:     src,
+		name:    name,
+		entries: make(map[string]*entry),
+	}
+	lname := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lname, ".zip"):
+		s.format = formatZip
+	case strings.HasSuffix(lname, ".tar.gz"), strings.HasSuffix(lname, ".tgz"):
+		s.format = formatTarGz
+	case strings.HasSuffix(lname, ".tar"):
+		s.format = formatTar
+	default:
+		return nil, ErrUnknownFormat
+	}
+
+	if tmpDir == "" {
+		return nil, fmt.Errorf("unable to create cachepath. tmpdir=%q", tmpDir)
+	}
+	if err := os.MkdirAll(tmpDir, 0775); err != nil {
+		return nil, fmt.Errorf("unable to create cachepath. tmpdir=%q err=%v", tmpDir, err)
+	}
+
+	uid := uuid.NewUUID().String()
+	s.ID = strings.Replace(uid, "-", "", -1)
+	cachepath, err := cloudstorage.CacheDir(tmpDir, s.ID)
+	if err != nil {
+		return nil, err
+	}
+	s.cachepath = cachepath
+
+	if s.format == formatZip {
+		err = s.indexZip(ctx)
+	} else {
+		err = s.walkTar(ctx, func(hdr *tar.Header, r io.Reader) (bool, error) {
+			n := entryName(hdr.Name)
+			s.entries[n] = &entry{name: n, size: hdr.Size, updated: hdr.ModTime}
+			return true, nil
+		})
+	}
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	for n := range s.entries {
+		s.names = append(s.names, n)
+	}
+	sort.Strings(s.names)
+	return s, nil
+}
+
+func (s *Store) indexZip(ctx context.Context) error {
+	rc, err := s.src.NewReaderWithContext(ctx, s.name)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	s.zipFile, err = os.CreateTemp(s.cachepath, "archive-*.zip")
+	if err != nil {
+		return err
+	}
+	os.Remove(s.zipFile.Name())
+	size, err := io.Copy(s.zipFile, rc)
+	if err != nil {
+		return fmt.Errorf("could not copy archive %q err=%v", s.name, err)
+	}
+	s.zip, err = zip.NewReader(s.zipFile, size)
+	if err != nil {
+		return fmt.Errorf("could not read zip archive %q err=%v", s.name, err)
+	}
+	for _, zf := range s.zip.File {
+		if zf.FileInfo().IsDir() {
+			continue
+		}
+		n := entryName(zf.Name)
+		s.entries[n] = &entry{name: n, size: int64(zf.UncompressedSize64), updated: zf.Modified, zf: zf}
+	}
+	return nil
+}
+
+// walkTar streams the tar archive from the source store calling fn for
+// each regular file until fn returns false.
+func (s *Store) walkTar(ctx context.Context, fn func(hdr *tar.Header, r io.Reader) (bool, error)) error {
+	rc, err := s.src.NewReaderWithContext(ctx, s.name)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	var r io.Reader = rc
+	if s.format == formatTarGz {
+		gz, err := gzip.NewReader(rc)
+		if err != nil {
+			return fmt.Errorf("could not read gzip archive %q err=%v", s.name, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("could not read tar archive %q err=%v", s.name, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		more, err := fn(hdr, tr)
+		if err != nil || !more {
+			return err
+		}
+	}
+}
+
+// Close releases the cached zip archive.
+func (s *Store) Close() error {
+	if s.zipFile != nil {
+		return s.zipFile.Close()
+	}
+	return nil
+}
+
+// Type of store = "archive"
+func (s *Store) Type() string {
+	return StoreType
+}
+
+// CleanCache removes stale cache files from the store's TmpDir, see
+// cloudstorage.CleanCache.
+func (s *Store) CleanCache(ctx context.Context, olderThan time.Duration) error {
+	return cloudstorage.CleanCache(ctx, s.cachepath, olderThan)
+}
+
+// CachePath is the cache directory of the store below its TmpDir.
+func (s *Store) CachePath() string {
+	return s.cachepath
+}
+
+// UpdatedGranularity of archive entries, zip entries without extended
+// timestamps only have even seconds.
+func (s *Store) UpdatedGranularity() time.Duration {
+	return 2 * time.Second
+}
+
+// Client returns the source store the archive is read from.
+func (s *Store) Client() interface{} {
+	return s.src
+}
+
+func (s *Store) String() string {
+	return fmt.Sprintf("archive://%s/%s", s.src.String(), s.name)
+}
+
+// Get an archive entry.
+func (s *Store) Get(ctx context.Context, name string) (cloudstorage.Object, error) {
+	e, ok := s.entries[name]
+	if !ok {
+		return nil, cloudstorage.ErrObjectNotFound
+	}
+	return s.newObject(e), nil
+}
+
+func (s *Store) newObject(e *entry) *object {
+	return &object{
+		s:         s,
+		e:         e,
+		cachepath: cloudstorage.CachePathObj(s.cachepath, e.name, s.ID),
+	}
+}
+
+// Objects returns an iterator over the archive entries that match the Query q.
+func (s *Store) Objects(ctx context.Context, q cloudstorage.Query) (cloudstorage.ObjectIterator, error) {
+	return cloudstorage.NewObjectPageIterator(ctx, s, q), nil
+}
+
+// List archive entries, the whole listing is returned as a single page.
+func (s *Store) List(ctx context.Context, q cloudstorage.Query) (*cloudstorage.ObjectsResponse, error) {
+	resp := cloudstorage.NewObjectsResponse()
+	seen := make(map[string]struct{})
+	for _, n := range s.names {
+		if !strings.HasPrefix(n, q.Prefix) {
+			continue
+		}
+		if q.Marker != "" && n <= q.Marker {
+			continue
+		}
+		if q.Delimiter != "" {
+			if i := strings.Index(n[len(q.Prefix):], q.Delimiter); i >= 0 {
+				p := n[:len(q.Prefix)+i+len(q.Delimiter)]
+				if _, ok := seen[p]; !ok {
+					seen[p] = struct{}{}
+					resp.Prefixes = append(resp.Prefixes, p)
+				}
+				continue
+			}
+		}
+		if e := s.entries[n]; q.Match(n, e.size) {
+			resp.Objects = append(resp.Objects, s.newObject(e))
+		}
+	}
+	resp.Objects = q.ApplyFilters(resp.Objects)
+	return resp, nil
+}
+
+// Folders get folders list.
+func (s *Store) Folders(ctx context.Context, q cloudstorage.Query) ([]string, error) {
+	iter, err := s.FolderIterator(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+	return cloudstorage.FoldersAll(iter)
+}
+
+// FolderIterator returns an iterator over the folders below the Query prefix.
+func (s *Store) FolderIterator(ctx context.Context, q cloudstorage.Query) (cloudstorage.FolderIterator, error) {
+	return cloudstorage.NewFolderPageIterator(ctx, s, q), nil
+}
+
+// NewReader create archive entry reader.
+func (s *Store) NewReader(o string) (io.ReadCloser, error) {
+	return s.NewReaderWithContext(context.Background(), o)
+}
+
+// NewReaderWithContext create archive entry reader with context.
+func (s *Store) NewReaderWithContext(ctx context.Context, name string) (io.ReadCloser, error) {
+	e, ok := s.entries[name]
+	if !ok {
+		return nil, cloudstorage.ErrObjectNotFound
+	}
+	if e.zf != nil {
+		return e.zf.Open()
+	}
+
+	// stream the archive to the entry, the pipe keeps the source open until
+	// the caller is done reading.
+	pr, pw := io.Pipe()
+	go func() {
+		found := false
+		err := s.walkTar(ctx, func(hdr *tar.Header, r io.Reader) (bool, error) {
+			if entryName(hdr.Name) != name {
+				return true, nil
+			}
+			found = true
+			_, err := io.Copy(pw, r)
+			return false, err
+		})
+		if err == nil && !found {
+			err = cloudstorage.ErrObjectNotFound
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
+
+// NewWriter is not supported, the archive store is read-only.
+func (s *Store) NewWriter(o string, metadata map[string]string) (io.WriteCloser, error) {
+	return nil, ErrReadOnly
+}
+
+// NewWriterWithContext is not supported, the archive store is read-only.
+func (s *Store) NewWriterWithContext(ctx context.Context, o string, metadata map[string]string, opts ...cloudstorage.Opts) (io.WriteCloser, error) {
+	return nil, ErrReadOnly
+}
+
+// NewObject is not supported, the archive store is read-only.
+func (s *Store) NewObject(o string, opts ...cloudstorage.Opts) (cloudstorage.Object, error) {
+	return nil, ErrReadOnly
+}
+
+// Delete is not supported, the archive store is read-only.
+func (s *Store) Delete(ctx context.Context, o string, opts ...cloudstorage.Opts) error {
+	return ErrReadOnly
+}
+
+func (o *object) Name() string {
+	return o.e.name
+}
+func (o *object) String() string {
+	return o.e.name
+}
+func (o *object) Updated() time.Time {
+	return o.e.updated.UTC()
+}
+func (o *object) MetaData() map[string]string {
+	return map[string]string{cloudstorage.ContentTypeKey: cloudstorage.ContentType(o.e.name)}
+}
+func (o *object) SetMetaData(meta map[string]string) {}
+func (o *object) Size() int64 {
+	return o.e.size
+}
+func (o *object) StorageSource() string {
+	return StoreType
+}
+func (o *object) DisableCompression() {}
+
+// Open extracts the entry to the local cache, only ReadOnly is supported.
+func (o *object) Open(accesslevel cloudstorage.AccessLevel) (*os.File, error) {
+	if accesslevel != cloudstorage.ReadOnly {
+		return nil, ErrReadOnly
+	}
+	if o.opened {
+		return nil, fmt.Errorf("the store object is already opened. %s", o.e.name)
+	}
+	if err := cloudstorage.EnsureDir(o.cachepath); err != nil {
+		return nil, fmt.Errorf("could not create cachedcopy's dir. cachepath=%q err=%v", o.cachepath, err)
+	}
+	cachedcopy, err := os.Create(o.cachepath)
+	if err != nil {
+		return nil, fmt.Errorf("could not create cachedcopy file. cachepath=%q err=%v", o.cachepath, err)
+	}
+	rc, err := o.s.NewReader(o.e.name)
+	if err != nil {
+		cachedcopy.Close()
+		return nil, err
+	}
+	_, err = io.Copy(cachedcopy, rc)
+	rc.Close()
+	if err != nil {
+		cachedcopy.Close()
+		return nil, fmt.Errorf("error extracting %q err=%v", o.e.name, err)
+	}
+	if _, err := cachedcopy.Seek(0, io.SeekStart); err != nil {
+		cachedcopy.Close()
+		return nil, fmt.Errorf("error seeking to start of cachedcopy err=%v", err)
+	}
+	o.cachedcopy = cachedcopy
+	o.opened = true
+	return cachedcopy, nil
+}
+
+func (o *object) Release() error {
+	if o.cachedcopy != nil {
+		o.cachedcopy.Close()
+		o.cachedcopy = nil
+		o.opened = false
+	}
+	os.Remove(o.cachepath)
+	return nil
+}
+func (o *object) Read(p []byte) (n int, err error) {
+	if o.cachedcopy == nil {
+		if _, err := o.Open(cloudstorage.ReadOnly); err != nil {
+			return 0, err
+		}
+	}
+	return o.cachedcopy.Read(p)
+}
+func (o *object) Write(p []byte) (n int, err error) {
+	return 0, ErrReadOnly
+}
+func (o *object) Sync() error {
+	return ErrReadOnly
+}
+func (o *object) Close() error {
+	return o.Release()
+}
+func (o *object) File() *os.File {
+	return o.cachedcopy
+}
+func (o *object) Delete() error {
+	return ErrReadOnly
+}
+
+// entryName cleans archive entry names into relative object names, ie
+// "./data/a.csv" is "data/a.csv".
+func entryName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
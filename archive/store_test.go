@@ -0,0 +1,120 @@
+package archive_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/archive"
+	"github.com/lytics/cloudstorage/localfs"
+)
+
+var files = map[string]string{
+	"a.csv":       "1,2,3\n",
+	"data/b.csv":  "4,5,6\n",
+	"data/c.csv":  "7,8,9\n",
+	"other/d.txt": "hello\n",
+}
+
+func writeObject(t *testing.T, store cloudstorage.Store, name string, data []byte) {
+	w, err := store.NewWriter(name, nil)
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+}
+
+func tarGz(t *testing.T) []byte {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "./data/", Typeflag: tar.TypeDir, Mode: 0755}))
+	for name, body := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "./" + name, Size: int64(len(body)), Mode: 0644, ModTime: time.Now()}))
+		_, err := tw.Write([]byte(body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func zipArchive(t *testing.T) []byte {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for name, body := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestArchive(t *testing.T) {
+	tmpDir := t.TempDir()
+	src, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "mockcloud"),
+		TmpDir:     filepath.Join(tmpDir, "localcache"),
+		Bucket:     "archives",
+	})
+	require.NoError(t, err)
+
+	writeObject(t, src, "partner/drop.tar.gz", tarGz(t))
+	writeObject(t, src, "partner/drop.zip", zipArchive(t))
+
+	_, err = archive.NewStore(context.Background(), src, "partner/drop.rar", filepath.Join(tmpDir, "archive"))
+	require.Equal(t, archive.ErrUnknownFormat, err)
+
+	for _, name := range []string{"partner/drop.tar.gz", "partner/drop.zip"} {
+		store, err := archive.NewStore(context.Background(), src, name, filepath.Join(tmpDir, "archive"))
+		require.NoError(t, err, name)
+
+		resp, err := store.List(context.Background(), cloudstorage.NewQuery("data/"))
+		require.NoError(t, err)
+		require.Equal(t, 2, len(resp.Objects))
+		require.Equal(t, "data/b.csv", resp.Objects[0].Name())
+
+		folders, err := store.Folders(context.Background(), cloudstorage.NewQueryForFolders(""))
+		require.NoError(t, err)
+		require.Equal(t, []string{"data/", "other/"}, folders)
+
+		for fname, body := range files {
+			rc, err := store.NewReader(fname)
+			require.NoError(t, err)
+			got, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			require.NoError(t, rc.Close())
+			require.Equal(t, body, string(got), "%s %s", name, fname)
+		}
+
+		obj, err := store.Get(context.Background(), "other/d.txt")
+		require.NoError(t, err)
+		f, err := obj.Open(cloudstorage.ReadOnly)
+		require.NoError(t, err)
+		got, err := io.ReadAll(f)
+		require.NoError(t, err)
+		require.Equal(t, "hello\n", string(got))
+		require.NoError(t, obj.Close())
+
+		_, err = obj.Open(cloudstorage.ReadWrite)
+		require.Equal(t, archive.ErrReadOnly, err)
+		_, err = store.Get(context.Background(), "missing.csv")
+		require.Equal(t, cloudstorage.ErrObjectNotFound, err)
+		_, err = store.NewWriter("new.csv", nil)
+		require.Equal(t, archive.ErrReadOnly, err)
+		require.NoError(t, store.Close())
+	}
+}
@@ -0,0 +1,77 @@
+package cloudstorage
+
+import (
+	"strconv"
+	"time"
+)
+
+// ObjectAttributes of an object as the provider keeps them, the typed
+// counterpart of the attributes some stores mix into MetaData.  Fields the
+// store doesn't have are zero.
+type ObjectAttributes struct {
+	Size            int64
+	Updated         time.Time
+	ContentType     string
+	ContentEncoding string
+	CacheControl    string
+	// ETag without quotes.
+	ETag string
+	// StorageClass, ie STANDARD or NEARLINE on gcs and STANDARD_IA on s3.
+	StorageClass string
+	// Generation of gcs objects.
+	Generation int64
+	// VersionID of s3 objects in versioned buckets.
+	VersionID string
+	// CustomTime of gcs objects, zero if unset.
+	CustomTime time.Time
+	// TemporaryHold and EventBasedHold of gcs objects.
+	TemporaryHold  bool
+	EventBasedHold bool
+	// RetentionExpiration of gcs objects in buckets with a retention
+	// policy, the time until which they can't be deleted or overwritten.
+	RetentionExpiration time.Time
+	// CustomMetadata is the metadata the object was written with, without
+	// the provider attributes.
+	CustomMetadata map[string]string
+}
+
+// AttrsOf obj, its Attrs if it is an ObjectAttributer, otherwise
+// BasicAttrs.
+func AttrsOf(obj Object) ObjectAttributes {
+	if oa, ok := obj.(ObjectAttributer); ok {
+		return oa.Attrs()
+	}
+	return BasicAttrs(obj)
+}
+
+// SizeOf obj in bytes, from ObjectSizer which the objects of every store
+// here implement, otherwise from its ContentLengthKey metadata.  False
+// when neither is known.
+func SizeOf(obj Object) (int64, bool) {
+	if s, ok := obj.(ObjectSizer); ok {
+		return s.Size(), true
+	}
+	if v, ok := obj.MetaData()[ContentLengthKey]; ok {
+		if size, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return size, true
+		}
+	}
+	return 0, false
+}
+
+// BasicAttrs of obj from the Object methods and the optional ObjectSizer
+// and ObjectETagger, for stores with no attributes beyond those.  The
+// ContentType is the content_type metadata, or guessed from the name.
+func BasicAttrs(obj Object) ObjectAttributes {
+	a := ObjectAttributes{Updated: obj.Updated(), CustomMetadata: obj.MetaData()}
+	if s, ok := obj.(ObjectSizer); ok {
+		a.Size = s.Size()
+	}
+	if et, ok := obj.(ObjectETagger); ok {
+		a.ETag = CleanETag(et.ETag())
+	}
+	if a.ContentType = a.CustomMetadata[ContentTypeKey]; a.ContentType == "" {
+		a.ContentType = ContentType(obj.Name())
+	}
+	return a
+}
@@ -0,0 +1,65 @@
+package cloudstorage_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/localfs"
+	"github.com/lytics/cloudstorage/mockstore"
+)
+
+func TestAttrsOf(t *testing.T) {
+	ctx := context.Background()
+	store := mockstore.New()
+	store.Add("in/a.json", []byte(`{"a":1}`), map[string]string{"owner": "etl"})
+
+	obj, err := store.Get(ctx, "in/a.json")
+	require.NoError(t, err)
+	a := cloudstorage.AttrsOf(obj)
+	require.Equal(t, int64(7), a.Size)
+	require.Equal(t, obj.(cloudstorage.ObjectETagger).ETag(), a.ETag)
+	require.Equal(t, obj.Updated(), a.Updated)
+	require.Equal(t, "application/json", a.ContentType)
+	require.Equal(t, map[string]string{"owner": "etl"}, a.CustomMetadata)
+
+	tmpDir := t.TempDir()
+	lstore, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:              localfs.StoreType,
+		AuthMethod:        localfs.AuthFileSystem,
+		LocalFS:           tmpDir + "/store",
+		TmpDir:            tmpDir + "/tmp",
+		EnableCompression: true,
+	})
+	require.NoError(t, err)
+	md := map[string]string{cloudstorage.ContentTypeKey: "text/csv", "owner": "etl"}
+	require.NoError(t, cloudstorage.WriteAll(ctx, lstore, "in/a.csv", []byte("a,b\n"), md))
+	obj, err = lstore.Get(ctx, "in/a.csv")
+	require.NoError(t, err)
+	a = cloudstorage.AttrsOf(obj)
+	require.Equal(t, cloudstorage.CodecGzip, a.ContentEncoding)
+	require.Equal(t, "text/csv", a.ContentType)
+	require.Equal(t, md, a.CustomMetadata)
+}
+
+func TestSizeOf(t *testing.T) {
+	store := mockstore.New()
+	store.Add("in/a.json", []byte(`{"a":1}`), nil)
+	obj, err := store.Get(context.Background(), "in/a.json")
+	require.NoError(t, err)
+	size, ok := cloudstorage.SizeOf(obj)
+	require.True(t, ok)
+	require.Equal(t, int64(7), size)
+
+	// objects without a Size fall back to the metadata
+	wt, err := cloudstorage.NewWriteThroughObject(store, "out/a.json", cloudstorage.Opts{})
+	require.NoError(t, err)
+	_, ok = cloudstorage.SizeOf(wt)
+	require.False(t, ok)
+	wt.SetMetaData(map[string]string{cloudstorage.ContentLengthKey: "12"})
+	size, ok = cloudstorage.SizeOf(wt)
+	require.True(t, ok)
+	require.Equal(t, int64(12), size)
+}
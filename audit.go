@@ -0,0 +1,551 @@
+package cloudstorage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/araddon/gou"
+	"golang.org/x/net/context"
+)
+
+// The operations of AuditEvent.Op.
+const (
+	AuditWrite   = "write"
+	AuditPut     = "put"
+	AuditDelete  = "delete"
+	AuditCopy    = "copy"
+	AuditMove    = "move"
+	AuditCompose = "compose"
+)
+
+// AuditEvent is a mutation of a store recorded by NewAuditStore.
+type AuditEvent struct {
+	Time time.Time `json:"time"`
+	// Principal of the context of the call, see WithPrincipal.
+	Principal string `json:"principal,omitempty"`
+	Op        string `json:"op"`
+	// Store is the String of the store.
+	Store string `json:"store"`
+	// Name of the object written or deleted, the destination of copies.
+	Name string `json:"name"`
+	// Sources of copies, moves and composes.
+	Sources []string `json:"sources,omitempty"`
+	// Bytes written, or the size of the source of copies and moves if
+	// known, 0 for deletes.
+	Bytes int64 `json:"bytes"`
+	// Error of the operation, empty if it succeeded.
+	Error string `json:"error,omitempty"`
+}
+
+// AuditSink records the events of an audit store.
+type AuditSink interface {
+	Record(ctx context.Context, e AuditEvent) error
+}
+
+// AuditFunc is an AuditSink calling the function.
+type AuditFunc func(ctx context.Context, e AuditEvent) error
+
+// Record calls f.
+func (f AuditFunc) Record(ctx context.Context, e AuditEvent) error {
+	return f(ctx, e)
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context of the principal (user, service, job)
+// making the calls, recorded by audit stores.
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalOf returns the principal of ctx, see WithPrincipal.
+func PrincipalOf(ctx context.Context) string {
+	p, _ := ctx.Value(principalKey{}).(string)
+	return p
+}
+
+// NewJSONAuditSink returns an AuditSink writing the events to w as json
+// lines, os.Stdout for log collectors.
+func NewJSONAuditSink(w io.Writer) AuditSink {
+	return &jsonAuditSink{enc: json.NewEncoder(w)}
+}
+
+type jsonAuditSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (s *jsonAuditSink) Record(ctx context.Context, e AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(e)
+}
+
+// NewStoreAuditSink returns an AuditSink writing each event as a json
+// object of s named prefix/2006/01/02/150405.000000000-<id>.json, so the
+// log of a day is listed in order.
+func NewStoreAuditSink(s Store, prefix string) AuditSink {
+	return &storeAuditSink{s: s, prefix: prefix}
+}
+
+type storeAuditSink struct {
+	s      Store
+	prefix string
+}
+
+func (s *storeAuditSink) Record(ctx context.Context, e AuditEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s/%s-%s.json", s.prefix, e.Time.UTC().Format("2006/01/02/150405.000000000"), NewLeaseID())
+	return WriteAll(ctx, s.s, name, data, map[string]string{ContentTypeKey: "application/json"})
+}
+
+// NewAuditStore wraps s so its mutations are recorded to sink: the objects
+// written with NewWriter, NewWriterWithContext and Put, deletes, copies,
+// moves and composes, with the principal of the call's context and the
+// outcome.  Writes are recorded when the writer is closed.  The objects of
+// NewObject, Get and listings record their Delete, and the uploads of
+// their Sync and Close once opened for writing, with the principal of the
+// Get or listing context.
+//
+// The optional interfaces of s are passed on, tags and ACLs are set
+// unrecorded.  The audit store is a StoreRangeReader, and its objects
+// ObjectSizers, only if s and its objects are.
+//
+// A failing sink doesn't fail the mutation, which is done, the error is
+// logged.
+func NewAuditStore(s Store, sink AuditSink) Store {
+	a := &auditStore{Store: s, sink: sink}
+	if rr, ok := s.(StoreRangeReader); ok {
+		return &auditRangeStore{auditStore: a, rr: rr}
+	}
+	return a
+}
+
+type auditStore struct {
+	Store
+	sink AuditSink
+}
+
+var (
+	_ StoreCopy            = (*auditStore)(nil)
+	_ StoreMove            = (*auditStore)(nil)
+	_ StorePut             = (*auditStore)(nil)
+	_ StoreComposer        = (*auditStore)(nil)
+	_ StoreLeaser          = (*auditStore)(nil)
+	_ StoreACLSetter       = (*auditStore)(nil)
+	_ StoreSigner          = (*auditStore)(nil)
+	_ TaggedStore          = (*auditStore)(nil)
+	_ StoreCapabilities    = (*auditStore)(nil)
+	_ StoreTimestamps      = (*auditStore)(nil)
+	_ StoreErrorClassifier = (*auditStore)(nil)
+	_ StoreBackoff         = (*auditStore)(nil)
+	_ StoreCacheCleaner    = (*auditStore)(nil)
+	_ StoreCachePath       = (*auditStore)(nil)
+	_ ObjectRecycler       = (*auditStore)(nil)
+	_ StoreRangeReader     = (*auditRangeStore)(nil)
+)
+
+// auditRangeStore is the auditStore of a StoreRangeReader.
+type auditRangeStore struct {
+	*auditStore
+	rr StoreRangeReader
+}
+
+func (a *auditRangeStore) NewRangeReader(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	return a.rr.NewRangeReader(ctx, name, offset, length)
+}
+
+func (a *auditStore) record(ctx context.Context, e AuditEvent, err error) {
+	e.Time = time.Now()
+	e.Principal = PrincipalOf(ctx)
+	e.Store = a.Store.String()
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if rerr := a.sink.Record(ctx, e); rerr != nil {
+		gou.Warnf("could not record audit event %s of %s err=%v", e.Op, e.Name, rerr)
+	}
+}
+
+// NewReaderWithOpts and GetWithOpts pass the opts of reads, which aren't
+// audited, on to the store.
+func (a *auditStore) NewReaderWithOpts(ctx context.Context, name string, opts ...Opts) (io.ReadCloser, error) {
+	return NewReaderWithOpts(ctx, a.Store, name, opts...)
+}
+func (a *auditStore) GetWithOpts(ctx context.Context, name string, opts ...Opts) (Object, error) {
+	o, err := GetWithOpts(ctx, a.Store, name, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return a.object(ctx, o), nil
+}
+func (a *auditStore) Get(ctx context.Context, name string) (Object, error) {
+	return a.GetWithOpts(ctx, name)
+}
+
+func (a *auditStore) NewObject(name string, opts ...Opts) (Object, error) {
+	o, err := a.Store.NewObject(name, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return a.object(context.Background(), o), nil
+}
+
+func (a *auditStore) List(ctx context.Context, q Query) (*ObjectsResponse, error) {
+	resp, err := a.Store.List(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	for i, o := range resp.Objects {
+		resp.Objects[i] = a.object(ctx, o)
+	}
+	return resp, nil
+}
+
+func (a *auditStore) Objects(ctx context.Context, q Query) (ObjectIterator, error) {
+	it, err := a.Store.Objects(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	ai := &auditIterator{ObjectIterator: it, a: a, ctx: ctx}
+	if ri, ok := it.(ResumableIterator); ok {
+		return &auditResumableIterator{auditIterator: ai, ri: ri}, nil
+	}
+	return ai, nil
+}
+
+func (a *auditStore) NewWriter(name string, metadata map[string]string) (io.WriteCloser, error) {
+	return a.NewWriterWithContext(context.Background(), name, metadata)
+}
+
+func (a *auditStore) NewWriterWithContext(ctx context.Context, name string, metadata map[string]string, opts ...Opts) (io.WriteCloser, error) {
+	wc, err := a.Store.NewWriterWithContext(ctx, name, metadata, opts...)
+	if err != nil {
+		a.record(ctx, AuditEvent{Op: AuditWrite, Name: name}, err)
+		return nil, err
+	}
+	aw := &auditWriter{WriteCloser: wc, a: a, ctx: ctx, name: name}
+	if rw, ok := wc.(ResultWriter); ok {
+		// keep the store's Result visible through the audit
+		return NewResultWriter(aw, func(r *UploadResult) error {
+			*r = rw.Result()
+			return nil
+		}), nil
+	}
+	return aw, nil
+}
+
+func (a *auditStore) Put(ctx context.Context, name string, r io.Reader, metadata map[string]string, opts ...Opts) error {
+	cr := &countingReader{r: r}
+	err := Put(ctx, a.Store, name, cr, metadata, opts...)
+	a.record(ctx, AuditEvent{Op: AuditPut, Name: name, Bytes: cr.n}, err)
+	return err
+}
+
+func (a *auditStore) Delete(ctx context.Context, name string, opts ...Opts) error {
+	err := a.Store.Delete(ctx, name, opts...)
+	a.record(ctx, AuditEvent{Op: AuditDelete, Name: name}, err)
+	return err
+}
+
+// Copy with the store's StoreCopy, if it has none Copy streams the object
+// through NewWriterWithContext recording a write.
+func (a *auditStore) Copy(ctx context.Context, src, dst Object) error {
+	return a.CopyWithOpts(ctx, src, dst)
+}
+
+func (a *auditStore) CopyWithOpts(ctx context.Context, src, dst Object, opts ...Opts) error {
+	err := fastCopy(ctx, a.Store, unwrapAudited(src), unwrapAudited(dst), opts)
+	if errors.Is(err, ErrNotImplemented) {
+		return err
+	}
+	size, _ := SizeOf(src)
+	a.record(ctx, AuditEvent{Op: AuditCopy, Name: dst.Name(), Sources: []string{src.Name()}, Bytes: size}, err)
+	return err
+}
+
+// Move with the store's StoreMove, if it has none the object is copied
+// then deleted through the audit store, recording both.
+func (a *auditStore) Move(ctx context.Context, src, dst Object) error {
+	return a.MoveWithOpts(ctx, src, dst)
+}
+
+func (a *auditStore) MoveWithOpts(ctx context.Context, src, dst Object, opts ...Opts) error {
+	if err := fastMove(ctx, a.Store, unwrapAudited(src), unwrapAudited(dst), opts); !errors.Is(err, ErrNotImplemented) {
+		size, _ := SizeOf(src)
+		a.record(ctx, AuditEvent{Op: AuditMove, Name: dst.Name(), Sources: []string{src.Name()}, Bytes: size}, err)
+		return err
+	}
+	if err := Copy(ctx, a, src, dst, opts...); err != nil {
+		return err
+	}
+	return a.Delete(ctx, src.Name())
+}
+
+func (a *auditStore) Compose(ctx context.Context, dst string, srcs []string) error {
+	c, ok := a.Store.(StoreComposer)
+	if !ok {
+		return ErrNotImplemented
+	}
+	err := c.Compose(ctx, dst, srcs)
+	if errors.Is(err, ErrNotImplemented) {
+		return err
+	}
+	a.record(ctx, AuditEvent{Op: AuditCompose, Name: dst, Sources: srcs}, err)
+	return err
+}
+
+func (a *auditStore) AcquireLease(ctx context.Context, name string, ttl time.Duration) (Lease, error) {
+	return AcquireLease(ctx, a.Store, name, ttl)
+}
+func (a *auditStore) SetObjectACL(ctx context.Context, name string, acl ACL) error {
+	return SetObjectACL(ctx, a.Store, name, acl)
+}
+func (a *auditStore) SignedURL(ctx context.Context, name, method string, expires time.Duration) (string, error) {
+	return SignedURL(ctx, a.Store, name, method, expires)
+}
+func (a *auditStore) GetTags(ctx context.Context, name string) (map[string]string, error) {
+	ts, ok := a.Store.(TaggedStore)
+	if !ok {
+		return nil, ErrNotImplemented
+	}
+	return ts.GetTags(ctx, name)
+}
+func (a *auditStore) SetTags(ctx context.Context, name string, tags map[string]string) error {
+	ts, ok := a.Store.(TaggedStore)
+	if !ok {
+		return ErrNotImplemented
+	}
+	return ts.SetTags(ctx, name, tags)
+}
+func (a *auditStore) Capabilities() Capabilities {
+	return CapabilitiesOf(a.Store)
+}
+func (a *auditStore) UpdatedGranularity() time.Duration {
+	return UpdatedGranularity(a.Store)
+}
+func (a *auditStore) IsTransient(err error) bool {
+	return IsTransient(a.Store, err)
+}
+func (a *auditStore) BackoffProfile() BackoffProfile {
+	return BackoffProfileOf(a.Store)
+}
+func (a *auditStore) CleanCache(ctx context.Context, olderThan time.Duration) error {
+	if c, ok := a.Store.(StoreCacheCleaner); ok {
+		return c.CleanCache(ctx, olderThan)
+	}
+	return nil
+}
+func (a *auditStore) CachePath() string {
+	if cp, ok := a.Store.(StoreCachePath); ok {
+		return cp.CachePath()
+	}
+	return ""
+}
+
+// Recycle hands the objects of a Reuse page back to the store, if it is an
+// ObjectRecycler.
+func (a *auditStore) Recycle(objects Objects) {
+	r, ok := a.Store.(ObjectRecycler)
+	if !ok {
+		return
+	}
+	inner := make(Objects, len(objects))
+	for i, o := range objects {
+		inner[i] = unwrapAudited(o)
+	}
+	r.Recycle(inner)
+}
+
+// object wraps o of the store so its mutations are recorded with the
+// principal of ctx.
+func (a *auditStore) object(ctx context.Context, o Object) Object {
+	ao := &auditObject{Object: o, a: a, ctx: ctx}
+	if s, ok := o.(ObjectSizer); ok {
+		return &auditSizedObject{auditObject: ao, sizer: s}
+	}
+	return ao
+}
+
+// unwrapAudited returns the store's object of o.
+func unwrapAudited(o Object) Object {
+	switch ao := o.(type) {
+	case *auditObject:
+		return ao.Object
+	case *auditSizedObject:
+		return ao.auditObject.Object
+	}
+	return o
+}
+
+// auditIterator wraps the listed objects.
+type auditIterator struct {
+	ObjectIterator
+	a   *auditStore
+	ctx context.Context
+}
+
+func (it *auditIterator) Next() (Object, error) {
+	o, err := it.ObjectIterator.Next()
+	if err != nil {
+		return nil, err
+	}
+	return it.a.object(it.ctx, o), nil
+}
+
+// auditResumableIterator is the auditIterator of a ResumableIterator.
+type auditResumableIterator struct {
+	*auditIterator
+	ri ResumableIterator
+}
+
+func (it *auditResumableIterator) Cursor() string {
+	return it.ri.Cursor()
+}
+func (it *auditResumableIterator) Resume(cursor string) error {
+	return it.ri.Resume(cursor)
+}
+
+// auditObject records the Delete of an object, and the uploads of its Sync
+// and Close once it is opened for writing.
+type auditObject struct {
+	Object
+	a   *auditStore
+	ctx context.Context
+	// writing is set by Open(ReadWrite) and Write, until Close.
+	writing bool
+	// n bytes written, the size of objects without a cached copy.
+	n int64
+}
+
+func (o *auditObject) Open(level AccessLevel) (*os.File, error) {
+	f, err := o.Object.Open(level)
+	if err == nil && level == ReadWrite {
+		o.writing = true
+	}
+	return f, err
+}
+
+func (o *auditObject) Write(p []byte) (int, error) {
+	n, err := o.Object.Write(p)
+	o.n += int64(n)
+	if err == nil {
+		o.writing = true
+	}
+	return n, err
+}
+
+// size of the upload, the cached copy if there is one.
+func (o *auditObject) size() int64 {
+	if f := o.Object.File(); f != nil {
+		if fi, err := f.Stat(); err == nil {
+			return fi.Size()
+		}
+	}
+	return o.n
+}
+
+func (o *auditObject) Sync() error {
+	if !o.writing {
+		return o.Object.Sync()
+	}
+	n := o.size()
+	err := o.Object.Sync()
+	o.a.record(o.ctx, AuditEvent{Op: AuditWrite, Name: o.Name(), Bytes: n}, err)
+	return err
+}
+
+func (o *auditObject) Close() error {
+	if !o.writing {
+		return o.Object.Close()
+	}
+	n := o.size()
+	err := o.Object.Close()
+	o.writing, o.n = false, 0
+	o.a.record(o.ctx, AuditEvent{Op: AuditWrite, Name: o.Name(), Bytes: n}, err)
+	return err
+}
+
+func (o *auditObject) Delete() error {
+	err := o.Object.Delete()
+	o.a.record(o.ctx, AuditEvent{Op: AuditDelete, Name: o.Name()}, err)
+	return err
+}
+
+func (o *auditObject) ETag() string {
+	if et, ok := o.Object.(ObjectETagger); ok {
+		return et.ETag()
+	}
+	return ""
+}
+func (o *auditObject) Attrs() ObjectAttributes {
+	return AttrsOf(o.Object)
+}
+func (o *auditObject) Hashes() map[string]string {
+	if h, ok := o.Object.(ObjectHasher); ok {
+		return h.Hashes()
+	}
+	return nil
+}
+
+// auditSizedObject is the auditObject of an ObjectSizer.
+type auditSizedObject struct {
+	*auditObject
+	sizer ObjectSizer
+}
+
+func (o *auditSizedObject) Size() int64 {
+	return o.sizer.Size()
+}
+
+// auditWriter counts the bytes written and records the write when closed.
+type auditWriter struct {
+	io.WriteCloser
+	a    *auditStore
+	ctx  context.Context
+	name string
+	n    int64
+	err  error
+	once sync.Once
+}
+
+func (w *auditWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	w.n += int64(n)
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return n, err
+}
+
+func (w *auditWriter) Close() error {
+	err := w.WriteCloser.Close()
+	w.once.Do(func() {
+		rerr := err
+		if rerr == nil {
+			rerr = w.err
+		}
+		w.a.record(w.ctx, AuditEvent{Op: AuditWrite, Name: w.name, Bytes: w.n}, rerr)
+	})
+	return err
+}
+
+// countingReader counts the bytes read.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
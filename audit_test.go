@@ -0,0 +1,182 @@
+package cloudstorage_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/localfs"
+	"github.com/lytics/cloudstorage/mockstore"
+)
+
+func TestAuditStore(t *testing.T) {
+	tmpDir := t.TempDir()
+	lstore, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "store"),
+		TmpDir:     filepath.Join(tmpDir, "tmp"),
+	})
+	require.NoError(t, err)
+	var events []cloudstorage.AuditEvent
+	store := cloudstorage.NewAuditStore(lstore, cloudstorage.AuditFunc(func(ctx context.Context, e cloudstorage.AuditEvent) error {
+		events = append(events, e)
+		return errors.New("sink failures don't fail the calls")
+	}))
+	ctx := cloudstorage.WithPrincipal(context.Background(), "jobs@example.com")
+
+	w, err := store.NewWriterWithContext(ctx, "in/a.csv", nil)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("a,b\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, cloudstorage.Put(ctx, store, "in/b.csv", strings.NewReader("c"), nil))
+	src, err := store.Get(ctx, "in/a.csv")
+	require.NoError(t, err)
+	dst, err := store.NewObject("out/a.csv")
+	require.NoError(t, err)
+	require.NoError(t, cloudstorage.Copy(ctx, store, src, dst))
+	require.NoError(t, store.Delete(ctx, "in/b.csv"))
+	require.Error(t, store.Delete(ctx, "in/b.csv"))
+
+	type summary struct {
+		principal, op, name string
+		bytes               int64
+		failed              bool
+	}
+	var got []summary
+	for _, e := range events {
+		require.False(t, e.Time.IsZero())
+		require.Equal(t, lstore.String(), e.Store)
+		got = append(got, summary{e.Principal, e.Op, e.Name, e.Bytes, e.Error != ""})
+	}
+	p := "jobs@example.com"
+	require.Equal(t, []summary{
+		{p, cloudstorage.AuditWrite, "in/a.csv", 4, false},
+		{p, cloudstorage.AuditPut, "in/b.csv", 1, false},
+		// localfs has no server side copy, the object is streamed
+		{p, cloudstorage.AuditWrite, "out/a.csv", 4, false},
+		{p, cloudstorage.AuditDelete, "in/b.csv", 0, false},
+		{p, cloudstorage.AuditDelete, "in/b.csv", 0, true},
+	}, got)
+}
+
+func TestAuditStoreObjects(t *testing.T) {
+	tmpDir := t.TempDir()
+	lstore, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "store"),
+		TmpDir:     filepath.Join(tmpDir, "tmp"),
+	})
+	require.NoError(t, err)
+	var events []cloudstorage.AuditEvent
+	store := cloudstorage.NewAuditStore(lstore, cloudstorage.AuditFunc(func(ctx context.Context, e cloudstorage.AuditEvent) error {
+		events = append(events, e)
+		return nil
+	}))
+	ctx := cloudstorage.WithPrincipal(context.Background(), "jobs@example.com")
+
+	// the optional interfaces of the store show through the audit
+	_, ok := store.(cloudstorage.StoreRangeReader)
+	require.True(t, ok)
+	_, ok = store.(cloudstorage.TaggedStore)
+	require.True(t, ok)
+	require.Equal(t, cloudstorage.CapabilitiesOf(lstore), cloudstorage.CapabilitiesOf(store))
+
+	obj, err := store.NewObject("in/a.csv")
+	require.NoError(t, err)
+	f, err := obj.Open(cloudstorage.ReadWrite)
+	require.NoError(t, err)
+	_, err = f.WriteString("a,b\n")
+	require.NoError(t, err)
+	require.NoError(t, obj.Close())
+
+	obj, err = store.Get(ctx, "in/a.csv")
+	require.NoError(t, err)
+	size, ok := cloudstorage.SizeOf(obj)
+	require.True(t, ok)
+	require.Equal(t, int64(4), size)
+	_, err = obj.Open(cloudstorage.ReadOnly)
+	require.NoError(t, err)
+	require.NoError(t, obj.Close())
+	require.NoError(t, obj.Delete())
+
+	type summary struct {
+		principal, op, name string
+		bytes               int64
+	}
+	var got []summary
+	for _, e := range events {
+		got = append(got, summary{e.Principal, e.Op, e.Name, e.Bytes})
+	}
+	require.Equal(t, []summary{
+		{"", cloudstorage.AuditWrite, "in/a.csv", 4},
+		{"jobs@example.com", cloudstorage.AuditDelete, "in/a.csv", 0},
+	}, got)
+}
+
+func TestAuditWriterResult(t *testing.T) {
+	ctx := context.Background()
+	inner := mockstore.New()
+	var events []cloudstorage.AuditEvent
+	store := cloudstorage.NewAuditStore(inner, cloudstorage.AuditFunc(func(ctx context.Context, e cloudstorage.AuditEvent) error {
+		events = append(events, e)
+		return nil
+	}))
+
+	w, err := store.NewWriterWithContext(ctx, "a.csv", nil)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("a,b\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	// the result of the store's writer shows through the audit
+	rw, ok := w.(cloudstorage.ResultWriter)
+	require.True(t, ok)
+	res := rw.Result()
+	require.Equal(t, int64(4), res.Size)
+	obj, err := inner.Get(ctx, "a.csv")
+	require.NoError(t, err)
+	require.NotEmpty(t, res.ETag)
+	require.Equal(t, obj.(cloudstorage.ObjectETagger).ETag(), res.ETag)
+	require.Equal(t, 1, len(events))
+	require.Equal(t, int64(4), events[0].Bytes)
+}
+
+func TestAuditSinks(t *testing.T) {
+	ctx := context.Background()
+	e := cloudstorage.AuditEvent{Principal: "ops", Op: cloudstorage.AuditDelete, Name: "a.csv"}
+
+	var buf bytes.Buffer
+	sink := cloudstorage.NewJSONAuditSink(&buf)
+	require.NoError(t, sink.Record(ctx, e))
+	require.NoError(t, sink.Record(ctx, e))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Equal(t, 2, len(lines))
+	var got cloudstorage.AuditEvent
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &got))
+	require.Equal(t, e.Principal, got.Principal)
+	require.Equal(t, e.Name, got.Name)
+
+	log := mockstore.New()
+	sink = cloudstorage.NewStoreAuditSink(log, "audit")
+	require.NoError(t, sink.Record(ctx, e))
+	iter, err := log.Objects(ctx, cloudstorage.NewQuery("audit/"))
+	require.NoError(t, err)
+	objs, err := cloudstorage.ObjectsAll(iter)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(objs))
+	require.True(t, strings.HasPrefix(objs[0].Name(), "audit/0001/01/01/000000.000000000-"))
+	data, err := cloudstorage.ReadAll(ctx, log, objs[0].Name())
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &got))
+	require.Equal(t, e.Op, got.Op)
+}
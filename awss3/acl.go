@@ -0,0 +1,67 @@
+package awss3
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+var _ cloudstorage.StoreACLSetter = (*FS)(nil)
+
+// SetObjectACL sets the private or public-read canned ACL of the object,
+// buckets enforcing object ownership reject ACLs.
+func (f *FS) SetObjectACL(ctx context.Context, name string, acl cloudstorage.ACL) error {
+	canned := s3.ObjectCannedACLPrivate
+	if acl == cloudstorage.ACLPublicRead {
+		canned = s3.ObjectCannedACLPublicRead
+	}
+	_, err := f.client.PutObjectAclWithContext(ctx, &s3.PutObjectAclInput{
+		Bucket: aws.String(f.bucket),
+		Key:    aws.String(name),
+		ACL:    aws.String(canned),
+	})
+	if err != nil && (strings.Contains(err.Error(), "NoSuchKey") || statusCode(err) == http.StatusNotFound) {
+		return cloudstorage.ErrObjectNotFound
+	}
+	return err
+}
+
+// validCannedACL is true for the s3 canned ACLs of objects, and "" for the
+// bucket default.
+func validCannedACL(acl string) bool {
+	if acl == "" {
+		return true
+	}
+	for _, v := range s3.ObjectCannedACL_Values() {
+		if acl == v {
+			return true
+		}
+	}
+	return false
+}
+
+// cannedACL of a write, Opts.CannedACL or the store's CannedACL, nil for
+// the bucket default.
+func (f *FS) cannedACL(opts []cloudstorage.Opts) *string {
+	acl := f.CannedACL
+	if len(opts) > 0 && opts[0].CannedACL != "" {
+		acl = opts[0].CannedACL
+	}
+	if acl == "" {
+		return nil
+	}
+	return aws.String(acl)
+}
+
+// expectedOwner of the bucket, nil for any.
+func (f *FS) expectedOwner() *string {
+	if f.ExpectedBucketOwner == "" {
+		return nil
+	}
+	return aws.String(f.ExpectedBucketOwner)
+}
@@ -0,0 +1,240 @@
+package awss3
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+// Server side encryption algorithms of SetBucketEncryption.
+const (
+	EncryptionAES256 = s3.ServerSideEncryptionAes256
+	EncryptionKMS    = s3.ServerSideEncryptionAwsKms
+)
+
+// APIStore manages the policies, ACLs and settings of s3 buckets, the
+// counterpart of the google APIStore.
+type APIStore struct {
+	client *s3.S3
+}
+
+// NewAPIStore create api store from the same config as the s3 store.
+func NewAPIStore(conf *cloudstorage.Config) (*APIStore, error) {
+	client, _, err := NewClient(conf)
+	if err != nil {
+		return nil, err
+	}
+	return &APIStore{client: client}, nil
+}
+
+// Grant of a bucket ACL.
+type Grant struct {
+	// Grantee is the canonical user ID, email or group URI granted.
+	Grantee string
+	// Permission is FULL_CONTROL, WRITE, WRITE_ACP, READ or READ_ACP.
+	Permission string
+}
+
+// PublicAccessBlock settings of a bucket, see the s3 PublicAccessBlock
+// configuration for their meaning.
+type PublicAccessBlock struct {
+	BlockPublicAcls       bool
+	IgnorePublicAcls      bool
+	BlockPublicPolicy     bool
+	RestrictPublicBuckets bool
+}
+
+// BlockAllPublicAccess blocks every kind of public access to a bucket.
+var BlockAllPublicAccess = PublicAccessBlock{
+	BlockPublicAcls:       true,
+	IgnorePublicAcls:      true,
+	BlockPublicPolicy:     true,
+	RestrictPublicBuckets: true,
+}
+
+// GetBucketPolicy returns the json policy of the bucket, "" if it has none.
+func (c *APIStore) GetBucketPolicy(ctx context.Context, bucket string) (string, error) {
+	res, err := c.client.GetBucketPolicyWithContext(ctx, &s3.GetBucketPolicyInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		if errorCode(err) == "NoSuchBucketPolicy" {
+			return "", nil
+		}
+		return "", err
+	}
+	return aws.StringValue(res.Policy), nil
+}
+
+// PutBucketPolicy replaces the policy of the bucket with the json policy, ""
+// deletes it.
+func (c *APIStore) PutBucketPolicy(ctx context.Context, bucket, policy string) error {
+	if policy == "" {
+		_, err := c.client.DeleteBucketPolicyWithContext(ctx, &s3.DeleteBucketPolicyInput{
+			Bucket: aws.String(bucket),
+		})
+		return err
+	}
+	_, err := c.client.PutBucketPolicyWithContext(ctx, &s3.PutBucketPolicyInput{
+		Bucket: aws.String(bucket),
+		Policy: aws.String(policy),
+	})
+	return err
+}
+
+// GetBucketACL returns the owner and grants of the bucket ACL.
+func (c *APIStore) GetBucketACL(ctx context.Context, bucket string) (string, []Grant, error) {
+	res, err := c.client.GetBucketAclWithContext(ctx, &s3.GetBucketAclInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	var owner string
+	if res.Owner != nil {
+		owner = aws.StringValue(res.Owner.ID)
+	}
+	grants := make([]Grant, 0, len(res.Grants))
+	for _, g := range res.Grants {
+		var grantee string
+		if g.Grantee != nil {
+			switch {
+			case g.Grantee.ID != nil:
+				grantee = aws.StringValue(g.Grantee.ID)
+			case g.Grantee.EmailAddress != nil:
+				grantee = aws.StringValue(g.Grantee.EmailAddress)
+			default:
+				grantee = aws.StringValue(g.Grantee.URI)
+			}
+		}
+		grants = append(grants, Grant{Grantee: grantee, Permission: aws.StringValue(g.Permission)})
+	}
+	return owner, grants, nil
+}
+
+// SetBucketCannedACL replaces the bucket ACL with a canned ACL, ie "private"
+// or "public-read".  Buckets with ACLs disabled (BucketOwnerEnforced object
+// ownership) only accept "private".
+func (c *APIStore) SetBucketCannedACL(ctx context.Context, bucket, acl string) error {
+	valid := false
+	for _, a := range s3.BucketCannedACL_Values() {
+		valid = valid || a == acl
+	}
+	if !valid {
+		return fmt.Errorf("invalid canned acl %q for bucket %s", acl, bucket)
+	}
+	_, err := c.client.PutBucketAclWithContext(ctx, &s3.PutBucketAclInput{
+		Bucket: aws.String(bucket),
+		ACL:    aws.String(acl),
+	})
+	return err
+}
+
+// GetPublicAccessBlock returns the public access block settings of the
+// bucket, nothing blocked if it has none.
+func (c *APIStore) GetPublicAccessBlock(ctx context.Context, bucket string) (PublicAccessBlock, error) {
+	res, err := c.client.GetPublicAccessBlockWithContext(ctx, &s3.GetPublicAccessBlockInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		if errorCode(err) == "NoSuchPublicAccessBlockConfiguration" {
+			return PublicAccessBlock{}, nil
+		}
+		return PublicAccessBlock{}, err
+	}
+	pab := res.PublicAccessBlockConfiguration
+	if pab == nil {
+		return PublicAccessBlock{}, nil
+	}
+	return PublicAccessBlock{
+		BlockPublicAcls:       aws.BoolValue(pab.BlockPublicAcls),
+		IgnorePublicAcls:      aws.BoolValue(pab.IgnorePublicAcls),
+		BlockPublicPolicy:     aws.BoolValue(pab.BlockPublicPolicy),
+		RestrictPublicBuckets: aws.BoolValue(pab.RestrictPublicBuckets),
+	}, nil
+}
+
+// SetPublicAccessBlock replaces the public access block settings of the
+// bucket, the zero PublicAccessBlock deletes them.
+func (c *APIStore) SetPublicAccessBlock(ctx context.Context, bucket string, pab PublicAccessBlock) error {
+	if pab == (PublicAccessBlock{}) {
+		_, err := c.client.DeletePublicAccessBlockWithContext(ctx, &s3.DeletePublicAccessBlockInput{
+			Bucket: aws.String(bucket),
+		})
+		return err
+	}
+	_, err := c.client.PutPublicAccessBlockWithContext(ctx, &s3.PutPublicAccessBlockInput{
+		Bucket: aws.String(bucket),
+		PublicAccessBlockConfiguration: &s3.PublicAccessBlockConfiguration{
+			BlockPublicAcls:       aws.Bool(pab.BlockPublicAcls),
+			IgnorePublicAcls:      aws.Bool(pab.IgnorePublicAcls),
+			BlockPublicPolicy:     aws.Bool(pab.BlockPublicPolicy),
+			RestrictPublicBuckets: aws.Bool(pab.RestrictPublicBuckets),
+		},
+	})
+	return err
+}
+
+// GetBucketEncryption returns the default encryption algorithm of the
+// bucket and its kms key ID, "" if it has none.
+func (c *APIStore) GetBucketEncryption(ctx context.Context, bucket string) (algorithm, kmsKeyID string, err error) {
+	res, err := c.client.GetBucketEncryptionWithContext(ctx, &s3.GetBucketEncryptionInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		if errorCode(err) == "ServerSideEncryptionConfigurationNotFoundError" {
+			return "", "", nil
+		}
+		return "", "", err
+	}
+	if res.ServerSideEncryptionConfiguration == nil {
+		return "", "", nil
+	}
+	for _, r := range res.ServerSideEncryptionConfiguration.Rules {
+		if d := r.ApplyServerSideEncryptionByDefault; d != nil {
+			return aws.StringValue(d.SSEAlgorithm), aws.StringValue(d.KMSMasterKeyID), nil
+		}
+	}
+	return "", "", nil
+}
+
+// SetBucketEncryption sets the default encryption of the objects written to
+// the bucket, EncryptionAES256 or EncryptionKMS with kmsKeyID ("" is the aws
+// managed key).
+func (c *APIStore) SetBucketEncryption(ctx context.Context, bucket, algorithm, kmsKeyID string) error {
+	switch algorithm {
+	case EncryptionAES256:
+		if kmsKeyID != "" {
+			return fmt.Errorf("invalid encryption for bucket %s: kms key with %s", bucket, algorithm)
+		}
+	case EncryptionKMS:
+	default:
+		return fmt.Errorf("invalid encryption algorithm %q for bucket %s", algorithm, bucket)
+	}
+	def := &s3.ServerSideEncryptionByDefault{SSEAlgorithm: aws.String(algorithm)}
+	if kmsKeyID != "" {
+		def.KMSMasterKeyID = aws.String(kmsKeyID)
+	}
+	_, err := c.client.PutBucketEncryptionWithContext(ctx, &s3.PutBucketEncryptionInput{
+		Bucket: aws.String(bucket),
+		ServerSideEncryptionConfiguration: &s3.ServerSideEncryptionConfiguration{
+			Rules: []*s3.ServerSideEncryptionRule{{ApplyServerSideEncryptionByDefault: def}},
+		},
+	})
+	return err
+}
+
+// errorCode of an s3 error, "" for other errors.
+func errorCode(err error) string {
+	var ae awserr.Error
+	if errors.As(err, &ae) {
+		return ae.Code()
+	}
+	return ""
+}
@@ -0,0 +1,93 @@
+package awss3
+
+import (
+	"fmt"
+
+	"github.com/araddon/gou"
+
+	"github.com/lytics/cloudstorage"
+)
+
+const (
+	// StoreTypeSpaces = "spaces" DigitalOcean Spaces, an s3 compatible store
+	// that only needs config Region (ie "nyc3") and access keys.
+	StoreTypeSpaces = "spaces"
+	// StoreTypeWasabi = "wasabi" Wasabi, an s3 compatible store that only
+	// needs config Region (ie "us-east-2") and access keys.
+	StoreTypeWasabi = "wasabi"
+)
+
+// Compatible describes how to reach an s3 compatible provider so the
+// awss3 store can be used from a config with only region and keys.
+type Compatible struct {
+	// EndpointTemplate is the endpoint url with a %s for the region.
+	EndpointTemplate string
+	// SigningRegion if set is used as the aws region for request signing
+	// instead of the config region.
+	SigningRegion string
+	// ForcePathStyle use path style bucket addressing.
+	ForcePathStyle bool
+}
+
+var (
+	// Spaces DigitalOcean Spaces endpoint defaults.
+	Spaces = Compatible{
+		EndpointTemplate: "https://%s.digitaloceanspaces.com",
+		SigningRegion:    "us-east-1",
+	}
+	// Wasabi endpoint defaults.
+	Wasabi = Compatible{
+		EndpointTemplate: "https://s3.%s.wasabisys.com",
+		ForcePathStyle:   true,
+	}
+)
+
+func init() {
+	cloudstorage.Register(StoreTypeSpaces, CompatibleProvider(Spaces))
+	cloudstorage.Register(StoreTypeWasabi, CompatibleProvider(Wasabi))
+	cloudstorage.AcceptAuthProviders(StoreTypeSpaces)
+	cloudstorage.AcceptAuthProviders(StoreTypeWasabi)
+}
+
+// CompatibleProvider creates a cloudstorage.StoreProvider for an s3 compatible
+// service.  An explicit config Endpoint or BaseUrl is left untouched, and
+// AuthMethod defaults to AuthAccessKey.
+func CompatibleProvider(c Compatible) cloudstorage.StoreProvider {
+	return func(conf *cloudstorage.Config) (cloudstorage.Store, error) {
+		s3conf, err := c.Config(conf)
+		if err != nil {
+			return nil, err
+		}
+		client, sess, err := NewClient(s3conf)
+		if err != nil {
+			return nil, err
+		}
+		return NewStore(client, sess, s3conf)
+	}
+}
+
+// Config returns a copy of conf with the s3 endpoint, region and path style
+// settings for this provider applied.
+func (c Compatible) Config(conf *cloudstorage.Config) (*cloudstorage.Config, error) {
+	s3conf := *conf
+	s3conf.Settings = make(gou.JsonHelper, len(conf.Settings)+1)
+	for k, v := range conf.Settings {
+		s3conf.Settings[k] = v
+	}
+	if s3conf.AuthMethod == "" {
+		s3conf.AuthMethod = AuthAccessKey
+	}
+	if s3conf.Endpoint == "" && s3conf.BaseUrl == "" {
+		if conf.Region == "" {
+			return nil, fmt.Errorf("invalid config: Region is required for store type %q", conf.Type)
+		}
+		s3conf.Endpoint = fmt.Sprintf(c.EndpointTemplate, conf.Region)
+	}
+	if c.SigningRegion != "" {
+		s3conf.Region = c.SigningRegion
+	}
+	if _, ok := s3conf.Settings[ConfKeyForcePathStyle]; !ok {
+		s3conf.Settings[ConfKeyForcePathStyle] = c.ForcePathStyle
+	}
+	return &s3conf, nil
+}
@@ -0,0 +1,125 @@
+package awss3
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/araddon/gou"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+const (
+	// minPartSize is the smallest size s3 accepts for any part of a
+	// multipart upload but the last.
+	minPartSize = 5 * 1024 * 1024
+	// maxPartCopySize is the largest source UploadPartCopy copies at once.
+	maxPartCopySize = 5 * 1024 * 1024 * 1024
+	// maxParts is the most parts a multipart upload can have.
+	maxParts = 10000
+)
+
+var _ cloudstorage.StoreComposer = (*FS)(nil)
+
+// Compose concatenates srcs into dst with a multipart upload copying one
+// source per part.  As s3 parts other than the last must be at least 5MiB,
+// sources that don't fit return ErrNotImplemented so cloudstorage.Compose
+// streams them instead.
+func (f *FS) Compose(ctx context.Context, dst string, srcs []string) error {
+	var parts []string
+	var sizes []int64
+	var first *s3.HeadObjectOutput
+	for _, src := range srcs {
+		head, err := f.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(f.bucket),
+			Key:    aws.String(src),
+		})
+		if statusCode(err) == http.StatusNotFound {
+			return cloudstorage.ErrObjectNotFound
+		} else if err != nil {
+			return err
+		}
+		if first == nil {
+			first = head
+		}
+		size := aws.Int64Value(head.ContentLength)
+		if size == 0 {
+			continue
+		}
+		if size > maxPartCopySize {
+			return fmt.Errorf("%w: s3 source %q is larger than 5GiB", cloudstorage.ErrNotImplemented, src)
+		}
+		parts = append(parts, src)
+		sizes = append(sizes, size)
+	}
+	for i := 0; i < len(parts)-1; i++ {
+		if sizes[i] < minPartSize {
+			return fmt.Errorf("%w: s3 source %q is smaller than 5MiB", cloudstorage.ErrNotImplemented, parts[i])
+		}
+	}
+	if len(parts) == 0 || len(parts) > maxParts {
+		return fmt.Errorf("%w: s3 compose of %d non empty sources", cloudstorage.ErrNotImplemented, len(parts))
+	}
+
+	mpu, err := f.client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:              aws.String(f.bucket),
+		Key:                 aws.String(dst),
+		ContentType:         first.ContentType,
+		ContentEncoding:     first.ContentEncoding,
+		Metadata:            first.Metadata,
+		ACL:                 f.cannedACL(nil),
+		ExpectedBucketOwner: f.expectedOwner(),
+	})
+	if err != nil {
+		return err
+	}
+	completed := make([]*s3.CompletedPart, 0, len(parts))
+	for i, src := range parts {
+		res, err := f.client.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+			Bucket:                    aws.String(f.bucket),
+			Key:                       aws.String(dst),
+			CopySource:                aws.String(url.PathEscape(f.bucket + "/" + src)),
+			PartNumber:                aws.Int64(int64(i + 1)),
+			UploadId:                  mpu.UploadId,
+			ExpectedBucketOwner:       f.expectedOwner(),
+			ExpectedSourceBucketOwner: f.expectedOwner(),
+		})
+		if err != nil {
+			f.abortMultipart(dst, mpu.UploadId)
+			return err
+		}
+		completed = append(completed, &s3.CompletedPart{
+			ETag:       res.CopyPartResult.ETag,
+			PartNumber: aws.Int64(int64(i + 1)),
+		})
+	}
+	_, err = f.client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:              aws.String(f.bucket),
+		Key:                 aws.String(dst),
+		UploadId:            mpu.UploadId,
+		MultipartUpload:     &s3.CompletedMultipartUpload{Parts: completed},
+		ExpectedBucketOwner: f.expectedOwner(),
+	})
+	if err != nil {
+		f.abortMultipart(dst, mpu.UploadId)
+		return err
+	}
+	return f.createFolderMarkers(ctx, dst)
+}
+
+// abortMultipart cleans up a failed multipart upload, uploaded parts are
+// billed until it is aborted.
+func (f *FS) abortMultipart(key string, uploadID *string) {
+	_, err := f.client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(f.bucket),
+		Key:      aws.String(key),
+		UploadId: uploadID,
+	})
+	if err != nil {
+		gou.Warnf("could not abort multipart upload of %q err=%v", key, err)
+	}
+}
@@ -0,0 +1,112 @@
+package awss3
+
+import (
+	"github.com/lytics/cloudstorage"
+)
+
+// S3Config is the typed form of the cloudstorage.Config fields and
+// Settings used by the s3 store.
+type S3Config struct {
+	AuthMethod cloudstorage.AuthMethod
+	Bucket     string
+	Region     string
+	Endpoint   string
+	BaseUrl    string
+	TmpDir     string
+
+	// AccessKey Settings[ConfKeyAccessKey], required for AuthAccessKey.
+	AccessKey string
+	// AccessSecret Settings[ConfKeyAccessSecret], required for AuthAccessKey.
+	AccessSecret   string
+	DisableSSL     bool
+	ForcePathStyle bool
+	DebugLog       bool
+	FolderMarkers  bool
+
+	// DownloadThreshold Settings[ConfKeyDownloadThreshold], nil uses
+	// DefaultDownloadThreshold.
+	DownloadThreshold *int
+	// DownloadPartSize Settings[ConfKeyDownloadPartSize], nil uses
+	// s3manager.DefaultDownloadPartSize.
+	DownloadPartSize *int
+	// DownloadConcurrency Settings[ConfKeyDownloadConcurrency], nil uses
+	// s3manager.DefaultDownloadConcurrency.
+	DownloadConcurrency *int
+	// PutThreshold Settings[ConfKeyPutThreshold], nil is 0.
+	PutThreshold *int
+	// CannedACL Settings[ConfKeyCannedACL], one of s3.ObjectCannedACL_Values
+	// or empty.
+	CannedACL string
+	// ExpectedBucketOwner Settings[ConfKeyExpectedBucketOwner].
+	ExpectedBucketOwner string
+}
+
+// NewS3Config converts a generic cloudstorage.Config into an S3Config.
+func NewS3Config(conf *cloudstorage.Config) *S3Config {
+	c := &S3Config{
+		AuthMethod:     conf.AuthMethod,
+		Bucket:         conf.Bucket,
+		Region:         conf.Region,
+		Endpoint:       conf.Endpoint,
+		BaseUrl:        conf.BaseUrl,
+		TmpDir:         conf.TmpDir,
+		AccessKey:      conf.Settings.String(ConfKeyAccessKey),
+		AccessSecret:   conf.Settings.String(ConfKeyAccessSecret),
+		DisableSSL:     conf.Settings.Bool(ConfKeyDisableSSL),
+		ForcePathStyle: conf.Settings.Bool(ConfKeyForcePathStyle),
+		DebugLog:       conf.Settings.Bool(ConfKeyDebugLog),
+		FolderMarkers:  conf.Settings.Bool(ConfKeyFolderMarkers),
+
+		CannedACL:           conf.Settings.String(ConfKeyCannedACL),
+		ExpectedBucketOwner: conf.Settings.String(ConfKeyExpectedBucketOwner),
+	}
+	if threshold, ok := conf.Settings.IntSafe(ConfKeyDownloadThreshold); ok {
+		c.DownloadThreshold = &threshold
+	}
+	if partSize, ok := conf.Settings.IntSafe(ConfKeyDownloadPartSize); ok {
+		c.DownloadPartSize = &partSize
+	}
+	if concurrency, ok := conf.Settings.IntSafe(ConfKeyDownloadConcurrency); ok {
+		c.DownloadConcurrency = &concurrency
+	}
+	if threshold, ok := conf.Settings.IntSafe(ConfKeyPutThreshold); ok {
+		c.PutThreshold = &threshold
+	}
+	return c
+}
+
+// Validate checks the config returning a *cloudstorage.ConfigError that
+// lists every missing or invalid key.
+func (c *S3Config) Validate() error {
+	e := &cloudstorage.ConfigError{Type: StoreType}
+	e.Require("bucket", c.Bucket)
+	e.Require("tmpdir", c.TmpDir)
+	switch c.AuthMethod {
+	case AuthAccessKey:
+		e.Require("settings."+ConfKeyAccessKey, c.AccessKey)
+		e.Require("settings."+ConfKeyAccessSecret, c.AccessSecret)
+	case AuthAnonymous:
+	case "":
+		e.Missing = append(e.Missing, "authmethod")
+	default:
+		if !cloudstorage.HasAuthProvider(StoreType, c.AuthMethod) {
+			e.Invalidf("authmethod %q is not supported or registered", c.AuthMethod)
+		}
+	}
+	if c.DownloadThreshold != nil && *c.DownloadThreshold < 0 {
+		e.Invalidf("settings.%s=%d must be >= 0", ConfKeyDownloadThreshold, *c.DownloadThreshold)
+	}
+	if c.DownloadPartSize != nil && *c.DownloadPartSize <= 0 {
+		e.Invalidf("settings.%s=%d must be > 0", ConfKeyDownloadPartSize, *c.DownloadPartSize)
+	}
+	if c.DownloadConcurrency != nil && *c.DownloadConcurrency <= 0 {
+		e.Invalidf("settings.%s=%d must be > 0", ConfKeyDownloadConcurrency, *c.DownloadConcurrency)
+	}
+	if c.PutThreshold != nil && *c.PutThreshold < 0 {
+		e.Invalidf("settings.%s=%d must be >= 0", ConfKeyPutThreshold, *c.PutThreshold)
+	}
+	if !validCannedACL(c.CannedACL) {
+		e.Invalidf("settings.%s=%q is not a canned ACL", ConfKeyCannedACL, c.CannedACL)
+	}
+	return e.Err()
+}
@@ -0,0 +1,81 @@
+package awss3
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"golang.org/x/net/context"
+)
+
+// isFolderMarker is true for the 0 byte "folder/" placeholder objects the
+// s3 console and other tools create, they aren't files of the folder.
+func isFolderMarker(o *s3.Object) bool {
+	return strings.HasSuffix(aws.StringValue(o.Key), "/") && aws.Int64Value(o.Size) == 0
+}
+
+// parentFolders of name, outermost first, "a/b/c.csv" has "a/" and "a/b/".
+func parentFolders(name string) []string {
+	var folders []string
+	for i, c := range name {
+		if c == '/' && i > 0 {
+			folders = append(folders, name[:i+1])
+		}
+	}
+	return folders
+}
+
+// createFolderMarkers puts the folder markers of the parent folders of name
+// when FolderMarkers is set, so consoles browsing by folder see them.
+func (f *FS) createFolderMarkers(ctx context.Context, name string) error {
+	if !f.FolderMarkers {
+		return nil
+	}
+	for _, folder := range parentFolders(name) {
+		_, err := f.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Bucket:              aws.String(f.bucket),
+			Key:                 aws.String(folder),
+			Body:                strings.NewReader(""),
+			ACL:                 f.cannedACL(nil),
+			ExpectedBucketOwner: f.expectedOwner(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteFolderMarkers deletes the folder markers of the parent folders of
+// name left empty when FolderMarkers is set, innermost first.  When the last
+// item in a folder is deleted the folder goes too, matching gcs.
+func (f *FS) deleteFolderMarkers(ctx context.Context, name string) error {
+	if !f.FolderMarkers {
+		return nil
+	}
+	folders := parentFolders(name)
+	for i := len(folders) - 1; i >= 0; i-- {
+		res, err := f.client.ListObjectsWithContext(ctx, &s3.ListObjectsInput{
+			Bucket:  aws.String(f.bucket),
+			Prefix:  aws.String(folders[i]),
+			MaxKeys: aws.Int64(2),
+		})
+		if err != nil {
+			return err
+		}
+		for _, o := range res.Contents {
+			if aws.StringValue(o.Key) != folders[i] {
+				// not empty; quit.
+				return nil
+			}
+		}
+		_, err = f.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(f.bucket),
+			Key:    aws.String(folders[i]),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
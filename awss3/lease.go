@@ -0,0 +1,121 @@
+package awss3
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+var _ cloudstorage.StoreLeaser = (*FS)(nil)
+
+// lease is held by a marker object written with s3 conditional puts, the
+// etag of our write is the precondition for renewing and releasing it.
+type lease struct {
+	fs  *FS
+	key string
+	id  string
+	ttl time.Duration
+
+	mu   sync.Mutex
+	etag string
+}
+
+// AcquireLease claims name by writing the marker object name+LeaseSuffix
+// with If-None-Match, an expired marker left by another owner is replaced.
+func (f *FS) AcquireLease(ctx context.Context, name string, ttl time.Duration) (cloudstorage.Lease, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("invalid lease ttl %v", ttl)
+	}
+	l := &lease{fs: f, key: name + cloudstorage.LeaseSuffix, id: cloudstorage.NewLeaseID(), ttl: ttl}
+	for try := 0; try < 2; try++ {
+		err := l.put(ctx, map[string]string{"If-None-Match": "*"})
+		if err == nil {
+			return l, nil
+		} else if !preconditionFailed(err) {
+			return nil, err
+		}
+
+		head, err := f.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(f.bucket),
+			Key:    aws.String(l.key),
+		})
+		if err != nil {
+			if strings.Contains(err.Error(), "Not Found") {
+				// released in between, try again
+				continue
+			}
+			return nil, err
+		}
+		md, _ := convertMetaData(head.Metadata)
+		if !cloudstorage.LeaseExpired(md, time.Now()) {
+			return nil, cloudstorage.ErrLeaseHeld
+		}
+		_, err = f.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(f.bucket),
+			Key:    aws.String(l.key),
+		}, request.WithSetRequestHeaders(map[string]string{"If-Match": aws.StringValue(head.ETag)}))
+		if err != nil && !preconditionFailed(err) {
+			return nil, err
+		}
+	}
+	return nil, cloudstorage.ErrLeaseHeld
+}
+
+func (l *lease) ID() string { return l.id }
+
+// Renew rewrites the marker with a new expiry if it is still ours.
+func (l *lease) Renew(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err := l.put(ctx, map[string]string{"If-Match": l.etag})
+	if preconditionFailed(err) || statusCode(err) == http.StatusNotFound {
+		return cloudstorage.ErrLeaseLost
+	}
+	return err
+}
+
+// Release deletes the marker if it is still ours.
+func (l *lease) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := l.fs.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(l.fs.bucket),
+		Key:    aws.String(l.key),
+	}, request.WithSetRequestHeaders(map[string]string{"If-Match": l.etag}))
+	if preconditionFailed(err) {
+		return cloudstorage.ErrLeaseLost
+	}
+	return err
+}
+
+// put writes the marker with a fresh expiry and the given conditional headers.
+func (l *lease) put(ctx context.Context, conditions map[string]string) error {
+	md := cloudstorage.LeaseMetaData(l.id, time.Now().Add(l.ttl))
+	res, err := l.fs.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:   aws.String(l.fs.bucket),
+		Key:      aws.String(l.key),
+		Body:     strings.NewReader(""),
+		Metadata: aws.StringMap(md),
+	}, request.WithSetRequestHeaders(conditions))
+	if err != nil {
+		return err
+	}
+	l.etag = aws.StringValue(res.ETag)
+	return nil
+}
+
+// preconditionFailed is the error of a conditional request that lost,
+// s3 returns 409 when a conflicting conditional write is in progress.
+func preconditionFailed(err error) bool {
+	sc := statusCode(err)
+	return sc == http.StatusPreconditionFailed || sc == http.StatusConflict
+}
@@ -0,0 +1,28 @@
+package awss3
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+
+	"github.com/lytics/cloudstorage"
+)
+
+// validateMetadataKeys checks the keys written as x-amz-meta- headers, s3
+// lowercases them so keys only differing in case would overwrite each
+// other.
+func validateMetadataKeys(metadata map[string]string) error {
+	seen := make(map[string]string, len(metadata))
+	for k := range metadata {
+		if !httpguts.ValidHeaderFieldName(k) {
+			return fmt.Errorf("%w: s3 key %q is not a valid http header name", cloudstorage.ErrInvalidMetadata, k)
+		}
+		lk := strings.ToLower(k)
+		if other, dup := seen[lk]; dup {
+			return fmt.Errorf("%w: s3 keys %q and %q only differ in case", cloudstorage.ErrInvalidMetadata, k, other)
+		}
+		seen[lk] = k
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package awss3
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+var _ cloudstorage.StoreSigner = (*FS)(nil)
+
+// SignedURL presigns a GetObject or PutObject request of the object with
+// the store's credentials, it is valid for at most 7 days.
+func (f *FS) SignedURL(ctx context.Context, name, method string, expires time.Duration) (string, error) {
+	var req *request.Request
+	if method == http.MethodPut {
+		req, _ = f.client.PutObjectRequest(&s3.PutObjectInput{
+			Bucket: aws.String(f.bucket),
+			Key:    aws.String(name),
+		})
+	} else {
+		req, _ = f.client.GetObjectRequest(&s3.GetObjectInput{
+			Bucket: aws.String(f.bucket),
+			Key:    aws.String(name),
+		})
+	}
+	req.SetContext(ctx)
+	return req.Presign(expires)
+}
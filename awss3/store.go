@@ -1,21 +1,27 @@
 package awss3
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/araddon/gou"
 	"github.com/pborman/uuid"
 	"golang.org/x/net/context"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
@@ -42,17 +48,54 @@ const (
 	ConfKeyDisableSSL = "disable_ssl"
 	// ConfKeyDebugLog config key to enable LogDebug log level
 	ConfKeyDebugLog = "debug_log"
+	// ConfKeyForcePathStyle config key to use path style (endpoint/bucket/key)
+	// addressing instead of virtual hosted (bucket.endpoint/key)
+	ConfKeyForcePathStyle = "force_path_style"
+	// ConfKeyFolderMarkers config key to create 0 byte "folder/" marker
+	// objects for the folders of written objects, and delete them once the
+	// folder is empty.
+	ConfKeyFolderMarkers = "folder_markers"
+	// ConfKeyDownloadThreshold config key of the object size in bytes from
+	// which Open downloads in parallel ranged parts, 0 disables it.
+	ConfKeyDownloadThreshold = "download_threshold"
+	// ConfKeyDownloadPartSize config key of the size in bytes of each ranged part.
+	ConfKeyDownloadPartSize = "download_part_size"
+	// ConfKeyDownloadConcurrency config key of the number of parts downloaded
+	// at once.
+	ConfKeyDownloadConcurrency = "download_concurrency"
+	// ConfKeyPutThreshold config key of the size in bytes up to which
+	// writers buffer the object in memory and upload it with a single
+	// PutObject with its Content-Length, as some s3 compatible endpoints
+	// require.  Larger objects switch to a multipart upload, 0 (the
+	// default) streams every object through one.
+	ConfKeyPutThreshold = "put_threshold"
+	// ConfKeyCannedACL config key of the canned ACL of the objects written
+	// and copied, ie "bucket-owner-full-control" for deliveries to a bucket
+	// of another account.  Empty leaves the bucket default.
+	ConfKeyCannedACL = "canned_acl"
+	// ConfKeyExpectedBucketOwner config key of the account id the bucket
+	// must belong to, uploads and copies to a bucket of another owner fail.
+	ConfKeyExpectedBucketOwner = "expected_bucket_owner"
 	// Authentication Source's
 
 	// AuthAccessKey is for using aws access key/secret pairs
 	AuthAccessKey cloudstorage.AuthMethod = "aws_access_key"
+	// AuthAnonymous is for unsigned requests, only useful for reading
+	// public buckets.
+	AuthAnonymous cloudstorage.AuthMethod = "anonymous"
 )
 
 var (
 	// Retries number of times to retry upon failures.
 	Retries = 3
+	// RetryBackoff delays between the Retries, the sdk already retried
+	// each request.
+	RetryBackoff = cloudstorage.BackoffProfile{Base: 500 * time.Millisecond, Max: 8 * time.Second, MaxElapsed: time.Minute}
 	// PageSize is default page size
 	PageSize = 2000
+	// DefaultDownloadThreshold objects of at least this many bytes are
+	// downloaded by Open in parallel ranged parts.
+	DefaultDownloadThreshold int64 = 64 * 1024 * 1024
 
 	// ErrNoS3Session no valid session
 	ErrNoS3Session = fmt.Errorf("no valid aws session was created")
@@ -62,25 +105,64 @@ var (
 	ErrNoAccessSecret = fmt.Errorf("no settings.access_secret")
 	// ErrNoAuth error for no findable auth
 	ErrNoAuth = fmt.Errorf("No auth provided")
+
+	// Ensure we implement the optional copier/mover
+	_ cloudstorage.StoreCopy = (*FS)(nil)
+	_ cloudstorage.StoreMove = (*FS)(nil)
+	// and ranged reads
+	_ cloudstorage.StoreRangeReader = (*FS)(nil)
+	// and recycles the objects of Query.Reuse listings
+	_ cloudstorage.ObjectRecycler = (*FS)(nil)
+
+	// objectPool holds the recycled objects of Query.Reuse listings.
+	objectPool = sync.Pool{New: func() interface{} { return &object{} }}
 )
 
 func init() {
 	// Register this Driver (s3) in cloudstorage driver registry.
 	cloudstorage.Register(StoreType, func(conf *cloudstorage.Config) (cloudstorage.Store, error) {
+		if err := NewS3Config(conf).Validate(); err != nil {
+			return nil, err
+		}
 		client, sess, err := NewClient(conf)
 		if err != nil {
 			return nil, err
 		}
 		return NewStore(client, sess, conf)
 	})
+	cloudstorage.AcceptAuthProviders(StoreType)
 }
 
 type (
 	// FS Simple wrapper for accessing s3 files, it doesn't currently implement a
 	// Reader/Writer interface so not useful for stream reading of large files yet.
 	FS struct {
-		PageSize  int
-		ID        string
+		PageSize int
+		ID       string
+		// DownloadThreshold objects of at least this size are downloaded in
+		// DownloadPartSize ranged parts, DownloadConcurrency at a time.
+		// 0 always downloads in a single request.
+		DownloadThreshold   int64
+		DownloadPartSize    int64
+		DownloadConcurrency int
+		// PutThreshold objects of at most this size are buffered by writers
+		// and uploaded in a single PutObject, 0 streams all of them through
+		// a multipart upload.
+		PutThreshold int64
+		// Timeouts of List, Folders, Get, readers, writers and Delete when
+		// the caller's context has no deadline.
+		Timeouts cloudstorage.Timeouts
+		// FolderMarkers creates "folder/" marker objects for the folders of
+		// written objects and deletes them when the folder is left empty.
+		// Markers are never listed as objects either way.
+		FolderMarkers bool
+		// CannedACL of the objects written and copied, Opts.CannedACL
+		// overrides it for a writer.  Empty leaves the bucket default.
+		CannedACL string
+		// ExpectedBucketOwner is the account id the bucket must belong to
+		// for uploads and copies to succeed, empty for any.
+		ExpectedBucketOwner string
+
 		client    *s3.S3
 		sess      *session.Session
 		endpoint  string
@@ -90,7 +172,6 @@ type (
 
 	object struct {
 		fs         *FS
-		o          *s3.GetObjectOutput
 		cachedcopy *os.File
 
 		name      string    // aka "key" in s3
@@ -100,6 +181,13 @@ type (
 		readonly  bool
 		opened    bool
 		cachepath string
+		size      int64
+		etag      string
+		// attrs the listing or HeadObject returned beyond the above
+		attrs cloudstorage.ObjectAttributes
+		// lean objects of a Query.Lean listing load their metadata on
+		// first use.
+		lean bool
 
 		infoOnce sync.Once
 		infoErr  error
@@ -138,14 +226,36 @@ func NewClient(conf *cloudstorage.Config) (*s3.S3, *session.Session, error) {
 			return nil, nil, ErrNoAccessSecret
 		}
 		awsConf.WithCredentials(credentials.NewStaticCredentials(accessKey, secretKey, ""))
+	case AuthAnonymous:
+		awsConf.WithCredentials(credentials.AnonymousCredentials)
 	default:
-		return nil, nil, ErrNoAuth
+		creds, ok, err := cloudstorage.AuthCredentials(conf)
+		if !ok {
+			return nil, nil, ErrNoAuth
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		// registered auth providers may return *credentials.Credentials
+		// or a credentials.Provider
+		switch c := creds.(type) {
+		case *credentials.Credentials:
+			awsConf.WithCredentials(c)
+		case credentials.Provider:
+			awsConf.WithCredentials(credentials.NewCredentials(c))
+		default:
+			return nil, nil, fmt.Errorf("unsupported credentials type %T from registered auth provider", creds)
+		}
 	}
 
 	if conf.BaseUrl != "" {
 		awsConf.WithEndpoint(conf.BaseUrl).WithS3ForcePathStyle(true)
 	}
 
+	if conf.Settings.Bool(ConfKeyForcePathStyle) {
+		awsConf.WithS3ForcePathStyle(true)
+	}
+
 	if conf.Settings.Bool(ConfKeyDebugLog) {
 		awsConf.WithLogLevel(aws.LogDebug)
 	}
@@ -178,15 +288,54 @@ func NewStore(c *s3.S3, sess *session.Session, conf *cloudstorage.Config) (*FS,
 
 	uid := uuid.NewUUID().String()
 	uid = strings.Replace(uid, "-", "", -1)
+	cachepath, err := cloudstorage.CacheDir(conf.TmpDir, uid)
+	if err != nil {
+		return nil, err
+	}
 
-	return &FS{
-		client:    c,
-		sess:      sess,
-		bucket:    conf.Bucket,
-		cachepath: conf.TmpDir,
-		ID:        uid,
-		PageSize:  cloudstorage.MaxResults,
-	}, nil
+	f := &FS{
+		client:              c,
+		sess:                sess,
+		bucket:              conf.Bucket,
+		cachepath:           cachepath,
+		ID:                  uid,
+		PageSize:            cloudstorage.MaxResults,
+		DownloadThreshold:   DefaultDownloadThreshold,
+		DownloadPartSize:    s3manager.DefaultDownloadPartSize,
+		DownloadConcurrency: s3manager.DefaultDownloadConcurrency,
+		Timeouts:            conf.Timeouts(),
+		FolderMarkers:       conf.Settings.Bool(ConfKeyFolderMarkers),
+		CannedACL:           conf.Settings.String(ConfKeyCannedACL),
+		ExpectedBucketOwner: conf.Settings.String(ConfKeyExpectedBucketOwner),
+	}
+	if !validCannedACL(f.CannedACL) {
+		return nil, fmt.Errorf("invalid config: %s=%q is not a canned ACL", ConfKeyCannedACL, f.CannedACL)
+	}
+	if threshold, ok := conf.Settings.IntSafe(ConfKeyDownloadThreshold); ok {
+		if threshold < 0 {
+			return nil, fmt.Errorf("invalid config: %s=%d must be >= 0", ConfKeyDownloadThreshold, threshold)
+		}
+		f.DownloadThreshold = int64(threshold)
+	}
+	if partSize, ok := conf.Settings.IntSafe(ConfKeyDownloadPartSize); ok {
+		if partSize <= 0 {
+			return nil, fmt.Errorf("invalid config: %s=%d must be > 0", ConfKeyDownloadPartSize, partSize)
+		}
+		f.DownloadPartSize = int64(partSize)
+	}
+	if concurrency, ok := conf.Settings.IntSafe(ConfKeyDownloadConcurrency); ok {
+		if concurrency <= 0 {
+			return nil, fmt.Errorf("invalid config: %s=%d must be > 0", ConfKeyDownloadConcurrency, concurrency)
+		}
+		f.DownloadConcurrency = concurrency
+	}
+	if threshold, ok := conf.Settings.IntSafe(ConfKeyPutThreshold); ok {
+		if threshold < 0 {
+			return nil, fmt.Errorf("invalid config: %s=%d must be >= 0", ConfKeyPutThreshold, threshold)
+		}
+		f.PutThreshold = int64(threshold)
+	}
+	return f, nil
 }
 
 // Type of store = "s3"
@@ -194,6 +343,49 @@ func (f *FS) Type() string {
 	return StoreType
 }
 
+// CleanCache removes stale cache files from the store's TmpDir, see
+// cloudstorage.CleanCache.
+func (f *FS) CleanCache(ctx context.Context, olderThan time.Duration) error {
+	return cloudstorage.CleanCache(ctx, f.cachepath, olderThan)
+}
+
+// CachePath is the cache directory of the store below its TmpDir.
+func (f *FS) CachePath() string {
+	return f.cachepath
+}
+
+// UpdatedGranularity of s3, LastModified only has seconds.
+func (f *FS) UpdatedGranularity() time.Duration {
+	return time.Second
+}
+
+// Capabilities of s3, deletes may take a while to show in listings.
+func (f *FS) Capabilities() cloudstorage.Capabilities {
+	return cloudstorage.Capabilities{ETags: true, Concurrent: true, ConsistencyDelay: 5 * time.Second}
+}
+
+// IsTransient is true for s3 errors worth retrying: throttling, server
+// errors and network errors, not the 4xx of a denied permission or a
+// missing bucket, nor missing credentials.
+func (f *FS) IsTransient(err error) bool {
+	if !cloudstorage.DefaultIsTransient(err) {
+		return false
+	}
+	switch errorCode(err) {
+	case request.CanceledErrorCode, "NoCredentialProviders":
+		return false
+	}
+	if code := statusCode(err); code != 0 {
+		return cloudstorage.IsTransientStatus(code)
+	}
+	return true
+}
+
+// BackoffProfile of s3 is RetryBackoff.
+func (f *FS) BackoffProfile() cloudstorage.BackoffProfile {
+	return RetryBackoff
+}
+
 // Client gets access to the underlying s3 cloud storage client.
 func (f *FS) Client() interface{} {
 	return f.client
@@ -205,11 +397,17 @@ func (f *FS) String() string {
 }
 
 // NewObject of Type s3.
-func (f *FS) NewObject(objectname string) (cloudstorage.Object, error) {
+func (f *FS) NewObject(objectname string, opts ...cloudstorage.Opts) (cloudstorage.Object, error) {
+	if len(opts) > 0 && opts[0].WriteThrough {
+		return cloudstorage.NewWriteThroughObject(f, objectname, opts[0])
+	}
 	obj, err := f.Get(context.Background(), objectname)
 	if err != nil && err != cloudstorage.ErrObjectNotFound {
 		return nil, err
 	} else if obj != nil {
+		if len(opts) > 0 && opts[0].Overwrite {
+			return obj, nil
+		}
 		return nil, cloudstorage.ErrObjectExists
 	}
 
@@ -225,8 +423,11 @@ func (f *FS) NewObject(objectname string) (cloudstorage.Object, error) {
 	}, nil
 }
 
-// Get a single File Object
+// Get a single File Object, its size, etag and metadata come from a
+// HeadObject request so none of the content is transferred.
 func (f *FS) Get(ctx context.Context, objectpath string) (cloudstorage.Object, error) {
+	ctx, cancel := cloudstorage.WithTimeout(ctx, f.Timeouts.Read)
+	defer cancel()
 
 	obj, err := f.getObjectMeta(ctx, objectpath)
 	if err != nil {
@@ -248,8 +449,8 @@ func (f *FS) getObjectMeta(ctx context.Context, objectname string) (*object, err
 
 	res, err := f.client.HeadObjectWithContext(ctx, req)
 	if err != nil {
-		// translate the string error to typed error
-		if strings.Contains(err.Error(), "Not Found") {
+		// a HEAD response has no body, so no NoSuchKey code either
+		if statusCode(err) == http.StatusNotFound || strings.Contains(err.Error(), "Not Found") {
 			return nil, cloudstorage.ErrObjectNotFound
 		}
 		return nil, err
@@ -289,41 +490,101 @@ func convertMetaData(m map[string]*string) (map[string]string, error) {
 
 // List objects from this store.
 func (f *FS) List(ctx context.Context, q cloudstorage.Query) (*cloudstorage.ObjectsResponse, error) {
+	ctx, cancel := cloudstorage.WithTimeout(ctx, f.Timeouts.List)
+	defer cancel()
+	if len(q.TagFilter) > 0 {
+		// tags aren't listed, filtering would need a request per object
+		return nil, cloudstorage.ErrNotImplemented
+	}
 
 	itemLimit := int64(f.PageSize)
 	if q.PageSize > 0 {
 		itemLimit = int64(q.PageSize)
 	}
 
+	marker := q.Marker
+	if q.StartOffset != "" && marker < q.StartOffset {
+		marker = startMarker(q.StartOffset)
+	}
 	params := &s3.ListObjectsInput{
 		Bucket:  aws.String(f.bucket),
-		Marker:  &q.Marker,
+		Marker:  &marker,
 		MaxKeys: &itemLimit,
 		Prefix:  &q.Prefix,
 	}
+	if q.Delimiter != "" {
+		params.Delimiter = &q.Delimiter
+	}
 
-	resp, err := f.client.ListObjects(params)
+	resp, err := f.client.ListObjectsWithContext(ctx, params)
 	if err != nil {
 		gou.Warnf("err = %v", err)
 		return nil, err
 	}
 
 	objResp := &cloudstorage.ObjectsResponse{
-		Objects: make(cloudstorage.Objects, len(resp.Contents)),
+		Objects: make(cloudstorage.Objects, 0, len(resp.Contents)),
 	}
 
-	for i, o := range resp.Contents {
-		objResp.Objects[i] = newObject(f, o)
+	// keys are listed in order, past the EndOffset there is nothing more
+	pastEnd := false
+	for _, o := range resp.Contents {
+		if q.EndOffset != "" && aws.StringValue(o.Key) >= q.EndOffset {
+			pastEnd = true
+			break
+		}
+		if isFolderMarker(o) || !q.Match(aws.StringValue(o.Key), aws.Int64Value(o.Size)) {
+			continue
+		}
+		obj := newObject(f, o, q.Reuse)
+		obj.lean = q.Lean
+		objResp.Objects = append(objResp.Objects, obj)
+	}
+	for _, cp := range resp.CommonPrefixes {
+		if q.EndOffset != "" && *cp.Prefix >= q.EndOffset {
+			pastEnd = true
+			continue
+		}
+		objResp.Prefixes = append(objResp.Prefixes, *cp.Prefix)
 	}
 
-	if resp.IsTruncated != nil && *resp.IsTruncated {
-		lastObj := *resp.Contents[len(resp.Contents)-1].Key
-		objResp.NextMarker = lastObj
+	if !pastEnd && resp.IsTruncated != nil && *resp.IsTruncated {
+		if resp.NextMarker != nil {
+			// only returned when a delimiter was used
+			objResp.NextMarker = *resp.NextMarker
+		} else if len(resp.Contents) > 0 {
+			objResp.NextMarker = *resp.Contents[len(resp.Contents)-1].Key
+		}
 	}
+	objResp.Objects = q.ApplyFilters(objResp.Objects)
 
 	return objResp, nil
 }
 
+// Recycle the objects of a Query.Reuse listing page for the next pages.
+func (f *FS) Recycle(objects cloudstorage.Objects) {
+	for _, o := range objects {
+		if obj, ok := o.(*object); ok && obj.fs == f {
+			*obj = object{}
+			objectPool.Put(obj)
+		}
+	}
+}
+
+// startMarker is the marker to list the keys >= offset from, s3 lists the
+// keys after the marker.  It sorts just before offset, when offset ends in
+// a non ASCII character the few keys between the marker and offset are
+// dropped by Query.Match.
+func startMarker(offset string) string {
+	r, size := utf8.DecodeLastRuneInString(offset)
+	marker := offset[:len(offset)-size]
+	if r > 1 && r < utf8.RuneSelf {
+		// the preceding character followed by the largest one
+		marker += string(r-1) + string(utf8.MaxRune)
+	}
+	return marker
+}
+
 func (o *object) DisableCompression() {}
 
 // Objects returns an iterator over the objects in the s3 bucket that match the Query q.
@@ -334,87 +595,51 @@ func (f *FS) Objects(ctx context.Context, q cloudstorage.Query) (cloudstorage.Ob
 
 // Folders get folders list.
 func (f *FS) Folders(ctx context.Context, q cloudstorage.Query) ([]string, error) {
-
-	q.Delimiter = "/"
-
-	// Think we should just put 1 here right?
-	itemLimit := int64(f.PageSize)
-	if q.PageSize > 0 {
-		itemLimit = int64(q.PageSize)
-	}
-
-	params := &s3.ListObjectsInput{
-		Bucket:    aws.String(f.bucket),
-		MaxKeys:   &itemLimit,
-		Prefix:    &q.Prefix,
-		Delimiter: &q.Delimiter,
+	ctx, cancel := cloudstorage.WithTimeout(ctx, f.Timeouts.List)
+	defer cancel()
+	iter, err := f.FolderIterator(ctx, q)
+	if err != nil {
+		return nil, err
 	}
+	defer iter.Close()
+	return cloudstorage.FoldersAll(iter)
+}
 
-	folders := make([]string, 0)
-
-	for {
-		select {
-		case <-ctx.Done():
-			// If has been closed
-			return folders, ctx.Err()
-		default:
-			if q.Marker != "" {
-				params.Marker = &q.Marker
-			}
-			resp, err := f.client.ListObjectsWithContext(ctx, params)
-			if err != nil {
-				return nil, err
-			}
-			for _, cp := range resp.CommonPrefixes {
-				folders = append(folders, strings.TrimPrefix(*cp.Prefix, `/`))
-			}
-			return folders, nil
-		}
-	}
+// FolderIterator returns an iterator over the folders below the Query prefix.
+func (f *FS) FolderIterator(ctx context.Context, q cloudstorage.Query) (cloudstorage.FolderIterator, error) {
+	return cloudstorage.NewFolderPageIterator(ctx, f, q), nil
 }
 
-/*
-// Copy from src to destination
+// Copy from src to destination server side with CopyObject, the metadata is
+// copied too.  Sources larger than 5GiB return ErrNotImplemented so
+// cloudstorage.Copy streams them instead.
 func (f *FS) Copy(ctx context.Context, src, des cloudstorage.Object) error {
-
-	so, ok := src.(*object)
-	if !ok {
-		return fmt.Errorf("Copy source file expected s3 but got %T", src)
+	if so, ok := src.(cloudstorage.ObjectSizer); ok && so.Size() > maxPartCopySize {
+		return fmt.Errorf("%w: s3 copy source %q is larger than 5GiB", cloudstorage.ErrNotImplemented, src.Name())
 	}
-	do, ok := des.(*object)
-	if !ok {
-		return fmt.Errorf("Copy destination expected s3 but got %T", des)
+	_, err := f.client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+		Bucket:                    aws.String(f.bucket),
+		Key:                       aws.String(des.Name()),
+		CopySource:                aws.String(url.PathEscape(f.bucket + "/" + src.Name())),
+		ACL:                       f.cannedACL(nil),
+		ExpectedBucketOwner:       f.expectedOwner(),
+		ExpectedSourceBucketOwner: f.expectedOwner(),
+	})
+	if statusCode(err) == http.StatusNotFound {
+		return cloudstorage.ErrObjectNotFound
+	} else if err != nil {
+		return err
 	}
-
-	oh := so.b.Object(so.name)
-	dh := do.b.Object(do.name)
-
-	_, err := dh.CopierFrom(oh).Run(ctx)
-	return err
+	return f.createFolderMarkers(ctx, des.Name())
 }
 
 // Move which is a Copy & Delete
 func (f *FS) Move(ctx context.Context, src, des cloudstorage.Object) error {
-
-	so, ok := src.(*object)
-	if !ok {
-		return fmt.Errorf("Move source file expected s3 but got %T", src)
-	}
-	do, ok := des.(*object)
-	if !ok {
-		return fmt.Errorf("Move destination expected s3 but got %T", des)
-	}
-
-	oh := so.b.Object(so.name)
-	dh := do.b.Object(des.name)
-
-	if _, err := dh.CopierFrom(oh).Run(ctx); err != nil {
+	if err := f.Copy(ctx, src, des); err != nil {
 		return err
 	}
-
-	return oh.Delete(ctx)
+	return f.Delete(ctx, src.Name())
 }
-*/
 
 // NewReader create file reader.
 func (f *FS) NewReader(o string) (io.ReadCloser, error) {
@@ -423,18 +648,58 @@ func (f *FS) NewReader(o string) (io.ReadCloser, error) {
 
 // NewReaderWithContext create new File reader with context.
 func (f *FS) NewReaderWithContext(ctx context.Context, objectname string) (io.ReadCloser, error) {
+	return f.NewReaderWithOpts(ctx, objectname)
+}
+
+// NewReaderWithOpts create new File reader honoring Opts.IfNoneMatch.
+func (f *FS) NewReaderWithOpts(ctx context.Context, objectname string, opts ...cloudstorage.Opts) (io.ReadCloser, error) {
+	input := &s3.GetObjectInput{
+		Key:    aws.String(objectname),
+		Bucket: aws.String(f.bucket),
+	}
+	if len(opts) > 0 && opts[0].IfNoneMatch != "" {
+		input.IfNoneMatch = aws.String(`"` + cloudstorage.CleanETag(opts[0].IfNoneMatch) + `"`)
+	}
+	ctx, cancel := cloudstorage.WithTimeout(ctx, f.Timeouts.Read)
+	res, err := f.client.GetObjectWithContext(ctx, input)
+	if err != nil {
+		cancel()
+		// translate the string error to typed error
+		if strings.Contains(err.Error(), "NoSuchKey") {
+			return nil, cloudstorage.ErrObjectNotFound
+		}
+		if statusCode(err) == http.StatusNotModified {
+			return nil, cloudstorage.ErrNotModified
+		}
+		return nil, err
+	}
+	return cloudstorage.NewCancelReader(res.Body, cancel), nil
+}
+
+// NewRangeReader reads length bytes of object objectname from offset, to
+// the end if length is negative.
+func (f *FS) NewRangeReader(ctx context.Context, objectname string, offset, length int64) (io.ReadCloser, error) {
+	rng := fmt.Sprintf("bytes=%d-", offset)
+	if length >= 0 {
+		if length == 0 {
+			return io.NopCloser(strings.NewReader("")), nil
+		}
+		rng = fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	}
+	ctx, cancel := cloudstorage.WithTimeout(ctx, f.Timeouts.Read)
 	res, err := f.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
 		Key:    aws.String(objectname),
 		Bucket: aws.String(f.bucket),
+		Range:  aws.String(rng),
 	})
 	if err != nil {
-		// translate the string error to typed error
+		cancel()
 		if strings.Contains(err.Error(), "NoSuchKey") {
 			return nil, cloudstorage.ErrObjectNotFound
 		}
 		return nil, err
 	}
-	return res.Body, nil
+	return cloudstorage.NewCancelReader(res.Body, cancel), nil
 }
 
 // NewWriter create Object Writer.
@@ -447,46 +712,185 @@ func (f *FS) NewWriterWithContext(ctx context.Context, objectName string, metada
 	if len(opts) > 0 && opts[0].IfNotExists {
 		return nil, fmt.Errorf("options IfNotExists not supported for store type")
 	}
+	metadata, err := cloudstorage.NormalizeMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateMetadataKeys(metadata); err != nil {
+		return nil, err
+	}
+	if len(opts) > 0 && !validCannedACL(opts[0].CannedACL) {
+		return nil, fmt.Errorf("%q is not a canned ACL", opts[0].CannedACL)
+	}
+	acl := f.cannedACL(opts)
+
+	// the upload outlives Close of the writer, so it owns the timeout
+	ctx, cancel := cloudstorage.WithTimeout(ctx, f.Timeouts.Write)
+	if f.PutThreshold > 0 {
+		w := &putWriter{f: f, ctx: ctx, cancel: cancel, name: objectName, metadata: metadata, acl: acl}
+		return cloudstorage.NewResultWriter(w, w.result), nil
+	}
+	w := f.newUploadWriter(ctx, cancel, objectName, metadata, acl)
+	return cloudstorage.NewResultWriter(w, w.result), nil
+}
 
+// uploadWriter streams an object through a pipe to a multipart upload.
+type uploadWriter struct {
+	io.WriteCloser
+	done chan error
+	out  *s3manager.UploadOutput
+}
+
+func (f *FS) newUploadWriter(ctx context.Context, cancel context.CancelFunc, objectName string, metadata map[string]string, acl *string) *uploadWriter {
 	// Create an uploader with the session and default options
 	uploader := s3manager.NewUploader(f.sess)
 
 	pr, pw := io.Pipe()
-	bw := csbufio.NewWriter(ctx, pw)
-
+	w := &uploadWriter{WriteCloser: csbufio.NewWriter(ctx, pw), done: make(chan error, 1)}
 	go func() {
+		defer cancel()
 		// TODO:  this needs to be managed, ie shutdown signals, close, handler err etc.
 
 		// Upload the file to S3.
-		_, err := uploader.UploadWithContext(ctx, &s3manager.UploadInput{
-			Bucket: aws.String(f.bucket),
-			Key:    aws.String(objectName),
-			Body:   pr,
+		var err error
+		w.out, err = uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+			Bucket:              aws.String(f.bucket),
+			Key:                 aws.String(objectName),
+			Body:                pr,
+			Metadata:            aws.StringMap(metadata),
+			ACL:                 acl,
+			ExpectedBucketOwner: f.expectedOwner(),
 		})
 		if err != nil {
 			gou.Warnf("could not upload %v", err)
+			// fail the writes still blocked on the pipe
+			pr.CloseWithError(err)
+		} else if err := f.createFolderMarkers(ctx, objectName); err != nil {
+			gou.Warnf("could not create folder markers of %s %v", objectName, err)
 		}
+		w.done <- err
 	}()
+	return w
+}
 
-	return bw, nil
+// result waits for the upload to finish.
+func (w *uploadWriter) result(r *cloudstorage.UploadResult) error {
+	if err := <-w.done; err != nil {
+		return err
+	}
+	r.ETag = cloudstorage.CleanETag(aws.StringValue(w.out.ETag))
+	r.VersionID = aws.StringValue(w.out.VersionID)
+	return nil
+}
+
+// putWriter buffers up to FS.PutThreshold bytes of an object, uploaded by
+// Close with a single PutObject of known Content-Length.  Larger objects
+// switch to an uploadWriter.
+type putWriter struct {
+	f        *FS
+	ctx      context.Context
+	cancel   context.CancelFunc
+	name     string
+	metadata map[string]string
+	acl      *string
+	buf      bytes.Buffer
+	up       *uploadWriter
+	out      *s3.PutObjectOutput
+}
+
+func (w *putWriter) Write(p []byte) (int, error) {
+	if w.up != nil {
+		return w.up.Write(p)
+	}
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if int64(w.buf.Len()+len(p)) <= w.f.PutThreshold {
+		return w.buf.Write(p)
+	}
+	w.up = w.f.newUploadWriter(w.ctx, w.cancel, w.name, w.metadata, w.acl)
+	if _, err := w.up.Write(w.buf.Bytes()); err != nil {
+		return 0, err
+	}
+	w.buf = bytes.Buffer{}
+	return w.up.Write(p)
+}
+
+func (w *putWriter) Close() error {
+	if w.up != nil {
+		return w.up.Close()
+	}
+	defer w.cancel()
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	var err error
+	w.out, err = w.f.client.PutObjectWithContext(w.ctx, &s3.PutObjectInput{
+		Bucket:              aws.String(w.f.bucket),
+		Key:                 aws.String(w.name),
+		Body:                bytes.NewReader(w.buf.Bytes()),
+		ContentLength:       aws.Int64(int64(w.buf.Len())),
+		Metadata:            aws.StringMap(w.metadata),
+		ACL:                 w.acl,
+		ExpectedBucketOwner: w.f.expectedOwner(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := w.f.createFolderMarkers(w.ctx, w.name); err != nil {
+		gou.Warnf("could not create folder markers of %s %v", w.name, err)
+	}
+	return nil
+}
+
+func (w *putWriter) result(r *cloudstorage.UploadResult) error {
+	if w.up != nil {
+		return w.up.result(r)
+	}
+	r.ETag = cloudstorage.CleanETag(aws.StringValue(w.out.ETag))
+	r.VersionID = aws.StringValue(w.out.VersionId)
+	return nil
 }
 
 // Delete requested object path string.
-func (f *FS) Delete(ctx context.Context, obj string) error {
+func (f *FS) Delete(ctx context.Context, obj string, opts ...cloudstorage.Opts) error {
+	ctx, cancel := cloudstorage.WithTimeout(ctx, f.Timeouts.Write)
+	defer cancel()
 	params := &s3.DeleteObjectInput{
 		Bucket: aws.String(f.bucket),
 		Key:    aws.String(obj),
 	}
+	var reqOpts []request.Option
+	if len(opts) > 0 {
+		if opts[0].VersionID != "" {
+			params.VersionId = aws.String(opts[0].VersionID)
+		}
+		if opts[0].IfMatch != "" {
+			reqOpts = append(reqOpts, request.WithSetRequestHeaders(map[string]string{
+				"If-Match": `"` + cloudstorage.CleanETag(opts[0].IfMatch) + `"`,
+			}))
+		}
+	}
 
-	_, err := f.client.DeleteObjectWithContext(ctx, params)
+	_, err := f.client.DeleteObjectWithContext(ctx, params, reqOpts...)
 	if err != nil {
+		if statusCode(err) == http.StatusPreconditionFailed {
+			return cloudstorage.ErrPreconditionFailed
+		}
 		return err
 	}
-	return nil
+	return f.deleteFolderMarkers(ctx, obj)
 }
 
-func newObject(f *FS, o *s3.Object) *object {
-	obj := &object{
+// newObject of a listed key, taken from the recycled ones when reuse.
+func newObject(f *FS, o *s3.Object, reuse bool) *object {
+	var obj *object
+	if reuse {
+		obj = objectPool.Get().(*object)
+	} else {
+		obj = &object{}
+	}
+	*obj = object{
 		fs:        f,
 		name:      *o.Key,
 		bucket:    f.bucket,
@@ -495,6 +899,11 @@ func newObject(f *FS, o *s3.Object) *object {
 	if o.LastModified != nil {
 		obj.updated = *o.LastModified
 	}
+	if o.Size != nil {
+		obj.size = *o.Size
+	}
+	obj.etag = cloudstorage.CleanETag(aws.StringValue(o.ETag))
+	obj.attrs.StorageClass = aws.StringValue(o.StorageClass)
 	return obj
 }
 func newObjectFromHead(f *FS, name string, o *s3.HeadObjectOutput) *object {
@@ -507,11 +916,71 @@ func newObjectFromHead(f *FS, name string, o *s3.HeadObjectOutput) *object {
 	if o.LastModified != nil {
 		obj.updated = *o.LastModified
 	}
-	// metadata?
+	if o.ContentLength != nil {
+		obj.size = *o.ContentLength
+	}
+	obj.etag = cloudstorage.CleanETag(aws.StringValue(o.ETag))
+	obj.attrs = cloudstorage.ObjectAttributes{
+		ContentType:     aws.StringValue(o.ContentType),
+		ContentEncoding: aws.StringValue(o.ContentEncoding),
+		CacheControl:    aws.StringValue(o.CacheControl),
+		StorageClass:    aws.StringValue(o.StorageClass),
+		VersionID:       aws.StringValue(o.VersionId),
+	}
+	if obj.attrs.StorageClass == "" {
+		// only returned for the other classes
+		obj.attrs.StorageClass = s3.StorageClassStandard
+	}
+	obj.attrs.CustomMetadata, _ = convertMetaData(o.Metadata)
 	obj.metadata, _ = convertMetaData(o.Metadata)
+	if _, ok := obj.metadata[cloudstorage.ContentTypeKey]; !ok && o.ContentType != nil {
+		obj.metadata[cloudstorage.ContentTypeKey] = *o.ContentType
+	}
 	return obj
 }
 
+// load the attributes and metadata of a lean object with a HeadObject.
+func (o *object) load() {
+	if !o.lean {
+		return
+	}
+	o.lean = false
+	ctx, cancel := cloudstorage.WithTimeout(context.Background(), o.fs.Timeouts.Read)
+	defer cancel()
+	loaded, err := o.fs.getObjectMeta(ctx, o.name)
+	if err != nil {
+		gou.Warnf("could not load the attributes of %s err=%v", o.name, err)
+		return
+	}
+	o.attrs, o.metadata = loaded.attrs, loaded.metadata
+}
+
+func (o *object) Size() int64 {
+	return o.size
+}
+
+// Attrs of the object, listed objects have no content type, encoding or
+// metadata, those come with Get, or on first use for lean listings.
+func (o *object) Attrs() cloudstorage.ObjectAttributes {
+	o.load()
+	a := o.attrs
+	a.Size, a.Updated, a.ETag = o.size, o.Updated(), o.etag
+	return a
+}
+
+func (o *object) ETag() string {
+	return o.etag
+}
+
+// Hashes the etag is the md5 of objects not uploaded in parts (which have a
+// "-<parts>" suffix).
+func (o *object) Hashes() map[string]string {
+	h := make(map[string]string, 1)
+	if len(o.etag) == 32 && !strings.Contains(o.etag, "-") {
+		h[cloudstorage.HashMD5] = o.etag
+	}
+	return h
+}
 func (o *object) StorageSource() string {
 	return StoreType
 }
@@ -522,12 +991,14 @@ func (o *object) String() string {
 	return o.name
 }
 func (o *object) Updated() time.Time {
-	return o.updated
+	return o.updated.UTC()
 }
 func (o *object) MetaData() map[string]string {
+	o.load()
 	return o.metadata
 }
 func (o *object) SetMetaData(meta map[string]string) {
+	o.lean = false
 	o.metadata = meta
 }
 
@@ -560,47 +1031,18 @@ func (o *object) Open(accesslevel cloudstorage.AccessLevel) (*os.File, error) {
 		return nil, fmt.Errorf("error occurred creating file. local=%s err=%v", o.cachepath, err)
 	}
 
+	bo := cloudstorage.NewBackoffer(RetryBackoff)
 	for try := 0; try < Retries; try++ {
-		if o.o == nil {
-			obj, err := o.fs.getS3OpenObject(context.Background(), o.name)
-			if err != nil {
-				if err == cloudstorage.ErrObjectNotFound {
-					// New, this is fine
-				} else {
-					// lets re-try
-					errs = append(errs, fmt.Errorf("error getting object err=%v", err))
-					cloudstorage.Backoff(try)
-					continue
-				}
-			}
-
-			if obj != nil {
-				o.o = obj
-			}
-		}
-
-		if o.o != nil {
-			// we have a preexisting object, so lets download it..
-			defer o.o.Body.Close()
-
-			if _, err := cachedcopy.Seek(0, os.SEEK_SET); err != nil {
-				return nil, fmt.Errorf("error seeking to start of cachedcopy err=%v", err) //don't retry on local fs errors
-			}
-
-			_, err = io.Copy(cachedcopy, o.o.Body)
-			if err != nil {
-				errs = append(errs, fmt.Errorf("error coping bytes. err=%v", err))
-				//recreate the cachedcopy file incase it has incomplete data
-				if err := os.Remove(o.cachepath); err != nil {
-					return nil, fmt.Errorf("error resetting the cachedcopy err=%v", err) //don't retry on local fs errors
-				}
-				if cachedcopy, err = os.Create(o.cachepath); err != nil {
-					return nil, fmt.Errorf("error creating a new cachedcopy file. local=%s err=%v", o.cachepath, err)
-				}
-
-				cloudstorage.Backoff(try)
-				continue
+		// every attempt downloads a fresh stream, a body left over from an
+		// earlier request may have long expired
+		if err := o.download(cachedcopy); err == cloudstorage.ErrObjectNotFound {
+			// New, this is fine
+		} else if err != nil {
+			errs = append(errs, err)
+			if !o.fs.IsTransient(err) || !bo.Wait(context.Background()) {
+				break
 			}
+			continue
 		}
 
 		if readonly {
@@ -625,7 +1067,68 @@ func (o *object) Open(accesslevel cloudstorage.AccessLevel) (*os.File, error) {
 		return o.cachedcopy, nil
 	}
 
-	return nil, fmt.Errorf("fetch error retry cnt reached: obj=%s tfile=%v errs:[%v]", o.name, o.cachepath, errs)
+	cachedcopy.Close()
+	return nil, fmt.Errorf("fetch error: obj=%s tfile=%v errs:[%v]", o.name, o.cachepath, errs)
+}
+
+// download replaces the content of cachedcopy with the object, checking
+// the whole Content-Length arrived.  Objects known to be at least
+// DownloadThreshold in size are fetched in parallel ranged parts.
+func (o *object) download(cachedcopy *os.File) error {
+	if o.fs.DownloadThreshold > 0 && o.size >= o.fs.DownloadThreshold {
+		return o.downloadParts(cachedcopy)
+	}
+	res, err := o.fs.getS3OpenObject(context.Background(), o.name)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if err := cachedcopy.Truncate(0); err != nil {
+		return fmt.Errorf("error truncating cachedcopy err=%v", err)
+	}
+	if _, err := cachedcopy.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("error seeking to start of cachedcopy err=%v", err)
+	}
+	n, err := io.Copy(cachedcopy, res.Body)
+	if err != nil {
+		return fmt.Errorf("error coping bytes. err=%v", err)
+	}
+	if res.ContentLength != nil && n != *res.ContentLength {
+		return fmt.Errorf("incomplete download of %s, got %d of %d bytes", o.name, n, *res.ContentLength)
+	}
+	return nil
+}
+
+// downloadParts downloads the object into cachedcopy with an s3manager
+// Downloader, each part being a ranged GetObject.  The parts must all come
+// from the same version of the object so they are conditional on its etag.
+func (o *object) downloadParts(cachedcopy *os.File) error {
+	if err := cachedcopy.Truncate(0); err != nil {
+		return fmt.Errorf("error truncating cachedcopy err=%v", err)
+	}
+	input := &s3.GetObjectInput{
+		Key:    aws.String(o.name),
+		Bucket: aws.String(o.bucket),
+	}
+	if o.etag != "" {
+		input.IfMatch = aws.String(`"` + o.etag + `"`)
+	}
+	d := s3manager.NewDownloaderWithClient(o.fs.client, func(d *s3manager.Downloader) {
+		d.PartSize = o.fs.DownloadPartSize
+		d.Concurrency = o.fs.DownloadConcurrency
+	})
+	n, err := d.DownloadWithContext(context.Background(), cachedcopy, input)
+	if err != nil {
+		if strings.Contains(err.Error(), "NoSuchKey") {
+			return cloudstorage.ErrObjectNotFound
+		}
+		return err
+	}
+	if n != o.size {
+		return fmt.Errorf("incomplete download of %s, got %d of %d bytes", o.name, n, o.size)
+	}
+	return nil
 }
 
 // File get the current file handle for cached copy.
@@ -659,6 +1162,11 @@ func (o *object) Sync() error {
 		return fmt.Errorf("trying to Sync a readonly object:%s", o.name)
 	}
 
+	metadata, err := cloudstorage.NormalizeMetadata(o.MetaData())
+	if err != nil {
+		return err
+	}
+
 	cachedcopy, err := os.OpenFile(o.cachepath, os.O_RDWR, 0664)
 	if err != nil {
 		return fmt.Errorf("couldn't open localfile for sync'ing. local=%s err=%v", o.cachepath, err)
@@ -674,15 +1182,18 @@ func (o *object) Sync() error {
 
 	// Upload the file to S3.
 	_, err = uploader.Upload(&s3manager.UploadInput{
-		Bucket: aws.String(o.fs.bucket),
-		Key:    aws.String(o.name),
-		Body:   cachedcopy,
+		Bucket:              aws.String(o.fs.bucket),
+		Key:                 aws.String(o.name),
+		Body:                cachedcopy,
+		Metadata:            aws.StringMap(metadata),
+		ACL:                 o.fs.cannedACL(nil),
+		ExpectedBucketOwner: o.fs.expectedOwner(),
 	})
 	if err != nil {
 		gou.Warnf("could not upload %v", err)
 		return fmt.Errorf("failed to upload file, %v", err)
 	}
-	return nil
+	return o.fs.createFolderMarkers(context.Background(), o.name)
 }
 
 // Close this object
@@ -730,3 +1241,12 @@ func (o *object) Release() error {
 	os.Remove(o.cachepath)
 	return nil
 }
+
+// statusCode of an s3 request error, 0 for other errors.
+func statusCode(err error) int {
+	var rf awserr.RequestFailure
+	if errors.As(err, &rf) {
+		return rf.StatusCode()
+	}
+	return 0
+}
@@ -1,15 +1,31 @@
 package awss3_test
 
 import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/araddon/gou"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
 
 	"github.com/lytics/cloudstorage"
 	"github.com/lytics/cloudstorage/awss3"
+	"github.com/lytics/cloudstorage/conformance"
 	"github.com/lytics/cloudstorage/testutils"
 )
 
@@ -81,6 +97,61 @@ func TestS3(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestAnonymousClient(t *testing.T) {
+	conf := &cloudstorage.Config{
+		Type:       awss3.StoreType,
+		AuthMethod: awss3.AuthAnonymous,
+		Settings:   make(gou.JsonHelper),
+	}
+	client, sess, err := awss3.NewClient(conf)
+	require.NoError(t, err)
+	require.NotNil(t, client)
+	require.Equal(t, credentials.AnonymousCredentials, sess.Config.Credentials)
+}
+
+func TestRegisteredAuth(t *testing.T) {
+	static := credentials.NewStaticCredentials("key", "secret", "")
+	cloudstorage.RegisterAuth(awss3.StoreType, "test_vault", func(conf *cloudstorage.Config) (interface{}, error) {
+		return static, nil
+	})
+	conf := &cloudstorage.Config{
+		Type:       awss3.StoreType,
+		AuthMethod: "test_vault",
+		Settings:   make(gou.JsonHelper),
+	}
+	_, sess, err := awss3.NewClient(conf)
+	require.NoError(t, err)
+	require.Equal(t, static, sess.Config.Credentials)
+}
+
+func TestCompatibleConfig(t *testing.T) {
+	conf := &cloudstorage.Config{
+		Type:     awss3.StoreTypeSpaces,
+		Settings: gou.JsonHelper{awss3.ConfKeyAccessKey: "key"},
+	}
+	_, err := awss3.Spaces.Config(conf)
+	require.Error(t, err)
+
+	conf.Region = "nyc3"
+	s3conf, err := awss3.Spaces.Config(conf)
+	require.NoError(t, err)
+	require.Equal(t, "https://nyc3.digitaloceanspaces.com", s3conf.Endpoint)
+	require.Equal(t, "us-east-1", s3conf.Region)
+	require.Equal(t, awss3.AuthAccessKey, s3conf.AuthMethod)
+	require.Equal(t, "key", s3conf.Settings.String(awss3.ConfKeyAccessKey))
+	// original config is not modified
+	require.Equal(t, "", conf.Endpoint)
+	require.Equal(t, 1, len(conf.Settings))
+
+	conf.Type = awss3.StoreTypeWasabi
+	conf.Region = "us-east-2"
+	s3conf, err = awss3.Wasabi.Config(conf)
+	require.NoError(t, err)
+	require.Equal(t, "https://s3.us-east-2.wasabisys.com", s3conf.Endpoint)
+	require.Equal(t, "us-east-2", s3conf.Region)
+	require.True(t, s3conf.Settings.Bool(awss3.ConfKeyForcePathStyle))
+}
+
 func TestAll(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -109,3 +180,872 @@ func TestAll(t *testing.T) {
 	require.NotNil(t, store, "no store?")
 	testutils.RunTests(t, store, config)
 }
+
+func TestS3ConfigValidate(t *testing.T) {
+	conf := &cloudstorage.Config{
+		Type:       awss3.StoreType,
+		AuthMethod: awss3.AuthAccessKey,
+		Settings:   make(gou.JsonHelper),
+	}
+	err := awss3.NewS3Config(conf).Validate()
+	require.Error(t, err)
+	cerr, ok := err.(*cloudstorage.ConfigError)
+	require.True(t, ok)
+	require.Equal(t, []string{"bucket", "tmpdir", "settings.access_key", "settings.access_secret"}, cerr.Missing)
+
+	_, err = cloudstorage.NewStore(conf)
+	require.Contains(t, err.Error(), "settings.access_key, settings.access_secret")
+
+	conf.Bucket = "tests"
+	conf.TmpDir = t.TempDir()
+	conf.Settings[awss3.ConfKeyAccessKey] = "key"
+	conf.Settings[awss3.ConfKeyAccessSecret] = "secret"
+	require.NoError(t, awss3.NewS3Config(conf).Validate())
+
+	conf.Settings[awss3.ConfKeyDownloadPartSize] = 0
+	require.Error(t, awss3.NewS3Config(conf).Validate())
+	delete(conf.Settings, awss3.ConfKeyDownloadPartSize)
+
+	conf.AuthMethod = "bad"
+	require.Error(t, awss3.NewS3Config(conf).Validate())
+}
+
+func TestGetUsesHead(t *testing.T) {
+	var methods []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		if r.URL.Path != "/bucket/logs/a.csv" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", "42")
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("ETag", `"abc"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Header().Set("X-Amz-Meta-Owner", "etl")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	conf := &cloudstorage.Config{
+		Type:       awss3.StoreType,
+		AuthMethod: awss3.AuthAccessKey,
+		Bucket:     "bucket",
+		Region:     "us-east-1",
+		Endpoint:   srv.URL,
+		TmpDir:     t.TempDir(),
+		Settings: gou.JsonHelper{
+			awss3.ConfKeyAccessKey:      "key",
+			awss3.ConfKeyAccessSecret:   "secret",
+			awss3.ConfKeyForcePathStyle: true,
+			awss3.ConfKeyDisableSSL:     true,
+		},
+	}
+	store, err := cloudstorage.NewStore(conf)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	obj, err := store.Get(ctx, "logs/a.csv")
+	require.NoError(t, err)
+	require.Equal(t, int64(42), obj.(cloudstorage.ObjectSizer).Size())
+	require.Equal(t, "abc", obj.(cloudstorage.ObjectETagger).ETag())
+	require.Equal(t, "etl", obj.MetaData()["owner"])
+	require.Equal(t, "text/csv", obj.MetaData()[cloudstorage.ContentTypeKey])
+
+	_, err = store.Get(ctx, "logs/missing.csv")
+	require.Equal(t, cloudstorage.ErrObjectNotFound, err)
+	_, err = store.NewObject("logs/a.csv")
+	require.Equal(t, cloudstorage.ErrObjectExists, err)
+
+	for _, m := range methods {
+		require.Equal(t, http.MethodHead, m)
+	}
+}
+
+func TestOpenRefetchesStream(t *testing.T) {
+	body := "Year,Make,Model\n2003,VW,EuroVan\n"
+	var gets int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		gets++
+		if gets == 1 {
+			// the first stream is cut short
+			conn, buf, err := w.(http.Hijacker).Hijack()
+			require.NoError(t, err)
+			fmt.Fprintf(buf, "HTTP/1.1 200 OK\r\nContent-Length: %d\r\n\r\n%s", len(body), body[:5])
+			buf.Flush()
+			conn.Close()
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+		io.WriteString(w, body)
+	}))
+	defer srv.Close()
+
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       awss3.StoreType,
+		AuthMethod: awss3.AuthAccessKey,
+		Bucket:     "bucket",
+		Region:     "us-east-1",
+		Endpoint:   srv.URL,
+		TmpDir:     t.TempDir(),
+		Settings: gou.JsonHelper{
+			awss3.ConfKeyAccessKey:      "key",
+			awss3.ConfKeyAccessSecret:   "secret",
+			awss3.ConfKeyForcePathStyle: true,
+			awss3.ConfKeyDisableSSL:     true,
+		},
+	})
+	require.NoError(t, err)
+
+	obj, err := store.Get(context.Background(), "a.csv")
+	require.NoError(t, err)
+	f, err := obj.Open(cloudstorage.ReadOnly)
+	require.NoError(t, err)
+	b, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.Equal(t, body, string(b))
+	require.Equal(t, 2, gets)
+	require.NoError(t, obj.Close())
+}
+
+func TestOpenRangedParts(t *testing.T) {
+	body := make([]byte, 1000)
+	for i := range body {
+		body[i] = byte('a' + i%26)
+	}
+	var mu sync.Mutex
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"abc"`)
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		require.Equal(t, `"abc"`, r.Header.Get("If-Match"))
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mu.Unlock()
+		http.ServeContent(w, r, "a.csv", time.Time{}, bytes.NewReader(body))
+	}))
+	defer srv.Close()
+
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       awss3.StoreType,
+		AuthMethod: awss3.AuthAccessKey,
+		Bucket:     "bucket",
+		Region:     "us-east-1",
+		Endpoint:   srv.URL,
+		TmpDir:     t.TempDir(),
+		Settings: gou.JsonHelper{
+			awss3.ConfKeyAccessKey:           "key",
+			awss3.ConfKeyAccessSecret:        "secret",
+			awss3.ConfKeyForcePathStyle:      true,
+			awss3.ConfKeyDisableSSL:          true,
+			awss3.ConfKeyDownloadThreshold:   500,
+			awss3.ConfKeyDownloadPartSize:    300,
+			awss3.ConfKeyDownloadConcurrency: 2,
+		},
+	})
+	require.NoError(t, err)
+
+	obj, err := store.Get(context.Background(), "a.csv")
+	require.NoError(t, err)
+	f, err := obj.Open(cloudstorage.ReadOnly)
+	require.NoError(t, err)
+	b, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.Equal(t, body, b)
+	require.NoError(t, obj.Close())
+
+	sort.Strings(ranges)
+	require.Equal(t, []string{"bytes=0-299", "bytes=300-599", "bytes=600-899", "bytes=900-1199"}, ranges)
+}
+
+func TestReadTimeout(t *testing.T) {
+	hang := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hang
+	}))
+	defer srv.Close()
+	defer close(hang)
+
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:        awss3.StoreType,
+		AuthMethod:  awss3.AuthAccessKey,
+		Bucket:      "bucket",
+		Region:      "us-east-1",
+		Endpoint:    srv.URL,
+		TmpDir:      t.TempDir(),
+		ReadTimeout: 50 * time.Millisecond,
+		Settings: gou.JsonHelper{
+			awss3.ConfKeyAccessKey:      "key",
+			awss3.ConfKeyAccessSecret:   "secret",
+			awss3.ConfKeyForcePathStyle: true,
+			awss3.ConfKeyDisableSSL:     true,
+		},
+	})
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, err = store.Get(context.Background(), "a.csv")
+	require.Error(t, err)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
+
+// fakeS3 keeps objects in memory, enough of s3 for the path style Head,
+// Get, Put, Delete and ListObjects calls of the store.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	markers []string
+	// lengths are the Content-Length headers of the PUTs
+	lengths map[string]int64
+	// meta are the x-amz-meta headers of the PUTs, returned by HEAD
+	meta  map[string]http.Header
+	heads int
+	// putHeaders are the headers of the last PUT of each key
+	putHeaders map[string]http.Header
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	switch {
+	case r.URL.Path == "/bucket" || r.URL.Path == "/bucket/":
+		prefix := r.URL.Query().Get("prefix")
+		marker := r.URL.Query().Get("marker")
+		s.markers = append(s.markers, marker)
+		var keys []string
+		for k := range s.objects {
+			if strings.HasPrefix(k, prefix) && k > marker {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		truncated := false
+		if max, _ := strconv.Atoi(r.URL.Query().Get("max-keys")); max > 0 && len(keys) > max {
+			keys, truncated = keys[:max], true
+		}
+		fmt.Fprintf(w, `<ListBucketResult><IsTruncated>%v</IsTruncated>`, truncated)
+		for _, k := range keys {
+			fmt.Fprintf(w, `<Contents><Key>%s</Key><Size>%d</Size></Contents>`, k, len(s.objects[k]))
+		}
+		fmt.Fprint(w, `</ListBucketResult>`)
+	case r.Method == http.MethodPut:
+		b, _ := io.ReadAll(r.Body)
+		if src, _ := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source")); src != "" {
+			b = s.objects[strings.TrimPrefix(src, "bucket/")]
+			fmt.Fprintf(w, `<CopyObjectResult><ETag>"%x"</ETag></CopyObjectResult>`, md5.Sum(b))
+		}
+		s.objects[key] = b
+		if s.lengths != nil {
+			s.lengths[key] = r.ContentLength
+		}
+		if s.putHeaders != nil {
+			s.putHeaders[key] = r.Header.Clone()
+		}
+		if s.meta != nil {
+			s.meta[key] = http.Header{}
+			for k, v := range r.Header {
+				if strings.HasPrefix(strings.ToLower(k), "x-amz-meta-") {
+					s.meta[key][k] = v
+				}
+			}
+		}
+		w.Header().Set("ETag", fmt.Sprintf(`"%x"`, md5.Sum(b)))
+		w.Header().Set("x-amz-version-id", fmt.Sprint("v", len(s.objects)))
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		b, ok := s.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<Error><Code>NoSuchKey</Code></Error>`)
+			return
+		}
+		for k, v := range s.meta[key] {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(b)))
+		if r.Method == http.MethodGet {
+			w.Write(b)
+		} else if r.Method == http.MethodHead {
+			s.heads++
+		}
+	}
+}
+
+func TestListOffsets(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       awss3.StoreType,
+		AuthMethod: awss3.AuthAccessKey,
+		Bucket:     "bucket",
+		Region:     "us-east-1",
+		Endpoint:   srv.URL,
+		TmpDir:     t.TempDir(),
+		Settings: gou.JsonHelper{
+			awss3.ConfKeyAccessKey:      "key",
+			awss3.ConfKeyAccessSecret:   "secret",
+			awss3.ConfKeyForcePathStyle: true,
+			awss3.ConfKeyDisableSSL:     true,
+		},
+	})
+	require.NoError(t, err)
+	s := &conformance.Suite{Store: store}
+	s.ListOffsets(t)
+
+	// the listing started at the StartOffset and stopped at the EndOffset
+	// rather than paging through the whole prefix.
+	fake.markers = nil
+	q := cloudstorage.NewQuery("offsets/")
+	q.StartOffset = "offsets/b.csv"
+	q.EndOffset = "offsets/d.csv"
+	q.PageSize = 2
+	for _, name := range []string{"offsets/a.csv", "offsets/b.csv", "offsets/c.csv", "offsets/d.csv", "offsets/e.csv", "offsets/f.csv"} {
+		fake.objects[name] = []byte("a")
+	}
+	iter, err := store.Objects(context.Background(), q)
+	require.NoError(t, err)
+	objs, err := cloudstorage.ObjectsAll(iter)
+	require.NoError(t, err)
+	require.Len(t, objs, 2)
+	require.Equal(t, []string{"offsets/b.csu\U0010ffff", "offsets/c.csv"}, fake.markers)
+}
+
+func TestLeanList(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}, meta: map[string]http.Header{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       awss3.StoreType,
+		AuthMethod: awss3.AuthAccessKey,
+		Bucket:     "bucket",
+		Region:     "us-east-1",
+		Endpoint:   srv.URL,
+		TmpDir:     t.TempDir(),
+		Settings: gou.JsonHelper{
+			awss3.ConfKeyAccessKey:      "key",
+			awss3.ConfKeyAccessSecret:   "secret",
+			awss3.ConfKeyForcePathStyle: true,
+			awss3.ConfKeyDisableSSL:     true,
+		},
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+	for _, name := range []string{"lean/a.csv", "lean/b.csv"} {
+		require.NoError(t, cloudstorage.WriteAll(ctx, store, name, []byte("a,b"), map[string]string{"owner": "ops"}))
+	}
+
+	q := cloudstorage.NewQuery("lean/")
+	q.Lean = true
+	iter, err := store.Objects(ctx, q)
+	require.NoError(t, err)
+	objs, err := cloudstorage.ObjectsAll(iter)
+	require.NoError(t, err)
+	require.Len(t, objs, 2)
+	size, ok := cloudstorage.SizeOf(objs[0])
+	require.True(t, ok)
+	require.Equal(t, int64(3), size)
+	// the metadata is fetched on first use, once
+	fake.heads = 0
+	require.Equal(t, "ops", objs[0].MetaData()["owner"])
+	require.Equal(t, "ops", objs[0].MetaData()["owner"])
+	require.Equal(t, 1, fake.heads)
+
+	// objects of regular listings have no metadata
+	iter, err = store.Objects(ctx, cloudstorage.NewQuery("lean/"))
+	require.NoError(t, err)
+	o, err := iter.Next()
+	require.NoError(t, err)
+	require.Empty(t, o.MetaData())
+	require.Equal(t, 1, fake.heads)
+}
+
+func TestReuseList(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}, meta: map[string]http.Header{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       awss3.StoreType,
+		AuthMethod: awss3.AuthAccessKey,
+		Bucket:     "bucket",
+		Region:     "us-east-1",
+		Endpoint:   srv.URL,
+		TmpDir:     t.TempDir(),
+		Settings: gou.JsonHelper{
+			awss3.ConfKeyAccessKey:      "key",
+			awss3.ConfKeyAccessSecret:   "secret",
+			awss3.ConfKeyForcePathStyle: true,
+			awss3.ConfKeyDisableSSL:     true,
+		},
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+	names := []string{"reuse/a.csv", "reuse/b.csv", "reuse/c.csv"}
+	for i, name := range names {
+		require.NoError(t, cloudstorage.WriteAll(ctx, store, name, []byte(strings.Repeat("x", i+1)), nil))
+	}
+
+	q := cloudstorage.NewQuery("reuse/")
+	q.Reuse = true
+	iter, err := store.Objects(ctx, q)
+	require.NoError(t, err)
+	var last cloudstorage.Object
+	for i, name := range names {
+		o, err := iter.Next()
+		require.NoError(t, err)
+		require.Equal(t, name, o.Name())
+		size, _ := cloudstorage.SizeOf(o)
+		require.Equal(t, int64(i+1), size)
+		last = o
+	}
+	// the objects are recycled once the iterator is closed
+	iter.Close()
+	require.Equal(t, "", last.Name())
+}
+
+func TestCannedACL(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}, putHeaders: map[string]http.Header{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	conf := &cloudstorage.Config{
+		Type:       awss3.StoreType,
+		AuthMethod: awss3.AuthAccessKey,
+		Bucket:     "bucket",
+		Region:     "us-east-1",
+		Endpoint:   srv.URL,
+		TmpDir:     t.TempDir(),
+		Settings: gou.JsonHelper{
+			awss3.ConfKeyAccessKey:           "key",
+			awss3.ConfKeyAccessSecret:        "secret",
+			awss3.ConfKeyForcePathStyle:      true,
+			awss3.ConfKeyDisableSSL:          true,
+			awss3.ConfKeyCannedACL:           "bucket-owner-full-control",
+			awss3.ConfKeyExpectedBucketOwner: "111122223333",
+		},
+	}
+	store, err := cloudstorage.NewStore(conf)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, cloudstorage.WriteAll(ctx, store, "out/a.csv", []byte("a,b"), nil))
+	h := fake.putHeaders["out/a.csv"]
+	require.Equal(t, "bucket-owner-full-control", h.Get("X-Amz-Acl"))
+	require.Equal(t, "111122223333", h.Get("X-Amz-Expected-Bucket-Owner"))
+
+	src, err := store.Get(ctx, "out/a.csv")
+	require.NoError(t, err)
+	dst, err := store.NewObject("out/b.csv")
+	require.NoError(t, err)
+	require.NoError(t, cloudstorage.Copy(ctx, store, src, dst))
+	h = fake.putHeaders["out/b.csv"]
+	b, err := cloudstorage.ReadAll(ctx, store, "out/b.csv")
+	require.NoError(t, err)
+	require.Equal(t, "a,b", string(b))
+	require.Equal(t, "bucket-owner-full-control", h.Get("X-Amz-Acl"))
+	require.Equal(t, "111122223333", h.Get("X-Amz-Source-Expected-Bucket-Owner"))
+
+	// the opts override the store's ACL for a writer
+	w, err := store.NewWriterWithContext(ctx, "out/c.csv", nil, cloudstorage.Opts{CannedACL: "private"})
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.Equal(t, "private", fake.putHeaders["out/c.csv"].Get("X-Amz-Acl"))
+	_, err = store.NewWriterWithContext(ctx, "out/d.csv", nil, cloudstorage.Opts{CannedACL: "everyone"})
+	require.Error(t, err)
+
+	conf.Settings[awss3.ConfKeyCannedACL] = "everyone"
+	require.Error(t, awss3.NewS3Config(conf).Validate())
+	_, err = cloudstorage.NewStore(conf)
+	require.Error(t, err)
+}
+
+func TestFolderMarkers(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{
+		// a placeholder made by the s3 console
+		"console/": nil,
+	}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       awss3.StoreType,
+		AuthMethod: awss3.AuthAccessKey,
+		Bucket:     "bucket",
+		Region:     "us-east-1",
+		Endpoint:   srv.URL,
+		TmpDir:     t.TempDir(),
+		Settings: gou.JsonHelper{
+			awss3.ConfKeyAccessKey:      "key",
+			awss3.ConfKeyAccessSecret:   "secret",
+			awss3.ConfKeyForcePathStyle: true,
+			awss3.ConfKeyDisableSSL:     true,
+			awss3.ConfKeyFolderMarkers:  true,
+		},
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	obj, err := store.NewObject("a/b/c.csv")
+	require.NoError(t, err)
+	f, err := obj.Open(cloudstorage.ReadWrite)
+	require.NoError(t, err)
+	_, err = f.WriteString("Year,Make,Model\n")
+	require.NoError(t, err)
+	require.NoError(t, obj.Close())
+
+	fake.mu.Lock()
+	require.Contains(t, fake.objects, "a/")
+	require.Contains(t, fake.objects, "a/b/")
+	fake.mu.Unlock()
+
+	resp, err := store.List(ctx, cloudstorage.NewQuery(""))
+	require.NoError(t, err)
+	require.Len(t, resp.Objects, 1)
+	require.Equal(t, "a/b/c.csv", resp.Objects[0].Name())
+
+	require.NoError(t, store.Delete(ctx, "a/b/c.csv"))
+	fake.mu.Lock()
+	require.Equal(t, []string{"console/"}, keys(fake.objects))
+	fake.mu.Unlock()
+}
+
+func keys(m map[string][]byte) []string {
+	var ks []string
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
+
+func TestWriterResult(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       awss3.StoreType,
+		AuthMethod: awss3.AuthAccessKey,
+		Bucket:     "bucket",
+		Region:     "us-east-1",
+		Endpoint:   srv.URL,
+		TmpDir:     t.TempDir(),
+		Settings: gou.JsonHelper{
+			awss3.ConfKeyAccessKey:      "key",
+			awss3.ConfKeyAccessSecret:   "secret",
+			awss3.ConfKeyForcePathStyle: true,
+			awss3.ConfKeyDisableSSL:     true,
+		},
+	})
+	require.NoError(t, err)
+
+	data := "Year,Make,Model\n1997,Ford,E350\n"
+	w, err := store.NewWriterWithContext(context.Background(), "a.csv", nil)
+	require.NoError(t, err)
+	_, err = io.WriteString(w, data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	// Close waited for the upload
+	fake.mu.Lock()
+	require.Equal(t, data, string(fake.objects["a.csv"]))
+	fake.mu.Unlock()
+
+	res := w.(cloudstorage.ResultWriter).Result()
+	require.Equal(t, int64(len(data)), res.Size)
+	require.Equal(t, fmt.Sprintf("%x", md5.Sum([]byte(data))), res.ETag)
+	require.Equal(t, "v1", res.VersionID)
+}
+
+func TestPutThreshold(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}, lengths: map[string]int64{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	conf := &cloudstorage.Config{
+		Type:       awss3.StoreType,
+		AuthMethod: awss3.AuthAccessKey,
+		Bucket:     "bucket",
+		Region:     "us-east-1",
+		Endpoint:   srv.URL,
+		TmpDir:     t.TempDir(),
+		Settings: gou.JsonHelper{
+			awss3.ConfKeyAccessKey:      "key",
+			awss3.ConfKeyAccessSecret:   "secret",
+			awss3.ConfKeyForcePathStyle: true,
+			awss3.ConfKeyDisableSSL:     true,
+			awss3.ConfKeyPutThreshold:   32,
+		},
+	}
+	store, err := cloudstorage.NewStore(conf)
+	require.NoError(t, err)
+	require.Equal(t, int64(32), store.(*awss3.FS).PutThreshold)
+
+	write := func(name, data string) cloudstorage.UploadResult {
+		w, err := store.NewWriterWithContext(context.Background(), name, nil)
+		require.NoError(t, err)
+		for i := 0; i < len(data); i += 10 {
+			end := i + 10
+			if end > len(data) {
+				end = len(data)
+			}
+			_, err = io.WriteString(w, data[i:end])
+			require.NoError(t, err)
+		}
+		require.NoError(t, w.Close())
+		return w.(cloudstorage.ResultWriter).Result()
+	}
+
+	small := "Year,Make,Model\n1997,Ford,E350\n"
+	res := write("small.csv", small)
+	require.Equal(t, fmt.Sprintf("%x", md5.Sum([]byte(small))), res.ETag)
+	require.Equal(t, "v1", res.VersionID)
+
+	large := strings.Repeat("1997,Ford,E350\n", 10)
+	res = write("large.csv", large)
+	require.Equal(t, fmt.Sprintf("%x", md5.Sum([]byte(large))), res.ETag)
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	require.Equal(t, small, string(fake.objects["small.csv"]))
+	require.Equal(t, int64(len(small)), fake.lengths["small.csv"])
+	require.Equal(t, large, string(fake.objects["large.csv"]))
+
+	conf.Settings[awss3.ConfKeyPutThreshold] = -1
+	_, err = cloudstorage.NewStore(conf)
+	require.Error(t, err)
+}
+
+func TestSetObjectACL(t *testing.T) {
+	var acls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !r.URL.Query().Has("acl") || r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path != "/bucket/share/a.csv" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<Error><Code>NoSuchKey</Code></Error>`)
+			return
+		}
+		acls = append(acls, r.Header.Get("x-amz-acl"))
+	}))
+	defer srv.Close()
+
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       awss3.StoreType,
+		AuthMethod: awss3.AuthAccessKey,
+		Bucket:     "bucket",
+		Region:     "us-east-1",
+		Endpoint:   srv.URL,
+		TmpDir:     t.TempDir(),
+		Settings: gou.JsonHelper{
+			awss3.ConfKeyAccessKey:      "key",
+			awss3.ConfKeyAccessSecret:   "secret",
+			awss3.ConfKeyForcePathStyle: true,
+			awss3.ConfKeyDisableSSL:     true,
+		},
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, cloudstorage.SetObjectACL(ctx, store, "share/a.csv", cloudstorage.ACLPublicRead))
+	require.NoError(t, cloudstorage.SetObjectACL(ctx, store, "share/a.csv", cloudstorage.ACLPrivate))
+	require.Equal(t, []string{"public-read", "private"}, acls)
+
+	err = cloudstorage.SetObjectACL(ctx, store, "share/missing.csv", cloudstorage.ACLPrivate)
+	require.Equal(t, cloudstorage.ErrObjectNotFound, err)
+}
+
+func TestSignedURL(t *testing.T) {
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       awss3.StoreType,
+		AuthMethod: awss3.AuthAccessKey,
+		Bucket:     "bucket",
+		Region:     "us-east-1",
+		Endpoint:   "http://localhost:9000",
+		TmpDir:     t.TempDir(),
+		Settings: gou.JsonHelper{
+			awss3.ConfKeyAccessKey:      "key",
+			awss3.ConfKeyAccessSecret:   "secret",
+			awss3.ConfKeyForcePathStyle: true,
+			awss3.ConfKeyDisableSSL:     true,
+		},
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		signed, err := cloudstorage.SignedURL(ctx, store, "share/a.csv", method, time.Hour)
+		require.NoError(t, err)
+		u, err := url.Parse(signed)
+		require.NoError(t, err)
+		require.Equal(t, "localhost:9000", u.Host)
+		require.Equal(t, "/bucket/share/a.csv", u.Path)
+		require.Equal(t, "3600", u.Query().Get("X-Amz-Expires"))
+		require.True(t, strings.HasPrefix(u.Query().Get("X-Amz-Credential"), "key/"))
+		require.NotEmpty(t, u.Query().Get("X-Amz-Signature"))
+	}
+}
+
+func TestAPIStore(t *testing.T) {
+	var policy, encryption string
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		q := r.URL.Query()
+		requests = append(requests, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery)
+		notFound := func(code string) {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, "<Error><Code>%s</Code><Message>none</Message></Error>", code)
+		}
+		switch {
+		case q.Has("policy") && r.Method == http.MethodGet:
+			if policy == "" {
+				notFound("NoSuchBucketPolicy")
+				return
+			}
+			w.Write([]byte(policy))
+		case q.Has("policy") && r.Method == http.MethodPut:
+			policy = string(body)
+		case q.Has("policy") && r.Method == http.MethodDelete:
+			policy = ""
+			w.WriteHeader(http.StatusNoContent)
+		case q.Has("acl") && r.Method == http.MethodGet:
+			w.Write([]byte(`<AccessControlPolicy><Owner><ID>owner1</ID></Owner><AccessControlList>` +
+				`<Grant><Grantee xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="CanonicalUser"><ID>owner1</ID></Grantee><Permission>FULL_CONTROL</Permission></Grant>` +
+				`<Grant><Grantee xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="Group"><URI>http://acs.amazonaws.com/groups/global/AllUsers</URI></Grantee><Permission>READ</Permission></Grant>` +
+				`</AccessControlList></AccessControlPolicy>`))
+		case q.Has("acl") && r.Method == http.MethodPut:
+			require.Equal(t, "public-read", r.Header.Get("X-Amz-Acl"))
+		case q.Has("publicAccessBlock") && r.Method == http.MethodGet:
+			notFound("NoSuchPublicAccessBlockConfiguration")
+		case q.Has("publicAccessBlock") && r.Method == http.MethodPut:
+			require.Contains(t, string(body), "<BlockPublicPolicy>true</BlockPublicPolicy>")
+		case q.Has("encryption") && r.Method == http.MethodGet:
+			if encryption == "" {
+				notFound("ServerSideEncryptionConfigurationNotFoundError")
+				return
+			}
+			w.Write([]byte(`<ServerSideEncryptionConfiguration>` + encryption + `</ServerSideEncryptionConfiguration>`))
+		case q.Has("encryption") && r.Method == http.MethodPut:
+			s := string(body)
+			encryption = s[strings.Index(s, "<Rule>") : strings.LastIndex(s, "</Rule>")+len("</Rule>")]
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	api, err := awss3.NewAPIStore(&cloudstorage.Config{
+		Type:       awss3.StoreType,
+		AuthMethod: awss3.AuthAccessKey,
+		Region:     "us-east-1",
+		Endpoint:   srv.URL,
+		Settings: gou.JsonHelper{
+			awss3.ConfKeyAccessKey:      "key",
+			awss3.ConfKeyAccessSecret:   "secret",
+			awss3.ConfKeyForcePathStyle: true,
+			awss3.ConfKeyDisableSSL:     true,
+		},
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	p, err := api.GetBucketPolicy(ctx, "bucket")
+	require.NoError(t, err)
+	require.Equal(t, "", p)
+	doc := `{"Version":"2012-10-17","Statement":[]}`
+	require.NoError(t, api.PutBucketPolicy(ctx, "bucket", doc))
+	p, err = api.GetBucketPolicy(ctx, "bucket")
+	require.NoError(t, err)
+	require.Equal(t, doc, p)
+	require.NoError(t, api.PutBucketPolicy(ctx, "bucket", ""))
+	require.Equal(t, "", policy)
+
+	owner, grants, err := api.GetBucketACL(ctx, "bucket")
+	require.NoError(t, err)
+	require.Equal(t, "owner1", owner)
+	require.Equal(t, []awss3.Grant{
+		{Grantee: "owner1", Permission: "FULL_CONTROL"},
+		{Grantee: "http://acs.amazonaws.com/groups/global/AllUsers", Permission: "READ"},
+	}, grants)
+	require.NoError(t, api.SetBucketCannedACL(ctx, "bucket", "public-read"))
+	require.Error(t, api.SetBucketCannedACL(ctx, "bucket", "world-writable"))
+
+	pab, err := api.GetPublicAccessBlock(ctx, "bucket")
+	require.NoError(t, err)
+	require.Equal(t, awss3.PublicAccessBlock{}, pab)
+	require.NoError(t, api.SetPublicAccessBlock(ctx, "bucket", awss3.BlockAllPublicAccess))
+
+	algo, key, err := api.GetBucketEncryption(ctx, "bucket")
+	require.NoError(t, err)
+	require.Equal(t, "", algo+key)
+	require.Error(t, api.SetBucketEncryption(ctx, "bucket", awss3.EncryptionAES256, "key1"))
+	require.NoError(t, api.SetBucketEncryption(ctx, "bucket", awss3.EncryptionKMS, "key1"))
+	algo, key, err = api.GetBucketEncryption(ctx, "bucket")
+	require.NoError(t, err)
+	require.Equal(t, awss3.EncryptionKMS, algo)
+	require.Equal(t, "key1", key)
+
+	for _, r := range requests {
+		require.True(t, strings.HasPrefix(strings.SplitN(r, " ", 2)[1], "/bucket?"), r)
+	}
+}
+
+func TestPermanentErrorsNotRetried(t *testing.T) {
+	var gets int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		gets++
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`)
+	}))
+	defer srv.Close()
+
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       awss3.StoreType,
+		AuthMethod: awss3.AuthAccessKey,
+		Bucket:     "bucket",
+		Region:     "us-east-1",
+		Endpoint:   srv.URL,
+		TmpDir:     t.TempDir(),
+		Settings: gou.JsonHelper{
+			awss3.ConfKeyAccessKey:      "key",
+			awss3.ConfKeyAccessSecret:   "secret",
+			awss3.ConfKeyForcePathStyle: true,
+			awss3.ConfKeyDisableSSL:     true,
+		},
+	})
+	require.NoError(t, err)
+
+	obj, err := store.Get(context.Background(), "a.csv")
+	require.NoError(t, err)
+	_, err = obj.Open(cloudstorage.ReadOnly)
+	require.Error(t, err)
+	require.Equal(t, 1, gets)
+
+	c := store.(cloudstorage.StoreErrorClassifier)
+	require.False(t, c.IsTransient(awserr.NewRequestFailure(awserr.New("AccessDenied", "", nil), 403, "")))
+	require.False(t, c.IsTransient(awserr.NewRequestFailure(awserr.New("NoSuchBucket", "", nil), 404, "")))
+	require.True(t, c.IsTransient(awserr.NewRequestFailure(awserr.New("SlowDown", "", nil), 503, "")))
+	require.True(t, c.IsTransient(awserr.New("RequestError", "send request failed", io.ErrUnexpectedEOF)))
+	require.False(t, c.IsTransient(cloudstorage.ErrObjectNotFound))
+}
@@ -0,0 +1,57 @@
+package awss3
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+var _ cloudstorage.TaggedStore = (*FS)(nil)
+
+// GetTags of the object using s3 object tagging.
+func (f *FS) GetTags(ctx context.Context, name string) (map[string]string, error) {
+	res, err := f.client.GetObjectTaggingWithContext(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(f.bucket),
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "NoSuchKey") || statusCode(err) == http.StatusNotFound {
+			return nil, cloudstorage.ErrObjectNotFound
+		}
+		return nil, err
+	}
+	tags := make(map[string]string, len(res.TagSet))
+	for _, t := range res.TagSet {
+		tags[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+	return tags, nil
+}
+
+// SetTags replaces the object's tag set, s3 allows at most 10 tags.
+func (f *FS) SetTags(ctx context.Context, name string, tags map[string]string) error {
+	if len(tags) == 0 {
+		_, err := f.client.DeleteObjectTaggingWithContext(ctx, &s3.DeleteObjectTaggingInput{
+			Bucket: aws.String(f.bucket),
+			Key:    aws.String(name),
+		})
+		return err
+	}
+	tagSet := make([]*s3.Tag, 0, len(tags))
+	for k, v := range tags {
+		tagSet = append(tagSet, &s3.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	_, err := f.client.PutObjectTaggingWithContext(ctx, &s3.PutObjectTaggingInput{
+		Bucket:  aws.String(f.bucket),
+		Key:     aws.String(name),
+		Tagging: &s3.Tagging{TagSet: tagSet},
+	})
+	if err != nil && (strings.Contains(err.Error(), "NoSuchKey") || statusCode(err) == http.StatusNotFound) {
+		return cloudstorage.ErrObjectNotFound
+	}
+	return err
+}
@@ -0,0 +1,34 @@
+package azure
+
+import (
+	"fmt"
+
+	az "github.com/Azure/azure-sdk-for-go/storage"
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+var _ cloudstorage.StoreACLSetter = (*FS)(nil)
+
+// SetObjectACL checks the container's public access level gives the blob
+// acl, azure has no per blob access.  Other acls fail with
+// cloudstorage.ErrNotImplemented.
+func (f *FS) SetObjectACL(ctx context.Context, name string, acl cloudstorage.ACL) error {
+	container := f.client.GetContainerReference(f.bucket)
+	exists, err := container.GetBlobReference(name).Exists()
+	if err != nil {
+		return err
+	} else if !exists {
+		return cloudstorage.ErrObjectNotFound
+	}
+	perms, err := container.GetPermissions(nil)
+	if err != nil {
+		return err
+	}
+	public := perms.AccessType != az.ContainerAccessTypePrivate
+	if public != (acl == cloudstorage.ACLPublicRead) {
+		return fmt.Errorf("%w: azure blobs have the public access level of container %s", cloudstorage.ErrNotImplemented, f.bucket)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package azure
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	az "github.com/Azure/azure-sdk-for-go/storage"
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+// maxBlockFromURL is the largest range a single Put Block From URL copies.
+const maxBlockFromURL = 100 * 1024 * 1024
+
+var _ cloudstorage.StoreComposer = (*FS)(nil)
+
+// Compose concatenates srcs into dst server side, each source is copied
+// into blocks of dst with Put Block From URL then committed as one block
+// list.  The sources are read through short lived SAS urls, which need the
+// store to be authenticated with the account key; otherwise ErrNotImplemented
+// is returned so cloudstorage.Compose streams them instead.
+func (f *FS) Compose(ctx context.Context, dst string, srcs []string) error {
+	container := f.client.GetContainerReference(f.bucket)
+	var first *az.Blob
+	var blocks []az.Block
+	var rawID uint64
+	for _, src := range srcs {
+		blob := container.GetBlobReference(src)
+		if err := blob.GetProperties(nil); err != nil {
+			if statusCode(err) == http.StatusNotFound {
+				return cloudstorage.ErrObjectNotFound
+			}
+			return err
+		}
+		if first == nil {
+			first = blob
+		}
+
+		size := blob.Properties.ContentLength
+		if size == 0 {
+			continue
+		}
+		srcURL, err := blob.GetSASURI(az.BlobSASOptions{
+			BlobServiceSASPermissions: az.BlobServiceSASPermissions{Read: true},
+			SASOptions:                az.SASOptions{Expiry: time.Now().Add(time.Hour), UseHTTPS: true},
+		})
+		if err != nil {
+			return fmt.Errorf("%w: azure compose could not sign %q: %v", cloudstorage.ErrNotImplemented, src, err)
+		}
+		for offset := int64(0); offset < size; offset += maxBlockFromURL {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if rawID >= maxParts {
+				return fmt.Errorf("azure: composed object %q exceeds max block count of %d", dst, maxParts)
+			}
+			n := size - offset
+			if n > maxBlockFromURL {
+				n = maxBlockFromURL
+			}
+			blockID := makeBlockID(rawID)
+			rawID++
+			if err := container.GetBlobReference(dst).PutBlockFromURL(blockID, srcURL, offset, uint64(n), nil); err != nil {
+				return err
+			}
+			blocks = append(blocks, az.Block{ID: blockID, Status: az.BlockStatusUncommitted})
+		}
+	}
+	if len(blocks) == 0 {
+		return fmt.Errorf("%w: azure compose of empty sources", cloudstorage.ErrNotImplemented)
+	}
+
+	blob := container.GetBlobReference(dst)
+	blob.Properties.ContentType = first.Properties.ContentType
+	blob.Properties.ContentEncoding = first.Properties.ContentEncoding
+	blob.Metadata = first.Metadata
+	return blob.PutBlockList(blocks, nil)
+}
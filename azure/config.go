@@ -0,0 +1,66 @@
+package azure
+
+import (
+	"github.com/lytics/cloudstorage"
+)
+
+// AzureConfig is the typed form of the cloudstorage.Config fields and
+// Settings used by the azure store.
+type AzureConfig struct {
+	AuthMethod cloudstorage.AuthMethod
+	// Account is the storage account name, Config.Project.
+	Account string
+	// Container is the blob container, Config.Bucket.
+	Container string
+	TmpDir    string
+
+	// AuthKey Settings[ConfKeyAuthKey], required for AuthKey.
+	AuthKey string
+	// ChunkSize Settings[ConfKeyChunkSize], 0 uses the default.
+	ChunkSize int
+	// UploadConcurrency Settings[ConfKeyUploadConcurrency], 0 uses UploadConcurrency.
+	UploadConcurrency int
+}
+
+// NewAzureConfig converts a generic cloudstorage.Config into an AzureConfig.
+func NewAzureConfig(conf *cloudstorage.Config) *AzureConfig {
+	c := &AzureConfig{
+		AuthMethod: conf.AuthMethod,
+		Account:    conf.Project,
+		Container:  conf.Bucket,
+		TmpDir:     conf.TmpDir,
+		AuthKey:    conf.Settings.String(ConfKeyAuthKey),
+	}
+	// JsonHelper.Int returns -1 for missing keys
+	if cs, ok := conf.Settings.IntSafe(ConfKeyChunkSize); ok {
+		c.ChunkSize = cs
+	}
+	if uc, ok := conf.Settings.IntSafe(ConfKeyUploadConcurrency); ok {
+		c.UploadConcurrency = uc
+	}
+	return c
+}
+
+// Validate checks the config returning a *cloudstorage.ConfigError that
+// lists every missing or invalid key.
+func (c *AzureConfig) Validate() error {
+	e := &cloudstorage.ConfigError{Type: StoreType}
+	e.Require("project", c.Account)
+	e.Require("bucket", c.Container)
+	e.Require("tmpdir", c.TmpDir)
+	switch c.AuthMethod {
+	case AuthKey:
+		e.Require("settings."+ConfKeyAuthKey, c.AuthKey)
+	case "":
+		e.Missing = append(e.Missing, "authmethod")
+	default:
+		e.Invalidf("authmethod %q is not supported", c.AuthMethod)
+	}
+	if c.ChunkSize < 0 || c.ChunkSize > maxChunkSize {
+		e.Invalidf("settings.%s=%d must be between 0 and %d", ConfKeyChunkSize, c.ChunkSize, maxChunkSize)
+	}
+	if c.UploadConcurrency < 0 {
+		e.Invalidf("settings.%s=%d must not be negative", ConfKeyUploadConcurrency, c.UploadConcurrency)
+	}
+	return e.Err()
+}
@@ -0,0 +1,69 @@
+package azure
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	az "github.com/Azure/azure-sdk-for-go/storage"
+	"github.com/pborman/uuid"
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+var _ cloudstorage.StoreLeaser = (*FS)(nil)
+
+// lease is an azure blob lease on the marker blob.
+type lease struct {
+	blob *az.Blob
+	id   string
+}
+
+// AcquireLease claims name with a native blob lease on the marker blob
+// name+LeaseSuffix, which is created if missing.  Azure leases last between
+// 15s and 60s, or forever for a ttl of 0, expired leases are free to take.
+func (f *FS) AcquireLease(ctx context.Context, name string, ttl time.Duration) (cloudstorage.Lease, error) {
+	seconds := -1
+	if ttl != 0 {
+		if ttl < 15*time.Second || ttl > 60*time.Second {
+			return nil, fmt.Errorf("invalid lease ttl %v, azure leases must be between 15s and 60s or 0 for infinite", ttl)
+		}
+		seconds = int(ttl / time.Second)
+	}
+
+	blob := f.client.GetContainerReference(f.bucket).GetBlobReference(name + cloudstorage.LeaseSuffix)
+	err := blob.CreateBlockBlob(&az.PutBlobOptions{IfNoneMatch: "*"})
+	if err != nil && statusCode(err) != http.StatusConflict && statusCode(err) != http.StatusPreconditionFailed {
+		return nil, err
+	}
+
+	id, err := blob.AcquireLease(seconds, uuid.NewRandom().String(), nil)
+	if err != nil {
+		if statusCode(err) == http.StatusConflict {
+			return nil, cloudstorage.ErrLeaseHeld
+		}
+		return nil, err
+	}
+	return &lease{blob: blob, id: id}, nil
+}
+
+func (l *lease) ID() string { return l.id }
+
+// Renew the blob lease, which fails once another owner has taken it.
+func (l *lease) Renew(ctx context.Context) error {
+	err := l.blob.RenewLease(l.id, nil)
+	if sc := statusCode(err); sc == http.StatusConflict || sc == http.StatusNotFound {
+		return cloudstorage.ErrLeaseLost
+	}
+	return err
+}
+
+// Release deletes the marker blob, which ends the lease.
+func (l *lease) Release(ctx context.Context) error {
+	err := l.blob.Delete(&az.DeleteBlobOptions{LeaseID: l.id})
+	if sc := statusCode(err); sc == http.StatusConflict || sc == http.StatusPreconditionFailed || sc == http.StatusNotFound {
+		return cloudstorage.ErrLeaseLost
+	}
+	return err
+}
@@ -0,0 +1,30 @@
+package azure
+
+import (
+	"fmt"
+
+	"github.com/lytics/cloudstorage"
+)
+
+// validateMetadataKeys checks the keys are C# identifiers as azure requires:
+// letters, digits and underscores, not leading with a digit.
+func validateMetadataKeys(metadata map[string]string) error {
+	for k := range metadata {
+		if !validMetadataKey(k) {
+			return fmt.Errorf("%w: azure key %q must be letters, digits and underscores not starting with a digit", cloudstorage.ErrInvalidMetadata, k)
+		}
+	}
+	return nil
+}
+
+func validMetadataKey(key string) bool {
+	if key == "" || (key[0] >= '0' && key[0] <= '9') {
+		return false
+	}
+	for _, c := range key {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '_' {
+			return false
+		}
+	}
+	return true
+}
@@ -4,11 +4,15 @@ import (
 	"bufio"
 	"encoding/base64"
 	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"path"
 	"strings"
+	"sync"
 	"time"
 
 	az "github.com/Azure/azure-sdk-for-go/storage"
@@ -29,6 +33,12 @@ const (
 
 	// ConfKeyAuthKey config key name of the azure api key for auth
 	ConfKeyAuthKey = "azure_key"
+	// ConfKeyChunkSize config key name of the block size (bytes) used for
+	// multipart uploads
+	ConfKeyChunkSize = "chunk_size"
+	// ConfKeyUploadConcurrency config key name of the number of blocks
+	// uploaded in parallel per writer
+	ConfKeyUploadConcurrency = "upload_concurrency"
 
 	// Authentication Source's
 
@@ -39,8 +49,12 @@ const (
 var (
 	// Retries number of times to retry upon failures.
 	Retries = 3
+	// RetryBackoff delays between the Retries.
+	RetryBackoff = cloudstorage.DefaultBackoff
 	// PageSize is default page size
 	PageSize = 2000
+	// UploadConcurrency is the default number of blocks uploaded in parallel
+	UploadConcurrency = 4
 
 	// ErrNoAzureSession no valid session
 	ErrNoAzureSession = fmt.Errorf("no valid azure session was created")
@@ -48,11 +62,23 @@ var (
 	ErrNoAccessKey = fmt.Errorf("no settings.azure_key")
 	// ErrNoAuth error for no findable auth
 	ErrNoAuth = fmt.Errorf("No auth provided")
+
+	// Ensure we implement the optional copier/mover
+	_ cloudstorage.StoreCopy        = (*FS)(nil)
+	_ cloudstorage.StoreMove        = (*FS)(nil)
+	_ cloudstorage.StoreRangeReader = (*FS)(nil)
+	_ cloudstorage.ObjectRecycler   = (*FS)(nil)
+
+	// objectPool holds the recycled objects of Query.Reuse listings.
+	objectPool = sync.Pool{New: func() interface{} { return &object{} }}
 )
 
 func init() {
 	// Register this Driver (azure) in cloudstorage driver registry.
 	cloudstorage.Register(StoreType, func(conf *cloudstorage.Config) (cloudstorage.Store, error) {
+		if err := NewAzureConfig(conf).Validate(); err != nil {
+			return nil, err
+		}
 		client, sess, err := NewClient(conf)
 		if err != nil {
 			return nil, err
@@ -72,6 +98,10 @@ type (
 		endpoint   string
 		bucket     string
 		cachepath  string
+
+		chunkSize         int
+		uploadConcurrency int
+		bufPool           *sync.Pool
 	}
 
 	object struct {
@@ -90,6 +120,13 @@ type (
 
 		//infoOnce sync.Once
 		infoErr error
+
+		// uploadETag of the blob written by NewWriterWithContext
+		uploadETag string
+
+		// lean objects of a Query.Lean listing load their metadata on
+		// first use.
+		lean bool
 	}
 )
 
@@ -127,16 +164,40 @@ func NewStore(c *az.Client, blobClient *az.BlobStorageClient, conf *cloudstorage
 		return nil, fmt.Errorf("unable to create cachepath. config.tmpdir=%q err=%v", conf.TmpDir, err)
 	}
 
+	chunkSize := initialChunkSize
+	if cs := conf.Settings.Int(ConfKeyChunkSize); cs > 0 {
+		if cs > maxChunkSize {
+			return nil, fmt.Errorf("invalid config: %s=%d exceeds max chunk size of %d", ConfKeyChunkSize, cs, maxChunkSize)
+		}
+		chunkSize = cs
+	}
+	uploadConcurrency := UploadConcurrency
+	if uc := conf.Settings.Int(ConfKeyUploadConcurrency); uc > 0 {
+		uploadConcurrency = uc
+	}
+
 	uid := uuid.NewUUID().String()
 	uid = strings.Replace(uid, "-", "", -1)
+	cachepath, err := cloudstorage.CacheDir(conf.TmpDir, uid)
+	if err != nil {
+		return nil, err
+	}
 
 	return &FS{
-		baseClient: c,
-		client:     blobClient,
-		bucket:     conf.Bucket,
-		cachepath:  conf.TmpDir,
-		ID:         uid,
-		PageSize:   10000,
+		baseClient:        c,
+		client:            blobClient,
+		bucket:            conf.Bucket,
+		cachepath:         cachepath,
+		ID:                uid,
+		PageSize:          10000,
+		chunkSize:         chunkSize,
+		uploadConcurrency: uploadConcurrency,
+		bufPool: &sync.Pool{
+			New: func() interface{} {
+				buf := make([]byte, chunkSize)
+				return &buf
+			},
+		},
 	}, nil
 }
 
@@ -145,6 +206,45 @@ func (f *FS) Type() string {
 	return StoreType
 }
 
+// CleanCache removes stale cache files from the store's TmpDir, see
+// cloudstorage.CleanCache.
+func (f *FS) CleanCache(ctx context.Context, olderThan time.Duration) error {
+	return cloudstorage.CleanCache(ctx, f.cachepath, olderThan)
+}
+
+// CachePath is the cache directory of the store below its TmpDir.
+func (f *FS) CachePath() string {
+	return f.cachepath
+}
+
+// UpdatedGranularity of azure, Last-Modified only has seconds.
+func (f *FS) UpdatedGranularity() time.Duration {
+	return time.Second
+}
+
+// Capabilities of azure, deleted blobs may still be found for a second.
+func (f *FS) Capabilities() cloudstorage.Capabilities {
+	return cloudstorage.Capabilities{ETags: true, Concurrent: true, ConsistencyDelay: 1100 * time.Millisecond}
+}
+
+// IsTransient is true for azure errors worth retrying: throttling, server
+// errors and network errors, not the 4xx of a denied permission or a
+// missing container.
+func (f *FS) IsTransient(err error) bool {
+	if !cloudstorage.DefaultIsTransient(err) {
+		return false
+	}
+	if code := statusCode(err); code != 0 {
+		return cloudstorage.IsTransientStatus(code)
+	}
+	return true
+}
+
+// BackoffProfile of azure is RetryBackoff.
+func (f *FS) BackoffProfile() cloudstorage.BackoffProfile {
+	return RetryBackoff
+}
+
 // Client gets access to the underlying google cloud storage client.
 func (f *FS) Client() interface{} {
 	return f.client
@@ -156,11 +256,17 @@ func (f *FS) String() string {
 }
 
 // NewObject of Type azure.
-func (f *FS) NewObject(objectname string) (cloudstorage.Object, error) {
+func (f *FS) NewObject(objectname string, opts ...cloudstorage.Opts) (cloudstorage.Object, error) {
+	if len(opts) > 0 && opts[0].WriteThrough {
+		return cloudstorage.NewWriteThroughObject(f, objectname, opts[0])
+	}
 	obj, err := f.Get(context.Background(), objectname)
 	if err != nil && err != cloudstorage.ErrObjectNotFound {
 		return nil, err
 	} else if obj != nil {
+		if len(opts) > 0 && opts[0].Overwrite {
+			return obj, nil
+		}
 		return nil, cloudstorage.ErrObjectExists
 	}
 
@@ -202,18 +308,7 @@ func (f *FS) getObject(ctx context.Context, objectname string) (*object, error)
 		}
 		return nil, err
 	}
-	o := &object{
-		name: objectname,
-		fs:   f,
-		o:    blob,
-	}
-
-	o.o.Properties.Etag = cloudstorage.CleanETag(o.o.Properties.Etag)
-	o.updated = time.Time(o.o.Properties.LastModified)
-	o.cachepath = cloudstorage.CachePathObj(f.cachepath, o.name, f.ID)
-
-	return o, nil
-	//return newObjectFromHead(f, objectname, res), nil
+	return newObject(f, blob, false), nil
 }
 
 func (f *FS) getOpenObject(ctx context.Context, objectname string) (io.ReadCloser, error) {
@@ -251,25 +346,74 @@ func (f *FS) List(ctx context.Context, q cloudstorage.Query) (*cloudstorage.Obje
 		Prefix:     q.Prefix,
 		MaxResults: itemLimit,
 		Marker:     q.Marker,
+		Delimiter:  q.Delimiter,
+		Include:    &az.IncludeBlobDataset{Metadata: !q.Lean || len(q.TagFilter) > 0},
 	}
 
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	blobs, err := f.client.GetContainerReference(f.bucket).ListBlobs(params)
 	if err != nil {
 		return nil, err
 	}
 	objResp := &cloudstorage.ObjectsResponse{
-		Objects: make(cloudstorage.Objects, len(blobs.Blobs)),
+		Objects: make(cloudstorage.Objects, 0, len(blobs.Blobs)),
 	}
 
-	for i, o := range blobs.Blobs {
-		objResp.Objects[i] = newObject(f, &o)
+	// blobs are listed in order, past the EndOffset there is nothing more.
+	// The markers are opaque so a StartOffset is only checked by q.Match.
+	pastEnd := false
+	for i := range blobs.Blobs {
+		o := &blobs.Blobs[i]
+		if q.EndOffset != "" && o.Name >= q.EndOffset {
+			pastEnd = true
+			break
+		}
+		if !q.ShowHidden && hidden(o.Name) {
+			continue
+		}
+		if len(q.TagFilter) > 0 && !cloudstorage.MatchTags(cloudstorage.DecodeTags(o.Metadata[cloudstorage.TagsMetadataKey]), q.TagFilter) {
+			continue
+		}
+		if !q.Match(o.Name, o.Properties.ContentLength) {
+			continue
+		}
+		if q.Lean {
+			objResp.Objects = append(objResp.Objects, newLeanObject(f, o, q.Reuse))
+			continue
+		}
+		objResp.Objects = append(objResp.Objects, newObject(f, o, q.Reuse))
+	}
+	for _, prefix := range blobs.BlobPrefixes {
+		// folders always end in the delimiter, like the other stores
+		if !strings.HasSuffix(prefix, q.Delimiter) {
+			prefix += q.Delimiter
+		}
+		if prefix == q.Prefix || (!q.ShowHidden && hidden(prefix)) {
+			continue
+		}
+		if q.EndOffset != "" && prefix >= q.EndOffset {
+			pastEnd = true
+			continue
+		}
+		objResp.Prefixes = append(objResp.Prefixes, prefix)
+	}
+	// a page may be empty but still have a marker, the page iterators
+	// continue with the next page
+	if !pastEnd {
+		objResp.NextMarker = blobs.NextMarker
 	}
-	objResp.NextMarker = blobs.NextMarker
-	q.Marker = blobs.NextMarker
+	objResp.Objects = q.ApplyFilters(objResp.Objects)
 
 	return objResp, nil
 }
 
+// hidden is true for objects and folders whose base name starts with ".".
+func hidden(name string) bool {
+	return strings.HasPrefix(path.Base(name), ".")
+}
+
 // Objects returns an iterator over the objects in the google bucket that match the Query q.
 // If q is nil, no filtering is done.
 func (f *FS) Objects(ctx context.Context, q cloudstorage.Query) (cloudstorage.ObjectIterator, error) {
@@ -278,85 +422,39 @@ func (f *FS) Objects(ctx context.Context, q cloudstorage.Query) (cloudstorage.Ob
 
 // Folders get folders list.
 func (f *FS) Folders(ctx context.Context, q cloudstorage.Query) ([]string, error) {
-
-	q.Delimiter = "/"
-
-	// Think we should just put 1 here right?
-	itemLimit := uint(f.PageSize)
-	if q.PageSize > 0 {
-		itemLimit = uint(q.PageSize)
+	iter, err := f.FolderIterator(ctx, q)
+	if err != nil {
+		return nil, err
 	}
+	defer iter.Close()
+	return cloudstorage.FoldersAll(iter)
+}
 
-	params := az.ListBlobsParameters{
-		Prefix:     q.Prefix,
-		MaxResults: itemLimit,
-		Delimiter:  "/",
-	}
-
-	for {
-		select {
-		case <-ctx.Done():
-			// If has been closed
-			return nil, ctx.Err()
-		default:
-			// if q.Marker != "" {
-			// 	params.Marker = &q.Marker
-			// }
-			blobs, err := f.client.GetContainerReference(f.bucket).ListBlobs(params)
-			if err != nil {
-				gou.Warnf("leaving %v", err)
-				return nil, err
-			}
-			if len(blobs.BlobPrefixes) > 0 {
-				return blobs.BlobPrefixes, nil
-			}
-			return nil, nil
-		}
-	}
+// FolderIterator returns an iterator over the folders below the Query prefix.
+func (f *FS) FolderIterator(ctx context.Context, q cloudstorage.Query) (cloudstorage.FolderIterator, error) {
+	return cloudstorage.NewFolderPageIterator(ctx, f, q), nil
 }
 
-/*
-// Copy from src to destination
+// Copy from src to destination server side with Copy Blob, which also
+// copies the metadata.
 func (f *FS) Copy(ctx context.Context, src, des cloudstorage.Object) error {
-
-	so, ok := src.(*object)
-	if !ok {
-		return fmt.Errorf("Copy source file expected s3 but got %T", src)
-	}
-	do, ok := des.(*object)
-	if !ok {
-		return fmt.Errorf("Copy destination expected s3 but got %T", des)
+	container := f.client.GetContainerReference(f.bucket)
+	srcURL := container.GetBlobReference(src.Name()).GetURL()
+	err := container.GetBlobReference(des.Name()).Copy(srcURL, nil)
+	if statusCode(err) == http.StatusNotFound {
+		return cloudstorage.ErrObjectNotFound
 	}
-
-	oh := so.b.Object(so.name)
-	dh := do.b.Object(do.name)
-
-	_, err := dh.CopierFrom(oh).Run(ctx)
 	return err
 }
 
 // Move which is a Copy & Delete
 func (f *FS) Move(ctx context.Context, src, des cloudstorage.Object) error {
-
-	so, ok := src.(*object)
-	if !ok {
-		return fmt.Errorf("Move source file expected s3 but got %T", src)
-	}
-	do, ok := des.(*object)
-	if !ok {
-		return fmt.Errorf("Move destination expected s3 but got %T", des)
-	}
-
-	oh := so.b.Object(so.name)
-	dh := do.b.Object(des.name)
-
-	if _, err := dh.CopierFrom(oh).Run(ctx); err != nil {
+	if err := f.Copy(ctx, src, des); err != nil {
 		return err
 	}
-
-	return oh.Delete(ctx)
+	return f.Delete(ctx, src.Name())
 }
-*/
+
 // NewReader create file reader.
 func (f *FS) NewReader(o string) (io.ReadCloser, error) {
 	return f.NewReaderWithContext(context.Background(), o)
@@ -364,17 +462,66 @@ func (f *FS) NewReader(o string) (io.ReadCloser, error) {
 
 // NewReaderWithContext create new File reader with context.
 func (f *FS) NewReaderWithContext(ctx context.Context, objectname string) (io.ReadCloser, error) {
-	ioc, err := f.client.GetContainerReference(f.bucket).GetBlobReference(objectname).Get(nil)
+	return f.NewReaderWithOpts(ctx, objectname)
+}
+
+// NewReaderWithOpts create new File reader honoring Opts.IfNoneMatch.
+func (f *FS) NewReaderWithOpts(ctx context.Context, objectname string, opts ...cloudstorage.Opts) (io.ReadCloser, error) {
+	var getOpts *az.GetBlobOptions
+	if len(opts) > 0 && opts[0].IfNoneMatch != "" {
+		getOpts = &az.GetBlobOptions{IfNoneMatch: `"` + cloudstorage.CleanETag(opts[0].IfNoneMatch) + `"`}
+	}
+	ioc, err := f.client.GetContainerReference(f.bucket).GetBlobReference(objectname).Get(getOpts)
 	if err != nil {
 		// translate the string error to typed error
 		if strings.Contains(err.Error(), "404") {
 			return nil, cloudstorage.ErrObjectNotFound
 		}
+		if statusCode(err) == http.StatusNotModified {
+			return nil, cloudstorage.ErrNotModified
+		}
 		return nil, err
 	}
 	return ioc, nil
 }
 
+// NewRangeReader reads length bytes of object objectname from offset, to
+// the end if length is negative.
+func (f *FS) NewRangeReader(ctx context.Context, objectname string, offset, length int64) (io.ReadCloser, error) {
+	rng := &az.BlobRange{Start: uint64(offset)}
+	if length >= 0 {
+		if length == 0 {
+			return io.NopCloser(strings.NewReader("")), nil
+		}
+		// an End of 0 is the end of the blob, so single byte reads of the
+		// start read two
+		rng.End = uint64(offset + length - 1)
+		if rng.End == 0 {
+			rng.End = 1
+		}
+	}
+	rc, err := f.client.GetContainerReference(f.bucket).GetBlobReference(objectname).GetRange(&az.GetBlobRangeOptions{Range: rng})
+	if err != nil {
+		if strings.Contains(err.Error(), "404") {
+			return nil, cloudstorage.ErrObjectNotFound
+		}
+		return nil, err
+	}
+	if length >= 0 {
+		return &limitReadCloser{Reader: io.LimitReader(rc, length), c: rc}, nil
+	}
+	return rc, nil
+}
+
+type limitReadCloser struct {
+	io.Reader
+	c io.Closer
+}
+
+func (l *limitReadCloser) Close() error {
+	return l.c.Close()
+}
+
 // NewWriter create Object Writer.
 func (f *FS) NewWriter(objectName string, metadata map[string]string) (io.WriteCloser, error) {
 	return f.NewWriterWithContext(context.Background(), objectName, metadata)
@@ -385,11 +532,21 @@ func (f *FS) NewWriterWithContext(ctx context.Context, name string, metadata map
 	if len(opts) > 0 && opts[0].IfNotExists {
 		return nil, fmt.Errorf("options IfNotExists not supported for store type")
 	}
+	metadata, err := cloudstorage.NormalizeMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateMetadataKeys(metadata); err != nil {
+		return nil, err
+	}
 	name = strings.Replace(name, " ", "+", -1)
 	o := &object{name: name, metadata: metadata}
 	rwc := newAzureWriteCloser(ctx, f, o)
 
-	return rwc, nil
+	return cloudstorage.NewResultWriter(rwc, func(r *cloudstorage.UploadResult) error {
+		r.ETag = o.uploadETag
+		return nil
+	}), nil
 }
 
 // azureWriteCloser - manages data and go routines used to pipe data to azures, calling Close
@@ -413,11 +570,14 @@ func newAzureWriteCloser(ctx context.Context, f *FS, obj *object) io.WriteCloser
 	g.Go(func() error {
 		// Upload the file to azure.
 		// Do a multipart upload
-		err := f.uploadMultiPart(obj, pr)
+		etag, err := f.uploadMultiPart(ctx, obj, pr)
 		if err != nil {
 			gou.Warnf("could not upload %v", err)
+			// fail the writes still blocked on the pipe
+			pr.CloseWithError(err)
 			return err
 		}
+		obj.uploadETag = etag
 		return nil
 	})
 
@@ -465,105 +625,236 @@ func makeBlockID(id uint64) string {
 	return base64.StdEncoding.EncodeToString(bytesID)
 }
 
-// uploadMultiPart start an upload
-func (f *FS) uploadMultiPart(o *object, r io.Reader) error {
-
-	//chunkSize, err := calcBlockSize(size)
-	// if err != nil {
-	// 	return err
-	// }
-	var buf = make([]byte, initialChunkSize)
+// uploadMultiPart start an upload.  The reader is split into blocks of
+// chunkSize which are uploaded by up to uploadConcurrency go-routines while
+// the next block is being read.  Block buffers are recycled through bufPool.
+//
+// The sdk calls take no context, once ctx is done they are abandoned through
+// cloudstorage.Run so the upload returns ctx.Err() without waiting on them.
+func (f *FS) uploadMultiPart(ctx context.Context, o *object, r io.Reader) (string, error) {
 
 	var blocks []az.Block
 	var rawID uint64
 
 	blob := f.client.GetContainerReference(f.bucket).GetBlobReference(o.name)
 
-	// TODO: performance improvement to mange uploads in separate
-	// go-routine than the reader
-	for {
-		n, err := r.Read(buf)
-		if err != nil {
+	g, gctx := errgroup.WithContext(ctx)
+	sem := make(chan struct{}, f.uploadConcurrency)
+
+	readErr := func() error {
+		for {
+			if err := gctx.Err(); err != nil {
+				// cancelled, or an upload failed, g.Wait() has the error
+				return nil
+			}
+			bufp := f.bufPool.Get().(*[]byte)
+			n, err := io.ReadFull(r, *bufp)
 			if err == io.EOF {
-				break
+				f.bufPool.Put(bufp)
+				return nil
+			} else if err != nil && err != io.ErrUnexpectedEOF {
+				f.bufPool.Put(bufp)
+				gou.Warnf("unknown err=%v", err)
+				return err
 			}
-			gou.Warnf("unknown err=%v", err)
-			return err
-		}
+			lastChunk := err == io.ErrUnexpectedEOF
 
-		blockID := makeBlockID(rawID)
-		chunk := buf[:n]
+			if rawID >= maxParts {
+				f.bufPool.Put(bufp)
+				return fmt.Errorf("azure: object %q exceeds max block count of %d", o.name, maxParts)
+			}
 
-		if err := blob.PutBlock(blockID, chunk, nil); err != nil {
-			return err
-		}
+			blockID := makeBlockID(rawID)
+			chunk := (*bufp)[:n]
+			blocks = append(blocks, az.Block{
+				ID:     blockID,
+				Status: az.BlockStatusLatest,
+			})
+			rawID++
+
+			select {
+			case sem <- struct{}{}:
+			case <-gctx.Done():
+				// an upload failed, the error is returned by g.Wait()
+				f.bufPool.Put(bufp)
+				return nil
+			}
+			g.Go(func() error {
+				defer func() { <-sem }()
+				err := cloudstorage.Run(gctx, func() error {
+					return blob.PutBlock(blockID, chunk, nil)
+				})
+				if gctx.Err() == nil {
+					// an abandoned PutBlock may still be reading chunk
+					f.bufPool.Put(bufp)
+				}
+				return err
+			})
 
-		blocks = append(blocks, az.Block{
-			ID:     blockID,
-			Status: az.BlockStatusLatest,
-		})
-		rawID++
+			if lastChunk {
+				return nil
+			}
+		}
+	}()
+	if err := g.Wait(); err != nil {
+		return "", err
 	}
-
-	err := blob.PutBlockList(blocks, nil)
-	if err != nil {
-		gou.Warnf("could not put block list %v", err)
-		return err
+	if readErr != nil {
+		return "", readErr
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
 	}
 
-	err = blob.GetProperties(nil)
+	err := cloudstorage.Run(ctx, func() error { return blob.PutBlockList(blocks, nil) })
 	if err != nil {
-		gou.Warnf("could not load blog properties %v", err)
-		return err
+		gou.Warnf("could not put block list %v", err)
+		return "", err
 	}
 
 	blob.Metadata = o.metadata
 
-	err = blob.SetMetadata(nil)
+	err = cloudstorage.Run(ctx, func() error { return blob.SetMetadata(nil) })
 	if err != nil {
 		gou.Warnf("can't set metadata err=%v", err)
-		return err
+		return "", err
 	}
-	return nil
+
+	// setting the metadata changes the etag, so the properties come last
+	err = cloudstorage.Run(ctx, func() error { return blob.GetProperties(nil) })
+	if err != nil {
+		gou.Warnf("could not load blog properties %v", err)
+		return "", err
+	}
+	return cloudstorage.CleanETag(blob.Properties.Etag), nil
 }
 
 // Delete requested object path string.
-func (f *FS) Delete(ctx context.Context, name string) error {
-	err := f.client.GetContainerReference(f.bucket).GetBlobReference(name).Delete(nil)
+func (f *FS) Delete(ctx context.Context, name string, opts ...cloudstorage.Opts) error {
+	var delOpts *az.DeleteBlobOptions
+	if len(opts) > 0 && opts[0].IfMatch != "" {
+		delOpts = &az.DeleteBlobOptions{IfMatch: `"` + cloudstorage.CleanETag(opts[0].IfMatch) + `"`}
+	}
+	err := f.client.GetContainerReference(f.bucket).GetBlobReference(name).Delete(delOpts)
 	if err != nil && strings.Contains(err.Error(), "404") {
 		return cloudstorage.ErrObjectNotFound
+	} else if statusCode(err) == http.StatusPreconditionFailed {
+		return cloudstorage.ErrPreconditionFailed
 	}
 	return err
 }
 
-func newObject(f *FS, o *az.Blob) *object {
-	obj := &object{
+// newObject of a listed blob, or one whose properties were loaded.  The
+// metadata is the blob's, with the content type of its properties unless
+// it was written with one.
+// newObject of a blob, taken from the recycled ones when reuse.
+func newObject(f *FS, o *az.Blob, reuse bool) *object {
+	obj := emptyObject(reuse)
+	*obj = object{
 		fs:        f,
 		o:         o,
 		name:      o.Name,
+		updated:   time.Time(o.Properties.LastModified),
 		bucket:    f.bucket,
 		cachepath: cloudstorage.CachePathObj(f.cachepath, o.Name, f.ID),
 	}
 	obj.o.Properties.Etag = cloudstorage.CleanETag(obj.o.Properties.Etag)
+	obj.metadata = make(map[string]string, len(o.Metadata)+1)
+	for k, v := range o.Metadata {
+		obj.metadata[k] = v
+	}
+	if _, ok := obj.metadata[cloudstorage.ContentTypeKey]; !ok && o.Properties.ContentType != "" {
+		obj.metadata[cloudstorage.ContentTypeKey] = o.Properties.ContentType
+	}
 	return obj
 }
 
-/*
-	func newObjectFromHead(f *FS, name string, o *s3.HeadObjectOutput) *object {
-		obj := &object{
-			fs:        f,
-			name:      name,
-			bucket:    f.bucket,
-			cachepath: cloudstorage.CachePathObj(f.cachepath, name, f.ID),
-		}
-		if o.LastModified != nil {
-			obj.updated = *o.LastModified
+// newLeanObject of a blob listed without its metadata.
+func newLeanObject(f *FS, o *az.Blob, reuse bool) *object {
+	o.Properties.Etag = cloudstorage.CleanETag(o.Properties.Etag)
+	obj := emptyObject(reuse)
+	*obj = object{
+		fs:        f,
+		o:         o,
+		name:      o.Name,
+		updated:   time.Time(o.Properties.LastModified),
+		bucket:    f.bucket,
+		cachepath: cloudstorage.CachePathObj(f.cachepath, o.Name, f.ID),
+		lean:      true,
+	}
+	return obj
+}
+
+// emptyObject to fill in, a recycled one when reuse.
+func emptyObject(reuse bool) *object {
+	if reuse {
+		return objectPool.Get().(*object)
+	}
+	return &object{}
+}
+
+// Recycle the objects of a Query.Reuse listing page for the next pages.
+func (f *FS) Recycle(objects cloudstorage.Objects) {
+	for _, o := range objects {
+		if obj, ok := o.(*object); ok && obj.fs == f {
+			*obj = object{}
+			objectPool.Put(obj)
 		}
-		// metadata?
-		obj.metadata, _ = convertMetaData(o.Metadata)
-		return obj
 	}
-*/
+}
+
+// load the properties and metadata of a lean object.
+func (o *object) load() {
+	if !o.lean {
+		return
+	}
+	o.lean = false
+	loaded, err := o.fs.getObject(context.Background(), o.name)
+	if err != nil {
+		gou.Warnf("could not load the properties of %s err=%v", o.name, err)
+		return
+	}
+	o.o, o.metadata = loaded.o, loaded.metadata
+}
+
+func (o *object) Size() int64 {
+	if o.o == nil {
+		return 0
+	}
+	return o.o.Properties.ContentLength
+}
+func (o *object) ETag() string {
+	if o.o == nil {
+		return ""
+	}
+	return o.o.Properties.Etag
+}
+func (o *object) Attrs() cloudstorage.ObjectAttributes {
+	o.load()
+	if o.o == nil {
+		return cloudstorage.BasicAttrs(o)
+	}
+	p := o.o.Properties
+	return cloudstorage.ObjectAttributes{
+		Size:            p.ContentLength,
+		Updated:         time.Time(p.LastModified).UTC(),
+		ContentType:     p.ContentType,
+		ContentEncoding: p.ContentEncoding,
+		CacheControl:    p.CacheControl,
+		ETag:            p.Etag,
+		CustomMetadata:  o.o.Metadata,
+	}
+}
+func (o *object) Hashes() map[string]string {
+	h := make(map[string]string, 1)
+	if o.o == nil || o.o.Properties.ContentMD5 == "" {
+		return h
+	}
+	if md5, err := base64.StdEncoding.DecodeString(o.o.Properties.ContentMD5); err == nil {
+		h[cloudstorage.HashMD5] = hex.EncodeToString(md5)
+	}
+	return h
+}
 func (o *object) StorageSource() string {
 	return StoreType
 }
@@ -574,12 +865,14 @@ func (o *object) String() string {
 	return o.name
 }
 func (o *object) Updated() time.Time {
-	return o.updated
+	return o.updated.UTC()
 }
 func (o *object) MetaData() map[string]string {
+	o.load()
 	return o.metadata
 }
 func (o *object) SetMetaData(meta map[string]string) {
+	o.lean = false
 	o.metadata = meta
 }
 
@@ -612,6 +905,7 @@ func (o *object) Open(accesslevel cloudstorage.AccessLevel) (*os.File, error) {
 		return nil, fmt.Errorf("error occurred creating file. local=%s err=%v", o.cachepath, err)
 	}
 
+	bo := cloudstorage.NewBackoffer(RetryBackoff)
 	for try := 0; try < Retries; try++ {
 		if o.rc == nil {
 			rc, err := o.fs.getOpenObject(context.Background(), o.name)
@@ -619,9 +913,10 @@ func (o *object) Open(accesslevel cloudstorage.AccessLevel) (*os.File, error) {
 				if err == cloudstorage.ErrObjectNotFound {
 					// New, this is fine
 				} else {
-					// lets re-try
 					errs = append(errs, fmt.Errorf("error getting object err=%v", err))
-					cloudstorage.Backoff(try)
+					if !o.fs.IsTransient(err) || !bo.Wait(context.Background()) {
+						break
+					}
 					continue
 				}
 			}
@@ -650,7 +945,9 @@ func (o *object) Open(accesslevel cloudstorage.AccessLevel) (*os.File, error) {
 					return nil, fmt.Errorf("error creating a new cachedcopy file. local=%s err=%v", o.cachepath, err)
 				}
 
-				cloudstorage.Backoff(try)
+				if !bo.Wait(context.Background()) {
+					break
+				}
 				continue
 			}
 		}
@@ -677,7 +974,7 @@ func (o *object) Open(accesslevel cloudstorage.AccessLevel) (*os.File, error) {
 		return o.cachedcopy, nil
 	}
 
-	return nil, fmt.Errorf("fetch error retry cnt reached: obj=%s tfile=%v errs:[%v]", o.name, o.cachepath, errs)
+	return nil, fmt.Errorf("fetch error: obj=%s tfile=%v errs:[%v]", o.name, o.cachepath, errs)
 }
 
 func (o *object) File() *os.File {
@@ -706,6 +1003,12 @@ func (o *object) Sync() error {
 		return fmt.Errorf("trying to Sync a readonly object:%s", o.name)
 	}
 
+	metadata, err := cloudstorage.NormalizeMetadata(o.MetaData())
+	if err != nil {
+		return err
+	}
+	o.metadata = metadata
+
 	cachedcopy, err := os.OpenFile(o.cachepath, os.O_RDWR, 0664)
 	if err != nil {
 		return fmt.Errorf("couldn't open localfile for sync'ing. local=%s err=%v", o.cachepath, err)
@@ -717,7 +1020,7 @@ func (o *object) Sync() error {
 	}
 
 	// Upload the file
-	if err = o.fs.uploadMultiPart(o, cachedcopy); err != nil {
+	if _, err = o.fs.uploadMultiPart(context.Background(), o, cachedcopy); err != nil {
 		gou.Warnf("could not upload %v", err)
 		return fmt.Errorf("failed to upload file, %v", err)
 	}
@@ -767,3 +1070,16 @@ func (o *object) Release() error {
 	os.Remove(o.cachepath)
 	return nil
 }
+
+// statusCode of an azure storage error, 0 for other errors.
+func statusCode(err error) int {
+	var serr az.AzureStorageServiceError
+	if errors.As(err, &serr) {
+		return serr.StatusCode
+	}
+	var uerr az.UnexpectedStatusCodeError
+	if errors.As(err, &uerr) {
+		return uerr.Got()
+	}
+	return 0
+}
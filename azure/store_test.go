@@ -1,8 +1,16 @@
 package azure_test
 
 import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"testing"
+	"time"
+
+	az "github.com/Azure/azure-sdk-for-go/storage"
 
 	"github.com/araddon/gou"
 	"github.com/stretchr/testify/require"
@@ -87,3 +95,158 @@ func TestAll(t *testing.T) {
 
 	testutils.RunTests(t, store, config)
 }
+
+func TestUploadSettings(t *testing.T) {
+	conf := &cloudstorage.Config{
+		Type:     azure.StoreType,
+		TmpDir:   t.TempDir(),
+		Settings: make(gou.JsonHelper),
+	}
+	conf.Settings[azure.ConfKeyChunkSize] = 200 * 1024 * 1024
+	_, err := azure.NewStore(nil, nil, conf)
+	require.Error(t, err)
+
+	conf.Settings[azure.ConfKeyChunkSize] = 1024 * 1024
+	conf.Settings[azure.ConfKeyUploadConcurrency] = 8
+	store, err := azure.NewStore(nil, nil, conf)
+	require.NoError(t, err)
+	require.NotNil(t, store)
+}
+
+func TestAzureConfigValidate(t *testing.T) {
+	conf := &cloudstorage.Config{
+		Type:       azure.StoreType,
+		AuthMethod: azure.AuthKey,
+		Settings:   make(gou.JsonHelper),
+	}
+	conf.Settings[azure.ConfKeyChunkSize] = -1
+	err := azure.NewAzureConfig(conf).Validate()
+	require.Error(t, err)
+	cerr, ok := err.(*cloudstorage.ConfigError)
+	require.True(t, ok)
+	require.Equal(t, []string{"project", "bucket", "tmpdir", "settings.azure_key"}, cerr.Missing)
+	require.Equal(t, 1, len(cerr.Invalid))
+
+	conf.Project = "account"
+	conf.Bucket = "tests"
+	conf.TmpDir = t.TempDir()
+	conf.Settings[azure.ConfKeyAuthKey] = "key"
+	delete(conf.Settings, azure.ConfKeyChunkSize)
+	require.NoError(t, azure.NewAzureConfig(conf).Validate())
+}
+
+// hostTransport sends every request to the test server.
+type hostTransport struct{ u *url.URL }
+
+func (h hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.URL.Scheme = h.u.Scheme
+	req.URL.Host = h.u.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestUploadCancel(t *testing.T) {
+	// PutBlock hangs until the test is done
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(done)
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	client, err := az.NewClient("account", base64.StdEncoding.EncodeToString([]byte("key")), az.DefaultBaseURL, az.DefaultAPIVersion, false)
+	require.NoError(t, err)
+	client.HTTPClient = &http.Client{Transport: hostTransport{u}}
+	blobClient := client.GetBlobService()
+
+	conf := &cloudstorage.Config{
+		Type:     azure.StoreType,
+		Bucket:   "tests",
+		TmpDir:   t.TempDir(),
+		Settings: make(gou.JsonHelper),
+	}
+	conf.Settings[azure.ConfKeyChunkSize] = 1024
+	store, err := azure.NewStore(&client, &blobClient, conf)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w, err := store.NewWriterWithContext(ctx, "cancel.csv", nil)
+	require.NoError(t, err)
+	_, err = w.Write(make([]byte, 4096))
+	require.NoError(t, err)
+
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	err = w.Close()
+	require.ErrorIs(t, err, context.Canceled)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestGetListMetadata(t *testing.T) {
+	const modified = "Mon, 06 Mar 2023 10:00:00 GMT"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("comp") == "list" {
+			require.Equal(t, "metadata", r.URL.Query().Get("include"))
+			w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?>
+<EnumerationResults><Blobs><Blob><Name>in/a.csv</Name><Properties>
+<Last-Modified>` + modified + `</Last-Modified><Etag>"0x1"</Etag>
+<Content-Length>8</Content-Length><Content-Type>text/csv</Content-Type>
+</Properties><Metadata><owner>etl</owner></Metadata></Blob></Blobs>
+<NextMarker/></EnumerationResults>`))
+			return
+		}
+		if r.URL.Path != "/tests/in/a.csv" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Last-Modified", modified)
+		w.Header().Set("Etag", `"0x1"`)
+		w.Header().Set("Content-Length", "8")
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("x-ms-meta-owner", "etl")
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	client, err := az.NewClient("account", base64.StdEncoding.EncodeToString([]byte("key")), az.DefaultBaseURL, az.DefaultAPIVersion, false)
+	require.NoError(t, err)
+	client.HTTPClient = &http.Client{Transport: hostTransport{u}}
+	blobClient := client.GetBlobService()
+	store, err := azure.NewStore(&client, &blobClient, &cloudstorage.Config{
+		Type:     azure.StoreType,
+		Bucket:   "tests",
+		TmpDir:   t.TempDir(),
+		Settings: make(gou.JsonHelper),
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+	updated, err := time.Parse(time.RFC1123, modified)
+	require.NoError(t, err)
+
+	check := func(obj cloudstorage.Object) {
+		require.Equal(t, "in/a.csv", obj.Name())
+		require.Equal(t, map[string]string{"owner": "etl", cloudstorage.ContentTypeKey: "text/csv"}, obj.MetaData())
+		require.True(t, updated.Equal(obj.Updated()), obj.Updated())
+		a := cloudstorage.AttrsOf(obj)
+		require.Equal(t, int64(8), a.Size)
+		require.Equal(t, "text/csv", a.ContentType)
+		require.Equal(t, "0x1", a.ETag)
+		require.Equal(t, map[string]string{"owner": "etl"}, a.CustomMetadata)
+	}
+	obj, err := store.Get(ctx, "in/a.csv")
+	require.NoError(t, err)
+	check(obj)
+
+	resp, err := store.List(ctx, cloudstorage.NewQuery("in/"))
+	require.NoError(t, err)
+	require.Len(t, resp.Objects, 1)
+	check(resp.Objects[0])
+
+	_, err = store.Get(ctx, "in/missing.csv")
+	require.Equal(t, cloudstorage.ErrObjectNotFound, err)
+}
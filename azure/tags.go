@@ -0,0 +1,44 @@
+package azure
+
+import (
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+var _ cloudstorage.TaggedStore = (*FS)(nil)
+
+// GetTags of the object, kept in the blob metadata as the azure sdk used
+// here predates blob index tags.
+func (f *FS) GetTags(ctx context.Context, name string) (map[string]string, error) {
+	blob := f.client.GetContainerReference(f.bucket).GetBlobReference(name)
+	if err := blob.GetMetadata(nil); err != nil {
+		if strings.Contains(err.Error(), "404") {
+			return nil, cloudstorage.ErrObjectNotFound
+		}
+		return nil, err
+	}
+	return cloudstorage.DecodeTags(blob.Metadata[cloudstorage.TagsMetadataKey]), nil
+}
+
+// SetTags replaces the tags, the rest of the blob metadata is kept.
+func (f *FS) SetTags(ctx context.Context, name string, tags map[string]string) error {
+	blob := f.client.GetContainerReference(f.bucket).GetBlobReference(name)
+	if err := blob.GetMetadata(nil); err != nil {
+		if strings.Contains(err.Error(), "404") {
+			return cloudstorage.ErrObjectNotFound
+		}
+		return err
+	}
+	if blob.Metadata == nil {
+		blob.Metadata = make(map[string]string)
+	}
+	if len(tags) == 0 {
+		delete(blob.Metadata, cloudstorage.TagsMetadataKey)
+	} else {
+		blob.Metadata[cloudstorage.TagsMetadataKey] = cloudstorage.EncodeTags(tags)
+	}
+	return blob.SetMetadata(nil)
+}
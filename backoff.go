@@ -0,0 +1,100 @@
+package cloudstorage
+
+import (
+	"math/rand"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// BackoffProfile of the delays between the retries of a failed request,
+// randomized exponential backoff with full jitter: the delay before retry n
+// is a random duration up to Base * 2^(n-1), at most Max.
+type BackoffProfile struct {
+	Base time.Duration
+	Max  time.Duration
+	// MaxElapsed is the time since the first try after which no more
+	// retries are made, 0 for no limit.
+	MaxElapsed time.Duration
+}
+
+// DefaultBackoff is the BackoffProfile of stores that aren't a
+// StoreBackoff.
+var DefaultBackoff = BackoffProfile{Base: time.Second, Max: 16 * time.Second, MaxElapsed: 2 * time.Minute}
+
+// BackoffProfileOf s, its BackoffProfile if it is a StoreBackoff,
+// otherwise DefaultBackoff.
+func BackoffProfileOf(s StoreReader) BackoffProfile {
+	if sb, ok := s.(StoreBackoff); ok {
+		return sb.BackoffProfile()
+	}
+	return DefaultBackoff
+}
+
+// Delay before retry try, the first retry is 1.
+func (p BackoffProfile) Delay(try int) time.Duration {
+	if try < 1 || p.Base <= 0 {
+		return 0
+	}
+	ceil := p.Max
+	if try <= 32 && p.Base<<(try-1) < ceil {
+		ceil = p.Base << (try - 1)
+	}
+	if ceil <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceil)))
+}
+
+// Backoffer waits between the retries of one operation with its
+// BackoffProfile.
+//
+//	bo := cloudstorage.NewBackoffer(cloudstorage.BackoffProfileOf(store))
+//	for try := 0; try < retries; try++ {
+//		if try > 0 && !bo.Wait(ctx) {
+//			break
+//		}
+//		...
+//	}
+type Backoffer struct {
+	profile BackoffProfile
+	start   time.Time
+	tries   int
+}
+
+// NewBackoffer for an operation starting now.
+func NewBackoffer(p BackoffProfile) *Backoffer {
+	return &Backoffer{profile: p, start: time.Now()}
+}
+
+// Wait sleeps the delay before the next retry and returns true.  It
+// returns false, without sleeping out the delay, if ctx is done or the
+// retry would start past the profile's MaxElapsed.
+func (b *Backoffer) Wait(ctx context.Context) bool {
+	b.tries++
+	d := b.profile.Delay(b.tries)
+	if b.profile.MaxElapsed > 0 && time.Since(b.start)+d > b.profile.MaxElapsed {
+		return false
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// Backoff sleeps a random amount so we can.
+// retry failed requests using a randomized exponential backoff:
+// wait a random period between [0..1] seconds and retry; if that fails,
+// wait a random period between [0..2] seconds and retry; if that fails,
+// wait a random period between [0..4] seconds and retry, and so on,
+// with an upper bounds to the wait period being 16 seconds.
+//
+// Deprecated: Backoff can't be cancelled and has no limit on the total
+// time spent retrying, use a Backoffer.
+func Backoff(try int) {
+	time.Sleep(DefaultBackoff.Delay(try + 1))
+}
@@ -0,0 +1,62 @@
+package cloudstorage_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/mockstore"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	p := cloudstorage.BackoffProfile{Base: 10 * time.Millisecond, Max: 50 * time.Millisecond}
+	require.Equal(t, time.Duration(0), p.Delay(0))
+	for i := 0; i < 100; i++ {
+		require.Less(t, p.Delay(1), 10*time.Millisecond)
+		require.Less(t, p.Delay(3), 40*time.Millisecond)
+		require.Less(t, p.Delay(100), 50*time.Millisecond)
+	}
+	require.Equal(t, cloudstorage.DefaultBackoff, cloudstorage.BackoffProfileOf(mockstore.New()))
+}
+
+func TestBackoffer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	bo := cloudstorage.NewBackoffer(cloudstorage.BackoffProfile{Base: time.Millisecond, Max: time.Millisecond})
+	require.True(t, bo.Wait(ctx))
+	cancel()
+	require.False(t, bo.Wait(ctx))
+
+	// a cancelled wait returns at once
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	bo = cloudstorage.NewBackoffer(cloudstorage.BackoffProfile{Base: time.Hour, Max: time.Hour})
+	bo.Wait(ctx)
+	started := time.Now()
+	require.False(t, bo.Wait(ctx))
+	require.Less(t, time.Since(started), time.Second)
+
+	bo = cloudstorage.NewBackoffer(cloudstorage.BackoffProfile{Base: time.Millisecond, Max: time.Millisecond,
+		MaxElapsed: 20 * time.Millisecond})
+	tries := 0
+	for bo.Wait(context.Background()) {
+		tries++
+		time.Sleep(5 * time.Millisecond)
+	}
+	require.Greater(t, tries, 0)
+	require.Less(t, tries, 5)
+}
+
+func TestWriteAllCancelledRetry(t *testing.T) {
+	store := mockstore.New()
+	store.Fail("NewWriter", "out/a.csv", errors.New("503 slow down"), 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	err := cloudstorage.WriteAll(ctx, store, "out/a.csv", []byte("a,b\n"), nil)
+	require.Error(t, err)
+	require.Less(t, time.Since(started), 500*time.Millisecond)
+}
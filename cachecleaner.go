@@ -1,13 +1,168 @@
 package cloudstorage
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"syscall"
 	"time"
 
 	"github.com/araddon/gou"
+	"golang.org/x/net/context"
 )
 
+// CacheLockFile is written into each store's cache directory and records
+// the CacheOwner of the directory.
+const CacheLockFile = "owner.lock"
+
+// CacheOwner identifies the process and store owning a cache directory.
+type CacheOwner struct {
+	StoreID string    `json:"store_id"`
+	PID     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Started time.Time `json:"started"`
+}
+
+// CacheDir creates the cache directory of store storeID below tmpDir, along
+// with a CacheLockFile naming this process as its owner, and returns its path.
+// Stores keep their cache files in their own directory so the caches left
+// behind by a crash can be told apart and removed, see CleanCache.
+func CacheDir(tmpDir, storeID string) (string, error) {
+	if tmpDir == "" {
+		return "", fmt.Errorf("unable to create cachepath. tmpdir=%q", tmpDir)
+	}
+	dir := filepath.Join(tmpDir, storeID)
+	if err := os.MkdirAll(dir, 0775); err != nil {
+		return "", fmt.Errorf("unable to create cachepath. path=%s err=%v", dir, err)
+	}
+	host, _ := os.Hostname()
+	by, err := json.Marshal(&CacheOwner{StoreID: storeID, PID: os.Getpid(), Host: host, Started: time.Now().UTC()})
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, CacheLockFile), by, 0664); err != nil {
+		return "", fmt.Errorf("unable to write cache lockfile. path=%s err=%v", dir, err)
+	}
+	return dir, nil
+}
+
+// CleanCache cleans the TmpDir shared by the store whose cache directory is
+// cachepath, as created by CacheDir.  Cache directories owned by a process
+// of this host that is no longer running are removed, as are those of other
+// hosts unchanged for olderThan.  In those of running processes cache files
+// older than olderThan are removed, as CleanupCacheFiles does.  cachepath
+// itself is left alone, as is everything without a CacheLockFile: the
+// TmpDir is often os.TempDir(), shared with other programs.
+//
+// Call it once at startup to reclaim the space of crashed processes.
+func CleanCache(ctx context.Context, cachepath string, olderThan time.Duration) error {
+	root := cachepath
+	if Exists(filepath.Join(cachepath, CacheLockFile)) {
+		root = filepath.Dir(cachepath)
+	}
+	host, _ := os.Hostname()
+	cutoff := time.Now().Add(-olderThan)
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		p := filepath.Join(root, e.Name())
+		if !e.IsDir() || p == filepath.Clean(cachepath) {
+			continue
+		}
+		owner, err := readCacheOwner(p)
+		if err != nil {
+			gou.Warnf("cloudstorage: skipping cache dir with unreadable lockfile %s: %v", p, err)
+			continue
+		}
+		if owner == nil {
+			// not a cache directory
+			continue
+		}
+		if cacheOwnerGone(owner, host, p, cutoff) {
+			gou.Debugf("cloudstorage: removing stale cache dir %s of pid=%d host=%s", p, owner.PID, owner.Host)
+			if err := os.RemoveAll(p); err != nil {
+				return err
+			}
+			continue
+		}
+		err = filepath.Walk(p, func(fp string, fi os.FileInfo, err error) error {
+			if err != nil || fi.IsDir() {
+				return err
+			}
+			return removeOldCacheFile(fp, cutoff)
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// readCacheOwner reads the CacheLockFile of dir, nil if there is none.
+func readCacheOwner(dir string) (*CacheOwner, error) {
+	by, err := os.ReadFile(filepath.Join(dir, CacheLockFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	owner := &CacheOwner{}
+	if err := json.Unmarshal(by, owner); err != nil {
+		return nil, err
+	}
+	return owner, nil
+}
+
+// cacheOwnerGone is true when the owner of cache directory dir has exited.
+// Processes of other hosts can't be checked, so their directories count as
+// gone once nothing in them changed since cutoff.
+func cacheOwnerGone(owner *CacheOwner, host, dir string, cutoff time.Time) bool {
+	if owner.Host == host {
+		return !processRunning(owner.PID)
+	}
+	var changed bool
+	filepath.Walk(dir, func(_ string, fi os.FileInfo, err error) error {
+		if err == nil && fi.ModTime().After(cutoff) {
+			changed = true
+		}
+		return nil
+	})
+	return !changed
+}
+
+// processRunning reports whether pid is running, errors other than the
+// process being done (ie unsupported platforms) count as running.
+func processRunning(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return !errors.Is(err, os.ErrProcessDone)
+}
+
+func removeOldCacheFile(name string, cutoff time.Time) error {
+	if filepath.Ext(name) != StoreCacheFileExt {
+		return nil
+	}
+	fi, err := os.Stat(name)
+	if err != nil || !fi.ModTime().Before(cutoff) {
+		return nil
+	}
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
 // CleanupCacheFiles cleans up old store cache files
 // if your process crashes all it's old cache files, the local copies of the cloudfiles,
 // will left behind.
@@ -0,0 +1,73 @@
+package cloudstorage_test
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+func TestCleanCache(t *testing.T) {
+	tmpDir := t.TempDir()
+	own, err := cloudstorage.CacheDir(tmpDir, "own")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(tmpDir, "own"), own)
+
+	by, err := os.ReadFile(filepath.Join(own, cloudstorage.CacheLockFile))
+	require.NoError(t, err)
+	owner := &cloudstorage.CacheOwner{}
+	require.NoError(t, json.Unmarshal(by, owner))
+	require.Equal(t, "own", owner.StoreID)
+	require.Equal(t, os.Getpid(), owner.PID)
+
+	// a store of this process still running
+	live, err := cloudstorage.CacheDir(tmpDir, "live")
+	require.NoError(t, err)
+
+	// a store of a process that has exited
+	cmd := exec.Command("true")
+	require.NoError(t, cmd.Run())
+	crashed := filepath.Join(tmpDir, "crashed")
+	require.NoError(t, os.MkdirAll(crashed, 0775))
+	host, _ := os.Hostname()
+	by, err = json.Marshal(&cloudstorage.CacheOwner{StoreID: "crashed", PID: cmd.Process.Pid, Host: host})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(crashed, cloudstorage.CacheLockFile), by, 0664))
+
+	old := time.Now().Add(-2 * time.Hour)
+	touch := func(name string, mtime time.Time) string {
+		require.NoError(t, cloudstorage.EnsureDir(name))
+		require.NoError(t, os.WriteFile(name, []byte("x"), 0664))
+		require.NoError(t, os.Chtimes(name, mtime, mtime))
+		return name
+	}
+	crashedFile := touch(filepath.Join(crashed, "a.csv.crashed.cache"), time.Now())
+	liveOld := touch(filepath.Join(live, "folder", "b.csv.live.cache"), old)
+	liveNew := touch(filepath.Join(live, "c.csv.live.cache"), time.Now())
+	ownOld := touch(filepath.Join(own, "d.csv.own.cache"), old)
+	// files of other programs sharing the TmpDir
+	looseOld := touch(filepath.Join(tmpDir, "folder", "e.csv.x.cache"), old)
+	looseNew := touch(filepath.Join(tmpDir, "f.csv.x.cache"), time.Now())
+	foreign := touch(filepath.Join(tmpDir, "x", "foo.cache"), old)
+	foreignTop := touch(filepath.Join(tmpDir, "foo.cache"), old)
+
+	require.NoError(t, cloudstorage.CleanCache(context.Background(), own, time.Hour))
+
+	require.NoDirExists(t, crashed)
+	require.NoFileExists(t, crashedFile)
+	require.NoFileExists(t, liveOld)
+	require.FileExists(t, liveNew)
+	require.FileExists(t, filepath.Join(live, cloudstorage.CacheLockFile))
+	require.FileExists(t, ownOld)
+	require.FileExists(t, looseOld)
+	require.FileExists(t, looseNew)
+	require.FileExists(t, foreign)
+	require.FileExists(t, foreignTop)
+}
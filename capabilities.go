@@ -0,0 +1,32 @@
+package cloudstorage
+
+import (
+	"time"
+)
+
+// Capabilities of a store beyond the Store interface, what callers and the
+// conformance suite can rely on.  The zero value claims nothing.
+type Capabilities struct {
+	// ETags is true if objects are ObjectETaggers and readers and Delete
+	// honor Opts.IfNoneMatch and Opts.IfMatch.
+	ETags bool
+	// IfNotExists is true if writers honor Opts.IfNotExists.
+	IfNotExists bool
+	// Compression is true if Config.EnableCompression compresses the
+	// objects written.
+	Compression bool
+	// Concurrent is true if the store is safe for concurrent use.
+	Concurrent bool
+	// ConsistencyDelay is how long listings and reads may still show the
+	// state from before a write or delete.
+	ConsistencyDelay time.Duration
+}
+
+// CapabilitiesOf store s, the zero Capabilities when it doesn't implement
+// StoreCapabilities.
+func CapabilitiesOf(s StoreReader) Capabilities {
+	if sc, ok := s.(StoreCapabilities); ok {
+		return sc.Capabilities()
+	}
+	return Capabilities{}
+}
@@ -0,0 +1,29 @@
+package cloudstorage_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/localfs"
+)
+
+func TestCapabilitiesOf(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "mockcloud"),
+		TmpDir:     filepath.Join(tmpDir, "localcache"),
+		Bucket:     "capabilities",
+	})
+	require.NoError(t, err)
+	caps := cloudstorage.CapabilitiesOf(store)
+	require.True(t, caps.IfNotExists)
+	require.True(t, caps.Concurrent)
+	require.False(t, caps.ETags)
+
+	require.Equal(t, cloudstorage.Capabilities{}, cloudstorage.CapabilitiesOf(plainStore{store}))
+}
@@ -0,0 +1,230 @@
+// Package checkpoint reads and writes checkpoint manifests for incremental
+// jobs, recording the last processed key and time per prefix in the same
+// Store the job reads from.
+//
+// Every Save writes a new version object named <name>/<version>.json using
+// cloudstorage.Opts{IfNotExists: true}, so of two workers saving on top of
+// the same version only one wins and the other gets ErrConflict.  The store
+// must support IfNotExists (gcs, localfs, ftp, swift, hdfs).
+package checkpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/araddon/gou"
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+var (
+	// ErrConflict is returned by Save when another writer saved a newer
+	// version of the checkpoint first, Load it again and re-apply changes.
+	ErrConflict = errors.New("checkpoint was updated concurrently")
+
+	// Keep is the default number of checkpoint versions kept in the store,
+	// older ones are deleted after a successful Save.
+	Keep = 3
+
+	// MaxRetries is the number of times Update retries on ErrConflict.
+	MaxRetries = 10
+)
+
+// Position is the last processed key and its time for a prefix.
+type Position struct {
+	Key  string    `json:"key"`
+	Time time.Time `json:"time"`
+}
+
+// Checkpoint is a manifest of the positions of an incremental job.
+type Checkpoint struct {
+	// Version is incremented by each Save, 0 is a checkpoint never saved.
+	Version  int64               `json:"version"`
+	Updated  time.Time           `json:"updated"`
+	Prefixes map[string]Position `json:"prefixes"`
+}
+
+// Set records the position for prefix.
+func (c *Checkpoint) Set(prefix, key string, t time.Time) {
+	if c.Prefixes == nil {
+		c.Prefixes = make(map[string]Position)
+	}
+	c.Prefixes[prefix] = Position{Key: key, Time: t}
+}
+
+// Manager loads and saves the checkpoint stored under a name.
+type Manager struct {
+	store cloudstorage.Store
+	name  string
+	// Keep overrides the package Keep versions for this manager.
+	Keep int
+}
+
+// New creates a Manager for the checkpoint stored at name, ie
+// "checkpoints/events-etl".
+func New(store cloudstorage.Store, name string) *Manager {
+	return &Manager{store: store, name: strings.TrimSuffix(name, "/"), Keep: Keep}
+}
+
+// Load returns the latest checkpoint, or an empty one with Version 0 if
+// none has been saved.
+func (m *Manager) Load(ctx context.Context) (*Checkpoint, error) {
+	versions, err := m.versions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(versions) - 1; i >= 0; i-- {
+		cp, err := m.read(ctx, versions[i])
+		if err != nil {
+			// a version still being written by another worker isn't
+			// readable yet, use the one before it.
+			gou.Warnf("could not read checkpoint %s version %d: %v", m.name, versions[i], err)
+			continue
+		}
+		return cp, nil
+	}
+	if len(versions) > 0 {
+		return nil, fmt.Errorf("no readable version of checkpoint %s", m.name)
+	}
+	return &Checkpoint{Prefixes: make(map[string]Position)}, nil
+}
+
+// Save writes cp as the next version, failing with ErrConflict if that
+// version was already written by another worker.  On success cp.Version
+// is incremented.
+func (m *Manager) Save(ctx context.Context, cp *Checkpoint) error {
+	next := *cp
+	next.Version++
+	next.Updated = time.Now().UTC()
+	by, err := json.Marshal(&next)
+	if err != nil {
+		return err
+	}
+
+	name := m.objectName(next.Version)
+	if err := m.write(ctx, name, by); err != nil {
+		if err == cloudstorage.ErrObjectExists {
+			return ErrConflict
+		}
+		// stores report a failed precondition differently, if the
+		// version now exists someone else wrote it.
+		if _, gerr := m.store.Get(ctx, name); gerr == nil {
+			return ErrConflict
+		}
+		return err
+	}
+	*cp = next
+	m.prune(ctx, next.Version)
+	return nil
+}
+
+// Update loads the checkpoint, applies fn and saves it, retrying on
+// ErrConflict with the freshly loaded checkpoint up to MaxRetries times.
+func (m *Manager) Update(ctx context.Context, fn func(cp *Checkpoint) error) (*Checkpoint, error) {
+	for try := 0; ; try++ {
+		cp, err := m.Load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err := fn(cp); err != nil {
+			return nil, err
+		}
+		err = m.Save(ctx, cp)
+		if err == nil {
+			return cp, nil
+		}
+		if err != ErrConflict || try >= MaxRetries {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Duration(rand.Int63n(int64(10*time.Millisecond) << uint(try)))):
+		}
+	}
+}
+
+func (m *Manager) write(ctx context.Context, name string, by []byte) error {
+	w, err := m.store.NewWriterWithContext(ctx, name, map[string]string{cloudstorage.ContentTypeKey: "application/json"},
+		cloudstorage.Opts{IfNotExists: true, DisableCompression: true})
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(by); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (m *Manager) read(ctx context.Context, version int64) (*Checkpoint, error) {
+	rc, err := m.store.NewReaderWithContext(ctx, m.objectName(version))
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	by, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	cp := &Checkpoint{}
+	if err := json.Unmarshal(by, cp); err != nil {
+		return nil, err
+	}
+	if cp.Prefixes == nil {
+		cp.Prefixes = make(map[string]Position)
+	}
+	return cp, nil
+}
+
+// versions lists the saved versions, oldest first.
+func (m *Manager) versions(ctx context.Context) ([]int64, error) {
+	q := cloudstorage.NewQuery(m.name + "/")
+	q.Sorted()
+	resp, err := m.store.List(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]int64, 0, len(resp.Objects))
+	for _, o := range resp.Objects {
+		v, err := strconv.ParseInt(strings.TrimSuffix(path.Base(o.Name()), ".json"), 10, 64)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
+
+// prune deletes versions older than the Keep newest.
+func (m *Manager) prune(ctx context.Context, latest int64) {
+	if m.Keep <= 0 {
+		return
+	}
+	versions, err := m.versions(ctx)
+	if err != nil {
+		gou.Warnf("could not list checkpoint %s versions: %v", m.name, err)
+		return
+	}
+	for _, v := range versions {
+		if v > latest-int64(m.Keep) {
+			break
+		}
+		if err := m.store.Delete(ctx, m.objectName(v)); err != nil && err != cloudstorage.ErrObjectNotFound {
+			gou.Warnf("could not delete checkpoint %s version %d: %v", m.name, v, err)
+		}
+	}
+}
+
+// objectName zero pads the version so versions list in order.
+func (m *Manager) objectName(version int64) string {
+	return fmt.Sprintf("%s/%020d.json", m.name, version)
+}
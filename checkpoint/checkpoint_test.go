@@ -0,0 +1,97 @@
+package checkpoint_test
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/checkpoint"
+	"github.com/lytics/cloudstorage/localfs"
+)
+
+func newStore(t *testing.T) cloudstorage.Store {
+	tmpDir := t.TempDir()
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "mockcloud"),
+		TmpDir:     filepath.Join(tmpDir, "localcache"),
+		Bucket:     "checkpoint",
+	})
+	require.NoError(t, err)
+	return store
+}
+
+func TestSaveLoad(t *testing.T) {
+	ctx := context.Background()
+	store := newStore(t)
+	m := checkpoint.New(store, "checkpoints/etl")
+
+	cp, err := m.Load(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), cp.Version)
+	require.Empty(t, cp.Prefixes)
+
+	ts := time.Date(2023, 3, 1, 10, 0, 0, 0, time.UTC)
+	cp.Set("events/", "events/2023/03/01/10.json", ts)
+	require.NoError(t, m.Save(ctx, cp))
+	require.Equal(t, int64(1), cp.Version)
+
+	stale, err := m.Load(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), stale.Version)
+	require.Equal(t, checkpoint.Position{Key: "events/2023/03/01/10.json", Time: ts}, stale.Prefixes["events/"])
+
+	cp.Set("users/", "users/b.json", ts)
+	require.NoError(t, m.Save(ctx, cp))
+
+	// saving on top of an old version loses
+	stale.Set("events/", "events/2023/03/01/11.json", ts)
+	require.Equal(t, checkpoint.ErrConflict, m.Save(ctx, stale))
+	require.Equal(t, int64(1), stale.Version)
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, m.Save(ctx, cp))
+	}
+	latest, err := m.Load(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(7), latest.Version)
+	require.Len(t, latest.Prefixes, 2)
+
+	// old versions are pruned
+	resp, err := store.List(ctx, cloudstorage.NewQuery("checkpoints/etl/"))
+	require.NoError(t, err)
+	require.Len(t, resp.Objects, checkpoint.Keep)
+}
+
+func TestUpdateConcurrent(t *testing.T) {
+	ctx := context.Background()
+	m := checkpoint.New(newStore(t), "checkpoints/counter")
+
+	const workers = 5
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := m.Update(ctx, func(cp *checkpoint.Checkpoint) error {
+				n, _ := strconv.Atoi(cp.Prefixes["count"].Key)
+				cp.Set("count", strconv.Itoa(n+1), time.Now())
+				return nil
+			})
+			require.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	cp, err := m.Load(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(workers), cp.Version)
+	require.Equal(t, strconv.Itoa(workers), cp.Prefixes["count"].Key)
+}
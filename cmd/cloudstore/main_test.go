@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDestName(t *testing.T) {
+	tests := []struct {
+		src, dst, name, want string
+	}{
+		{"in/a.csv", "out/b.csv", "in/a.csv", "out/b.csv"},
+		{"in/a.csv", "out/", "in/a.csv", "out/a.csv"},
+		{"in/a.csv", "", "in/a.csv", "a.csv"},
+		{"in/", "out/", "in/x/a.csv", "out/x/a.csv"},
+		{"in/", "out", "in/a.csv", "out/a.csv"},
+		{"in", "out", "in/a.csv", "out/a.csv"},
+		{"in", "out", "inbox.csv", "outbox.csv"},
+		{"in/", "", "in/a.csv", "a.csv"},
+		{"", "out/", "a.csv", "out/a.csv"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, destName(tt.src, tt.dst, tt.name), "%+v", tt)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "in", "x"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "in", "a.csv"), []byte("a,b\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "in", "x", "b.csv"), []byte("c,d\n"), 0644))
+	storeURL := func(p string) string {
+		return "file://" + p + "?tmpdir=" + filepath.Join(dir, "tmp")
+	}
+
+	runOut := func(args ...string) string {
+		var out bytes.Buffer
+		require.NoError(t, run(ctx, args, &out), "%v", args)
+		return out.String()
+	}
+
+	require.Equal(t, "x/\na.csv\n", runOut("ls", storeURL(src+"/in/")))
+	require.Equal(t, "in/a.csv\nin/x/b.csv\n", runOut("ls", "-r", storeURL(src+"/in")))
+	require.Equal(t, "a,b\n", runOut("cat", storeURL(src+"/in/a.csv")))
+
+	dst := filepath.Join(dir, "dst")
+	runOut("cp", storeURL(src+"/in/a.csv"), storeURL(dst+"/"))
+	b, err := os.ReadFile(filepath.Join(dst, "a.csv"))
+	require.NoError(t, err)
+	require.Equal(t, "a,b\n", string(b))
+
+	require.Equal(t, "in/a.csv -> out/a.csv\nin/x/b.csv -> out/x/b.csv\n",
+		runOut("cp", "-r", storeURL(src+"/in"), storeURL(dst+"/out")))
+	b, err = os.ReadFile(filepath.Join(dst, "out", "x", "b.csv"))
+	require.NoError(t, err)
+	require.Equal(t, "c,d\n", string(b))
+
+	// unchanged objects aren't copied again, extra ones are deleted
+	require.NoError(t, os.WriteFile(filepath.Join(dst, "out", "old.csv"), []byte("old"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "in", "x", "b.csv"), []byte("c,d,e\n"), 0644))
+	require.Equal(t, "in/x/b.csv -> out/x/b.csv\ndelete out/old.csv\n",
+		runOut("sync", "-delete", "-n", storeURL(src+"/in"), storeURL(dst+"/out")))
+	require.Equal(t, "in/x/b.csv -> out/x/b.csv\ndelete out/old.csv\n",
+		runOut("sync", "-delete", storeURL(src+"/in"), storeURL(dst+"/out")))
+	require.Equal(t, "", runOut("sync", "-delete", storeURL(src+"/in"), storeURL(dst+"/out")))
+	require.NoFileExists(t, filepath.Join(dst, "out", "old.csv"))
+
+	require.Equal(t, "out/a.csv\nout/x/b.csv\n", runOut("rm", "-r", storeURL(dst+"/out")))
+	runOut("rm", storeURL(dst+"/a.csv"))
+	require.NoFileExists(t, filepath.Join(dst, "a.csv"))
+
+	var out bytes.Buffer
+	err = run(ctx, []string{"presign", storeURL(src + "/in/a.csv")}, &out)
+	require.ErrorContains(t, err, "can't sign urls")
+	require.Error(t, run(ctx, []string{"mv"}, &out))
+	require.Error(t, run(ctx, []string{"serve", "local"}, &out))
+	require.Error(t, run(ctx, []string{"cp", storeURL(src + "/in/a.csv")}, &out))
+}
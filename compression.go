@@ -0,0 +1,94 @@
+package cloudstorage
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression codecs of Config.CompressionCodec, they double as the
+// Content-Encoding of the objects written with them.
+const (
+	CodecGzip   = "gzip"
+	CodecZstd   = "zstd"
+	CodecSnappy = "snappy"
+)
+
+// ValidateCompression checks a Config.CompressionCodec ("" is gzip) and
+// Config.CompressionLevel (0 is the codec default) pair.
+func ValidateCompression(codec string, level int) error {
+	switch codec {
+	case "", CodecGzip:
+		if level != 0 && (level < gzip.HuffmanOnly || level > gzip.BestCompression) {
+			return fmt.Errorf("compression level %d must be between %d and %d for gzip",
+				level, gzip.HuffmanOnly, gzip.BestCompression)
+		}
+	case CodecZstd:
+		if level < 0 || level > 22 {
+			return fmt.Errorf("compression level %d must be between 1 and 22 for zstd", level)
+		}
+	case CodecSnappy:
+		if level != 0 {
+			return fmt.Errorf("snappy has no compression levels")
+		}
+	default:
+		return fmt.Errorf("unknown compression codec %q", codec)
+	}
+	return nil
+}
+
+// NewCompressWriter compresses what is written to it into w with codec
+// ("" is gzip) at level (0 is the codec default).  Close flushes the
+// compressed stream but doesn't close w.
+func NewCompressWriter(w io.Writer, codec string, level int) (io.WriteCloser, error) {
+	if err := ValidateCompression(codec, level); err != nil {
+		return nil, err
+	}
+	switch codec {
+	case CodecZstd:
+		var opts []zstd.EOption
+		if level != 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		return zstd.NewWriter(w, opts...)
+	case CodecSnappy:
+		return snappy.NewBufferedWriter(w), nil
+	default:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(w, level)
+	}
+}
+
+// IsCompressed is true for the Content-Encoding of a codec NewDecompressReader
+// reads.
+func IsCompressed(encoding string) bool {
+	switch encoding {
+	case CodecGzip, CodecZstd, CodecSnappy:
+		return true
+	}
+	return false
+}
+
+// NewDecompressReader decompresses r, an object with Content-Encoding
+// encoding.  Encodings that aren't compressed are read as is.
+func NewDecompressReader(r io.Reader, encoding string) (io.ReadCloser, error) {
+	switch encoding {
+	case CodecGzip:
+		return gzip.NewReader(r)
+	case CodecZstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	case CodecSnappy:
+		return io.NopCloser(snappy.NewReader(r)), nil
+	default:
+		return io.NopCloser(r), nil
+	}
+}
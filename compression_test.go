@@ -0,0 +1,60 @@
+package cloudstorage_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+)
+
+func TestCompressionCodecs(t *testing.T) {
+	data := strings.Repeat("Year,Make,Model\n2003,VW,EuroVan\n", 100)
+	for _, tc := range []struct {
+		codec string
+		level int
+	}{
+		{"", 0},
+		{cloudstorage.CodecGzip, 9},
+		{cloudstorage.CodecZstd, 0},
+		{cloudstorage.CodecZstd, 19},
+		{cloudstorage.CodecSnappy, 0},
+	} {
+		var buf bytes.Buffer
+		w, err := cloudstorage.NewCompressWriter(&buf, tc.codec, tc.level)
+		require.NoError(t, err, tc.codec)
+		_, err = io.WriteString(w, data)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		require.Less(t, buf.Len(), len(data), tc.codec)
+
+		encoding := tc.codec
+		if encoding == "" {
+			encoding = cloudstorage.CodecGzip
+		}
+		require.True(t, cloudstorage.IsCompressed(encoding))
+		r, err := cloudstorage.NewDecompressReader(&buf, encoding)
+		require.NoError(t, err, tc.codec)
+		by, err := io.ReadAll(r)
+		require.NoError(t, err, tc.codec)
+		require.NoError(t, r.Close())
+		require.Equal(t, data, string(by), tc.codec)
+	}
+
+	require.False(t, cloudstorage.IsCompressed(""))
+	r, err := cloudstorage.NewDecompressReader(strings.NewReader(data), "")
+	require.NoError(t, err)
+	by, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, data, string(by))
+
+	require.Error(t, cloudstorage.ValidateCompression("lz4", 0))
+	require.Error(t, cloudstorage.ValidateCompression(cloudstorage.CodecGzip, 10))
+	require.Error(t, cloudstorage.ValidateCompression(cloudstorage.CodecZstd, 23))
+	require.Error(t, cloudstorage.ValidateCompression(cloudstorage.CodecSnappy, 1))
+	_, err = cloudstorage.NewCompressWriter(io.Discard, "lz4", 0)
+	require.Error(t, err)
+}
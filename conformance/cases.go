@@ -0,0 +1,1526 @@
+package conformance
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/araddon/gou"
+	"github.com/lytics/cloudstorage"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/iterator"
+)
+
+var testcsv = "Year,Make,Model\n1997,Ford,E350\n2000,Mercury,Cougar\n"
+
+func deleteIfExists(store cloudstorage.Store, filePath string) {
+	// Read the object from store, delete if it exists
+	obj, _ := store.Get(context.Background(), filePath)
+	if obj != nil {
+		obj.Delete()
+	}
+}
+
+func (s *Suite) StoreSetup(t *testing.T) {
+	store := s.Store
+
+	// Ensure the store has a String identifying store type
+	require.NotEqual(t, "", store.String())
+
+	// We should be able to get underlying client
+	require.NotNil(t, store.Client())
+}
+
+func (s *Suite) BasicRW(t *testing.T) {
+	store := s.Store
+
+	// Read the object from store, delete if it exists
+	deleteIfExists(store, "prefix/test.csv")
+
+	// Store should be empty
+	all, err := store.List(context.Background(), cloudstorage.NewQueryAll())
+	require.NoError(t, err)
+	require.NotNil(t, all)
+	require.Empty(t, all.Objects)
+
+	// Create a new object and write to it.
+	obj, err := store.NewObject("prefix/test.csv")
+	require.NoError(t, err)
+	require.NotNil(t, obj)
+
+	// Opening is required for new objects.
+	f, err := obj.Open(cloudstorage.ReadWrite)
+	require.NoError(t, err)
+	require.NotNil(t, f)
+
+	w := bufio.NewWriter(f)
+	_, err = w.WriteString(testcsv)
+	require.NoError(t, err)
+	err = w.Flush()
+	require.NoError(t, err)
+
+	// Close() actually does the upload/flush/write to cloud
+	err = obj.Close()
+	require.NoError(t, err)
+
+	err = obj.Release()
+	require.NoError(t, err)
+
+	// Read the object back out of the cloud store.
+	obj2, err := store.Get(context.Background(), "prefix/test.csv")
+	require.NoError(t, err)
+	require.Equal(t, store.Type(), obj2.StorageSource())
+	require.Equal(t, "prefix/test.csv", obj2.Name())
+	require.Equal(t, "prefix/test.csv", obj2.String())
+
+	f2, err := obj2.Open(cloudstorage.ReadOnly)
+	defer func() {
+		// Delete should close the file
+		_ = f2.Close()
+	}()
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf("%p", f2), fmt.Sprintf("%p", obj2.File()))
+
+	bytes, err := io.ReadAll(f2)
+	require.NoError(t, err)
+
+	require.Equal(t, testcsv, string(bytes))
+
+	// Store should be not empty
+	all, err = store.List(context.Background(), cloudstorage.NewQueryAll())
+	require.NoError(t, err)
+	require.NotNil(t, all)
+	require.NotEmpty(t, all.Objects)
+
+	// Now delete again
+	err = obj2.Delete()
+	require.NoError(t, err)
+	obj, err = store.Get(context.Background(), "prefix/test.csv")
+	require.Equal(t, cloudstorage.ErrObjectNotFound, err)
+	require.Nil(t, obj)
+
+	// Store should be empty again
+	all, err = store.List(context.Background(), cloudstorage.NewQueryAll())
+	require.NoError(t, err)
+	require.NotNil(t, all)
+	require.Empty(t, all.Objects)
+}
+
+func createFile(t *testing.T, store cloudstorage.Store, name, data string) cloudstorage.Object {
+
+	obj, err := store.NewObject(name)
+	require.NoError(t, err)
+	require.NotNil(t, obj)
+
+	// Opening is required for new objects.
+	f, err := obj.Open(cloudstorage.ReadWrite)
+	require.NoError(t, err)
+	require.NotNil(t, f)
+
+	w := bufio.NewWriter(f)
+	_, err = w.WriteString(data)
+	require.NoError(t, err)
+	err = w.Flush()
+	require.NoError(t, err)
+
+	// Close() actually does the upload/flush/write to cloud
+	err = obj.Close()
+	require.NoError(t, err)
+
+	obj2, err := store.Get(context.Background(), name)
+	require.NoError(t, err)
+
+	f2, err := obj2.Open(cloudstorage.ReadWrite)
+	require.NoError(t, err)
+
+	bytes, err := io.ReadAll(f2)
+	require.NoError(t, err)
+
+	require.Equal(t, data, string(bytes))
+
+	obj2.Close()
+
+	obj3, err := store.Get(context.Background(), name)
+	require.NoError(t, err)
+	return obj3
+}
+
+func (s *Suite) Move(t *testing.T) {
+	store := s.Store
+	deleteIfExists(store, "to/testmove.txt")
+	s.waitConsistent()
+	sleepGranule(store)
+
+	testdata := []string{
+		"",
+		"1_1234567890",
+		"2_12345678901234567890",
+		"3_1234567890",
+		"",
+	}
+
+	dest, err := store.NewObject("to/testmove.txt")
+	require.NoError(t, err, "dest file")
+
+	// We do this multiple times with variable length data because Move
+	// should overwrite the desc object on each call.
+	for row, data := range testdata {
+
+		// Read the object from store, delete if it exists
+		deleteIfExists(store, "from/testmove.txt")
+		s.waitConsistent()
+
+		// Create a new object and write to it.
+		obj := createFile(t, store, "from/testmove.txt", data)
+		require.NotNil(t, obj, "at row:%v", row)
+
+		err = cloudstorage.Move(context.Background(), store, obj, dest)
+		require.NoError(t, err, "at row:%v", row)
+
+		ensureContents(t, store, "to/testmove.txt", data, fmt.Sprintf("move `to` file validation: at row:%v", row))
+
+		_, err := store.Get(context.Background(), "from/testmove.txt")
+		require.Equal(t, cloudstorage.ErrObjectNotFound, err, "move `from` file validation: at row:%v", row)
+	}
+}
+
+func caller(calldepth int) string {
+	_, _, line, ok := runtime.Caller(calldepth)
+	if !ok {
+		line = 0
+	}
+	return fmt.Sprintf("caller-LN%v", line)
+}
+
+func ensureContents(t *testing.T, store cloudstorage.Store, name, data, msg string) {
+	caller := caller(2)
+
+	obj, err := store.Get(context.Background(), name)
+	require.Equalf(t, nil, err, msg, caller)
+	if err != nil {
+		return
+	}
+	require.Equalf(t, store.Type(), obj.StorageSource(), msg, caller)
+	require.Equalf(t, name, obj.Name(), msg, caller)
+
+	f, err := obj.Open(cloudstorage.ReadOnly)
+	defer func() {
+		err = obj.Close()
+		require.Equalf(t, nil, err, msg, caller)
+	}()
+	require.Equalf(t, nil, err, msg, caller)
+	require.Equalf(t, fmt.Sprintf("%p", f), fmt.Sprintf("%p", obj.File()), msg, caller)
+
+	bytes, err := io.ReadAll(f)
+	require.Equalf(t, nil, err, msg, caller)
+	require.Equalf(t, data, string(bytes), msg, caller)
+}
+
+func (s *Suite) Copy(t *testing.T) {
+	store := s.Store
+	caller := caller(2)
+
+	// Read the object from store, delete if it exists
+	deleteIfExists(store, "from/test.csv")
+	deleteIfExists(store, "to/testcopy.csv")
+	s.waitConsistent()
+
+	// Create a new object and write to it.
+	obj := createFile(t, store, "from/test.csv", testcsv)
+
+	dest, err := store.NewObject("to/testcopy.csv")
+	require.Equalf(t, nil, err, caller)
+
+	err = cloudstorage.Copy(context.Background(), store, obj, dest)
+	require.Equalf(t, nil, err, caller)
+
+	// After copy, old should exist
+	obj2, err := store.Get(context.Background(), "from/test.csv")
+	require.Equalf(t, nil, err, caller)
+	require.Equalf(t, "from/test.csv", obj2.Name(), caller)
+
+	// And also to should exist
+	ensureContents(t, store, "to/testcopy.csv", testcsv, "target file validation")
+}
+
+func (s *Suite) Append(t *testing.T) {
+	store := s.Store
+
+	deleteIfExists(store, "append.csv")
+	deleteIfExists(store, "append_native.csv")
+
+	now := time.Now()
+	sleepGranule(store)
+
+	// Create a new object and write to it.
+	obj, err := store.NewObject("append.csv")
+	require.NoError(t, err)
+
+	f1, err := obj.Open(cloudstorage.ReadWrite)
+	require.NoError(t, err)
+	require.NotNil(t, f1)
+
+	testcsv := "Year,Make,Model\n2003,VW,EuroVan\n2001,Ford,Ranger\n"
+
+	w1 := bufio.NewWriter(f1)
+	_, err = w1.WriteString(testcsv)
+	require.NoError(t, err)
+	w1.Flush()
+
+	err = obj.Close()
+	require.NoError(t, err)
+
+	// get the object and append to it...
+	morerows := "2013,VW,Jetta\n2011,Dodge,Caravan\n"
+	obj2, err := store.Get(context.Background(), "append.csv")
+	require.NoError(t, err)
+
+	// snapshot updated time pre-update
+	updated := obj2.Updated()
+	require.Equal(t, time.UTC, updated.Location())
+	require.True(t, cloudstorage.UpdatedAtLeast(store, obj2, now), "updated time was not set %v vs %v", now, updated)
+
+	time.Sleep(10 * time.Millisecond)
+
+	f2, err := obj2.Open(cloudstorage.ReadWrite)
+	require.NoError(t, err)
+	require.NotNil(t, f2)
+
+	// DANGER HERE BE DRAGONS.  This didn't used to be here
+	// so would our app have to implement this behavior?
+	_, err = f2.Seek(0, io.SeekEnd)
+	require.NoError(t, err)
+
+	w2 := bufio.NewWriter(f2)
+	ct, err := w2.WriteString(morerows)
+	w2.Flush()
+	//ct, err := f2.WriteString(morerows)
+	require.NoError(t, err)
+	require.Equal(t, len(morerows), ct)
+
+	sleepGranule(store)
+	//u.Infof("about to call close on the appended file f p = %p", f2)
+	f2.Sync()
+
+	err = obj2.Close()
+	require.NoError(t, err)
+
+	// Read the object back out of the cloud storage.
+	obj3, err := store.Get(context.Background(), "append.csv")
+	require.NoError(t, err)
+	updated3 := obj3.Updated()
+	require.True(t, cloudstorage.UpdatedAfter(store, obj3, updated), "updated wrong:  pre=%v post=%v", updated, updated3)
+	f3, err := obj3.Open(cloudstorage.ReadOnly)
+	require.NoError(t, err)
+
+	bytes, err := io.ReadAll(f3)
+	require.NoError(t, err)
+
+	require.Equal(t, testcsv+morerows, string(bytes), "not the rows we expected.")
+
+	err = obj3.Close()
+	require.NoError(t, err)
+
+	// Now we are going to essentially repeat tests but now use the native
+	// interface object.Read(), Write() instead of OPen() -> os.File()
+
+	// Create a new object and write to it.
+	obj, err = store.NewObject("append_native.csv")
+	require.NoError(t, err)
+
+	writeCt, err := obj.Write([]byte(testcsv))
+	require.NoError(t, err)
+	require.Equal(t, len(testcsv), writeCt)
+
+	err = obj.Close()
+	require.NoError(t, err)
+}
+
+func (s *Suite) ListObjsAndFolders(t *testing.T) {
+	store := s.Store
+
+	s.Clear(t)
+
+	createObjects := func(names []string) {
+		for _, n := range names {
+			obj, err := store.NewObject(n)
+			require.Equalf(t, nil, err, "failed trying to call new object on:%v of %v", n, names)
+			if obj == nil {
+				continue
+			}
+
+			f1, err := obj.Open(cloudstorage.ReadWrite)
+			require.NoError(t, err)
+			require.NotNil(t, f1)
+
+			testcsv := "12345\n"
+
+			w1 := bufio.NewWriter(f1)
+			_, err = w1.WriteString(testcsv)
+			require.NoError(t, err)
+			w1.Flush()
+
+			err = obj.Close()
+			require.NoError(t, err)
+		}
+	}
+
+	// Create 5 objects in each of 3 folders
+	// ie 15 objects
+	folders := []string{"a", "b", "c"}
+	names := []string{}
+	for _, folder := range folders {
+		for i := 0; i < 5; i++ {
+			n := fmt.Sprintf("list-test/%s/test%d.csv", folder, i)
+			names = append(names, n)
+		}
+	}
+
+	sort.Strings(names)
+
+	createObjects(names)
+
+	q := cloudstorage.NewQuery("list-test/")
+	q.PageSize = 500
+	q.Sorted()
+	iter, _ := store.Objects(context.Background(), q)
+	objs, err := cloudstorage.ObjectsAll(iter)
+	require.NoError(t, err)
+	require.Equal(t, 15, len(objs), "incorrect list len. wanted 15 got %d", len(objs))
+	iter.Close()
+
+	iter, _ = store.Objects(context.Background(), q)
+	objr, err := cloudstorage.ObjectResponseFromIter(iter)
+	require.NoError(t, err)
+	require.Equal(t, 15, len(objr.Objects), "incorrect list len. wanted 15 got %d", len(objr.Objects))
+
+	// Now we are going to re-run this test using store.List() instead of store.Objects()
+	q = cloudstorage.NewQuery("list-test/")
+	q.Sorted()
+	objResp, err := store.List(context.Background(), q)
+	require.NoError(t, err)
+	require.Equal(t, 15, len(objResp.Objects), "incorrect list len. wanted 15 got %d", len(objResp.Objects))
+
+	// Now we are going to re-run this test using an Object Iterator
+	// that uses store.List() instead of store.Objects()
+	q = cloudstorage.NewQuery("list-test/")
+	q.Sorted()
+	iter = cloudstorage.NewObjectPageIterator(context.Background(), store, q)
+	objs = make(cloudstorage.Objects, 0)
+	i := 0
+	for {
+		o, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		objs = append(objs, o)
+		//u.Debugf("iter i=%d  len names=%v", i, len(names))
+		//u.Infof("2 %d found %v expect %v", i, o.Name(), names[i])
+		require.Equal(t, names[i], o.Name(), "unexpected name.")
+		i++
+	}
+	require.Equal(t, 15, len(objs), "incorrect list len. wanted 15 got %d", len(objs))
+
+	q = cloudstorage.NewQuery("list-test/b")
+	q.Sorted()
+	iter, _ = store.Objects(context.Background(), q)
+	objs, err = cloudstorage.ObjectsAll(iter)
+	require.NoError(t, err)
+	require.Equal(t, 5, len(objs), "incorrect list len. wanted 5 got %d", len(objs))
+
+	for i, o := range objs {
+		require.Equal(t, names[i+5], o.Name(), "unexpected name.")
+	}
+
+	// test with iterator
+	iter, _ = store.Objects(context.Background(), q)
+	objs = make(cloudstorage.Objects, 0)
+	i = 0
+	for {
+		o, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		objs = append(objs, o)
+		//t.Logf("%d found %v", i, o.Name())
+		require.Equal(t, names[i+5], o.Name(), "unexpected name.")
+		i++
+	}
+
+	require.Equal(t, 5, len(objs), "incorrect list len.")
+
+	q = cloudstorage.NewQueryForFolders("list-test/")
+	folders, err = store.Folders(context.Background(), q)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(folders), "incorrect list len. wanted 3 folders. %v", folders)
+	sort.Strings(folders)
+	require.Equal(t, []string{"list-test/a/", "list-test/b/", "list-test/c/"}, folders)
+
+	foldersInput := []string{"a/a2", "b/b1", "b/b2"}
+	names = []string{}
+	for _, folder := range foldersInput {
+		for i := 0; i < 2; i++ {
+			n := fmt.Sprintf("list-test/%s/test%d.csv", folder, i)
+			names = append(names, n)
+		}
+	}
+
+	sort.Strings(names)
+
+	createObjects(names)
+
+	q = cloudstorage.NewQueryForFolders("list-test/")
+	q.PageSize = 500
+	folders, err = store.Folders(context.Background(), q)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(folders), "incorrect list len. wanted 3 folders. %v", folders)
+	require.Equal(t, []string{"list-test/a/", "list-test/b/", "list-test/c/"}, folders)
+
+	q = cloudstorage.NewQueryForFolders("list-test/b/")
+	folders, err = store.Folders(context.Background(), q)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(folders), "incorrect list len. wanted 2 folders. %v", folders)
+	require.Equal(t, []string{"list-test/b/b1/", "list-test/b/b2/"}, folders)
+
+	fiter, err := store.FolderIterator(context.Background(), q)
+	require.NoError(t, err)
+	folders = make([]string, 0)
+	for {
+		f, err := fiter.Next()
+		if err == iterator.Done {
+			break
+		}
+		require.NoError(t, err)
+		folders = append(folders, f)
+	}
+	fiter.Close()
+	require.Equal(t, []string{"list-test/b/b1/", "list-test/b/b2/"}, folders)
+
+	// A delimited List returns only this level's objects plus its sub-folders
+	q = cloudstorage.NewQueryForFolders("list-test/b/")
+	q.PageSize = 500
+	objResp, err = store.List(context.Background(), q)
+	require.NoError(t, err)
+	require.Equal(t, 5, len(objResp.Objects), "incorrect list len. wanted 5 got %d", len(objResp.Objects))
+	sort.Strings(objResp.Prefixes)
+	require.Equal(t, []string{"list-test/b/b1/", "list-test/b/b2/"}, objResp.Prefixes)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	folders, err = store.Folders(ctx, q)
+	require.Error(t, err)
+	require.Equal(t, 0, len(folders), "incorrect list len. wanted 0 folders. %v", folders)
+
+	// List objects from a missing folder
+	q = cloudstorage.NewQuery("does-not-exist/")
+	resp, err := store.List(context.Background(), q)
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	require.Empty(t, resp.Objects)
+	folders, err = store.Folders(context.Background(), q)
+	require.NoError(t, err)
+	require.Empty(t, folders)
+}
+
+// SortedListing makes sure a Sorted, filtered query lists the objects in
+// name order across pages, whether through List or the iterator.
+func (s *Suite) SortedListing(t *testing.T) {
+	store := s.Store
+	ctx := context.Background()
+	names := []string{"sorted/d.csv", "sorted/a.csv", "sorted/e.txt", "sorted/c.csv", "sorted/b.txt", "sorted/f.csv"}
+	for _, name := range names {
+		deleteIfExists(store, name)
+		require.NoError(t, MockFile(store, name, name))
+	}
+
+	q := cloudstorage.NewQuery("sorted/")
+	q.PageSize = 2
+	q.AddFilter(func(objs cloudstorage.Objects) cloudstorage.Objects {
+		var csvs cloudstorage.Objects
+		for _, o := range objs {
+			if strings.HasSuffix(o.Name(), ".csv") {
+				csvs = append(csvs, o)
+			}
+		}
+		return csvs
+	})
+	q.Sorted()
+	iter, err := store.Objects(ctx, q)
+	require.NoError(t, err)
+	objs, err := cloudstorage.ObjectsAll(iter)
+	require.NoError(t, err)
+	var got []string
+	for _, o := range objs {
+		got = append(got, o.Name())
+	}
+	require.Equal(t, []string{"sorted/a.csv", "sorted/c.csv", "sorted/d.csv", "sorted/f.csv"}, got)
+
+	for _, name := range names {
+		deleteIfExists(store, name)
+	}
+}
+
+func (s *Suite) ObjectFilters(t *testing.T) {
+	store := s.Store
+	ctx := context.Background()
+	files := map[string]string{
+		"objfilter/a.csv":     "Year,Make,Model\n2003,VW,EuroVan\n",
+		"objfilter/b.CSV":     "",
+		"objfilter/c.txt":     "Year,Make,Model\n2003,VW,EuroVan\n",
+		"objfilter/d.csv.bak": "Year,Make,Model\n",
+	}
+	for name, data := range files {
+		deleteIfExists(store, name)
+		require.NoError(t, MockFile(store, name, data))
+	}
+	list := func(q cloudstorage.Query) []string {
+		iter, err := store.Objects(ctx, q)
+		require.NoError(t, err)
+		objs, err := cloudstorage.ObjectsAll(iter)
+		require.NoError(t, err)
+		var got []string
+		for _, o := range objs {
+			got = append(got, o.Name())
+		}
+		sort.Strings(got)
+		return got
+	}
+
+	q := cloudstorage.NewQuery("objfilter/")
+	q.AddObjectFilter(cloudstorage.ExtensionFilter{".csv"})
+	require.Equal(t, []string{"objfilter/a.csv", "objfilter/b.CSV"}, list(q))
+
+	q = cloudstorage.NewQuery("objfilter/")
+	q.AddObjectFilter(cloudstorage.SuffixFilter(".bak"))
+	require.Equal(t, []string{"objfilter/d.csv.bak"}, list(q))
+
+	q = cloudstorage.NewQuery("objfilter/")
+	q.AddObjectFilter(cloudstorage.ExtensionFilter{".csv", ".txt"})
+	q.AddObjectFilter(cloudstorage.MinSizeFilter(1))
+	require.Equal(t, []string{"objfilter/a.csv", "objfilter/c.txt"}, list(q))
+
+	for name := range files {
+		deleteIfExists(store, name)
+	}
+}
+
+// ListOffsets checks the StartOffset and EndOffset of a Query bound the
+// listing, paging through it a few objects at a time.
+func (s *Suite) ListOffsets(t *testing.T) {
+	store := s.Store
+	ctx := context.Background()
+	names := []string{"offsets/a.csv", "offsets/b.csv", "offsets/b/c.csv", "offsets/c.csv", "offsets/d.csv"}
+	for _, name := range names {
+		deleteIfExists(store, name)
+		require.NoError(t, MockFile(store, name, name))
+	}
+	list := func(start, end string) []string {
+		q := cloudstorage.NewQuery("offsets/")
+		q.StartOffset = start
+		q.EndOffset = end
+		q.PageSize = 2
+		iter, err := store.Objects(ctx, q)
+		require.NoError(t, err)
+		objs, err := cloudstorage.ObjectsAll(iter)
+		require.NoError(t, err)
+		var got []string
+		for _, o := range objs {
+			got = append(got, o.Name())
+		}
+		sort.Strings(got)
+		return got
+	}
+
+	require.Equal(t, []string{"offsets/b.csv", "offsets/b/c.csv", "offsets/c.csv"}, list("offsets/b.csv", "offsets/d.csv"))
+	require.Equal(t, []string{"offsets/b/c.csv", "offsets/c.csv", "offsets/d.csv"}, list("offsets/b/", ""))
+	require.Equal(t, []string{"offsets/a.csv", "offsets/b.csv"}, list("", "offsets/b/"))
+	require.Empty(t, list("offsets/e", ""))
+
+	for _, name := range names {
+		deleteIfExists(store, name)
+	}
+}
+
+// ResumeListing checks an object iterator resumed from the cursor of
+// another goes on with the objects the first didn't return, across pages
+// and objects added meanwhile.
+func (s *Suite) ResumeListing(t *testing.T) {
+	store := s.Store
+	ctx := context.Background()
+	names := []string{"resume/a.csv", "resume/b.csv", "resume/c.csv", "resume/d.csv", "resume/e.csv"}
+	for _, name := range names {
+		deleteIfExists(store, name)
+		require.NoError(t, MockFile(store, name, name))
+	}
+	defer func() {
+		for _, name := range append(names, "resume/c2.csv") {
+			deleteIfExists(store, name)
+		}
+	}()
+
+	q := cloudstorage.NewQuery("resume/")
+	q.PageSize = 2
+	iterate := func(cursor string, n int) (cloudstorage.ResumableIterator, []string) {
+		iter, err := store.Objects(ctx, q)
+		require.NoError(t, err)
+		ri, ok := iter.(cloudstorage.ResumableIterator)
+		if !ok {
+			t.Skipf("%s object iterators can't be resumed", store.Type())
+		}
+		if cursor != "" {
+			require.NoError(t, ri.Resume(cursor))
+		}
+		var got []string
+		for n < 0 || len(got) < n {
+			o, err := ri.Next()
+			if err == iterator.Done {
+				break
+			}
+			require.NoError(t, err)
+			got = append(got, o.Name())
+		}
+		return ri, got
+	}
+
+	first, got := iterate("", 3)
+	require.Equal(t, names[:3], got)
+	cursor := first.Cursor()
+	first.Close()
+
+	// an object sorting before the cursor isn't listed by the resumed iterator
+	require.NoError(t, MockFile(store, "resume/c2.csv", "c2"))
+	s.waitConsistent()
+
+	resumed, got := iterate(cursor, -1)
+	require.Equal(t, []string{"resume/c2.csv", "resume/d.csv", "resume/e.csv"}, got)
+	cursor = resumed.Cursor()
+	resumed.Close()
+
+	_, got = iterate(cursor, -1)
+	require.Empty(t, got, "resuming a finished listing")
+
+	// resuming the page iterator of the store's List
+	iter := cloudstorage.NewObjectPageIterator(ctx, store, q)
+	defer iter.Close()
+	pi := iter.(cloudstorage.ResumableIterator)
+	require.NoError(t, pi.Resume(cursor))
+	_, err := pi.Next()
+	require.Equal(t, iterator.Done, err)
+	require.NoError(t, pi.Resume(cloudstorage.Cursor{After: "resume/d.csv"}.String()))
+	o, err := pi.Next()
+	require.NoError(t, err)
+	require.Equal(t, "resume/e.csv", o.Name())
+}
+
+func (s *Suite) Truncate(t *testing.T) {
+	store := s.Store
+
+	deleteIfExists(store, "test.csv")
+
+	// Create a new object and write to it.
+	obj, err := store.NewObject("test.csv")
+	require.NoError(t, err)
+
+	f1, err := obj.Open(cloudstorage.ReadWrite)
+	require.NoError(t, err)
+	require.NotNil(t, f1, "the file was nil")
+
+	testcsv := "Year,Make,Model\n2003,VW,EuroVan\n2001,Ford,Ranger\n"
+
+	w1 := bufio.NewWriter(f1)
+	n1, err := w1.WriteString(testcsv)
+	require.NoError(t, err, "error. %d", n1)
+	w1.Flush()
+
+	err = obj.Close()
+	require.NoError(t, err)
+
+	// get the object and replace it...
+	newtestcsv := "Year,Make,Model\n2013,VW,Jetta\n"
+	obj2, err := store.Get(context.Background(), "test.csv")
+	require.NoError(t, err)
+
+	f2, err := obj2.Open(cloudstorage.ReadWrite)
+	require.NoError(t, err)
+	require.NotNil(t, f2, "the file was nil")
+
+	// Truncating the file will zero out the file
+	f2.Truncate(0)
+	// We also want to start writing from the beginning of the file
+	f2.Seek(0, 0)
+
+	w2 := bufio.NewWriter(f2)
+	n2, err := w2.WriteString(newtestcsv)
+	require.NoError(t, err, "error. %d", n2)
+	w2.Flush()
+
+	err = obj2.Close()
+	require.NoError(t, err)
+
+	// Read the object back out of the cloud storage.
+	obj3, err := store.Get(context.Background(), "test.csv")
+	require.NoError(t, err)
+
+	f3, err := obj3.Open(cloudstorage.ReadOnly)
+	require.NoError(t, err)
+
+	bytes, err := io.ReadAll(f3)
+	require.NoError(t, err)
+
+	require.Equal(t, newtestcsv, string(bytes), "not the rows we expected.")
+}
+
+func (s *Suite) NewObjectWithExisting(t *testing.T) {
+	store := s.Store
+
+	deleteIfExists(store, "test.csv")
+
+	// Create a new object and write to it.
+	obj, err := store.NewObject("test.csv")
+	require.NoError(t, err)
+
+	f, err := obj.Open(cloudstorage.ReadWrite)
+	require.NoError(t, err)
+	require.NotNil(t, f, "the file was nil")
+
+	testcsv := "Year,Make,Model\n2003,VW,EuroVan\n2001,Ford,Ranger\n"
+
+	w := bufio.NewWriter(f)
+	n, err := w.WriteString(testcsv)
+	require.NoError(t, err, "error. %d", n)
+	err = w.Flush()
+	require.NoError(t, err)
+
+	err = obj.Close()
+	require.NoError(t, err)
+
+	// Ensure calling NewObject on an existing object returns an error,
+	// because the object exits.
+	obj2, err := store.NewObject("test.csv")
+	require.Equal(t, cloudstorage.ErrObjectExists, err, "error.")
+	require.Nil(t, obj2, "object should be nil.")
+
+	// Read the object back out of the cloud storage.
+	obj3, err := store.Get(context.Background(), "test.csv")
+	require.NoError(t, err)
+
+	f3, err := obj3.Open(cloudstorage.ReadOnly)
+	require.NoError(t, err)
+
+	bytes, err := io.ReadAll(f3)
+	require.NoError(t, err)
+
+	require.Equal(t, testcsv, string(bytes))
+
+	err = obj3.Close()
+	require.NoError(t, err)
+
+	// With Overwrite the existing object is returned, ready to write.
+	obj4, err := store.NewObject("test.csv", cloudstorage.Opts{Overwrite: true})
+	require.NoError(t, err)
+	require.Equal(t, "test.csv", obj4.Name())
+	f4, err := obj4.Open(cloudstorage.ReadWrite)
+	require.NoError(t, err)
+	bytes, err = io.ReadAll(f4)
+	require.NoError(t, err)
+	require.Equal(t, testcsv, string(bytes))
+	_, err = f4.WriteString("2013,Ford,Focus\n")
+	require.NoError(t, err)
+	require.NoError(t, obj4.Close())
+	require.Equal(t, testcsv+"2013,Ford,Focus\n", readAll(t, store, "test.csv"))
+
+	// and a new object as usual when there is none.
+	deleteIfExists(store, "test2.csv")
+	obj5, err := store.NewObject("test2.csv", cloudstorage.Opts{Overwrite: true})
+	require.NoError(t, err)
+	_, err = obj5.Open(cloudstorage.ReadWrite)
+	require.NoError(t, err)
+	require.NoError(t, obj5.Close())
+	deleteIfExists(store, "test2.csv")
+}
+
+func (s *Suite) ReadWriteCloser(t *testing.T) {
+	store := s.Store
+
+	deleteIfExists(store, "prefix/iorw.test")
+
+	testdata := []string{
+		"",
+		"1234567890",
+		"12345678901234567890",
+		"1234567890",
+		"",
+	}
+
+	// We do this multiple times with variable length data because NewWriter
+	// should truncate and overwrite the object on each call.
+	for i, padding := range testdata {
+		gou.Debugf("starting ReadWriteCloser (take:%v)", i)
+		fileName := "prefix/iorw.test"
+		data := fmt.Sprintf("pad:%v:pid:%v:time:%v:index:%v:", padding, os.Getpid(), time.Now().Nanosecond(), i)
+
+		wc, err := store.NewWriter(fileName, nil)
+		require.Equalf(t, nil, err, "at loop-cnt:%v", i)
+		buf1 := bytes.NewBufferString(data)
+		_, err = buf1.WriteTo(wc)
+		require.Equalf(t, nil, err, "at loop-cnt:%v", i)
+		err = wc.Close()
+		require.Equalf(t, nil, err, "at loop-cnt:%v", i)
+		time.Sleep(time.Millisecond * 100)
+
+		wc, err = store.NewWriterWithContext(context.Background(), fileName, nil, cloudstorage.Opts{IfNotExists: true})
+		if err == nil {
+			// stores with the IfNotExists capability may only fail on
+			// Close, the others refuse the option up front
+			_, err = bytes.NewBufferString(data).WriteTo(wc)
+			require.NoErrorf(t, err, "at loop-cnt:%v", i)
+			err = wc.Close()
+			time.Sleep(time.Millisecond * 100)
+		}
+		require.Error(t, err)
+
+		// Read the object from store, delete if it exists
+		deleteIfExists(store, "prefix/test.csv")
+
+		rc, err := store.NewReader(fileName)
+		require.Equalf(t, nil, err, "at loop-cnt:%v", i)
+		if rc == nil {
+			t.Fatalf("could not create reader")
+			return
+		}
+		buf2 := bytes.Buffer{}
+		_, err = buf2.ReadFrom(rc)
+		require.Equalf(t, nil, err, "at loop-cnt:%v", i)
+		require.Equalf(t, data, buf2.String(), "round trip data don't match: loop-cnt:%v", i) // extra data means we didn't truncate the file
+
+		// make sure we clean up and close
+		require.Nil(t, rc.Close())
+
+		_, err = store.NewReader("bogus/notreal.csv")
+		require.Equalf(t, cloudstorage.ErrObjectNotFound, err, "at loop-cnt:%v", i)
+	}
+}
+
+// WriterResult makes sure writers report the size and, if the store has
+// them, the etag of the object they created.
+func (s *Suite) WriterResult(t *testing.T) {
+	store := s.Store
+	ctx := context.Background()
+	name := "result/object.csv"
+	deleteIfExists(store, name)
+
+	wc, err := store.NewWriterWithContext(ctx, name, nil)
+	require.NoError(t, err)
+	rw, ok := wc.(cloudstorage.ResultWriter)
+	require.True(t, ok, "%T isn't a ResultWriter", wc)
+	_, err = io.WriteString(wc, testcsv)
+	require.NoError(t, err)
+	require.NoError(t, wc.Close())
+
+	res := rw.Result()
+	require.Equal(t, int64(len(testcsv)), res.Size)
+	obj, err := store.Get(ctx, name)
+	require.NoError(t, err)
+	if et, ok := obj.(cloudstorage.ObjectETagger); ok && res.ETag != "" {
+		require.Equal(t, cloudstorage.CleanETag(et.ETag()), res.ETag)
+	}
+	deleteIfExists(store, name)
+}
+
+func (s *Suite) MultipleRW(t *testing.T) {
+	store := s.Store
+	conf := s.Config
+	const TestFileName = "multi_rw/multi_rw_test.csv"
+
+	oldFiles, err := filepath.Glob(conf.TmpDir + "/multi_rw/*")
+	require.NoError(t, err)
+	for _, f := range oldFiles {
+		if f != "" && strings.Contains(f, TestFileName) {
+			gou.Warnf("should have been cleaned up for the: test-file:%v cachefile:%v allfiles:%v", TestFileName, f, oldFiles)
+		}
+	}
+
+	err = os.RemoveAll(conf.TmpDir + "/multi_rw/")
+	require.NoError(t, err)
+
+	// Read the object from store, delete if it exists
+	deleteIfExists(store, TestFileName)
+
+	testdata := []string{
+		"",
+		"1234567890",
+		"12345678901234567890",
+		"1234567890",
+		"",
+	}
+
+	// We do this multiple times with variable length data because NewWriter
+	// should truncate and overwrite the object on each call.
+	for i, padding := range testdata {
+		data := fmt.Sprintf("pad:%v:pid:%v:time:%v:index:%v:", padding, os.Getpid(), time.Now().Nanosecond(), i)
+
+		// Create a new object and write to it.
+		obj, err := store.NewObject(TestFileName)
+		if err == cloudstorage.ErrObjectExists {
+			obj, err = store.Get(context.Background(), TestFileName)
+		}
+		require.NoError(t, err)
+		require.NotNil(t, obj)
+
+		// Opening is required for new objects.
+		f, err := obj.Open(cloudstorage.ReadWrite)
+		require.NoError(t, err)
+		require.NotNil(t, f)
+
+		err = f.Truncate(0) //since we intend to replace the data, lets truncate the file.
+		require.NoError(t, err)
+
+		w := bufio.NewWriter(f)
+		_, err = w.WriteString(data)
+		require.NoError(t, err)
+		err = w.Flush()
+		require.NoError(t, err)
+
+		// Close() actually does the upload/flush/write to cloud
+		err = obj.Close()
+		require.NoError(t, err)
+
+		files, err := filepath.Glob(conf.TmpDir + "/multi_rw/*")
+		require.NoError(t, err)
+		for _, f := range files {
+			if f != "" && strings.Contains(f, TestFileName) {
+				t.Fatalf("tc:%v the cache files should have been cleaned up for the: test-file:%v cachefile:%v allfiles:%v", i, TestFileName, f, files)
+				return
+			}
+		}
+
+		// Read the object back out of the cloud store.
+		obj2, err := store.Get(context.Background(), TestFileName)
+		require.NoError(t, err)
+		require.Equal(t, store.Type(), obj2.StorageSource())
+		require.Equal(t, TestFileName, obj2.Name())
+		require.Equal(t, TestFileName, obj2.String())
+
+		f2, err := obj2.Open(cloudstorage.ReadOnly)
+
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("%p", f2), fmt.Sprintf("%p", obj2.File()))
+		bytes, err := io.ReadAll(f2)
+		require.NoError(t, err)
+		require.Nil(t, f2.Close())
+
+		require.Equal(t, data, string(bytes))
+
+		err = obj2.Close()
+		require.NoError(t, err)
+	}
+}
+
+// ConditionalRead checks readers return ErrNotModified for an unchanged
+// ETag, stores without ETags are skipped.
+func (s *Suite) ConditionalRead(t *testing.T) {
+	if !s.capabilities().ETags {
+		t.Skip("store has no etags")
+	}
+	store := s.Store
+	const name = "conditional/etag.csv"
+	ctx := context.Background()
+	deleteIfExists(store, name)
+
+	require.NoError(t, MockFile(store, name, "v1"))
+	obj, err := store.Get(ctx, name)
+	require.NoError(t, err)
+	tagger, ok := obj.(cloudstorage.ObjectETagger)
+	require.True(t, ok, "%T isn't an ObjectETagger", obj)
+	etag := tagger.ETag()
+	require.NotEmpty(t, etag)
+
+	_, err = cloudstorage.NewReaderWithOpts(ctx, store, name, cloudstorage.Opts{IfNoneMatch: etag})
+	require.Equal(t, cloudstorage.ErrNotModified, err)
+
+	require.NoError(t, cloudstorage.WriteAll(ctx, store, name, []byte("version 2"), nil))
+	rc, err := cloudstorage.NewReaderWithOpts(ctx, store, name, cloudstorage.Opts{IfNoneMatch: etag})
+	require.NoError(t, err)
+	by, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	require.Equal(t, "version 2", string(by))
+
+	deleteIfExists(store, name)
+}
+
+// Attributes checks the typed attributes of an object agree with the
+// object, and that the custom metadata is only what was written.
+func (s *Suite) Attributes(t *testing.T) {
+	store := s.Store
+	const name = "attributes/data.csv"
+	ctx := context.Background()
+	deleteIfExists(store, name)
+
+	md := map[string]string{cloudstorage.ContentTypeKey: "text/csv", "owner": "etl"}
+	require.NoError(t, cloudstorage.WriteAll(ctx, store, name, []byte("a,b\n1,2\n"), md))
+	s.waitConsistent()
+	obj, err := store.Get(ctx, name)
+	require.NoError(t, err)
+
+	a := cloudstorage.AttrsOf(obj)
+	if sizer, ok := obj.(cloudstorage.ObjectSizer); ok {
+		require.Equal(t, sizer.Size(), a.Size)
+	}
+	if tagger, ok := obj.(cloudstorage.ObjectETagger); ok {
+		require.Equal(t, cloudstorage.CleanETag(tagger.ETag()), a.ETag)
+	}
+	require.True(t, a.Updated.Equal(obj.Updated()))
+	// stores without metadata guess it from the name
+	require.True(t, strings.HasPrefix(a.ContentType, "text/csv"), a.ContentType)
+	for _, k := range []string{"content_length", "content_encoding", "attrs_content_type", "attrs_cache_control"} {
+		require.NotContains(t, a.CustomMetadata, k)
+	}
+	if v, ok := a.CustomMetadata["owner"]; ok {
+		require.Equal(t, "etl", v)
+	}
+
+	deleteIfExists(store, name)
+}
+
+// Size checks the objects of Get and listings know their size, stored
+// compressed it is the compressed size.
+func (s *Suite) Size(t *testing.T) {
+	store := s.Store
+	const name = "size/data.csv"
+	ctx := context.Background()
+	deleteIfExists(store, name)
+
+	data := []byte("a,b\n1,2\n")
+	require.NoError(t, cloudstorage.WriteAll(ctx, store, name, data, nil))
+	s.waitConsistent()
+	check := func(obj cloudstorage.Object) {
+		size, ok := cloudstorage.SizeOf(obj)
+		require.True(t, ok, "object without size")
+		if !cloudstorage.IsCompressed(cloudstorage.AttrsOf(obj).ContentEncoding) {
+			require.Equal(t, int64(len(data)), size)
+		}
+	}
+	obj, err := store.Get(ctx, name)
+	require.NoError(t, err)
+	check(obj)
+
+	resp, err := store.List(ctx, cloudstorage.NewQuery("size/"))
+	require.NoError(t, err)
+	require.Len(t, resp.Objects, 1)
+	check(resp.Objects[0])
+
+	deleteIfExists(store, name)
+}
+
+// Metadata checks the metadata an object was written with is returned by
+// Get, and by listings of stores that include it, for stores keeping
+// metadata.
+func (s *Suite) Metadata(t *testing.T) {
+	store := s.Store
+	const name = "metadata/data.csv"
+	ctx := context.Background()
+	deleteIfExists(store, name)
+
+	md := map[string]string{cloudstorage.ContentTypeKey: "text/csv", "owner": "etl"}
+	require.NoError(t, cloudstorage.WriteAll(ctx, store, name, []byte("a,b\n1,2\n"), md))
+	s.waitConsistent()
+	obj, err := store.Get(ctx, name)
+	require.NoError(t, err)
+	if obj.MetaData() == nil {
+		deleteIfExists(store, name)
+		t.Skip("store keeps no metadata")
+	}
+	require.Equal(t, "etl", obj.MetaData()["owner"])
+	require.True(t, strings.HasPrefix(obj.MetaData()[cloudstorage.ContentTypeKey], "text/csv"))
+
+	resp, err := store.List(ctx, cloudstorage.NewQuery("metadata/"))
+	require.NoError(t, err)
+	require.Len(t, resp.Objects, 1)
+	// s3 listings have no metadata
+	if v, ok := resp.Objects[0].MetaData()["owner"]; ok {
+		require.Equal(t, "etl", v)
+	}
+
+	deleteIfExists(store, name)
+}
+
+// WriteThrough writes an object without a cached copy, through the file
+// Open returns and the object.
+func (s *Suite) WriteThrough(t *testing.T) {
+	store := s.Store
+	const name = "writethrough/data.csv"
+	deleteIfExists(store, name)
+
+	obj, err := store.NewObject(name, cloudstorage.Opts{WriteThrough: true})
+	require.NoError(t, err)
+	f, err := obj.Open(cloudstorage.ReadWrite)
+	require.NoError(t, err)
+	_, err = f.WriteString("Year,Make,Model\n")
+	require.NoError(t, err)
+	_, err = obj.Write([]byte("2003,VW,EuroVan\n"))
+	require.NoError(t, err)
+	require.NoError(t, obj.Close())
+	s.waitConsistent()
+	require.Equal(t, "Year,Make,Model\n2003,VW,EuroVan\n", readAll(t, store, name))
+
+	deleteIfExists(store, name)
+}
+
+// ConcurrentWriters writes, reads and lists distinct objects from many
+// goroutines sharing the store, for stores claiming to be Concurrent.  Run
+// with -race it catches unguarded state of the store.
+func (s *Suite) ConcurrentWriters(t *testing.T) {
+	if !s.capabilities().Concurrent {
+		t.Skip("store isn't safe for concurrent use")
+	}
+	store := s.Store
+	ctx := context.Background()
+	const workers = 8
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- func() error {
+				// each in new folders, for the stores creating them
+				name := fmt.Sprintf("concurrent/%d/sub/data.csv", i)
+				data := fmt.Sprintf("worker,%d\n", i)
+				if err := cloudstorage.WriteAll(ctx, store, name, []byte(data), nil); err != nil {
+					return err
+				}
+				obj, err := store.NewObject(fmt.Sprintf("concurrent/%d/obj.csv", i))
+				if err != nil {
+					return err
+				}
+				f, err := obj.Open(cloudstorage.ReadWrite)
+				if err != nil {
+					return err
+				}
+				if _, err := f.WriteString(data); err != nil {
+					return err
+				}
+				if err := obj.Close(); err != nil {
+					return err
+				}
+				got, err := cloudstorage.ReadAll(ctx, store, name)
+				if err != nil {
+					return err
+				}
+				if string(got) != data {
+					return fmt.Errorf("%s has %q, want %q", name, got, data)
+				}
+				_, err = store.List(ctx, cloudstorage.NewQuery(fmt.Sprintf("concurrent/%d/", i)))
+				return err
+			}()
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	s.waitConsistent()
+
+	for i := 0; i < workers; i++ {
+		deleteIfExists(store, fmt.Sprintf("concurrent/%d/sub/data.csv", i))
+		deleteIfExists(store, fmt.Sprintf("concurrent/%d/obj.csv", i))
+	}
+}
+
+// ReaderAt reads an object at random offsets, with range reads if the store
+// has them.
+func (s *Suite) ReaderAt(t *testing.T) {
+	store := s.Store
+	const name = "readerat/data.csv"
+	ctx := context.Background()
+	deleteIfExists(store, name)
+
+	data := strings.Repeat("0123456789", 100)
+	require.NoError(t, MockFile(store, name, data))
+	s.waitConsistent()
+
+	if rr, ok := store.(cloudstorage.StoreRangeReader); ok {
+		// compressed objects can't be read in ranges
+		rc, err := rr.NewRangeReader(ctx, name, 995, 3)
+		if !errors.Is(err, cloudstorage.ErrNotImplemented) {
+			require.NoError(t, err)
+			by, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			require.NoError(t, rc.Close())
+			require.Equal(t, data[995:998], string(by))
+		}
+	}
+
+	r, err := cloudstorage.NewReaderAt(ctx, store, name, cloudstorage.ReaderAtOpts{BlockSize: 64, TmpDir: s.Config.TmpDir})
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), r.Size())
+	p := make([]byte, 100)
+	for _, off := range []int64{900, 0, 450, 63} {
+		n, err := r.ReadAt(p, off)
+		require.NoError(t, err)
+		require.Equal(t, data[off:off+int64(n)], string(p[:n]))
+	}
+	n, err := r.ReadAt(p, 950)
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, data[950:], string(p[:n]))
+	require.NoError(t, r.Close())
+
+	deleteIfExists(store, name)
+}
+
+// Put replaces an object with shorter content and makes sure a failed Put
+// leaves the previous content in place.
+func (s *Suite) Put(t *testing.T) {
+	store := s.Store
+	const name = "put/test.csv"
+	ctx := context.Background()
+	deleteIfExists(store, name)
+
+	md := map[string]string{cloudstorage.ContentTypeKey: "text/csv"}
+	testcsv := "Year,Make,Model\n2003,VW,EuroVan\n2001,Ford,Ranger\n"
+	require.NoError(t, cloudstorage.Put(ctx, store, name, strings.NewReader(testcsv), md))
+	require.Equal(t, testcsv, readAll(t, store, name))
+
+	newtestcsv := "Year,Make,Model\n2013,VW,Jetta\n"
+	require.NoError(t, cloudstorage.Put(ctx, store, name, strings.NewReader(newtestcsv), md))
+	require.Equal(t, newtestcsv, readAll(t, store, name))
+
+	errRead := fmt.Errorf("read failed")
+	r := io.MultiReader(strings.NewReader("partial"), &errReader{errRead})
+	require.Equal(t, errRead, cloudstorage.Put(ctx, store, name, r, md))
+	require.Equal(t, newtestcsv, readAll(t, store, name))
+
+	resp, err := store.List(ctx, cloudstorage.NewQuery("put/"))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(resp.Objects))
+
+	deleteIfExists(store, name)
+}
+
+// Compose concatenates parts into a new object then appends to it.
+func (s *Suite) Compose(t *testing.T) {
+	store := s.Store
+	ctx := context.Background()
+	parts := []string{"compose/part-00000.csv", "compose/part-00001.csv", "compose/part-00002.csv"}
+	for i, name := range parts {
+		deleteIfExists(store, name)
+		require.NoError(t, cloudstorage.WriteAll(ctx, store, name, []byte(fmt.Sprintf("%d,row\n", i)), nil))
+	}
+	deleteIfExists(store, "compose/all.csv")
+
+	require.NoError(t, cloudstorage.Compose(ctx, store, "compose/all.csv", parts))
+	require.Equal(t, "0,row\n1,row\n2,row\n", readAll(t, store, "compose/all.csv"))
+
+	require.NoError(t, cloudstorage.Compose(ctx, store, "compose/all.csv", []string{"compose/all.csv", parts[0]}))
+	require.Equal(t, "0,row\n1,row\n2,row\n0,row\n", readAll(t, store, "compose/all.csv"))
+
+	err := cloudstorage.Compose(ctx, store, "compose/missing.csv", []string{parts[0], "compose/nope.csv"})
+	require.Equal(t, cloudstorage.ErrObjectNotFound, err)
+
+	for _, name := range append(parts, "compose/all.csv") {
+		deleteIfExists(store, name)
+	}
+}
+
+// Compression makes sure objects read back as written however they were
+// written, and with conf.EnableCompression, for stores with the Compression
+// capability, that their Attrs have their codec as ContentEncoding unless
+// written with Opts.DisableCompression.
+func (s *Suite) Compression(t *testing.T) {
+	store := s.Store
+	conf := s.Config
+	compressed := conf.EnableCompression && s.capabilities().Compression
+	ctx := context.Background()
+	data := strings.Repeat("Year,Make,Model\n1997,Ford,E350\n", 100)
+	codec := conf.CompressionCodec
+	if codec == "" {
+		codec = cloudstorage.CodecGzip
+	}
+	encoding := func(name string) string {
+		obj, err := store.Get(ctx, name)
+		require.NoError(t, err)
+		return cloudstorage.AttrsOf(obj).ContentEncoding
+	}
+
+	name := "compression/writer.csv"
+	deleteIfExists(store, name)
+	wc, err := store.NewWriterWithContext(ctx, name, nil)
+	require.NoError(t, err)
+	_, err = wc.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, wc.Close())
+	require.Equal(t, data, readAll(t, store, name))
+	if compressed {
+		require.Equal(t, codec, encoding(name))
+	}
+
+	// overwrite it uncompressed, the old encoding mustn't stick
+	wc, err = store.NewWriterWithContext(ctx, name, nil, cloudstorage.Opts{DisableCompression: true})
+	require.NoError(t, err)
+	_, err = wc.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, wc.Close())
+	require.Equal(t, data, readAll(t, store, name))
+	require.Equal(t, "", encoding(name))
+	deleteIfExists(store, name)
+
+	name = "compression/object.csv"
+	deleteIfExists(store, name)
+	createFile(t, store, name, data)
+	require.Equal(t, data, readAll(t, store, name))
+	if compressed {
+		require.Equal(t, codec, encoding(name))
+	}
+	obj, err := store.Get(ctx, name)
+	require.NoError(t, err)
+	f, err := obj.Open(cloudstorage.ReadOnly)
+	require.NoError(t, err)
+	by, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.Equal(t, data, string(by))
+	require.NoError(t, obj.Close())
+	deleteIfExists(store, name)
+}
+
+type errReader struct{ err error }
+
+func (r *errReader) Read([]byte) (int, error) { return 0, r.err }
+
+func readAll(t *testing.T, store cloudstorage.Store, name string) string {
+	rc, err := store.NewReaderWithContext(context.Background(), name)
+	require.NoError(t, err)
+	defer rc.Close()
+	by, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	return string(by)
+}
+
+// ConditionalDelete makes sure a Delete with a stale Opts.IfMatch leaves
+// an overwritten object alone, stores without etags ignore the option.
+func (s *Suite) ConditionalDelete(t *testing.T) {
+	store := s.Store
+	const name = "conditional/delete.csv"
+	ctx := context.Background()
+	deleteIfExists(store, name)
+
+	require.NoError(t, MockFile(store, name, "v1"))
+	if !s.capabilities().ETags {
+		require.NoError(t, store.Delete(ctx, name, cloudstorage.Opts{IfMatch: "stale"}))
+		return
+	}
+	obj, err := store.Get(ctx, name)
+	require.NoError(t, err)
+	tagger, ok := obj.(cloudstorage.ObjectETagger)
+	require.True(t, ok, "%T isn't an ObjectETagger", obj)
+	stale := tagger.ETag()
+
+	require.NoError(t, cloudstorage.WriteAll(ctx, store, name, []byte("version 2"), nil))
+	err = store.Delete(ctx, name, cloudstorage.Opts{IfMatch: stale})
+	require.Equal(t, cloudstorage.ErrPreconditionFailed, err)
+
+	obj, err = store.Get(ctx, name)
+	require.NoError(t, err)
+	require.NoError(t, store.Delete(ctx, name, cloudstorage.Opts{IfMatch: obj.(cloudstorage.ObjectETagger).ETag()}))
+	_, err = store.Get(ctx, name)
+	require.Equal(t, cloudstorage.ErrObjectNotFound, err)
+}
+
+// EmptyObjects creates zero byte objects through an object handle and a
+// writer, then lists, reads and copies them.
+func (s *Suite) EmptyObjects(t *testing.T) {
+	store := s.Store
+	ctx := context.Background()
+	names := []string{"empty/object.csv", "empty/writer.csv", "empty/copy.csv"}
+	for _, name := range names {
+		deleteIfExists(store, name)
+	}
+
+	obj, err := store.NewObject(names[0])
+	require.NoError(t, err)
+	_, err = obj.Open(cloudstorage.ReadWrite)
+	require.NoError(t, err)
+	require.NoError(t, obj.Close())
+
+	w, err := store.NewWriterWithContext(ctx, names[1], nil)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	for _, name := range names[:2] {
+		obj, err := store.Get(ctx, name)
+		require.NoError(t, err, name)
+		if sizer, ok := obj.(cloudstorage.ObjectSizer); ok {
+			require.Equal(t, int64(0), sizer.Size(), name)
+		}
+		f, err := obj.Open(cloudstorage.ReadOnly)
+		require.NoError(t, err, name)
+		by, err := io.ReadAll(f)
+		require.NoError(t, err, name)
+		require.Empty(t, by, name)
+		require.NoError(t, obj.Close())
+
+		require.Equal(t, "", readAll(t, store, name))
+	}
+
+	src, err := store.Get(ctx, names[0])
+	require.NoError(t, err)
+	dst, err := store.NewObject(names[2])
+	require.NoError(t, err)
+	require.NoError(t, cloudstorage.Copy(ctx, store, src, dst))
+	require.Equal(t, "", readAll(t, store, names[2]))
+
+	resp, err := store.List(ctx, cloudstorage.NewQuery("empty/"))
+	require.NoError(t, err)
+	var listed []string
+	for _, o := range resp.Objects {
+		listed = append(listed, o.Name())
+	}
+	sort.Strings(listed)
+	require.Equal(t, []string{"empty/copy.csv", "empty/object.csv", "empty/writer.csv"}, listed)
+
+	for _, name := range names {
+		deleteIfExists(store, name)
+	}
+}
+
+// sleepGranule waits until the store's Updated times have moved on to the
+// next granule.
+func sleepGranule(store cloudstorage.Store) {
+	g := cloudstorage.UpdatedGranularity(store)
+	if g < 10*time.Millisecond {
+		g = 10 * time.Millisecond
+	}
+	time.Sleep(g + g/10)
+}
+
+func MockFile(store cloudstorage.Store, path string, body string) error {
+	obj, err := store.NewObject(path)
+	if err != nil {
+		return err
+	}
+	f, err := obj.Open(cloudstorage.ReadWrite)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+
+	if _, err := w.WriteString(body); err != nil {
+		return err
+	}
+	w.Flush()
+	obj.Close()
+	return nil
+}
@@ -0,0 +1,142 @@
+// Package conformance is a test suite checking a cloudstorage.Store behaves
+// like the stores of this module, so store implementations outside of it
+// can validate themselves:
+//
+//	func TestConformance(t *testing.T) {
+//		store, err := cloudstorage.NewStore(config)
+//		require.NoError(t, err)
+//		conformance.Run(t, store, config)
+//	}
+//
+// The cases needing more than the Store interface are skipped, or relaxed,
+// according to the store's cloudstorage.Capabilities.  The suite deletes
+// every object of the store, run it against an empty bucket or folder.
+package conformance
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/stretchr/testify/require"
+)
+
+// Suite of conformance tests of a Store.
+type Suite struct {
+	// Store tested.
+	Store cloudstorage.Store
+	// Config the Store was created with.
+	Config *cloudstorage.Config
+	// Capabilities of the Store, cloudstorage.CapabilitiesOf(Store) if
+	// zero.
+	Capabilities cloudstorage.Capabilities
+	// WaitConsistent is called after objects are deleted, before the store
+	// is expected to reflect it.  By default it sleeps the ConsistencyDelay
+	// of the Capabilities.
+	WaitConsistent func()
+}
+
+// Run the conformance Suite of store created with conf.
+func Run(t *testing.T, store cloudstorage.Store, conf *cloudstorage.Config) {
+	s := &Suite{Store: store, Config: conf}
+	s.Run(t)
+}
+
+type testCase struct {
+	name string
+	test func(t *testing.T)
+}
+
+// Run every case of the suite as a subtest, in parallel when they don't
+// share objects and the store is Concurrent.
+func (s *Suite) Run(t *testing.T) {
+	// Ensure testing dirs are clean.
+	s.Clear(t)
+	defer s.Clear(t)
+
+	// these cases share objects or expect an empty store
+	serial := []testCase{
+		{"StoreSetup", s.StoreSetup},
+		{"BasicRW", s.BasicRW},
+		{"Move", s.Move},
+		{"Copy", s.Copy},
+		{"Append", s.Append},
+		{"ListObjsAndFolders", s.ListObjsAndFolders},
+		{"Truncate", s.Truncate},
+		{"NewObjectWithExisting", s.NewObjectWithExisting},
+		{"ReadWriteCloser", s.ReadWriteCloser},
+		{"MultipleRW", s.MultipleRW},
+	}
+	for _, tc := range serial {
+		t.Run(tc.name, tc.test)
+	}
+
+	// these each keep to their own folder
+	parallel := []testCase{
+		{"SortedListing", s.SortedListing},
+		{"ObjectFilters", s.ObjectFilters},
+		{"ListOffsets", s.ListOffsets},
+		{"ResumeListing", s.ResumeListing},
+		{"WriterResult", s.WriterResult},
+		{"ConditionalRead", s.ConditionalRead},
+		{"ReaderAt", s.ReaderAt},
+		{"Attributes", s.Attributes},
+		{"Metadata", s.Metadata},
+		{"Size", s.Size},
+		{"ConditionalDelete", s.ConditionalDelete},
+		{"Put", s.Put},
+		{"WriteThrough", s.WriteThrough},
+		{"ConcurrentWriters", s.ConcurrentWriters},
+		{"Compose", s.Compose},
+		{"EmptyObjects", s.EmptyObjects},
+		{"Compression", s.Compression},
+	}
+	concurrent := s.capabilities().Concurrent
+	t.Run("Folders", func(t *testing.T) {
+		for _, tc := range parallel {
+			tc := tc
+			t.Run(tc.name, func(t *testing.T) {
+				if concurrent {
+					t.Parallel()
+				}
+				tc.test(t)
+			})
+		}
+	})
+}
+
+// Clear deletes every object of the store.
+func (s *Suite) Clear(t *testing.T) {
+	q := cloudstorage.NewQueryAll()
+	q.Sorted()
+	ctx := context.Background()
+	iter, err := s.Store.Objects(ctx, q)
+	require.NoError(t, err)
+	objs, err := cloudstorage.ObjectsAll(iter)
+	if err != nil {
+		t.Fatalf("Could not list store %v", err)
+	}
+	for _, o := range objs {
+		err = s.Store.Delete(ctx, o.Name())
+		require.NoError(t, err)
+	}
+	s.waitConsistent()
+}
+
+func (s *Suite) capabilities() cloudstorage.Capabilities {
+	if s.Capabilities == (cloudstorage.Capabilities{}) {
+		return cloudstorage.CapabilitiesOf(s.Store)
+	}
+	return s.Capabilities
+}
+
+func (s *Suite) waitConsistent() {
+	if s.WaitConsistent != nil {
+		s.WaitConsistent()
+		return
+	}
+	if d := s.capabilities().ConsistencyDelay; d > 0 {
+		time.Sleep(d)
+	}
+}
@@ -0,0 +1,200 @@
+package cloudstorage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// MetaSidecarExt is the extension of the metadata files written next to
+// downloaded files by DownloadPrefix when DownloadOpts.MetaSidecar is set.
+const MetaSidecarExt = ".meta.json"
+
+// ValidatorSidecarExt is the extension of the files OpenIfChanged keeps the
+// ETag, Updated time and size of the object next to its local copy in.
+const ValidatorSidecarExt = ".validator.json"
+
+// DownloadOpts optional settings for DownloadPrefix.
+type DownloadOpts struct {
+	// Concurrency is the number of objects downloaded at once, 0 or 1
+	// downloads serially.
+	Concurrency int
+	// PreserveModTime sets the modification time of each local file to the
+	// object's Updated time.
+	PreserveModTime bool
+	// MetaSidecar writes each object's MetaData as json to a file named
+	// <file>.meta.json next to the downloaded file.
+	MetaSidecar bool
+	// Resume skips objects whose local copy already matches, so an
+	// interrupted mirror can be re-run.  A local file matches when its size
+	// equals the object's (for stores implementing ObjectSizer) and, with
+	// PreserveModTime, its modification time equals the object's Updated.
+	Resume bool
+}
+
+// DownloadPrefix mirrors every object below prefix into localDir, the
+// object name with prefix trimmed is the path relative to localDir.  Files
+// are written to a temp file and renamed when complete so a partial file is
+// never mistaken for a finished one.
+func DownloadPrefix(ctx context.Context, store StoreReader, prefix, localDir string, opts ...DownloadOpts) error {
+	var o DownloadOpts
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	localDir, err := filepath.Abs(localDir)
+	if err != nil {
+		return err
+	}
+
+	return Walk(ctx, store, prefix, func(obj Object) error {
+		name := obj.Name()
+		if strings.HasSuffix(name, "/") {
+			// folder marker objects
+			return nil
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(name, prefix), "/")
+		fpath := filepath.Join(localDir, filepath.FromSlash(rel))
+		if !strings.HasPrefix(fpath, localDir+string(filepath.Separator)) {
+			return fmt.Errorf("object %q resolves outside of %s", name, localDir)
+		}
+		if o.Resume && downloaded(obj, fpath, o.PreserveModTime) {
+			return nil
+		}
+		return downloadObject(ctx, store, obj, fpath, o)
+	}, WalkOpts{Concurrency: o.Concurrency})
+}
+
+// downloaded reports whether fpath already holds a complete copy of obj.
+func downloaded(obj Object, fpath string, checkModTime bool) bool {
+	fi, err := os.Stat(fpath)
+	if err != nil {
+		return false
+	}
+	size, ok := SizeOf(obj)
+	if !ok && !checkModTime {
+		// nothing to compare against
+		return false
+	}
+	if ok && size != fi.Size() {
+		return false
+	}
+	if checkModTime && !fi.ModTime().Equal(obj.Updated()) {
+		return false
+	}
+	return true
+}
+
+// validator of an object version, the ETag or else its Updated time and
+// size.
+type validator struct {
+	ETag    string    `json:"etag,omitempty"`
+	Updated time.Time `json:"updated"`
+	Size    int64     `json:"size"`
+}
+
+func validatorOf(obj Object) validator {
+	v := validator{Updated: obj.Updated().UTC(), Size: -1}
+	if et, ok := obj.(ObjectETagger); ok {
+		v.ETag = CleanETag(et.ETag())
+	}
+	if size, ok := SizeOf(obj); ok {
+		v.Size = size
+	}
+	return v
+}
+
+func (v validator) matches(o validator) bool {
+	if v.ETag != "" || o.ETag != "" {
+		return v.ETag == o.ETag
+	}
+	return !v.Updated.IsZero() && v.Updated.Equal(o.Updated) && v.Size == o.Size
+}
+
+// OpenIfChanged opens the local copy of object name at fpath, downloading
+// it first unless the copy is of the object's current version, for jobs
+// re-reading the same objects.  changed is true when it was downloaded.
+//
+// The version is checked with a Get, by the ETag or else the Updated time
+// and size, against the one recorded in fpath+ValidatorSidecarExt by the
+// previous download.  An object changing while it is downloaded is
+// downloaded again by the next call.
+func OpenIfChanged(ctx context.Context, store StoreReader, name, fpath string) (f *os.File, changed bool, err error) {
+	obj, err := store.Get(ctx, name)
+	if err != nil {
+		return nil, false, err
+	}
+	current := validatorOf(obj)
+	if by, err := os.ReadFile(fpath + ValidatorSidecarExt); err == nil {
+		var cached validator
+		if json.Unmarshal(by, &cached) == nil && cached.matches(current) {
+			if f, err := os.Open(fpath); err == nil {
+				return f, false, nil
+			}
+		}
+	}
+
+	// a failed download must not leave the sidecar of the previous one
+	os.Remove(fpath + ValidatorSidecarExt)
+	if err := downloadObject(ctx, store, obj, fpath, DownloadOpts{}); err != nil {
+		return nil, false, err
+	}
+	by, err := json.Marshal(current)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := os.WriteFile(fpath+ValidatorSidecarExt, by, 0664); err != nil {
+		return nil, false, err
+	}
+	f, err = os.Open(fpath)
+	return f, true, err
+}
+
+func downloadObject(ctx context.Context, store StoreReader, obj Object, fpath string, o DownloadOpts) error {
+	if err := os.MkdirAll(filepath.Dir(fpath), 0775); err != nil {
+		return err
+	}
+	rc, err := store.NewReaderWithContext(ctx, obj.Name())
+	if err != nil {
+		return fmt.Errorf("could not read %q: %w", obj.Name(), err)
+	}
+	defer rc.Close()
+
+	f, err := os.CreateTemp(filepath.Dir(fpath), "."+filepath.Base(fpath)+".*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = io.Copy(f, rc)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("could not download %q: %w", obj.Name(), err)
+	}
+
+	if o.PreserveModTime && !obj.Updated().IsZero() {
+		if err := os.Chtimes(tmp, obj.Updated(), obj.Updated()); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if o.MetaSidecar {
+		by, err := json.Marshal(obj.MetaData())
+		if err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		if err := os.WriteFile(fpath+MetaSidecarExt, by, 0664); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	return os.Rename(tmp, fpath)
+}
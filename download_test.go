@@ -0,0 +1,109 @@
+package cloudstorage_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/localfs"
+	"github.com/lytics/cloudstorage/mockstore"
+	"github.com/lytics/cloudstorage/testutils"
+)
+
+func TestDownloadPrefix(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "mockcloud"),
+		TmpDir:     filepath.Join(tmpDir, "localcache"),
+		Bucket:     "download",
+	})
+	require.NoError(t, err)
+
+	files := map[string]string{"snap/a.csv": "a,b", "snap/b/1.csv": "1,2,3", "snap/b/c/2.csv": "22", "other/3.csv": "3"}
+	for n, data := range files {
+		require.NoError(t, testutils.MockFile(store, n, data))
+	}
+
+	ctx := context.Background()
+	dest := filepath.Join(tmpDir, "mirror")
+	err = cloudstorage.DownloadPrefix(ctx, store, "snap/", dest, cloudstorage.DownloadOpts{
+		Concurrency:     2,
+		PreserveModTime: true,
+		MetaSidecar:     true,
+	})
+	require.NoError(t, err)
+
+	for _, n := range []string{"a.csv", "b/1.csv", "b/c/2.csv"} {
+		by, err := os.ReadFile(filepath.Join(dest, n))
+		require.NoError(t, err)
+		require.Equal(t, files["snap/"+n], string(by))
+
+		obj, err := store.Get(ctx, "snap/"+n)
+		require.NoError(t, err)
+		fi, err := os.Stat(filepath.Join(dest, n))
+		require.NoError(t, err)
+		require.True(t, fi.ModTime().Equal(obj.Updated()))
+
+		by, err = os.ReadFile(filepath.Join(dest, n) + cloudstorage.MetaSidecarExt)
+		require.NoError(t, err)
+		md := make(map[string]string)
+		require.NoError(t, json.Unmarshal(by, &md))
+		require.Equal(t, obj.MetaData(), md)
+	}
+	_, err = os.Stat(filepath.Join(dest, "3.csv"))
+	require.True(t, os.IsNotExist(err))
+
+	// a local file of the same size is kept when resuming, replaced otherwise
+	require.NoError(t, os.WriteFile(filepath.Join(dest, "a.csv"), []byte("x,y"), 0664))
+	require.NoError(t, cloudstorage.DownloadPrefix(ctx, store, "snap/", dest, cloudstorage.DownloadOpts{Resume: true}))
+	by, err := os.ReadFile(filepath.Join(dest, "a.csv"))
+	require.NoError(t, err)
+	require.Equal(t, "x,y", string(by))
+
+	require.NoError(t, cloudstorage.DownloadPrefix(ctx, store, "snap/", dest))
+	by, err = os.ReadFile(filepath.Join(dest, "a.csv"))
+	require.NoError(t, err)
+	require.Equal(t, "a,b", string(by))
+}
+
+func TestOpenIfChanged(t *testing.T) {
+	ctx := context.Background()
+	store := mockstore.New()
+	store.Add("in/a.csv", []byte("a,b\n"), nil)
+	fpath := filepath.Join(t.TempDir(), "cache", "a.csv")
+
+	open := func(want string, wantChanged bool) {
+		t.Helper()
+		f, changed, err := cloudstorage.OpenIfChanged(ctx, store, "in/a.csv", fpath)
+		require.NoError(t, err)
+		defer f.Close()
+		by, err := io.ReadAll(f)
+		require.NoError(t, err)
+		require.Equal(t, want, string(by))
+		require.Equal(t, wantChanged, changed)
+	}
+	open("a,b\n", true)
+	require.Equal(t, 1, countCalls(store, "NewReader"))
+	open("a,b\n", false)
+	require.Equal(t, 1, countCalls(store, "NewReader"))
+
+	store.Add("in/a.csv", []byte("c,d\n"), nil)
+	open("c,d\n", true)
+	open("c,d\n", false)
+	require.Equal(t, 2, countCalls(store, "NewReader"))
+
+	// a missing local copy is downloaded again
+	require.NoError(t, os.Remove(fpath))
+	open("c,d\n", true)
+
+	_, _, err := cloudstorage.OpenIfChanged(ctx, store, "in/missing.csv", fpath)
+	require.Equal(t, cloudstorage.ErrObjectNotFound, err)
+}
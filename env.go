@@ -0,0 +1,155 @@
+package cloudstorage
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/araddon/gou"
+)
+
+// ConfigFromEnv builds a Config from environment variables.  The generic
+// fields are read from prefixed vars, ie for prefix "STORE"
+//
+//	STORE_URL                 a store url, see ConfigFromURL, read first
+//	STORE_TYPE                gcs, s3, azure, sftp, localfs
+//	STORE_BUCKET
+//	STORE_AUTH_METHOD
+//	STORE_TMPDIR
+//	STORE_LOCALFS
+//	STORE_ENABLE_COMPRESSION  true/false
+//	STORE_COMPRESSION_CODEC   gzip, zstd, snappy
+//	STORE_COMPRESSION_LEVEL
+//
+// while credentials come from the conventional per provider vars
+//
+//	s3:    AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_REGION (or AWS_DEFAULT_REGION), AWS_ENDPOINT_URL
+//	gcs:   GOOGLE_APPLICATION_CREDENTIALS, GOOGLE_CLOUD_PROJECT
+//	azure: AZURE_STORAGE_ACCOUNT, AZURE_STORAGE_KEY
+//	sftp:  SFTP_HOST, SFTP_PORT, SFTP_USER, SFTP_PASSWORD, SFTP_PRIVATE_KEY, SFTP_FOLDER
+//
+// Prefixed vars always win over the provider defaults.
+func ConfigFromEnv(prefix string) (*Config, error) {
+	if prefix != "" && !strings.HasSuffix(prefix, "_") {
+		prefix += "_"
+	}
+	env := func(name string) string {
+		return os.Getenv(prefix + name)
+	}
+
+	conf := &Config{Settings: make(gou.JsonHelper)}
+	if u := env("URL"); u != "" {
+		c, _, err := ConfigFromURL(u)
+		if err != nil {
+			return nil, err
+		}
+		conf = c
+	}
+	if t := env("TYPE"); t != "" {
+		conf.Type = t
+	}
+	if conf.Type == "" {
+		return nil, fmt.Errorf("invalid config: missing %sTYPE or %sURL env var", prefix, prefix)
+	}
+
+	switch conf.Type {
+	case "s3":
+		if key := os.Getenv("AWS_ACCESS_KEY_ID"); key != "" {
+			conf.AuthMethod = "aws_access_key"
+			conf.Settings["access_key"] = key
+			conf.Settings["access_secret"] = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		}
+		conf.Region = firstEnv(conf.Region, "AWS_REGION", "AWS_DEFAULT_REGION")
+		conf.Endpoint = firstEnv(conf.Endpoint, "AWS_ENDPOINT_URL")
+	case "gcs":
+		if creds := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); creds != "" {
+			conf.AuthMethod = "GoogleJWTFile"
+			conf.JwtFile = creds
+			if conf.Scope == "" {
+				conf.Scope = "https://www.googleapis.com/auth/devstorage.full_control"
+			}
+		} else if conf.AuthMethod == "" {
+			conf.AuthMethod = "adc"
+		}
+		conf.Project = firstEnv(conf.Project, "GOOGLE_CLOUD_PROJECT")
+	case "azure":
+		conf.AuthMethod = "azure_key"
+		conf.Project = firstEnv(conf.Project, "AZURE_STORAGE_ACCOUNT")
+		if key := os.Getenv("AZURE_STORAGE_KEY"); key != "" {
+			conf.Settings["azure_key"] = key
+		}
+	case "sftp":
+		for setting, name := range map[string]string{
+			"host":       "SFTP_HOST",
+			"user":       "SFTP_USER",
+			"password":   "SFTP_PASSWORD",
+			"privatekey": "SFTP_PRIVATE_KEY",
+			"folder":     "SFTP_FOLDER",
+		} {
+			if v := os.Getenv(name); v != "" {
+				conf.Settings[setting] = v
+			}
+		}
+		if p := os.Getenv("SFTP_PORT"); p != "" {
+			port, err := strconv.Atoi(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid config: SFTP_PORT=%q is not a number", p)
+			}
+			conf.Settings["port"] = port
+		} else if _, ok := conf.Settings["port"]; !ok {
+			conf.Settings["port"] = 22
+		}
+		if conf.Settings.String("password") != "" && conf.Settings.String("privatekey") == "" {
+			conf.AuthMethod = "userpass"
+		} else if conf.AuthMethod == "" {
+			conf.AuthMethod = "userkey"
+		}
+	case "localfs":
+		conf.AuthMethod = "localfiles"
+	}
+
+	if v := env("BUCKET"); v != "" {
+		conf.Bucket = v
+	}
+	if v := env("AUTH_METHOD"); v != "" {
+		conf.AuthMethod = AuthMethod(v)
+	}
+	if v := env("TMPDIR"); v != "" {
+		conf.TmpDir = v
+	}
+	if v := env("LOCALFS"); v != "" {
+		conf.LocalFS = v
+	}
+	if v := env("ENABLE_COMPRESSION"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config: %sENABLE_COMPRESSION=%q is not a bool", prefix, v)
+		}
+		conf.EnableCompression = b
+	}
+	if v := env("COMPRESSION_CODEC"); v != "" {
+		conf.CompressionCodec = v
+	}
+	if v := env("COMPRESSION_LEVEL"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config: %sCOMPRESSION_LEVEL=%q is not an int", prefix, v)
+		}
+		conf.CompressionLevel = l
+	}
+	return conf, nil
+}
+
+// firstEnv returns val if set, else the first non empty env var of names.
+func firstEnv(val string, names ...string) string {
+	if val != "" {
+		return val
+	}
+	for _, n := range names {
+		if v := os.Getenv(n); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,50 @@
+package cloudstorage_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	_, err := cloudstorage.ConfigFromEnv("CSTEST")
+	require.Error(t, err)
+
+	t.Setenv("CSTEST_TYPE", "s3")
+	t.Setenv("CSTEST_BUCKET", "my-bucket")
+	t.Setenv("CSTEST_ENABLE_COMPRESSION", "true")
+	t.Setenv("CSTEST_COMPRESSION_CODEC", "zstd")
+	t.Setenv("CSTEST_COMPRESSION_LEVEL", "3")
+	t.Setenv("AWS_ACCESS_KEY_ID", "key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "eu-west-1")
+	conf, err := cloudstorage.ConfigFromEnv("CSTEST")
+	require.NoError(t, err)
+	require.Equal(t, "s3", conf.Type)
+	require.Equal(t, "my-bucket", conf.Bucket)
+	require.Equal(t, "eu-west-1", conf.Region)
+	require.True(t, conf.EnableCompression)
+	require.Equal(t, cloudstorage.CodecZstd, conf.CompressionCodec)
+	require.Equal(t, 3, conf.CompressionLevel)
+	require.Equal(t, cloudstorage.AuthMethod("aws_access_key"), conf.AuthMethod)
+	require.Equal(t, "secret", conf.Settings.String("access_secret"))
+
+	t.Setenv("CSTEST_TYPE", "")
+	t.Setenv("CSTEST_URL", "sftp://user@example.com/uploads")
+	t.Setenv("SFTP_PASSWORD", "pass")
+	t.Setenv("SFTP_PORT", "2222")
+	conf, err = cloudstorage.ConfigFromEnv("CSTEST_")
+	require.NoError(t, err)
+	require.Equal(t, "sftp", conf.Type)
+	require.Equal(t, cloudstorage.AuthMethod("userpass"), conf.AuthMethod)
+	require.Equal(t, "pass", conf.Settings.String("password"))
+	require.Equal(t, 2222, conf.Settings.Int("port"))
+	require.Equal(t, "uploads", conf.Settings.String("folder"))
+
+	t.Setenv("CSTEST_ENABLE_COMPRESSION", "maybe")
+	_, err = cloudstorage.ConfigFromEnv("CSTEST")
+	require.Error(t, err)
+}
@@ -0,0 +1,94 @@
+package cloudstorage
+
+import (
+	"path"
+	"strings"
+)
+
+// ObjectFilter is a Query filter deciding on single objects by name and
+// size.  Unlike a Filter it needs no page of results: stores check it while
+// listing, on the file info or listing entry, so the objects it rejects are
+// never built, stat'ed further or buffered.  See Query.ObjectFilters.
+type ObjectFilter interface {
+	// Match is true for the objects to list, size is -1 if unknown.
+	Match(name string, size int64) bool
+}
+
+// SuffixFilter lists the objects whose name ends with the suffix.
+type SuffixFilter string
+
+// Match implements ObjectFilter.
+func (f SuffixFilter) Match(name string, size int64) bool {
+	return strings.HasSuffix(name, string(f))
+}
+
+// ExtensionFilter lists the objects with one of the extensions, with the
+// leading dot, ie ".csv".  Extensions match case insensitively.
+type ExtensionFilter []string
+
+// Match implements ObjectFilter.
+func (f ExtensionFilter) Match(name string, size int64) bool {
+	ext := path.Ext(name)
+	for _, e := range f {
+		if strings.EqualFold(ext, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// MinSizeFilter lists the objects of at least this many bytes, objects of
+// unknown size are listed.
+type MinSizeFilter int64
+
+// Match implements ObjectFilter.
+func (f MinSizeFilter) Match(name string, size int64) bool {
+	return size < 0 || size >= int64(f)
+}
+
+// MaxSizeFilter lists the objects of at most this many bytes, objects of
+// unknown size are listed.
+type MaxSizeFilter int64
+
+// Match implements ObjectFilter.
+func (f MaxSizeFilter) Match(name string, size int64) bool {
+	return size < 0 || size <= int64(f)
+}
+
+// AddObjectFilter adds a filter of single objects, see ObjectFilter.
+func (q *Query) AddObjectFilter(f ObjectFilter) *Query {
+	q.ObjectFilters = append(q.ObjectFilters, f)
+	return q
+}
+
+// Match is true if the object is InRange and passes all the ObjectFilters.
+func (q *Query) Match(name string, size int64) bool {
+	if !q.InRange(name) {
+		return false
+	}
+	for _, f := range q.ObjectFilters {
+		if !f.Match(name, size) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchObjects drops the objects not Matching the query, for the stores
+// that don't check them while listing.
+func (q *Query) matchObjects(objects Objects) Objects {
+	if len(q.ObjectFilters) == 0 && q.StartOffset == "" && q.EndOffset == "" {
+		return objects
+	}
+	matched := objects[:0]
+	for _, o := range objects {
+		size, ok := SizeOf(o)
+		if !ok {
+			size = -1
+		}
+		if q.Match(o.Name(), size) {
+			matched = append(matched, o)
+		}
+	}
+	return matched
+}
@@ -0,0 +1,45 @@
+package cloudstorage_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+)
+
+func TestObjectFilters(t *testing.T) {
+	require.True(t, cloudstorage.SuffixFilter(".csv.gz").Match("a/b.csv.gz", 1))
+	require.False(t, cloudstorage.SuffixFilter(".csv.gz").Match("a/b.csv", 1))
+
+	ext := cloudstorage.ExtensionFilter{".csv", ".json"}
+	require.True(t, ext.Match("a/b.CSV", 1))
+	require.True(t, ext.Match("a/b.json", 1))
+	require.False(t, ext.Match("a/b.csv.gz", 1))
+	require.False(t, ext.Match("a/csv", 1))
+
+	require.True(t, cloudstorage.MinSizeFilter(10).Match("a", 10))
+	require.False(t, cloudstorage.MinSizeFilter(10).Match("a", 9))
+	require.True(t, cloudstorage.MinSizeFilter(10).Match("a", -1), "unknown sizes pass")
+	require.True(t, cloudstorage.MaxSizeFilter(10).Match("a", 10))
+	require.False(t, cloudstorage.MaxSizeFilter(10).Match("a", 11))
+	require.True(t, cloudstorage.MaxSizeFilter(10).Match("a", -1), "unknown sizes pass")
+
+	q := cloudstorage.NewQuery("a/")
+	require.True(t, q.Match("a/b.txt", 5))
+	q.AddObjectFilter(ext).AddObjectFilter(cloudstorage.MaxSizeFilter(100))
+	require.True(t, q.Match("a/b.csv", 5))
+	require.False(t, q.Match("a/b.txt", 5))
+	require.False(t, q.Match("a/b.csv", 500))
+}
+
+func TestQueryOffsets(t *testing.T) {
+	q := cloudstorage.NewQuery("a/")
+	q.StartOffset = "a/b"
+	q.EndOffset = "a/d"
+	require.False(t, q.Match("a/a.csv", 1))
+	require.True(t, q.Match("a/b", 1))
+	require.True(t, q.Match("a/c.csv", 1))
+	require.False(t, q.Match("a/d", 1))
+	require.False(t, q.Match("a/e.csv", 1))
+}
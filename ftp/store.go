@@ -0,0 +1,721 @@
+package ftp
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/araddon/gou"
+	goftp "github.com/jlaffaye/ftp"
+	"github.com/pborman/uuid"
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/pathutil"
+)
+
+const (
+	// StoreType = "ftp" this is used to define the storage type to create
+	// from cloudstorage.NewStore(config)
+	StoreType = "ftp"
+
+	timeout = 5 * time.Minute
+
+	// AuthUserPass login with Settings[ConfKeyUser] and Settings[ConfKeyPassword]
+	AuthUserPass cloudstorage.AuthMethod = "userpass"
+	// AuthAnonymous login as the ftp "anonymous" user
+	AuthAnonymous cloudstorage.AuthMethod = "anonymous"
+
+	// ConfKeyUser config key name of the username
+	ConfKeyUser = "user"
+	// ConfKeyPassword config key name of the password
+	ConfKeyPassword = "password"
+	// ConfKeyHost config key name of the server host
+	ConfKeyHost = "host"
+	// ConfKeyPort config key name of the ftp port, defaults to 21
+	ConfKeyPort = "port"
+	// ConfKeyFolder config key name of the ftp folder, defaults to config.Bucket
+	ConfKeyFolder = "folder"
+	// ConfKeyTLS config key name of the FTPS mode, one of "" (plain ftp),
+	// TLSExplicit or TLSImplicit.
+	ConfKeyTLS = "tls"
+	// ConfKeyTLSSkipVerify config key name of the flag to skip verifying
+	// the server certificate.
+	ConfKeyTLSSkipVerify = "tls_skip_verify"
+
+	// TLSExplicit upgrades the connection with AUTH TLS (FTPES), usually port 21.
+	TLSExplicit = "explicit"
+	// TLSImplicit connects with TLS from the start, usually port 990.
+	TLSImplicit = "implicit"
+)
+
+var (
+	// Ensure we implement the optional mover
+	_ cloudstorage.StoreMove = (*Client)(nil)
+)
+
+type (
+	// Client is the ftp client.  An ftp control connection can only run one
+	// command at a time so all access to the connection is serialized.
+	Client struct {
+		ID        string
+		clientCtx context.Context
+		mu        sync.Mutex
+		client    *goftp.ServerConn
+		cachepath string
+		host      string
+		port      int
+		bucket    string
+		paths     map[string]struct{}
+	}
+
+	object struct {
+		client     *Client
+		cachedcopy *os.File
+		entry      *goftp.Entry
+		name       string
+		readonly   bool
+		opened     bool
+		cachepath  string
+	}
+)
+
+func init() {
+	// Register this Driver (ftp) in cloudstorage driver registry.
+	cloudstorage.Register(StoreType, NewStore)
+}
+
+// NewStore creates a new ftp store from config.
+func NewStore(conf *cloudstorage.Config) (cloudstorage.Store, error) {
+	ctx := context.Background()
+	if conf.LogPrefix != "" {
+		ctx = gou.NewContext(ctx, conf.LogPrefix)
+	}
+	client, err := NewClientFromConfig(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// NewClientFromConfig validates configuration then creates new client.
+func NewClientFromConfig(clientCtx context.Context, conf *cloudstorage.Config) (*Client, error) {
+
+	var user, password string
+	switch conf.AuthMethod {
+	case AuthUserPass:
+		user = conf.Settings.String(ConfKeyUser)
+		password = conf.Settings.String(ConfKeyPassword)
+		if user == "" {
+			return nil, fmt.Errorf("invalid config: missing settings.%s", ConfKeyUser)
+		}
+	case AuthAnonymous:
+		user, password = "anonymous", "anonymous"
+	default:
+		err := fmt.Errorf("invalid config.AuthMethod %q", conf.AuthMethod)
+		gou.WarnCtx(clientCtx, "%v", err)
+		return nil, err
+	}
+
+	host := conf.Settings.String(ConfKeyHost)
+	port := 21
+	if p, ok := conf.Settings.IntSafe(ConfKeyPort); ok && p > 0 {
+		port = p
+	}
+	folder := conf.Settings.String(ConfKeyFolder)
+	if folder == "" {
+		folder = conf.Bucket
+	}
+
+	opts := []goftp.DialOption{goftp.DialWithTimeout(timeout)}
+	tlsConf := &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: conf.Settings.Bool(ConfKeyTLSSkipVerify),
+	}
+	switch mode := conf.Settings.String(ConfKeyTLS); mode {
+	case "":
+	case TLSExplicit:
+		opts = append(opts, goftp.DialWithExplicitTLS(tlsConf))
+	case TLSImplicit:
+		opts = append(opts, goftp.DialWithTLS(tlsConf))
+	default:
+		return nil, fmt.Errorf("invalid config: settings.%s=%q must be %q or %q", ConfKeyTLS, mode, TLSExplicit, TLSImplicit)
+	}
+
+	return NewClient(clientCtx, conf, host, port, folder, user, password, opts...)
+}
+
+// NewClient returns a new FTP Client, make sure to Close when done.
+func NewClient(clientCtx context.Context, conf *cloudstorage.Config, host string, port int, folder, user, password string, opts ...goftp.DialOption) (*Client, error) {
+
+	target, err := ftpAddr(host, port)
+	if err != nil {
+		gou.WarnCtx(clientCtx, "failed creating address with %s, %d: %v", host, port, err)
+		return nil, err
+	}
+
+	uid := uuid.NewUUID().String()
+	uid = strings.Replace(uid, "-", "", -1)
+	cachepath, err := cloudstorage.CacheDir(conf.TmpDir, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := goftp.Dial(target, opts...)
+	if err != nil {
+		gou.WarnCtx(clientCtx, "failed FTP dial for %s with error %s", target, err)
+		return nil, err
+	}
+	if err = conn.Login(user, password); err != nil {
+		gou.WarnCtx(clientCtx, "failed FTP login for %s with error %s", user, err)
+		conn.Quit()
+		return nil, err
+	}
+
+	return &Client{
+		ID:        uid,
+		clientCtx: clientCtx,
+		client:    conn,
+		host:      host,
+		port:      port,
+		cachepath: cachepath,
+		bucket:    strings.Trim(folder, "/"),
+		paths:     make(map[string]struct{}),
+	}, nil
+}
+
+// Type of store = "ftp"
+func (m *Client) Type() string {
+	return StoreType
+}
+
+// CleanCache removes stale cache files from the store's TmpDir, see
+// cloudstorage.CleanCache.
+func (m *Client) CleanCache(ctx context.Context, olderThan time.Duration) error {
+	return cloudstorage.CleanCache(ctx, m.cachepath, olderThan)
+}
+
+// CachePath is the cache directory of the store below its TmpDir.
+func (m *Client) CachePath() string {
+	return m.cachepath
+}
+
+// UpdatedGranularity of ftp, MLSD times have seconds.  Servers only
+// supporting LIST may just have minutes.
+func (m *Client) UpdatedGranularity() time.Duration {
+	return time.Second
+}
+
+// Capabilities of ftp, its single control connection serves one command at
+// a time so it isn't Concurrent, and it has no atomic create for
+// IfNotExists.
+func (m *Client) Capabilities() cloudstorage.Capabilities {
+	return cloudstorage.Capabilities{}
+}
+
+// Client return underlying client
+func (m *Client) Client() interface{} {
+	return m.client
+}
+
+func (m *Client) String() string {
+	return fmt.Sprintf("<ftp host=%q />", m.host)
+}
+
+// fullpath is the server path of the object name.
+func (m *Client) fullpath(name string) string {
+	return pathutil.JoinKey("/", m.bucket, pathutil.CleanKey(name))
+}
+
+// stat finds the entry for the named file by listing its parent folder,
+// MLST/SIZE/MDTM are not supported consistently across ftp servers.
+func (m *Client) stat(name string) (*goftp.Entry, error) {
+	full := m.fullpath(name)
+	m.mu.Lock()
+	entries, err := m.client.List(path.Dir(full))
+	m.mu.Unlock()
+	if err != nil {
+		if isNotExist(err) {
+			return nil, cloudstorage.ErrObjectNotFound
+		}
+		return nil, err
+	}
+	base := path.Base(full)
+	for _, e := range entries {
+		if e.Name == base && e.Type == goftp.EntryTypeFile {
+			return e, nil
+		}
+	}
+	return nil, cloudstorage.ErrObjectNotFound
+}
+
+// isNotExist checks for the 550 "file unavailable" ftp reply.
+func isNotExist(err error) bool {
+	if err == nil {
+		return false
+	}
+	if tpErr, ok := err.(*textproto.Error); ok {
+		return tpErr.Code == goftp.StatusFileUnavailable
+	}
+	return false
+}
+
+// NewObject create a new object with given name.  Will not write to remote
+// ftp until Close is called.
+func (m *Client) NewObject(objectname string, opts ...cloudstorage.Opts) (cloudstorage.Object, error) {
+	if len(opts) > 0 && opts[0].WriteThrough {
+		return cloudstorage.NewWriteThroughObject(m, objectname, opts[0])
+	}
+	obj, err := m.Get(context.Background(), objectname)
+	if err != nil && err != cloudstorage.ErrObjectNotFound {
+		return nil, err
+	} else if obj != nil {
+		if len(opts) > 0 && opts[0].Overwrite {
+			if opts[0].Stream {
+				return cloudstorage.NewStreamObject(m, obj, opts[0]), nil
+			}
+			return obj, nil
+		}
+		return nil, cloudstorage.ErrObjectExists
+	}
+
+	return &object{
+		client:    m,
+		name:      objectname,
+		cachepath: cloudstorage.CachePathObj(m.cachepath, objectname, m.ID),
+	}, nil
+}
+
+// Get a single file object.
+func (m *Client) Get(ctx context.Context, name string) (cloudstorage.Object, error) {
+	e, err := m.stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return newObjectFromEntry(m, name, e), nil
+}
+
+// Objects returns an iterator over the objects in the ftp folder that match the Query q.
+func (m *Client) Objects(ctx context.Context, q cloudstorage.Query) (cloudstorage.ObjectIterator, error) {
+	return cloudstorage.NewObjectPageIterator(ctx, m, q), nil
+}
+
+// List lists files in a directory, recursing into sub-folders.
+func (m *Client) List(ctx context.Context, q cloudstorage.Query) (*cloudstorage.ObjectsResponse, error) {
+
+	objs := cloudstorage.NewObjectsResponse()
+
+	dir := q.Prefix
+	if !strings.HasSuffix(dir, "/") {
+		dir = path.Dir(dir)
+		if dir == "." {
+			dir = ""
+		}
+	}
+
+	if err := m.listFiles(ctx, q, objs, strings.TrimSuffix(dir, "/")); err != nil {
+		if err == cloudstorage.ErrObjectNotFound {
+			return objs, nil
+		}
+		gou.Warnf("fetch listFiles error %v", err)
+		return nil, err
+	}
+	// list in name order like the cloud stores, iterators resume by name
+	sort.Sort(objs.Objects)
+	objs.Objects = q.ApplyFilters(objs.Objects)
+	return objs, nil
+}
+
+func (m *Client) listFiles(ctx context.Context, q cloudstorage.Query, objs *cloudstorage.ObjectsResponse, dir string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	entries, err := m.fetchEntries(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !q.ShowHidden && strings.HasPrefix(e.Name, ".") {
+			continue
+		}
+		name := pathutil.JoinKey(dir, e.Name)
+		switch e.Type {
+		case goftp.EntryTypeFolder:
+			// only descend into folders that may contain the prefix
+			dirName := name + "/"
+			if !strings.HasPrefix(dirName, q.Prefix) && !strings.HasPrefix(q.Prefix, dirName) {
+				continue
+			}
+			if q.Delimiter == "/" {
+				// listing starts at the prefix's own level so every
+				// sub-directory here is a common prefix.
+				objs.Prefixes = append(objs.Prefixes, dirName)
+				continue
+			}
+			if err := m.listFiles(ctx, q, objs, name); err != nil {
+				return err
+			}
+		case goftp.EntryTypeFile:
+			if !strings.HasPrefix(name, q.Prefix) || !q.Match(name, int64(e.Size)) {
+				continue
+			}
+			objs.Objects = append(objs.Objects, newObjectFromEntry(m, name, e))
+		}
+	}
+	return nil
+}
+
+// Folders get folders list.
+func (m *Client) Folders(ctx context.Context, q cloudstorage.Query) ([]string, error) {
+	iter, err := m.FolderIterator(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+	return cloudstorage.FoldersAll(iter)
+}
+
+// FolderIterator returns an iterator over the folders below the Query prefix.
+func (m *Client) FolderIterator(ctx context.Context, q cloudstorage.Query) (cloudstorage.FolderIterator, error) {
+	return cloudstorage.NewFolderPageIterator(ctx, m, q), nil
+}
+
+// fetchEntries lists the folder, skipping the "." and ".." entries some
+// servers return.
+func (m *Client) fetchEntries(folder string) ([]*goftp.Entry, error) {
+	m.mu.Lock()
+	entries, err := m.client.List(m.fullpath(folder))
+	m.mu.Unlock()
+	if err != nil {
+		if isNotExist(err) {
+			return nil, cloudstorage.ErrObjectNotFound
+		}
+		gou.WarnCtx(m.clientCtx, "failed to read directory %q with error: %v", folder, err)
+		return nil, err
+	}
+	out := entries[:0]
+	for _, e := range entries {
+		if e.Name == "." || e.Name == ".." {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// Close closes underlying client connection
+func (m *Client) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.client.Quit()
+}
+
+// Delete deletes a file
+func (m *Client) Delete(ctx context.Context, name string, opts ...cloudstorage.Opts) error {
+	if _, err := m.stat(name); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.client.Delete(m.fullpath(name))
+}
+
+// Move renames the file on the ftp server, an existing destination is replaced.
+func (m *Client) Move(ctx context.Context, src, des cloudstorage.Object) error {
+	m.ensureDir(des.Name())
+	if err := m.Delete(ctx, des.Name()); err != nil && err != cloudstorage.ErrObjectNotFound {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.client.Rename(m.fullpath(src.Name()), m.fullpath(des.Name()))
+}
+
+func (m *Client) ensureDir(name string) {
+	parts := strings.Split(strings.Trim(m.fullpath(name), "/"), "/")
+	dir := "/"
+	for _, dirPart := range parts[0 : len(parts)-1] {
+		dir = pathutil.JoinKey(dir, dirPart)
+		m.mu.Lock()
+		if _, exists := m.paths[dir]; exists {
+			m.mu.Unlock()
+			continue
+		}
+		// MakeDir errors if the folder exists, so ignore it
+		if err := m.client.MakeDir(dir); err != nil {
+			gou.Debugf("could not create directory for ftp %q %v", dir, err)
+		}
+		m.paths[dir] = struct{}{}
+		m.mu.Unlock()
+	}
+}
+
+// download copies the remote file into w.  The ftp connection is busy
+// until the transfer completes so it is read fully while locked.
+func (m *Client) download(name string, w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	resp, err := m.client.Retr(m.fullpath(name))
+	if err != nil {
+		if isNotExist(err) {
+			return cloudstorage.ErrObjectNotFound
+		}
+		return err
+	}
+	_, err = io.Copy(w, resp)
+	if cerr := resp.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (m *Client) upload(name string, r io.Reader) error {
+	m.ensureDir(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.client.Stor(m.fullpath(name), r)
+}
+
+// NewReader create file reader.
+func (m *Client) NewReader(o string) (io.ReadCloser, error) {
+	return m.NewReaderWithContext(context.Background(), o)
+}
+
+// NewReaderWithContext create new File reader with context.  The file is
+// copied to the local cache first so the ftp connection is not held by
+// the reader.
+func (m *Client) NewReaderWithContext(ctx context.Context, name string) (io.ReadCloser, error) {
+	obj, err := m.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := obj.Open(cloudstorage.ReadOnly)
+	if err != nil {
+		return nil, err
+	}
+	return &cachedReader{File: f, obj: obj}, nil
+}
+
+// cachedReader removes the cached copy on close.
+type cachedReader struct {
+	*os.File
+	obj cloudstorage.Object
+}
+
+func (r *cachedReader) Close() error {
+	return r.obj.Release()
+}
+
+// NewWriter create Object Writer.
+func (m *Client) NewWriter(objectName string, metadata map[string]string) (io.WriteCloser, error) {
+	return m.NewWriterWithContext(context.Background(), objectName, metadata)
+}
+
+// NewWriterWithContext create writer with provided context, ftp has no
+// metadata so it is ignored.
+func (m *Client) NewWriterWithContext(ctx context.Context, name string, metadata map[string]string, opts ...cloudstorage.Opts) (io.WriteCloser, error) {
+	if len(opts) > 0 && opts[0].IfNotExists {
+		return nil, fmt.Errorf("options IfNotExists not supported for store type")
+	}
+
+	o := &object{
+		client:    m,
+		name:      name,
+		cachepath: cloudstorage.CachePathObj(m.cachepath, name, m.ID),
+	}
+	if _, err := o.Open(cloudstorage.ReadWrite); err != nil {
+		gou.Errorf("could not open %v %v", name, err)
+		return nil, err
+	}
+	return cloudstorage.NewResultWriter(o, nil), nil
+}
+
+func newObjectFromEntry(c *Client, name string, e *goftp.Entry) *object {
+	name = pathutil.CleanKey(name)
+	return &object{
+		client:    c,
+		entry:     e,
+		name:      name,
+		cachepath: cloudstorage.CachePathObj(c.cachepath, name, c.ID),
+	}
+}
+
+func (o *object) Size() int64 {
+	if o.entry == nil {
+		return 0
+	}
+	return int64(o.entry.Size)
+}
+
+// Open ensures the file is available for read/write (or accessevel)
+func (o *object) Open(accesslevel cloudstorage.AccessLevel) (*os.File, error) {
+
+	if o.opened {
+		return nil, fmt.Errorf("the store object is already opened. %s", o.cachepath)
+	}
+
+	if err := cloudstorage.EnsureDir(o.cachepath); err != nil {
+		return nil, fmt.Errorf("could not create cachedcopy's dir. cachepath=%q err=%v", o.cachepath, err)
+	}
+
+	cachedcopy, err := os.Create(o.cachepath)
+	if err != nil {
+		return nil, fmt.Errorf("could not open cachedcopy file. cachepath=%q err=%v", o.cachepath, err)
+	}
+
+	if o.entry != nil {
+		// existing file
+		if err := o.client.download(o.name, cachedcopy); err != nil {
+			gou.WarnCtx(o.client.clientCtx, "Could not get %q err=%v", o.name, err)
+			cachedcopy.Close()
+			return nil, err
+		}
+		if _, err := cachedcopy.Seek(0, io.SeekStart); err != nil {
+			cachedcopy.Close()
+			return nil, fmt.Errorf("error seeking to start of cachedcopy err=%v", err)
+		}
+	}
+
+	o.cachedcopy = cachedcopy
+	o.readonly = accesslevel == cloudstorage.ReadOnly
+	o.opened = true
+	return o.cachedcopy, nil
+}
+
+// Delete delete the underlying object from ftp server.
+func (o *object) Delete() error {
+	o.Release()
+	return o.client.Delete(context.Background(), o.name)
+}
+
+func (o *object) Sync() error {
+
+	if !o.opened {
+		return fmt.Errorf("object isn't opened object:%s", o.name)
+	}
+	if o.readonly {
+		return fmt.Errorf("trying to Sync a readonly object:%s", o.name)
+	}
+
+	cachedcopy, err := os.Open(o.cachepath)
+	if err != nil {
+		return fmt.Errorf("couldn't open localfile for sync'ing. local=%s err=%v", o.cachepath, err)
+	}
+	defer cachedcopy.Close()
+
+	if err := o.client.upload(o.name, cachedcopy); err != nil {
+		gou.WarnCtx(o.client.clientCtx, "Could not upload %q err=%v", o.cachepath, err)
+		return err
+	}
+	return nil
+}
+
+func (o *object) Close() error {
+	if !o.opened {
+		return nil
+	}
+	defer func() {
+		os.Remove(o.cachepath)
+		o.cachedcopy = nil
+		o.opened = false
+	}()
+
+	if !o.readonly {
+		if err := o.cachedcopy.Sync(); err != nil {
+			return err
+		}
+	}
+	if err := o.cachedcopy.Close(); err != nil {
+		if !strings.Contains(err.Error(), os.ErrClosed.Error()) {
+			return fmt.Errorf("error on closing localfile. %q err=%v", o.cachepath, err)
+		}
+	}
+	if !o.readonly {
+		return o.Sync()
+	}
+	return nil
+}
+
+func (o *object) Release() error {
+	if o.cachedcopy != nil {
+		o.cachedcopy.Close()
+		o.cachedcopy = nil
+		o.opened = false
+	}
+	// most likely this doesn't exist so don't return error
+	os.Remove(o.cachepath)
+	return nil
+}
+
+func (o *object) File() *os.File {
+	return o.cachedcopy
+}
+func (o *object) Read(p []byte) (n int, err error) {
+	return o.cachedcopy.Read(p)
+}
+func (o *object) Write(p []byte) (n int, err error) {
+	if o.cachedcopy == nil {
+		_, err := o.Open(cloudstorage.ReadWrite)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return o.cachedcopy.Write(p)
+}
+
+// MetaData ftp has no per-file metadata.
+func (o *object) MetaData() map[string]string {
+	return nil
+}
+func (o *object) SetMetaData(meta map[string]string) {}
+
+func (o *object) DisableCompression() {}
+
+func (o *object) StorageSource() string {
+	return StoreType
+}
+func (o *object) Name() string {
+	return o.name
+}
+func (o *object) String() string {
+	return o.name
+}
+func (o *object) Updated() time.Time {
+	if o.entry != nil {
+		return o.entry.Time.UTC()
+	}
+	return time.Time{}
+}
+
+// ftpAddr build ftp address
+func ftpAddr(host string, port int) (string, error) {
+	// remove things like ftp://
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[(i + 3):]
+	}
+
+	// remove trailing :port
+	if i := strings.Index(host, ":"); i >= 0 {
+		host = host[:i]
+	}
+
+	if host == "" {
+		return "", fmt.Errorf("host name not recognized %s", host)
+	}
+
+	if port <= 0 {
+		return "", fmt.Errorf("port number must be greater than 0")
+	}
+
+	return fmt.Sprintf("%s:%v", host, port), nil
+}
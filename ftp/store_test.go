@@ -0,0 +1,82 @@
+package ftp_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/araddon/gou"
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/ftp"
+	"github.com/lytics/cloudstorage/testutils"
+)
+
+/*
+
+# to use ftp tests ensure you have exported
+
+export FTP_HOST="localhost"
+export FTP_USER="aaa"
+export FTP_PASSWORD="bbb"
+export FTP_FOLDER="bucket"
+export FTP_TLS="explicit" # optional
+
+*/
+
+func TestConfig(t *testing.T) {
+	conf := &cloudstorage.Config{
+		Type:       ftp.StoreType,
+		AuthMethod: ftp.AuthUserPass,
+		TmpDir:     t.TempDir(),
+		Settings:   make(gou.JsonHelper),
+	}
+	_, err := cloudstorage.NewStore(conf)
+	require.Error(t, err)
+
+	conf.Settings[ftp.ConfKeyUser] = "user"
+	conf.Settings[ftp.ConfKeyTLS] = "bogus"
+	_, err = cloudstorage.NewStore(conf)
+	require.Error(t, err)
+
+	conf.AuthMethod = "bad"
+	_, err = cloudstorage.NewStore(conf)
+	require.Error(t, err)
+
+	conf.AuthMethod = ftp.AuthAnonymous
+	conf.Settings[ftp.ConfKeyTLS] = ftp.TLSExplicit
+	// missing host
+	_, err = cloudstorage.NewStore(conf)
+	require.Error(t, err)
+}
+
+func TestAll(t *testing.T) {
+	if os.Getenv("FTP_HOST") == "" {
+		t.Logf("No ftp host, skipping")
+		t.Skip()
+		return
+	}
+	tmpDir := t.TempDir()
+	config := &cloudstorage.Config{
+		Type:       ftp.StoreType,
+		AuthMethod: ftp.AuthUserPass,
+		Bucket:     os.Getenv("FTP_FOLDER"),
+		TmpDir:     filepath.Join(tmpDir, "localcache", "ftp"),
+		Settings:   make(gou.JsonHelper),
+		LogPrefix:  "ftp-testing",
+	}
+	config.Settings[ftp.ConfKeyHost] = os.Getenv("FTP_HOST")
+	config.Settings[ftp.ConfKeyUser] = os.Getenv("FTP_USER")
+	config.Settings[ftp.ConfKeyPassword] = os.Getenv("FTP_PASSWORD")
+	config.Settings[ftp.ConfKeyTLS] = os.Getenv("FTP_TLS")
+	config.Settings[ftp.ConfKeyTLSSkipVerify] = true
+
+	store, err := cloudstorage.NewStore(config)
+	if err != nil {
+		t.Logf("No valid auth provided, skipping ftp testing %v", err)
+		t.Skip()
+		return
+	}
+	testutils.RunTests(t, store, config)
+}
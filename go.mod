@@ -17,7 +17,20 @@ require (
 	google.golang.org/api v0.103.0
 )
 
-require github.com/acomagu/bufpipe v1.0.4
+require (
+	github.com/acomagu/bufpipe v1.0.4
+	github.com/fsnotify/fsnotify v1.6.0
+	github.com/jlaffaye/ftp v0.1.0
+	github.com/klauspost/compress v1.17.4
+	github.com/ncw/swift v1.0.53
+	google.golang.org/grpc v1.50.1
+	google.golang.org/protobuf v1.28.1
+)
+
+require (
+	github.com/hashicorp/errwrap v1.0.0 // indirect
+	github.com/hashicorp/go-multierror v1.1.1 // indirect
+)
 
 require (
 	cloud.google.com/go v0.105.0 // indirect
@@ -50,7 +63,5 @@ require (
 	golang.org/x/xerrors v0.0.0-20220907171357-04be3eba64a2 // indirect
 	google.golang.org/appengine v1.6.7 // indirect
 	google.golang.org/genproto v0.0.0-20221027153422-115e99e71e1c // indirect
-	google.golang.org/grpc v1.50.1 // indirect
-	google.golang.org/protobuf v1.28.1 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,40 @@
+package google
+
+import (
+	"errors"
+	"net/http"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
+
+	"github.com/lytics/cloudstorage"
+)
+
+var _ cloudstorage.StoreACLSetter = (*GcsFS)(nil)
+
+// SetObjectACL grants (ACLPublicRead) or removes (ACLPrivate) the allUsers
+// reader entry of the object's ACL, the other entries are left alone.
+// Buckets with uniform bucket-level access have no object ACLs.
+func (g *GcsFS) SetObjectACL(ctx context.Context, name string, acl cloudstorage.ACL) error {
+	oh := g.gcsb().Object(name)
+	var err error
+	if acl == cloudstorage.ACLPublicRead {
+		err = oh.ACL().Set(ctx, storage.AllUsers, storage.RoleReader)
+	} else {
+		err = oh.ACL().Delete(ctx, storage.AllUsers)
+	}
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) && gerr.Code == http.StatusNotFound {
+		// a private object has no allUsers entry to delete
+		if _, err := oh.Attrs(ctx); err == storage.ErrObjectNotExist {
+			return cloudstorage.ErrObjectNotFound
+		} else if err != nil {
+			return err
+		}
+		if acl == cloudstorage.ACLPrivate {
+			return nil
+		}
+	}
+	return err
+}
@@ -1,10 +1,32 @@
 package google
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/lytics/cloudstorage"
 	"google.golang.org/api/storage/v1"
 )
 
+// publicAccessPrevention states of a bucket's iam configuration.
+const (
+	publicAccessEnforced  = "enforced"
+	publicAccessInherited = "inherited"
+)
+
+// CORS is a cross-origin resource sharing rule of a bucket, for browsers
+// reading or uploading objects from other origins.
+type CORS struct {
+	// Origins allowed, ie "https://app.example.com", "*" is any origin.
+	Origins []string
+	// Methods allowed, ie "GET", "PUT", "POST".
+	Methods []string
+	// ResponseHeaders browsers may expose to the origins, ie "Content-Type".
+	ResponseHeaders []string
+	// MaxAge browsers cache the preflight response for, 0 is not set.
+	MaxAge time.Duration
+}
+
 // APIStore a google api store
 type APIStore struct {
 	service *storage.Service
@@ -88,6 +110,99 @@ func (c *APIStore) SetBucketAgeLifecycle(name string, days int64) error {
 	return err
 }
 
+// SetBucketCORS replaces the CORS configuration of the bucket with rules, no
+// rules removes it.
+func (c *APIStore) SetBucketCORS(name string, rules ...CORS) error {
+	bucket := &storage.Bucket{Cors: make([]*storage.BucketCors, 0, len(rules))}
+	for _, r := range rules {
+		if len(r.Origins) == 0 || len(r.Methods) == 0 {
+			return fmt.Errorf("invalid cors rule for bucket %s: origins and methods are required", name)
+		}
+		if r.MaxAge < 0 {
+			return fmt.Errorf("invalid cors rule for bucket %s: negative max age %v", name, r.MaxAge)
+		}
+		bucket.Cors = append(bucket.Cors, &storage.BucketCors{
+			Origin:         r.Origins,
+			Method:         r.Methods,
+			ResponseHeader: r.ResponseHeaders,
+			MaxAgeSeconds:  int64(r.MaxAge / time.Second),
+		})
+	}
+	// send an empty list to remove the rules, omitted it leaves them be.
+	bucket.ForceSendFields = []string{"Cors"}
+	_, err := c.service.Buckets.Patch(name, bucket).Do()
+	return err
+}
+
+// GetBucketCORS returns the CORS rules of the bucket, nil if it has none.
+func (c *APIStore) GetBucketCORS(name string) ([]CORS, error) {
+	bucket, err := c.service.Buckets.Get(name).Fields("cors").Do()
+	if err != nil {
+		return nil, err
+	}
+	var rules []CORS
+	for _, bc := range bucket.Cors {
+		rules = append(rules, CORS{
+			Origins:         bc.Origin,
+			Methods:         bc.Method,
+			ResponseHeaders: bc.ResponseHeader,
+			MaxAge:          time.Duration(bc.MaxAgeSeconds) * time.Second,
+		})
+	}
+	return rules, nil
+}
+
+// SetUniformBucketLevelAccess enables or disables uniform bucket-level
+// access, with it object ACLs are ignored and access is only granted by
+// IAM.  It can only be disabled within 90 days of enabling it.
+func (c *APIStore) SetUniformBucketLevelAccess(name string, enabled bool) error {
+	ubla := &storage.BucketIamConfigurationUniformBucketLevelAccess{
+		Enabled:         enabled,
+		ForceSendFields: []string{"Enabled"},
+	}
+	bucket := &storage.Bucket{
+		IamConfiguration: &storage.BucketIamConfiguration{UniformBucketLevelAccess: ubla},
+	}
+	_, err := c.service.Buckets.Patch(name, bucket).Do()
+	return err
+}
+
+// GetUniformBucketLevelAccess returns whether uniform bucket-level access
+// is enabled on the bucket.
+func (c *APIStore) GetUniformBucketLevelAccess(name string) (bool, error) {
+	bucket, err := c.service.Buckets.Get(name).Fields("iamConfiguration").Do()
+	if err != nil {
+		return false, err
+	}
+	iam := bucket.IamConfiguration
+	return iam != nil && iam.UniformBucketLevelAccess != nil && iam.UniformBucketLevelAccess.Enabled, nil
+}
+
+// SetPublicAccessPrevention enforces public access prevention on the
+// bucket, denying access to allUsers and allAuthenticatedUsers, or sets it
+// back to inherit the organization policy when not enforced.
+func (c *APIStore) SetPublicAccessPrevention(name string, enforced bool) error {
+	pap := publicAccessInherited
+	if enforced {
+		pap = publicAccessEnforced
+	}
+	bucket := &storage.Bucket{
+		IamConfiguration: &storage.BucketIamConfiguration{PublicAccessPrevention: pap},
+	}
+	_, err := c.service.Buckets.Patch(name, bucket).Do()
+	return err
+}
+
+// GetPublicAccessPrevention returns whether public access prevention is
+// enforced on the bucket itself, rather than inherited.
+func (c *APIStore) GetPublicAccessPrevention(name string) (bool, error) {
+	bucket, err := c.service.Buckets.Get(name).Fields("iamConfiguration").Do()
+	if err != nil {
+		return false, err
+	}
+	return bucket.IamConfiguration != nil && bucket.IamConfiguration.PublicAccessPrevention == publicAccessEnforced, nil
+}
+
 // GrantObjectViewer updates the IAM policy on the bucket to grant member the roles/storage.objectViewer role
 // The existing policy attributes on the bucket are preserved
 func (c *APIStore) GrantObjectViewer(bucket, member string) error {
@@ -1,15 +1,18 @@
 package google
 
 import (
+	"encoding/base64"
 	"fmt"
 	"net/http"
 	"os"
+	"time"
 
 	"cloud.google.com/go/storage"
 	"golang.org/x/net/context"
 	"golang.org/x/oauth2"
 	googleOauth2 "golang.org/x/oauth2/google"
 	"golang.org/x/oauth2/jwt"
+	"google.golang.org/api/impersonate"
 	"google.golang.org/api/option"
 
 	"github.com/lytics/cloudstorage"
@@ -27,6 +30,19 @@ const (
 	// AuthGCEDefaultOAuthToken means use local auth where it (google client)
 	// checks variety of locations for local auth tokens.
 	AuthGCEDefaultOAuthToken cloudstorage.AuthMethod = "gcedefaulttoken"
+	// AuthAnonymous uses an unauthenticated client, only useful for reading
+	// public buckets.
+	AuthAnonymous cloudstorage.AuthMethod = "anonymous"
+	// AuthADC uses google Application Default Credentials found via
+	// google.FindDefaultCredentials, this covers GKE workload identity.
+	AuthADC cloudstorage.AuthMethod = "adc"
+	// AuthImpersonatedSA uses Application Default Credentials to impersonate
+	// the service account named in Settings[ConfKeyImpersonateServiceAccount].
+	AuthImpersonatedSA cloudstorage.AuthMethod = "impersonated_sa"
+
+	// ConfKeyImpersonateServiceAccount config key name of the target service
+	// account email for AuthImpersonatedSA.
+	ConfKeyImpersonateServiceAccount = "impersonate_service_account"
 )
 
 // GoogleOAuthClient An interface so we can return any of the
@@ -43,7 +59,12 @@ func (g *gOAuthClient) Client() *http.Client {
 }
 
 func gcsCommonClient(client *http.Client, conf *cloudstorage.Config) (cloudstorage.Store, error) {
-	gcs, err := storage.NewClient(context.Background(), option.WithHTTPClient(client))
+	opts := []option.ClientOption{option.WithHTTPClient(client)}
+	if conf.Endpoint != "" {
+		// emulators such as fake-gcs-server
+		opts = append(opts, option.WithEndpoint(conf.Endpoint))
+	}
+	gcs, err := storage.NewClient(context.Background(), opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -51,6 +72,53 @@ func gcsCommonClient(client *http.Client, conf *cloudstorage.Config) (cloudstora
 	if err != nil {
 		return nil, err
 	}
+	store.Timeouts = conf.Timeouts()
+	if err := cloudstorage.ValidateCompression(conf.CompressionCodec, conf.CompressionLevel); err != nil {
+		return nil, fmt.Errorf("invalid config: %v", err)
+	}
+	store.CompressionCodec = conf.CompressionCodec
+	store.CompressionLevel = conf.CompressionLevel
+	if chunkSize, ok := conf.Settings.IntSafe(ConfKeyChunkSize); ok {
+		if chunkSize < 0 || chunkSize > MaxChunkSize {
+			return nil, fmt.Errorf("invalid config: %s=%d must be between 0 and %d", ConfKeyChunkSize, chunkSize, MaxChunkSize)
+		}
+		store.ChunkSize = chunkSize
+	}
+	if deadline := conf.Settings.String(ConfKeyChunkRetryDeadline); deadline != "" {
+		d, err := time.ParseDuration(deadline)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config: %s=%q err=%v", ConfKeyChunkRetryDeadline, deadline, err)
+		}
+		store.ChunkRetryDeadline = d
+	}
+	if key := conf.Settings.String(ConfKeyEncryptionKey); key != "" {
+		kb, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config: %s is not base64 encoded err=%v", ConfKeyEncryptionKey, err)
+		}
+		if len(kb) != 32 {
+			return nil, fmt.Errorf("invalid config: %s must be a 32 byte AES-256 key, got %d bytes", ConfKeyEncryptionKey, len(kb))
+		}
+		store.EncryptionKey = kb
+	}
+	if threshold, ok := conf.Settings.IntSafe(ConfKeyDownloadThreshold); ok {
+		if threshold < 0 {
+			return nil, fmt.Errorf("invalid config: %s=%d must be >= 0", ConfKeyDownloadThreshold, threshold)
+		}
+		store.DownloadThreshold = int64(threshold)
+	}
+	if partSize, ok := conf.Settings.IntSafe(ConfKeyDownloadPartSize); ok {
+		if partSize <= 0 {
+			return nil, fmt.Errorf("invalid config: %s=%d must be > 0", ConfKeyDownloadPartSize, partSize)
+		}
+		store.DownloadPartSize = int64(partSize)
+	}
+	if concurrency, ok := conf.Settings.IntSafe(ConfKeyDownloadConcurrency); ok {
+		if concurrency <= 0 {
+			return nil, fmt.Errorf("invalid config: %s=%d must be > 0", ConfKeyDownloadConcurrency, concurrency)
+		}
+		store.DownloadConcurrency = concurrency
+	}
 	return store, nil
 }
 
@@ -151,6 +219,65 @@ func BuildDefaultGoogleTransporter(scope ...string) (GoogleOAuthClient, error) {
 	}, nil
 }
 
+// BuildAnonymousTransporter creates a GoogleOAuthClient that sends no
+// credentials, the equivalent of option.WithoutAuthentication.  Requests
+// will only succeed against publicly readable buckets.
+func BuildAnonymousTransporter() GoogleOAuthClient {
+	return &gOAuthClient{
+		httpclient: &http.Client{},
+	}
+}
+
+// BuildADCTransporter creates a GoogleOAuthClient from google Application
+// Default Credentials.  If no scope is given storage.ScopeFullControl is used.
+func BuildADCTransporter(scope ...string) (GoogleOAuthClient, error) {
+	if len(scope) == 0 || scope[0] == "" {
+		scope = []string{storage.ScopeFullControl}
+	}
+	creds, err := googleOauth2.FindDefaultCredentials(context.Background(), scope...)
+	if err != nil {
+		return nil, err
+	}
+	return &gOAuthClient{
+		httpclient: oauth2.NewClient(context.Background(), creds.TokenSource),
+	}, nil
+}
+
+// BuildImpersonatedTransporter creates a GoogleOAuthClient that uses the
+// Application Default Credentials to impersonate the target service account.
+// The caller must have roles/iam.serviceAccountTokenCreator on the target.
+func BuildImpersonatedTransporter(targetServiceAccount string, scope ...string) (GoogleOAuthClient, error) {
+	if len(scope) == 0 || scope[0] == "" {
+		scope = []string{storage.ScopeFullControl}
+	}
+	ts, err := impersonate.CredentialsTokenSource(context.Background(), impersonate.CredentialsConfig{
+		TargetPrincipal: targetServiceAccount,
+		Scopes:          scope,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &gOAuthClient{
+		httpclient: oauth2.NewClient(context.Background(), ts),
+	}, nil
+}
+
+// registeredClient converts the credentials returned by an AuthProvider
+// registered with cloudstorage.RegisterAuth into a GoogleOAuthClient.  The
+// provider may return a GoogleOAuthClient, *http.Client or oauth2.TokenSource.
+func registeredClient(creds interface{}) (GoogleOAuthClient, error) {
+	switch c := creds.(type) {
+	case GoogleOAuthClient:
+		return c, nil
+	case *http.Client:
+		return &gOAuthClient{httpclient: c}, nil
+	case oauth2.TokenSource:
+		return &gOAuthClient{httpclient: oauth2.NewClient(context.Background(), c)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported credentials type %T from registered auth provider", creds)
+	}
+}
+
 // NewGoogleClient create new Google Storage Client.
 func NewGoogleClient(conf *cloudstorage.Config) (client GoogleOAuthClient, err error) {
 
@@ -186,8 +313,31 @@ func NewGoogleClient(conf *cloudstorage.Config) (client GoogleOAuthClient, err e
 		if err != nil {
 			return nil, err
 		}
+	case AuthAnonymous:
+		client = BuildAnonymousTransporter()
+	case AuthADC:
+		client, err = BuildADCTransporter(conf.Scope)
+		if err != nil {
+			return nil, err
+		}
+	case AuthImpersonatedSA:
+		target := conf.Settings.String(ConfKeyImpersonateServiceAccount)
+		if target == "" {
+			return nil, fmt.Errorf("invalid config: missing settings.%s", ConfKeyImpersonateServiceAccount)
+		}
+		client, err = BuildImpersonatedTransporter(target, conf.Scope)
+		if err != nil {
+			return nil, err
+		}
 	default:
-		return nil, fmt.Errorf("bad AuthMethod: %v", conf.AuthMethod)
+		creds, ok, err := cloudstorage.AuthCredentials(conf)
+		if !ok {
+			return nil, fmt.Errorf("bad AuthMethod: %v", conf.AuthMethod)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return registeredClient(creds)
 	}
 
 	return client, err
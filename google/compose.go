@@ -0,0 +1,58 @@
+package google
+
+import (
+	"errors"
+	"net/http"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
+
+	"github.com/lytics/cloudstorage"
+)
+
+// maxComposeSources is the most objects a single gcs compose request takes.
+const maxComposeSources = 32
+
+var _ cloudstorage.StoreComposer = (*GcsFS)(nil)
+
+// Compose concatenates srcs into dst with gcs compose requests.  Beyond
+// maxComposeSources sources dst is built up over several requests, each
+// appending the next batch to the result of the previous one, so readers
+// may see the intermediate results.
+func (g *GcsFS) Compose(ctx context.Context, dst string, srcs []string) error {
+	first, err := g.objectHandle(srcs[0]).Attrs(ctx)
+	if err == storage.ErrObjectNotExist {
+		return cloudstorage.ErrObjectNotFound
+	} else if err != nil {
+		return err
+	}
+
+	var handles []*storage.ObjectHandle
+	for len(srcs) > 0 {
+		n := maxComposeSources - len(handles)
+		if n > len(srcs) {
+			n = len(srcs)
+		}
+		for _, src := range srcs[:n] {
+			handles = append(handles, g.objectHandle(src))
+		}
+		srcs = srcs[n:]
+
+		c := g.objectHandle(dst).ComposerFrom(handles...)
+		c.ContentType = first.ContentType
+		c.ContentEncoding = first.ContentEncoding
+		c.Metadata = first.Metadata
+		if _, err := c.Run(ctx); err != nil {
+			var gerr *googleapi.Error
+			if errors.As(err, &gerr) && gerr.Code == http.StatusNotFound {
+				// one of the sources is missing
+				return cloudstorage.ErrObjectNotFound
+			}
+			return err
+		}
+		// the next batch is appended to what was composed so far
+		handles = []*storage.ObjectHandle{g.objectHandle(dst)}
+	}
+	return nil
+}
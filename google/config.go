@@ -0,0 +1,127 @@
+package google
+
+import (
+	"encoding/base64"
+	"time"
+
+	"github.com/lytics/cloudstorage"
+)
+
+// GCSConfig is the typed form of the cloudstorage.Config fields and
+// Settings used by the gcs store.
+type GCSConfig struct {
+	AuthMethod cloudstorage.AuthMethod
+	Bucket     string
+	TmpDir     string
+	// Scope is required for AuthGoogleJWTKeySource.
+	Scope string
+	// JwtConf is required for AuthJWTKeySource.
+	JwtConf *cloudstorage.JwtConf
+	// JwtFile is the key file path used by AuthGoogleJWTKeySource.
+	JwtFile           string
+	EnableCompression bool
+	CompressionCodec  string
+	CompressionLevel  int
+
+	// ImpersonateServiceAccount Settings[ConfKeyImpersonateServiceAccount],
+	// required for AuthImpersonatedSA.
+	ImpersonateServiceAccount string
+	// ChunkSize Settings[ConfKeyChunkSize], nil uses DefaultChunkSize.
+	ChunkSize *int
+	// ChunkRetryDeadline Settings[ConfKeyChunkRetryDeadline] duration string.
+	ChunkRetryDeadline string
+	// EncryptionKey Settings[ConfKeyEncryptionKey] base64 AES-256 key.
+	EncryptionKey string
+	// DownloadThreshold Settings[ConfKeyDownloadThreshold], nil uses
+	// DefaultDownloadThreshold.
+	DownloadThreshold *int
+	// DownloadPartSize Settings[ConfKeyDownloadPartSize], nil uses
+	// DefaultDownloadPartSize.
+	DownloadPartSize *int
+	// DownloadConcurrency Settings[ConfKeyDownloadConcurrency], nil uses
+	// DefaultDownloadConcurrency.
+	DownloadConcurrency *int
+}
+
+// NewGCSConfig converts a generic cloudstorage.Config into a GCSConfig.
+func NewGCSConfig(conf *cloudstorage.Config) *GCSConfig {
+	c := &GCSConfig{
+		AuthMethod:                conf.AuthMethod,
+		Bucket:                    conf.Bucket,
+		TmpDir:                    conf.TmpDir,
+		Scope:                     conf.Scope,
+		JwtConf:                   conf.JwtConf,
+		JwtFile:                   conf.JwtFile,
+		EnableCompression:         conf.EnableCompression,
+		CompressionCodec:          conf.CompressionCodec,
+		CompressionLevel:          conf.CompressionLevel,
+		ImpersonateServiceAccount: conf.Settings.String(ConfKeyImpersonateServiceAccount),
+		ChunkRetryDeadline:        conf.Settings.String(ConfKeyChunkRetryDeadline),
+		EncryptionKey:             conf.Settings.String(ConfKeyEncryptionKey),
+	}
+	if chunkSize, ok := conf.Settings.IntSafe(ConfKeyChunkSize); ok {
+		c.ChunkSize = &chunkSize
+	}
+	if threshold, ok := conf.Settings.IntSafe(ConfKeyDownloadThreshold); ok {
+		c.DownloadThreshold = &threshold
+	}
+	if partSize, ok := conf.Settings.IntSafe(ConfKeyDownloadPartSize); ok {
+		c.DownloadPartSize = &partSize
+	}
+	if concurrency, ok := conf.Settings.IntSafe(ConfKeyDownloadConcurrency); ok {
+		c.DownloadConcurrency = &concurrency
+	}
+	return c
+}
+
+// Validate checks the config returning a *cloudstorage.ConfigError that
+// lists every missing or invalid key.
+func (c *GCSConfig) Validate() error {
+	e := &cloudstorage.ConfigError{Type: StoreType}
+	e.Require("bucket", c.Bucket)
+	e.Require("tmpdir", c.TmpDir)
+	switch c.AuthMethod {
+	case AuthGCEDefaultOAuthToken, AuthGCEMetaKeySource, AuthAnonymous, AuthADC:
+	case AuthJWTKeySource:
+		if c.JwtConf == nil {
+			e.Missing = append(e.Missing, "jwtconf")
+		}
+	case AuthGoogleJWTKeySource:
+		e.Require("jwtfile", c.JwtFile)
+		e.Require("scope", c.Scope)
+	case AuthImpersonatedSA:
+		e.Require("settings."+ConfKeyImpersonateServiceAccount, c.ImpersonateServiceAccount)
+	default:
+		if !cloudstorage.HasAuthProvider(StoreType, c.AuthMethod) {
+			e.Invalidf("bad AuthMethod: %q is not supported or registered", c.AuthMethod)
+		}
+	}
+	if err := cloudstorage.ValidateCompression(c.CompressionCodec, c.CompressionLevel); err != nil {
+		e.Invalidf("%v", err)
+	}
+	if c.ChunkSize != nil && (*c.ChunkSize < 0 || *c.ChunkSize > MaxChunkSize) {
+		e.Invalidf("settings.%s=%d must be between 0 and %d", ConfKeyChunkSize, *c.ChunkSize, MaxChunkSize)
+	}
+	if c.ChunkRetryDeadline != "" {
+		if _, err := time.ParseDuration(c.ChunkRetryDeadline); err != nil {
+			e.Invalidf("settings.%s=%q is not a duration", ConfKeyChunkRetryDeadline, c.ChunkRetryDeadline)
+		}
+	}
+	if c.EncryptionKey != "" {
+		if kb, err := base64.StdEncoding.DecodeString(c.EncryptionKey); err != nil {
+			e.Invalidf("settings.%s is not base64 encoded", ConfKeyEncryptionKey)
+		} else if len(kb) != 32 {
+			e.Invalidf("settings.%s must be a 32 byte AES-256 key, got %d bytes", ConfKeyEncryptionKey, len(kb))
+		}
+	}
+	if c.DownloadThreshold != nil && *c.DownloadThreshold < 0 {
+		e.Invalidf("settings.%s=%d must be >= 0", ConfKeyDownloadThreshold, *c.DownloadThreshold)
+	}
+	if c.DownloadPartSize != nil && *c.DownloadPartSize <= 0 {
+		e.Invalidf("settings.%s=%d must be > 0", ConfKeyDownloadPartSize, *c.DownloadPartSize)
+	}
+	if c.DownloadConcurrency != nil && *c.DownloadConcurrency <= 0 {
+		e.Invalidf("settings.%s=%d must be > 0", ConfKeyDownloadConcurrency, *c.DownloadConcurrency)
+	}
+	return e.Err()
+}
@@ -1,11 +1,19 @@
 package google_test
 
 import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 
 	"cloud.google.com/go/storage"
+	"github.com/araddon/gou"
+	"google.golang.org/api/option"
+
 	"github.com/lytics/cloudstorage"
 	"github.com/lytics/cloudstorage/google"
 	"github.com/lytics/cloudstorage/testutils"
@@ -119,3 +127,130 @@ func TestConfigValidation(t *testing.T) {
 		t.Fatalf("expected an error for a config that points to a non-existent file: config=%+v", config)
 	}
 }
+
+func TestAnonymousClient(t *testing.T) {
+	config := &cloudstorage.Config{
+		Type:       google.StoreType,
+		AuthMethod: google.AuthAnonymous,
+		Bucket:     "gcp-public-data-landsat",
+		TmpDir:     t.TempDir(),
+	}
+	client, err := google.NewGoogleClient(config)
+	if err != nil {
+		t.Fatalf("expected no error for anonymous auth: err=%v", err)
+	}
+	if client.Client() == nil {
+		t.Fatalf("expected an http client for anonymous auth")
+	}
+}
+
+func TestImpersonatedSAConfig(t *testing.T) {
+	config := &cloudstorage.Config{
+		Type:       google.StoreType,
+		AuthMethod: google.AuthImpersonatedSA,
+		Bucket:     "tbd",
+		TmpDir:     t.TempDir(),
+	}
+	_, err := google.NewGoogleClient(config)
+	if err == nil {
+		t.Fatalf("expected an error for a config without a target service account: config=%+v", config)
+	}
+	if !strings.Contains(err.Error(), google.ConfKeyImpersonateServiceAccount) {
+		t.Fatalf("expected error naming %s: err=%v", google.ConfKeyImpersonateServiceAccount, err)
+	}
+}
+
+func TestGCSConfigValidate(t *testing.T) {
+	config := &cloudstorage.Config{
+		Type:       google.StoreType,
+		AuthMethod: google.AuthGoogleJWTKeySource,
+		Settings:   gou.JsonHelper{google.ConfKeyChunkRetryDeadline: "soon"},
+	}
+	err := google.NewGCSConfig(config).Validate()
+	cerr, ok := err.(*cloudstorage.ConfigError)
+	if !ok {
+		t.Fatalf("expected a ConfigError: err=%v", err)
+	}
+	if strings.Join(cerr.Missing, ",") != "bucket,tmpdir,jwtfile,scope" || len(cerr.Invalid) != 1 {
+		t.Fatalf("unexpected validation result: %v", err)
+	}
+
+	config.Settings[google.ConfKeyDownloadConcurrency] = 0
+	err = google.NewGCSConfig(config).Validate()
+	if cerr, ok := err.(*cloudstorage.ConfigError); !ok || len(cerr.Invalid) != 2 {
+		t.Fatalf("expected download_concurrency to be invalid: err=%v", err)
+	}
+}
+
+func TestEncryptionKeyOpts(t *testing.T) {
+	const object = `{"name":"a.csv","bucket":"keys","size":"3","updated":"2024-01-02T03:04:05Z"}`
+	var mu sync.Mutex
+	keys := make(map[string]http.Header)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		keys[r.Method+" "+r.URL.Path] = r.Header.Clone()
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.Contains(r.URL.Path, "/rewriteTo/"):
+			w.Write([]byte(`{"kind":"storage#rewriteResponse","done":true,"totalBytesRewritten":"3","objectSize":"3","resource":` + object + `}`))
+		case strings.HasSuffix(r.URL.Path, "/o/a.csv"):
+			w.Write([]byte(object))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"code":404,"message":"No such object"}}`))
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx, option.WithEndpoint(srv.URL+"/storage/v1/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("could not create client: %v", err)
+	}
+	store, err := google.NewGCSStore(client, "keys", t.TempDir(), false, 100)
+	if err != nil {
+		t.Fatalf("could not create store: %v", err)
+	}
+	key := []byte(strings.Repeat("k", 32))
+	encoded := base64.StdEncoding.EncodeToString(key)
+	opts := cloudstorage.Opts{EncryptionKey: key}
+
+	src, err := cloudstorage.GetWithOpts(ctx, store, "a.csv", opts)
+	if err != nil {
+		t.Fatalf("GetWithOpts: %v", err)
+	}
+	if got := keys["GET /storage/v1/b/keys/o/a.csv"].Get("X-Goog-Encryption-Key"); got != encoded {
+		t.Fatalf("expected the key to get the object, got %q", got)
+	}
+	des, err := store.NewObject("b.csv")
+	if err != nil {
+		t.Fatalf("NewObject: %v", err)
+	}
+
+	// the server side copy decrypts and encrypts with the key
+	if err := cloudstorage.Copy(ctx, store, src, des, opts); err != nil {
+		t.Fatalf("Copy: %v", err)
+	}
+	h := keys["POST /storage/v1/b/keys/o/a.csv/rewriteTo/b/keys/o/b.csv"]
+	if h == nil {
+		t.Fatalf("expected a rewrite request, got %v", keys)
+	}
+	if h.Get("X-Goog-Copy-Source-Encryption-Key") != encoded || h.Get("X-Goog-Encryption-Key") != encoded {
+		t.Fatalf("expected the key on both objects of the copy, got %v", h)
+	}
+
+	// as does a copy of the objects, which keep the key they were got with
+	delete(keys, "POST /storage/v1/b/keys/o/a.csv/rewriteTo/b/keys/o/b.csv")
+	if err := store.Copy(ctx, src, des); err != nil {
+		t.Fatalf("Copy: %v", err)
+	}
+	h = keys["POST /storage/v1/b/keys/o/a.csv/rewriteTo/b/keys/o/b.csv"]
+	if h.Get("X-Goog-Copy-Source-Encryption-Key") != encoded || h.Get("X-Goog-Encryption-Key") != "" {
+		t.Fatalf("expected the key of the source only, got %v", h)
+	}
+
+	if err := cloudstorage.Copy(ctx, store, src, des, cloudstorage.Opts{EncryptionKey: []byte("short")}); err == nil {
+		t.Fatalf("expected an error for a key that isn't 32 bytes")
+	}
+}
@@ -0,0 +1,96 @@
+package google
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
+
+	"github.com/lytics/cloudstorage"
+)
+
+var _ cloudstorage.StoreLeaser = (*GcsFS)(nil)
+
+// lease is held by a lock object, the generation of our write is the
+// precondition for renewing and releasing it.
+type lease struct {
+	obj *storage.ObjectHandle
+	id  string
+	ttl time.Duration
+
+	mu         sync.Mutex
+	generation int64
+}
+
+// AcquireLease claims name by creating the lock object name+LeaseSuffix
+// with a DoesNotExist precondition, an expired lock left by another owner
+// is deleted (matching its generation) and replaced.
+func (g *GcsFS) AcquireLease(ctx context.Context, name string, ttl time.Duration) (cloudstorage.Lease, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("invalid lease ttl %v", ttl)
+	}
+	l := &lease{obj: g.gcsb().Object(name + cloudstorage.LeaseSuffix), id: cloudstorage.NewLeaseID(), ttl: ttl}
+	for try := 0; try < 2; try++ {
+		wc := l.obj.If(storage.Conditions{DoesNotExist: true}).NewWriter(ctx)
+		wc.Metadata = cloudstorage.LeaseMetaData(l.id, time.Now().Add(ttl))
+		err := wc.Close()
+		if err == nil {
+			l.generation = wc.Attrs().Generation
+			return l, nil
+		} else if !preconditionFailed(err) {
+			return nil, err
+		}
+
+		attrs, err := l.obj.Attrs(ctx)
+		if err == storage.ErrObjectNotExist {
+			// released in between, try again
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if !cloudstorage.LeaseExpired(attrs.Metadata, time.Now()) {
+			return nil, cloudstorage.ErrLeaseHeld
+		}
+		err = l.obj.If(storage.Conditions{GenerationMatch: attrs.Generation}).Delete(ctx)
+		if err != nil && err != storage.ErrObjectNotExist && !preconditionFailed(err) {
+			return nil, err
+		}
+	}
+	return nil, cloudstorage.ErrLeaseHeld
+}
+
+func (l *lease) ID() string { return l.id }
+
+// Renew updates the lock's expiry if it is still our generation.
+func (l *lease) Renew(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := l.obj.If(storage.Conditions{GenerationMatch: l.generation}).Update(ctx, storage.ObjectAttrsToUpdate{
+		Metadata: cloudstorage.LeaseMetaData(l.id, time.Now().Add(l.ttl)),
+	})
+	if err == storage.ErrObjectNotExist || preconditionFailed(err) {
+		return cloudstorage.ErrLeaseLost
+	}
+	return err
+}
+
+// Release deletes the lock if it is still our generation.
+func (l *lease) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err := l.obj.If(storage.Conditions{GenerationMatch: l.generation}).Delete(ctx)
+	if err == storage.ErrObjectNotExist || preconditionFailed(err) {
+		return cloudstorage.ErrLeaseLost
+	}
+	return err
+}
+
+func preconditionFailed(err error) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && gerr.Code == http.StatusPreconditionFailed
+}
@@ -0,0 +1,22 @@
+package google
+
+import (
+	"time"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+var _ cloudstorage.StoreSigner = (*GcsFS)(nil)
+
+// SignedURL signs a V4 url of the object, the signing service account is
+// detected from the client's credentials.
+func (g *GcsFS) SignedURL(ctx context.Context, name, method string, expires time.Duration) (string, error) {
+	return g.gcsb().SignedURL(name, &storage.SignedURLOptions{
+		Method:  method,
+		Expires: time.Now().Add(expires),
+		Scheme:  storage.SigningSchemeV4,
+	})
+}
@@ -2,19 +2,23 @@ package google
 
 import (
 	"bufio"
-	"compress/gzip"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/storage"
 	"github.com/araddon/gou"
 	"github.com/pborman/uuid"
 	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 
 	"github.com/lytics/cloudstorage"
@@ -22,8 +26,12 @@ import (
 
 func init() {
 	cloudstorage.Register(StoreType, provider)
+	cloudstorage.AcceptAuthProviders(StoreType)
 }
 func provider(conf *cloudstorage.Config) (cloudstorage.Store, error) {
+	if err := NewGCSConfig(conf).Validate(); err != nil {
+		return nil, err
+	}
 	googleclient, err := NewGoogleClient(conf)
 	if err != nil {
 		return nil, err
@@ -31,16 +39,64 @@ func provider(conf *cloudstorage.Config) (cloudstorage.Store, error) {
 	return gcsCommonClient(googleclient.Client(), conf)
 }
 
-// StoreType = "gcs"
-const StoreType = "gcs"
+const (
+	// StoreType = "gcs"
+	StoreType = "gcs"
+
+	// Configuration Keys.  These are the names of keys
+	// to look for in the json map[string]string to extract for config.
+
+	// ConfKeyChunkSize config key name of the upload chunk size in bytes.
+	// Every open writer buffers up to this many bytes in memory, 0 disables
+	// chunking so objects are uploaded in a single request.
+	ConfKeyChunkSize = "chunk_size"
+	// ConfKeyChunkRetryDeadline config key name of the per-chunk retry
+	// deadline, a duration string such as "30s".
+	ConfKeyChunkRetryDeadline = "chunk_retry_deadline"
+	// ConfKeyEncryptionKey config key name of the base64 encoded
+	// customer-supplied AES-256 encryption key (CSEK) used for all objects.
+	ConfKeyEncryptionKey = "encryption_key"
+	// ConfKeyDownloadThreshold config key name of the object size in bytes
+	// from which Open downloads in parallel ranged parts, 0 disables it.
+	ConfKeyDownloadThreshold = "download_threshold"
+	// ConfKeyDownloadPartSize config key name of the size in bytes of each
+	// ranged part, every worker buffers a part in memory.
+	ConfKeyDownloadPartSize = "download_part_size"
+	// ConfKeyDownloadConcurrency config key name of the number of parts
+	// downloaded at once.
+	ConfKeyDownloadConcurrency = "download_concurrency"
+
+	// DefaultChunkSize is the default upload chunk size (16MB) used by the
+	// google storage client.
+	DefaultChunkSize = 16 * 1024 * 1024
+	// MaxChunkSize is the largest upload chunk size allowed, this bounds the
+	// memory used per concurrent writer.
+	MaxChunkSize = 256 * 1024 * 1024
+
+	// DefaultDownloadThreshold objects of at least this size (64MB) are
+	// downloaded by Open in parallel ranged parts.
+	DefaultDownloadThreshold = 64 * 1024 * 1024
+	// DefaultDownloadPartSize is the default ranged part size (8MB).
+	DefaultDownloadPartSize = 8 * 1024 * 1024
+	// DefaultDownloadConcurrency is the default number of parts downloaded
+	// at once.
+	DefaultDownloadConcurrency = 5
+)
 
 var (
 	// GCSRetries number of times to retry for GCS.
 	GCSRetries int = 55
+	// GCSBackoff delays between the retries of GCS requests, see
+	// cloudstorage.BackoffProfile.
+	GCSBackoff = cloudstorage.BackoffProfile{Base: time.Second, Max: 32 * time.Second, MaxElapsed: 5 * time.Minute}
 
 	// Ensure we implement ObjectIterator
-	_               cloudstorage.ObjectIterator = (*objectIterator)(nil)
-	compressionMime                             = "gzip"
+	_ cloudstorage.ObjectIterator = (*objectIterator)(nil)
+	_ cloudstorage.FolderIterator = (*folderIterator)(nil)
+	// and the optional copier/mover
+	_               cloudstorage.StoreCopy = (*GcsFS)(nil)
+	_               cloudstorage.StoreMove = (*GcsFS)(nil)
+	compressionMime                        = "gzip"
 )
 
 // GcsFS Simple wrapper for accessing smaller GCS files, it doesn't currently implement a
@@ -52,6 +108,29 @@ type GcsFS struct {
 	PageSize          int
 	Id                string
 	enableCompression bool
+	// ChunkSize is the upload chunk size used by writers, each writer buffers
+	// up to ChunkSize bytes in memory.  0 uploads objects in a single request.
+	ChunkSize int
+	// ChunkRetryDeadline is the per-chunk retry deadline for uploads, 0 uses
+	// the google storage client default.
+	ChunkRetryDeadline time.Duration
+	// EncryptionKey is a customer-supplied AES-256 key (32 bytes) used to
+	// encrypt/decrypt objects.  nil uses google managed encryption.
+	EncryptionKey []byte
+	// DownloadThreshold objects of at least this size, that aren't gzip
+	// encoded, are downloaded in DownloadPartSize ranged parts,
+	// DownloadConcurrency at a time.  0 always uses a single reader.
+	DownloadThreshold   int64
+	DownloadPartSize    int64
+	DownloadConcurrency int
+	// CompressionCodec (cloudstorage.CodecGzip, CodecZstd or CodecSnappy)
+	// and CompressionLevel (0 is the codec default) of objects written with
+	// compression enabled.  "" is gzip.
+	CompressionCodec string
+	CompressionLevel int
+	// Timeouts of List, Folders, Get, readers, writers and Delete when the
+	// caller's context has no deadline, see cloudstorage.Config.ListTimeout.
+	Timeouts cloudstorage.Timeouts
 }
 
 // NewGCSStore Create Google Cloud Storage Store.
@@ -63,6 +142,10 @@ func NewGCSStore(gcs *storage.Client, bucket, cachepath string, enableCompressio
 
 	uid := uuid.NewUUID().String()
 	uid = strings.Replace(uid, "-", "", -1)
+	cachepath, err = cloudstorage.CacheDir(cachepath, uid)
+	if err != nil {
+		return nil, err
+	}
 
 	return &GcsFS{
 		gcs:               gcs,
@@ -71,14 +154,117 @@ func NewGCSStore(gcs *storage.Client, bucket, cachepath string, enableCompressio
 		Id:                uid,
 		PageSize:          pagesize,
 		enableCompression: enableCompression,
+		ChunkSize:         DefaultChunkSize,
+
+		DownloadThreshold:   DefaultDownloadThreshold,
+		DownloadPartSize:    DefaultDownloadPartSize,
+		DownloadConcurrency: DefaultDownloadConcurrency,
 	}, nil
 }
 
+// checkEncryptionKey validates the Opts.EncryptionKey of opts.
+func checkEncryptionKey(opts []cloudstorage.Opts) error {
+	if len(opts) > 0 && len(opts[0].EncryptionKey) > 0 && len(opts[0].EncryptionKey) != 32 {
+		return fmt.Errorf("invalid encryption key, expected 32 bytes got %d", len(opts[0].EncryptionKey))
+	}
+	return nil
+}
+
+// objectHandle returns the handle for the named object with the customer
+// supplied encryption key applied, Opts.EncryptionKey overrides the store key.
+func (g *GcsFS) objectHandle(name string, opts ...cloudstorage.Opts) *storage.ObjectHandle {
+	oh := g.gcsb().Object(name)
+	key := g.EncryptionKey
+	if len(opts) > 0 && len(opts[0].EncryptionKey) > 0 {
+		key = opts[0].EncryptionKey
+	}
+	if len(key) > 0 {
+		oh = oh.Key(key)
+	}
+	return oh
+}
+
+// newWriter creates a storage.Writer for the object handle applying the
+// store's chunking settings, overridden by opts, and the custom time and
+// holds of opts.
+func (g *GcsFS) newWriter(ctx context.Context, oh *storage.ObjectHandle, opts ...cloudstorage.Opts) *storage.Writer {
+	wc := oh.NewWriter(ctx)
+	wc.ChunkSize = g.ChunkSize
+	if g.ChunkRetryDeadline > 0 {
+		wc.ChunkRetryDeadline = g.ChunkRetryDeadline
+	}
+	if len(opts) > 0 {
+		if opts[0].ChunkSize > 0 {
+			wc.ChunkSize = opts[0].ChunkSize
+		} else if opts[0].ChunkSize < 0 {
+			wc.ChunkSize = 0
+		}
+		if opts[0].ChunkRetryDeadline > 0 {
+			wc.ChunkRetryDeadline = opts[0].ChunkRetryDeadline
+		}
+		wc.CustomTime = opts[0].CustomTime
+		wc.TemporaryHold = opts[0].TemporaryHold
+		wc.EventBasedHold = opts[0].EventBasedHold
+	}
+	return wc
+}
+
 // Type of store = "gcs"
 func (g *GcsFS) Type() string {
 	return StoreType
 }
 
+// CleanCache removes stale cache files from the store's TmpDir, see
+// cloudstorage.CleanCache.
+func (g *GcsFS) CleanCache(ctx context.Context, olderThan time.Duration) error {
+	return cloudstorage.CleanCache(ctx, g.cachepath, olderThan)
+}
+
+// CachePath is the cache directory of the store below its TmpDir.
+func (g *GcsFS) CachePath() string {
+	return g.cachepath
+}
+
+// UpdatedGranularity of gcs, updated times have milliseconds.
+func (g *GcsFS) UpdatedGranularity() time.Duration {
+	return time.Millisecond
+}
+
+// Capabilities of gcs, deletes may take a while to show in listings.
+func (g *GcsFS) Capabilities() cloudstorage.Capabilities {
+	return cloudstorage.Capabilities{
+		ETags:            true,
+		IfNotExists:      true,
+		Compression:      true,
+		Concurrent:       true,
+		ConsistencyDelay: 15 * time.Second,
+	}
+}
+
+// IsTransient is true for gcs errors worth retrying: rate limits, server
+// errors and network errors, not the 4xx of a denied permission or a
+// missing bucket.
+func (g *GcsFS) IsTransient(err error) bool {
+	return isTransient(err)
+}
+
+func isTransient(err error) bool {
+	if !cloudstorage.DefaultIsTransient(err) || errors.Is(err, storage.ErrBucketNotExist) ||
+		errors.Is(err, storage.ErrObjectNotExist) {
+		return false
+	}
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		return cloudstorage.IsTransientStatus(gerr.Code)
+	}
+	return true
+}
+
+// BackoffProfile of gcs is GCSBackoff.
+func (g *GcsFS) BackoffProfile() cloudstorage.BackoffProfile {
+	return GCSBackoff
+}
+
 // Client gets access to the underlying google cloud storage client.
 func (g *GcsFS) Client() interface{} {
 	return g.gcs
@@ -98,17 +284,27 @@ func (o *object) DisableCompression() {
 }
 
 // NewObject of Type GCS.
-func (g *GcsFS) NewObject(objectname string) (cloudstorage.Object, error) {
-	obj, err := g.Get(context.Background(), objectname)
+func (g *GcsFS) NewObject(objectname string, opts ...cloudstorage.Opts) (cloudstorage.Object, error) {
+	if len(opts) > 0 && opts[0].WriteThrough {
+		return cloudstorage.NewWriteThroughObject(g, objectname, opts[0])
+	}
+	obj, err := g.GetWithOpts(context.Background(), objectname, opts...)
 	if err != nil && err != cloudstorage.ErrObjectNotFound {
 		return nil, err
 	} else if obj != nil {
+		if len(opts) > 0 && opts[0].Overwrite {
+			if opts[0].Stream {
+				return cloudstorage.NewStreamObject(g, obj, opts[0]), nil
+			}
+			return obj, nil
+		}
 		return nil, cloudstorage.ErrObjectExists
 	}
 
 	cf := cloudstorage.CachePathObj(g.cachepath, objectname, g.Id)
 
-	return &object{
+	o := &object{
+		fs:                g,
 		name:              objectname,
 		metadata:          map[string]string{cloudstorage.ContentTypeKey: cloudstorage.ContentType(objectname)},
 		gcsb:              g.gcsb(),
@@ -116,13 +312,28 @@ func (g *GcsFS) NewObject(objectname string) (cloudstorage.Object, error) {
 		cachedcopy:        nil,
 		cachepath:         cf,
 		enableCompression: g.enableCompression,
-	}, nil
+	}
+	if len(opts) > 0 {
+		o.key = opts[0].EncryptionKey
+	}
+	return o, nil
 }
 
 // Get Gets a single File Object
 func (g *GcsFS) Get(ctx context.Context, objectpath string) (cloudstorage.Object, error) {
+	return g.GetWithOpts(ctx, objectpath)
+}
+
+// GetWithOpts gets a single File Object with the Opts.EncryptionKey of
+// opts, which the object keeps using when opened.
+func (g *GcsFS) GetWithOpts(ctx context.Context, objectpath string, opts ...cloudstorage.Opts) (cloudstorage.Object, error) {
+	if err := checkEncryptionKey(opts); err != nil {
+		return nil, err
+	}
+	ctx, cancel := cloudstorage.WithTimeout(ctx, g.Timeouts.Read)
+	defer cancel()
 
-	gobj, err := g.gcsb().Object(objectpath).Attrs(context.Background()) // .Objects(context.Background(), q)
+	gobj, err := g.objectHandle(objectpath, opts...).Attrs(ctx)
 	if err != nil {
 		if strings.Contains(err.Error(), "doesn't exist") {
 			return nil, cloudstorage.ErrObjectNotFound
@@ -134,62 +345,97 @@ func (g *GcsFS) Get(ctx context.Context, objectpath string) (cloudstorage.Object
 		return nil, cloudstorage.ErrObjectNotFound
 	}
 
-	return newObject(g, gobj), nil
+	o := newObject(g, gobj)
+	if len(opts) > 0 {
+		o.key = opts[0].EncryptionKey
+	}
+	return o, nil
 }
 
 // Objects returns an iterator over the objects in the google bucket that match the Query q.
 // If q is nil, no filtering is done.
 func (g *GcsFS) Objects(ctx context.Context, csq cloudstorage.Query) (cloudstorage.ObjectIterator, error) {
-	var q = &storage.Query{Prefix: csq.Prefix}
+	var q = &storage.Query{Prefix: csq.Prefix, Delimiter: csq.Delimiter}
 	if csq.StartOffset != "" {
 		q.StartOffset = csq.StartOffset
 	}
 	if csq.EndOffset != "" {
 		q.EndOffset = csq.EndOffset
 	}
+	if csq.Lean {
+		attrs := leanAttrs
+		if len(csq.TagFilter) > 0 {
+			attrs = append([]string{"Metadata"}, attrs...)
+		}
+		if err := q.SetAttrSelection(attrs); err != nil {
+			return nil, err
+		}
+	}
 	iter := g.gcsb().Objects(ctx, q)
-	return &objectIterator{g, ctx, iter}, nil
+	if csq.PageSize > 0 {
+		iter.PageInfo().MaxSize = csq.PageSize
+	}
+	return &objectIterator{g: g, ctx: ctx, iter: iter, q: csq}, nil
 }
 
+// leanAttrs are the attributes of lean listings.
+var leanAttrs = []string{"Name", "Prefix", "Size", "Updated", "Etag", "MD5", "CRC32C"}
+
 // List returns an iterator over the objects in the google bucket that match the Query q.
 // If q is nil, no filtering is done.
 func (g *GcsFS) List(ctx context.Context, csq cloudstorage.Query) (*cloudstorage.ObjectsResponse, error) {
+	ctx, cancel := cloudstorage.WithTimeout(ctx, g.Timeouts.List)
+	defer cancel()
+	// the page is returned whole, its objects belong to the caller
+	csq.Reuse = false
 	iter, err := g.Objects(ctx, csq)
 	if err != nil {
 		return nil, err
 	}
-	return cloudstorage.ObjectResponseFromIter(iter)
+	resp, err := cloudstorage.ObjectResponseFromIter(iter)
+	if err != nil {
+		return nil, err
+	}
+	resp.Prefixes = iter.(*objectIterator).prefixes
+	return resp, nil
 }
 
 // Folders get folders list.
 func (g *GcsFS) Folders(ctx context.Context, csq cloudstorage.Query) ([]string, error) {
+	ctx, cancel := cloudstorage.WithTimeout(ctx, g.Timeouts.List)
+	defer cancel()
+	iter, err := g.FolderIterator(ctx, csq)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+	return cloudstorage.FoldersAll(iter)
+}
+
+// FolderIterator returns an iterator over the folders below the Query prefix.
+func (g *GcsFS) FolderIterator(ctx context.Context, csq cloudstorage.Query) (cloudstorage.FolderIterator, error) {
+	if csq.Delimiter == "" {
+		csq.Delimiter = "/"
+	}
 	var q = &storage.Query{Delimiter: csq.Delimiter, Prefix: csq.Prefix}
-	iter := g.gcsb().Objects(ctx, q)
-	folders := make([]string, 0)
-	for {
-		select {
-		case <-ctx.Done():
-			// If has been closed
-			return folders, ctx.Err()
-		default:
-			o, err := iter.Next()
-			if err == nil {
-				if o.Prefix != "" {
-					folders = append(folders, o.Prefix)
-				}
-			} else if err == iterator.Done {
-				return folders, nil
-			} else if err == context.Canceled || err == context.DeadlineExceeded {
-				// Return to user
-				return nil, err
-			}
-		}
+	if err := q.SetAttrSelection([]string{"Prefix"}); err != nil {
+		return nil, err
 	}
+	iter := g.gcsb().Objects(ctx, q)
+	return &folderIterator{ctx: ctx, iter: iter}, nil
 }
 
 // Copy from src to destination
 func (g *GcsFS) Copy(ctx context.Context, src, des cloudstorage.Object) error {
+	return g.CopyWithOpts(ctx, src, des)
+}
 
+// CopyWithOpts copies src to des, the Opts.EncryptionKey of opts decrypts
+// src and encrypts des, otherwise each object's own key is used.
+func (g *GcsFS) CopyWithOpts(ctx context.Context, src, des cloudstorage.Object, opts ...cloudstorage.Opts) error {
+	if err := checkEncryptionKey(opts); err != nil {
+		return err
+	}
 	srcgcs, ok := src.(*object)
 	if !ok {
 		return fmt.Errorf("Copy source file expected GCS but got %T", src)
@@ -199,8 +445,8 @@ func (g *GcsFS) Copy(ctx context.Context, src, des cloudstorage.Object) error {
 		return fmt.Errorf("Copy destination expected GCS but got %T", des)
 	}
 
-	oh := srcgcs.gcsb.Object(srcgcs.name)
-	dh := desgcs.gcsb.Object(desgcs.name)
+	oh := srcgcs.handle(opts...)
+	dh := desgcs.handle(opts...)
 
 	_, err := dh.CopierFrom(oh).Run(ctx)
 	return err
@@ -208,7 +454,14 @@ func (g *GcsFS) Copy(ctx context.Context, src, des cloudstorage.Object) error {
 
 // Move which is a Copy & Delete
 func (g *GcsFS) Move(ctx context.Context, src, des cloudstorage.Object) error {
+	return g.MoveWithOpts(ctx, src, des)
+}
 
+// MoveWithOpts moves src to des with the keys of CopyWithOpts.
+func (g *GcsFS) MoveWithOpts(ctx context.Context, src, des cloudstorage.Object, opts ...cloudstorage.Opts) error {
+	if err := checkEncryptionKey(opts); err != nil {
+		return err
+	}
 	srcgcs, ok := src.(*object)
 	if !ok {
 		return fmt.Errorf("Move source file expected GCS but got %T", src)
@@ -218,8 +471,8 @@ func (g *GcsFS) Move(ctx context.Context, src, des cloudstorage.Object) error {
 		return fmt.Errorf("Move destination expected GCS but got %T", des)
 	}
 
-	oh := srcgcs.gcsb.Object(srcgcs.name)
-	dh := desgcs.gcsb.Object(desgcs.name)
+	oh := srcgcs.handle(opts...)
+	dh := desgcs.handle(opts...)
 
 	if _, err := dh.CopierFrom(oh).Run(ctx); err != nil {
 		return err
@@ -235,29 +488,75 @@ func (g *GcsFS) NewReader(o string) (io.ReadCloser, error) {
 
 // NewReaderWithContext create new GCS File reader with context.
 func (g *GcsFS) NewReaderWithContext(ctx context.Context, o string) (io.ReadCloser, error) {
-	obj := g.gcsb().Object(o).ReadCompressed(true)
+	return g.NewReaderWithOpts(ctx, o)
+}
+
+// NewReaderWithOpts create new GCS File reader honoring Opts.EncryptionKey
+// and IfNoneMatch.
+func (g *GcsFS) NewReaderWithOpts(ctx context.Context, o string, opts ...cloudstorage.Opts) (io.ReadCloser, error) {
+	ctx, cancel := cloudstorage.WithTimeout(ctx, g.Timeouts.Read)
+	rc, err := g.newReader(ctx, o, opts...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return cloudstorage.NewCancelReader(rc, cancel), nil
+}
+
+var _ cloudstorage.StoreRangeReader = (*GcsFS)(nil)
+
+// NewRangeReader reads length bytes of object o from offset, to the end if
+// length is negative.  Objects stored compressed can't be read in ranges.
+func (g *GcsFS) NewRangeReader(ctx context.Context, o string, offset, length int64) (io.ReadCloser, error) {
+	ctx, cancel := cloudstorage.WithTimeout(ctx, g.Timeouts.Read)
+	rc, err := g.objectHandle(o).ReadCompressed(true).NewRangeReader(ctx, offset, length)
+	if err != nil {
+		cancel()
+		if err == storage.ErrObjectNotExist {
+			return nil, cloudstorage.ErrObjectNotFound
+		}
+		return nil, err
+	}
+	if decompress(&storage.ObjectAttrs{ContentEncoding: rc.Attrs.ContentEncoding, ContentType: rc.Attrs.ContentType}) {
+		rc.Close()
+		cancel()
+		return nil, fmt.Errorf("%w: range reads of compressed object %s", cloudstorage.ErrNotImplemented, o)
+	}
+	return cloudstorage.NewCancelReader(rc, cancel), nil
+}
+
+func (g *GcsFS) newReader(ctx context.Context, o string, opts ...cloudstorage.Opts) (io.ReadCloser, error) {
+	if err := checkEncryptionKey(opts); err != nil {
+		return nil, err
+	}
+	obj := g.objectHandle(o, opts...).ReadCompressed(true)
 	attrs, err := obj.Attrs(ctx)
 	if err == storage.ErrObjectNotExist {
 		return nil, cloudstorage.ErrObjectNotFound
 	} else if err != nil {
 		return nil, err
 	}
-	// we check ContentType here because files uploaded compressed without an
-	// explicit ContentType set get autodetected as "application/x-gzip" instead
-	// of "application/octet-stream", but files with the gzip ContentType get
-	// auto-decompressed regardless of your Accept-Encoding header
-	if attrs.ContentEncoding == compressionMime && attrs.ContentType != "application/x-gzip" {
+	if len(opts) > 0 && opts[0].IfNoneMatch != "" {
+		tag := cloudstorage.CleanETag(opts[0].IfNoneMatch)
+		if tag == attrs.Etag || tag == strconv.FormatInt(attrs.Generation, 10) {
+			return nil, cloudstorage.ErrNotModified
+		}
+		// read the generation compared, not a newer one
+		obj = obj.Generation(attrs.Generation)
+	}
+	if decompress(attrs) {
 		rc, err := obj.NewReader(ctx)
 		if err == storage.ErrObjectNotExist {
 			return nil, cloudstorage.ErrObjectNotFound
 		} else if err != nil {
 			return nil, err
 		}
-		gr, err := gzip.NewReader(rc)
+		dr, err := cloudstorage.NewDecompressReader(rc, attrs.ContentEncoding)
 		if err != nil {
+			rc.Close()
 			return nil, err
 		}
-		return gr, err
+		return &decompressReadCloser{ReadCloser: dr, rc: rc}, nil
 	}
 
 	rc, err := obj.NewReader(ctx)
@@ -272,25 +571,66 @@ func (g *GcsFS) NewWriter(o string, metadata map[string]string) (io.WriteCloser,
 	return g.NewWriterWithContext(context.Background(), o, metadata)
 }
 
-type gzipWriteCloser struct {
+// decompress is true for objects stored compressed by a codec the store
+// decompresses on read.  We check ContentType here because files uploaded
+// compressed without an explicit ContentType set get autodetected as
+// "application/x-gzip" instead of "application/octet-stream", but files with
+// the gzip ContentType get auto-decompressed regardless of your
+// Accept-Encoding header.
+func decompress(attrs *storage.ObjectAttrs) bool {
+	if attrs.ContentEncoding == compressionMime {
+		return attrs.ContentType != "application/x-gzip"
+	}
+	return cloudstorage.IsCompressed(attrs.ContentEncoding)
+}
+
+// decompressReadCloser closes both the decompressing reader and the object
+// reader it reads.
+type decompressReadCloser struct {
+	io.ReadCloser
+	rc io.Closer
+}
+
+func (d *decompressReadCloser) Close() error {
+	err := d.ReadCloser.Close()
+	if cerr := d.rc.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// codec of the objects the store writes compressed.
+func (g *GcsFS) codec() string {
+	if g.CompressionCodec == "" {
+		return cloudstorage.CodecGzip
+	}
+	return g.CompressionCodec
+}
+
+type compressWriteCloser struct {
 	ctx context.Context
 	w   io.WriteCloser
 	c   io.Closer
 }
 
-// newGZIPWriteCloser is a io.WriteCloser that closes both the gzip writer and also the passed in writer
-func newGZIPWriteCloser(ctx context.Context, rc io.WriteCloser) io.WriteCloser {
-	return &gzipWriteCloser{ctx, gzip.NewWriter(rc), rc}
+// newCompressWriteCloser is a io.WriteCloser that closes both the compression
+// writer of the store's codec and also the passed in writer
+func (g *GcsFS) newCompressWriteCloser(ctx context.Context, rc io.WriteCloser) (io.WriteCloser, error) {
+	cw, err := cloudstorage.NewCompressWriter(rc, g.codec(), g.CompressionLevel)
+	if err != nil {
+		return nil, err
+	}
+	return &compressWriteCloser{ctx, cw, rc}, nil
 }
 
-func (b *gzipWriteCloser) Write(p []byte) (int, error) {
+func (b *compressWriteCloser) Write(p []byte) (int, error) {
 	if err := b.ctx.Err(); err != nil {
 		return 0, err
 	}
 	return b.w.Write(p)
 }
 
-func (b *gzipWriteCloser) Close() error {
+func (b *compressWriteCloser) Close() error {
 	if err := b.ctx.Err(); err != nil {
 		return err
 	}
@@ -302,7 +642,32 @@ func (b *gzipWriteCloser) Close() error {
 
 // NewWriterWithContext create writer with provided context and metadata.
 func (g *GcsFS) NewWriterWithContext(ctx context.Context, o string, metadata map[string]string, opts ...cloudstorage.Opts) (io.WriteCloser, error) {
-	obj := g.gcsb().Object(o)
+	ctx, cancel := cloudstorage.WithTimeout(ctx, g.Timeouts.Write)
+	wc, sw, err := g.newObjectWriter(ctx, o, metadata, opts...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return cloudstorage.NewResultWriter(cloudstorage.NewCancelWriter(wc, cancel), func(r *cloudstorage.UploadResult) error {
+		if attrs := sw.Attrs(); attrs != nil {
+			r.ETag = attrs.Etag
+			r.VersionID = strconv.FormatInt(attrs.Generation, 10)
+		}
+		return nil
+	}), nil
+}
+
+// newObjectWriter returns the writer of object o, and the storage.Writer it
+// writes to.
+func (g *GcsFS) newObjectWriter(ctx context.Context, o string, metadata map[string]string, opts ...cloudstorage.Opts) (io.WriteCloser, *storage.Writer, error) {
+	if err := checkEncryptionKey(opts); err != nil {
+		return nil, nil, err
+	}
+	metadata, err := cloudstorage.NormalizeMetadata(metadata)
+	if err != nil {
+		return nil, nil, err
+	}
+	obj := g.objectHandle(o, opts...)
 	disableCompression := false
 	if len(opts) > 0 {
 		if opts[0].DisableCompression {
@@ -312,7 +677,7 @@ func (g *GcsFS) NewWriterWithContext(ctx context.Context, o string, metadata map
 			obj = obj.If(storage.Conditions{DoesNotExist: true})
 		}
 	}
-	wc := obj.NewWriter(ctx)
+	wc := g.newWriter(ctx, obj, opts...)
 	if metadata != nil {
 		wc.Metadata = metadata
 		//contenttype is only used for viewing the file in a browser. (i.e. the GCS Object browser).
@@ -320,15 +685,52 @@ func (g *GcsFS) NewWriterWithContext(ctx context.Context, o string, metadata map
 		wc.ContentType = ctype
 	}
 	if g.enableCompression && !disableCompression {
-		wc.ContentEncoding = compressionMime
-		return newGZIPWriteCloser(ctx, wc), nil
+		wc.ContentEncoding = g.codec()
+		cw, err := g.newCompressWriteCloser(ctx, wc)
+		return cw, wc, err
 	}
-	return wc, nil
+	return wc, wc, nil
 }
 
 // Delete requested object path string.
-func (g *GcsFS) Delete(ctx context.Context, obj string) error {
-	err := g.gcsb().Object(obj).Delete(ctx)
+func (g *GcsFS) Delete(ctx context.Context, obj string, opts ...cloudstorage.Opts) error {
+	ctx, cancel := cloudstorage.WithTimeout(ctx, g.Timeouts.Write)
+	defer cancel()
+	oh := g.gcsb().Object(obj)
+	if len(opts) > 0 && (opts[0].IfMatch != "" || opts[0].VersionID != "") {
+		var gen int64
+		if opts[0].VersionID != "" {
+			var err error
+			if gen, err = strconv.ParseInt(opts[0].VersionID, 10, 64); err != nil {
+				return fmt.Errorf("invalid gcs generation %q", opts[0].VersionID)
+			}
+		}
+		if opts[0].IfMatch != "" {
+			attrs, err := oh.Attrs(ctx)
+			if err == storage.ErrObjectNotExist {
+				return cloudstorage.ErrObjectNotFound
+			} else if err != nil {
+				return err
+			}
+			tag := cloudstorage.CleanETag(opts[0].IfMatch)
+			if tag != attrs.Etag && tag != strconv.FormatInt(attrs.Generation, 10) {
+				return cloudstorage.ErrPreconditionFailed
+			}
+			if gen != 0 && gen != attrs.Generation {
+				return cloudstorage.ErrPreconditionFailed
+			}
+			gen = attrs.Generation
+		}
+		// the generation match makes the check and the delete atomic
+		err := oh.If(storage.Conditions{GenerationMatch: gen}).Delete(ctx)
+		if err == storage.ErrObjectNotExist {
+			return cloudstorage.ErrObjectNotFound
+		} else if preconditionFailed(err) {
+			return cloudstorage.ErrPreconditionFailed
+		}
+		return err
+	}
+	err := oh.Delete(ctx)
 	if err != nil {
 		return err
 	}
@@ -341,12 +743,92 @@ type objectIterator struct {
 	g    *GcsFS
 	ctx  context.Context
 	iter *storage.ObjectIterator
+	// prefixes seen so far when iterating with a delimiter
+	prefixes []string
+	// q has the TagFilter and ObjectFilters checked on each listed object,
+	// and the Filters applied to each page buffered in page
+	q    cloudstorage.Query
+	page cloudstorage.Objects
+	// last is the name of the last object returned, for Cursor
+	last string
+	// reused is the object overwritten by each Next of a Query.Reuse
+	// listing.
+	reused *object
 }
 
+var _ cloudstorage.ResumableIterator = (*objectIterator)(nil)
+
 func (*objectIterator) Close() {}
 
 // Next iterator to go to next object or else returns error for done.
 func (it *objectIterator) Next() (cloudstorage.Object, error) {
+	if len(it.q.Filters) == 0 {
+		o, err := it.next()
+		if err == nil {
+			it.last = o.Name()
+		}
+		return o, err
+	}
+	for len(it.page) == 0 {
+		if err := it.nextPage(); err != nil {
+			return nil, err
+		}
+	}
+	o := it.page[0]
+	it.page = it.page[1:]
+	it.last = o.Name()
+	return o, nil
+}
+
+// Cursor of the position after the last object returned by Next.
+func (it *objectIterator) Cursor() string {
+	return cloudstorage.Cursor{After: it.last}.String()
+}
+
+// Resume iterating after the position of cursor, gcs lists objects in name
+// order so the listing is restarted from the object after the cursor's.
+func (it *objectIterator) Resume(cursor string) error {
+	c, err := cloudstorage.ParseCursor(cursor)
+	if err != nil {
+		return err
+	}
+	q := it.q
+	if c.After != "" && q.StartOffset <= c.After {
+		q.StartOffset = c.After + "\x00"
+	}
+	resumed, err := it.g.Objects(it.ctx, q)
+	if err != nil {
+		return err
+	}
+	it.iter = resumed.(*objectIterator).iter
+	it.page = nil
+	it.last = c.After
+	return nil
+}
+
+// nextPage buffers the objects of the next page the storage iterator
+// fetches, filtered by the Query filters.
+func (it *objectIterator) nextPage() error {
+	var page cloudstorage.Objects
+	for {
+		o, err := it.next()
+		if err == iterator.Done && len(page) > 0 {
+			break
+		} else if err != nil {
+			return err
+		}
+		page = append(page, o)
+		if it.iter.PageInfo().Remaining() == 0 {
+			break
+		}
+	}
+	q := cloudstorage.Query{Filters: it.q.Filters}
+	it.page = q.ApplyFilters(page)
+	return nil
+}
+
+func (it *objectIterator) next() (cloudstorage.Object, error) {
+	bo := cloudstorage.NewBackoffer(GCSBackoff)
 	retryCt := 0
 	for {
 		select {
@@ -356,16 +838,24 @@ func (it *objectIterator) Next() (cloudstorage.Object, error) {
 		default:
 			o, err := it.iter.Next()
 			if err == nil {
-				return newObject(it.g, o), nil
+				if o.Prefix != "" {
+					it.prefixes = append(it.prefixes, o.Prefix)
+					continue
+				}
+				if len(it.q.TagFilter) > 0 && !cloudstorage.MatchTags(cloudstorage.DecodeTags(o.Metadata[cloudstorage.TagsMetadataKey]), it.q.TagFilter) {
+					continue
+				}
+				if !it.q.Match(o.Name, o.Size) {
+					continue
+				}
+				return it.object(o), nil
 			} else if err == iterator.Done {
 				return nil, err
 			} else if err == context.Canceled || err == context.DeadlineExceeded {
 				// Return to user
 				return nil, err
 			}
-			if retryCt < 5 {
-				cloudstorage.Backoff(retryCt)
-			} else {
+			if retryCt >= 5 || !isTransient(err) || !bo.Wait(it.ctx) {
 				return nil, err
 			}
 			retryCt++
@@ -373,11 +863,71 @@ func (it *objectIterator) Next() (cloudstorage.Object, error) {
 	}
 }
 
+// object of the listed attributes o.  A Query.Reuse listing without
+// Filters, whose objects aren't buffered in pages, overwrites the object
+// returned by the previous Next.
+func (it *objectIterator) object(o *storage.ObjectAttrs) *object {
+	if !it.q.Reuse || len(it.q.Filters) > 0 {
+		if it.q.Lean {
+			return newLeanObject(it.g, o)
+		}
+		return newObject(it.g, o)
+	}
+	if it.reused == nil {
+		it.reused = &object{}
+	}
+	if it.q.Lean {
+		it.reused.setLean(it.g, o)
+	} else {
+		it.reused.set(it.g, o)
+	}
+	return it.reused
+}
+
+type folderIterator struct {
+	ctx  context.Context
+	iter *storage.ObjectIterator
+}
+
+func (*folderIterator) Close() {}
+
+// Next iterator to go to next folder or else returns error for done.
+func (it *folderIterator) Next() (string, error) {
+	bo := cloudstorage.NewBackoffer(GCSBackoff)
+	retryCt := 0
+	for {
+		select {
+		case <-it.ctx.Done():
+			// If has been closed
+			return "", it.ctx.Err()
+		default:
+			o, err := it.iter.Next()
+			if err == nil {
+				if o.Prefix == "" {
+					continue
+				}
+				return o.Prefix, nil
+			} else if err == iterator.Done {
+				return "", err
+			} else if err == context.Canceled || err == context.DeadlineExceeded {
+				// Return to user
+				return "", err
+			}
+			if retryCt >= 5 || !isTransient(err) || !bo.Wait(it.ctx) {
+				return "", err
+			}
+			retryCt++
+		}
+	}
+}
+
 type object struct {
+	fs                *GcsFS
 	name              string
 	updated           time.Time
 	metadata          map[string]string
 	googleObject      *storage.ObjectAttrs
+	attrs             *storage.ObjectAttrs
 	gcsb              *storage.BucketHandle
 	bucket            string
 	cachedcopy        *os.File
@@ -385,19 +935,45 @@ type object struct {
 	opened            bool
 	cachepath         string
 	enableCompression bool
+	size              int64
+	etag              string
+	hashes            map[string]string
+	// lean objects of a Query.Lean listing load their metadata on first
+	// use.
+	lean bool
+	// key is the Opts.EncryptionKey the object was got with, nil for the
+	// store's.
+	key []byte
+}
+
+// handle of the object with its key, or that of opts.
+func (o *object) handle(opts ...cloudstorage.Opts) *storage.ObjectHandle {
+	if len(opts) == 0 || len(opts[0].EncryptionKey) == 0 {
+		opts = []cloudstorage.Opts{{EncryptionKey: o.key}}
+	}
+	return o.fs.objectHandle(o.name, opts...)
 }
 
 func newObject(g *GcsFS, o *storage.ObjectAttrs) *object {
-	metadata := o.Metadata
-	if metadata == nil {
-		metadata = make(map[string]string)
+	obj := &object{}
+	obj.set(g, o)
+	return obj
+}
+
+// set the object to the attributes o.
+func (obj *object) set(g *GcsFS, o *storage.ObjectAttrs) {
+	// the attributes keep the custom metadata
+	metadata := make(map[string]string, len(o.Metadata)+4)
+	for k, v := range o.Metadata {
+		metadata[k] = v
 	}
-	metadata["content_length"] = strconv.FormatInt(o.Size, 10)
+	metadata[cloudstorage.ContentLengthKey] = strconv.FormatInt(o.Size, 10)
 	metadata["attrs_content_type"] = o.ContentType
 	metadata["attrs_cache_control"] = o.CacheControl
 	metadata["content_encoding"] = o.ContentEncoding
 
-	return &object{
+	*obj = object{
+		fs:                g,
 		name:              o.Name,
 		updated:           o.Updated,
 		metadata:          metadata,
@@ -405,8 +981,100 @@ func newObject(g *GcsFS, o *storage.ObjectAttrs) *object {
 		bucket:            g.bucket,
 		cachepath:         cloudstorage.CachePathObj(g.cachepath, o.Name, g.Id),
 		enableCompression: g.enableCompression,
+		size:              o.Size,
+		etag:              o.Etag,
+		hashes:            attrsHashes(o),
+		attrs:             o,
 	}
 }
+
+// newLeanObject of a lean listing, without metadata, the hashes are made
+// from attrs on first use.
+func newLeanObject(g *GcsFS, o *storage.ObjectAttrs) *object {
+	obj := &object{}
+	obj.setLean(g, o)
+	return obj
+}
+
+// setLean sets the object to the attributes o of a lean listing.
+func (obj *object) setLean(g *GcsFS, o *storage.ObjectAttrs) {
+	*obj = object{
+		fs:                g,
+		name:              o.Name,
+		updated:           o.Updated,
+		gcsb:              g.gcsb(),
+		bucket:            g.bucket,
+		cachepath:         cloudstorage.CachePathObj(g.cachepath, o.Name, g.Id),
+		enableCompression: g.enableCompression,
+		size:              o.Size,
+		etag:              o.Etag,
+		attrs:             o,
+		lean:              true,
+	}
+}
+
+// load the attributes and metadata of a lean object.
+func (o *object) load() {
+	if !o.lean {
+		return
+	}
+	o.lean = false
+	ctx, cancel := cloudstorage.WithTimeout(context.Background(), o.fs.Timeouts.Read)
+	defer cancel()
+	attrs, err := o.handle().Attrs(ctx)
+	if err != nil {
+		gou.Warnf("could not load the attributes of %s err=%v", o.name, err)
+		return
+	}
+	loaded := newObject(o.fs, attrs)
+	o.metadata, o.hashes, o.attrs = loaded.metadata, loaded.hashes, loaded.attrs
+}
+
+func (o *object) Size() int64 {
+	return o.size
+}
+func (o *object) ETag() string {
+	return o.etag
+}
+func (o *object) Hashes() map[string]string {
+	if o.hashes == nil && o.attrs != nil {
+		o.hashes = attrsHashes(o.attrs)
+	}
+	return o.hashes
+}
+func (o *object) Attrs() cloudstorage.ObjectAttributes {
+	o.load()
+	if o.attrs == nil {
+		return cloudstorage.BasicAttrs(o)
+	}
+	return cloudstorage.ObjectAttributes{
+		Size:                o.attrs.Size,
+		Updated:             o.attrs.Updated.UTC(),
+		ContentType:         o.attrs.ContentType,
+		ContentEncoding:     o.attrs.ContentEncoding,
+		CacheControl:        o.attrs.CacheControl,
+		ETag:                o.attrs.Etag,
+		StorageClass:        o.attrs.StorageClass,
+		Generation:          o.attrs.Generation,
+		CustomTime:          o.attrs.CustomTime.UTC(),
+		TemporaryHold:       o.attrs.TemporaryHold,
+		EventBasedHold:      o.attrs.EventBasedHold,
+		RetentionExpiration: o.attrs.RetentionExpirationTime.UTC(),
+		CustomMetadata:      o.attrs.Metadata,
+	}
+}
+
+// attrsHashes composite objects have no md5, every object has a crc32c.
+func attrsHashes(attrs *storage.ObjectAttrs) map[string]string {
+	h := make(map[string]string, 2)
+	if len(attrs.MD5) > 0 {
+		h[cloudstorage.HashMD5] = hex.EncodeToString(attrs.MD5)
+	}
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, attrs.CRC32C)
+	h[cloudstorage.HashCRC32C] = hex.EncodeToString(crc)
+	return h
+}
 func (o *object) StorageSource() string {
 	return StoreType
 }
@@ -417,12 +1085,14 @@ func (o *object) String() string {
 	return o.name
 }
 func (o *object) Updated() time.Time {
-	return o.updated
+	return o.updated.UTC()
 }
 func (o *object) MetaData() map[string]string {
+	o.load()
 	return o.metadata
 }
 func (o *object) SetMetaData(meta map[string]string) {
+	o.lean = false
 	o.metadata = meta
 }
 
@@ -459,15 +1129,18 @@ func (o *object) Open(accesslevel cloudstorage.AccessLevel) (*os.File, error) {
 			o.cachepath, err)
 	}
 
+	bo := cloudstorage.NewBackoffer(GCSBackoff)
 	for try := 0; try < GCSRetries; try++ {
 		if o.googleObject == nil {
-			gobj, err := o.gcsb.Object(o.name).Attrs(context.Background())
+			gobj, err := o.handle().Attrs(context.Background())
 			if err != nil {
 				if strings.Contains(err.Error(), "doesn't exist") {
 					// New, this is fine
 				} else {
 					errs = append(errs, fmt.Errorf("error storage.NewReader err=%v", err))
-					cloudstorage.Backoff(try)
+					if !isTransient(err) || !bo.Wait(context.Background()) {
+						break
+					}
 					continue
 				}
 			}
@@ -479,58 +1152,71 @@ func (o *object) Open(accesslevel cloudstorage.AccessLevel) (*os.File, error) {
 
 		if o.googleObject != nil {
 			//we have a preexisting object, so lets download it..
-			rc, err := o.gcsb.Object(o.name).ReadCompressed(true).NewReader(context.Background())
-			if err != nil {
-				errs = append(errs, fmt.Errorf("error storage.NewReader err=%v", err))
-				cloudstorage.Backoff(try)
-				continue
-			}
-			defer rc.Close()
-
-			if _, err := cachedcopy.Seek(0, io.SeekStart); err != nil {
-				return nil, fmt.Errorf("error seeking to start of cachedcopy err=%v", err) // don't retry on local fs errors
-			}
-
-			var writtenBytes int64
-			// we check ContentType here because files uploaded compressed without an
-			// explicit ContentType set get autodetected as "application/x-gzip" instead
-			// of "application/octet-stream", but files with the gzip ContentType get
-			// auto-decompressed regardless of your Accept-Encoding header
-			if o.googleObject.ContentEncoding == compressionMime && o.googleObject.ContentType != "application/x-gzip" {
-				cr, err := gzip.NewReader(rc)
-				if err != nil {
-					return nil, fmt.Errorf("error decompressing data err=%v", err) // don't retry on decompression errors
-				}
-				writtenBytes, err = io.Copy(cachedcopy, cr)
-				if err != nil && (strings.HasPrefix(err.Error(), "gzip: ")) {
-					return nil, fmt.Errorf("error copying/decompressing data err=%v", err) // don't retry on decompression errors
+			if o.fs.DownloadThreshold > 0 && o.googleObject.ContentEncoding == "" &&
+				o.googleObject.Size >= o.fs.DownloadThreshold {
+				if err := o.downloadParts(cachedcopy); err != nil {
+					errs = append(errs, err)
+					if !isTransient(err) || !bo.Wait(context.Background()) {
+						break
+					}
+					continue
 				}
 			} else {
-				writtenBytes, err = io.Copy(cachedcopy, rc)
-			}
-			if err != nil {
-				errs = append(errs, fmt.Errorf("error coping bytes. err=%v", err))
-				//recreate the cachedcopy file incase it has incomplete data
-				if err := os.Remove(o.cachepath); err != nil {
-					return nil, fmt.Errorf("error resetting the cachedcopy err=%v", err) //don't retry on local fs errors
+				rc, err := o.handle().ReadCompressed(true).NewReader(context.Background())
+				if err != nil {
+					errs = append(errs, fmt.Errorf("error storage.NewReader err=%v", err))
+					if !isTransient(err) || !bo.Wait(context.Background()) {
+						break
+					}
+					continue
 				}
-				if cachedcopy, err = os.Create(o.cachepath); err != nil {
-					return nil, fmt.Errorf("error creating a new cachedcopy file. local=%s err=%v", o.cachepath, err)
+				defer rc.Close()
+
+				if _, err := cachedcopy.Seek(0, io.SeekStart); err != nil {
+					return nil, fmt.Errorf("error seeking to start of cachedcopy err=%v", err) // don't retry on local fs errors
 				}
 
-				cloudstorage.Backoff(try)
-				continue
-			}
+				var writtenBytes int64
+				if decompress(o.googleObject) {
+					src := &readErrRecorder{r: rc}
+					cr, err := cloudstorage.NewDecompressReader(src, o.googleObject.ContentEncoding)
+					if err != nil {
+						return nil, fmt.Errorf("error decompressing data err=%v", err) // don't retry on decompression errors
+					}
+					writtenBytes, err = io.Copy(cachedcopy, cr)
+					cr.Close()
+					if err != nil && src.err == nil {
+						return nil, fmt.Errorf("error copying/decompressing data err=%v", err) // don't retry on decompression errors
+					}
+				} else {
+					writtenBytes, err = io.Copy(cachedcopy, rc)
+				}
+				if err != nil {
+					errs = append(errs, fmt.Errorf("error coping bytes. err=%v", err))
+					//recreate the cachedcopy file incase it has incomplete data
+					if err := os.Remove(o.cachepath); err != nil {
+						return nil, fmt.Errorf("error resetting the cachedcopy err=%v", err) //don't retry on local fs errors
+					}
+					if cachedcopy, err = os.Create(o.cachepath); err != nil {
+						return nil, fmt.Errorf("error creating a new cachedcopy file. local=%s err=%v", o.cachepath, err)
+					}
+
+					if !bo.Wait(context.Background()) {
+						break
+					}
+					continue
+				}
 
-			if o.googleObject.ContentEncoding != compressionMime { // compression checks crc
-				// make sure the whole object was downloaded from google
-				if contentLength, ok := o.metadata["content_length"]; ok {
-					if contentLengthInt, err := strconv.ParseInt(contentLength, 10, 64); err == nil {
-						if contentLengthInt != writtenBytes {
-							return nil, fmt.Errorf("partial file download error. tfile=%v", o.name)
+				if !cloudstorage.IsCompressed(o.googleObject.ContentEncoding) { // compression checks crc
+					// make sure the whole object was downloaded from google
+					if contentLength, ok := o.MetaData()[cloudstorage.ContentLengthKey]; ok {
+						if contentLengthInt, err := strconv.ParseInt(contentLength, 10, 64); err == nil {
+							if contentLengthInt != writtenBytes {
+								return nil, fmt.Errorf("partial file download error. tfile=%v", o.name)
+							}
+						} else {
+							return nil, fmt.Errorf("content_length is not a number. tfile=%v", o.name)
 						}
-					} else {
-						return nil, fmt.Errorf("content_length is not a number. tfile=%v", o.name)
 					}
 				}
 			}
@@ -558,7 +1244,91 @@ func (o *object) Open(accesslevel cloudstorage.AccessLevel) (*os.File, error) {
 		return o.cachedcopy, nil
 	}
 
-	return nil, fmt.Errorf("fetch error retry cnt reached: obj=%s tfile=%v errs:[%v]", o.name, o.cachepath, errs)
+	return nil, fmt.Errorf("fetch error: obj=%s tfile=%v errs:[%v]", o.name, o.cachepath, errs)
+}
+
+// readErrRecorder records the errors of reading the object, so they can be
+// told apart from the decompression errors of the reader wrapping it.
+type readErrRecorder struct {
+	r   io.Reader
+	err error
+}
+
+func (r *readErrRecorder) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// downloadParts downloads the object into cachedcopy with ranged readers,
+// DownloadConcurrency parts at a time.  The readers are pinned to the
+// generation found by Attrs so every part comes from the same version.
+func (o *object) downloadParts(cachedcopy *os.File) error {
+	if err := cachedcopy.Truncate(0); err != nil {
+		return fmt.Errorf("error truncating cachedcopy err=%v", err)
+	}
+	oh := o.handle().Generation(o.googleObject.Generation)
+	size := o.googleObject.Size
+	partSize := o.fs.DownloadPartSize
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	parts := make(chan int64)
+	errc := make(chan error, o.fs.DownloadConcurrency)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < o.fs.DownloadConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, partSize)
+			for off := range parts {
+				if err := downloadPart(ctx, oh, cachedcopy, buf, off, size); err != nil {
+					errc <- err
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+feed:
+	for off := int64(0); off < size; off += partSize {
+		select {
+		case parts <- off:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(parts)
+	wg.Wait()
+
+	select {
+	case err := <-errc:
+		return err
+	default:
+		return nil
+	}
+}
+
+// downloadPart reads the part of the object starting at off into buf and
+// writes it to the same offset of f.
+func downloadPart(ctx context.Context, oh *storage.ObjectHandle, f *os.File, buf []byte, off, size int64) error {
+	if n := size - off; n < int64(len(buf)) {
+		buf = buf[:n]
+	}
+	rc, err := oh.NewRangeReader(ctx, off, int64(len(buf)))
+	if err != nil {
+		return fmt.Errorf("error storage.NewRangeReader offset=%d err=%v", off, err)
+	}
+	defer rc.Close()
+	if _, err := io.ReadFull(rc, buf); err != nil {
+		return fmt.Errorf("error reading part offset=%d err=%v", off, err)
+	}
+	if _, err := f.WriteAt(buf, off); err != nil {
+		return fmt.Errorf("error writing part offset=%d err=%v", off, err)
+	}
+	return nil
 }
 
 func (o *object) File() *os.File {
@@ -588,6 +1358,11 @@ func (o *object) Sync() error {
 
 	var errs = make([]string, 0)
 
+	metadata, err := cloudstorage.NormalizeMetadata(o.MetaData())
+	if err != nil {
+		return err
+	}
+
 	cachedcopy, err := os.OpenFile(o.cachepath, os.O_RDWR, 0664)
 	if err != nil {
 		return fmt.Errorf("couldn't open localfile for sync'ing. local=%s err=%v",
@@ -595,39 +1370,49 @@ func (o *object) Sync() error {
 	}
 	defer cachedcopy.Close()
 
+	bo := cloudstorage.NewBackoffer(GCSBackoff)
 	for try := 0; try < GCSRetries; try++ {
 		if _, err := cachedcopy.Seek(0, os.SEEK_SET); err != nil {
 			return fmt.Errorf("error seeking to start of cachedcopy err=%v", err) //don't retry on local filesystem errors
 		}
 		rd := bufio.NewReader(cachedcopy)
 
-		wc := o.gcsb.Object(o.name).NewWriter(context.Background())
+		wc := o.fs.newWriter(context.Background(), o.handle())
 
-		if o.metadata != nil {
-			wc.Metadata = o.metadata
+		if metadata != nil {
+			wc.Metadata = metadata
 			//contenttype is only used for viewing the file in a browser. (i.e. the GCS Object browser).
-			ctype := cloudstorage.EnsureContextType(o.name, o.metadata)
+			ctype := cloudstorage.EnsureContextType(o.name, metadata)
 			wc.ContentType = ctype
 		}
 
 		if o.enableCompression {
-			wc.ContentEncoding = compressionMime
-			cw := gzip.NewWriter(wc)
+			wc.ContentEncoding = o.fs.codec()
+			cw, err := cloudstorage.NewCompressWriter(wc, o.fs.codec(), o.fs.CompressionLevel)
+			if err != nil {
+				return err
+			}
 			if _, err = io.Copy(cw, rd); err != nil {
 				errs = append(errs, fmt.Sprintf("copy to remote object error:%v", err))
-				cloudstorage.Backoff(try)
+				if !isTransient(err) || !bo.Wait(context.Background()) {
+					break
+				}
 				continue
 			}
 
 			if err = cw.Close(); err != nil {
 				errs = append(errs, fmt.Sprintf("close compression writer error:%v", err))
-				cloudstorage.Backoff(try)
+				if !isTransient(err) || !bo.Wait(context.Background()) {
+					break
+				}
 				continue
 			}
 
 			if err = wc.Close(); err != nil {
 				errs = append(errs, fmt.Sprintf("Close writer error:%v", err))
-				cloudstorage.Backoff(try)
+				if !isTransient(err) || !bo.Wait(context.Background()) {
+					break
+				}
 				continue
 			}
 		} else {
@@ -637,13 +1422,17 @@ func (o *object) Sync() error {
 				if err2 != nil {
 					errs = append(errs, fmt.Sprintf("CloseWithError error:%v", err2))
 				}
-				cloudstorage.Backoff(try)
+				if !isTransient(err) || !bo.Wait(context.Background()) {
+					break
+				}
 				continue
 			}
 
 			if err = wc.Close(); err != nil {
 				errs = append(errs, fmt.Sprintf("close gcs writer error:%v", err))
-				cloudstorage.Backoff(try)
+				if !isTransient(err) || !bo.Wait(context.Background()) {
+					break
+				}
 				continue
 			}
 		}
@@ -652,7 +1441,7 @@ func (o *object) Sync() error {
 	}
 
 	errmsg := strings.Join(errs, ",")
-	return fmt.Errorf("GCS sync error after retry: (oname=%s cpath:%v) errors[%v]", o.name, o.cachepath, errmsg)
+	return fmt.Errorf("GCS sync error: (oname=%s cpath:%v) errors[%v]", o.name, o.cachepath, errmsg)
 }
 
 func (o *object) Close() error {
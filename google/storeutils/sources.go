@@ -0,0 +1,125 @@
+package storeutils
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"google.golang.org/api/storagetransfer/v1"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/awss3"
+	"github.com/lytics/cloudstorage/azure"
+	"github.com/lytics/cloudstorage/google"
+	"github.com/lytics/cloudstorage/localfs"
+)
+
+// TransferOpts are the options of a transfer job built from cloudstorage
+// configs or stores, see TransferConfig for their meaning.
+type TransferOpts struct {
+	ProjectID          string // defaults to the project of the destination
+	IncludePrefixes    []string
+	ExcludePrefixes    []string
+	Schedule           *storagetransfer.Schedule
+	DeleteFromSource   bool
+	DeleteUniqueInSink bool
+	Overwrite          bool
+}
+
+func (o *TransferOpts) config(src Source, destBucket, project string) *TransferConfig {
+	if o.ProjectID != "" {
+		project = o.ProjectID
+	}
+	return &TransferConfig{
+		ProjectID:          project,
+		DestBucket:         destBucket,
+		Src:                src,
+		IncludePrefixes:    o.IncludePrefixes,
+		ExcludePrefixes:    o.ExcludePrefixes,
+		Schedule:           o.Schedule,
+		DeleteFromSource:   o.DeleteFromSource,
+		DeleteUniqueInSink: o.DeleteUniqueInSink,
+		Overwrite:          o.Overwrite,
+	}
+}
+
+// ConfKeyAzureSasToken config key name of the SAS token transfer jobs read
+// an azure source with, the account key of the azure store can't be used.
+const ConfKeyAzureSasToken = "azure_sas_token"
+
+// NewTransferFromConfigs creates a TransferConfig copying the bucket of the
+// src config, of a gcs, s3, azure or localfs store, to the bucket of the dst
+// gcs config.  localfs sources are read by the default agent pool.
+func NewTransferFromConfigs(src, dst *cloudstorage.Config, opts TransferOpts) (*TransferConfig, error) {
+	if src == nil || dst == nil {
+		return nil, fmt.Errorf("%w: missing source or destination config", ErrBadConfig)
+	}
+	if dst.Type != google.StoreType {
+		return nil, fmt.Errorf("%w: destination must be a %s store not %q", ErrBadConfig, google.StoreType, dst.Type)
+	}
+
+	var source Source
+	switch src.Type {
+	case google.StoreType:
+		source = NewGcsSource(src.Bucket)
+	case awss3.StoreType:
+		source = NewAwsSource(src.Bucket,
+			src.Settings.String(awss3.ConfKeyAccessKey),
+			src.Settings.String(awss3.ConfKeyAccessSecret))
+	case azure.StoreType:
+		source = NewAzureSource(src.Project, src.Bucket, "", src.Settings.String(ConfKeyAzureSasToken))
+	case localfs.StoreType:
+		source = NewPosixSource(src.LocalFS, "")
+	default:
+		return nil, fmt.Errorf("%w: unsupported source store type %q", ErrBadConfig, src.Type)
+	}
+	return opts.config(source, dst.Bucket, dst.Project), nil
+}
+
+// NewTransferFromStores creates a TransferConfig copying the bucket of the
+// src store, a gcs or s3 store, to the bucket of the dst gcs store.  The
+// project has to be set in opts as stores don't expose theirs.
+func NewTransferFromStores(src, dst cloudstorage.Store, opts TransferOpts) (*TransferConfig, error) {
+	if src == nil || dst == nil {
+		return nil, fmt.Errorf("%w: missing source or destination store", ErrBadConfig)
+	}
+	if dst.Type() != google.StoreType {
+		return nil, fmt.Errorf("%w: destination must be a %s store not %q", ErrBadConfig, google.StoreType, dst.Type())
+	}
+	destBucket, err := storeBucket(dst)
+	if err != nil {
+		return nil, err
+	}
+	srcBucket, err := storeBucket(src)
+	if err != nil {
+		return nil, err
+	}
+
+	var source Source
+	switch src.Type() {
+	case google.StoreType:
+		source = NewGcsSource(srcBucket)
+	case awss3.StoreType:
+		client, ok := src.Client().(*s3.S3)
+		if !ok {
+			return nil, fmt.Errorf("%w: s3 store %s has no s3 client", ErrBadConfig, src)
+		}
+		creds, err := client.Config.Credentials.Get()
+		if err != nil {
+			return nil, fmt.Errorf("s3 store %s credentials: %w", src, err)
+		}
+		source = NewAwsSource(srcBucket, creds.AccessKeyID, creds.SecretAccessKey)
+	default:
+		return nil, fmt.Errorf("%w: unsupported source store type %q", ErrBadConfig, src.Type())
+	}
+	return opts.config(source, destBucket, ""), nil
+}
+
+// storeBucket of a store from its scheme://bucket/ String.
+func storeBucket(s cloudstorage.Store) (string, error) {
+	u, err := url.Parse(s.String())
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("%w: no bucket in store %q", ErrBadConfig, s.String())
+	}
+	return u.Host, nil
+}
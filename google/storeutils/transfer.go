@@ -5,8 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"path"
+	"strings"
 	"time"
 
+	"golang.org/x/net/context"
 	"google.golang.org/api/storagetransfer/v1"
 )
 
@@ -19,17 +23,37 @@ const (
 	Deleted     Status = "DELETED"
 )
 
+// OperationStatus is the state of a run of a transfer job.
+type OperationStatus string
+
+const (
+	OperationQueued     OperationStatus = "QUEUED"
+	OperationInProgress OperationStatus = "IN_PROGRESS"
+	OperationPaused     OperationStatus = "PAUSED"
+	OperationSuccess    OperationStatus = "SUCCESS"
+	OperationFailed     OperationStatus = "FAILED"
+	OperationAborted    OperationStatus = "ABORTED"
+)
+
+// Done is true once the operation has ended, successfully or not.
+func (s OperationStatus) Done() bool {
+	return s == OperationSuccess || s == OperationFailed || s == OperationAborted
+}
+
 var (
 	// MaxPrefix is the maximum number of prefix filters allowed when transferring files in GCS buckets
 	MaxPrefix = 20
 
 	ErrBadFilter = errors.New("too many inclusion/exclusion prefixes")
 	ErrBadConfig = errors.New("transferconfig not valid")
+	// ErrTransferFailed the transfer operation failed or was aborted.
+	ErrTransferFailed = errors.New("transfer failed")
 )
 
 // Transferer manages the transfer of data sources to GCS
 type Transferer struct {
 	svc *storagetransfer.TransferJobsService
+	ops *storagetransfer.TransferOperationsService
 }
 
 // NewTransferClient creates a new Transferer using an authed http client
@@ -39,7 +63,14 @@ func NewTransferClient(client *http.Client) (*Transferer, error) {
 		return nil, err
 	}
 
-	return &Transferer{storagetransfer.NewTransferJobsService(st)}, nil
+	return newTransferer(st), nil
+}
+
+func newTransferer(st *storagetransfer.Service) *Transferer {
+	return &Transferer{
+		svc: storagetransfer.NewTransferJobsService(st),
+		ops: storagetransfer.NewTransferOperationsService(st),
+	}
 }
 
 // List returns all of the transferJobs under a specific project. If the variadic argument "statuses"
@@ -103,6 +134,156 @@ func (t *Transferer) NewTransfer(conf *TransferConfig) (*storagetransfer.Transfe
 	return t.svc.Create(job).Do()
 }
 
+// Operations returns the runs of the transferJob with the specified project
+// and job ID, newest first.
+func (t *Transferer) Operations(project, job string) ([]*storagetransfer.TransferOperation, error) {
+	var ops []*storagetransfer.TransferOperation
+	var token string
+
+	filter, err := json.Marshal(struct {
+		ProjectID string   `json:"projectId"`
+		JobNames  []string `json:"jobNames"`
+	}{
+		ProjectID: project,
+		JobNames:  []string{job},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		call := t.ops.List("transferOperations", string(filter))
+		if token != "" {
+			call = call.PageToken(token)
+		}
+
+		resp, err := call.Do()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, o := range resp.Operations {
+			op := &storagetransfer.TransferOperation{}
+			if err := json.Unmarshal(o.Metadata, op); err != nil {
+				return nil, fmt.Errorf("invalid transfer operation %s: %v", o.Name, err)
+			}
+			ops = append(ops, op)
+		}
+
+		token = resp.NextPageToken
+		if token == "" {
+			break
+		}
+	}
+	return ops, nil
+}
+
+// Wait polls the operations of the transferJob with the specified project
+// and job ID every interval until its latest run is done, returning it.
+// ErrTransferFailed is returned, with the operation, if the run failed or
+// was aborted.
+func (t *Transferer) Wait(ctx context.Context, project, job string, interval time.Duration) (*storagetransfer.TransferOperation, error) {
+	return t.WaitProgress(ctx, project, job, interval, nil)
+}
+
+// WaitProgress is Wait calling progress, if not nil, with the progress of the
+// latest run of the job at every poll.
+func (t *Transferer) WaitProgress(ctx context.Context, project, job string, interval time.Duration,
+	progress func(Progress)) (*storagetransfer.TransferOperation, error) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		ops, err := t.Operations(project, job)
+		if err != nil {
+			return nil, err
+		}
+		if len(ops) > 0 {
+			op := ops[0]
+			if progress != nil {
+				progress(ProgressOf(op))
+			}
+			switch OperationStatus(op.Status) {
+			case OperationSuccess:
+				return op, nil
+			case OperationFailed, OperationAborted:
+				return op, fmt.Errorf("%w: job=%s operation=%s status=%s", ErrTransferFailed, job, op.Name, op.Status)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Pause the running transfer operation with the specified name.
+func (t *Transferer) Pause(operation string) error {
+	_, err := t.ops.Pause(operation, &storagetransfer.PauseTransferOperationRequest{}).Do()
+	return err
+}
+
+// Resume the paused transfer operation with the specified name.
+func (t *Transferer) Resume(operation string) error {
+	_, err := t.ops.Resume(operation, &storagetransfer.ResumeTransferOperationRequest{}).Do()
+	return err
+}
+
+// Cancel the transfer operation with the specified name, the objects already
+// transferred are kept.
+func (t *Transferer) Cancel(operation string) error {
+	_, err := t.ops.Cancel(operation, &storagetransfer.CancelOperationRequest{}).Do()
+	return err
+}
+
+// SetStatus of the transferJob with the specified project and job ID,
+// Disabled stops scheduling new runs of the job and Enabled restarts it.
+func (t *Transferer) SetStatus(project, job string, status Status) (*storagetransfer.TransferJob, error) {
+	return t.svc.Patch(job, &storagetransfer.UpdateTransferJobRequest{
+		ProjectId:                  project,
+		TransferJob:                &storagetransfer.TransferJob{Status: string(status)},
+		UpdateTransferJobFieldMask: "status",
+	}).Do()
+}
+
+// Progress of a transfer operation.
+type Progress struct {
+	Operation     string
+	Status        OperationStatus
+	ObjectsFound  int64
+	ObjectsCopied int64
+	ObjectsFailed int64
+	BytesFound    int64
+	BytesCopied   int64
+	BytesFailed   int64
+	// Failures counts the failed objects by error code.
+	Failures map[string]int64
+}
+
+// ProgressOf a transfer operation from its counters.
+func ProgressOf(op *storagetransfer.TransferOperation) Progress {
+	p := Progress{
+		Operation: op.Name,
+		Status:    OperationStatus(op.Status),
+	}
+	if c := op.Counters; c != nil {
+		p.ObjectsFound = c.ObjectsFoundFromSource
+		p.ObjectsCopied = c.ObjectsCopiedToSink
+		p.ObjectsFailed = c.ObjectsFromSourceFailed
+		p.BytesFound = c.BytesFoundFromSource
+		p.BytesCopied = c.BytesCopiedToSink
+		p.BytesFailed = c.BytesFromSourceFailed
+	}
+	for _, e := range op.ErrorBreakdowns {
+		if p.Failures == nil {
+			p.Failures = make(map[string]int64, len(op.ErrorBreakdowns))
+		}
+		p.Failures[e.ErrorCode] += e.ErrorCount
+	}
+	return p
+}
+
 func newTransferJob(project, description string, spec *storagetransfer.TransferSpec, sched *storagetransfer.Schedule) *storagetransfer.TransferJob {
 	return &storagetransfer.TransferJob{
 		ProjectId:    project,
@@ -122,6 +303,26 @@ func oneTimeJobSchedule(ts time.Time) *storagetransfer.Schedule {
 	}
 }
 
+// RecurringSchedule returns a storagetransfer job schedule running the job
+// every interval (a whole number of seconds, at least an hour) from start,
+// until the end date if end isn't zero.
+func RecurringSchedule(start time.Time, interval time.Duration, end time.Time) *storagetransfer.Schedule {
+	start = start.UTC()
+	sched := &storagetransfer.Schedule{
+		ScheduleStartDate: toDate(start),
+		StartTimeOfDay: &storagetransfer.TimeOfDay{
+			Hours:   int64(start.Hour()),
+			Minutes: int64(start.Minute()),
+			Seconds: int64(start.Second()),
+		},
+		RepeatInterval: fmt.Sprintf("%ds", int64(interval/time.Second)),
+	}
+	if !end.IsZero() {
+		sched.ScheduleEndDate = toDate(end.UTC())
+	}
+	return sched
+}
+
 // toDate converts a time into a storagetransfer friendly Date
 func toDate(ts time.Time) *storagetransfer.Date {
 	return &storagetransfer.Date{
@@ -132,13 +333,20 @@ func toDate(ts time.Time) *storagetransfer.Date {
 }
 
 // Source defines the data source when transferring data to a GCS bucket. While the sink is restricted to a GCS bucket
-// the source can either be another GCS bucket, and AWS S3 source, or a HTTP source
+// the source can either be another GCS bucket, an AWS S3 source, an Azure Blob Storage container, a POSIX
+// filesystem or a HTTP source
 // Each source produces a storagetransfer TransferSpec
 type Source interface {
 	TransferSpec(destBucket string) *storagetransfer.TransferSpec
 	String() string
 }
 
+// SourceValidator is a Source checking its required fields, TransferConfig.Job
+// validates the sources implementing it.
+type SourceValidator interface {
+	Validate() error
+}
+
 // GcsSource is a Source defined by a Gcs bucket
 type GcsSource struct {
 	source string
@@ -158,6 +366,13 @@ func (g *GcsSource) String() string {
 	return g.source
 }
 
+func (g *GcsSource) Validate() error {
+	if g.source == "" {
+		return fmt.Errorf("%w: gcs source requires a bucket", ErrBadConfig)
+	}
+	return nil
+}
+
 // HttpSource is a Source defined by a HTTP URL data source
 type HttpSource struct {
 	url string
@@ -177,6 +392,13 @@ func (h *HttpSource) String() string {
 	return h.url
 }
 
+func (h *HttpSource) Validate() error {
+	if u, err := url.Parse(h.url); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("%w: http source requires a http(s) url list not %q", ErrBadConfig, h.url)
+	}
+	return nil
+}
+
 // AwsSource is an AWS S3 data source
 type AwsSource struct {
 	bucket          string
@@ -204,6 +426,89 @@ func (a *AwsSource) String() string {
 	return a.bucket
 }
 
+func (a *AwsSource) Validate() error {
+	if a.bucket == "" {
+		return fmt.Errorf("%w: aws source requires a bucket", ErrBadConfig)
+	}
+	if a.accessKeyId == "" || a.secretAccessKey == "" {
+		return fmt.Errorf("%w: aws source %s requires an access key and secret", ErrBadConfig, a.bucket)
+	}
+	return nil
+}
+
+// AzureSource is an Azure Blob Storage container data source
+type AzureSource struct {
+	account   string
+	container string
+	path      string
+	sasToken  string
+}
+
+// NewAzureSource transfers the blobs under path ("" is the whole container)
+// of the container of the storage account, read with a SAS token.
+func NewAzureSource(account, container, path, sasToken string) Source {
+	return &AzureSource{account, container, path, sasToken}
+}
+
+func (a *AzureSource) TransferSpec(bucket string) *storagetransfer.TransferSpec {
+	ts := newTransferSpec(bucket)
+	ts.AzureBlobStorageDataSource = &storagetransfer.AzureBlobStorageData{
+		AzureCredentials: &storagetransfer.AzureCredentials{SasToken: a.sasToken},
+		Container:        a.container,
+		Path:             a.path,
+		StorageAccount:   a.account,
+	}
+	return ts
+}
+
+func (a *AzureSource) String() string {
+	return a.account + "/" + a.container
+}
+
+func (a *AzureSource) Validate() error {
+	if a.account == "" || a.container == "" {
+		return fmt.Errorf("%w: azure source requires a storage account and container", ErrBadConfig)
+	}
+	if a.sasToken == "" {
+		return fmt.Errorf("%w: azure source %s requires a sas token", ErrBadConfig, a)
+	}
+	if strings.HasPrefix(a.path, "/") {
+		return fmt.Errorf("%w: azure source path %q must be relative", ErrBadConfig, a.path)
+	}
+	return nil
+}
+
+// PosixSource is a POSIX filesystem data source, read by the transfer agents
+// of an agent pool.
+type PosixSource struct {
+	root      string
+	agentPool string
+}
+
+// NewPosixSource transfers the files under the absolute root directory with
+// the agents of agentPool ("" is the project's default pool).
+func NewPosixSource(root, agentPool string) Source {
+	return &PosixSource{root, agentPool}
+}
+
+func (p *PosixSource) TransferSpec(bucket string) *storagetransfer.TransferSpec {
+	ts := newTransferSpec(bucket)
+	ts.PosixDataSource = &storagetransfer.PosixFilesystem{RootDirectory: p.root}
+	ts.SourceAgentPoolName = p.agentPool
+	return ts
+}
+
+func (p *PosixSource) String() string {
+	return p.root
+}
+
+func (p *PosixSource) Validate() error {
+	if !path.IsAbs(p.root) {
+		return fmt.Errorf("%w: posix source requires an absolute root directory not %q", ErrBadConfig, p.root)
+	}
+	return nil
+}
+
 func newTransferSpec(sink string) *storagetransfer.TransferSpec {
 	return &storagetransfer.TransferSpec{
 		GcsDataSink: &storagetransfer.GcsData{BucketName: sink},
@@ -218,7 +523,17 @@ type TransferConfig struct {
 	Src             Source
 	IncludePrefixes []string
 	ExcludePrefixes []string
-	Schedule        *storagetransfer.Schedule
+	// Schedule of the job, a one time transfer today if nil.  See
+	// RecurringSchedule.
+	Schedule *storagetransfer.Schedule
+	// DeleteFromSource deletes the source objects once transferred.
+	DeleteFromSource bool
+	// DeleteUniqueInSink deletes the objects of DestBucket that aren't in
+	// the source, mirroring it.  It can't be combined with DeleteFromSource.
+	DeleteUniqueInSink bool
+	// Overwrite replaces the objects already in DestBucket, by default only
+	// the objects that differ from the source are.
+	Overwrite bool
 }
 
 // Job instantiates a Transfer job from the TransferConfig struct
@@ -226,11 +541,22 @@ func (t *TransferConfig) Job() (*storagetransfer.TransferJob, error) {
 	if t.DestBucket == "" || t.Src == nil {
 		return nil, ErrBadConfig
 	}
+	if v, ok := t.Src.(SourceValidator); ok {
+		if err := v.Validate(); err != nil {
+			return nil, err
+		}
+	}
 
 	// Google returns an error if more than 20 inclusionary/exclusionary fields are included
 	if len(t.IncludePrefixes) > MaxPrefix || len(t.ExcludePrefixes) > MaxPrefix {
 		return nil, ErrBadFilter
 	}
+	if t.DeleteFromSource && t.DeleteUniqueInSink {
+		return nil, fmt.Errorf("%w: DeleteFromSource and DeleteUniqueInSink are exclusive", ErrBadConfig)
+	}
+	if t.Schedule != nil && t.Schedule.ScheduleStartDate == nil {
+		return nil, fmt.Errorf("%w: schedule has no start date", ErrBadConfig)
+	}
 
 	spec := t.Src.TransferSpec(t.DestBucket)
 
@@ -242,9 +568,17 @@ func (t *TransferConfig) Job() (*storagetransfer.TransferJob, error) {
 		}
 	}
 
+	if t.DeleteFromSource || t.DeleteUniqueInSink || t.Overwrite {
+		spec.TransferOptions = &storagetransfer.TransferOptions{
+			DeleteObjectsFromSourceAfterTransfer:  t.DeleteFromSource,
+			DeleteObjectsUniqueInSink:             t.DeleteUniqueInSink,
+			OverwriteObjectsAlreadyExistingInSink: t.Overwrite,
+		}
+	}
+
 	// if a schedule is not provided, create a 1-time transfer schedule
-	var schedule *storagetransfer.Schedule
-	if t.Schedule == nil {
+	schedule := t.Schedule
+	if schedule == nil {
 		schedule = oneTimeJobSchedule(time.Now())
 	}
 
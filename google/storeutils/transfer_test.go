@@ -0,0 +1,248 @@
+package storeutils
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/option"
+	"google.golang.org/api/storagetransfer/v1"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/awss3"
+	"github.com/lytics/cloudstorage/azure"
+	"github.com/lytics/cloudstorage/google"
+)
+
+func TestTransferJob(t *testing.T) {
+	start := time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC)
+	conf := &TransferConfig{
+		ProjectID:        "proj",
+		DestBucket:       "dst",
+		Src:              NewGcsSource("src"),
+		Schedule:         RecurringSchedule(start, 24*time.Hour, time.Time{}),
+		DeleteFromSource: true,
+	}
+	job, err := conf.Job()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if job.Schedule.RepeatInterval != "86400s" || job.Schedule.ScheduleStartDate.Day != 4 ||
+		job.Schedule.StartTimeOfDay.Hours != 5 || job.Schedule.ScheduleEndDate != nil {
+		t.Errorf("unexpected schedule %+v", job.Schedule)
+	}
+	opts := job.TransferSpec.TransferOptions
+	if opts == nil || !opts.DeleteObjectsFromSourceAfterTransfer || opts.DeleteObjectsUniqueInSink {
+		t.Errorf("unexpected transfer options %+v", opts)
+	}
+
+	conf.DeleteUniqueInSink = true
+	if _, err := conf.Job(); !errors.Is(err, ErrBadConfig) {
+		t.Errorf("expected ErrBadConfig got %v", err)
+	}
+
+	conf.DeleteFromSource, conf.DeleteUniqueInSink, conf.Schedule = false, false, nil
+	job, err = conf.Job()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if job.Schedule.ScheduleEndDate == nil || job.TransferSpec.TransferOptions != nil {
+		t.Errorf("expected a one time job without options %+v", job)
+	}
+}
+
+func TestNewTransferFromConfigs(t *testing.T) {
+	dst := &cloudstorage.Config{Type: google.StoreType, Project: "proj", Bucket: "dst"}
+	src := &cloudstorage.Config{
+		Type:   awss3.StoreType,
+		Bucket: "src",
+		Settings: map[string]interface{}{
+			awss3.ConfKeyAccessKey:    "key",
+			awss3.ConfKeyAccessSecret: "secret",
+		},
+	}
+	conf, err := NewTransferFromConfigs(src, dst, TransferOpts{IncludePrefixes: []string{"logs/"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	job, err := conf.Job()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	aws := job.TransferSpec.AwsS3DataSource
+	if job.ProjectId != "proj" || job.TransferSpec.GcsDataSink.BucketName != "dst" ||
+		aws == nil || aws.BucketName != "src" || aws.AwsAccessKey.AccessKeyId != "key" {
+		t.Errorf("unexpected job %+v", job.TransferSpec)
+	}
+
+	if _, err := NewTransferFromConfigs(dst, src, TransferOpts{}); !errors.Is(err, ErrBadConfig) {
+		t.Errorf("expected ErrBadConfig for a s3 destination got %v", err)
+	}
+	src.Type = "ftp"
+	if _, err := NewTransferFromConfigs(src, dst, TransferOpts{}); !errors.Is(err, ErrBadConfig) {
+		t.Errorf("expected ErrBadConfig for a ftp source got %v", err)
+	}
+
+	src = &cloudstorage.Config{Type: azure.StoreType, Project: "account", Bucket: "container"}
+	conf, err = NewTransferFromConfigs(src, dst, TransferOpts{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := conf.Job(); !errors.Is(err, ErrBadConfig) {
+		t.Errorf("expected ErrBadConfig for an azure source without a sas token got %v", err)
+	}
+	src.Settings = map[string]interface{}{ConfKeyAzureSasToken: "sas"}
+	conf, _ = NewTransferFromConfigs(src, dst, TransferOpts{})
+	job, err = conf.Job()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	az := job.TransferSpec.AzureBlobStorageDataSource
+	if az == nil || az.StorageAccount != "account" || az.Container != "container" || az.AzureCredentials.SasToken != "sas" {
+		t.Errorf("unexpected azure source %+v", az)
+	}
+}
+
+func TestSourceValidate(t *testing.T) {
+	tests := []struct {
+		src   Source
+		valid bool
+	}{
+		{NewGcsSource("bucket"), true},
+		{NewGcsSource(""), false},
+		{NewHttpSource("https://example.com/list.tsv"), true},
+		{NewHttpSource("example.com/list.tsv"), false},
+		{NewAwsSource("bucket", "key", "secret"), true},
+		{NewAwsSource("bucket", "", "secret"), false},
+		{NewAzureSource("account", "container", "logs/", "sas"), true},
+		{NewAzureSource("account", "", "", "sas"), false},
+		{NewAzureSource("account", "container", "/logs/", "sas"), false},
+		{NewPosixSource("/data/export", "pool"), true},
+		{NewPosixSource("data/export", ""), false},
+	}
+	for _, tt := range tests {
+		conf := &TransferConfig{ProjectID: "proj", DestBucket: "dst", Src: tt.src}
+		job, err := conf.Job()
+		if tt.valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.src, err)
+		} else if !tt.valid && !errors.Is(err, ErrBadConfig) {
+			t.Errorf("%s: expected ErrBadConfig got %v", tt.src, err)
+		}
+		if tt.valid && job.TransferSpec.GcsDataSink.BucketName != "dst" {
+			t.Errorf("%s: unexpected sink %+v", tt.src, job.TransferSpec.GcsDataSink)
+		}
+	}
+
+	job, _ := (&TransferConfig{DestBucket: "dst", Src: NewPosixSource("/data", "pool")}).Job()
+	if job.TransferSpec.PosixDataSource.RootDirectory != "/data" || job.TransferSpec.SourceAgentPoolName != "pool" {
+		t.Errorf("unexpected posix spec %+v", job.TransferSpec)
+	}
+}
+
+func TestTransferWait(t *testing.T) {
+	statuses := []OperationStatus{OperationQueued, OperationInProgress, OperationFailed}
+	polls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var filter struct {
+			JobNames []string `json:"jobNames"`
+		}
+		if err := json.Unmarshal([]byte(r.URL.Query().Get("filter")), &filter); err != nil || len(filter.JobNames) != 1 {
+			http.Error(w, "bad filter", http.StatusBadRequest)
+			return
+		}
+		md, _ := json.Marshal(storagetransfer.TransferOperation{
+			Name:            "op1",
+			TransferJobName: filter.JobNames[0],
+			Status:          string(statuses[polls]),
+			Counters: &storagetransfer.TransferCounters{
+				ObjectsCopiedToSink: int64(polls),
+				BytesCopiedToSink:   int64(polls * 10),
+			},
+			ErrorBreakdowns: []*storagetransfer.ErrorSummary{{ErrorCode: "NOT_FOUND", ErrorCount: 1}},
+		})
+		polls++
+		json.NewEncoder(w).Encode(storagetransfer.ListOperationsResponse{
+			Operations: []*storagetransfer.Operation{{Name: "op1", Metadata: md}},
+		})
+	}))
+	defer srv.Close()
+
+	st, err := storagetransfer.NewService(context.Background(),
+		option.WithEndpoint(srv.URL), option.WithHTTPClient(srv.Client()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var progress []Progress
+	op, err := newTransferer(st).WaitProgress(context.Background(), "proj", "transferJobs/1", time.Millisecond,
+		func(p Progress) { progress = append(progress, p) })
+	if !errors.Is(err, ErrTransferFailed) {
+		t.Fatalf("expected ErrTransferFailed got %v", err)
+	}
+	if op.TransferJobName != "transferJobs/1" || polls != 3 {
+		t.Errorf("unexpected operation %+v after %d polls", op, polls)
+	}
+	if len(progress) != 3 {
+		t.Fatalf("expected 3 progress reports got %d", len(progress))
+	}
+	last := progress[2]
+	if last.Status != OperationFailed || last.ObjectsCopied != 2 || last.BytesCopied != 20 || last.Failures["NOT_FOUND"] != 1 {
+		t.Errorf("unexpected progress %+v", last)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	statuses, polls = []OperationStatus{OperationInProgress}, 0
+	if _, err := newTransferer(st).Wait(ctx, "proj", "transferJobs/1", time.Hour); err != context.Canceled {
+		t.Errorf("expected context.Canceled got %v", err)
+	}
+}
+
+func TestTransferControl(t *testing.T) {
+	var calls []string
+	var patch storagetransfer.UpdateTransferJobRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		if r.Method == http.MethodPatch {
+			json.NewDecoder(r.Body).Decode(&patch)
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+
+	st, err := storagetransfer.NewService(context.Background(),
+		option.WithEndpoint(srv.URL), option.WithHTTPClient(srv.Client()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tr := newTransferer(st)
+	for _, f := range []func(string) error{tr.Pause, tr.Resume, tr.Cancel} {
+		if err := f("transferOperations/op1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if _, err := tr.SetStatus("proj", "transferJobs/1", Disabled); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"POST /v1/transferOperations/op1:pause",
+		"POST /v1/transferOperations/op1:resume",
+		"POST /v1/transferOperations/op1:cancel",
+		"PATCH /v1/transferJobs/1",
+	}
+	if len(calls) != len(expected) {
+		t.Fatalf("expected calls %v got %v", expected, calls)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Errorf("expected call %q got %q", expected[i], calls[i])
+		}
+	}
+	if patch.ProjectId != "proj" || patch.UpdateTransferJobFieldMask != "status" || patch.TransferJob.Status != string(Disabled) {
+		t.Errorf("unexpected patch %+v", patch)
+	}
+}
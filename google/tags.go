@@ -0,0 +1,33 @@
+package google
+
+import (
+	"cloud.google.com/go/storage"
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+var _ cloudstorage.TaggedStore = (*GcsFS)(nil)
+
+// GetTags of the object, kept in its metadata.
+func (g *GcsFS) GetTags(ctx context.Context, name string) (map[string]string, error) {
+	attrs, err := g.gcsb().Object(name).Attrs(ctx)
+	if err == storage.ErrObjectNotExist {
+		return nil, cloudstorage.ErrObjectNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return cloudstorage.DecodeTags(attrs.Metadata[cloudstorage.TagsMetadataKey]), nil
+}
+
+// SetTags replaces the tags, metadata updates are merged so the rest of the
+// object's metadata is left alone.
+func (g *GcsFS) SetTags(ctx context.Context, name string, tags map[string]string) error {
+	_, err := g.gcsb().Object(name).Update(ctx, storage.ObjectAttrsToUpdate{
+		Metadata: map[string]string{cloudstorage.TagsMetadataKey: cloudstorage.EncodeTags(tags)},
+	})
+	if err == storage.ErrObjectNotExist {
+		return cloudstorage.ErrObjectNotFound
+	}
+	return err
+}
@@ -0,0 +1,707 @@
+package hdfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/araddon/gou"
+	"github.com/pborman/uuid"
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/pathutil"
+)
+
+const (
+	// StoreType = "hdfs" this is used to define the storage type to create
+	// from cloudstorage.NewStore(config)
+	StoreType = "hdfs"
+
+	// AuthSimple uses hadoop simple (pseudo) authentication, the user name
+	// in Settings[ConfKeyUser] is sent with each request.
+	AuthSimple cloudstorage.AuthMethod = "simple"
+	// AuthDelegationToken uses a hadoop delegation token from
+	// Settings[ConfKeyDelegationToken].
+	AuthDelegationToken cloudstorage.AuthMethod = "delegation_token"
+
+	// ConfKeyNameNode config key name of the WebHDFS namenode address, ie
+	// "http://namenode:9870".
+	ConfKeyNameNode = "namenode"
+	// ConfKeyUser config key name of the hadoop user name
+	ConfKeyUser = "user"
+	// ConfKeyDelegationToken config key name of the hadoop delegation token
+	ConfKeyDelegationToken = "delegation_token"
+
+	webhdfsPrefix = "/webhdfs/v1"
+)
+
+var (
+	// ErrNoNameNode error for no namenode address
+	ErrNoNameNode = fmt.Errorf("no settings.namenode")
+	// ErrNoUser error for no settings.user
+	ErrNoUser = fmt.Errorf("no settings.user")
+	// ErrNoDelegationToken error for no settings.delegation_token
+	ErrNoDelegationToken = fmt.Errorf("no settings.delegation_token")
+
+	// Ensure we implement the optional mover
+	_ cloudstorage.StoreMove = (*FS)(nil)
+)
+
+func init() {
+	// Register this Driver (hdfs) in cloudstorage driver registry.
+	cloudstorage.Register(StoreType, func(conf *cloudstorage.Config) (cloudstorage.Store, error) {
+		return NewStore(http.DefaultClient, conf)
+	})
+}
+
+type (
+	// FS is a WebHDFS client for accessing files in hdfs.  The config
+	// Bucket is used as the root directory of the store.
+	FS struct {
+		ID        string
+		client    *http.Client
+		namenode  string
+		root      string
+		user      string
+		token     string
+		cachepath string
+	}
+
+	object struct {
+		fs         *FS
+		cachedcopy *os.File
+		name       string
+		updated    time.Time
+		size       int64
+		exists     bool
+		readonly   bool
+		opened     bool
+		cachepath  string
+		// ifNotExists creates the file without overwriting, for
+		// Opts.IfNotExists writers.
+		ifNotExists bool
+	}
+
+	// fileStatus is the WebHDFS FileStatus json object.
+	fileStatus struct {
+		PathSuffix       string `json:"pathSuffix"`
+		Type             string `json:"type"`
+		Length           int64  `json:"length"`
+		ModificationTime int64  `json:"modificationTime"`
+	}
+	fileStatusResponse struct {
+		FileStatus fileStatus `json:"FileStatus"`
+	}
+	listStatusResponse struct {
+		FileStatuses struct {
+			FileStatus []fileStatus `json:"FileStatus"`
+		} `json:"FileStatuses"`
+	}
+	remoteException struct {
+		RemoteException struct {
+			Exception string `json:"exception"`
+			Message   string `json:"message"`
+		} `json:"RemoteException"`
+	}
+)
+
+// NewStore create WebHDFS store of type cloudstorage.Store
+func NewStore(client *http.Client, conf *cloudstorage.Config) (*FS, error) {
+
+	namenode := strings.TrimRight(conf.Settings.String(ConfKeyNameNode), "/")
+	if namenode == "" {
+		return nil, ErrNoNameNode
+	}
+	if !strings.Contains(namenode, "://") {
+		namenode = "http://" + namenode
+	}
+
+	fs := &FS{
+		client:   client,
+		namenode: namenode,
+		root:     "/" + strings.Trim(conf.Bucket, "/"),
+	}
+
+	switch conf.AuthMethod {
+	case AuthSimple:
+		fs.user = conf.Settings.String(ConfKeyUser)
+		if fs.user == "" {
+			return nil, ErrNoUser
+		}
+	case AuthDelegationToken:
+		fs.token = conf.Settings.String(ConfKeyDelegationToken)
+		if fs.token == "" {
+			return nil, ErrNoDelegationToken
+		}
+	default:
+		return nil, fmt.Errorf("invalid config.AuthMethod %q", conf.AuthMethod)
+	}
+
+	if conf.TmpDir == "" {
+		return nil, fmt.Errorf("unable to create cachepath. config.tmpdir=%q", conf.TmpDir)
+	}
+	if err := os.MkdirAll(conf.TmpDir, 0775); err != nil {
+		return nil, fmt.Errorf("unable to create cachepath. config.tmpdir=%q err=%v", conf.TmpDir, err)
+	}
+
+	uid := uuid.NewUUID().String()
+	fs.ID = strings.Replace(uid, "-", "", -1)
+	cachepath, err := cloudstorage.CacheDir(conf.TmpDir, fs.ID)
+	if err != nil {
+		return nil, err
+	}
+	fs.cachepath = cachepath
+
+	return fs, nil
+}
+
+// Type of store = "hdfs"
+func (f *FS) Type() string {
+	return StoreType
+}
+
+// CleanCache removes stale cache files from the store's TmpDir, see
+// cloudstorage.CleanCache.
+func (f *FS) CleanCache(ctx context.Context, olderThan time.Duration) error {
+	return cloudstorage.CleanCache(ctx, f.cachepath, olderThan)
+}
+
+// CachePath is the cache directory of the store below its TmpDir.
+func (f *FS) CachePath() string {
+	return f.cachepath
+}
+
+// UpdatedGranularity of hdfs, modification times have milliseconds.
+func (f *FS) UpdatedGranularity() time.Duration {
+	return time.Millisecond
+}
+
+// Capabilities of hdfs.
+func (f *FS) Capabilities() cloudstorage.Capabilities {
+	return cloudstorage.Capabilities{IfNotExists: true, Concurrent: true}
+}
+
+// Client return underlying http client
+func (f *FS) Client() interface{} {
+	return f.client
+}
+
+func (f *FS) String() string {
+	return fmt.Sprintf("<hdfs namenode=%q root=%q />", f.namenode, f.root)
+}
+
+// fullpath is the absolute hdfs path of the object name.
+func (f *FS) fullpath(name string) string {
+	return pathutil.JoinKey(f.root, pathutil.CleanKey(name))
+}
+
+// opURL creates the WebHDFS url for the operation on the absolute hdfs path.
+func (f *FS) opURL(op, hdfsPath string, params url.Values) string {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("op", op)
+	if f.user != "" {
+		params.Set("user.name", f.user)
+	}
+	if f.token != "" {
+		params.Set("delegation", f.token)
+	}
+	u := url.URL{Path: webhdfsPrefix + hdfsPath}
+	return f.namenode + u.EscapedPath() + "?" + params.Encode()
+}
+
+// do executes the WebHDFS request, a 404 is returned as
+// cloudstorage.ErrObjectNotFound and other failures as the hdfs exception.
+func (f *FS) do(ctx context.Context, method, op, hdfsPath string, params url.Values, expect int) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, f.opURL(op, hdfsPath, params), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != expect {
+		defer resp.Body.Close()
+		return nil, responseError(op, hdfsPath, resp)
+	}
+	return resp, nil
+}
+
+func responseError(op, hdfsPath string, resp *http.Response) error {
+	if resp.StatusCode == http.StatusNotFound {
+		return cloudstorage.ErrObjectNotFound
+	}
+	re := &remoteException{}
+	if err := json.NewDecoder(resp.Body).Decode(re); err == nil && re.RemoteException.Exception != "" {
+		if re.RemoteException.Exception == "FileAlreadyExistsException" {
+			return cloudstorage.ErrObjectExists
+		}
+		return fmt.Errorf("hdfs %s failed path=%q status=%d err=%s: %s", op, hdfsPath,
+			resp.StatusCode, re.RemoteException.Exception, re.RemoteException.Message)
+	}
+	return fmt.Errorf("hdfs %s failed path=%q status=%d", op, hdfsPath, resp.StatusCode)
+}
+
+func (f *FS) getJSON(ctx context.Context, op, hdfsPath string, v interface{}) error {
+	resp, err := f.do(ctx, http.MethodGet, op, hdfsPath, nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (f *FS) stat(ctx context.Context, hdfsPath string) (*fileStatus, error) {
+	fs := &fileStatusResponse{}
+	if err := f.getJSON(ctx, "GETFILESTATUS", hdfsPath, fs); err != nil {
+		return nil, err
+	}
+	return &fs.FileStatus, nil
+}
+
+func (f *FS) listStatus(ctx context.Context, hdfsPath string) ([]fileStatus, error) {
+	ls := &listStatusResponse{}
+	if err := f.getJSON(ctx, "LISTSTATUS", hdfsPath, ls); err != nil {
+		return nil, err
+	}
+	return ls.FileStatuses.FileStatus, nil
+}
+
+// NewObject create a new object with given name.  Will not write to hdfs
+// until Close is called.
+func (f *FS) NewObject(objectname string, opts ...cloudstorage.Opts) (cloudstorage.Object, error) {
+	if len(opts) > 0 && opts[0].WriteThrough {
+		return cloudstorage.NewWriteThroughObject(f, objectname, opts[0])
+	}
+	obj, err := f.Get(context.Background(), objectname)
+	if err != nil && err != cloudstorage.ErrObjectNotFound {
+		return nil, err
+	} else if obj != nil {
+		if len(opts) > 0 && opts[0].Overwrite {
+			return obj, nil
+		}
+		return nil, cloudstorage.ErrObjectExists
+	}
+
+	return &object{
+		fs:        f,
+		name:      objectname,
+		cachepath: cloudstorage.CachePathObj(f.cachepath, objectname, f.ID),
+	}, nil
+}
+
+// Get a single File Object
+func (f *FS) Get(ctx context.Context, objectpath string) (cloudstorage.Object, error) {
+	st, err := f.stat(ctx, f.fullpath(objectpath))
+	if err != nil {
+		return nil, err
+	}
+	if st.Type == "DIRECTORY" {
+		return nil, cloudstorage.ErrObjectNotFound
+	}
+	return f.newObject(objectpath, st), nil
+}
+
+func (f *FS) newObject(name string, st *fileStatus) *object {
+	return &object{
+		fs:        f,
+		name:      name,
+		updated:   time.Unix(0, st.ModificationTime*int64(time.Millisecond)),
+		size:      st.Length,
+		exists:    true,
+		cachepath: cloudstorage.CachePathObj(f.cachepath, name, f.ID),
+	}
+}
+
+// Objects returns an iterator over the objects in hdfs that match the Query q.
+func (f *FS) Objects(ctx context.Context, q cloudstorage.Query) (cloudstorage.ObjectIterator, error) {
+	return cloudstorage.NewObjectPageIterator(ctx, f, q), nil
+}
+
+// List objects from hdfs, walking the directory tree below the query prefix.
+func (f *FS) List(ctx context.Context, q cloudstorage.Query) (*cloudstorage.ObjectsResponse, error) {
+
+	objs := cloudstorage.NewObjectsResponse()
+
+	dir := q.Prefix
+	if !strings.HasSuffix(dir, "/") {
+		dir = path.Dir(dir)
+		if dir == "." {
+			dir = ""
+		}
+	}
+
+	if err := f.listFiles(ctx, q, objs, strings.TrimSuffix(dir, "/")); err != nil {
+		if err == cloudstorage.ErrObjectNotFound {
+			return objs, nil
+		}
+		return nil, err
+	}
+	// list in name order like the cloud stores, iterators resume by name
+	sort.Sort(objs.Objects)
+	objs.Objects = q.ApplyFilters(objs.Objects)
+	return objs, nil
+}
+
+func (f *FS) listFiles(ctx context.Context, q cloudstorage.Query, objs *cloudstorage.ObjectsResponse, dir string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	files, err := f.listStatus(ctx, f.fullpath(dir))
+	if err != nil {
+		return err
+	}
+	for i := range files {
+		fi := &files[i]
+		name := pathutil.JoinKey(dir, fi.PathSuffix)
+		if !q.ShowHidden && strings.HasPrefix(fi.PathSuffix, ".") {
+			continue
+		}
+		if fi.Type == "DIRECTORY" {
+			// only descend into directories that may contain the prefix
+			dirName := name + "/"
+			if !strings.HasPrefix(dirName, q.Prefix) && !strings.HasPrefix(q.Prefix, dirName) {
+				continue
+			}
+			if q.Delimiter == "/" {
+				// listing starts at the prefix's own level so every
+				// sub-directory here is a common prefix.
+				objs.Prefixes = append(objs.Prefixes, dirName)
+				continue
+			}
+			if err := f.listFiles(ctx, q, objs, name); err != nil {
+				return err
+			}
+			continue
+		}
+		if !strings.HasPrefix(name, q.Prefix) {
+			continue
+		}
+		if !q.Match(name, fi.Length) {
+			continue
+		}
+		objs.Objects = append(objs.Objects, f.newObject(name, fi))
+	}
+	return nil
+}
+
+// Folders get folders list.
+func (f *FS) Folders(ctx context.Context, q cloudstorage.Query) ([]string, error) {
+	iter, err := f.FolderIterator(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+	return cloudstorage.FoldersAll(iter)
+}
+
+// FolderIterator returns an iterator over the folders below the Query prefix.
+func (f *FS) FolderIterator(ctx context.Context, q cloudstorage.Query) (cloudstorage.FolderIterator, error) {
+	return cloudstorage.NewFolderPageIterator(ctx, f, q), nil
+}
+
+// NewReader create file reader.
+func (f *FS) NewReader(o string) (io.ReadCloser, error) {
+	return f.NewReaderWithContext(context.Background(), o)
+}
+
+// NewReaderWithContext create new File reader with context.  The namenode
+// redirects the read to a datanode which the http client follows.
+func (f *FS) NewReaderWithContext(ctx context.Context, o string) (io.ReadCloser, error) {
+	resp, err := f.do(ctx, http.MethodGet, "OPEN", f.fullpath(o), nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// NewWriter create Object Writer.
+func (f *FS) NewWriter(objectName string, metadata map[string]string) (io.WriteCloser, error) {
+	return f.NewWriterWithContext(context.Background(), objectName, metadata)
+}
+
+// NewWriterWithContext create writer with provided context and metadata.
+// hdfs has no object metadata so metadata is ignored.
+func (f *FS) NewWriterWithContext(ctx context.Context, name string, metadata map[string]string, opts ...cloudstorage.Opts) (io.WriteCloser, error) {
+	if len(opts) > 0 && opts[0].IfNotExists {
+		if _, err := f.stat(ctx, f.fullpath(name)); err == nil {
+			return nil, cloudstorage.ErrObjectExists
+		} else if err != cloudstorage.ErrObjectNotFound {
+			return nil, err
+		}
+	}
+
+	o := &object{
+		fs:          f,
+		name:        name,
+		cachepath:   cloudstorage.CachePathObj(f.cachepath, name, f.ID),
+		ifNotExists: len(opts) > 0 && opts[0].IfNotExists,
+	}
+	if _, err := o.Open(cloudstorage.ReadWrite); err != nil {
+		return nil, err
+	}
+	return cloudstorage.NewResultWriter(o, nil), nil
+}
+
+// upload creates the hdfs file from the reader, overwriting an existing
+// one unless ifNotExists, which fails with ErrObjectExists.  WebHDFS create
+// is a two step operation, the namenode redirects to a datanode which
+// receives the data.
+func (f *FS) upload(ctx context.Context, name string, body io.Reader, ifNotExists bool) error {
+	hdfsPath := f.fullpath(name)
+	location, err := f.createLocation(ctx, hdfsPath, !ifNotExists)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, location, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return responseError("CREATE", hdfsPath, resp)
+	}
+	return nil
+}
+
+// createLocation asks the namenode to create hdfsPath, returning the
+// datanode location it redirects the data to.
+func (f *FS) createLocation(ctx context.Context, hdfsPath string, overwrite bool) (string, error) {
+	params := url.Values{}
+	params.Set("overwrite", strconv.FormatBool(overwrite))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, f.opURL("CREATE", hdfsPath, params), nil)
+	if err != nil {
+		return "", err
+	}
+	nr := *f.client
+	nr.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := nr.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusTemporaryRedirect {
+		return "", responseError("CREATE", hdfsPath, resp)
+	}
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return "", fmt.Errorf("hdfs CREATE path=%q missing datanode location", hdfsPath)
+	}
+	return location, nil
+}
+
+// Delete requested object path string.
+func (f *FS) Delete(ctx context.Context, name string, opts ...cloudstorage.Opts) error {
+	hdfsPath := f.fullpath(name)
+	resp, err := f.do(ctx, http.MethodDelete, "DELETE", hdfsPath, nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	result := struct {
+		Boolean bool `json:"boolean"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if !result.Boolean {
+		return cloudstorage.ErrObjectNotFound
+	}
+	return nil
+}
+
+// Move which is a Rename in hdfs, an existing destination is replaced.
+func (f *FS) Move(ctx context.Context, src, des cloudstorage.Object) error {
+	dst := f.fullpath(des.Name())
+
+	resp, err := f.do(ctx, http.MethodPut, "MKDIRS", path.Dir(dst), nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if err := f.Delete(ctx, des.Name()); err != nil && err != cloudstorage.ErrObjectNotFound {
+		return err
+	}
+
+	params := url.Values{}
+	params.Set("destination", dst)
+	resp, err = f.do(ctx, http.MethodPut, "RENAME", f.fullpath(src.Name()), params, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (o *object) Size() int64 {
+	return o.size
+}
+func (o *object) StorageSource() string {
+	return StoreType
+}
+func (o *object) Name() string {
+	return o.name
+}
+func (o *object) String() string {
+	return o.name
+}
+func (o *object) Updated() time.Time {
+	return o.updated.UTC()
+}
+
+// MetaData hdfs has no per-file metadata.
+func (o *object) MetaData() map[string]string {
+	return nil
+}
+func (o *object) SetMetaData(meta map[string]string) {}
+
+func (o *object) DisableCompression() {}
+
+// Open copies the hdfs file to the local cache for reading/writing.
+func (o *object) Open(accesslevel cloudstorage.AccessLevel) (*os.File, error) {
+	if o.opened {
+		return nil, fmt.Errorf("the store object is already opened. %s", o.name)
+	}
+
+	if err := cloudstorage.EnsureDir(o.cachepath); err != nil {
+		return nil, fmt.Errorf("could not create cachedcopy's dir. cachepath=%q err=%v", o.cachepath, err)
+	}
+
+	cachedcopy, err := os.Create(o.cachepath)
+	if err != nil {
+		return nil, fmt.Errorf("could not create cachedcopy file. cachepath=%q err=%v", o.cachepath, err)
+	}
+
+	if o.exists {
+		rc, err := o.fs.NewReader(o.name)
+		if err != nil {
+			cachedcopy.Close()
+			return nil, fmt.Errorf("error opening hdfs file. object=%q err=%v", o.name, err)
+		}
+		_, err = io.Copy(cachedcopy, rc)
+		rc.Close()
+		if err != nil {
+			cachedcopy.Close()
+			return nil, fmt.Errorf("error copying hdfs file. object=%q err=%v", o.name, err)
+		}
+		if _, err := cachedcopy.Seek(0, io.SeekStart); err != nil {
+			cachedcopy.Close()
+			return nil, fmt.Errorf("error seeking to start of cachedcopy err=%v", err)
+		}
+	}
+
+	o.cachedcopy = cachedcopy
+	o.readonly = accesslevel == cloudstorage.ReadOnly
+	o.opened = true
+	return o.cachedcopy, nil
+}
+
+// Delete the hdfs file and local cached copy.
+func (o *object) Delete() error {
+	if err := o.Release(); err != nil {
+		gou.Errorf("could not release %v", err)
+	}
+	return o.fs.Delete(context.Background(), o.name)
+}
+
+// Sync uploads the local cached copy to hdfs.
+func (o *object) Sync() error {
+	if !o.opened {
+		return fmt.Errorf("object isn't opened object:%s", o.name)
+	}
+	if o.readonly {
+		return fmt.Errorf("trying to Sync a readonly object:%s", o.name)
+	}
+
+	cachedcopy, err := os.Open(o.cachepath)
+	if err != nil {
+		return fmt.Errorf("couldn't open localfile for sync'ing. local=%s err=%v", o.cachepath, err)
+	}
+	defer cachedcopy.Close()
+
+	if err := o.fs.upload(context.Background(), o.name, cachedcopy, o.ifNotExists); err != nil {
+		gou.Warnf("could not upload %q err=%v", o.name, err)
+		return err
+	}
+	// the file is ours now, later syncs overwrite it
+	o.ifNotExists = false
+	o.exists = true
+	o.updated = time.Now()
+	return nil
+}
+
+func (o *object) Close() error {
+	if !o.opened {
+		return nil
+	}
+	defer func() {
+		os.Remove(o.cachepath)
+		o.cachedcopy = nil
+		o.opened = false
+	}()
+
+	if !o.readonly {
+		if err := o.cachedcopy.Sync(); err != nil {
+			return err
+		}
+	}
+	if err := o.cachedcopy.Close(); err != nil {
+		if !strings.Contains(err.Error(), os.ErrClosed.Error()) {
+			return err
+		}
+	}
+	if !o.readonly {
+		return o.Sync()
+	}
+	return nil
+}
+
+func (o *object) Release() error {
+	if o.cachedcopy != nil {
+		o.cachedcopy.Close()
+		o.cachedcopy = nil
+		o.opened = false
+	}
+	// most likely this doesn't exist so don't return error
+	os.Remove(o.cachepath)
+	return nil
+}
+
+func (o *object) File() *os.File {
+	return o.cachedcopy
+}
+func (o *object) Read(p []byte) (n int, err error) {
+	return o.cachedcopy.Read(p)
+}
+func (o *object) Write(p []byte) (n int, err error) {
+	if o.cachedcopy == nil {
+		if _, err := o.Open(cloudstorage.ReadWrite); err != nil {
+			return 0, err
+		}
+	}
+	return o.cachedcopy.Write(p)
+}
@@ -0,0 +1,233 @@
+package hdfs_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/araddon/gou"
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/hdfs"
+	"github.com/lytics/cloudstorage/testutils"
+)
+
+/*
+
+# to use hdfs tests against a real cluster ensure you have exported
+
+export HDFS_NAMENODE="http://localhost:9870"
+export HDFS_USER="hadoop"
+
+otherwise tests run against a fake WebHDFS server.
+
+*/
+
+// fakeWebHDFS implements the subset of the WebHDFS api the store uses,
+// backed by a local directory.
+func fakeWebHDFS(t *testing.T, root string) *httptest.Server {
+	var srv *httptest.Server
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+	notFound := func(w http.ResponseWriter, p string) {
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(w, map[string]interface{}{"RemoteException": map[string]string{
+			"exception": "FileNotFoundException", "message": "File does not exist: " + p}})
+	}
+	status := func(fi os.FileInfo, suffix string) map[string]interface{} {
+		typ := "FILE"
+		if fi.IsDir() {
+			typ = "DIRECTORY"
+		}
+		return map[string]interface{}{"pathSuffix": suffix, "type": typ, "length": fi.Size(),
+			"modificationTime": fi.ModTime().UnixNano() / 1e6}
+	}
+	mux.HandleFunc("/webhdfs/v1/", func(w http.ResponseWriter, r *http.Request) {
+		p := strings.TrimPrefix(r.URL.Path, "/webhdfs/v1")
+		local := filepath.Join(root, filepath.FromSlash(p))
+		switch r.URL.Query().Get("op") {
+		case "GETFILESTATUS":
+			fi, err := os.Stat(local)
+			if err != nil {
+				notFound(w, p)
+				return
+			}
+			writeJSON(w, map[string]interface{}{"FileStatus": status(fi, "")})
+		case "LISTSTATUS":
+			entries, err := os.ReadDir(local)
+			if err != nil {
+				notFound(w, p)
+				return
+			}
+			list := make([]interface{}, 0)
+			for _, e := range entries {
+				fi, _ := e.Info()
+				list = append(list, status(fi, e.Name()))
+			}
+			writeJSON(w, map[string]interface{}{"FileStatuses": map[string]interface{}{"FileStatus": list}})
+		case "OPEN":
+			f, err := os.Open(local)
+			if err != nil {
+				notFound(w, p)
+				return
+			}
+			defer f.Close()
+			io.Copy(w, f)
+		case "CREATE":
+			if r.URL.Query().Get("datanode") == "" {
+				q := r.URL.Query()
+				q.Set("datanode", "true")
+				w.Header().Set("Location", srv.URL+r.URL.Path+"?"+q.Encode())
+				w.WriteHeader(http.StatusTemporaryRedirect)
+				return
+			}
+			if _, err := os.Stat(local); err == nil && r.URL.Query().Get("overwrite") == "false" {
+				w.WriteHeader(http.StatusForbidden)
+				writeJSON(w, map[string]interface{}{"RemoteException": map[string]string{
+					"exception": "FileAlreadyExistsException", "message": p + " already exists"}})
+				return
+			}
+			os.MkdirAll(filepath.Dir(local), 0775)
+			f, err := os.Create(local)
+			require.NoError(t, err)
+			io.Copy(f, r.Body)
+			f.Close()
+			w.WriteHeader(http.StatusCreated)
+		case "MKDIRS":
+			writeJSON(w, map[string]bool{"boolean": os.MkdirAll(local, 0775) == nil})
+		case "RENAME":
+			dst := filepath.Join(root, filepath.FromSlash(r.URL.Query().Get("destination")))
+			writeJSON(w, map[string]bool{"boolean": os.Rename(local, dst) == nil})
+		case "DELETE":
+			_, err := os.Stat(local)
+			writeJSON(w, map[string]bool{"boolean": err == nil && os.RemoveAll(local) == nil})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+	srv = httptest.NewServer(mux)
+	return srv
+}
+
+func TestConfig(t *testing.T) {
+	conf := &cloudstorage.Config{
+		Type:       hdfs.StoreType,
+		AuthMethod: hdfs.AuthSimple,
+		Bucket:     "tests",
+		TmpDir:     t.TempDir(),
+		Settings:   make(gou.JsonHelper),
+	}
+	_, err := cloudstorage.NewStore(conf)
+	require.Equal(t, hdfs.ErrNoNameNode, err)
+
+	conf.Settings[hdfs.ConfKeyNameNode] = "localhost:9870"
+	_, err = cloudstorage.NewStore(conf)
+	require.Equal(t, hdfs.ErrNoUser, err)
+
+	conf.AuthMethod = hdfs.AuthDelegationToken
+	_, err = cloudstorage.NewStore(conf)
+	require.Equal(t, hdfs.ErrNoDelegationToken, err)
+
+	conf.AuthMethod = "bad"
+	_, err = cloudstorage.NewStore(conf)
+	require.Error(t, err)
+}
+
+func TestAll(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf := &cloudstorage.Config{
+		Type:       hdfs.StoreType,
+		AuthMethod: hdfs.AuthSimple,
+		Bucket:     "cloudstorage-tests",
+		TmpDir:     filepath.Join(tmpDir, "localcache", "hdfs"),
+		Settings:   make(gou.JsonHelper),
+	}
+	if namenode := os.Getenv("HDFS_NAMENODE"); namenode != "" {
+		conf.Settings[hdfs.ConfKeyNameNode] = namenode
+		conf.Settings[hdfs.ConfKeyUser] = os.Getenv("HDFS_USER")
+	} else {
+		srv := fakeWebHDFS(t, filepath.Join(tmpDir, "mockhdfs"))
+		defer srv.Close()
+		conf.Settings[hdfs.ConfKeyNameNode] = srv.URL
+		conf.Settings[hdfs.ConfKeyUser] = "tester"
+	}
+
+	store, err := cloudstorage.NewStore(conf)
+	require.NoError(t, err)
+	testutils.RunTests(t, store, conf)
+}
+
+func TestIfNotExistsRace(t *testing.T) {
+	tmpDir := t.TempDir()
+	srv := fakeWebHDFS(t, filepath.Join(tmpDir, "mockhdfs"))
+	defer srv.Close()
+	newStore := func(cache string) cloudstorage.Store {
+		store, err := cloudstorage.NewStore(&cloudstorage.Config{
+			Type:       hdfs.StoreType,
+			AuthMethod: hdfs.AuthSimple,
+			Bucket:     "tests",
+			TmpDir:     filepath.Join(tmpDir, cache),
+			Settings:   gou.JsonHelper{hdfs.ConfKeyNameNode: srv.URL, hdfs.ConfKeyUser: "tester"},
+		})
+		require.NoError(t, err)
+		return store
+	}
+	store, other := newStore("localcache"), newStore("othercache")
+	ctx := context.Background()
+
+	w, err := store.NewWriterWithContext(ctx, "once.csv", nil, cloudstorage.Opts{IfNotExists: true})
+	require.NoError(t, err)
+	_, err = w.Write([]byte("mine\n"))
+	require.NoError(t, err)
+	// created by someone else after the writer was opened
+	require.NoError(t, cloudstorage.WriteAll(ctx, other, "once.csv", []byte("theirs\n"), nil))
+	require.ErrorIs(t, w.Close(), cloudstorage.ErrObjectExists)
+
+	b, err := cloudstorage.ReadAll(ctx, store, "once.csv")
+	require.NoError(t, err)
+	require.Equal(t, "theirs\n", string(b))
+}
+
+func TestCreateError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("op") == "CREATE" {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]interface{}{"RemoteException": map[string]string{
+				"exception": "AccessControlException", "message": "Permission denied: user=tester"}})
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	conf := &cloudstorage.Config{
+		Type:       hdfs.StoreType,
+		AuthMethod: hdfs.AuthSimple,
+		Bucket:     "tests",
+		TmpDir:     t.TempDir(),
+		Settings:   gou.JsonHelper{hdfs.ConfKeyNameNode: srv.URL, hdfs.ConfKeyUser: "tester"},
+	}
+	store, err := cloudstorage.NewStore(conf)
+	require.NoError(t, err)
+
+	w, err := store.NewWriterWithContext(context.Background(), "denied.csv", nil)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("a,b\n"))
+	require.NoError(t, err)
+	err = w.Close()
+	require.Error(t, err)
+	// the RemoteException is read before the response is closed
+	require.Contains(t, err.Error(), "AccessControlException: Permission denied")
+}
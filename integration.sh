@@ -0,0 +1,10 @@
+#!/usr/bin/env bash
+
+set -e
+
+compose="docker compose -f integration/docker-compose.yml"
+
+$compose up -d --wait
+trap "$compose down -v" EXIT
+
+go test -tags=integration -p 1 -count=1 ./integration/...
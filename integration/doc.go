@@ -0,0 +1,14 @@
+// Package integration runs the conformance suite against emulated backends
+// of the cloud stores, started with docker compose:
+//
+//	./integration.sh
+//
+// or by hand:
+//
+//	docker compose -f integration/docker-compose.yml up -d --wait
+//	go test -tags=integration -p 1 ./integration/...
+//
+// The tests are only built with the integration tag, the endpoints default
+// to the ports of docker-compose.yml and can be overridden with the
+// MINIO_ENDPOINT, GCS_ENDPOINT, SFTP_HOST and SFTP_PORT env vars.
+package integration
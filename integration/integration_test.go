@@ -0,0 +1,130 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	az "github.com/Azure/azure-sdk-for-go/storage"
+	"github.com/araddon/gou"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/awss3"
+	"github.com/lytics/cloudstorage/azure"
+	"github.com/lytics/cloudstorage/conformance"
+	"github.com/lytics/cloudstorage/google"
+	"github.com/lytics/cloudstorage/sftp"
+)
+
+const bucket = "cloudstorage-integration"
+
+func env(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+func TestMinio(t *testing.T) {
+	conf := &cloudstorage.Config{
+		Type:       awss3.StoreType,
+		AuthMethod: awss3.AuthAccessKey,
+		Bucket:     bucket,
+		Endpoint:   env("MINIO_ENDPOINT", "http://localhost:9000"),
+		TmpDir:     t.TempDir(),
+		Settings:   make(gou.JsonHelper),
+	}
+	conf.Settings[awss3.ConfKeyAccessKey] = "minioadmin"
+	conf.Settings[awss3.ConfKeyAccessSecret] = "minioadmin"
+	conf.Settings[awss3.ConfKeyForcePathStyle] = true
+	conf.Settings[awss3.ConfKeyDisableSSL] = true
+
+	client, _, err := awss3.NewClient(conf)
+	require.NoError(t, err)
+	_, err = client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String(bucket)})
+	var aerr awserr.Error
+	if err != nil && !(errors.As(err, &aerr) && aerr.Code() == s3.ErrCodeBucketAlreadyOwnedByYou) {
+		require.NoError(t, err)
+	}
+
+	store, err := cloudstorage.NewStore(conf)
+	require.NoError(t, err)
+	conformance.Run(t, store, conf)
+}
+
+func TestAzurite(t *testing.T) {
+	conf := &cloudstorage.Config{
+		Type:       azure.StoreType,
+		AuthMethod: azure.AuthKey,
+		// the emulator account is served by Azurite on 127.0.0.1:10000
+		Project:  az.StorageEmulatorAccountName,
+		Bucket:   bucket,
+		TmpDir:   t.TempDir(),
+		Settings: make(gou.JsonHelper),
+	}
+	conf.Settings[azure.ConfKeyAuthKey] = az.StorageEmulatorAccountKey
+
+	_, blobClient, err := azure.NewClient(conf)
+	require.NoError(t, err)
+	_, err = blobClient.GetContainerReference(bucket).CreateIfNotExists(nil)
+	require.NoError(t, err)
+
+	store, err := cloudstorage.NewStore(conf)
+	require.NoError(t, err)
+	conformance.Run(t, store, conf)
+}
+
+func TestFakeGCS(t *testing.T) {
+	conf := &cloudstorage.Config{
+		Type:       google.StoreType,
+		AuthMethod: google.AuthAnonymous,
+		Project:    "integration",
+		Bucket:     bucket,
+		Endpoint:   env("GCS_ENDPOINT", "http://localhost:4443/storage/v1/"),
+		TmpDir:     t.TempDir(),
+	}
+
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx, option.WithEndpoint(conf.Endpoint), option.WithoutAuthentication())
+	require.NoError(t, err)
+	defer client.Close()
+	err = client.Bucket(bucket).Create(ctx, conf.Project, nil)
+	var gerr *googleapi.Error
+	if err != nil && !(errors.As(err, &gerr) && gerr.Code == http.StatusConflict) {
+		require.NoError(t, err)
+	}
+
+	store, err := cloudstorage.NewStore(conf)
+	require.NoError(t, err)
+	conformance.Run(t, store, conf)
+}
+
+func TestSftp(t *testing.T) {
+	conf := &cloudstorage.Config{
+		Type:       sftp.StoreType,
+		AuthMethod: sftp.AuthUserPass,
+		TmpDir:     t.TempDir(),
+		Settings:   make(gou.JsonHelper),
+	}
+	conf.Settings[sftp.ConfKeyUser] = "cloudstorage"
+	conf.Settings[sftp.ConfKeyPassword] = "cloudstorage"
+	conf.Settings[sftp.ConfKeyHost] = env("SFTP_HOST", "localhost")
+	conf.Settings[sftp.ConfKeyPort] = env("SFTP_PORT", "2222")
+	// the only directory of the chrooted user writable by it
+	conf.Settings[sftp.ConfKeyFolder] = "upload"
+
+	store, err := cloudstorage.NewStore(conf)
+	require.NoError(t, err)
+	conformance.Run(t, store, conf)
+}
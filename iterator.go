@@ -1,9 +1,8 @@
 package cloudstorage
 
 import (
-	"math"
-	"math/rand"
-	"time"
+	"fmt"
+	"net/url"
 
 	"golang.org/x/net/context"
 	"google.golang.org/api/iterator"
@@ -33,28 +32,162 @@ func ObjectResponseFromIter(iter ObjectIterator) (*ObjectsResponse, error) {
 	return &ObjectsResponse{Objects: objs}, nil
 }
 
+// ObjectsChan streams the objects matching q on the returned channel, which
+// holds up to buffer objects so listing only runs ahead of the consumers by
+// that much.  Both channels are closed once the listing ends, the error
+// channel first receiving the error if it failed.  Cancelling ctx stops the
+// listing, with ctx.Err() as the error, so consumers that stop reading
+// early must cancel it to release the listing goroutine.
+func ObjectsChan(ctx context.Context, store StoreReader, q Query, buffer int) (<-chan Object, <-chan error) {
+	// the consumers own the objects sent
+	q.Reuse = false
+	objc := make(chan Object, buffer)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(objc)
+		defer close(errc)
+		iter, err := store.Objects(ctx, q)
+		if err != nil {
+			errc <- err
+			return
+		}
+		defer iter.Close()
+		for {
+			o, err := iter.Next()
+			if err == iterator.Done {
+				return
+			} else if err != nil {
+				errc <- err
+				return
+			}
+			select {
+			case objc <- o:
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			}
+		}
+	}()
+	return objc, errc
+}
+
+// Cursor is the position of a ResumableIterator, the objects listed after
+// the object named After in the page fetched with Marker.  Pages list
+// objects in name order so the position holds when objects are added or
+// deleted meanwhile.
+type Cursor struct {
+	// Marker of the page, "" for the first one.
+	Marker string
+	// After is the name of the last object returned, "" for none.
+	After string
+}
+
+// String encodes the cursor, see ParseCursor.
+func (c Cursor) String() string {
+	v := url.Values{}
+	if c.Marker != "" {
+		v.Set("marker", c.Marker)
+	}
+	if c.After != "" {
+		v.Set("after", c.After)
+	}
+	return v.Encode()
+}
+
+// ParseCursor decodes a Cursor.String().
+func ParseCursor(s string) (Cursor, error) {
+	v, err := url.ParseQuery(s)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("invalid cursor %q: %v", s, err)
+	}
+	return Cursor{Marker: v.Get("marker"), After: v.Get("after")}, nil
+}
+
 // ObjectPageIterator iterator to facilitate easy paging through store.List() method
 // to read all Objects that matched query.
 type ObjectPageIterator struct {
-	s      Store
-	ctx    context.Context
-	cancel context.CancelFunc
-	q      Query
-	cursor int
-	page   Objects
+	s       Store
+	ctx     context.Context
+	cancel  context.CancelFunc
+	q       Query
+	cursor  int
+	page    Objects
+	fetched bool
+	pending chan pageResult
+	// pageMarker the page was fetched with and pageAfter the name its
+	// objects were listed after when resumed.
+	pageMarker string
+	pageAfter  string
+	// after is the name of the last object returned before Resume, the
+	// objects up to it are dropped from the next pages.
+	after string
+	// recycler takes the pages of a Query.Reuse listing that are done.
+	recycler ObjectRecycler
+}
+
+var _ ResumableIterator = (*ObjectPageIterator)(nil)
+
+// pageResult is a page fetched in the background for Query.Prefetch.
+type pageResult struct {
+	resp *ObjectsResponse
+	err  error
 }
 
 // NewObjectPageIterator create an iterator that wraps the store List interface.
+// The pages are q.PageSize objects (the store default if 0), with
+// q.Prefetch the next page is fetched while the current one is consumed so
+// fast consumers aren't stalled between pages.  With q.Reuse the pages
+// done with are handed back to the store if it is an ObjectRecycler.
 func NewObjectPageIterator(ctx context.Context, s Store, q Query) ObjectIterator {
 
 	cancelCtx, cancel := context.WithCancel(ctx)
-	return &ObjectPageIterator{
-		s:      s,
-		ctx:    cancelCtx,
-		cancel: cancel,
-		q:      q,
+	it := &ObjectPageIterator{
+		s:          s,
+		ctx:        cancelCtx,
+		cancel:     cancel,
+		q:          q,
+		pageMarker: q.Marker,
 	}
+	if r, ok := s.(ObjectRecycler); ok && q.Reuse {
+		it.recycler = r
+	}
+	return it
+}
+
+// Cursor of the position after the last object returned by Next.
+func (it *ObjectPageIterator) Cursor() string {
+	if it.fetched && it.cursor >= len(it.page) && it.q.Marker != "" {
+		// the page is done, resume from the next one
+		return Cursor{Marker: it.q.Marker, After: it.after}.String()
+	}
+	c := Cursor{Marker: it.pageMarker, After: it.pageAfter}
+	if !it.fetched {
+		c.After = it.after
+	} else if it.cursor > 0 {
+		c.After = it.page[it.cursor-1].Name()
+	}
+	return c.String()
 }
+
+// Resume iterating from cursor, the Cursor of an iterator of the same query,
+// the store and query of this iterator are kept.
+func (it *ObjectPageIterator) Resume(cursor string) error {
+	c, err := ParseCursor(cursor)
+	if err != nil {
+		return err
+	}
+	it.q.Marker = c.Marker
+	it.pageMarker = c.Marker
+	it.pageAfter = ""
+	it.after = c.After
+	it.page = nil
+	it.cursor = 0
+	it.fetched = false
+	// a prefetched page is for the former position
+	it.pending = nil
+	return nil
+}
+
 func (it *ObjectPageIterator) returnPageNext() (Object, error) {
 	it.cursor++
 	return it.page[it.cursor-1], nil
@@ -68,62 +201,198 @@ func (it *ObjectPageIterator) Close() {
 		// done
 	default:
 		it.cancel()
+		it.recycle()
 	}
 }
 
+// recycle the current page of a Query.Reuse listing.
+func (it *ObjectPageIterator) recycle() {
+	if it.recycler != nil && len(it.page) > 0 {
+		it.recycler.Recycle(it.page)
+	}
+	it.page = nil
+	it.cursor = 0
+}
+
 // Next iterator to go to next object or else returns error for done.
 func (it *ObjectPageIterator) Next() (Object, error) {
-	retryCt := 0
-
 	select {
 	case <-it.ctx.Done():
 		// If iterator has been closed
 		return nil, it.ctx.Err()
 	default:
+	}
+	for {
 		if it.cursor < len(it.page) {
 			return it.returnPageNext()
-		} else if it.cursor > 0 && it.q.Marker == "" {
+		} else if it.fetched && it.q.Marker == "" {
 			// no new page, lets return
 			return nil, iterator.Done
 		}
+		var resp *ObjectsResponse
+		var err error
+		it.pageMarker = it.q.Marker
+		if it.pending != nil {
+			r := <-it.pending
+			it.pending = nil
+			resp, err = r.resp, r.err
+		} else {
+			resp, err = it.list(it.q)
+		}
+		if err != nil {
+			return nil, err
+		}
+		// delimited pages may hold only prefixes, so an empty page with a
+		// marker goes on to the next one
+		it.recycle()
+		it.fetched = true
+		it.page = resp.Objects
+		it.cursor = 0
+		it.pageAfter = it.after
+		if it.after != "" {
+			// pages list in name order, once one has objects after the
+			// resumed position the next ones do too
+			if it.page = objectsAfter(it.page, it.after); len(it.page) > 0 {
+				it.after = ""
+			}
+		}
+		it.q.Marker = resp.NextMarker
+		if it.q.Prefetch && it.q.Marker != "" {
+			it.pending = make(chan pageResult, 1)
+			go func(q Query, pending chan<- pageResult) {
+				resp, err := it.list(q)
+				pending <- pageResult{resp, err}
+			}(it.q, it.pending)
+		}
+	}
+}
+
+// objectsAfter are the objects named after name.
+func objectsAfter(objects Objects, name string) Objects {
+	after := make(Objects, 0, len(objects))
+	for _, o := range objects {
+		if o.Name() > name {
+			after = append(after, o)
+		}
+	}
+	return after
+}
+
+// list fetches the page of q, retrying transient errors.
+func (it *ObjectPageIterator) list(q Query) (*ObjectsResponse, error) {
+	bo := NewBackoffer(BackoffProfileOf(it.s))
+	retryCt := 0
+	for {
+		resp, err := it.s.List(it.ctx, q)
+		if err == nil {
+			return resp, nil
+		} else if err == iterator.Done {
+			return nil, err
+		} else if err == context.Canceled || err == context.DeadlineExceeded {
+			// Return to user
+			return nil, err
+		}
+		if retryCt >= 5 || !IsTransient(it.s, err) || !bo.Wait(it.ctx) {
+			return nil, err
+		}
+		retryCt++
+	}
+}
+
+// FoldersAll get all folders for an iterator.
+func FoldersAll(iter FolderIterator) ([]string, error) {
+	folders := make([]string, 0)
+	for {
+		f, err := iter.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		folders = append(folders, f)
+	}
+	return folders, nil
+}
+
+// FolderPageIterator iterator to facilitate easy paging through the Prefixes
+// of a delimited store.List() to read all folders below the query prefix.
+type FolderPageIterator struct {
+	s      Store
+	ctx    context.Context
+	cancel context.CancelFunc
+	q      Query
+	cursor int
+	page   []string
+}
+
+// NewFolderPageIterator create a folder iterator that wraps the store List
+// interface, the query Delimiter defaults to "/".
+func NewFolderPageIterator(ctx context.Context, s Store, q Query) FolderIterator {
+	if q.Delimiter == "" {
+		q.Delimiter = "/"
+	}
+	cancelCtx, cancel := context.WithCancel(ctx)
+	return &FolderPageIterator{
+		s:      s,
+		ctx:    cancelCtx,
+		cancel: cancel,
+		q:      q,
+	}
+}
+
+// Close the folder iterator.
+func (it *FolderPageIterator) Close() {
+	defer func() { recover() }()
+	select {
+	case <-it.ctx.Done():
+		// done
+	default:
+		it.cancel()
+	}
+}
+
+// Next iterator to go to next folder or else returns error for done.
+func (it *FolderPageIterator) Next() (string, error) {
+	bo := NewBackoffer(BackoffProfileOf(it.s))
+	retryCt := 0
+
+	select {
+	case <-it.ctx.Done():
+		// If iterator has been closed
+		return "", it.ctx.Err()
+	default:
+		if it.cursor < len(it.page) {
+			it.cursor++
+			return it.page[it.cursor-1], nil
+		} else if it.cursor > 0 && it.q.Marker == "" {
+			// no new page, lets return
+			return "", iterator.Done
+		}
 		for {
 			resp, err := it.s.List(it.ctx, it.q)
 			if err == nil {
-				it.page = resp.Objects
+				it.page = resp.Prefixes
 				it.cursor = 0
 				it.q.Marker = resp.NextMarker
 				if len(it.page) == 0 {
-					return nil, iterator.Done
+					if it.q.Marker != "" {
+						// page held only objects
+						continue
+					}
+					return "", iterator.Done
 				}
-				return it.returnPageNext()
+				it.cursor++
+				return it.page[0], nil
 			} else if err == iterator.Done {
-				return nil, err
+				return "", err
 			} else if err == context.Canceled || err == context.DeadlineExceeded {
 				// Return to user
-				return nil, err
+				return "", err
 			}
-			if retryCt < 5 {
-				Backoff(retryCt)
-			} else {
-				return nil, err
+			if retryCt >= 5 || !IsTransient(it.s, err) || !bo.Wait(it.ctx) {
+				return "", err
 			}
 			retryCt++
 		}
 	}
 }
-
-// Backoff sleeps a random amount so we can.
-// retry failed requests using a randomized exponential backoff:
-// wait a random period between [0..1] seconds and retry; if that fails,
-// wait a random period between [0..2] seconds and retry; if that fails,
-// wait a random period between [0..4] seconds and retry, and so on,
-// with an upper bounds to the wait period being 16 seconds.
-// http://play.golang.org/p/l9aUHgiR8J
-func Backoff(try int) {
-	nf := math.Pow(2, float64(try))
-	nf = math.Max(1, nf)
-	nf = math.Min(nf, 16)
-	r := rand.Int31n(int32(nf))
-	d := time.Duration(r) * time.Second
-	time.Sleep(d)
-}
@@ -0,0 +1,265 @@
+package cloudstorage_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/localfs"
+	"github.com/lytics/cloudstorage/mockstore"
+	"github.com/lytics/cloudstorage/testutils"
+)
+
+func TestObjectsChan(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "mockcloud"),
+		TmpDir:     filepath.Join(tmpDir, "localcache"),
+		Bucket:     "chan",
+	})
+	require.NoError(t, err)
+	var want []string
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("logs/%02d.log", i)
+		require.NoError(t, testutils.MockFile(store, name, "x"))
+		want = append(want, name)
+	}
+
+	ctx := context.Background()
+	objc, errc := cloudstorage.ObjectsChan(ctx, store, cloudstorage.NewQuery("logs/"), 2)
+	var mu sync.Mutex
+	var got []string
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for o := range objc {
+				mu.Lock()
+				got = append(got, o.Name())
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, <-errc)
+	sort.Strings(got)
+	require.Equal(t, want, got)
+
+	// a consumer stopping early cancels the listing
+	cctx, cancel := context.WithCancel(ctx)
+	objc, errc = cloudstorage.ObjectsChan(cctx, store, cloudstorage.NewQuery("logs/"), 0)
+	<-objc
+	cancel()
+	for range objc {
+	}
+	require.Equal(t, context.Canceled, <-errc)
+}
+
+// pagedStore lists its objects in pages of pageSize, counting the calls.
+type pagedStore struct {
+	cloudstorage.Store
+	objs  cloudstorage.Objects
+	mu    sync.Mutex
+	calls int
+	sizes []int
+}
+
+func (s *pagedStore) List(ctx context.Context, q cloudstorage.Query) (*cloudstorage.ObjectsResponse, error) {
+	s.mu.Lock()
+	s.calls++
+	s.sizes = append(s.sizes, q.PageSize)
+	s.mu.Unlock()
+	start := 0
+	if q.Marker != "" {
+		fmt.Sscanf(q.Marker, "%d", &start)
+	}
+	end := start + q.PageSize
+	resp := cloudstorage.NewObjectsResponse()
+	if end >= len(s.objs) {
+		end = len(s.objs)
+	} else {
+		resp.NextMarker = fmt.Sprintf("%d", end)
+	}
+	resp.Objects = s.objs[start:end]
+	return resp, nil
+}
+
+func (s *pagedStore) listCalls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func TestObjectPageIteratorPrefetch(t *testing.T) {
+	tmpDir := t.TempDir()
+	local, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "mockcloud"),
+		TmpDir:     filepath.Join(tmpDir, "localcache"),
+		Bucket:     "prefetch",
+	})
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, testutils.MockFile(local, fmt.Sprintf("logs/%02d.log", i), "x"))
+	}
+	ctx := context.Background()
+	all, err := local.List(ctx, cloudstorage.NewQuery("logs/"))
+	require.NoError(t, err)
+	sort.Sort(all.Objects)
+
+	for _, prefetch := range []bool{false, true} {
+		store := &pagedStore{Store: local, objs: all.Objects}
+		q := cloudstorage.NewQuery("logs/")
+		q.PageSize = 4
+		q.Prefetch = prefetch
+		iter := cloudstorage.NewObjectPageIterator(ctx, store, q)
+
+		o, err := iter.Next()
+		require.NoError(t, err)
+		require.Equal(t, "logs/00.log", o.Name())
+		if prefetch {
+			// the second page is fetched before the first is consumed
+			require.Eventually(t, func() bool { return store.listCalls() == 2 }, time.Second, time.Millisecond)
+		} else {
+			require.Equal(t, 1, store.listCalls())
+		}
+
+		objs, err := cloudstorage.ObjectsAll(iter)
+		require.NoError(t, err)
+		require.Equal(t, 9, len(objs))
+		require.Equal(t, "logs/09.log", objs[8].Name())
+		require.Equal(t, 3, store.listCalls())
+		require.Equal(t, []int{4, 4, 4}, store.sizes)
+		iter.Close()
+	}
+}
+
+// recyclingStore records the objects of the pages recycled.
+type recyclingStore struct {
+	*pagedStore
+	recycled []string
+}
+
+func (s *recyclingStore) Recycle(objs cloudstorage.Objects) {
+	for _, o := range objs {
+		s.recycled = append(s.recycled, o.Name())
+	}
+}
+
+func TestObjectPageIteratorReuse(t *testing.T) {
+	ctx := context.Background()
+	mock := mockstore.New()
+	for i := 0; i < 6; i++ {
+		require.NoError(t, testutils.MockFile(mock, fmt.Sprintf("logs/%02d.log", i), "x"))
+	}
+	all, err := mock.List(ctx, cloudstorage.NewQuery("logs/"))
+	require.NoError(t, err)
+	sort.Sort(all.Objects)
+
+	for _, reuse := range []bool{false, true} {
+		store := &recyclingStore{pagedStore: &pagedStore{Store: mock, objs: all.Objects}}
+		q := cloudstorage.NewQuery("logs/")
+		q.PageSize = 4
+		q.Reuse = reuse
+		iter := cloudstorage.NewObjectPageIterator(ctx, store, q)
+		for i := 0; i < 5; i++ {
+			o, err := iter.Next()
+			require.NoError(t, err)
+			require.Equal(t, fmt.Sprintf("logs/%02d.log", i), o.Name())
+		}
+		iter.Close()
+		if !reuse {
+			// the caller owns the objects
+			require.Nil(t, store.recycled)
+			continue
+		}
+		// the first page once the second was fetched, the second on Close
+		require.Equal(t, []string{
+			"logs/00.log", "logs/01.log", "logs/02.log", "logs/03.log",
+			"logs/04.log", "logs/05.log",
+		}, store.recycled)
+	}
+}
+
+func TestObjectPageIteratorResume(t *testing.T) {
+	tmpDir := t.TempDir()
+	local, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "mockcloud"),
+		TmpDir:     filepath.Join(tmpDir, "localcache"),
+		Bucket:     "resume",
+	})
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, testutils.MockFile(local, fmt.Sprintf("logs/%02d.log", i), "x"))
+	}
+	ctx := context.Background()
+	all, err := local.List(ctx, cloudstorage.NewQuery("logs/"))
+	require.NoError(t, err)
+
+	names := func(iter cloudstorage.ObjectIterator, n int) []string {
+		var got []string
+		for ; n > 0; n-- {
+			o, err := iter.Next()
+			require.NoError(t, err)
+			got = append(got, o.Name())
+		}
+		return got
+	}
+	resumed := func(cursor string) []string {
+		q := cloudstorage.NewQuery("logs/")
+		q.PageSize = 4
+		q.Prefetch = true
+		iter := cloudstorage.NewObjectPageIterator(ctx, &pagedStore{Store: local, objs: all.Objects}, q)
+		defer iter.Close()
+		require.NoError(t, iter.(cloudstorage.ResumableIterator).Resume(cursor))
+		objs, err := cloudstorage.ObjectsAll(iter)
+		require.NoError(t, err)
+		var got []string
+		for _, o := range objs {
+			got = append(got, o.Name())
+		}
+		return got
+	}
+
+	for _, n := range []int{0, 3, 4, 10} {
+		q := cloudstorage.NewQuery("logs/")
+		q.PageSize = 4
+		store := &pagedStore{Store: local, objs: all.Objects}
+		iter := cloudstorage.NewObjectPageIterator(ctx, store, q).(cloudstorage.ResumableIterator)
+		got := names(iter, n)
+		cursor := iter.Cursor()
+		iter.Close()
+
+		c, err := cloudstorage.ParseCursor(cursor)
+		require.NoError(t, err)
+		if n == 4 {
+			// the first page is done, the cursor is the second one's
+			require.Equal(t, cloudstorage.Cursor{Marker: "4"}, c)
+		}
+		got = append(got, resumed(cursor)...)
+		require.Len(t, got, 10, "resumed after %d", n)
+		for i, name := range got {
+			require.Equal(t, fmt.Sprintf("logs/%02d.log", i), name)
+		}
+	}
+
+	// a cursor after objects of a later page skips the pages before
+	got := resumed(cloudstorage.Cursor{After: "logs/08.log"}.String())
+	require.Equal(t, []string{"logs/09.log"}, got)
+
+	_, err = cloudstorage.ParseCursor("%zz")
+	require.Error(t, err)
+}
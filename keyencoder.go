@@ -0,0 +1,395 @@
+package cloudstorage
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// KeyEncoder maps the object names an application uses to the keys of the
+// backend store and back, see Config.KeyEncoder.  Encode must keep "/" and
+// map the prefixes of a name to prefixes of its key, so prefix listings and
+// folders keep working.
+type KeyEncoder interface {
+	// Encode name to the key of the store.
+	Encode(name string) string
+	// Decode the key of a listed object back to its name, an error if the
+	// key wasn't encoded by Encode.
+	Decode(key string) (string, error)
+}
+
+// SafeKeyEncoder is a KeyEncoder leaving only the characters every store
+// takes in keys: ASCII letters and digits, "/" and "-_.!*'()".  Other
+// bytes, and a "." starting a path segment (so names like ".." can't walk
+// the file system stores), are percent encoded as "%XX".
+type SafeKeyEncoder struct{}
+
+func safeKeyByte(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		strings.IndexByte("/-_.!*'()", c) >= 0
+}
+
+// Encode name, see SafeKeyEncoder.
+func (SafeKeyEncoder) Encode(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if safeKeyByte(c) && !(c == '.' && (i == 0 || name[i-1] == '/')) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// Decode key, see SafeKeyEncoder.
+func (SafeKeyEncoder) Decode(key string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+		if i+2 >= len(key) {
+			return "", fmt.Errorf("invalid escape in key %q", key)
+		}
+		d, err := strconv.ParseUint(key[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("invalid escape in key %q", key)
+		}
+		b.WriteByte(byte(d))
+		i += 2
+	}
+	return b.String(), nil
+}
+
+// NewKeyEncodedStore wraps s so the object names of every call are encoded
+// with enc, and the names of listed objects and folders decoded, NewStore
+// does so when Config.KeyEncoder is set.
+//
+// Listings are made with the encoded Prefix, the other fields of the Query
+// that look at names (StartOffset, EndOffset, ObjectFilters and Filters)
+// are applied to the decoded names.  Keys that don't decode fail the
+// listing.  Besides the Store interface the wrapper passes on StoreCopy,
+// StoreMove, StoreComposer, StorePut, StoreLeaser, StoreACLSetter,
+// StoreSigner, TaggedStore, ObjectRecycler and the store's capabilities,
+// timestamps, retry and cache settings.  It is a StoreRangeReader, and its
+// objects ObjectSizers, only if the wrapped store's are.
+func NewKeyEncodedStore(s Store, enc KeyEncoder) Store {
+	k := &keyEncodedStore{s: s, enc: enc}
+	if rr, ok := s.(StoreRangeReader); ok {
+		return &keyEncodedRangeStore{keyEncodedStore: k, rr: rr}
+	}
+	return k
+}
+
+type keyEncodedStore struct {
+	s   Store
+	enc KeyEncoder
+}
+
+var (
+	_ StoreCopy            = (*keyEncodedStore)(nil)
+	_ StoreMove            = (*keyEncodedStore)(nil)
+	_ StoreComposer        = (*keyEncodedStore)(nil)
+	_ StorePut             = (*keyEncodedStore)(nil)
+	_ StoreLeaser          = (*keyEncodedStore)(nil)
+	_ StoreACLSetter       = (*keyEncodedStore)(nil)
+	_ StoreSigner          = (*keyEncodedStore)(nil)
+	_ StoreCapabilities    = (*keyEncodedStore)(nil)
+	_ StoreTimestamps      = (*keyEncodedStore)(nil)
+	_ StoreErrorClassifier = (*keyEncodedStore)(nil)
+	_ StoreBackoff         = (*keyEncodedStore)(nil)
+	_ StoreCacheCleaner    = (*keyEncodedStore)(nil)
+	_ StoreCachePath       = (*keyEncodedStore)(nil)
+	_ TaggedStore          = (*keyEncodedStore)(nil)
+	_ ObjectRecycler       = (*keyEncodedStore)(nil)
+	_ StoreRangeReader     = (*keyEncodedRangeStore)(nil)
+)
+
+// keyEncodedRangeStore is the keyEncodedStore of a StoreRangeReader.
+type keyEncodedRangeStore struct {
+	*keyEncodedStore
+	rr StoreRangeReader
+}
+
+func (k *keyEncodedRangeStore) NewRangeReader(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	return k.rr.NewRangeReader(ctx, k.enc.Encode(name), offset, length)
+}
+
+func (k *keyEncodedStore) Type() string {
+	return k.s.Type()
+}
+func (k *keyEncodedStore) Client() interface{} {
+	return k.s.Client()
+}
+func (k *keyEncodedStore) String() string {
+	return k.s.String()
+}
+
+func (k *keyEncodedStore) object(o Object) (Object, error) {
+	name, err := k.enc.Decode(o.Name())
+	if err != nil {
+		return nil, err
+	}
+	return newKeyEncodedObject(o, name), nil
+}
+
+func (k *keyEncodedStore) Get(ctx context.Context, name string) (Object, error) {
+	return k.GetWithOpts(ctx, name)
+}
+func (k *keyEncodedStore) GetWithOpts(ctx context.Context, name string, opts ...Opts) (Object, error) {
+	o, err := GetWithOpts(ctx, k.s, k.enc.Encode(name), opts...)
+	if err != nil {
+		return nil, err
+	}
+	return newKeyEncodedObject(o, name), nil
+}
+
+// List the page of q, see NewKeyEncodedStore for the fields of q applied
+// to the decoded names.
+func (k *keyEncodedStore) List(ctx context.Context, q Query) (*ObjectsResponse, error) {
+	q2 := q
+	q2.Prefix = k.enc.Encode(q.Prefix)
+	q2.StartOffset, q2.EndOffset = "", ""
+	q2.ObjectFilters, q2.Filters = nil, nil
+	resp, err := k.s.List(ctx, q2)
+	if err != nil {
+		return nil, err
+	}
+	for i, o := range resp.Objects {
+		if resp.Objects[i], err = k.object(o); err != nil {
+			return nil, err
+		}
+	}
+	for i, p := range resp.Prefixes {
+		if resp.Prefixes[i], err = k.enc.Decode(p); err != nil {
+			return nil, err
+		}
+	}
+	resp.Objects = q.ApplyFilters(resp.Objects)
+	return resp, nil
+}
+
+func (k *keyEncodedStore) Objects(ctx context.Context, q Query) (ObjectIterator, error) {
+	return NewObjectPageIterator(ctx, k, q), nil
+}
+
+func (k *keyEncodedStore) Folders(ctx context.Context, q Query) ([]string, error) {
+	it, err := k.FolderIterator(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	return FoldersAll(it)
+}
+
+func (k *keyEncodedStore) FolderIterator(ctx context.Context, q Query) (FolderIterator, error) {
+	q.Prefix = k.enc.Encode(q.Prefix)
+	it, err := k.s.FolderIterator(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return &keyEncodedFolderIterator{FolderIterator: it, enc: k.enc}, nil
+}
+
+func (k *keyEncodedStore) NewReader(name string) (io.ReadCloser, error) {
+	return k.s.NewReader(k.enc.Encode(name))
+}
+func (k *keyEncodedStore) NewReaderWithContext(ctx context.Context, name string) (io.ReadCloser, error) {
+	return k.s.NewReaderWithContext(ctx, k.enc.Encode(name))
+}
+func (k *keyEncodedStore) NewReaderWithOpts(ctx context.Context, name string, opts ...Opts) (io.ReadCloser, error) {
+	return NewReaderWithOpts(ctx, k.s, k.enc.Encode(name), opts...)
+}
+func (k *keyEncodedStore) NewWriter(name string, metadata map[string]string) (io.WriteCloser, error) {
+	return k.s.NewWriter(k.enc.Encode(name), metadata)
+}
+func (k *keyEncodedStore) NewWriterWithContext(ctx context.Context, name string, metadata map[string]string, opts ...Opts) (io.WriteCloser, error) {
+	return k.s.NewWriterWithContext(ctx, k.enc.Encode(name), metadata, opts...)
+}
+
+func (k *keyEncodedStore) NewObject(name string, opts ...Opts) (Object, error) {
+	o, err := k.s.NewObject(k.enc.Encode(name), opts...)
+	if err != nil {
+		return nil, err
+	}
+	return newKeyEncodedObject(o, name), nil
+}
+
+func (k *keyEncodedStore) Delete(ctx context.Context, name string, opts ...Opts) error {
+	return k.s.Delete(ctx, k.enc.Encode(name), opts...)
+}
+
+// unwrap the store's objects for the wrapped store.
+func unwrapKeyEncoded(o Object) Object {
+	switch ko := o.(type) {
+	case *keyEncodedObject:
+		return ko.Object
+	case *keyEncodedSizedObject:
+		return ko.keyEncodedObject.Object
+	}
+	return o
+}
+
+func (k *keyEncodedStore) Copy(ctx context.Context, src, dst Object) error {
+	return k.CopyWithOpts(ctx, src, dst)
+}
+func (k *keyEncodedStore) CopyWithOpts(ctx context.Context, src, dst Object, opts ...Opts) error {
+	return fastCopy(ctx, k.s, unwrapKeyEncoded(src), unwrapKeyEncoded(dst), opts)
+}
+
+func (k *keyEncodedStore) Move(ctx context.Context, src, dst Object) error {
+	return k.MoveWithOpts(ctx, src, dst)
+}
+func (k *keyEncodedStore) MoveWithOpts(ctx context.Context, src, dst Object, opts ...Opts) error {
+	return fastMove(ctx, k.s, unwrapKeyEncoded(src), unwrapKeyEncoded(dst), opts)
+}
+
+func (k *keyEncodedStore) Compose(ctx context.Context, dst string, srcs []string) error {
+	c, ok := k.s.(StoreComposer)
+	if !ok {
+		return ErrNotImplemented
+	}
+	keys := make([]string, len(srcs))
+	for i, src := range srcs {
+		keys[i] = k.enc.Encode(src)
+	}
+	return c.Compose(ctx, k.enc.Encode(dst), keys)
+}
+
+func (k *keyEncodedStore) Put(ctx context.Context, name string, r io.Reader, metadata map[string]string, opts ...Opts) error {
+	return Put(ctx, k.s, k.enc.Encode(name), r, metadata, opts...)
+}
+
+func (k *keyEncodedStore) AcquireLease(ctx context.Context, name string, ttl time.Duration) (Lease, error) {
+	return AcquireLease(ctx, k.s, k.enc.Encode(name), ttl)
+}
+
+func (k *keyEncodedStore) SetObjectACL(ctx context.Context, name string, acl ACL) error {
+	return SetObjectACL(ctx, k.s, k.enc.Encode(name), acl)
+}
+
+func (k *keyEncodedStore) SignedURL(ctx context.Context, name, method string, expires time.Duration) (string, error) {
+	return SignedURL(ctx, k.s, k.enc.Encode(name), method, expires)
+}
+
+func (k *keyEncodedStore) GetTags(ctx context.Context, name string) (map[string]string, error) {
+	ts, ok := k.s.(TaggedStore)
+	if !ok {
+		return nil, ErrNotImplemented
+	}
+	return ts.GetTags(ctx, k.enc.Encode(name))
+}
+func (k *keyEncodedStore) SetTags(ctx context.Context, name string, tags map[string]string) error {
+	ts, ok := k.s.(TaggedStore)
+	if !ok {
+		return ErrNotImplemented
+	}
+	return ts.SetTags(ctx, k.enc.Encode(name), tags)
+}
+
+// Recycle hands the wrapped objects of a Reuse page back to the wrapped
+// store, if it is an ObjectRecycler.
+func (k *keyEncodedStore) Recycle(objects Objects) {
+	r, ok := k.s.(ObjectRecycler)
+	if !ok {
+		return
+	}
+	inner := make(Objects, len(objects))
+	for i, o := range objects {
+		inner[i] = unwrapKeyEncoded(o)
+	}
+	r.Recycle(inner)
+}
+
+func (k *keyEncodedStore) Capabilities() Capabilities {
+	return CapabilitiesOf(k.s)
+}
+func (k *keyEncodedStore) UpdatedGranularity() time.Duration {
+	return UpdatedGranularity(k.s)
+}
+func (k *keyEncodedStore) IsTransient(err error) bool {
+	return IsTransient(k.s, err)
+}
+func (k *keyEncodedStore) BackoffProfile() BackoffProfile {
+	return BackoffProfileOf(k.s)
+}
+func (k *keyEncodedStore) CleanCache(ctx context.Context, olderThan time.Duration) error {
+	if c, ok := k.s.(StoreCacheCleaner); ok {
+		return c.CleanCache(ctx, olderThan)
+	}
+	return nil
+}
+func (k *keyEncodedStore) CachePath() string {
+	if cp, ok := k.s.(StoreCachePath); ok {
+		return cp.CachePath()
+	}
+	return ""
+}
+
+type keyEncodedFolderIterator struct {
+	FolderIterator
+	enc KeyEncoder
+}
+
+func (it *keyEncodedFolderIterator) Next() (string, error) {
+	key, err := it.FolderIterator.Next()
+	if err != nil {
+		return "", err
+	}
+	return it.enc.Decode(key)
+}
+
+// keyEncodedObject is an object of the wrapped store with its decoded name.
+type keyEncodedObject struct {
+	Object
+	name string
+}
+
+// keyEncodedSizedObject is the keyEncodedObject of an ObjectSizer.
+type keyEncodedSizedObject struct {
+	*keyEncodedObject
+	sizer ObjectSizer
+}
+
+func (o *keyEncodedSizedObject) Size() int64 {
+	return o.sizer.Size()
+}
+
+func newKeyEncodedObject(o Object, name string) Object {
+	ko := &keyEncodedObject{Object: o, name: name}
+	if s, ok := o.(ObjectSizer); ok {
+		return &keyEncodedSizedObject{keyEncodedObject: ko, sizer: s}
+	}
+	return ko
+}
+
+func (o *keyEncodedObject) Name() string {
+	return o.name
+}
+func (o *keyEncodedObject) String() string {
+	return o.name
+}
+
+func (o *keyEncodedObject) ETag() string {
+	if et, ok := o.Object.(ObjectETagger); ok {
+		return et.ETag()
+	}
+	return ""
+}
+func (o *keyEncodedObject) Attrs() ObjectAttributes {
+	return AttrsOf(o.Object)
+}
+func (o *keyEncodedObject) Hashes() map[string]string {
+	if h, ok := o.Object.(ObjectHasher); ok {
+		return h.Hashes()
+	}
+	return nil
+}
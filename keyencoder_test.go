@@ -0,0 +1,181 @@
+package cloudstorage_test
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/iterator"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/conformance"
+	"github.com/lytics/cloudstorage/localfs"
+)
+
+func TestSafeKeyEncoder(t *testing.T) {
+	enc := cloudstorage.SafeKeyEncoder{}
+	for name, key := range map[string]string{
+		"logs/2023-03-01/a.csv": "logs/2023-03-01/a.csv",
+		"users/a b?c#d.json":    "users/a%20b%3Fc%23d.json",
+		"../etc/passwd":         "%2E./etc/passwd",
+		"a/.hidden/%41":         "a/%2Ehidden/%2541",
+		"héllo":                 "h%C3%A9llo",
+	} {
+		require.Equal(t, key, enc.Encode(name))
+		got, err := enc.Decode(key)
+		require.NoError(t, err)
+		require.Equal(t, name, got)
+	}
+	for _, name := range []string{"users/a b", "users/a", "a/."} {
+		require.True(t, strings.HasPrefix(enc.Encode(name+"x/y"), enc.Encode(name)))
+	}
+	_, err := enc.Decode("a%4")
+	require.Error(t, err)
+	_, err = enc.Decode("a%zz")
+	require.Error(t, err)
+}
+
+func TestKeyEncodedStore(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	conf := &cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    tmpDir + "/store",
+		TmpDir:     tmpDir + "/tmp",
+		KeyEncoder: cloudstorage.SafeKeyEncoder{},
+	}
+	store, err := cloudstorage.NewStore(conf)
+	require.NoError(t, err)
+
+	names := []string{"users/ann smith/a?.json", "users/ann smith/b#.json", "users/bob/../x.json"}
+	for _, name := range names {
+		require.NoError(t, cloudstorage.WriteAll(ctx, store, name, []byte(name), nil))
+	}
+	data, err := cloudstorage.ReadAll(ctx, store, names[2])
+	require.NoError(t, err)
+	require.Equal(t, names[2], string(data))
+
+	// the keys are encoded in the backing store
+	conf.KeyEncoder = nil
+	raw, err := cloudstorage.NewStore(conf)
+	require.NoError(t, err)
+	_, err = raw.Get(ctx, "users/ann%20smith/a%3F.json")
+	require.NoError(t, err)
+	_, err = raw.Get(ctx, "users/bob/%2E./x.json")
+	require.NoError(t, err)
+
+	q := cloudstorage.NewQuery("users/ann s")
+	q.Sorted()
+	objs, err := store.List(ctx, q)
+	require.NoError(t, err)
+	require.Len(t, objs.Objects, 2)
+	require.Equal(t, names[0], objs.Objects[0].Name())
+	require.Equal(t, names[1], objs.Objects[1].Name())
+	require.Equal(t, int64(len(names[0])), objs.Objects[0].(cloudstorage.ObjectSizer).Size())
+
+	q = cloudstorage.NewQuery("users/")
+	q.StartOffset = "users/ann smith/b"
+	iter, err := store.Objects(ctx, q)
+	require.NoError(t, err)
+	all, err := cloudstorage.ObjectsAll(iter)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+
+	folders, err := store.Folders(ctx, cloudstorage.NewQueryForFolders("users/"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"users/ann smith/", "users/bob/"}, folders)
+
+	src, err := store.Get(ctx, names[0])
+	require.NoError(t, err)
+	dst, err := store.NewObject("copies/a?.json")
+	require.NoError(t, err)
+	require.NoError(t, cloudstorage.Copy(ctx, store, src, dst))
+	data, err = cloudstorage.ReadAll(ctx, store, "copies/a?.json")
+	require.NoError(t, err)
+	require.Equal(t, names[0], string(data))
+
+	require.NoError(t, store.Delete(ctx, names[2]))
+	_, err = store.Get(ctx, names[2])
+	require.Equal(t, cloudstorage.ErrObjectNotFound, err)
+}
+
+func TestKeyEncodedStoreOptional(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	conf := &cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    tmpDir + "/store",
+		TmpDir:     tmpDir + "/tmp",
+		KeyEncoder: cloudstorage.SafeKeyEncoder{},
+	}
+	store, err := cloudstorage.NewStore(conf)
+	require.NoError(t, err)
+
+	names := []string{"tags/a b.txt", "tags/c?d.txt", "tags/e#f.txt"}
+	for _, name := range names {
+		require.NoError(t, cloudstorage.WriteAll(ctx, store, name, []byte("0123456789"), nil))
+	}
+
+	rr, ok := store.(cloudstorage.StoreRangeReader)
+	require.True(t, ok)
+	rc, err := rr.NewRangeReader(ctx, names[0], 2, 3)
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	require.NoError(t, err)
+	require.Equal(t, "234", string(data))
+
+	ts, ok := store.(cloudstorage.TaggedStore)
+	require.True(t, ok)
+	require.NoError(t, ts.SetTags(ctx, names[1], map[string]string{"team": "x"}))
+	tags, err := ts.GetTags(ctx, names[1])
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"team": "x"}, tags)
+
+	cp, ok := store.(cloudstorage.StoreCachePath)
+	require.True(t, ok)
+	require.True(t, strings.HasPrefix(cp.CachePath(), tmpDir+"/tmp"))
+
+	_, ok = store.(cloudstorage.ObjectRecycler)
+	require.True(t, ok)
+	q := cloudstorage.NewQuery("tags/")
+	q.PageSize = 2
+	q.Reuse = true
+	q.Lean = true
+	iter, err := store.Objects(ctx, q)
+	require.NoError(t, err)
+	var listed []string
+	for {
+		o, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		require.NoError(t, err)
+		size, ok := cloudstorage.SizeOf(o)
+		require.True(t, ok)
+		require.Equal(t, int64(10), size)
+		listed = append(listed, o.Name())
+	}
+	iter.Close()
+	sort.Strings(listed)
+	require.Equal(t, names, listed)
+}
+
+func TestKeyEncodedStoreConformance(t *testing.T) {
+	tmpDir := t.TempDir()
+	conf := &cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    tmpDir + "/store",
+		TmpDir:     tmpDir + "/tmp",
+		KeyEncoder: cloudstorage.SafeKeyEncoder{},
+	}
+	store, err := cloudstorage.NewStore(conf)
+	require.NoError(t, err)
+	conformance.Run(t, store, conf)
+}
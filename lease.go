@@ -0,0 +1,57 @@
+package cloudstorage
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pborman/uuid"
+	"golang.org/x/net/context"
+)
+
+const (
+	// LeaseSuffix is appended to an object name to name the marker object
+	// (or lock file) a lease on it is held with.
+	LeaseSuffix = ".lease"
+	// LeaseIDKey metadata key of the lease id on lease marker objects.
+	LeaseIDKey = "lease_id"
+	// LeaseExpiresKey metadata key of the RFC3339 expiry on lease marker objects.
+	LeaseExpiresKey = "lease_expires"
+)
+
+// AcquireLease claims name for ttl on stores implementing StoreLeaser,
+// others return ErrNotImplemented.
+//
+//	lease, err := cloudstorage.AcquireLease(ctx, store, "jobs/2023-03-01.csv", time.Minute)
+//	if err == cloudstorage.ErrLeaseHeld {
+//		// another worker has it
+//	}
+//	defer lease.Release(ctx)
+func AcquireLease(ctx context.Context, s Store, name string, ttl time.Duration) (Lease, error) {
+	if l, ok := s.(StoreLeaser); ok {
+		return l.AcquireLease(ctx, name, ttl)
+	}
+	return nil, ErrNotImplemented
+}
+
+// NewLeaseID creates a random lease id.
+func NewLeaseID() string {
+	return strings.Replace(uuid.NewRandom().String(), "-", "", -1)
+}
+
+// LeaseMetaData is the metadata of a lease marker object.
+func LeaseMetaData(id string, expires time.Time) map[string]string {
+	return map[string]string{
+		LeaseIDKey:      id,
+		LeaseExpiresKey: expires.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// LeaseExpired reports whether the lease marker metadata md has expired,
+// markers without a readable expiry are treated as expired.
+func LeaseExpired(md map[string]string, now time.Time) bool {
+	expires, err := time.Parse(time.RFC3339Nano, md[LeaseExpiresKey])
+	if err != nil {
+		return true
+	}
+	return now.After(expires)
+}
@@ -0,0 +1,25 @@
+package localfs
+
+import (
+	"os"
+
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+var _ cloudstorage.StoreACLSetter = (*LocalStore)(nil)
+
+// SetObjectACL sets the mode of the object's file, 0600 for ACLPrivate and
+// 0644 for ACLPublicRead.
+func (l *LocalStore) SetObjectACL(ctx context.Context, name string, acl cloudstorage.ACL) error {
+	fo, err := l.pathForObject(name)
+	if err != nil {
+		return err
+	}
+	mode := os.FileMode(0600)
+	if acl == cloudstorage.ACLPublicRead {
+		mode = 0644
+	}
+	return os.Chmod(fo, mode)
+}
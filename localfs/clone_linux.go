@@ -0,0 +1,23 @@
+package localfs
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// ficlone is the FICLONE ioctl of linux/fs.h.
+const ficlone = 0x40049409
+
+// copyFile copies src to the empty file dst.  On file systems with reflinks
+// (btrfs, xfs) dst is a copy-on-write clone sharing the blocks of src,
+// which takes no time whatever its size.  Elsewhere, or across file
+// systems, the bytes are copied.
+func copyFile(dst, src *os.File) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dst.Fd(), ficlone, src.Fd())
+	if errno == 0 {
+		return nil
+	}
+	_, err := io.Copy(dst, src)
+	return err
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package localfs
+
+import (
+	"io"
+	"os"
+)
+
+// copyFile copies src to the empty file dst, reflinks are only cloned on
+// linux.
+func copyFile(dst, src *os.File) error {
+	_, err := io.Copy(dst, src)
+	return err
+}
@@ -0,0 +1,34 @@
+package localfs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	data := bytes.Repeat([]byte("1997,Ford,E350\n"), 1000)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "src"), data, 0664))
+
+	src, err := os.Open(filepath.Join(dir, "src"))
+	require.NoError(t, err)
+	defer src.Close()
+	dst, err := os.Create(filepath.Join(dir, "dst"))
+	require.NoError(t, err)
+	// cloned or copied, the copy is independent of the source
+	require.NoError(t, copyFile(dst, src))
+	_, err = dst.WriteAt([]byte("2023"), 0)
+	require.NoError(t, err)
+	require.NoError(t, dst.Close())
+
+	got, err := os.ReadFile(filepath.Join(dir, "dst"))
+	require.NoError(t, err)
+	require.Equal(t, append([]byte("2023"), data[4:]...), got)
+	got, err = os.ReadFile(filepath.Join(dir, "src"))
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+}
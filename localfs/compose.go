@@ -0,0 +1,35 @@
+package localfs
+
+import (
+	"io"
+
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+var _ cloudstorage.StoreComposer = (*LocalStore)(nil)
+
+// Compose concatenates the srcs files into dst through Put, so dst is
+// replaced atomically even when it is one of the srcs.  Compressed srcs are
+// read decompressed, Put compresses dst as the store writes.
+func (l *LocalStore) Compose(ctx context.Context, dst string, srcs []string) error {
+	var readers []io.Reader
+	for _, src := range srcs {
+		fo, err := l.pathForObject(src)
+		if err != nil {
+			return err
+		}
+		rc, err := l.openReader(ctx, fo)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		readers = append(readers, rc)
+	}
+	metadata, _, err := readmeta(l.filePath(srcs[0]) + ".metadata")
+	if err != nil {
+		return err
+	}
+	return l.Put(ctx, dst, io.MultiReader(readers...), metadata)
+}
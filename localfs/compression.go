@@ -0,0 +1,183 @@
+package localfs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/csbufio"
+)
+
+// metaContentEncoding is the key of the codec an object is stored
+// compressed with in the attrs of its metadata file, see metaVersion.
+const metaContentEncoding = "content_encoding"
+
+// magic numbers of the codecs, for sniffing files that have no metadata.
+var codecMagic = []struct {
+	codec string
+	magic []byte
+}{
+	{cloudstorage.CodecGzip, []byte{0x1f, 0x8b}},
+	{cloudstorage.CodecZstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{cloudstorage.CodecSnappy, []byte("\xff\x06\x00\x00sNaPpY")},
+}
+
+// codec of the objects the store writes compressed.
+func (l *LocalStore) codec() string {
+	if l.CompressionCodec == "" {
+		return cloudstorage.CodecGzip
+	}
+	return l.CompressionCodec
+}
+
+// encoding of the object stored in file fo.  Files put in place without a
+// metadata file are sniffed when compression is enabled.
+func (l *LocalStore) encoding(fo string) (string, error) {
+	mf := fo + ".metadata"
+	if cloudstorage.Exists(mf) || !l.EnableCompression {
+		_, codec, err := readmeta(mf)
+		return codec, err
+	}
+	return sniffEncoding(fo)
+}
+
+func sniffEncoding(fo string) (string, error) {
+	f, err := os.Open(fo)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	head := make([]byte, 10)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	for _, c := range codecMagic {
+		if bytes.HasPrefix(head[:n], c.magic) {
+			return c.codec, nil
+		}
+	}
+	return "", nil
+}
+
+// openReader of the object stored in file fo, decompressing it when it was
+// stored compressed.
+func (l *LocalStore) openReader(ctx context.Context, fo string) (io.ReadCloser, error) {
+	encoding, err := l.encoding(fo)
+	if err != nil {
+		return nil, err
+	}
+	if cloudstorage.IsCompressed(encoding) {
+		if stat, err := os.Stat(fo); err == nil && stat.Size() == 0 {
+			encoding = ""
+		}
+	}
+	rc, err := csbufio.OpenReader(ctx, fo)
+	if err != nil || !cloudstorage.IsCompressed(encoding) {
+		return rc, err
+	}
+	dr, err := cloudstorage.NewDecompressReader(rc, encoding)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return &decompressReadCloser{ReadCloser: dr, rc: rc}, nil
+}
+
+// decompressReadCloser closes both the decompressing reader and the file
+// reader it reads.
+type decompressReadCloser struct {
+	io.ReadCloser
+	rc io.Closer
+}
+
+func (d *decompressReadCloser) Close() error {
+	err := d.ReadCloser.Close()
+	if cerr := d.rc.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// compressWriteCloser compresses what is written to wc, closing both the
+// compression writer and wc.  The compression writer is only created by the
+// first write so empty objects are stored as empty files, rather than the
+// header of an empty stream, and are read as is.
+type compressWriteCloser struct {
+	l  *LocalStore
+	cw io.WriteCloser
+	wc io.WriteCloser
+}
+
+// newCompressWriter compresses what is written to wc with the store's codec.
+func (l *LocalStore) newCompressWriter(wc io.WriteCloser) (io.WriteCloser, error) {
+	if err := cloudstorage.ValidateCompression(l.CompressionCodec, l.CompressionLevel); err != nil {
+		return nil, err
+	}
+	return &compressWriteCloser{l: l, wc: wc}, nil
+}
+
+func (c *compressWriteCloser) Write(p []byte) (int, error) {
+	if c.cw == nil {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		cw, err := cloudstorage.NewCompressWriter(c.wc, c.l.codec(), c.l.CompressionLevel)
+		if err != nil {
+			return 0, err
+		}
+		c.cw = cw
+	}
+	return c.cw.Write(p)
+}
+
+func (c *compressWriteCloser) Close() error {
+	if c.cw != nil {
+		if err := c.cw.Close(); err != nil {
+			c.wc.Close()
+			return err
+		}
+	}
+	return c.wc.Close()
+}
+
+var _ cloudstorage.StoreRangeReader = (*LocalStore)(nil)
+
+// NewRangeReader reads length bytes of object o from offset, to the end if
+// length is negative.  Objects stored compressed can't be read in ranges.
+func (l *LocalStore) NewRangeReader(ctx context.Context, o string, offset, length int64) (io.ReadCloser, error) {
+	fo, err := l.pathForObject(o)
+	if err != nil {
+		return nil, err
+	}
+	encoding, err := l.encoding(fo)
+	if err != nil {
+		return nil, err
+	}
+	if cloudstorage.IsCompressed(encoding) {
+		return nil, fmt.Errorf("%w: range reads of compressed object %s", cloudstorage.ErrNotImplemented, o)
+	}
+	f, err := os.Open(fo)
+	if err != nil {
+		return nil, err
+	}
+	if length < 0 {
+		length = math.MaxInt64 - offset
+	}
+	return &sectionReadCloser{SectionReader: io.NewSectionReader(f, offset, length), f: f}, nil
+}
+
+// sectionReadCloser reads a section of a file, closing it.
+type sectionReadCloser struct {
+	*io.SectionReader
+	f *os.File
+}
+
+func (s *sectionReadCloser) Close() error {
+	return s.f.Close()
+}
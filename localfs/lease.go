@@ -0,0 +1,77 @@
+//go:build !windows
+
+package localfs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+var _ cloudstorage.StoreLeaser = (*LocalStore)(nil)
+
+// lease is a flock on the lock file, it is held until released or the
+// process exits.
+type lease struct {
+	id string
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+// AcquireLease claims name with an exclusive flock on the lock file
+// name+LeaseSuffix.  The ttl is ignored, the kernel releases the lock if the
+// process dies so it can't be left held.
+func (l *LocalStore) AcquireLease(ctx context.Context, name string, ttl time.Duration) (cloudstorage.Lease, error) {
+	fname := l.filePath(name + cloudstorage.LeaseSuffix)
+	if err := os.MkdirAll(filepath.Dir(fname), 0775); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(fname, os.O_RDWR|os.O_CREATE, 0665)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, cloudstorage.ErrLeaseHeld
+		}
+		return nil, fmt.Errorf("could not lock %s: %w", fname, err)
+	}
+	return &lease{id: cloudstorage.NewLeaseID(), f: f}, nil
+}
+
+func (le *lease) ID() string { return le.id }
+
+// Renew is a no-op while the lock is held.
+func (le *lease) Renew(ctx context.Context) error {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	if le.f == nil {
+		return cloudstorage.ErrLeaseLost
+	}
+	return nil
+}
+
+// Release unlocks and closes the lock file.  The file is left in place,
+// removing it would let another owner lock a file already unlinked.
+func (le *lease) Release(ctx context.Context) error {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	if le.f == nil {
+		return cloudstorage.ErrLeaseLost
+	}
+	err := syscall.Flock(int(le.f.Fd()), syscall.LOCK_UN)
+	if cerr := le.f.Close(); err == nil {
+		err = cerr
+	}
+	le.f = nil
+	return err
+}
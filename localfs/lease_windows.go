@@ -0,0 +1,14 @@
+package localfs
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+// AcquireLease is not implemented for windows.
+func (l *LocalStore) AcquireLease(ctx context.Context, name string, ttl time.Duration) (cloudstorage.Lease, error) {
+	return nil, cloudstorage.ErrNotImplemented
+}
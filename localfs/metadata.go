@@ -0,0 +1,106 @@
+package localfs
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// metaVersion of the metadata files the store writes.
+//
+// Version 0 files are the flat json object of the metadata that stores
+// before the envelope wrote, with the codec under content_encoding.  From
+// version 1 a file is a metaEnvelope, the custom metadata apart from the
+// attributes the store keeps of the object (the codec it is stored
+// compressed with), so the custom metadata may have a content_encoding of
+// its own.  Files of later versions are read by the fields known here, so
+// new fields must not change the meaning of these.
+const metaVersion = 1
+
+// metaEnvelope is the json of a metadata file.
+type metaEnvelope struct {
+	Version  int               `json:"version"`
+	Metadata map[string]string `json:"metadata"`
+	Attrs    map[string]string `json:"attrs,omitempty"`
+}
+
+// decodemeta parses a metadata file of any version into the custom
+// metadata of the object and the codec it is stored compressed with.
+func decodemeta(b []byte) (map[string]string, string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, "", err
+	}
+	var version int
+	if err := json.Unmarshal(fields["version"], &version); err != nil || fields["metadata"] == nil {
+		// version 0, values are all strings so "version" isn't a number
+		metadata := make(map[string]string, len(fields))
+		if err := json.Unmarshal(b, &metadata); err != nil {
+			return nil, "", err
+		}
+		codec := metadata[metaContentEncoding]
+		delete(metadata, metaContentEncoding)
+		return metadata, codec, nil
+	}
+	var env metaEnvelope
+	if err := json.Unmarshal(b, &env); err != nil {
+		return nil, "", err
+	}
+	if env.Metadata == nil {
+		env.Metadata = make(map[string]string)
+	}
+	return env.Metadata, env.Attrs[metaContentEncoding], nil
+}
+
+// encodemeta the custom metadata and codec of an object as a metaVersion
+// envelope.
+func encodemeta(meta map[string]string, codec string) ([]byte, error) {
+	env := metaEnvelope{Version: metaVersion, Metadata: meta}
+	if env.Metadata == nil {
+		env.Metadata = make(map[string]string)
+	}
+	if codec != "" {
+		env.Attrs = map[string]string{metaContentEncoding: codec}
+	}
+	return json.MarshalIndent(env, "", "  ")
+}
+
+// readmeta reads the metadata file of an object, empty if it has none.
+// Files of older versions are read as they are and upgraded by the next
+// write, rewriting them here could undo a concurrent write.
+func readmeta(filename string) (map[string]string, string, error) {
+	b, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return make(map[string]string), "", nil
+	} else if err != nil {
+		return nil, "", err
+	}
+	return decodemeta(b)
+}
+
+// writemeta replaces the metadata file through a temp file, so concurrent
+// readers and listings never see it partially written.
+func writemeta(filename string, meta map[string]string, codec string) error {
+	bm, err := encodemeta(meta, codec)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*"+putSuffix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0664); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
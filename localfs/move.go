@@ -0,0 +1,61 @@
+package localfs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+var _ cloudstorage.StoreMove = (*LocalStore)(nil)
+
+// Move renames the file of src, and its metadata, over dst, so moves take
+// no time whatever the size of the file.  Across file systems, or for
+// objects of another store, it returns ErrNotImplemented and
+// cloudstorage.Move copies the file then deletes src.
+func (l *LocalStore) Move(ctx context.Context, src, dst cloudstorage.Object) error {
+	if !l.owns(src) || !l.owns(dst) {
+		return cloudstorage.ErrNotImplemented
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	from, err := l.pathForObject(src.Name())
+	if err != nil {
+		return err
+	}
+	to := l.filePath(dst.Name())
+	if from == to {
+		return nil
+	}
+	if err := cloudstorage.EnsureDir(to); err != nil {
+		return err
+	}
+	if err := os.Rename(from, to); err != nil {
+		if errors.Is(err, syscall.EXDEV) {
+			return fmt.Errorf("can't rename %s across file systems: %w", from, cloudstorage.ErrNotImplemented)
+		}
+		return fmt.Errorf("renaming file=%s: %w", from, err)
+	}
+
+	// the metadata of dst is src's, if it has none dst's former is dropped
+	if cloudstorage.Exists(from + ".metadata") {
+		err = os.Rename(from+".metadata", to+".metadata")
+	} else if err = os.Remove(to + ".metadata"); errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("moving metadata of file=%s: %w", from, err)
+	}
+	return l.deleteParentDirs(from)
+}
+
+// owns is true for the objects of this store.
+func (l *LocalStore) owns(o cloudstorage.Object) bool {
+	lo, ok := o.(*object)
+	return ok && lo.fs == l
+}
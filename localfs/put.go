@@ -0,0 +1,118 @@
+package localfs
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+// putSuffix marks the temp files of an in progress Put, List skips them.
+const putSuffix = ".putting"
+
+var _ cloudstorage.StorePut = (*LocalStore)(nil)
+
+// Put writes r to a temp file next to the object and renames it into place
+// so readers never see a truncated or partially written file.
+func (l *LocalStore) Put(ctx context.Context, name string, r io.Reader, metadata map[string]string, opts ...cloudstorage.Opts) error {
+	metadata, err := cloudstorage.NormalizeMetadata(metadata)
+	if err != nil {
+		return err
+	}
+	fo := l.filePath(name)
+	if err := cloudstorage.EnsureDir(fo); err != nil {
+		return err
+	}
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(fo), "."+filepath.Base(fo)+".*"+putSuffix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	var wc io.WriteCloser = tmp
+	var codec string
+	if l.EnableCompression && !(len(opts) > 0 && opts[0].DisableCompression) {
+		if wc, err = l.newCompressWriter(tmp); err != nil {
+			tmp.Close()
+			return err
+		}
+		codec = l.codec()
+	}
+	if _, err := io.Copy(wc, ctxReader{ctx, r}); err != nil {
+		wc.Close()
+		return err
+	}
+	if err := wc.Close(); err != nil {
+		return err
+	}
+	return commitTemp(tmp.Name(), fo, metadata, codec, len(opts) > 0 && opts[0].IfNotExists)
+}
+
+// commitTemp moves the written temp file tmp and its metadata into place as
+// the object file fo, stored compressed with codec.  With ifNotExists an
+// existing fo is left as is and ErrObjectExists returned.
+func commitTemp(tmp, fo string, metadata map[string]string, codec string, ifNotExists bool) error {
+	if err := os.Chmod(tmp, 0665); err != nil {
+		return err
+	}
+
+	tmpmd := tmp + ".metadata"
+	defer os.Remove(tmpmd)
+	if err := writemeta(tmpmd, metadata, codec); err != nil {
+		return err
+	}
+
+	if ifNotExists {
+		// a hard link fails rather than replace an existing file
+		if err := os.Link(tmp, fo); err != nil {
+			if os.IsExist(err) {
+				return cloudstorage.ErrObjectExists
+			}
+			return err
+		}
+		return os.Rename(tmpmd, fo+".metadata")
+	}
+	if err := os.Rename(tmpmd, fo+".metadata"); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fo)
+}
+
+// tempWriter writes an object to a temp file committed on Close, so readers
+// and listings never see it partially written.
+type tempWriter struct {
+	io.WriteCloser
+	tmp         *os.File
+	fo          string
+	metadata    map[string]string
+	codec       string
+	ifNotExists bool
+}
+
+func (w *tempWriter) Close() error {
+	defer os.Remove(w.tmp.Name())
+	if err := w.WriteCloser.Close(); err != nil {
+		w.tmp.Close()
+		return err
+	}
+	return commitTemp(w.tmp.Name(), w.fo, w.metadata, w.codec, w.ifNotExists)
+}
+
+// ctxReader stops reading once the context is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
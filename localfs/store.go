@@ -1,7 +1,8 @@
 package localfs
 
 import (
-	"encoding/json"
+	"crypto/md5"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -9,6 +10,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"syscall"
 	"time"
@@ -16,6 +18,7 @@ import (
 	"github.com/araddon/gou"
 	"github.com/lytics/cloudstorage"
 	"github.com/lytics/cloudstorage/csbufio"
+	"github.com/lytics/cloudstorage/pathutil"
 	"github.com/pborman/uuid"
 	"golang.org/x/net/context"
 	"google.golang.org/api/iterator"
@@ -29,6 +32,12 @@ func localProvider(conf *cloudstorage.Config) (cloudstorage.Store, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := cloudstorage.ValidateCompression(conf.CompressionCodec, conf.CompressionLevel); err != nil {
+		return nil, fmt.Errorf("invalid config: %v", err)
+	}
+	store.EnableCompression = conf.EnableCompression
+	store.CompressionCodec = conf.CompressionCodec
+	store.CompressionLevel = conf.CompressionLevel
 	return store, nil
 }
 
@@ -50,6 +59,14 @@ type LocalStore struct {
 	storepath string // possibly is relative  ./tables
 	cachepath string
 	Id        string
+
+	// EnableCompression stores the objects written compressed with
+	// CompressionCodec ("" is gzip) at CompressionLevel (0 is the codec
+	// default), the ContentEncoding of their Attrs names the codec.
+	// Objects are decompressed on read whatever codec wrote them.
+	EnableCompression bool
+	CompressionCodec  string
+	CompressionLevel  int
 }
 
 // NewLocalStore create local store from storage path on local filesystem, and cachepath.
@@ -70,13 +87,12 @@ func NewLocalStore(bucket, storepath, cachepath string) (*LocalStore, error) {
 		return nil, fmt.Errorf("unable to create path. path=%s err=%v", storepath, err)
 	}
 
-	err = os.MkdirAll(cachepath, 0775)
-	if err != nil {
-		return nil, fmt.Errorf("unable to create path. path=%s err=%v", cachepath, err)
-	}
-
 	uid := uuid.NewUUID().String()
 	uid = strings.Replace(uid, "-", "", -1)
+	cachepath, err = cloudstorage.CacheDir(cachepath, uid)
+	if err != nil {
+		return nil, err
+	}
 
 	return &LocalStore{
 		storepath: storepath,
@@ -89,22 +105,51 @@ func NewLocalStore(bucket, storepath, cachepath string) (*LocalStore, error) {
 func (l *LocalStore) Type() string {
 	return StoreType
 }
+
+// CleanCache removes stale cache files from the store's TmpDir, see
+// cloudstorage.CleanCache.
+func (l *LocalStore) CleanCache(ctx context.Context, olderThan time.Duration) error {
+	return cloudstorage.CleanCache(ctx, l.cachepath, olderThan)
+}
+
+// CachePath is the cache directory of the store below its TmpDir.
+func (l *LocalStore) CachePath() string {
+	return l.cachepath
+}
+
+// UpdatedGranularity of localfs is the file system's, nanoseconds on most.
+func (l *LocalStore) UpdatedGranularity() time.Duration {
+	return time.Nanosecond
+}
+
+// Capabilities of localfs.
+func (l *LocalStore) Capabilities() cloudstorage.Capabilities {
+	return cloudstorage.Capabilities{IfNotExists: true, Compression: true, Concurrent: true}
+}
 func (l *LocalStore) Client() interface{} {
 	return l
 }
 
-func (o *object) DisableCompression() {}
+func (o *object) DisableCompression() {
+	o.enableCompression = false
+}
 
 // NewObject create new object of given name.
-func (l *LocalStore) NewObject(objectname string) (cloudstorage.Object, error) {
+func (l *LocalStore) NewObject(objectname string, opts ...cloudstorage.Opts) (cloudstorage.Object, error) {
+	if len(opts) > 0 && opts[0].WriteThrough {
+		return cloudstorage.NewWriteThroughObject(l, objectname, opts[0])
+	}
 	obj, err := l.Get(context.Background(), objectname)
 	if err != nil && err != cloudstorage.ErrObjectNotFound {
 		return nil, err
 	} else if obj != nil {
+		if len(opts) > 0 && opts[0].Overwrite {
+			return obj, nil
+		}
 		return nil, cloudstorage.ErrObjectExists
 	}
 
-	of := path.Join(l.storepath, objectname)
+	of := l.filePath(objectname)
 	err = cloudstorage.EnsureDir(of)
 	if err != nil {
 		return nil, err
@@ -112,16 +157,19 @@ func (l *LocalStore) NewObject(objectname string) (cloudstorage.Object, error) {
 
 	cf := cloudstorage.CachePathObj(l.cachepath, objectname, l.Id)
 
-	metadata, err := readmeta(of + ".metadata")
+	metadata, codec, err := readmeta(of + ".metadata")
 	if err != nil {
 		return nil, err
 	}
 
 	return &object{
-		name:      objectname,
-		storepath: of,
-		cachepath: cf,
-		metadata:  metadata,
+		name:              objectname,
+		storepath:         of,
+		cachepath:         cf,
+		metadata:          metadata,
+		codec:             codec,
+		fs:                l,
+		enableCompression: l.EnableCompression,
 	}, nil
 }
 
@@ -130,12 +178,13 @@ func (l *LocalStore) List(ctx context.Context, query cloudstorage.Query) (*cloud
 	resp := cloudstorage.NewObjectsResponse()
 	objects := make(map[string]*object)
 	metadatas := make(map[string]map[string]string)
+	codecs := make(map[string]string)
 
 	spath := l.storepath
 	filePre := query.Prefix
 	li := strings.LastIndex(query.Prefix, "/")
 	if li > 0 {
-		spath = path.Join(spath, query.Prefix[:li])
+		spath = l.filePath(query.Prefix[:li])
 	}
 	if !cloudstorage.Exists(spath) {
 		return resp, nil
@@ -149,30 +198,45 @@ func (l *LocalStore) List(ctx context.Context, query cloudstorage.Query) (*cloud
 		obj := strings.Replace(fo, l.storepath, "", 1)
 
 		if f.IsDir() {
+			// with a "/" delimiter only the prefix's own level is listed,
+			// sub-directories are left for Folders.
+			if query.Delimiter == "/" && fo != spath {
+				prefix := strings.TrimPrefix(obj, "/") + "/"
+				if strings.HasPrefix(prefix, filePre) {
+					resp.Prefixes = append(resp.Prefixes, prefix)
+				}
+				return filepath.SkipDir
+			}
 			return nil
 		} else if filepath.Ext(f.Name()) == ".metadata" {
-			metadata, err := readmeta(f.Name())
+			metadata, codec, err := readmeta(fo)
 			if err != nil {
 				return err
 			}
 			mdkey := strings.Replace(obj, ".metadata", "", 1)
 			metadatas[mdkey] = metadata
+			codecs[mdkey] = codec
+		} else if ext := filepath.Ext(f.Name()); ext == cloudstorage.LeaseSuffix || ext == putSuffix {
+			// lock files of AcquireLease, temp files of Put
+			return nil
 		} else {
 			oname := strings.TrimPrefix(obj, "/")
 			if filePre != "" && !strings.HasPrefix(oname, filePre) {
 				return nil
 			}
 
-			if (query.StartOffset != "" && oname < query.StartOffset) ||
-				(query.EndOffset != "" && oname >= query.EndOffset) {
+			if !query.Match(oname, f.Size()) {
 				return nil
 			}
 
 			objects[obj] = &object{
-				name:      oname,
-				updated:   f.ModTime(),
-				storepath: fo,
-				cachepath: cloudstorage.CachePathObj(l.cachepath, oname, l.Id),
+				name:              oname,
+				updated:           f.ModTime(),
+				size:              f.Size(),
+				storepath:         fo,
+				cachepath:         cloudstorage.CachePathObj(l.cachepath, oname, l.Id),
+				fs:                l,
+				enableCompression: l.EnableCompression,
 			}
 		}
 		return err
@@ -184,10 +248,20 @@ func (l *LocalStore) List(ctx context.Context, query cloudstorage.Query) (*cloud
 
 	for objname, obj := range objects {
 		if md, ok := metadatas[objname]; ok {
-			obj.metadata = md
+			obj.metadata, obj.codec = md, codecs[objname]
+		}
+		if len(query.TagFilter) > 0 && !cloudstorage.MatchTags(cloudstorage.DecodeTags(obj.metadata[cloudstorage.TagsMetadataKey]), query.TagFilter) {
+			continue
+		}
+		if query.IncludeHashes {
+			if obj.md5, err = fileMD5(obj.storepath); err != nil {
+				return nil, err
+			}
 		}
 		resp.Objects = append(resp.Objects, obj)
 	}
+	// list in name order like the cloud stores, iterators resume by name
+	sort.Sort(resp.Objects)
 
 	resp.Objects = query.ApplyFilters(resp.Objects)
 
@@ -204,34 +278,37 @@ func (l *LocalStore) Objects(ctx context.Context, csq cloudstorage.Query) (cloud
 	return &objectIterator{objects: resp.Objects}, nil
 }
 
-// Folders list of folders for given path query.
+// Folders get folders list.
 func (l *LocalStore) Folders(ctx context.Context, csq cloudstorage.Query) ([]string, error) {
-	spath := path.Join(l.storepath, csq.Prefix)
-	if !cloudstorage.Exists(spath) {
-		return []string{}, nil
-	}
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	default:
+	iter, err := l.FolderIterator(ctx, csq)
+	if err != nil {
+		return nil, err
 	}
+	defer iter.Close()
+	return cloudstorage.FoldersAll(iter)
+}
 
-	folders := make([]string, 0)
-	files, _ := os.ReadDir(spath)
-	for _, f := range files {
-		if f.IsDir() {
-			folders = append(folders, fmt.Sprintf("%s/", path.Join(csq.Prefix, f.Name())))
-		}
+// FolderIterator returns an iterator over the folders below the Query prefix.
+// The prefix is a folder, "b" lists the folders in b/ like "b/".
+func (l *LocalStore) FolderIterator(ctx context.Context, csq cloudstorage.Query) (cloudstorage.FolderIterator, error) {
+	if csq.Prefix != "" && !strings.HasSuffix(csq.Prefix, "/") {
+		csq.Prefix += "/"
 	}
-	return folders, nil
+	return cloudstorage.NewFolderPageIterator(ctx, l, csq), nil
 }
 
 // NewReader create local file-system store reader.
 func (l *LocalStore) NewReader(o string) (io.ReadCloser, error) {
 	return l.NewReaderWithContext(context.Background(), o)
 }
+
+// filePath of object o below the storepath.
+func (l *LocalStore) filePath(o string) string {
+	return pathutil.JoinKey(l.storepath, pathutil.CleanKey(o))
+}
+
 func (l *LocalStore) pathForObject(o string) (string, error) {
-	fo := path.Join(l.storepath, o)
+	fo := l.filePath(o)
 	if !cloudstorage.Exists(fo) {
 		return "", cloudstorage.ErrObjectNotFound
 	}
@@ -250,16 +327,21 @@ func (l *LocalStore) NewReaderWithContext(ctx context.Context, o string) (io.Rea
 	if err != nil {
 		return nil, err
 	}
-	return csbufio.OpenReader(ctx, fo)
+	return l.openReader(ctx, fo)
 }
 
 func (l *LocalStore) NewWriter(o string, metadata map[string]string) (io.WriteCloser, error) {
 	return l.NewWriterWithContext(context.Background(), o, metadata)
 }
 func (l *LocalStore) NewWriterWithContext(ctx context.Context, o string, metadata map[string]string, opts ...cloudstorage.Opts) (io.WriteCloser, error) {
-	fo := path.Join(l.storepath, o)
+	metadata, err := cloudstorage.NormalizeMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	fo := l.filePath(o)
 
-	err := cloudstorage.EnsureDir(fo)
+	err = cloudstorage.EnsureDir(fo)
 	if err != nil {
 		return nil, err
 	}
@@ -267,22 +349,35 @@ func (l *LocalStore) NewWriterWithContext(ctx context.Context, o string, metadat
 	if len(metadata) == 0 {
 		metadata = make(map[string]string)
 	}
-
-	fmd := fo + ".metadata"
-	if err := writemeta(fmd, metadata); err != nil {
-		return nil, err
+	compress := l.EnableCompression && !(len(opts) > 0 && opts[0].DisableCompression)
+	var codec string
+	if compress {
+		codec = l.codec()
 	}
 
-	flag := os.O_RDWR | os.O_CREATE | os.O_TRUNC
-	if len(opts) > 0 && opts[0].IfNotExists {
-		flag = flag | os.O_EXCL
+	ifNotExists := len(opts) > 0 && opts[0].IfNotExists
+	if ifNotExists && cloudstorage.Exists(fo) {
+		// checked again when the object is committed
+		return nil, cloudstorage.ErrObjectExists
 	}
-	f, err := os.OpenFile(fo, flag, 0665)
+
+	// written next to the object and renamed into place on Close, the
+	// object is never seen partially written
+	tmp, err := os.CreateTemp(filepath.Dir(fo), "."+filepath.Base(fo)+".*"+putSuffix)
 	if err != nil {
 		return nil, err
 	}
 
-	return csbufio.NewWriter(ctx, f), nil
+	wc := csbufio.NewWriter(ctx, tmp)
+	if compress {
+		if wc, err = l.newCompressWriter(wc); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return nil, err
+		}
+	}
+	tw := &tempWriter{WriteCloser: wc, tmp: tmp, fo: fo, metadata: metadata, codec: codec, ifNotExists: ifNotExists}
+	return cloudstorage.NewResultWriter(tw, nil), nil
 }
 
 func (l *LocalStore) Get(ctx context.Context, o string) (cloudstorage.Object, error) {
@@ -292,27 +387,33 @@ func (l *LocalStore) Get(ctx context.Context, o string) (cloudstorage.Object, er
 	}
 
 	var updated time.Time
+	var size int64
 	if stat, err := os.Stat(fo); err == nil {
 		updated = stat.ModTime()
+		size = stat.Size()
 	}
 
-	metadata, err := readmeta(fo + ".metadata")
+	metadata, codec, err := readmeta(fo + ".metadata")
 	if err != nil {
 		return nil, err
 	}
 
 	return &object{
-		name:      o,
-		updated:   updated,
-		storepath: fo,
-		metadata:  metadata,
-		cachepath: cloudstorage.CachePathObj(l.cachepath, o, l.Id),
+		name:              o,
+		updated:           updated,
+		size:              size,
+		storepath:         fo,
+		metadata:          metadata,
+		codec:             codec,
+		cachepath:         cloudstorage.CachePathObj(l.cachepath, o, l.Id),
+		fs:                l,
+		enableCompression: l.EnableCompression,
 	}, nil
 }
 
 // Delete the object from underlying store.
-func (l *LocalStore) Delete(ctx context.Context, obj string) error {
-	fo := path.Join(l.storepath, obj)
+func (l *LocalStore) Delete(ctx context.Context, obj string, opts ...cloudstorage.Opts) error {
+	fo := l.filePath(obj)
 	if err := os.Remove(fo); err != nil {
 		return fmt.Errorf("removing file=%s: %w", fo, err)
 	}
@@ -367,8 +468,12 @@ type objectIterator struct {
 	objects cloudstorage.Objects
 	err     error
 	cursor  int
+	// after is the name objects were listed after when resumed
+	after string
 }
 
+var _ cloudstorage.ResumableIterator = (*objectIterator)(nil)
+
 func (l *objectIterator) Next() (cloudstorage.Object, error) {
 	if l.err != nil {
 		return nil, l.err
@@ -382,10 +487,34 @@ func (l *objectIterator) Next() (cloudstorage.Object, error) {
 }
 func (l *objectIterator) Close() {}
 
+// Cursor of the position after the last object returned by Next.
+func (l *objectIterator) Cursor() string {
+	c := cloudstorage.Cursor{After: l.after}
+	if l.cursor > 0 {
+		c.After = l.objects[l.cursor-1].Name()
+	}
+	return c.String()
+}
+
+// Resume iterating after the position of cursor, the objects are listed in
+// name order so those up to the cursor's are skipped.
+func (l *objectIterator) Resume(cursor string) error {
+	c, err := cloudstorage.ParseCursor(cursor)
+	if err != nil {
+		return err
+	}
+	l.cursor = sort.Search(len(l.objects), func(i int) bool { return l.objects[i].Name() > c.After })
+	l.after = c.After
+	return nil
+}
+
 type object struct {
 	name     string
 	updated  time.Time
 	metadata map[string]string
+	codec    string // the object is stored compressed with, see Attrs
+	size     int64
+	md5      string // only when listed with Query.IncludeHashes
 
 	storepath string
 	cachepath string
@@ -393,8 +522,30 @@ type object struct {
 	cachedcopy *os.File
 	readonly   bool
 	opened     bool
+
+	fs                *LocalStore
+	enableCompression bool
+}
+
+func (o *object) Size() int64 {
+	return o.size
 }
 
+// Attrs of the object, the ContentEncoding is the codec it is stored
+// compressed with.
+func (o *object) Attrs() cloudstorage.ObjectAttributes {
+	a := cloudstorage.BasicAttrs(o)
+	a.ContentEncoding = o.codec
+	return a
+}
+
+func (o *object) Hashes() map[string]string {
+	h := make(map[string]string, 1)
+	if o.md5 != "" {
+		h[cloudstorage.HashMD5] = o.md5
+	}
+	return h
+}
 func (o *object) StorageSource() string {
 	return StoreType
 }
@@ -405,7 +556,7 @@ func (o *object) String() string {
 	return o.name
 }
 func (o *object) Updated() time.Time {
-	return o.updated
+	return o.updated.UTC()
 }
 func (o *object) MetaData() map[string]string {
 	return o.metadata
@@ -443,6 +594,22 @@ func (o *object) Open(accesslevel cloudstorage.AccessLevel) (*os.File, error) {
 	}
 	defer storecopy.Close()
 
+	encoding, err := o.fs.encoding(o.storepath)
+	if err != nil {
+		return nil, fmt.Errorf("localfs: local=%q could not read encoding err=%v", o.storepath, err)
+	}
+	var src io.Reader
+	if cloudstorage.IsCompressed(encoding) {
+		if stat, err := storecopy.Stat(); err == nil && stat.Size() > 0 {
+			dr, err := cloudstorage.NewDecompressReader(storecopy, encoding)
+			if err != nil {
+				return nil, fmt.Errorf("localfs: local=%q error decompressing err=%v", o.storepath, err)
+			}
+			defer dr.Close()
+			src = dr
+		}
+	}
+
 	err = cloudstorage.EnsureDir(o.cachepath)
 	if err != nil {
 		return nil, fmt.Errorf("localfs: cachepath=%s could not create cachedcopy dir err=%v", o.cachepath, err)
@@ -453,7 +620,12 @@ func (o *object) Open(accesslevel cloudstorage.AccessLevel) (*os.File, error) {
 		return nil, fmt.Errorf("localfs: cachepath=%s could not create cachedcopy err=%v", o.cachepath, err)
 	}
 
-	_, err = io.Copy(cachedcopy, storecopy)
+	if src != nil {
+		_, err = io.Copy(cachedcopy, src)
+	} else {
+		// uncompressed objects are cloned where the file system can
+		err = copyFile(cachedcopy, storecopy)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("localfs: storepath=%s cachedcopy=%v could not copy from store to cache err=%v", o.storepath, cachedcopy.Name(), err)
 	}
@@ -502,6 +674,12 @@ func (o *object) Sync() error {
 		return fmt.Errorf("trying to Sync a readonly object %s", o.name)
 	}
 
+	metadata, err := cloudstorage.NormalizeMetadata(o.metadata)
+	if err != nil {
+		return err
+	}
+	o.metadata = metadata
+
 	cachedcopy, err := os.OpenFile(o.cachepath, os.O_RDONLY, 0664)
 	if err != nil {
 		return err
@@ -518,42 +696,27 @@ func (o *object) Sync() error {
 		o.metadata = make(map[string]string)
 	}
 
-	_, err = io.Copy(storecopy, cachedcopy)
-	if err != nil {
-		return err
-	}
-
-	fmd := o.storepath + ".metadata"
-	return writemeta(fmd, o.metadata)
-}
-
-func readmeta(filename string) (map[string]string, error) {
-	metadata := make(map[string]string)
-	b, err := os.ReadFile(filename)
-	if err == nil {
-		err = json.Unmarshal(b, &metadata)
+	if o.enableCompression {
+		cw, err := o.fs.newCompressWriter(storecopy)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if _, err = io.Copy(cw, cachedcopy); err != nil {
+			return err
+		}
+		if err := cw.Close(); err != nil {
+			return err
 		}
+		o.codec = o.fs.codec()
 	} else {
-		if !errors.Is(err, os.ErrNotExist) {
-			return nil, err
+		if err = copyFile(storecopy, cachedcopy); err != nil {
+			return err
 		}
-	}
-	return metadata, nil
-}
-
-func writemeta(filename string, meta map[string]string) error {
-	bm, err := json.MarshalIndent(meta, "", "  ")
-	if err != nil {
-		return err
+		o.codec = ""
 	}
 
-	err = os.WriteFile(filename, bm, 0664)
-	if err != nil {
-		return err
-	}
-	return nil
+	fmd := o.storepath + ".metadata"
+	return writemeta(fmd, o.metadata, o.codec)
 }
 
 func (o *object) Close() error {
@@ -609,3 +772,17 @@ func (o *object) Release() error {
 	os.Remove(o.cachepath)
 	return nil
 }
+
+// fileMD5 hex md5 digest of the file contents.
+func fileMD5(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -1,9 +1,16 @@
 package localfs_test
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
+	"io"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/lytics/cloudstorage"
 	"github.com/lytics/cloudstorage/localfs"
@@ -37,6 +44,14 @@ func TestAll(t *testing.T) {
 		return
 	}
 	testutils.RunTests(t, store, localFsConf)
+
+	localFsConf.CompressionCodec = cloudstorage.CodecZstd
+	store, err = cloudstorage.NewStore(localFsConf)
+	if err != nil {
+		t.Fatalf("Could not create store: config=%+v  err=%v", localFsConf, err)
+		return
+	}
+	testutils.RunTests(t, store, localFsConf)
 }
 
 func TestBusted(t *testing.T) {
@@ -113,10 +128,11 @@ func TestList(t *testing.T) {
 	t.Parallel()
 
 	for name, tt := range map[string]struct {
-		objs        map[string]string
-		q           cloudstorage.Query
-		startOffset string
-		want        []string
+		objs         map[string]string
+		q            cloudstorage.Query
+		startOffset  string
+		want         []string
+		wantPrefixes []string
 	}{
 		"empty": {
 			objs: nil,
@@ -170,6 +186,48 @@ func TestList(t *testing.T) {
 			},
 			want: []string{"b"},
 		},
+		"delimiter-top-level": {
+			objs: map[string]string{
+				"a":       "ijo",
+				"b/c":     "ijo",
+				"b/d/e":   "ijo",
+				"b/d/f/g": "ijo",
+			},
+			q: cloudstorage.Query{
+				Delimiter: "/",
+			},
+			want:         []string{"a"},
+			wantPrefixes: []string{"b/"},
+		},
+		"delimiter-prefix-level": {
+			objs: map[string]string{
+				"a":       "ijo",
+				"b/c":     "ijo",
+				"b/cc":    "ijo",
+				"b/d/e":   "ijo",
+				"b/d/f/g": "ijo",
+			},
+			q: cloudstorage.Query{
+				Delimiter: "/",
+				Prefix:    "b/c",
+			},
+			want: []string{"b/c", "b/cc"},
+		},
+		"delimiter-prefix-folder": {
+			objs: map[string]string{
+				"a":       "ijo",
+				"b/c":     "ijo",
+				"b/cc":    "ijo",
+				"b/d/e":   "ijo",
+				"b/d/f/g": "ijo",
+			},
+			q: cloudstorage.Query{
+				Delimiter: "/",
+				Prefix:    "b/",
+			},
+			want:         []string{"b/c", "b/cc"},
+			wantPrefixes: []string{"b/d/"},
+		},
 	} {
 		t.Run(name, func(t *testing.T) {
 			ctx := context.Background()
@@ -198,6 +256,373 @@ func TestList(t *testing.T) {
 				names = append(names, o.Name())
 			}
 			require.ElementsMatch(t, tt.want, names)
+			require.ElementsMatch(t, tt.wantPrefixes, got.Prefixes)
 		})
 	}
 }
+
+func TestFolders(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+
+	store, err := localfs.NewLocalStore(
+		"folders",
+		filepath.Join(tmpDir, "mockcloud"),
+		filepath.Join(tmpDir, "localcache"),
+	)
+	require.NoError(t, err)
+	for _, k := range []string{"a", "b/c", "b/d/e", "b/f/g", "bb/h"} {
+		w, err := store.NewWriterWithContext(ctx, k, nil)
+		require.NoError(t, err)
+		_, err = w.Write([]byte("ijo"))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+	}
+
+	// the prefix is a folder with or without the trailing slash
+	for _, prefix := range []string{"b", "b/"} {
+		folders, err := store.Folders(ctx, cloudstorage.NewQueryForFolders(prefix))
+		require.NoError(t, err)
+		require.Equal(t, []string{"b/d/", "b/f/"}, folders, prefix)
+	}
+	folders, err := store.Folders(ctx, cloudstorage.NewQueryForFolders(""))
+	require.NoError(t, err)
+	require.Equal(t, []string{"b/", "bb/"}, folders)
+}
+
+func TestLease(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "mockcloud"),
+		TmpDir:     filepath.Join(tmpDir, "localcache"),
+		Bucket:     "lease",
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, testutils.MockFile(store, "jobs/a.csv", "a"))
+	lease, err := cloudstorage.AcquireLease(ctx, store, "jobs/a.csv", time.Minute)
+	require.NoError(t, err)
+	require.NotEmpty(t, lease.ID())
+
+	_, err = cloudstorage.AcquireLease(ctx, store, "jobs/a.csv", time.Minute)
+	require.Equal(t, cloudstorage.ErrLeaseHeld, err)
+
+	// lock files aren't listed as objects
+	resp, err := store.List(ctx, cloudstorage.NewQuery("jobs/"))
+	require.NoError(t, err)
+	require.Len(t, resp.Objects, 1)
+
+	require.NoError(t, lease.Renew(ctx))
+	require.NoError(t, lease.Release(ctx))
+	require.Equal(t, cloudstorage.ErrLeaseLost, lease.Renew(ctx))
+
+	lease, err = cloudstorage.AcquireLease(ctx, store, "jobs/a.csv", time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, lease.Release(ctx))
+}
+
+func TestTags(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "mockcloud"),
+		TmpDir:     filepath.Join(tmpDir, "localcache"),
+		Bucket:     "tags",
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, testutils.MockFile(store, "logs/a.csv", "a"))
+	require.NoError(t, testutils.MockFile(store, "logs/b.csv", "b"))
+	tagged := store.(cloudstorage.TaggedStore)
+
+	tags, err := tagged.GetTags(ctx, "logs/a.csv")
+	require.NoError(t, err)
+	require.Empty(t, tags)
+
+	require.NoError(t, tagged.SetTags(ctx, "logs/a.csv", map[string]string{"team": "data", "retention": "30d"}))
+	require.NoError(t, tagged.SetTags(ctx, "logs/b.csv", map[string]string{"team": "web"}))
+	tags, err = tagged.GetTags(ctx, "logs/a.csv")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"team": "data", "retention": "30d"}, tags)
+
+	q := cloudstorage.NewQuery("logs/")
+	q.TagFilter = map[string]string{"team": "data"}
+	resp, err := store.List(ctx, q)
+	require.NoError(t, err)
+	require.Len(t, resp.Objects, 1)
+	require.Equal(t, "logs/a.csv", resp.Objects[0].Name())
+
+	require.NoError(t, tagged.SetTags(ctx, "logs/a.csv", nil))
+	resp, err = store.List(ctx, q)
+	require.NoError(t, err)
+	require.Empty(t, resp.Objects)
+
+	_, err = tagged.GetTags(ctx, "logs/missing.csv")
+	require.Equal(t, cloudstorage.ErrObjectNotFound, err)
+}
+
+func TestSetObjectACL(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "mockcloud"),
+		TmpDir:     filepath.Join(tmpDir, "localcache"),
+		Bucket:     "acl",
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, testutils.MockFile(store, "share/a.csv", "a"))
+	mode := func() os.FileMode {
+		fi, err := os.Stat(filepath.Join(tmpDir, "mockcloud", "acl", "share/a.csv"))
+		require.NoError(t, err)
+		return fi.Mode().Perm()
+	}
+
+	require.NoError(t, cloudstorage.SetObjectACL(ctx, store, "share/a.csv", cloudstorage.ACLPrivate))
+	require.Equal(t, os.FileMode(0600), mode())
+	require.NoError(t, cloudstorage.SetObjectACL(ctx, store, "share/a.csv", cloudstorage.ACLPublicRead))
+	require.Equal(t, os.FileMode(0644), mode())
+
+	err = cloudstorage.SetObjectACL(ctx, store, "share/missing.csv", cloudstorage.ACLPublicRead)
+	require.Equal(t, cloudstorage.ErrObjectNotFound, err)
+}
+
+func TestMetadataVersions(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:              localfs.StoreType,
+		AuthMethod:        localfs.AuthFileSystem,
+		LocalFS:           filepath.Join(tmpDir, "mockcloud"),
+		TmpDir:            filepath.Join(tmpDir, "localcache"),
+		Bucket:            "versions",
+		EnableCompression: true,
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+	mdfile := filepath.Join(tmpDir, "mockcloud", "versions", "a.csv.metadata")
+	readEnvelope := func() map[string]interface{} {
+		b, err := os.ReadFile(mdfile)
+		require.NoError(t, err)
+		var env map[string]interface{}
+		require.NoError(t, json.Unmarshal(b, &env))
+		return env
+	}
+
+	// compressed objects keep the codec in the attrs
+	require.NoError(t, cloudstorage.WriteAll(ctx, store, "a.csv", []byte("a,b\n"), map[string]string{"owner": "etl"}))
+	env := readEnvelope()
+	require.Equal(t, float64(1), env["version"])
+	require.Equal(t, map[string]interface{}{"owner": "etl"}, env["metadata"])
+	require.Equal(t, map[string]interface{}{"content_encoding": cloudstorage.CodecGzip}, env["attrs"])
+	obj, err := store.Get(ctx, "a.csv")
+	require.NoError(t, err)
+	require.Equal(t, cloudstorage.CodecGzip, cloudstorage.AttrsOf(obj).ContentEncoding)
+	require.Equal(t, "a,b\n", readAll(t, store, "a.csv"))
+
+	// the flat files of older stores are read, and upgraded by the next write
+	require.NoError(t, os.WriteFile(mdfile, []byte(`{"owner":"legacy","version":"3","content_encoding":"gzip"}`), 0664))
+	obj, err = store.Get(ctx, "a.csv")
+	require.NoError(t, err)
+	require.Equal(t, "legacy", obj.MetaData()["owner"])
+	require.Equal(t, "3", obj.MetaData()["version"])
+	require.Equal(t, "a,b\n", readAll(t, store, "a.csv"))
+	require.NoError(t, store.(cloudstorage.TaggedStore).SetTags(ctx, "a.csv", map[string]string{"team": "data"}))
+	env = readEnvelope()
+	require.Equal(t, float64(1), env["version"])
+	require.Equal(t, "legacy", env["metadata"].(map[string]interface{})["owner"])
+
+	// later versions are read by the fields known
+	require.NoError(t, os.WriteFile(mdfile, []byte(`{"version":2,"metadata":{"owner":"next"},"attrs":{"content_encoding":"gzip","storage_class":"cold"},"checksums":{"md5":"x"}}`), 0664))
+	obj, err = store.Get(ctx, "a.csv")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"owner": "next"}, obj.MetaData())
+	require.Equal(t, cloudstorage.CodecGzip, cloudstorage.AttrsOf(obj).ContentEncoding)
+	require.Equal(t, "a,b\n", readAll(t, store, "a.csv"))
+
+	// a content_encoding of the custom metadata is kept apart from the codec
+	md := map[string]string{"content_encoding": "br"}
+	require.NoError(t, cloudstorage.WriteAll(ctx, store, "a.csv", []byte("a,b\n"), md))
+	obj, err = store.Get(ctx, "a.csv")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"content_encoding": "br"}, obj.MetaData())
+	require.Equal(t, cloudstorage.CodecGzip, cloudstorage.AttrsOf(obj).ContentEncoding)
+	require.Equal(t, "a,b\n", readAll(t, store, "a.csv"))
+	w, err := store.NewWriterWithContext(ctx, "a.csv", md, cloudstorage.Opts{DisableCompression: true})
+	require.NoError(t, err)
+	_, err = w.Write([]byte("c,d\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.Equal(t, map[string]string{"content_encoding": "br"}, md)
+	obj, err = store.Get(ctx, "a.csv")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"content_encoding": "br"}, obj.MetaData())
+	require.Equal(t, "", cloudstorage.AttrsOf(obj).ContentEncoding)
+	require.Equal(t, "c,d\n", readAll(t, store, "a.csv"))
+}
+
+func readAll(t *testing.T, store cloudstorage.Store, name string) string {
+	rc, err := store.NewReaderWithContext(context.Background(), name)
+	require.NoError(t, err)
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestCompression(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+
+	localFsConf := &cloudstorage.Config{
+		Type:              localfs.StoreType,
+		AuthMethod:        localfs.AuthFileSystem,
+		LocalFS:           filepath.Join(tmpDir, "mockcloud"),
+		TmpDir:            filepath.Join(tmpDir, "localcache"),
+		Bucket:            "compression",
+		EnableCompression: true,
+	}
+	store, err := cloudstorage.NewStore(localFsConf)
+	require.NoError(t, err)
+	ctx := context.Background()
+	data := strings.Repeat("a,b,c\n", 1000)
+
+	// stored gzipped
+	require.NoError(t, cloudstorage.WriteAll(ctx, store, "a.csv", []byte(data), nil))
+	stored, err := os.ReadFile(filepath.Join(tmpDir, "mockcloud", "compression", "a.csv"))
+	require.NoError(t, err)
+	require.Less(t, len(stored), len(data))
+	zr, err := gzip.NewReader(bytes.NewReader(stored))
+	require.NoError(t, err)
+	by, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	require.Equal(t, data, string(by))
+
+	// a gzip file put in place without a metadata file is sniffed
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err = zw.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "mockcloud", "compression", "b.csv"), buf.Bytes(), 0664))
+	by, err = cloudstorage.ReadAll(ctx, store, "b.csv")
+	require.NoError(t, err)
+	require.Equal(t, data, string(by))
+
+	localFsConf.CompressionCodec = "lz4"
+	_, err = cloudstorage.NewStore(localFsConf)
+	require.Error(t, err)
+}
+
+func TestMetadata(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+
+	localFsConf := &cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "mockcloud"),
+		TmpDir:     filepath.Join(tmpDir, "localcache"),
+		Bucket:     "metadata",
+	}
+	store, err := cloudstorage.NewStore(localFsConf)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// keys are kept as given, hyphens and case included
+	w, err := store.NewWriterWithContext(ctx, "a.csv", map[string]string{"Owner": "data", "x-team": " etl "})
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	obj, err := store.Get(ctx, "a.csv")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"Owner": "data", "x-team": "etl"}, obj.MetaData())
+
+	_, err = store.NewWriterWithContext(ctx, "b.csv", map[string]string{"owner": "a\nb"})
+	require.ErrorIs(t, err, cloudstorage.ErrInvalidMetadata)
+	err = cloudstorage.Put(ctx, store, "b.csv", strings.NewReader("b"), map[string]string{"": "data"})
+	require.ErrorIs(t, err, cloudstorage.ErrInvalidMetadata)
+}
+
+func TestSyncMetadataKeys(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+
+	localFsConf := &cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "mockcloud"),
+		TmpDir:     filepath.Join(tmpDir, "localcache"),
+		Bucket:     "syncmeta",
+	}
+	store, err := cloudstorage.NewStore(localFsConf)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	obj, err := store.NewObject("a.csv")
+	require.NoError(t, err)
+	obj.SetMetaData(map[string]string{"Content-Owner": "Data-Team"})
+	f, err := obj.Open(cloudstorage.ReadWrite)
+	require.NoError(t, err)
+	_, err = f.WriteString("a,b")
+	require.NoError(t, err)
+	require.NoError(t, obj.Close())
+
+	obj, err = store.Get(ctx, "a.csv")
+	require.NoError(t, err)
+	require.Equal(t, "Data-Team", obj.MetaData()["Content-Owner"])
+}
+
+func TestMoveRenames(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+
+	localFsConf := &cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "mockcloud"),
+		TmpDir:     filepath.Join(tmpDir, "localcache"),
+		Bucket:     "move",
+	}
+	store, err := cloudstorage.NewStore(localFsConf)
+	require.NoError(t, err)
+	ctx := context.Background()
+	root := filepath.Join(tmpDir, "mockcloud", "move")
+
+	require.NoError(t, cloudstorage.WriteAll(ctx, store, "in/a.csv", []byte("a,b"), map[string]string{"owner": "data"}))
+	require.NoError(t, cloudstorage.WriteAll(ctx, store, "out/a.csv", []byte("old"), map[string]string{"stale": "yes"}))
+	before, err := os.Stat(filepath.Join(root, "in", "a.csv"))
+	require.NoError(t, err)
+
+	src, err := store.Get(ctx, "in/a.csv")
+	require.NoError(t, err)
+	dst, err := store.Get(ctx, "out/a.csv")
+	require.NoError(t, err)
+	require.NoError(t, cloudstorage.Move(ctx, store, src, dst))
+
+	// the file was renamed, not copied
+	after, err := os.Stat(filepath.Join(root, "out", "a.csv"))
+	require.NoError(t, err)
+	require.True(t, os.SameFile(before, after))
+	moved, err := store.Get(ctx, "out/a.csv")
+	require.NoError(t, err)
+	require.Equal(t, "data", moved.MetaData()["owner"])
+	require.Empty(t, moved.MetaData()["stale"])
+	_, err = store.Get(ctx, "in/a.csv")
+	require.Equal(t, cloudstorage.ErrObjectNotFound, err)
+	// the emptied folder went with it
+	_, err = os.Stat(filepath.Join(root, "in"))
+	require.True(t, os.IsNotExist(err))
+
+	require.ErrorIs(t, store.(cloudstorage.StoreMove).Move(ctx, src, dst), cloudstorage.ErrObjectNotFound)
+}
@@ -0,0 +1,40 @@
+package localfs
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+var _ cloudstorage.TaggedStore = (*LocalStore)(nil)
+
+// GetTags of the object, kept in its metadata file.
+func (l *LocalStore) GetTags(ctx context.Context, name string) (map[string]string, error) {
+	fo, err := l.pathForObject(name)
+	if err != nil {
+		return nil, err
+	}
+	md, _, err := readmeta(fo + ".metadata")
+	if err != nil {
+		return nil, err
+	}
+	return cloudstorage.DecodeTags(md[cloudstorage.TagsMetadataKey]), nil
+}
+
+// SetTags replaces the tags in the object's metadata file.
+func (l *LocalStore) SetTags(ctx context.Context, name string, tags map[string]string) error {
+	fo, err := l.pathForObject(name)
+	if err != nil {
+		return err
+	}
+	md, codec, err := readmeta(fo + ".metadata")
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		delete(md, cloudstorage.TagsMetadataKey)
+	} else {
+		md[cloudstorage.TagsMetadataKey] = cloudstorage.EncodeTags(tags)
+	}
+	return writemeta(fo+".metadata", md, codec)
+}
@@ -0,0 +1,288 @@
+package cloudstorage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/araddon/gou"
+	"golang.org/x/net/context"
+)
+
+// Manager is a Store rebuilt when its Config changes, so buckets and
+// credentials are rotated without restarting the service.  Every call goes
+// to the current store, Reload swaps in a store of the new Config once it
+// is created and waits for the calls in flight on the old one to finish.
+//
+// Readers and writers count as in flight until closed, listings per page.
+// Objects returned by Get or NewObject stay bound to the store that made
+// them.
+type Manager struct {
+	// OnReload, if set, is called after each reload by WatchFile with the
+	// new config and the error of the reload.
+	OnReload func(conf *Config, err error)
+
+	mu  sync.RWMutex
+	gen *generation
+}
+
+// generation is a store built by the Manager and its calls in flight.
+type generation struct {
+	store    Store
+	conf     *Config
+	inflight sync.WaitGroup
+}
+
+var (
+	_ Store     = (*Manager)(nil)
+	_ StoreCopy = (*Manager)(nil)
+	_ StoreMove = (*Manager)(nil)
+	_ StorePut  = (*Manager)(nil)
+)
+
+// NewManager returns a Manager of the store of conf.
+func NewManager(conf *Config) (*Manager, error) {
+	s, err := NewStore(conf)
+	if err != nil {
+		return nil, err
+	}
+	return &Manager{gen: &generation{store: s, conf: conf}}, nil
+}
+
+// Config returns the Config of the current store.
+func (m *Manager) Config() *Config {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.gen.conf
+}
+
+// Reload builds the store of conf and makes it current, then waits for the
+// calls in flight on the previous store until ctx is done.  If the store
+// can't be built the current one is kept and the error returned.  The
+// error of ctx is returned if the previous store isn't drained in time, the
+// new store is current all the same.
+func (m *Manager) Reload(ctx context.Context, conf *Config) error {
+	s, err := NewStore(conf)
+	if err != nil {
+		return fmt.Errorf("could not rebuild store err=%w", err)
+	}
+	m.mu.Lock()
+	old := m.gen
+	m.gen = &generation{store: s, conf: conf}
+	m.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		old.inflight.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WatchFile reloads the Manager with the json Config of file when the
+// watch starts and whenever the file changes, checking every interval
+// until ctx is done.  The KeyEncoder, which has no json form, is kept from
+// the current Config.  Reload errors are passed to OnReload, the watch
+// goes on.
+func (m *Manager) WatchFile(ctx context.Context, file string, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var last []byte
+	for {
+		data, err := os.ReadFile(file)
+		switch {
+		case err != nil:
+			// mid replace by an editor or deploy, retried next tick
+			gou.Warnf("could not read config file %s err=%v", file, err)
+		case last == nil || !bytes.Equal(data, last):
+			last = data
+			m.reloadFile(ctx, file, data)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Manager) reloadFile(ctx context.Context, file string, data []byte) {
+	conf := &Config{}
+	err := json.Unmarshal(data, conf)
+	if err == nil {
+		conf.KeyEncoder = m.Config().KeyEncoder
+		err = m.Reload(ctx, conf)
+	} else {
+		err = fmt.Errorf("invalid config file %s err=%w", file, err)
+	}
+	if err != nil {
+		gou.Warnf("could not reload store err=%v", err)
+	}
+	if m.OnReload != nil {
+		m.OnReload(conf, err)
+	}
+}
+
+// acquire the current generation for a call, release it when done.
+func (m *Manager) acquire() *generation {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	m.gen.inflight.Add(1)
+	return m.gen
+}
+
+func (g *generation) release() {
+	g.inflight.Done()
+}
+
+func (m *Manager) Type() string {
+	g := m.acquire()
+	defer g.release()
+	return g.store.Type()
+}
+func (m *Manager) Client() interface{} {
+	g := m.acquire()
+	defer g.release()
+	return g.store.Client()
+}
+func (m *Manager) String() string {
+	g := m.acquire()
+	defer g.release()
+	return g.store.String()
+}
+
+func (m *Manager) Get(ctx context.Context, name string) (Object, error) {
+	return m.GetWithOpts(ctx, name)
+}
+func (m *Manager) GetWithOpts(ctx context.Context, name string, opts ...Opts) (Object, error) {
+	g := m.acquire()
+	defer g.release()
+	return GetWithOpts(ctx, g.store, name, opts...)
+}
+
+func (m *Manager) List(ctx context.Context, q Query) (*ObjectsResponse, error) {
+	g := m.acquire()
+	defer g.release()
+	return g.store.List(ctx, q)
+}
+
+func (m *Manager) Objects(ctx context.Context, q Query) (ObjectIterator, error) {
+	return NewObjectPageIterator(ctx, m, q), nil
+}
+
+func (m *Manager) Folders(ctx context.Context, q Query) ([]string, error) {
+	g := m.acquire()
+	defer g.release()
+	return g.store.Folders(ctx, q)
+}
+
+func (m *Manager) FolderIterator(ctx context.Context, q Query) (FolderIterator, error) {
+	return NewFolderPageIterator(ctx, m, q), nil
+}
+
+func (m *Manager) NewReader(name string) (io.ReadCloser, error) {
+	return m.NewReaderWithContext(context.Background(), name)
+}
+func (m *Manager) NewReaderWithContext(ctx context.Context, name string) (io.ReadCloser, error) {
+	return m.NewReaderWithOpts(ctx, name)
+}
+func (m *Manager) NewReaderWithOpts(ctx context.Context, name string, opts ...Opts) (io.ReadCloser, error) {
+	g := m.acquire()
+	rc, err := NewReaderWithOpts(ctx, g.store, name, opts...)
+	if err != nil {
+		g.release()
+		return nil, err
+	}
+	return &managedReader{ReadCloser: rc, g: g}, nil
+}
+func (m *Manager) NewWriter(name string, metadata map[string]string) (io.WriteCloser, error) {
+	return m.NewWriterWithContext(context.Background(), name, metadata)
+}
+func (m *Manager) NewWriterWithContext(ctx context.Context, name string, metadata map[string]string, opts ...Opts) (io.WriteCloser, error) {
+	g := m.acquire()
+	wc, err := g.store.NewWriterWithContext(ctx, name, metadata, opts...)
+	if err != nil {
+		g.release()
+		return nil, err
+	}
+	mw := &managedWriter{WriteCloser: wc, g: g}
+	if rw, ok := wc.(ResultWriter); ok {
+		// keep the store's Result visible through the manager
+		return NewResultWriter(mw, func(r *UploadResult) error {
+			*r = rw.Result()
+			return nil
+		}), nil
+	}
+	return mw, nil
+}
+
+func (m *Manager) NewObject(name string, opts ...Opts) (Object, error) {
+	g := m.acquire()
+	defer g.release()
+	return g.store.NewObject(name, opts...)
+}
+
+func (m *Manager) Delete(ctx context.Context, name string, opts ...Opts) error {
+	g := m.acquire()
+	defer g.release()
+	return g.store.Delete(ctx, name, opts...)
+}
+
+func (m *Manager) Copy(ctx context.Context, src, dst Object) error {
+	return m.CopyWithOpts(ctx, src, dst)
+}
+func (m *Manager) CopyWithOpts(ctx context.Context, src, dst Object, opts ...Opts) error {
+	g := m.acquire()
+	defer g.release()
+	return fastCopy(ctx, g.store, src, dst, opts)
+}
+
+func (m *Manager) Move(ctx context.Context, src, dst Object) error {
+	return m.MoveWithOpts(ctx, src, dst)
+}
+func (m *Manager) MoveWithOpts(ctx context.Context, src, dst Object, opts ...Opts) error {
+	g := m.acquire()
+	defer g.release()
+	return fastMove(ctx, g.store, src, dst, opts)
+}
+
+func (m *Manager) Put(ctx context.Context, name string, r io.Reader, metadata map[string]string, opts ...Opts) error {
+	g := m.acquire()
+	defer g.release()
+	return Put(ctx, g.store, name, r, metadata, opts...)
+}
+
+// managedReader releases its generation when closed.
+type managedReader struct {
+	io.ReadCloser
+	g    *generation
+	once sync.Once
+}
+
+func (r *managedReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.g.release)
+	return err
+}
+
+// managedWriter releases its generation when closed.
+type managedWriter struct {
+	io.WriteCloser
+	g    *generation
+	once sync.Once
+}
+
+func (w *managedWriter) Close() error {
+	err := w.WriteCloser.Close()
+	w.once.Do(w.g.release)
+	return err
+}
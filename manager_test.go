@@ -0,0 +1,136 @@
+package cloudstorage_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/localfs"
+	"github.com/lytics/cloudstorage/mockstore"
+)
+
+func TestManager(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	confOf := func(dir string) *cloudstorage.Config {
+		return &cloudstorage.Config{
+			Type:       localfs.StoreType,
+			AuthMethod: localfs.AuthFileSystem,
+			LocalFS:    filepath.Join(tmpDir, dir),
+			TmpDir:     filepath.Join(tmpDir, "tmp"),
+		}
+	}
+	m, err := cloudstorage.NewManager(confOf("one"))
+	require.NoError(t, err)
+	require.NoError(t, cloudstorage.WriteAll(ctx, m, "a.csv", []byte("a"), nil))
+
+	// a writer open on the old store holds up the reload
+	w, err := m.NewWriterWithContext(ctx, "b.csv", nil)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("b"))
+	require.NoError(t, err)
+	rctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, m.Reload(rctx, confOf("two")))
+	require.Equal(t, filepath.Join(tmpDir, "two"), m.Config().LocalFS)
+
+	// new calls go to the new store
+	_, err = m.Get(ctx, "a.csv")
+	require.Equal(t, cloudstorage.ErrObjectNotFound, err)
+	require.NoError(t, cloudstorage.WriteAll(ctx, m, "c.csv", []byte("c"), nil))
+	require.NoError(t, w.Close())
+	require.FileExists(t, filepath.Join(tmpDir, "one", "b.csv"))
+	require.FileExists(t, filepath.Join(tmpDir, "two", "c.csv"))
+
+	require.NoError(t, m.Reload(ctx, confOf("one")))
+	b, err := cloudstorage.ReadAll(ctx, m, "b.csv")
+	require.NoError(t, err)
+	require.Equal(t, "b", string(b))
+
+	err = m.Reload(ctx, &cloudstorage.Config{Type: "nope"})
+	require.Error(t, err)
+	require.Equal(t, filepath.Join(tmpDir, "one"), m.Config().LocalFS)
+}
+
+func TestManagerWatchFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	confFile := filepath.Join(tmpDir, "store.json")
+	// replaced whole, the watcher never reads a partial file
+	replace := func(data []byte) {
+		require.NoError(t, os.WriteFile(confFile+".tmp", data, 0644))
+		require.NoError(t, os.Rename(confFile+".tmp", confFile))
+	}
+	writeConf := func(conf *cloudstorage.Config) {
+		data, err := json.Marshal(conf)
+		require.NoError(t, err)
+		replace(data)
+	}
+	conf := &cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "one"),
+		TmpDir:     filepath.Join(tmpDir, "tmp"),
+		KeyEncoder: cloudstorage.SafeKeyEncoder{},
+	}
+	writeConf(conf)
+	m, err := cloudstorage.NewManager(conf)
+	require.NoError(t, err)
+	reloads := make(chan error, 2)
+	m.OnReload = func(conf *cloudstorage.Config, err error) {
+		reloads <- err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- m.WatchFile(ctx, confFile, 5*time.Millisecond)
+	}()
+
+	require.NoError(t, <-reloads)
+	next := *conf
+	next.LocalFS = filepath.Join(tmpDir, "two")
+	writeConf(&next)
+	require.NoError(t, <-reloads)
+	require.Equal(t, filepath.Join(tmpDir, "two"), m.Config().LocalFS)
+	require.Equal(t, cloudstorage.SafeKeyEncoder{}, m.Config().KeyEncoder)
+
+	replace([]byte("{"))
+	require.Error(t, <-reloads)
+	require.Equal(t, filepath.Join(tmpDir, "two"), m.Config().LocalFS)
+
+	cancel()
+	require.Equal(t, context.Canceled, <-done)
+}
+
+func TestManagerWriterResult(t *testing.T) {
+	ctx := context.Background()
+	inner := mockstore.New()
+	cloudstorage.Register("managermock", func(conf *cloudstorage.Config) (cloudstorage.Store, error) {
+		return inner, nil
+	})
+	defer cloudstorage.Unregister("managermock")
+	m, err := cloudstorage.NewManager(&cloudstorage.Config{Type: "managermock"})
+	require.NoError(t, err)
+
+	w, err := m.NewWriterWithContext(ctx, "a.csv", nil)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("a,b\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	// the result of the store's writer shows through the manager
+	rw, ok := w.(cloudstorage.ResultWriter)
+	require.True(t, ok)
+	res := rw.Result()
+	require.Equal(t, int64(4), res.Size)
+	obj, err := inner.Get(ctx, "a.csv")
+	require.NoError(t, err)
+	require.NotEmpty(t, res.ETag)
+	require.Equal(t, obj.(cloudstorage.ObjectETagger).ETag(), res.ETag)
+}
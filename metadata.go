@@ -0,0 +1,50 @@
+package cloudstorage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaxMetadataSize is the most metadata an object can have, the total length
+// of its keys and values.  It is s3's limit, the smallest of the stores.
+const MaxMetadataSize = 2 << 10
+
+// NormalizeMetadata returns a copy of metadata as every store writes it and
+// reads it back, the writers of the stores that keep metadata call it so
+// metadata moves between them unchanged.
+//
+// Values are trimmed of the surrounding whitespace http headers drop.  Keys
+// may not be empty, keys and values may not have control characters and
+// may total MaxMetadataSize.  The errors wrap ErrInvalidMetadata.  Keys are
+// kept as given, the stores check them against their own rules when
+// writing (azure keys are C# identifiers, s3 keys http header names it
+// lowercases).
+func NormalizeMetadata(metadata map[string]string) (map[string]string, error) {
+	if metadata == nil {
+		return nil, nil
+	}
+	md := make(map[string]string, len(metadata))
+	size := 0
+	for k, v := range metadata {
+		if k == "" {
+			return nil, fmt.Errorf("%w: empty key", ErrInvalidMetadata)
+		}
+		if strings.IndexFunc(k, isControl) >= 0 {
+			return nil, fmt.Errorf("%w: key %q has control characters", ErrInvalidMetadata, k)
+		}
+		val := strings.TrimSpace(v)
+		if strings.IndexFunc(val, isControl) >= 0 {
+			return nil, fmt.Errorf("%w: value of key %q has control characters", ErrInvalidMetadata, k)
+		}
+		md[k] = val
+		size += len(k) + len(val)
+	}
+	if size > MaxMetadataSize {
+		return nil, fmt.Errorf("%w: size %d is more than %d bytes", ErrInvalidMetadata, size, MaxMetadataSize)
+	}
+	return md, nil
+}
+
+func isControl(r rune) bool {
+	return r < ' ' || r == 0x7f
+}
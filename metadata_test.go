@@ -0,0 +1,32 @@
+package cloudstorage_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+)
+
+func TestNormalizeMetadata(t *testing.T) {
+	md, err := cloudstorage.NormalizeMetadata(nil)
+	require.NoError(t, err)
+	require.Nil(t, md)
+
+	in := map[string]string{"Content-Type": "text/csv", "owner": " data team ", "_v2": "1"}
+	md, err = cloudstorage.NormalizeMetadata(in)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"Content-Type": "text/csv", "owner": "data team", "_v2": "1"}, md)
+	require.Equal(t, " data team ", in["owner"], "the caller's map is left alone")
+
+	for name, md := range map[string]map[string]string{
+		"empty key":     {"": "a"},
+		"newline key":   {"own\ner": "a"},
+		"newline value": {"owner": "a\nb"},
+		"too large":     {"owner": strings.Repeat("a", cloudstorage.MaxMetadataSize)},
+	} {
+		_, err := cloudstorage.NormalizeMetadata(md)
+		require.ErrorIs(t, err, cloudstorage.ErrInvalidMetadata, name)
+	}
+}
@@ -0,0 +1,615 @@
+// Package mockstore is an in memory cloudstorage.Store for unit tests of
+// code using a Store, without a bucket or local folders to set up.  Calls
+// to the store are recorded and can be made to fail:
+//
+//	store := mockstore.New()
+//	store.Add("in/a.csv", []byte("a,b\n"), nil)
+//	store.Fail("NewWriter", "out/a.csv", errors.New("quota exceeded"), 1)
+//	err := process(ctx, store)
+//	calls := store.Calls()
+//
+// Objects only touch the disk while opened, for the *os.File Open returns.
+package mockstore
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+// StoreType = "mockstore" is the Type of the Store and the StorageSource of
+// its objects.
+const StoreType = "mockstore"
+
+// Call of a Store method recorded by the Store.  NewReaderWithContext and
+// NewWriterWithContext are recorded as "NewReader" and "NewWriter", the
+// Sync (or Close) of an object's changes as "Sync".
+type Call struct {
+	// Method name.
+	Method string
+	// Name of the object, or the Query prefix of listings.
+	Name string
+}
+
+type failure struct {
+	method string
+	name   string
+	err    error
+	times  int
+}
+
+type entry struct {
+	data     []byte
+	metadata map[string]string
+	updated  time.Time
+	etag     string
+}
+
+// Store keeps objects in memory, it is safe for concurrent use.
+type Store struct {
+	// TmpDir of the files of opened objects, os.TempDir if "".
+	TmpDir string
+
+	mu       sync.Mutex
+	objects  map[string]*entry
+	calls    []Call
+	failures []*failure
+}
+
+var (
+	_ cloudstorage.Store             = (*Store)(nil)
+	_ cloudstorage.StoreTimestamps   = (*Store)(nil)
+	_ cloudstorage.StoreCapabilities = (*Store)(nil)
+	_ cloudstorage.StoreRangeReader  = (*Store)(nil)
+)
+
+// New empty Store.
+func New() *Store {
+	return &Store{objects: make(map[string]*entry)}
+}
+
+// Add object name with data and metadata to the store, without recording a
+// call.
+func (s *Store) Add(name string, data []byte, metadata map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(name, data, metadata)
+}
+
+// Data of object name, false if there is no such object.
+func (s *Store) Data(name string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.objects[name]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), e.data...), true
+}
+
+// Fail makes the calls of method on object name ("" is any object) return
+// err.  Only the next times calls fail, every call if times is 0.  The
+// failures added first are checked first.
+func (s *Store) Fail(method, name string, err error, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, &failure{method: method, name: name, err: err, times: times})
+}
+
+// Calls recorded so far, in order.
+func (s *Store) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Call(nil), s.calls...)
+}
+
+// Reset forgets the recorded calls and the failures still to come, the
+// objects are kept.
+func (s *Store) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = nil
+	s.failures = nil
+}
+
+// call records a call of method on name, returning the error it is made to
+// fail with.
+func (s *Store) call(method, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, Call{Method: method, Name: name})
+	for i, f := range s.failures {
+		if f.method != method || (f.name != "" && f.name != name) {
+			continue
+		}
+		if f.times > 0 {
+			if f.times--; f.times == 0 {
+				s.failures = append(s.failures[:i], s.failures[i+1:]...)
+			}
+		}
+		return f.err
+	}
+	return nil
+}
+
+// put stores an object, s.mu must be held.
+func (s *Store) put(name string, data []byte, metadata map[string]string) *entry {
+	md := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		md[k] = v
+	}
+	sum := md5.Sum(data)
+	e := &entry{
+		data:     append([]byte(nil), data...),
+		metadata: md,
+		updated:  time.Now().UTC(),
+		etag:     hex.EncodeToString(sum[:]),
+	}
+	s.objects[name] = e
+	return e
+}
+
+// Type of store = "mockstore"
+func (s *Store) Type() string {
+	return StoreType
+}
+
+// UpdatedGranularity of the mock store, updated times have nanoseconds.
+func (s *Store) UpdatedGranularity() time.Duration {
+	return time.Nanosecond
+}
+
+// Capabilities of the mock store.
+func (s *Store) Capabilities() cloudstorage.Capabilities {
+	return cloudstorage.Capabilities{ETags: true, IfNotExists: true, Concurrent: true}
+}
+
+// Client is the Store itself.
+func (s *Store) Client() interface{} {
+	return s
+}
+
+func (s *Store) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fmt.Sprintf("<mockstore objects=%d />", len(s.objects))
+}
+
+// NewObject of name, ErrObjectExists if it exists unless opts Overwrite.
+func (s *Store) NewObject(name string, opts ...cloudstorage.Opts) (cloudstorage.Object, error) {
+	if err := s.call("NewObject", name); err != nil {
+		return nil, err
+	}
+	if len(opts) > 0 && opts[0].WriteThrough {
+		return cloudstorage.NewWriteThroughObject(s, name, opts[0])
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.objects[name]; ok {
+		if len(opts) > 0 && opts[0].Overwrite {
+			if opts[0].Stream {
+				return cloudstorage.NewStreamObject(s, s.newObject(name, e), opts[0]), nil
+			}
+			return s.newObject(name, e), nil
+		}
+		return nil, cloudstorage.ErrObjectExists
+	}
+	return &object{store: s, name: name, metadata: make(map[string]string)}, nil
+}
+
+// newObject of stored entry e, s.mu must be held.
+func (s *Store) newObject(name string, e *entry) *object {
+	md := make(map[string]string, len(e.metadata))
+	for k, v := range e.metadata {
+		md[k] = v
+	}
+	return &object{
+		store:    s,
+		name:     name,
+		metadata: md,
+		updated:  e.updated,
+		size:     int64(len(e.data)),
+		etag:     e.etag,
+		data:     e.data,
+	}
+}
+
+// Get object name, ErrObjectNotFound if it doesn't exist.
+func (s *Store) Get(ctx context.Context, name string) (cloudstorage.Object, error) {
+	if err := s.call("Get", name); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.objects[name]
+	if !ok {
+		return nil, cloudstorage.ErrObjectNotFound
+	}
+	return s.newObject(name, e), nil
+}
+
+// List the objects and, with a Query Delimiter, the folders matching q.
+func (s *Store) List(ctx context.Context, q cloudstorage.Query) (*cloudstorage.ObjectsResponse, error) {
+	if err := s.call("List", q.Prefix); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	pageSize := q.PageSize
+	if pageSize <= 0 {
+		pageSize = cloudstorage.MaxResults
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.objects))
+	for name := range s.objects {
+		if strings.HasPrefix(name, q.Prefix) && name > q.Marker {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	// a page has pageSize objects and folders, a folder's objects are
+	// skipped, the marker being the last of either.
+	resp := &cloudstorage.ObjectsResponse{}
+	var last string
+	n := 0
+	for _, name := range names {
+		if q.Delimiter != "" && strings.HasSuffix(q.Marker, q.Delimiter) && strings.HasPrefix(name, q.Marker) {
+			continue
+		}
+		key, folder := name, false
+		if q.Delimiter != "" {
+			if j := strings.Index(name[len(q.Prefix):], q.Delimiter); j >= 0 {
+				key, folder = name[:len(q.Prefix)+j+len(q.Delimiter)], true
+			}
+		}
+		if folder && key == last {
+			continue
+		}
+		if n == pageSize {
+			resp.NextMarker = last
+			break
+		}
+		n++
+		last = key
+		if folder {
+			resp.Prefixes = append(resp.Prefixes, key)
+			continue
+		}
+		e := s.objects[name]
+		if !q.Match(name, int64(len(e.data))) {
+			continue
+		}
+		resp.Objects = append(resp.Objects, s.newObject(name, e))
+	}
+	resp.Objects = q.ApplyFilters(resp.Objects)
+	return resp, nil
+}
+
+// Objects returns an iterator over the objects matching q.
+func (s *Store) Objects(ctx context.Context, q cloudstorage.Query) (cloudstorage.ObjectIterator, error) {
+	return cloudstorage.NewObjectPageIterator(ctx, s, q), nil
+}
+
+// Folders below the Query prefix.
+func (s *Store) Folders(ctx context.Context, q cloudstorage.Query) ([]string, error) {
+	iter, err := s.FolderIterator(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+	return cloudstorage.FoldersAll(iter)
+}
+
+// FolderIterator returns an iterator over the folders below the Query prefix.
+func (s *Store) FolderIterator(ctx context.Context, q cloudstorage.Query) (cloudstorage.FolderIterator, error) {
+	return cloudstorage.NewFolderPageIterator(ctx, s, q), nil
+}
+
+// NewReader of object name.
+func (s *Store) NewReader(name string) (io.ReadCloser, error) {
+	return s.NewReaderWithContext(context.Background(), name)
+}
+
+// NewReaderWithContext of object name.
+func (s *Store) NewReaderWithContext(ctx context.Context, name string) (io.ReadCloser, error) {
+	return s.NewReaderWithOpts(ctx, name)
+}
+
+// NewReaderWithOpts of object name, honoring Opts.IfNoneMatch.
+func (s *Store) NewReaderWithOpts(ctx context.Context, name string, opts ...cloudstorage.Opts) (io.ReadCloser, error) {
+	if err := s.call("NewReader", name); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.objects[name]
+	if !ok {
+		return nil, cloudstorage.ErrObjectNotFound
+	}
+	if len(opts) > 0 && opts[0].IfNoneMatch != "" && opts[0].IfNoneMatch == e.etag {
+		return nil, cloudstorage.ErrNotModified
+	}
+	return io.NopCloser(bytes.NewReader(e.data)), nil
+}
+
+// NewRangeReader of length bytes of object name from offset, to the end if
+// length is negative.
+func (s *Store) NewRangeReader(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	if err := s.call("NewRangeReader", name); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.objects[name]
+	if !ok {
+		return nil, cloudstorage.ErrObjectNotFound
+	}
+	data := e.data
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	data = data[offset:]
+	if length >= 0 && length < int64(len(data)) {
+		data = data[:length]
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// NewWriter of object name.
+func (s *Store) NewWriter(name string, metadata map[string]string) (io.WriteCloser, error) {
+	return s.NewWriterWithContext(context.Background(), name, metadata)
+}
+
+// NewWriterWithContext of object name, the object is replaced once the
+// writer is closed, unless ctx is done by then.  With Opts.IfNotExists
+// ErrObjectExists is returned for existing objects.
+func (s *Store) NewWriterWithContext(ctx context.Context, name string, metadata map[string]string, opts ...cloudstorage.Opts) (io.WriteCloser, error) {
+	if err := s.call("NewWriter", name); err != nil {
+		return nil, err
+	}
+	metadata, err := cloudstorage.NormalizeMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+	ifNotExists := len(opts) > 0 && opts[0].IfNotExists
+	if ifNotExists {
+		s.mu.Lock()
+		_, ok := s.objects[name]
+		s.mu.Unlock()
+		if ok {
+			return nil, cloudstorage.ErrObjectExists
+		}
+	}
+	w := &writer{ctx: ctx, store: s, name: name, metadata: metadata, ifNotExists: ifNotExists}
+	return cloudstorage.NewResultWriter(w, w.result), nil
+}
+
+type writer struct {
+	ctx         context.Context
+	store       *Store
+	name        string
+	metadata    map[string]string
+	ifNotExists bool
+	buf         bytes.Buffer
+	etag        string
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.buf.Write(p)
+}
+
+func (w *writer) Close() error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	w.store.mu.Lock()
+	defer w.store.mu.Unlock()
+	if _, ok := w.store.objects[w.name]; ok && w.ifNotExists {
+		return cloudstorage.ErrObjectExists
+	}
+	w.etag = w.store.put(w.name, w.buf.Bytes(), w.metadata).etag
+	return nil
+}
+
+func (w *writer) result(res *cloudstorage.UploadResult) error {
+	res.ETag = w.etag
+	return nil
+}
+
+// Delete object name, honoring Opts.IfMatch.
+func (s *Store) Delete(ctx context.Context, name string, opts ...cloudstorage.Opts) error {
+	if err := s.call("Delete", name); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.objects[name]
+	if !ok {
+		return cloudstorage.ErrObjectNotFound
+	}
+	if len(opts) > 0 && opts[0].IfMatch != "" && opts[0].IfMatch != e.etag {
+		return cloudstorage.ErrPreconditionFailed
+	}
+	delete(s.objects, name)
+	return nil
+}
+
+// sync replaces object name with the content of file f.
+func (s *Store) sync(name string, f *os.File, metadata map[string]string) (*entry, error) {
+	if err := s.call("Sync", name); err != nil {
+		return nil, err
+	}
+	metadata, err := cloudstorage.NormalizeMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.put(name, data, metadata), nil
+}
+
+type object struct {
+	store    *Store
+	name     string
+	metadata map[string]string
+	updated  time.Time
+	size     int64
+	etag     string
+	data     []byte
+
+	cachedcopy *os.File
+	readonly   bool
+	opened     bool
+}
+
+func (o *object) StorageSource() string {
+	return StoreType
+}
+func (o *object) Name() string {
+	return o.name
+}
+func (o *object) String() string {
+	return o.name
+}
+func (o *object) Updated() time.Time {
+	return o.updated
+}
+func (o *object) MetaData() map[string]string {
+	return o.metadata
+}
+func (o *object) SetMetaData(meta map[string]string) {
+	o.metadata = meta
+}
+
+// Size of the object when it was listed or fetched.
+func (o *object) Size() int64 {
+	return o.size
+}
+
+// ETag of the object when it was listed or fetched, the hex md5 digest of
+// its content.
+func (o *object) ETag() string {
+	return o.etag
+}
+
+func (o *object) DisableCompression() {}
+
+func (o *object) Delete() error {
+	if err := o.Release(); err != nil {
+		return err
+	}
+	return o.store.Delete(context.Background(), o.name)
+}
+
+// Open copies the object's content into a temp file in the store's TmpDir.
+func (o *object) Open(accesslevel cloudstorage.AccessLevel) (*os.File, error) {
+	if o.opened {
+		return nil, fmt.Errorf("the store object is already opened. %s", o.name)
+	}
+	f, err := os.CreateTemp(o.store.TmpDir, "mockstore-*"+cloudstorage.StoreCacheFileExt)
+	if err != nil {
+		return nil, fmt.Errorf("mockstore: could not create cachedcopy err=%v", err)
+	}
+	if _, err := f.Write(o.data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	o.cachedcopy = f
+	o.readonly = accesslevel == cloudstorage.ReadOnly
+	o.opened = true
+	return f, nil
+}
+
+func (o *object) File() *os.File {
+	return o.cachedcopy
+}
+func (o *object) Read(p []byte) (n int, err error) {
+	return o.cachedcopy.Read(p)
+}
+
+// Write the given bytes to object.  Won't be writen until Close() or Sync() called.
+func (o *object) Write(p []byte) (n int, err error) {
+	if o.cachedcopy == nil {
+		if _, err := o.Open(cloudstorage.ReadWrite); err != nil {
+			return 0, err
+		}
+	}
+	return o.cachedcopy.Write(p)
+}
+
+func (o *object) Sync() error {
+	if !o.opened {
+		return fmt.Errorf("object isn't opened %s", o.name)
+	}
+	if o.readonly {
+		return fmt.Errorf("trying to Sync a readonly object %s", o.name)
+	}
+	e, err := o.store.sync(o.name, o.cachedcopy, o.metadata)
+	if err != nil {
+		return err
+	}
+	o.updated, o.size, o.etag, o.data = e.updated, int64(len(e.data)), e.etag, e.data
+	return nil
+}
+
+func (o *object) Close() error {
+	if !o.opened {
+		return nil
+	}
+	defer o.Release()
+	if o.readonly {
+		return nil
+	}
+	return o.Sync()
+}
+
+func (o *object) Release() error {
+	if o.cachedcopy == nil {
+		return nil
+	}
+	o.cachedcopy.Close()
+	err := os.Remove(o.cachedcopy.Name())
+	o.cachedcopy = nil
+	o.opened = false
+	return err
+}
@@ -0,0 +1,61 @@
+package mockstore_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/conformance"
+	"github.com/lytics/cloudstorage/mockstore"
+)
+
+func TestAll(t *testing.T) {
+	store := mockstore.New()
+	store.TmpDir = t.TempDir()
+	conformance.Run(t, store, &cloudstorage.Config{Type: mockstore.StoreType, TmpDir: store.TmpDir})
+}
+
+func TestFailAndCalls(t *testing.T) {
+	ctx := context.Background()
+	store := mockstore.New()
+	store.TmpDir = t.TempDir()
+	store.Add("in/a.csv", []byte("a,b\n"), map[string]string{"owner": "etl"})
+
+	errQuota := errors.New("quota exceeded")
+	store.Fail("NewWriter", "out/a.csv", errQuota, 1)
+	err := cloudstorage.WriteAll(ctx, store, "out/a.csv", []byte("a,b\n"), nil)
+	require.NoError(t, err, "the retry succeeds")
+	data, ok := store.Data("out/a.csv")
+	require.True(t, ok)
+	require.Equal(t, "a,b\n", string(data))
+
+	store.Reset()
+	store.Fail("Get", "", cloudstorage.ErrObjectNotFound, 0)
+	for i := 0; i < 2; i++ {
+		_, err = store.Get(ctx, "in/a.csv")
+		require.Equal(t, cloudstorage.ErrObjectNotFound, err)
+	}
+	rc, err := store.NewReaderWithContext(ctx, "in/a.csv")
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	require.Equal(t, []mockstore.Call{
+		{Method: "Get", Name: "in/a.csv"},
+		{Method: "Get", Name: "in/a.csv"},
+		{Method: "NewReader", Name: "in/a.csv"},
+	}, store.Calls())
+
+	// a failed Sync leaves the object as it was
+	store.Reset()
+	store.Fail("Sync", "in/a.csv", errQuota, 1)
+	obj, err := store.NewObject("in/a.csv", cloudstorage.Opts{Overwrite: true})
+	require.NoError(t, err)
+	require.Equal(t, "etl", obj.MetaData()["owner"])
+	_, err = obj.Write([]byte("c,d\n"))
+	require.NoError(t, err)
+	require.Equal(t, errQuota, obj.Close())
+	data, _ = store.Data("in/a.csv")
+	require.Equal(t, "a,b\n", string(data))
+}
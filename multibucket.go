@@ -0,0 +1,271 @@
+package cloudstorage
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// MultiBucketStore is a Store spanning the buckets (containers for azure)
+// of one project or account.  Object names start with their bucket,
+// "bucket/key", the store of each bucket is created with NewStore from the
+// shared Config on first use and kept, so applications using many buckets
+// hold one store.
+//
+// Query prefixes must name a bucket, the buckets can't be listed.  Copy and
+// Move within a bucket use the bucket's store, across buckets they
+// return ErrNotImplemented so Copy and Move stream the object.
+type MultiBucketStore struct {
+	conf *Config
+
+	mu     sync.Mutex
+	stores map[string]Store
+}
+
+var (
+	_ Store          = (*MultiBucketStore)(nil)
+	_ StoreCopy      = (*MultiBucketStore)(nil)
+	_ StoreMove      = (*MultiBucketStore)(nil)
+	_ StoreComposer  = (*MultiBucketStore)(nil)
+	_ StorePut       = (*MultiBucketStore)(nil)
+	_ StoreLeaser    = (*MultiBucketStore)(nil)
+	_ StoreACLSetter = (*MultiBucketStore)(nil)
+	_ StoreSigner    = (*MultiBucketStore)(nil)
+)
+
+// NewMultiBucketStore returns a MultiBucketStore of the stores made from
+// conf with their Bucket set, conf.Bucket is ignored.
+func NewMultiBucketStore(conf *Config) (*MultiBucketStore, error) {
+	if conf.Type == "" {
+		return nil, fmt.Errorf("Type is required on Config")
+	}
+	if _, ok := Provider(conf.Type); !ok {
+		return nil, fmt.Errorf("config.Type=%q was not found", conf.Type)
+	}
+	return &MultiBucketStore{conf: conf, stores: make(map[string]Store)}, nil
+}
+
+// bucketKeys maps the names of one bucket, "bucket/key", to its keys.
+type bucketKeys string
+
+func (b bucketKeys) Encode(name string) string {
+	if name == string(b) {
+		return ""
+	}
+	return strings.TrimPrefix(name, string(b)+"/")
+}
+func (b bucketKeys) Decode(key string) (string, error) {
+	return string(b) + "/" + key, nil
+}
+
+// Bucket returns the store of bucket, its object names start with the
+// bucket like those of m.
+func (m *MultiBucketStore) Bucket(bucket string) (Store, error) {
+	if bucket == "" || strings.Contains(bucket, "/") {
+		return nil, fmt.Errorf("invalid bucket name %q", bucket)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.stores[bucket]; ok {
+		return s, nil
+	}
+	conf := *m.conf
+	conf.Bucket = bucket
+	s, err := NewStore(&conf)
+	if err != nil {
+		return nil, fmt.Errorf("could not create store of bucket %q err=%w", bucket, err)
+	}
+	s = NewKeyEncodedStore(s, bucketKeys(bucket))
+	m.stores[bucket] = s
+	return s, nil
+}
+
+// storeOf returns the store of the bucket name starts with.
+func (m *MultiBucketStore) storeOf(name string) (Store, error) {
+	bucket, _, ok := strings.Cut(name, "/")
+	if !ok || bucket == "" {
+		return nil, fmt.Errorf("object name %q doesn't start with a bucket", name)
+	}
+	return m.Bucket(bucket)
+}
+
+func (m *MultiBucketStore) bucketOf(name string) string {
+	bucket, _, _ := strings.Cut(name, "/")
+	return bucket
+}
+
+func (m *MultiBucketStore) Type() string {
+	return m.conf.Type
+}
+
+// Client is nil, the clients are those of the bucket stores.
+func (m *MultiBucketStore) Client() interface{} {
+	return nil
+}
+func (m *MultiBucketStore) String() string {
+	return fmt.Sprintf("multi-bucket %s store", m.conf.Type)
+}
+
+func (m *MultiBucketStore) Get(ctx context.Context, name string) (Object, error) {
+	return m.GetWithOpts(ctx, name)
+}
+func (m *MultiBucketStore) GetWithOpts(ctx context.Context, name string, opts ...Opts) (Object, error) {
+	s, err := m.storeOf(name)
+	if err != nil {
+		return nil, err
+	}
+	return GetWithOpts(ctx, s, name, opts...)
+}
+
+func (m *MultiBucketStore) List(ctx context.Context, q Query) (*ObjectsResponse, error) {
+	s, err := m.storeOf(q.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	return s.List(ctx, q)
+}
+
+func (m *MultiBucketStore) Objects(ctx context.Context, q Query) (ObjectIterator, error) {
+	s, err := m.storeOf(q.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	return s.Objects(ctx, q)
+}
+
+func (m *MultiBucketStore) Folders(ctx context.Context, q Query) ([]string, error) {
+	s, err := m.storeOf(q.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	return s.Folders(ctx, q)
+}
+
+func (m *MultiBucketStore) FolderIterator(ctx context.Context, q Query) (FolderIterator, error) {
+	s, err := m.storeOf(q.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	return s.FolderIterator(ctx, q)
+}
+
+func (m *MultiBucketStore) NewReader(name string) (io.ReadCloser, error) {
+	return m.NewReaderWithContext(context.Background(), name)
+}
+func (m *MultiBucketStore) NewReaderWithContext(ctx context.Context, name string) (io.ReadCloser, error) {
+	return m.NewReaderWithOpts(ctx, name)
+}
+func (m *MultiBucketStore) NewReaderWithOpts(ctx context.Context, name string, opts ...Opts) (io.ReadCloser, error) {
+	s, err := m.storeOf(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewReaderWithOpts(ctx, s, name, opts...)
+}
+func (m *MultiBucketStore) NewWriter(name string, metadata map[string]string) (io.WriteCloser, error) {
+	return m.NewWriterWithContext(context.Background(), name, metadata)
+}
+func (m *MultiBucketStore) NewWriterWithContext(ctx context.Context, name string, metadata map[string]string, opts ...Opts) (io.WriteCloser, error) {
+	s, err := m.storeOf(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.NewWriterWithContext(ctx, name, metadata, opts...)
+}
+
+func (m *MultiBucketStore) NewObject(name string, opts ...Opts) (Object, error) {
+	s, err := m.storeOf(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.NewObject(name, opts...)
+}
+
+func (m *MultiBucketStore) Delete(ctx context.Context, name string, opts ...Opts) error {
+	s, err := m.storeOf(name)
+	if err != nil {
+		return err
+	}
+	return s.Delete(ctx, name, opts...)
+}
+
+func (m *MultiBucketStore) Copy(ctx context.Context, src, dst Object) error {
+	return m.CopyWithOpts(ctx, src, dst)
+}
+func (m *MultiBucketStore) CopyWithOpts(ctx context.Context, src, dst Object, opts ...Opts) error {
+	if m.bucketOf(src.Name()) != m.bucketOf(dst.Name()) {
+		return ErrNotImplemented
+	}
+	s, err := m.storeOf(src.Name())
+	if err != nil {
+		return err
+	}
+	return fastCopy(ctx, s, src, dst, opts)
+}
+
+func (m *MultiBucketStore) Move(ctx context.Context, src, dst Object) error {
+	return m.MoveWithOpts(ctx, src, dst)
+}
+func (m *MultiBucketStore) MoveWithOpts(ctx context.Context, src, dst Object, opts ...Opts) error {
+	if m.bucketOf(src.Name()) != m.bucketOf(dst.Name()) {
+		return ErrNotImplemented
+	}
+	s, err := m.storeOf(src.Name())
+	if err != nil {
+		return err
+	}
+	return fastMove(ctx, s, src, dst, opts)
+}
+
+// Compose srcs of the bucket of dst into dst.
+func (m *MultiBucketStore) Compose(ctx context.Context, dst string, srcs []string) error {
+	for _, src := range srcs {
+		if m.bucketOf(src) != m.bucketOf(dst) {
+			return fmt.Errorf("can't compose %q of another bucket than %q", src, dst)
+		}
+	}
+	s, err := m.storeOf(dst)
+	if err != nil {
+		return err
+	}
+	if c, ok := s.(StoreComposer); ok {
+		return c.Compose(ctx, dst, srcs)
+	}
+	return ErrNotImplemented
+}
+
+func (m *MultiBucketStore) Put(ctx context.Context, name string, r io.Reader, metadata map[string]string, opts ...Opts) error {
+	s, err := m.storeOf(name)
+	if err != nil {
+		return err
+	}
+	return Put(ctx, s, name, r, metadata, opts...)
+}
+
+func (m *MultiBucketStore) AcquireLease(ctx context.Context, name string, ttl time.Duration) (Lease, error) {
+	s, err := m.storeOf(name)
+	if err != nil {
+		return nil, err
+	}
+	return AcquireLease(ctx, s, name, ttl)
+}
+
+func (m *MultiBucketStore) SetObjectACL(ctx context.Context, name string, acl ACL) error {
+	s, err := m.storeOf(name)
+	if err != nil {
+		return err
+	}
+	return SetObjectACL(ctx, s, name, acl)
+}
+
+func (m *MultiBucketStore) SignedURL(ctx context.Context, name, method string, expires time.Duration) (string, error) {
+	s, err := m.storeOf(name)
+	if err != nil {
+		return "", err
+	}
+	return SignedURL(ctx, s, name, method, expires)
+}
@@ -0,0 +1,82 @@
+package cloudstorage_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/localfs"
+)
+
+func TestMultiBucketStore(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	store, err := cloudstorage.NewMultiBucketStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "store"),
+		TmpDir:     filepath.Join(tmpDir, "tmp"),
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, cloudstorage.WriteAll(ctx, store, "red/in/a.csv", []byte("a"), nil))
+	require.NoError(t, cloudstorage.WriteAll(ctx, store, "red/in/x/b.csv", []byte("b"), nil))
+	require.NoError(t, cloudstorage.WriteAll(ctx, store, "blue/in/c.csv", []byte("c"), nil))
+	// each bucket is a directory of localfs
+	_, err = os.Stat(filepath.Join(tmpDir, "store", "blue", "in", "c.csv"))
+	require.NoError(t, err)
+
+	obj, err := store.Get(ctx, "red/in/a.csv")
+	require.NoError(t, err)
+	require.Equal(t, "red/in/a.csv", obj.Name())
+	b, err := cloudstorage.ReadAll(ctx, store, "blue/in/c.csv")
+	require.NoError(t, err)
+	require.Equal(t, "c", string(b))
+
+	iter, err := store.Objects(ctx, cloudstorage.NewQuery("red/in/"))
+	require.NoError(t, err)
+	objs, err := cloudstorage.ObjectsAll(iter)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(objs))
+	require.Equal(t, "red/in/a.csv", objs[0].Name())
+	require.Equal(t, "red/in/x/b.csv", objs[1].Name())
+	folders, err := store.Folders(ctx, cloudstorage.NewQueryForFolders("red/in/"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"red/in/x/"}, folders)
+
+	// across buckets the object is streamed
+	dst, err := store.NewObject("blue/out/a.csv")
+	require.NoError(t, err)
+	require.NoError(t, cloudstorage.Copy(ctx, store, obj, dst))
+	b, err = cloudstorage.ReadAll(ctx, store, "blue/out/a.csv")
+	require.NoError(t, err)
+	require.Equal(t, "a", string(b))
+
+	dst, err = store.NewObject("red/out/a.csv")
+	require.NoError(t, err)
+	require.NoError(t, cloudstorage.Move(ctx, store, obj, dst))
+	_, err = store.Get(ctx, "red/in/a.csv")
+	require.Equal(t, cloudstorage.ErrObjectNotFound, err)
+
+	require.NoError(t, store.Delete(ctx, "blue/in/c.csv"))
+	_, err = store.Get(ctx, "blue/in/c.csv")
+	require.Equal(t, cloudstorage.ErrObjectNotFound, err)
+
+	red, err := store.Bucket("red")
+	require.NoError(t, err)
+	red2, err := store.Bucket("red")
+	require.NoError(t, err)
+	require.True(t, red == red2)
+
+	_, err = store.Get(ctx, "a.csv")
+	require.Error(t, err)
+	_, err = store.List(ctx, cloudstorage.NewQueryAll())
+	require.Error(t, err)
+
+	_, err = cloudstorage.NewMultiBucketStore(&cloudstorage.Config{Type: "nope"})
+	require.Error(t, err)
+}
@@ -0,0 +1,273 @@
+package cloudstorage
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+	"path"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Layouts of TimePartition.
+const (
+	DailyPartition  = "dt=2006-01-02"
+	HourlyPartition = "dt=2006-01-02/hour=15"
+)
+
+// TimePartition is the partition of t (in UTC) formatted with layout, ie
+// "dt=2024-06-01/hour=03" for HourlyPartition.
+func TimePartition(t time.Time, layout string) string {
+	return t.UTC().Format(layout)
+}
+
+// HashPartition is the partition "shard=NNNN" of key among n shards.
+func HashPartition(key string, n int) string {
+	if n <= 0 {
+		n = 1
+	}
+	return fmt.Sprintf("shard=%04d", crc32.ChecksumIEEE([]byte(key))%uint32(n))
+}
+
+// RolledPart is a part object completed by a PartitionedWriter.
+type RolledPart struct {
+	Partition string
+	Name      string
+	// Bytes and Records written to the part, before compression.
+	Bytes   int64
+	Records int
+	// Err closing the part, the object may be missing or incomplete.
+	Err error
+}
+
+// PartitionedWriter writes records into part objects of partitions,
+// Prefix/<partition>/part-00001-<id><Ext>, rolling to a new part when one
+// reaches MaxSize or MaxAge.  The <id> of the writer keeps parts of other
+// runs from being overwritten.  Write is safe for concurrent use, the
+// writes to one partition are serialized.
+type PartitionedWriter struct {
+	Store  Store
+	Prefix string
+	// Ext of the part names, ie ".csv.gz".
+	Ext string
+	// PartName, if set, names the parts of a partition from their sequence
+	// number (starting at 1) instead.
+	PartName func(partition string, seq int) string
+	// Metadata of the part objects.
+	Metadata map[string]string
+	// Compress the parts with CompressionCodec ("" is gzip) at
+	// CompressionLevel.
+	Compress         bool
+	CompressionCodec string
+	CompressionLevel int
+	// MaxSize is the bytes written (before compression) to a part before
+	// the next write rolls it, 0 for no limit.  Records aren't split.
+	MaxSize int64
+	// MaxAge is the time a part is open before the next write, or
+	// RollExpired, rolls it, 0 for no limit.
+	MaxAge time.Duration
+	// MaxOpen is the number of parts open at once, opening another rolls
+	// the least recently written one.  0 is no limit.
+	MaxOpen int
+	// OnRoll, if set, is called for each part closed.
+	OnRoll func(RolledPart)
+
+	ctx        context.Context
+	id         string
+	mu         sync.Mutex
+	partitions map[string]*partition
+}
+
+// partition of a PartitionedWriter and its open part.
+type partition struct {
+	mu  sync.Mutex
+	key string
+	seq int
+	cur *part
+}
+
+type part struct {
+	name    string
+	sw      io.WriteCloser
+	w       io.WriteCloser
+	opened  time.Time
+	written time.Time
+	bytes   int64
+	records int
+}
+
+// NewPartitionedWriter writes partitions below prefix of store, ctx is
+// the context of the part writers.
+func NewPartitionedWriter(ctx context.Context, store Store, prefix string) *PartitionedWriter {
+	return &PartitionedWriter{
+		Store:      store,
+		Prefix:     prefix,
+		ctx:        ctx,
+		id:         NewLeaseID()[:8],
+		partitions: make(map[string]*partition),
+	}
+}
+
+func (w *PartitionedWriter) partition(key string) *partition {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	p, ok := w.partitions[key]
+	if !ok {
+		p = &partition{key: key}
+		w.partitions[key] = p
+	}
+	return p
+}
+
+// Write record to the open part of partition, opening one if there is
+// none or rolling it first if it is full or expired.
+func (w *PartitionedWriter) Write(partition string, record []byte) error {
+	p := w.partition(partition)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if c := p.cur; c != nil {
+		full := w.MaxSize > 0 && c.bytes > 0 && c.bytes+int64(len(record)) > w.MaxSize
+		if full || w.expired(c, time.Now()) {
+			if err := w.roll(p); err != nil {
+				return err
+			}
+		}
+	}
+	if p.cur == nil {
+		if err := w.open(p); err != nil {
+			return err
+		}
+		w.closeLeastRecent(p)
+	}
+	n, err := p.cur.w.Write(record)
+	p.cur.bytes += int64(n)
+	p.cur.records++
+	p.cur.written = time.Now()
+	return err
+}
+
+func (w *PartitionedWriter) expired(c *part, now time.Time) bool {
+	return w.MaxAge > 0 && now.Sub(c.opened) >= w.MaxAge
+}
+
+func (w *PartitionedWriter) open(p *partition) error {
+	p.seq++
+	name := fmt.Sprintf("part-%05d-%s%s", p.seq, w.id, w.Ext)
+	if w.PartName != nil {
+		name = w.PartName(p.key, p.seq)
+	}
+	name = path.Join(w.Prefix, p.key, name)
+	sw, err := w.Store.NewWriterWithContext(w.ctx, name, w.Metadata)
+	if err != nil {
+		return fmt.Errorf("could not open part %s err=%w", name, err)
+	}
+	c := &part{name: name, sw: sw, w: sw, opened: time.Now()}
+	if w.Compress {
+		if c.w, err = NewCompressWriter(sw, w.CompressionCodec, w.CompressionLevel); err != nil {
+			sw.Close()
+			return err
+		}
+	}
+	p.cur = c
+	return nil
+}
+
+// roll closes the open part of p, the caller holds p.mu.
+func (w *PartitionedWriter) roll(p *partition) error {
+	c := p.cur
+	if c == nil {
+		return nil
+	}
+	p.cur = nil
+	var err error
+	if c.w != c.sw {
+		err = c.w.Close()
+	}
+	if cerr := c.sw.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		err = fmt.Errorf("could not close part %s err=%w", c.name, err)
+	}
+	if w.OnRoll != nil {
+		w.OnRoll(RolledPart{Partition: p.key, Name: c.name, Bytes: c.bytes, Records: c.records, Err: err})
+	}
+	return err
+}
+
+// closeLeastRecent rolls the least recently written part if more than
+// MaxOpen are open, partitions busy writing are passed over.
+func (w *PartitionedWriter) closeLeastRecent(cur *partition) {
+	if w.MaxOpen <= 0 {
+		return
+	}
+	w.mu.Lock()
+	parts := make([]*partition, 0, len(w.partitions))
+	for _, p := range w.partitions {
+		if p != cur {
+			parts = append(parts, p)
+		}
+	}
+	w.mu.Unlock()
+
+	open := 1
+	var lru *partition
+	var lruWritten time.Time
+	for _, p := range parts {
+		if !p.mu.TryLock() {
+			open++
+			continue
+		}
+		if p.cur != nil {
+			open++
+			if lru == nil || p.cur.written.Before(lruWritten) {
+				lru, lruWritten = p, p.cur.written
+			}
+		}
+		p.mu.Unlock()
+	}
+	if open <= w.MaxOpen || lru == nil || !lru.mu.TryLock() {
+		return
+	}
+	defer lru.mu.Unlock()
+	// errors of the roll go to OnRoll, the write at hand is unaffected
+	w.roll(lru)
+}
+
+// RollExpired rolls the parts open for MaxAge, call it periodically so
+// partitions no longer written are completed.
+func (w *PartitionedWriter) RollExpired() error {
+	if w.MaxAge <= 0 {
+		return nil
+	}
+	return w.rollAll(func(c *part) bool { return w.expired(c, time.Now()) })
+}
+
+// Close rolls the open parts, returning the first error.
+func (w *PartitionedWriter) Close() error {
+	return w.rollAll(func(*part) bool { return true })
+}
+
+func (w *PartitionedWriter) rollAll(match func(*part) bool) error {
+	w.mu.Lock()
+	parts := make([]*partition, 0, len(w.partitions))
+	for _, p := range w.partitions {
+		parts = append(parts, p)
+	}
+	w.mu.Unlock()
+
+	var first error
+	for _, p := range parts {
+		p.mu.Lock()
+		if p.cur != nil && match(p.cur) {
+			if err := w.roll(p); err != nil && first == nil {
+				first = err
+			}
+		}
+		p.mu.Unlock()
+	}
+	return first
+}
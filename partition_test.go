@@ -0,0 +1,125 @@
+package cloudstorage_test
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/mockstore"
+)
+
+func TestPartitions(t *testing.T) {
+	ts := time.Date(2024, 6, 1, 3, 4, 5, 0, time.FixedZone("x", 3600))
+	require.Equal(t, "dt=2024-06-01", cloudstorage.TimePartition(ts, cloudstorage.DailyPartition))
+	require.Equal(t, "dt=2024-06-01/hour=02", cloudstorage.TimePartition(ts, cloudstorage.HourlyPartition))
+
+	shard := cloudstorage.HashPartition("user-1", 16)
+	require.True(t, strings.HasPrefix(shard, "shard=00"))
+	require.Equal(t, shard, cloudstorage.HashPartition("user-1", 16))
+	require.Equal(t, "shard=0000", cloudstorage.HashPartition("user-1", 0))
+}
+
+func TestPartitionedWriter(t *testing.T) {
+	ctx := context.Background()
+	store := mockstore.New()
+	w := cloudstorage.NewPartitionedWriter(ctx, store, "events")
+	w.PartName = func(partition string, seq int) string {
+		return fmt.Sprintf("part-%04d.csv", seq)
+	}
+	w.MaxSize = 8
+	var rolled []cloudstorage.RolledPart
+	w.OnRoll = func(p cloudstorage.RolledPart) {
+		rolled = append(rolled, p)
+	}
+
+	day := cloudstorage.TimePartition(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), cloudstorage.DailyPartition)
+	for _, rec := range []string{"a,1\n", "b,2\n", "c,3\n"} {
+		require.NoError(t, w.Write(day, []byte(rec)))
+	}
+	require.NoError(t, w.Write("dt=2024-06-02", []byte("a record longer than MaxSize\n")))
+	require.NoError(t, w.Close())
+
+	b, err := cloudstorage.ReadAll(ctx, store, "events/dt=2024-06-01/part-0001.csv")
+	require.NoError(t, err)
+	require.Equal(t, "a,1\nb,2\n", string(b))
+	b, err = cloudstorage.ReadAll(ctx, store, "events/dt=2024-06-01/part-0002.csv")
+	require.NoError(t, err)
+	require.Equal(t, "c,3\n", string(b))
+	b, err = cloudstorage.ReadAll(ctx, store, "events/dt=2024-06-02/part-0001.csv")
+	require.NoError(t, err)
+	require.Equal(t, "a record longer than MaxSize\n", string(b))
+
+	require.Equal(t, 3, len(rolled))
+	require.Equal(t, cloudstorage.RolledPart{
+		Partition: "dt=2024-06-01", Name: "events/dt=2024-06-01/part-0001.csv", Bytes: 8, Records: 2,
+	}, rolled[0])
+}
+
+func TestPartitionedWriterRolling(t *testing.T) {
+	ctx := context.Background()
+	store := mockstore.New()
+	w := cloudstorage.NewPartitionedWriter(ctx, store, "out")
+	w.Ext = ".csv.gz"
+	w.Compress = true
+	w.MaxOpen = 2
+	w.MaxAge = time.Hour
+	var mu sync.Mutex
+	var rolled []string
+	w.OnRoll = func(p cloudstorage.RolledPart) {
+		require.NoError(t, p.Err)
+		mu.Lock()
+		rolled = append(rolled, p.Partition)
+		mu.Unlock()
+	}
+
+	require.NoError(t, w.Write("a", []byte("1\n")))
+	require.NoError(t, w.Write("b", []byte("1\n")))
+	// a third open part rolls the least recently written one
+	require.NoError(t, w.Write("c", []byte("1\n")))
+	require.Equal(t, []string{"a"}, rolled)
+	// nothing is open for an hour yet
+	require.NoError(t, w.RollExpired())
+	require.Equal(t, []string{"a"}, rolled)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				require.NoError(t, w.Write(cloudstorage.HashPartition(fmt.Sprint(j), 4), []byte(fmt.Sprintf("%d,%d\n", i, j))))
+			}
+		}(i)
+	}
+	wg.Wait()
+	require.NoError(t, w.Close())
+
+	iter, err := store.Objects(ctx, cloudstorage.NewQuery("out/shard="))
+	require.NoError(t, err)
+	objs, err := cloudstorage.ObjectsAll(iter)
+	require.NoError(t, err)
+	var lines []string
+	for _, o := range objs {
+		require.True(t, strings.HasSuffix(o.Name(), ".csv.gz"), o.Name())
+		rc, err := store.NewReaderWithContext(ctx, o.Name())
+		require.NoError(t, err)
+		gz, err := gzip.NewReader(rc)
+		require.NoError(t, err)
+		b, err := io.ReadAll(gz)
+		require.NoError(t, err)
+		rc.Close()
+		lines = append(lines, strings.Split(strings.TrimSpace(string(b)), "\n")...)
+	}
+	require.Equal(t, 400, len(lines))
+	sort.Strings(lines)
+	require.Equal(t, "0,0", lines[0])
+}
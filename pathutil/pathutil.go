@@ -0,0 +1,84 @@
+// Package pathutil joins, cleans and splits the object names (keys) of the
+// stores.  Unlike path.Join and path.Clean, "." and ".." are kept as they
+// are: they are ordinary characters of keys on the cloud stores.
+package pathutil
+
+import (
+	"strings"
+)
+
+// JoinKey joins the non empty elems with a single "/", the slashes at the
+// ends of the elements where they are joined are dropped.  A leading "/"
+// of the first element (an absolute file system root) and a trailing "/"
+// of the last (a folder) are kept, the insides of the elements are left
+// alone.
+//
+//	JoinKey("bucket/", "/logs", "a.csv") == "bucket/logs/a.csv"
+//	JoinKey("/home/ftp", "in/")          == "/home/ftp/in/"
+//	JoinKey("", "a.csv")                 == "a.csv"
+func JoinKey(elems ...string) string {
+	var b strings.Builder
+	lead, trail := false, false
+	for _, e := range elems {
+		if e == "" {
+			continue
+		}
+		if b.Len() == 0 && !lead {
+			lead = strings.HasPrefix(e, "/")
+		}
+		trail = strings.HasSuffix(e, "/")
+		if e = strings.Trim(e, "/"); e == "" {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('/')
+		}
+		b.WriteString(e)
+	}
+	if b.Len() == 0 {
+		if lead || trail {
+			return "/"
+		}
+		return ""
+	}
+	key := b.String()
+	if lead {
+		key = "/" + key
+	}
+	if trail {
+		key += "/"
+	}
+	return key
+}
+
+// CleanKey removes the leading slashes of key and collapses runs of
+// slashes into one, a trailing "/" of a folder is kept.
+//
+//	CleanKey("/logs//2023/a.csv") == "logs/2023/a.csv"
+//	CleanKey("logs/../a.csv")     == "logs/../a.csv"
+func CleanKey(key string) string {
+	key = strings.TrimLeft(key, "/")
+	if !strings.Contains(key, "//") {
+		return key
+	}
+	var b strings.Builder
+	b.Grow(len(key))
+	for i := 0; i < len(key); i++ {
+		if key[i] == '/' && i > 0 && key[i-1] == '/' {
+			continue
+		}
+		b.WriteByte(key[i])
+	}
+	return b.String()
+}
+
+// SplitFolder splits key after its last "/" into the folder, ending in
+// "/" or empty, and the base name, empty for folder keys.
+//
+//	SplitFolder("logs/2023/a.csv") == "logs/2023/", "a.csv"
+//	SplitFolder("logs/2023/")      == "logs/2023/", ""
+//	SplitFolder("a.csv")           == "", "a.csv"
+func SplitFolder(key string) (folder, base string) {
+	i := strings.LastIndexByte(key, '/')
+	return key[:i+1], key[i+1:]
+}
@@ -0,0 +1,83 @@
+package pathutil_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage/pathutil"
+)
+
+func TestJoinKey(t *testing.T) {
+	for _, tc := range []struct {
+		elems []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{""}, ""},
+		{[]string{"", ""}, ""},
+		{[]string{"a.csv"}, "a.csv"},
+		{[]string{"/a.csv"}, "/a.csv"},
+		{[]string{"logs/"}, "logs/"},
+		{[]string{"logs", "a.csv"}, "logs/a.csv"},
+		{[]string{"logs/", "a.csv"}, "logs/a.csv"},
+		{[]string{"logs", "/a.csv"}, "logs/a.csv"},
+		{[]string{"logs//", "//a.csv"}, "logs/a.csv"},
+		{[]string{"", "a.csv"}, "a.csv"},
+		{[]string{"", "/a.csv"}, "/a.csv"},
+		{[]string{"logs", ""}, "logs"},
+		{[]string{"logs/", ""}, "logs/"},
+		{[]string{"logs", "", "a.csv"}, "logs/a.csv"},
+		{[]string{"logs", "/", "a.csv"}, "logs/a.csv"},
+		{[]string{"/", "bucket", "a.csv"}, "/bucket/a.csv"},
+		{[]string{"/", "a.csv"}, "/a.csv"},
+		{[]string{"/"}, "/"},
+		{[]string{"/", "/"}, "/"},
+		{[]string{"/home/ftp", "in/"}, "/home/ftp/in/"},
+		{[]string{"/home/ftp/", "/in//"}, "/home/ftp/in/"},
+		{[]string{"bucket", "logs/2023", "a.csv"}, "bucket/logs/2023/a.csv"},
+		{[]string{"bucket", "logs//2023", "a.csv"}, "bucket/logs//2023/a.csv"},
+		{[]string{"bucket", "..", "a.csv"}, "bucket/../a.csv"},
+		{[]string{"bucket", "./a.csv"}, "bucket/./a.csv"},
+	} {
+		require.Equal(t, tc.want, pathutil.JoinKey(tc.elems...), "%q", tc.elems)
+	}
+}
+
+func TestCleanKey(t *testing.T) {
+	for key, want := range map[string]string{
+		"":                  "",
+		"/":                 "",
+		"//":                "",
+		"a.csv":             "a.csv",
+		"/a.csv":            "a.csv",
+		"//a.csv":           "a.csv",
+		"logs/":             "logs/",
+		"logs//":            "logs/",
+		"/logs//2023/a.csv": "logs/2023/a.csv",
+		"logs///a.csv":      "logs/a.csv",
+		"logs/../a.csv":     "logs/../a.csv",
+		"./a.csv":           "./a.csv",
+		"logs/ a.csv":       "logs/ a.csv",
+	} {
+		require.Equal(t, want, pathutil.CleanKey(key), "%q", key)
+	}
+}
+
+func TestSplitFolder(t *testing.T) {
+	for key, want := range map[string][2]string{
+		"":                {"", ""},
+		"/":               {"/", ""},
+		"a.csv":           {"", "a.csv"},
+		"/a.csv":          {"/", "a.csv"},
+		"logs/":           {"logs/", ""},
+		"logs/a.csv":      {"logs/", "a.csv"},
+		"logs/2023/a.csv": {"logs/2023/", "a.csv"},
+		"logs/2023/":      {"logs/2023/", ""},
+		"logs//a.csv":     {"logs//", "a.csv"},
+	} {
+		folder, base := pathutil.SplitFolder(key)
+		require.Equal(t, want, [2]string{folder, base}, "%q", key)
+		require.Equal(t, key, folder+base)
+	}
+}
@@ -13,12 +13,39 @@ type Filter func(objects Objects) Objects
 type Query struct {
 	Delimiter   string   // Delimiter is most likely "/"
 	Prefix      string   // prefix (directory) to search for or object name if one file
-	StartOffset string   // (gcs/localfs only) "bar/", Only list objects lexicographically >= "bar/"
-	EndOffset   string   // (gcs/localfs only) "foo/", Only list objects lexicographically < "foo/"
+	StartOffset string   // "bar/", Only list objects lexicographically >= "bar/"
+	EndOffset   string   // "foo/", Only list objects lexicographically < "foo/"
 	Marker      string   // Next Page Marker if provided is a start next page fetch bookmark.
-	ShowHidden  bool     // Show hidden files?
-	Filters     []Filter // Applied to the result sets to filter out Objects (i.e. remove objects by extension)
+	ShowHidden  bool     // Show hidden (".") files and folders? (azure, ftp and hdfs hide them)
+	Filters     []Filter // Applied to each page of results to filter out Objects (i.e. remove objects by extension)
 	PageSize    int      // PageSize defaults to global, or you can supply an override
+	// IncludeHashes asks stores that compute content hashes rather than
+	// report them (localfs) to do so while listing, see ObjectHasher.  gcs,
+	// s3 and azure always include the hashes they report.
+	IncludeHashes bool
+	// TagFilter (gcs/azure/localfs only) only lists objects having all of
+	// these TaggedStore tags.  The tags are read from the listed metadata,
+	// s3 can't filter by tags and returns ErrNotImplemented.
+	TagFilter map[string]string
+	// ObjectFilters decide on single objects by name and size, stores check
+	// them while listing, before the Filters run on the page.
+	ObjectFilters []ObjectFilter
+	// Prefetch has the iterators paging through store.List (s3, azure,
+	// swift, sftp etc, see NewObjectPageIterator) fetch the next page in
+	// the background while the current one is consumed.
+	Prefetch bool
+	// Lean listings (gcs, s3, azure) carry only the name, size, updated
+	// time, etag and hashes of the objects, for listing millions of objects
+	// without their metadata maps.  MetaData and Attrs fetch the rest with a
+	// request on first use, the other stores ignore it.
+	Lean bool
+	// Reuse has the iterators (gcs, s3, azure) recycle the objects they
+	// return rather than allocate new ones for each page.  The caller
+	// doesn't own the objects of a Reuse listing: an object returned by
+	// Next is only valid until the following Next or Close, and one opened
+	// must be closed by then.  Callers keeping the objects, as ObjectsAll
+	// does, must not set it, store.List and ObjectsChan ignore it.
+	Reuse bool
 }
 
 // NewQuery create a query for finding files under given prefix.
@@ -54,14 +81,29 @@ func (q *Query) AddFilter(f Filter) *Query {
 // Sorted added a sort Filter to the filter chain, if its not the last call
 // while building your query, Then sorting is only guaranteed for the next
 // filter in the chain.
+//
+// Filters run on each page of a listing, by store.List and store.Objects
+// alike, so a sorted listing is in name order across pages for every store:
+// the object stores (gcs, s3, azure, swift) page through the names in order
+// and the file system stores list everything as one page.
 func (q *Query) Sorted() *Query {
 	q.AddFilter(ObjectSortFilter)
 	return q
 }
 
-// ApplyFilters is called as the last step in store.List() to filter out the
-// results before they are returned.
+// InRange is true if name is within the StartOffset and EndOffset of the
+// query.  gcs and s3 start listing at the StartOffset, s3 and azure stop at
+// the EndOffset, the other stores check every name.
+func (q *Query) InRange(name string) bool {
+	return (q.StartOffset == "" || name >= q.StartOffset) &&
+		(q.EndOffset == "" || name < q.EndOffset)
+}
+
+// ApplyFilters is called as the last step in store.List(), and by the
+// iterators not built on it for each page, to filter out the results before
+// they are returned.
 func (q *Query) ApplyFilters(objects Objects) Objects {
+	objects = q.matchObjects(objects)
 	for _, f := range q.Filters {
 		objects = f(objects)
 	}
@@ -0,0 +1,193 @@
+package cloudstorage
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// ReaderAtOpts optional settings for NewReaderAt.
+type ReaderAtOpts struct {
+	// BlockSize is the size of the ranges read from the store, 0 is
+	// DefaultReaderAtBlockSize.
+	BlockSize int64
+	// CacheBlocks is the number of blocks kept in memory, least recently
+	// used first out, 0 is DefaultReaderAtCacheBlocks.
+	CacheBlocks int
+	// TmpDir is where objects the store can't read ranges of are
+	// downloaded to, "" is os.TempDir.
+	TmpDir string
+}
+
+var (
+	// DefaultReaderAtBlockSize is the size of the ranges a ReaderAt reads.
+	DefaultReaderAtBlockSize int64 = 1 << 20
+	// DefaultReaderAtCacheBlocks is the number of blocks a ReaderAt caches.
+	DefaultReaderAtCacheBlocks = 16
+)
+
+// ReaderAt reads an object at random offsets, ie for columnar formats like
+// parquet which read a footer and then the column chunks they need.  Stores
+// implementing StoreRangeReader serve it with range reads of whole blocks,
+// cached so the small reads of a decoder don't each go to the store.  For
+// other stores, and objects stored compressed, the object is downloaded to a
+// spill file first.
+//
+// It is safe for concurrent use.
+type ReaderAt struct {
+	ctx       context.Context
+	rr        StoreRangeReader
+	name      string
+	size      int64
+	blockSize int64
+	maxBlocks int
+
+	mu     sync.Mutex
+	blocks map[int64]*list.Element
+	lru    *list.List
+
+	spill *StreamReader
+}
+
+type readerAtBlock struct {
+	index int64
+	data  []byte
+}
+
+var _ io.ReaderAt = (*ReaderAt)(nil)
+
+// NewReaderAt opens object name of store s for random access reads, see
+// ReaderAt.  Close it to release the spill file of stores without range
+// reads.
+func NewReaderAt(ctx context.Context, s StoreReader, name string, opts ...ReaderAtOpts) (*ReaderAt, error) {
+	var o ReaderAtOpts
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	r := &ReaderAt{
+		ctx:       ctx,
+		name:      name,
+		blockSize: o.BlockSize,
+		maxBlocks: o.CacheBlocks,
+		blocks:    make(map[int64]*list.Element),
+		lru:       list.New(),
+	}
+	if r.blockSize <= 0 {
+		r.blockSize = DefaultReaderAtBlockSize
+	}
+	if r.maxBlocks <= 0 {
+		r.maxBlocks = DefaultReaderAtCacheBlocks
+	}
+
+	obj, err := s.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	rr, ok := s.(StoreRangeReader)
+	size, sized := SizeOf(obj)
+	if ok && sized && !IsCompressed(AttrsOf(obj).ContentEncoding) {
+		r.rr, r.size = rr, size
+		return r, nil
+	}
+
+	sr, err := OpenStream(ctx, s, name, o.TmpDir)
+	if err != nil {
+		return nil, err
+	}
+	if r.size, err = sr.Seek(0, io.SeekEnd); err != nil {
+		sr.Close()
+		return nil, err
+	}
+	r.spill = sr
+	return r, nil
+}
+
+// Size of the object, as io.SectionReader wants it.
+func (r *ReaderAt) Size() int64 {
+	return r.size
+}
+
+// ReadAt implements io.ReaderAt.
+func (r *ReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if r.spill != nil {
+		return r.spill.spill.ReadAt(p, off)
+	}
+	n := 0
+	for n < len(p) {
+		if off >= r.size {
+			return n, io.EOF
+		}
+		block, err := r.block(off / r.blockSize)
+		if err != nil {
+			return n, err
+		}
+		start := off % r.blockSize
+		if start >= int64(len(block)) {
+			// the object shrank since it was opened
+			return n, io.ErrUnexpectedEOF
+		}
+		c := copy(p[n:], block[start:])
+		n += c
+		off += int64(c)
+	}
+	return n, nil
+}
+
+// block index of the object, from the cache or read from the store.  The
+// lock isn't held while reading so concurrent reads of other blocks go on,
+// concurrent misses of the same block may both read it.
+func (r *ReaderAt) block(index int64) ([]byte, error) {
+	r.mu.Lock()
+	if e, ok := r.blocks[index]; ok {
+		r.lru.MoveToFront(e)
+		r.mu.Unlock()
+		return e.Value.(*readerAtBlock).data, nil
+	}
+	r.mu.Unlock()
+
+	off := index * r.blockSize
+	length := r.blockSize
+	if off+length > r.size {
+		length = r.size - off
+	}
+	rc, err := r.rr.NewRangeReader(r.ctx, r.name, off, length)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, length))
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s at %d: %w", r.name, off, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.blocks[index]; !ok {
+		r.blocks[index] = r.lru.PushFront(&readerAtBlock{index: index, data: data})
+		for r.lru.Len() > r.maxBlocks {
+			oldest := r.lru.Back()
+			r.lru.Remove(oldest)
+			delete(r.blocks, oldest.Value.(*readerAtBlock).index)
+		}
+	}
+	return data, nil
+}
+
+// Close releases the cached blocks and spill file.
+func (r *ReaderAt) Close() error {
+	r.mu.Lock()
+	r.blocks = make(map[int64]*list.Element)
+	r.lru.Init()
+	r.mu.Unlock()
+	if r.spill != nil {
+		return r.spill.Close()
+	}
+	return nil
+}
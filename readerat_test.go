@@ -0,0 +1,112 @@
+package cloudstorage_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/localfs"
+	"github.com/lytics/cloudstorage/mockstore"
+)
+
+func countCalls(store *mockstore.Store, method string) int {
+	n := 0
+	for _, c := range store.Calls() {
+		if c.Method == method {
+			n++
+		}
+	}
+	return n
+}
+
+func TestReaderAt(t *testing.T) {
+	ctx := context.Background()
+	store := mockstore.New()
+	data := strings.Repeat("0123456789", 10)
+	store.Add("data/a.parquet", []byte(data), nil)
+
+	r, err := cloudstorage.NewReaderAt(ctx, store, "data/a.parquet",
+		cloudstorage.ReaderAtOpts{BlockSize: 16, CacheBlocks: 2})
+	require.NoError(t, err)
+	defer r.Close()
+	require.Equal(t, int64(100), r.Size())
+
+	// a read spanning blocks
+	p := make([]byte, 20)
+	n, err := r.ReadAt(p, 10)
+	require.NoError(t, err)
+	require.Equal(t, 20, n)
+	require.Equal(t, data[10:30], string(p))
+	require.Equal(t, 2, countCalls(store, "NewRangeReader"))
+
+	// served from the cache
+	n, err = r.ReadAt(p[:4], 20)
+	require.NoError(t, err)
+	require.Equal(t, data[20:24], string(p[:n]))
+	require.Equal(t, 2, countCalls(store, "NewRangeReader"))
+
+	// the footer, past the end returns io.EOF
+	n, err = r.ReadAt(p, 90)
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, data[90:], string(p[:n]))
+	require.Equal(t, 4, countCalls(store, "NewRangeReader"))
+
+	// the least recently used blocks were evicted
+	_, err = r.ReadAt(p[:1], 10)
+	require.NoError(t, err)
+	require.Equal(t, 5, countCalls(store, "NewRangeReader"))
+
+	// as an io.SectionReader
+	got, err := io.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+	require.NoError(t, err)
+	require.Equal(t, data, string(got))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(off int64) {
+			defer wg.Done()
+			p := make([]byte, 7)
+			_, err := r.ReadAt(p, off)
+			require.NoError(t, err)
+			require.Equal(t, data[off:off+7], string(p))
+		}(int64(i * 9))
+	}
+	wg.Wait()
+
+	_, err = cloudstorage.NewReaderAt(ctx, store, "data/missing.parquet")
+	require.Equal(t, cloudstorage.ErrObjectNotFound, err)
+}
+
+func TestReaderAtCompressed(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:              localfs.StoreType,
+		AuthMethod:        localfs.AuthFileSystem,
+		LocalFS:           tmpDir + "/store",
+		TmpDir:            tmpDir + "/tmp",
+		EnableCompression: true,
+	})
+	require.NoError(t, err)
+
+	data := strings.Repeat("compressed ", 100)
+	require.NoError(t, cloudstorage.WriteAll(ctx, store, "data/a.parquet", []byte(data), nil))
+	_, err = store.(cloudstorage.StoreRangeReader).NewRangeReader(ctx, "data/a.parquet", 0, 10)
+	require.ErrorIs(t, err, cloudstorage.ErrNotImplemented)
+
+	// read from a spill file of the decompressed object
+	r, err := cloudstorage.NewReaderAt(ctx, store, "data/a.parquet", cloudstorage.ReaderAtOpts{TmpDir: tmpDir})
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), r.Size())
+	p := make([]byte, 10)
+	_, err = r.ReadAt(p, 550)
+	require.NoError(t, err)
+	require.Equal(t, data[550:560], string(p))
+	require.NoError(t, r.Close())
+}
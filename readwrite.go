@@ -0,0 +1,65 @@
+package cloudstorage
+
+import (
+	"bytes"
+	"io"
+
+	"golang.org/x/net/context"
+)
+
+// Retries is the number of attempts ReadAll, WriteAll and CopyTo make
+// before giving up on an error that may be transient.
+var Retries = 3
+
+// ReadAll reads the whole content of object name.
+func ReadAll(ctx context.Context, s StoreReader, name string) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := CopyTo(ctx, s, name, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteAll replaces the content of object name with data, see Put.
+func WriteAll(ctx context.Context, s Store, name string, data []byte, metadata map[string]string) error {
+	bo := NewBackoffer(BackoffProfileOf(s))
+	var err error
+	for try := 0; try < Retries; try++ {
+		if try > 0 && !bo.Wait(ctx) {
+			break
+		}
+		err = Put(ctx, s, name, bytes.NewReader(data), metadata)
+		if !retryable(ctx, s, err) {
+			return err
+		}
+	}
+	return err
+}
+
+// CopyTo writes the content of object name to w returning the number of
+// bytes written.  Once part of the content reached w an error is returned
+// rather than retried, as w can't be rewound.
+func CopyTo(ctx context.Context, s StoreReader, name string, w io.Writer) (int64, error) {
+	bo := NewBackoffer(BackoffProfileOf(s))
+	var err error
+	for try := 0; try < Retries; try++ {
+		if try > 0 && !bo.Wait(ctx) {
+			break
+		}
+		var n int64
+		n, err = copyTo(ctx, s, name, w)
+		if n > 0 || !retryable(ctx, s, err) {
+			return n, err
+		}
+	}
+	return 0, err
+}
+
+func copyTo(ctx context.Context, s StoreReader, name string, w io.Writer) (int64, error) {
+	rc, err := s.NewReaderWithContext(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	return io.Copy(w, rc)
+}
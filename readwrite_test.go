@@ -0,0 +1,88 @@
+package cloudstorage_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/localfs"
+	"github.com/lytics/cloudstorage/mockstore"
+)
+
+// flakyStore fails the first NewReaderWithContext call.
+type flakyStore struct {
+	cloudstorage.Store
+	failed bool
+}
+
+func (s *flakyStore) NewReaderWithContext(ctx context.Context, name string) (io.ReadCloser, error) {
+	if !s.failed {
+		s.failed = true
+		return nil, fmt.Errorf("connection reset")
+	}
+	return s.Store.NewReaderWithContext(ctx, name)
+}
+
+func TestReadWriteAll(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "mockcloud"),
+		TmpDir:     filepath.Join(tmpDir, "localcache"),
+		Bucket:     "readwrite",
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = cloudstorage.ReadAll(ctx, store, "missing.json")
+	require.Equal(t, cloudstorage.ErrObjectNotFound, err)
+
+	md := map[string]string{cloudstorage.ContentTypeKey: "application/json"}
+	require.NoError(t, cloudstorage.WriteAll(ctx, store, "small.json", []byte(`{"a":1,"b":2}`), md))
+	require.NoError(t, cloudstorage.WriteAll(ctx, store, "small.json", []byte(`{"a":1}`), md))
+
+	by, err := cloudstorage.ReadAll(ctx, store, "small.json")
+	require.NoError(t, err)
+	require.Equal(t, `{"a":1}`, string(by))
+
+	obj, err := store.Get(ctx, "small.json")
+	require.NoError(t, err)
+	require.Equal(t, "application/json", obj.MetaData()[cloudstorage.ContentTypeKey])
+
+	var buf bytes.Buffer
+	n, err := cloudstorage.CopyTo(ctx, &flakyStore{Store: store}, "small.json", &buf)
+	require.NoError(t, err)
+	require.Equal(t, int64(7), n)
+	require.Equal(t, `{"a":1}`, buf.String())
+}
+
+func TestNewReaderWithOpts(t *testing.T) {
+	ctx := context.Background()
+	store := mockstore.New()
+	require.NoError(t, cloudstorage.WriteAll(ctx, store, "a.csv", []byte("a,b"), nil))
+	obj, err := store.Get(ctx, "a.csv")
+	require.NoError(t, err)
+	opts := cloudstorage.Opts{IfNoneMatch: obj.(cloudstorage.ObjectETagger).ETag()}
+
+	// the opts reach the store through wrappers
+	_, err = cloudstorage.NewReaderWithOpts(ctx, store, "a.csv", opts)
+	require.ErrorIs(t, err, cloudstorage.ErrNotModified)
+	audited := cloudstorage.NewAuditStore(store, cloudstorage.NewJSONAuditSink(io.Discard))
+	_, err = cloudstorage.NewReaderWithOpts(ctx, audited, "a.csv", opts)
+	require.ErrorIs(t, err, cloudstorage.ErrNotModified)
+
+	// stores without StoreReaderWithOpts read without them
+	rc, err := cloudstorage.NewReaderWithOpts(ctx, &flakyStore{Store: store, failed: true}, "a.csv", opts)
+	require.NoError(t, err)
+	b, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	require.Equal(t, "a,b", string(b))
+}
@@ -2,6 +2,7 @@ package cloudstorage
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 )
 
@@ -10,12 +11,19 @@ var (
 	registryMu sync.RWMutex
 	// store provider registry
 	storeProviders = make(map[string]StoreProvider)
+	// auth provider registry, keyed by store type then auth method
+	authProviders = make(map[string]map[AuthMethod]AuthProvider)
+	// store types consulting the auth provider registry
+	authStores = make(map[string]bool)
 )
 
-// StoreProvider a provider function for creating New Stores
+// StoreProvider a provider function for creating New Stores.  The
+// registry functions are safe to call concurrently with each other and with
+// NewStore, which uses the provider registered when it was called.
 type StoreProvider func(*Config) (Store, error)
 
-// Register adds a store type provider.
+// Register adds a store type provider, it panics if the store type is
+// already registered.
 func Register(storeType string, provider StoreProvider) {
 	registryMu.Lock()
 	defer registryMu.Unlock()
@@ -24,3 +32,126 @@ func Register(storeType string, provider StoreProvider) {
 	}
 	storeProviders[storeType] = provider
 }
+
+// RegisterOrReplace sets the provider of a store type, returning the one
+// it replaced (nil if there was none), ie to decorate a registered store
+// with instrumentation:
+//
+//	prev, _ := cloudstorage.Provider(gcsStoreType)
+//	cloudstorage.RegisterOrReplace(gcsStoreType, func(conf *cloudstorage.Config) (cloudstorage.Store, error) {
+//		s, err := prev(conf)
+//		...
+//	})
+func RegisterOrReplace(storeType string, provider StoreProvider) StoreProvider {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	prev := storeProviders[storeType]
+	storeProviders[storeType] = provider
+	return prev
+}
+
+// Unregister removes the provider of a store type, NewStore fails for it
+// afterwards.  Unknown store types are ignored.
+func Unregister(storeType string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	delete(storeProviders, storeType)
+}
+
+// Provider registered for a store type, ok is false if there is none.
+func Provider(storeType string) (provider StoreProvider, ok bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	provider, ok = storeProviders[storeType]
+	return provider, ok
+}
+
+// Providers are the registered store types, sorted.
+func Providers() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	types := make([]string, 0, len(storeProviders))
+	for storeType := range storeProviders {
+		types = append(types, storeType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// AuthProvider a provider function for creating credentials for a store.
+// The type of the returned credentials is specific to the store type, see
+// each store package for the types it accepts.
+type AuthProvider func(*Config) (interface{}, error)
+
+// RegisterAuth adds an auth method provider for a store type, allowing
+// custom credential sources to be used with existing stores.  The store
+// consults it for any AuthMethod it does not natively support.  Only the
+// store types declared with AcceptAuthProviders do, gcs, s3 and the s3
+// compatible stores (spaces, wasabi), NewStore returns a *ConfigError for a
+// registered method of any other store type.
+func RegisterAuth(storeType string, method AuthMethod, provider AuthProvider) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	methods, ok := authProviders[storeType]
+	if !ok {
+		methods = make(map[AuthMethod]AuthProvider)
+		authProviders[storeType] = methods
+	}
+	if _, ok := methods[method]; ok {
+		panic(fmt.Sprintf("Cannot provide duplicate auth method %q for store %q", method, storeType))
+	}
+	methods[method] = provider
+}
+
+// AcceptAuthProviders declares that the provider of a store type consults
+// AuthCredentials for the auth methods it doesn't natively support, store
+// packages call it from init along with Register.
+func AcceptAuthProviders(storeType string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	authStores[storeType] = true
+}
+
+// AcceptsAuthProviders reports whether the store type consults the
+// AuthProviders registered for it, see AcceptAuthProviders.
+func AcceptsAuthProviders(storeType string) bool {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return authStores[storeType]
+}
+
+// checkAuthProvider returns a *ConfigError if the AuthMethod of conf is
+// registered for a store type that doesn't consult the registry, rather
+// than the store failing on an auth method it doesn't know.
+func checkAuthProvider(conf *Config) error {
+	if !HasAuthProvider(conf.Type, conf.AuthMethod) || AcceptsAuthProviders(conf.Type) {
+		return nil
+	}
+	ce := &ConfigError{Type: conf.Type}
+	ce.Invalidf("auth method %q is registered with RegisterAuth but store type %q doesn't use registered auth providers",
+		conf.AuthMethod, conf.Type)
+	return ce
+}
+
+// AuthCredentials looks up the registered AuthProvider for the store type
+// and AuthMethod of the config and returns the credentials it creates.
+// ok is false if no provider is registered.
+func AuthCredentials(conf *Config) (creds interface{}, ok bool, err error) {
+	registryMu.RLock()
+	provider, ok := authProviders[conf.Type][conf.AuthMethod]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, false, nil
+	}
+	creds, err = provider(conf)
+	return creds, true, err
+}
+
+// HasAuthProvider reports whether an AuthProvider is registered for the
+// store type and auth method.
+func HasAuthProvider(storeType string, method AuthMethod) bool {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	_, ok := authProviders[storeType][method]
+	return ok
+}
@@ -2,6 +2,7 @@ package cloudstorage_test
 
 import (
 	"fmt"
+	"sort"
 	"testing"
 
 	"github.com/lytics/cloudstorage"
@@ -14,7 +15,84 @@ func TestRegistry(t *testing.T) {
 		cloudstorage.Register("teststore", fakeProvider)
 	})
 	require.True(t, paniced)
+	require.Contains(t, cloudstorage.Providers(), "teststore")
 }
+
+func TestRegistryReplace(t *testing.T) {
+	_, ok := cloudstorage.Provider("replacestore")
+	require.False(t, ok)
+	require.Nil(t, cloudstorage.RegisterOrReplace("replacestore", fakeProvider))
+	_, err := cloudstorage.NewStore(&cloudstorage.Config{Type: "replacestore"})
+	require.EqualError(t, err, "Not Implemented")
+
+	// decorate the registered provider
+	prev, ok := cloudstorage.Provider("replacestore")
+	require.True(t, ok)
+	replaced := cloudstorage.RegisterOrReplace("replacestore", func(conf *cloudstorage.Config) (cloudstorage.Store, error) {
+		_, err := prev(conf)
+		return nil, fmt.Errorf("wrapped: %w", err)
+	})
+	require.NotNil(t, replaced)
+	_, err = cloudstorage.NewStore(&cloudstorage.Config{Type: "replacestore"})
+	require.EqualError(t, err, "wrapped: Not Implemented")
+
+	providers := cloudstorage.Providers()
+	require.Contains(t, providers, "replacestore")
+	require.True(t, sort.StringsAreSorted(providers))
+
+	cloudstorage.Unregister("replacestore")
+	require.NotContains(t, cloudstorage.Providers(), "replacestore")
+	_, err = cloudstorage.NewStore(&cloudstorage.Config{Type: "replacestore"})
+	require.Error(t, err)
+	cloudstorage.Unregister("replacestore")
+
+	// Register works again once unregistered
+	require.False(t, didPanic(func() { cloudstorage.Register("replacestore", fakeProvider) }))
+	cloudstorage.Unregister("replacestore")
+}
+
+func TestAuthRegistry(t *testing.T) {
+	cloudstorage.RegisterAuth("teststore", "custom", func(conf *cloudstorage.Config) (interface{}, error) {
+		return "token-" + conf.Bucket, nil
+	})
+	paniced := didPanic(func() {
+		cloudstorage.RegisterAuth("teststore", "custom", nil)
+	})
+	require.True(t, paniced)
+
+	creds, ok, err := cloudstorage.AuthCredentials(&cloudstorage.Config{Type: "teststore", AuthMethod: "custom", Bucket: "b"})
+	require.True(t, ok)
+	require.NoError(t, err)
+	require.Equal(t, "token-b", creds)
+
+	_, ok, _ = cloudstorage.AuthCredentials(&cloudstorage.Config{Type: "teststore", AuthMethod: "other"})
+	require.False(t, ok)
+}
+
+func TestAuthRegistryUnsupportedStore(t *testing.T) {
+	cloudstorage.Register("authstore", fakeProvider)
+	defer cloudstorage.Unregister("authstore")
+	cloudstorage.RegisterAuth("authstore", "vault", func(conf *cloudstorage.Config) (interface{}, error) {
+		return "token", nil
+	})
+
+	// authstore doesn't consult the registry, the method can't be used
+	_, err := cloudstorage.NewStore(&cloudstorage.Config{Type: "authstore", AuthMethod: "vault"})
+	var ce *cloudstorage.ConfigError
+	require.ErrorAs(t, err, &ce)
+	require.Equal(t, "authstore", ce.Type)
+	require.Equal(t, 1, len(ce.Invalid))
+
+	// other methods reach the store
+	_, err = cloudstorage.NewStore(&cloudstorage.Config{Type: "authstore", AuthMethod: "other"})
+	require.EqualError(t, err, "Not Implemented")
+
+	cloudstorage.AcceptAuthProviders("authstore")
+	require.True(t, cloudstorage.AcceptsAuthProviders("authstore"))
+	_, err = cloudstorage.NewStore(&cloudstorage.Config{Type: "authstore", AuthMethod: "vault"})
+	require.EqualError(t, err, "Not Implemented")
+}
+
 func didPanic(f func()) (dp bool) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -0,0 +1,51 @@
+package cloudstorage
+
+import (
+	"io"
+)
+
+// UploadResult describes the object a store writer created, see
+// ResultWriter.
+type UploadResult struct {
+	// Size is the number of bytes written to the writer, before any
+	// compression by the store.
+	Size int64
+	// ETag of the created object without quotes, when the store has them.
+	ETag string
+	// VersionID is the generation (gcs) or version id (s3, on versioned
+	// buckets) of the created object, as taken by Opts.VersionID.
+	VersionID string
+}
+
+// NewResultWriter returns a ResultWriter of wc counting the bytes written.
+// Once wc is closed result, if not nil, fills in what the store knows of the
+// created object.
+func NewResultWriter(wc io.WriteCloser, result func(*UploadResult) error) ResultWriter {
+	return &resultWriter{wc: wc, result: result}
+}
+
+type resultWriter struct {
+	wc     io.WriteCloser
+	result func(*UploadResult) error
+	res    UploadResult
+}
+
+func (w *resultWriter) Write(p []byte) (int, error) {
+	n, err := w.wc.Write(p)
+	w.res.Size += int64(n)
+	return n, err
+}
+
+func (w *resultWriter) Close() error {
+	if err := w.wc.Close(); err != nil {
+		return err
+	}
+	if w.result == nil {
+		return nil
+	}
+	return w.result(&w.res)
+}
+
+func (w *resultWriter) Result() UploadResult {
+	return w.res
+}
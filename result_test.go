@@ -0,0 +1,38 @@
+package cloudstorage_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+)
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestResultWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := cloudstorage.NewResultWriter(nopWriteCloser{&buf}, func(r *cloudstorage.UploadResult) error {
+		r.ETag = "abc"
+		r.VersionID = "1"
+		return nil
+	})
+	_, err := io.WriteString(w, "Year,Make,Model\n")
+	require.NoError(t, err)
+	_, err = io.WriteString(w, "1997,Ford,E350\n")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.Equal(t, cloudstorage.UploadResult{Size: 31, ETag: "abc", VersionID: "1"}, w.Result())
+
+	// the upload error of result is returned by Close
+	failed := errors.New("upload failed")
+	w = cloudstorage.NewResultWriter(nopWriteCloser{&buf}, func(r *cloudstorage.UploadResult) error {
+		return failed
+	})
+	require.Equal(t, failed, w.Close())
+}
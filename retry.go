@@ -0,0 +1,49 @@
+package cloudstorage
+
+import (
+	"errors"
+
+	"golang.org/x/net/context"
+)
+
+// IsTransient is true if err of store s may go away on a retry, the
+// store's StoreErrorClassifier decides if it has one, otherwise
+// DefaultIsTransient.
+func IsTransient(s StoreReader, err error) bool {
+	if err == nil {
+		return false
+	}
+	if c, ok := s.(StoreErrorClassifier); ok {
+		return c.IsTransient(err)
+	}
+	return DefaultIsTransient(err)
+}
+
+// DefaultIsTransient is false for the errors of this package and context
+// errors no retry can fix, true otherwise as an unknown error may be a
+// throttled request or a dropped connection.  Store classifiers call it
+// before looking at the provider errors.
+func DefaultIsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, permanent := range []error{ErrObjectNotFound, ErrObjectExists, ErrNotImplemented,
+		ErrNotModified, ErrPreconditionFailed, ErrLeaseHeld, ErrLeaseLost, ErrInvalidMetadata,
+		ErrWriteOnly, context.Canceled, context.DeadlineExceeded} {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsTransientStatus is true for the HTTP status codes of errors worth
+// retrying: request timeout, too many requests and server errors.
+func IsTransientStatus(code int) bool {
+	return code == 408 || code == 429 || code >= 500
+}
+
+// retryable is true for errors of s other than the ones a retry can't fix.
+func retryable(ctx context.Context, s StoreReader, err error) bool {
+	return err != nil && ctx.Err() == nil && IsTransient(s, err)
+}
@@ -0,0 +1,56 @@
+package cloudstorage_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/mockstore"
+)
+
+var errDenied = errors.New("access denied")
+
+// classifyingStore is a mockstore with a StoreErrorClassifier.
+type classifyingStore struct {
+	*mockstore.Store
+}
+
+func (classifyingStore) IsTransient(err error) bool {
+	return !errors.Is(err, errDenied) && cloudstorage.DefaultIsTransient(err)
+}
+
+func TestIsTransient(t *testing.T) {
+	require.False(t, cloudstorage.DefaultIsTransient(nil))
+	require.False(t, cloudstorage.DefaultIsTransient(cloudstorage.ErrObjectNotFound))
+	require.False(t, cloudstorage.DefaultIsTransient(fmt.Errorf("get: %w", cloudstorage.ErrPreconditionFailed)))
+	require.False(t, cloudstorage.DefaultIsTransient(context.Canceled))
+	require.True(t, cloudstorage.DefaultIsTransient(errDenied), "unknown errors may be transient")
+
+	require.True(t, cloudstorage.IsTransientStatus(429))
+	require.True(t, cloudstorage.IsTransientStatus(503))
+	require.False(t, cloudstorage.IsTransientStatus(403))
+	require.False(t, cloudstorage.IsTransientStatus(404))
+
+	store := classifyingStore{mockstore.New()}
+	require.False(t, cloudstorage.IsTransient(store, errDenied))
+	require.True(t, cloudstorage.IsTransient(store.Store, errDenied))
+}
+
+func TestWriteAllPermanentError(t *testing.T) {
+	ctx := context.Background()
+	store := classifyingStore{mockstore.New()}
+
+	store.Fail("NewWriter", "out/a.csv", errDenied, 0)
+	err := cloudstorage.WriteAll(ctx, store, "out/a.csv", []byte("a,b\n"), nil)
+	require.Equal(t, errDenied, err)
+	require.Equal(t, 1, countCalls(store.Store, "NewWriter"))
+
+	store.Reset()
+	store.Fail("NewWriter", "out/a.csv", errors.New("503 slow down"), 1)
+	require.NoError(t, cloudstorage.WriteAll(ctx, store, "out/a.csv", []byte("a,b\n"), nil))
+	require.Equal(t, 2, countCalls(store.Store, "NewWriter"))
+}
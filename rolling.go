@@ -0,0 +1,241 @@
+package cloudstorage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/araddon/gou"
+	"golang.org/x/net/context"
+)
+
+// RollOpts are the rotation settings of a RollingWriter.
+type RollOpts struct {
+	// MaxSize is the bytes written to an object before the next write
+	// rotates to a new one, 0 for no limit.  Writes aren't split.
+	MaxSize int64
+	// MaxAge is the time an object is written to before it is rotated, even
+	// if no write follows, 0 for no limit.
+	MaxAge time.Duration
+	// Ext of the object names, ie ".log.gz".
+	Ext string
+	// Metadata of the objects.
+	Metadata map[string]string
+	// Compress the objects with CompressionCodec ("" is gzip) at
+	// CompressionLevel, MaxSize counts the bytes before compression.
+	Compress         bool
+	CompressionCodec string
+	CompressionLevel int
+	// TmpDir is where the object being written is spooled, os.TempDir()
+	// if empty.
+	TmpDir string
+	// OnRoll, if set, is called for each object finalized, or failing to,
+	// from the goroutine uploading it.
+	OnRoll func(RolledPart)
+}
+
+// RollingWriter is an io.WriteCloser rotating to a new object every
+// RollOpts.MaxSize bytes or MaxAge.  The object being written is spooled
+// to a local file, rotated ones are uploaded in the background, with
+// retries of transient errors, and the local file removed.  A file failing
+// to upload is left in TmpDir.  Write is safe for concurrent use.
+type RollingWriter struct {
+	store   Store
+	pattern string
+	opts    RollOpts
+	id      string
+
+	mu     sync.Mutex
+	seq    int
+	cur    *rollingPart
+	closed bool
+
+	uploads sync.WaitGroup
+	errMu   sync.Mutex
+	err     error
+}
+
+type rollingPart struct {
+	name    string
+	f       *os.File
+	bytes   int64
+	records int
+	timer   *time.Timer
+}
+
+// ErrWriterClosed is returned by writes to a closed RollingWriter.
+var ErrWriterClosed = errors.New("writer is closed")
+
+// NewRollingWriter writes objects of store named by formatting
+// prefixPattern, a time.Format layout, with the time (UTC) an object is
+// opened, followed by -<seq>-<writer id> and opts.Ext:
+//
+//	w := NewRollingWriter(store, "logs/2006/01/02/app-150405", RollOpts{MaxAge: 5 * time.Minute, Ext: ".log"})
+//	// logs/2024/06/01/app-030000-00001-1f3a9c2e.log
+//
+// The literal parts of the pattern must not contain layout elements.
+func NewRollingWriter(store Store, prefixPattern string, opts RollOpts) *RollingWriter {
+	return &RollingWriter{
+		store:   store,
+		pattern: prefixPattern,
+		opts:    opts,
+		id:      NewLeaseID()[:8],
+	}
+}
+
+// Write p to the current object, rotating it first if it is full.
+func (w *RollingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, ErrWriterClosed
+	}
+	if c := w.cur; c != nil && w.opts.MaxSize > 0 && c.bytes > 0 && c.bytes+int64(len(p)) > w.opts.MaxSize {
+		w.roll()
+	}
+	if w.cur == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.cur.f.Write(p)
+	w.cur.bytes += int64(n)
+	w.cur.records++
+	return n, err
+}
+
+// Roll finalizes the current object, the next write opens a new one.
+func (w *RollingWriter) Roll() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.roll()
+}
+
+// Close finalizes the current object and waits for the uploads, returning
+// the first upload error of the writer.
+func (w *RollingWriter) Close() error {
+	w.mu.Lock()
+	w.closed = true
+	w.roll()
+	w.mu.Unlock()
+
+	w.uploads.Wait()
+	w.errMu.Lock()
+	defer w.errMu.Unlock()
+	return w.err
+}
+
+// open the next object, the caller holds w.mu.
+func (w *RollingWriter) open() error {
+	f, err := os.CreateTemp(w.opts.TmpDir, "rolling-*")
+	if err != nil {
+		return fmt.Errorf("could not create spool file err=%w", err)
+	}
+	w.seq++
+	c := &rollingPart{
+		name: fmt.Sprintf("%s-%05d-%s%s", time.Now().UTC().Format(w.pattern), w.seq, w.id, w.opts.Ext),
+		f:    f,
+	}
+	if w.opts.MaxAge > 0 {
+		c.timer = time.AfterFunc(w.opts.MaxAge, func() {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			if w.cur == c {
+				w.roll()
+			}
+		})
+	}
+	w.cur = c
+	return nil
+}
+
+// roll hands the current object to a background upload, the caller holds
+// w.mu.
+func (w *RollingWriter) roll() {
+	c := w.cur
+	if c == nil {
+		return
+	}
+	w.cur = nil
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	w.uploads.Add(1)
+	go func() {
+		defer w.uploads.Done()
+		err := w.finalize(c)
+		if err != nil {
+			gou.Warnf("could not finalize %s, spooled in %s err=%v", c.name, c.f.Name(), err)
+			w.errMu.Lock()
+			if w.err == nil {
+				w.err = err
+			}
+			w.errMu.Unlock()
+		}
+		if w.opts.OnRoll != nil {
+			w.opts.OnRoll(RolledPart{Name: c.name, Bytes: c.bytes, Records: c.records, Err: err})
+		}
+	}()
+}
+
+// finalize uploads the spool file of c, retrying transient errors, then
+// removes it.
+func (w *RollingWriter) finalize(c *rollingPart) error {
+	ctx := context.Background()
+	bo := NewBackoffer(BackoffProfileOf(w.store))
+	var err error
+	for try := 0; try < Retries; try++ {
+		if try > 0 && !bo.Wait(ctx) {
+			break
+		}
+		err = w.upload(ctx, c)
+		if !retryable(ctx, w.store, err) {
+			break
+		}
+		gou.Warnf("upload of %s failed, try=%d err=%v", c.name, try, err)
+	}
+	if cerr := c.f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("could not upload %s err=%w", c.name, err)
+	}
+	return os.Remove(c.f.Name())
+}
+
+func (w *RollingWriter) upload(ctx context.Context, c *rollingPart) error {
+	if _, err := c.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sw, err := w.store.NewWriterWithContext(wctx, c.name, w.opts.Metadata)
+	if err != nil {
+		return err
+	}
+	var dst io.WriteCloser = sw
+	if w.opts.Compress {
+		if dst, err = NewCompressWriter(sw, w.opts.CompressionCodec, w.opts.CompressionLevel); err != nil {
+			cancel()
+			sw.Close()
+			return err
+		}
+	}
+	if _, err := io.Copy(dst, c.f); err != nil {
+		// abandon the partial upload
+		cancel()
+		sw.Close()
+		return err
+	}
+	if dst != sw {
+		if err := dst.Close(); err != nil {
+			cancel()
+			sw.Close()
+			return err
+		}
+	}
+	return sw.Close()
+}
@@ -0,0 +1,131 @@
+package cloudstorage_test
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/mockstore"
+)
+
+func rolledObjects(t *testing.T, store cloudstorage.Store, prefix string) []string {
+	iter, err := store.Objects(context.Background(), cloudstorage.NewQuery(prefix))
+	require.NoError(t, err)
+	objs, err := cloudstorage.ObjectsAll(iter)
+	require.NoError(t, err)
+	var names []string
+	for _, o := range objs {
+		names = append(names, o.Name())
+	}
+	return names
+}
+
+func TestRollingWriter(t *testing.T) {
+	ctx := context.Background()
+	store := mockstore.New()
+	tmpDir := t.TempDir()
+	var mu sync.Mutex
+	var rolled []cloudstorage.RolledPart
+	w := cloudstorage.NewRollingWriter(store, "logs/2006/01/02/app", cloudstorage.RollOpts{
+		MaxSize: 8,
+		Ext:     ".log",
+		TmpDir:  tmpDir,
+		OnRoll: func(p cloudstorage.RolledPart) {
+			mu.Lock()
+			rolled = append(rolled, p)
+			mu.Unlock()
+		},
+	})
+	// the first upload fails and is retried
+	store.Fail("NewWriter", "", errors.New("connection reset"), 1)
+
+	for _, line := range []string{"a,1\n", "b,2\n", "c,3\n"} {
+		n, err := w.Write([]byte(line))
+		require.NoError(t, err)
+		require.Equal(t, 4, n)
+	}
+	require.NoError(t, w.Close())
+	_, err := w.Write([]byte("d,4\n"))
+	require.ErrorIs(t, err, cloudstorage.ErrWriterClosed)
+
+	names := rolledObjects(t, store, "logs/")
+	require.Equal(t, 2, len(names))
+	day := time.Now().UTC().Format("2006/01/02")
+	require.True(t, strings.HasPrefix(names[0], "logs/"+day+"/app-00001-"), names[0])
+	require.True(t, strings.HasSuffix(names[1], ".log"), names[1])
+	b, err := cloudstorage.ReadAll(ctx, store, names[0])
+	require.NoError(t, err)
+	require.Equal(t, "a,1\nb,2\n", string(b))
+	b, err = cloudstorage.ReadAll(ctx, store, names[1])
+	require.NoError(t, err)
+	require.Equal(t, "c,3\n", string(b))
+
+	require.Equal(t, 2, len(rolled))
+	for _, p := range rolled {
+		require.NoError(t, p.Err)
+	}
+	// the spool files are removed once uploaded
+	files, err := os.ReadDir(tmpDir)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(files))
+}
+
+func TestRollingWriterMaxAge(t *testing.T) {
+	ctx := context.Background()
+	store := mockstore.New()
+	rolled := make(chan cloudstorage.RolledPart, 1)
+	w := cloudstorage.NewRollingWriter(store, "events/150405", cloudstorage.RollOpts{
+		MaxAge:   50 * time.Millisecond,
+		Ext:      ".json.gz",
+		Compress: true,
+		TmpDir:   t.TempDir(),
+		OnRoll: func(p cloudstorage.RolledPart) {
+			rolled <- p
+		},
+	})
+	_, err := io.WriteString(w, `{"a":1}`+"\n")
+	require.NoError(t, err)
+
+	// the object is finalized without another write
+	select {
+	case p := <-rolled:
+		require.NoError(t, p.Err)
+		require.Equal(t, 1, p.Records)
+		rc, err := store.NewReaderWithContext(ctx, p.Name)
+		require.NoError(t, err)
+		gz, err := gzip.NewReader(rc)
+		require.NoError(t, err)
+		b, err := io.ReadAll(gz)
+		require.NoError(t, err)
+		rc.Close()
+		require.Equal(t, `{"a":1}`+"\n", string(b))
+	case <-time.After(5 * time.Second):
+		t.Fatal("object wasn't rolled after MaxAge")
+	}
+	require.NoError(t, w.Close())
+	require.Equal(t, 1, len(rolledObjects(t, store, "events/")))
+}
+
+func TestRollingWriterUploadFails(t *testing.T) {
+	store := mockstore.New()
+	tmpDir := t.TempDir()
+	store.Fail("NewWriter", "", cloudstorage.ErrNotImplemented, 0)
+	w := cloudstorage.NewRollingWriter(store, "logs/app", cloudstorage.RollOpts{TmpDir: tmpDir})
+	_, err := w.Write([]byte("a\n"))
+	require.NoError(t, err)
+	require.ErrorIs(t, w.Close(), cloudstorage.ErrNotImplemented)
+
+	// the spool file is kept for recovery
+	files, err := os.ReadDir(tmpDir)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(files))
+}
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/server/storepb"
+)
+
+// downloadChunkSize is the most data of a Download message.
+const downloadChunkSize = 64 << 10
+
+// RegisterGRPC registers the stores of s as the storepb.Store service of gs.
+func (s *Server) RegisterGRPC(gs grpc.ServiceRegistrar) {
+	storepb.RegisterStoreServer(gs, &grpcServer{s: s})
+}
+
+type grpcServer struct {
+	storepb.UnimplementedStoreServer
+	s *Server
+}
+
+func (g *grpcServer) store(name string) (cloudstorage.Store, error) {
+	store, ok := g.s.stores[name]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "unknown store "+strconv.Quote(name))
+	}
+	return store, nil
+}
+
+// object is the store of an object request, once its name is checked.
+func (g *grpcServer) object(storeName, name string) (cloudstorage.Store, error) {
+	if err := checkName(name); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return g.store(storeName)
+}
+
+func (g *grpcServer) ListStores(ctx context.Context, req *storepb.ListStoresRequest) (*storepb.ListStoresResponse, error) {
+	names := make([]string, 0, len(g.s.stores))
+	for name := range g.s.stores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return &storepb.ListStoresResponse{Stores: names}, nil
+}
+
+func (g *grpcServer) List(ctx context.Context, req *storepb.ListRequest) (*storepb.ListResponse, error) {
+	store, err := g.store(req.Store)
+	if err != nil {
+		return nil, err
+	}
+	if req.Limit < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid limit %d", req.Limit)
+	}
+	if req.Prefix != "" {
+		if err := checkName(req.Prefix); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	q := cloudstorage.NewQuery(req.Prefix)
+	q.Delimiter = req.Delimiter
+	q.Marker = req.Cursor
+	q.PageSize = int(req.Limit)
+
+	resp, err := store.List(ctx, q)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	lr := &storepb.ListResponse{
+		Objects:    make([]*storepb.Object, 0, len(resp.Objects)),
+		Prefixes:   resp.Prefixes,
+		NextCursor: resp.NextMarker,
+	}
+	for _, o := range resp.Objects {
+		lr.Objects = append(lr.Objects, protoObject(o))
+	}
+	return lr, nil
+}
+
+func (g *grpcServer) Stat(ctx context.Context, req *storepb.ObjectRequest) (*storepb.Object, error) {
+	store, err := g.object(req.Store, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := store.Get(ctx, req.Name)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return protoObject(obj), nil
+}
+
+func (g *grpcServer) Download(req *storepb.ObjectRequest, stream storepb.Store_DownloadServer) error {
+	store, err := g.object(req.Store, req.Name)
+	if err != nil {
+		return err
+	}
+	ctx := stream.Context()
+	obj, err := store.Get(ctx, req.Name)
+	if err != nil {
+		return statusError(err)
+	}
+	rc, err := store.NewReaderWithContext(ctx, req.Name)
+	if err != nil {
+		return statusError(err)
+	}
+	defer rc.Close()
+
+	resp := &storepb.DownloadResponse{Object: protoObject(obj)}
+	buf := make([]byte, downloadChunkSize)
+	for {
+		n, err := io.ReadFull(rc, buf)
+		if n > 0 || resp.Object != nil {
+			resp.Data = buf[:n]
+			if serr := stream.Send(resp); serr != nil {
+				return serr
+			}
+			resp.Object = nil
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return statusError(err)
+		}
+	}
+}
+
+func (g *grpcServer) Upload(stream storepb.Store_UploadServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	h := req.Header
+	if h == nil {
+		return status.Error(codes.InvalidArgument, "the first upload message has no header")
+	}
+	store, err := g.object(h.Store, h.Name)
+	if err != nil {
+		return err
+	}
+	md := make(map[string]string, len(h.Metadata)+1)
+	for k, v := range h.Metadata {
+		md[k] = v
+	}
+	if h.ContentType != "" {
+		md[cloudstorage.ContentTypeKey] = h.ContentType
+	}
+	md, err = cloudstorage.NormalizeMetadata(md)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	opts := cloudstorage.Opts{IfNotExists: h.IfNotExists, IfMatch: h.IfMatch}
+
+	// the upload is abandoned, not committed, if the stream fails
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	wc, err := store.NewWriterWithContext(ctx, h.Name, md, opts)
+	if err != nil {
+		return statusError(err)
+	}
+	for {
+		if len(req.Data) > 0 {
+			if _, err := wc.Write(req.Data); err != nil {
+				cancel()
+				wc.Close()
+				return statusError(err)
+			}
+		}
+		req, err = stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			cancel()
+			wc.Close()
+			return err
+		}
+	}
+	if err := wc.Close(); err != nil {
+		return statusError(err)
+	}
+	obj, err := store.Get(stream.Context(), h.Name)
+	if err != nil {
+		return statusError(err)
+	}
+	return stream.SendAndClose(protoObject(obj))
+}
+
+func (g *grpcServer) Delete(ctx context.Context, req *storepb.ObjectRequest) (*storepb.DeleteResponse, error) {
+	store, err := g.object(req.Store, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.Delete(ctx, req.Name); err != nil {
+		return nil, statusError(err)
+	}
+	return &storepb.DeleteResponse{}, nil
+}
+
+func protoObject(o cloudstorage.Object) *storepb.Object {
+	obj := objectOf(o)
+	po := &storepb.Object{
+		Name:        obj.Name,
+		Size:        obj.Size,
+		ContentType: obj.ContentType,
+		Etag:        obj.ETag,
+		Metadata:    obj.Metadata,
+	}
+	if !obj.Updated.IsZero() {
+		po.Updated = timestamppb.New(obj.Updated)
+	}
+	return po
+}
+
+// statusError is the gRPC status of a store error, the codes match the
+// http statuses of statusOf.
+func statusError(err error) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, cloudstorage.ErrObjectNotFound):
+		code = codes.NotFound
+	case errors.Is(err, cloudstorage.ErrObjectExists), errors.Is(err, cloudstorage.ErrPreconditionFailed):
+		code = codes.FailedPrecondition
+	case errors.Is(err, cloudstorage.ErrInvalidMetadata):
+		code = codes.InvalidArgument
+	case errors.Is(err, cloudstorage.ErrNotImplemented):
+		code = codes.Unimplemented
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	}
+	return status.Error(code, err.Error())
+}
@@ -0,0 +1,155 @@
+package server_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/localfs"
+	"github.com/lytics/cloudstorage/server"
+	"github.com/lytics/cloudstorage/server/storepb"
+)
+
+func upload(t *testing.T, client storepb.StoreClient, header *storepb.UploadHeader, chunks ...string) (*storepb.Object, error) {
+	stream, err := client.Upload(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&storepb.UploadRequest{Header: header}))
+	for _, c := range chunks {
+		require.NoError(t, stream.Send(&storepb.UploadRequest{Data: []byte(c)}))
+	}
+	return stream.CloseAndRecv()
+}
+
+func TestGRPC(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    tmpDir + "/store",
+		TmpDir:     tmpDir + "/tmp",
+	})
+	require.NoError(t, err)
+
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	server.New(map[string]cloudstorage.Store{"local": store}).RegisterGRPC(gs)
+	go gs.Serve(lis)
+	defer gs.Stop()
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := storepb.NewStoreClient(conn)
+	ctx := context.Background()
+
+	stores, err := client.ListStores(ctx, &storepb.ListStoresRequest{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"local"}, stores.Stores)
+
+	header := &storepb.UploadHeader{
+		Store:       "local",
+		Name:        "in/a.csv",
+		ContentType: "text/csv",
+		Metadata:    map[string]string{"owner-team": "etl"},
+		IfNotExists: true,
+	}
+	obj, err := upload(t, client, header, "a,b\n", "c,d\n")
+	require.NoError(t, err)
+	require.Equal(t, "in/a.csv", obj.Name)
+	require.Equal(t, int64(8), obj.Size)
+	require.Equal(t, "etl", obj.Metadata["owner-team"])
+	_, err = upload(t, client, header, "e,f\n")
+	require.Equal(t, codes.FailedPrecondition, status.Code(err), err)
+
+	big := strings.Repeat("x", 100<<10)
+	_, err = upload(t, client, &storepb.UploadHeader{Store: "local", Name: "in/x/b.csv"}, big)
+	require.NoError(t, err)
+
+	dl, err := client.Download(ctx, &storepb.ObjectRequest{Store: "local", Name: "in/x/b.csv"})
+	require.NoError(t, err)
+	var data []byte
+	msgs := 0
+	for {
+		resp, err := dl.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if msgs == 0 {
+			require.Equal(t, "in/x/b.csv", resp.Object.Name)
+		} else {
+			require.Nil(t, resp.Object)
+		}
+		data = append(data, resp.Data...)
+		msgs++
+	}
+	require.Equal(t, big, string(data))
+	require.Equal(t, 2, msgs)
+
+	lr, err := client.List(ctx, &storepb.ListRequest{Store: "local", Prefix: "in/", Delimiter: "/"})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(lr.Objects))
+	require.Equal(t, "in/a.csv", lr.Objects[0].Name)
+	require.Equal(t, []string{"in/x/"}, lr.Prefixes)
+
+	_, err = client.Delete(ctx, &storepb.ObjectRequest{Store: "local", Name: "in/a.csv"})
+	require.NoError(t, err)
+	_, err = client.Stat(ctx, &storepb.ObjectRequest{Store: "local", Name: "in/a.csv"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.Stat(ctx, &storepb.ObjectRequest{Store: "remote", Name: "in/a.csv"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	// the first message must have the header
+	_, err = upload(t, client, nil, "a")
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPCInvalidNames(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    tmpDir + "/store",
+		TmpDir:     tmpDir + "/tmp",
+	})
+	require.NoError(t, err)
+
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	server.New(map[string]cloudstorage.Store{"local": store}).RegisterGRPC(gs)
+	go gs.Serve(lis)
+	defer gs.Stop()
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := storepb.NewStoreClient(conn)
+	ctx := context.Background()
+
+	for _, name := range []string{"", "../escaped", "in/../../escaped", "/escaped", "in/./a"} {
+		_, err := upload(t, client, &storepb.UploadHeader{Store: "local", Name: name}, "x")
+		require.Equal(t, codes.InvalidArgument, status.Code(err), name)
+		_, err = client.Stat(ctx, &storepb.ObjectRequest{Store: "local", Name: name})
+		require.Equal(t, codes.InvalidArgument, status.Code(err), name)
+		_, err = client.Delete(ctx, &storepb.ObjectRequest{Store: "local", Name: name})
+		require.Equal(t, codes.InvalidArgument, status.Code(err), name)
+		dl, err := client.Download(ctx, &storepb.ObjectRequest{Store: "local", Name: name})
+		require.NoError(t, err)
+		_, err = dl.Recv()
+		require.Equal(t, codes.InvalidArgument, status.Code(err), name)
+	}
+	_, err = client.List(ctx, &storepb.ListRequest{Store: "local", Prefix: "../"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
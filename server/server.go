@@ -0,0 +1,340 @@
+// Package server exposes stores over http, so services not written in Go
+// share the stores, and their credentials, of a Go process:
+//
+//	GET    /stores                          names of the stores
+//	GET    /stores/{store}/objects          list, ?prefix=&delimiter=&cursor=&limit=
+//	GET    /stores/{store}/objects/{name}   download the object
+//	HEAD   /stores/{store}/objects/{name}   headers of the object
+//	PUT    /stores/{store}/objects/{name}   upload the request body
+//	DELETE /stores/{store}/objects/{name}   delete the object
+//
+// Downloads and uploads are streamed.  The object metadata travels in
+// X-Meta-<key> headers besides Content-Type, Last-Modified and ETag, the
+// keys are the lowercased header names after the prefix, hyphens kept:
+// X-Meta-Owner-Team is key owner-team.  An
+// upload with If-None-Match: * only creates the object, one with If-Match
+// only replaces that ETag, failing with 412 on stores honoring them.
+// Errors are returned as {"error": "..."} with the status of the store
+// error, 404 for cloudstorage.ErrObjectNotFound etc.  Object names (and
+// list prefixes) that are empty, start with "/" or have a "." or ".."
+// segment are refused with 400, the file system stores would resolve them
+// outside their root.
+//
+// The same API is served over gRPC, with streamed uploads and downloads,
+// by registering the Server with RegisterGRPC, see storepb/store.proto.
+//
+// The Server does no authentication, wrap it in the handler of the
+// service's own, or the interceptors of the grpc.Server.
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/araddon/gou"
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+// MetaHeaderPrefix prefixes the headers of the object metadata keys.
+const MetaHeaderPrefix = "X-Meta-"
+
+// Server is an http.Handler serving named stores.
+type Server struct {
+	stores map[string]cloudstorage.Store
+}
+
+// New returns a Server of stores by name.
+func New(stores map[string]cloudstorage.Store) *Server {
+	return &Server{stores: stores}
+}
+
+// Object is the json form of an object in listings.
+type Object struct {
+	Name        string            `json:"name"`
+	Size        int64             `json:"size"`
+	Updated     time.Time         `json:"updated"`
+	ContentType string            `json:"content_type,omitempty"`
+	ETag        string            `json:"etag,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// ListResponse is the json response of a listing.
+type ListResponse struct {
+	Objects  []Object `json:"objects"`
+	Prefixes []string `json:"prefixes,omitempty"`
+	// NextCursor is the cursor of the next page, empty on the last one.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := strings.TrimPrefix(r.URL.Path, "/")
+	if p == "stores" || p == "stores/" {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		names := make([]string, 0, len(s.stores))
+		for name := range s.stores {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		writeJSON(w, http.StatusOK, names)
+		return
+	}
+	if !strings.HasPrefix(p, "stores/") {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	storeName, rest, _ := strings.Cut(strings.TrimPrefix(p, "stores/"), "/")
+	store, ok := s.stores[storeName]
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("unknown store "+strconv.Quote(storeName)))
+		return
+	}
+
+	switch {
+	case rest == "objects" || rest == "objects/":
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		s.list(w, r, store)
+	case strings.HasPrefix(rest, "objects/"):
+		name := strings.TrimPrefix(rest, "objects/")
+		if err := checkName(name); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			s.get(w, r, store, name)
+		case http.MethodPut:
+			s.put(w, r, store, name)
+		case http.MethodDelete:
+			s.delete(w, r, store, name)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		}
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request, store cloudstorage.Store) {
+	params := r.URL.Query()
+	if prefix := params.Get("prefix"); prefix != "" {
+		if err := checkName(prefix); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	q := cloudstorage.NewQuery(params.Get("prefix"))
+	q.Delimiter = params.Get("delimiter")
+	q.Marker = params.Get("cursor")
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, errors.New("invalid limit "+strconv.Quote(limit)))
+			return
+		}
+		q.PageSize = n
+	}
+
+	resp, err := store.List(r.Context(), q)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	lr := ListResponse{
+		Objects:    make([]Object, 0, len(resp.Objects)),
+		Prefixes:   resp.Prefixes,
+		NextCursor: resp.NextMarker,
+	}
+	for _, o := range resp.Objects {
+		lr.Objects = append(lr.Objects, objectOf(o))
+	}
+	writeJSON(w, http.StatusOK, lr)
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request, store cloudstorage.Store, name string) {
+	ctx := r.Context()
+	obj, err := store.Get(ctx, name)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	attrs := cloudstorage.AttrsOf(obj)
+	h := w.Header()
+	for k, v := range obj.MetaData() {
+		switch k {
+		case cloudstorage.ContentTypeKey, cloudstorage.ContentLengthKey:
+		default:
+			h.Set(metaHeader(k), v)
+		}
+	}
+	if attrs.ContentType != "" {
+		h.Set("Content-Type", attrs.ContentType)
+	}
+	if size, ok := cloudstorage.SizeOf(obj); ok {
+		h.Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	if !attrs.Updated.IsZero() {
+		h.Set("Last-Modified", attrs.Updated.UTC().Format(http.TimeFormat))
+	}
+	if attrs.ETag != "" {
+		etag := strconv.Quote(attrs.ETag)
+		h.Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	rc, err := store.NewReaderWithContext(ctx, name)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	defer rc.Close()
+	if _, err := io.Copy(w, rc); err != nil {
+		// the status is sent, the client sees the short body
+		gou.Warnf("server could not send %s err=%v", name, err)
+	}
+}
+
+func (s *Server) put(w http.ResponseWriter, r *http.Request, store cloudstorage.Store, name string) {
+	md := make(map[string]string)
+	for k, v := range r.Header {
+		if key, ok := metaKey(k); ok && len(v) > 0 {
+			md[key] = v[0]
+		}
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		md[cloudstorage.ContentTypeKey] = ct
+	}
+	md, err := cloudstorage.NormalizeMetadata(md)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var opts cloudstorage.Opts
+	if r.Header.Get("If-None-Match") == "*" {
+		opts.IfNotExists = true
+	}
+	if m := r.Header.Get("If-Match"); m != "" {
+		opts.IfMatch = strings.Trim(m, `"`)
+	}
+
+	// the upload is abandoned, not committed, if the body is cut short
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	wc, err := store.NewWriterWithContext(ctx, name, md, opts)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	if _, err := io.Copy(wc, r.Body); err != nil {
+		cancel()
+		wc.Close()
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := wc.Close(); err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) delete(w http.ResponseWriter, r *http.Request, store cloudstorage.Store, name string) {
+	if err := store.Delete(r.Context(), name); err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkName refuses the object names that could escape the root of the
+// localfs, sftp and ftp stores, which keep "." and ".." in the keys they
+// join: empty names, names starting with "/" and "." or ".." segments.
+func checkName(name string) error {
+	if name == "" {
+		return errors.New("empty object name")
+	}
+	if strings.HasPrefix(name, "/") {
+		return errors.New("invalid object name " + strconv.Quote(name) + ": starts with /")
+	}
+	for _, seg := range strings.Split(name, "/") {
+		if seg == "." || seg == ".." {
+			return errors.New("invalid object name " + strconv.Quote(name) + ": has a " + seg + " segment")
+		}
+	}
+	return nil
+}
+
+// metaKey is the metadata key of a canonical X-Meta-<key> header name.
+func metaKey(header string) (string, bool) {
+	if !strings.HasPrefix(header, MetaHeaderPrefix) || len(header) == len(MetaHeaderPrefix) {
+		return "", false
+	}
+	return strings.ToLower(header[len(MetaHeaderPrefix):]), true
+}
+
+// metaHeader is the header name of a metadata key.
+func metaHeader(key string) string {
+	return http.CanonicalHeaderKey(MetaHeaderPrefix + key)
+}
+
+func objectOf(o cloudstorage.Object) Object {
+	attrs := cloudstorage.AttrsOf(o)
+	size, _ := cloudstorage.SizeOf(o)
+	return Object{
+		Name:        o.Name(),
+		Size:        size,
+		Updated:     attrs.Updated,
+		ContentType: attrs.ContentType,
+		ETag:        attrs.ETag,
+		Metadata:    o.MetaData(),
+	}
+}
+
+// statusOf maps store errors to http status codes.
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, cloudstorage.ErrObjectNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, cloudstorage.ErrObjectExists), errors.Is(err, cloudstorage.ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, cloudstorage.ErrInvalidMetadata):
+		return http.StatusBadRequest
+	case errors.Is(err, cloudstorage.ErrNotImplemented):
+		return http.StatusNotImplemented
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		gou.Warnf("server could not write response err=%v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
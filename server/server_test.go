@@ -0,0 +1,127 @@
+package server_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/localfs"
+	"github.com/lytics/cloudstorage/server"
+)
+
+func do(t *testing.T, method, url, body string, header http.Header) (*http.Response, string) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(b)
+}
+
+func TestServer(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    tmpDir + "/store",
+		TmpDir:     tmpDir + "/tmp",
+	})
+	require.NoError(t, err)
+	srv := httptest.NewServer(server.New(map[string]cloudstorage.Store{"local": store}))
+	defer srv.Close()
+	objects := srv.URL + "/stores/local/objects"
+
+	resp, body := do(t, http.MethodGet, srv.URL+"/stores", "", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.JSONEq(t, `["local"]`, body)
+
+	resp, _ = do(t, http.MethodPut, objects+"/in/a.csv", "a,b\n", http.Header{
+		"Content-Type":      {"text/csv"},
+		"X-Meta-Owner":      {"jobs"},
+		"X-Meta-Owner-Team": {"etl"},
+		"If-None-Match":     {"*"},
+	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp, body = do(t, http.MethodPut, objects+"/in/a.csv", "c,d\n", http.Header{"If-None-Match": {"*"}})
+	require.Equal(t, http.StatusPreconditionFailed, resp.StatusCode, body)
+	resp, _ = do(t, http.MethodPut, objects+"/in/x/b.csv", "c,d\n", nil)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, body = do(t, http.MethodGet, objects+"/in/a.csv", "", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "a,b\n", body)
+	require.Equal(t, "text/csv", resp.Header.Get("Content-Type"))
+	require.Equal(t, "jobs", resp.Header.Get("X-Meta-Owner"))
+	require.Equal(t, "etl", resp.Header.Get("X-Meta-Owner-Team"))
+	require.Equal(t, "4", resp.Header.Get("Content-Length"))
+
+	resp, body = do(t, http.MethodHead, objects+"/in/a.csv", "", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "", body)
+
+	resp, body = do(t, http.MethodGet, objects+"?prefix=in/&delimiter=/", "", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var lr server.ListResponse
+	require.NoError(t, json.Unmarshal([]byte(body), &lr))
+	require.Equal(t, 1, len(lr.Objects))
+	require.Equal(t, "in/a.csv", lr.Objects[0].Name)
+	require.Equal(t, int64(4), lr.Objects[0].Size)
+	require.Equal(t, "jobs", lr.Objects[0].Metadata["owner"])
+	require.Equal(t, "etl", lr.Objects[0].Metadata["owner-team"])
+	require.Equal(t, []string{"in/x/"}, lr.Prefixes)
+
+	resp, _ = do(t, http.MethodDelete, objects+"/in/a.csv", "", nil)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp, body = do(t, http.MethodGet, objects+"/in/a.csv", "", nil)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	require.JSONEq(t, `{"error":"object not found"}`, body)
+
+	resp, _ = do(t, http.MethodGet, srv.URL+"/stores/remote/objects", "", nil)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = do(t, http.MethodPost, objects+"/in/x/b.csv", "", nil)
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	resp, _ = do(t, http.MethodGet, objects+"?limit=none", "", nil)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestServerInvalidNames(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    tmpDir + "/store",
+		TmpDir:     tmpDir + "/tmp",
+	})
+	require.NoError(t, err)
+	srv := httptest.NewServer(server.New(map[string]cloudstorage.Store{"local": store}))
+	defer srv.Close()
+	objects := srv.URL + "/stores/local/objects/"
+
+	for _, name := range []string{"../escaped", "in/../../escaped", "%2e%2e/escaped", "./escaped", "/escaped"} {
+		for _, method := range []string{http.MethodPut, http.MethodGet, http.MethodDelete} {
+			resp, body := do(t, method, objects+name, "x", nil)
+			require.Equal(t, http.StatusBadRequest, resp.StatusCode, "%s %s: %s", method, name, body)
+		}
+	}
+	resp, _ := do(t, http.MethodGet, srv.URL+"/stores/local/objects?prefix=../", "", nil)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// nothing was written outside the store
+	_, err = os.Stat(tmpDir + "/escaped")
+	require.True(t, os.IsNotExist(err))
+	// names merely containing dots are fine
+	resp, _ = do(t, http.MethodPut, objects+"in/..a/b..csv", "x", nil)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+}
@@ -0,0 +1,53 @@
+package sftp
+
+import (
+	"path"
+
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+var _ cloudstorage.StoreComposer = (*Client)(nil)
+
+// Compose concatenates srcs into a temp file next to dst on the server and
+// renames it over dst.  sftp has no server side copy so the bytes go
+// through this client, but not through the local cache.
+func (m *Client) Compose(ctx context.Context, dst string, srcs []string) error {
+	for _, src := range srcs {
+		if !m.Exists(src) {
+			return cloudstorage.ErrObjectNotFound
+		}
+	}
+	m.ensureDir(dst)
+	target := m.fullPath(dst)
+	tmp := path.Join(path.Dir(target), "."+path.Base(target)+"."+m.ID+".compose")
+
+	f, err := m.client.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer m.client.Remove(tmp)
+	for _, src := range srcs {
+		if err := ctx.Err(); err != nil {
+			f.Close()
+			return err
+		}
+		sf, err := m.client.Open(m.fullPath(src))
+		if err != nil {
+			f.Close()
+			return err
+		}
+		_, err = sf.WriteTo(f)
+		sf.Close()
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return m.rename(tmp, target)
+}
@@ -0,0 +1,145 @@
+package sftp
+
+import (
+	"time"
+
+	ftp "github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/lytics/cloudstorage"
+)
+
+// SftpConfig is the typed form of the cloudstorage.Config fields and
+// Settings used by the sftp store.
+type SftpConfig struct {
+	AuthMethod cloudstorage.AuthMethod
+	TmpDir     string
+
+	Host string
+	Port int
+	User string
+	// Password Settings[ConfKeyPassword], required for AuthUserPass.
+	Password string
+	// PrivateKey Settings[ConfKeyPrivateKey], required for AuthUserKey.
+	PrivateKey string
+	Folder     string
+
+	// DialTimeout Settings[ConfKeyDialTimeout] duration string.
+	DialTimeout string
+	// KeepAliveInterval Settings[ConfKeyKeepAliveInterval] duration string.
+	KeepAliveInterval string
+	// TCPKeepAlive Settings[ConfKeyTCPKeepAlive] duration string.
+	TCPKeepAlive string
+
+	JumpHost       string
+	JumpUser       string
+	JumpPassword   string
+	JumpPrivateKey string
+
+	// MaxPacket Settings[ConfKeyMaxPacket] bytes, 0 for the sftp default.
+	MaxPacket int
+	// ConcurrentRequests Settings[ConfKeyConcurrentRequests] per file, 0
+	// for the sftp default.
+	ConcurrentRequests int
+	// ConcurrentReads Settings[ConfKeyConcurrentReads], defaults to true.
+	ConcurrentReads bool
+	// ConcurrentWrites Settings[ConfKeyConcurrentWrites].
+	ConcurrentWrites bool
+}
+
+// NewSftpConfig converts a generic cloudstorage.Config into a SftpConfig.
+func NewSftpConfig(conf *cloudstorage.Config) *SftpConfig {
+	c := &SftpConfig{
+		AuthMethod: conf.AuthMethod,
+		TmpDir:     conf.TmpDir,
+		Host:       conf.Settings.String(ConfKeyHost),
+		Port:       conf.Settings.Int(ConfKeyPort),
+		User:       conf.Settings.String(ConfKeyUser),
+		Password:   conf.Settings.String(ConfKeyPassword),
+		PrivateKey: conf.Settings.String(ConfKeyPrivateKey),
+		Folder:     conf.Settings.String(ConfKeyFolder),
+
+		DialTimeout:       conf.Settings.String(ConfKeyDialTimeout),
+		KeepAliveInterval: conf.Settings.String(ConfKeyKeepAliveInterval),
+		TCPKeepAlive:      conf.Settings.String(ConfKeyTCPKeepAlive),
+
+		JumpHost:       conf.Settings.String(ConfKeyJumpHost),
+		JumpUser:       conf.Settings.String(ConfKeyJumpUser),
+		JumpPassword:   conf.Settings.String(ConfKeyJumpPassword),
+		JumpPrivateKey: conf.Settings.String(ConfKeyJumpPrivateKey),
+
+		ConcurrentReads:  true,
+		ConcurrentWrites: conf.Settings.Bool(ConfKeyConcurrentWrites),
+	}
+	if v, ok := conf.Settings.IntSafe(ConfKeyMaxPacket); ok {
+		c.MaxPacket = v
+	}
+	if v, ok := conf.Settings.IntSafe(ConfKeyConcurrentRequests); ok {
+		c.ConcurrentRequests = v
+	}
+	if v, ok := conf.Settings.BoolSafe(ConfKeyConcurrentReads); ok {
+		c.ConcurrentReads = v
+	}
+	return c
+}
+
+// Validate checks the config returning a *cloudstorage.ConfigError that
+// lists every missing or invalid key.
+func (c *SftpConfig) Validate() error {
+	e := &cloudstorage.ConfigError{Type: StoreType}
+	e.Require("tmpdir", c.TmpDir)
+	e.Require("settings."+ConfKeyHost, c.Host)
+	e.Require("settings."+ConfKeyUser, c.User)
+	if c.Port <= 0 {
+		e.Missing = append(e.Missing, "settings."+ConfKeyPort)
+	}
+	switch c.AuthMethod {
+	case AuthUserPass:
+		e.Require("settings."+ConfKeyPassword, c.Password)
+	case AuthUserKey:
+		e.Require("settings."+ConfKeyPrivateKey, c.PrivateKey)
+	case "":
+		e.Missing = append(e.Missing, "authmethod")
+	default:
+		e.Invalidf("authmethod %q is not supported", c.AuthMethod)
+	}
+	for _, d := range []struct{ key, val string }{
+		{ConfKeyDialTimeout, c.DialTimeout},
+		{ConfKeyKeepAliveInterval, c.KeepAliveInterval},
+		{ConfKeyTCPKeepAlive, c.TCPKeepAlive},
+	} {
+		if d.val == "" {
+			continue
+		}
+		if dur, err := time.ParseDuration(d.val); err != nil || dur <= 0 {
+			e.Invalidf("settings.%s=%q is not a positive duration", d.key, d.val)
+		}
+	}
+	if c.JumpPrivateKey != "" {
+		if _, err := ssh.ParsePrivateKey([]byte(c.JumpPrivateKey)); err != nil {
+			e.Invalidf("settings.%s is not a valid private key", ConfKeyJumpPrivateKey)
+		}
+	}
+	if c.MaxPacket < 0 {
+		e.Invalidf("settings.%s=%d must be positive", ConfKeyMaxPacket, c.MaxPacket)
+	}
+	if c.ConcurrentRequests < 0 {
+		e.Invalidf("settings.%s=%d must be positive", ConfKeyConcurrentRequests, c.ConcurrentRequests)
+	}
+	return e.Err()
+}
+
+// clientOptions are the pkg/sftp client options for the transfer settings.
+func (c *SftpConfig) clientOptions() []ftp.ClientOption {
+	opts := []ftp.ClientOption{
+		ftp.UseConcurrentReads(c.ConcurrentReads),
+		ftp.UseConcurrentWrites(c.ConcurrentWrites),
+	}
+	if c.MaxPacket > 0 {
+		opts = append(opts, ftp.MaxPacketUnchecked(c.MaxPacket))
+	}
+	if c.ConcurrentRequests > 0 {
+		opts = append(opts, ftp.MaxConcurrentRequestsPerFile(c.ConcurrentRequests))
+	}
+	return opts
+}
@@ -0,0 +1,150 @@
+package sftp
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/araddon/gou"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+// dialer connects the ssh client, optionally through a jump host.
+type dialer struct {
+	timeout      time.Duration
+	keepAlive    time.Duration
+	tcpKeepAlive time.Duration
+	jumpAddr     string
+	jumpConfig   *ssh.ClientConfig
+}
+
+// newDialer reads the network settings of a validated config, config is the
+// ssh config of the target whose credentials a jump host defaults to.
+func newDialer(conf *cloudstorage.Config, config *ssh.ClientConfig) (*dialer, error) {
+	c := NewSftpConfig(conf)
+	d := &dialer{timeout: timeout}
+	if c.DialTimeout != "" {
+		d.timeout, _ = time.ParseDuration(c.DialTimeout)
+	}
+	if c.KeepAliveInterval != "" {
+		d.keepAlive, _ = time.ParseDuration(c.KeepAliveInterval)
+	}
+	if c.TCPKeepAlive != "" {
+		d.tcpKeepAlive, _ = time.ParseDuration(c.TCPKeepAlive)
+	}
+	if c.JumpHost == "" {
+		return d, nil
+	}
+
+	host, port := c.JumpHost, 22
+	if h, p, err := net.SplitHostPort(c.JumpHost); err == nil {
+		host = h
+		if port, err = strconv.Atoi(p); err != nil {
+			return nil, fmt.Errorf("invalid config: settings.%s=%q bad port", ConfKeyJumpHost, c.JumpHost)
+		}
+	}
+	d.jumpAddr = net.JoinHostPort(host, strconv.Itoa(port))
+
+	user := c.JumpUser
+	if user == "" {
+		user = config.User
+	}
+	switch {
+	case c.JumpPrivateKey != "":
+		jc, err := ConfigUserKey(user, c.JumpPrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		d.jumpConfig = jc
+	case c.JumpPassword != "":
+		d.jumpConfig = ConfigUserPass(user, c.JumpPassword)
+	default:
+		jc := *config
+		jc.User = user
+		d.jumpConfig = &jc
+	}
+	return d, nil
+}
+
+// dial connects to target returning the ssh client and the jump host
+// client (nil without one), which must be closed after the client.
+func (d *dialer) dial(ctx context.Context, target string, config *ssh.ClientConfig) (*ssh.Client, *ssh.Client, error) {
+	if d.jumpAddr == "" {
+		conn, err := (&net.Dialer{Timeout: d.timeout, KeepAlive: d.tcpKeepAlive}).DialContext(ctx, "tcp", target)
+		if err != nil {
+			return nil, nil, err
+		}
+		client, err := d.handshake(conn, target, config)
+		return client, nil, err
+	}
+
+	conn, err := (&net.Dialer{Timeout: d.timeout, KeepAlive: d.tcpKeepAlive}).DialContext(ctx, "tcp", d.jumpAddr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not reach jump host %s: %w", d.jumpAddr, err)
+	}
+	jump, err := d.handshake(conn, d.jumpAddr, d.jumpConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed login to jump host %s: %w", d.jumpAddr, err)
+	}
+	tunnel, err := jump.Dial("tcp", target)
+	if err != nil {
+		jump.Close()
+		return nil, nil, fmt.Errorf("jump host %s could not reach %s: %w", d.jumpAddr, target, err)
+	}
+	client, err := d.handshake(tunnel, target, config)
+	if err != nil {
+		jump.Close()
+		return nil, nil, err
+	}
+	return client, jump, nil
+}
+
+// handshake runs the ssh handshake on conn bounded by the dial timeout.
+func (d *dialer) handshake(conn net.Conn, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	conn.SetDeadline(time.Now().Add(d.timeout))
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// keepAliveLoop sends keepalive requests every interval until done is
+// closed, closing the connection if the server stops answering so blocked
+// sftp operations return an error instead of hanging.
+func keepAliveLoop(client *ssh.Client, interval time.Duration, done <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+		}
+		errc := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			errc <- err
+		}()
+		select {
+		case <-done:
+			return
+		case err := <-errc:
+			if err != nil {
+				gou.Warnf("sftp keepalive failed, closing connection: %v", err)
+				client.Close()
+				return
+			}
+		case <-time.After(interval):
+			gou.Warnf("sftp keepalive got no answer in %v, closing connection", interval)
+			client.Close()
+			return
+		}
+	}
+}
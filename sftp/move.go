@@ -0,0 +1,59 @@
+package sftp
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/araddon/gou"
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+var _ cloudstorage.StoreMove = (*Client)(nil)
+
+// Move renames the file of src over dst on the server, so moves of huge
+// files don't go through this client.  For objects of another store, or if
+// the server refuses the rename (ie across its file systems), it returns
+// ErrNotImplemented and cloudstorage.Move copies the file then deletes src.
+func (m *Client) Move(ctx context.Context, src, dst cloudstorage.Object) error {
+	if !m.owns(src) || !m.owns(dst) {
+		return cloudstorage.ErrNotImplemented
+	}
+	ctx, cancel := cloudstorage.WithTimeout(ctx, m.timeouts.Write)
+	defer cancel()
+	return cloudstorage.Run(ctx, func() error {
+		if !m.Exists(src.Name()) {
+			return cloudstorage.ErrObjectNotFound
+		}
+		from, to := m.fullPath(src.Name()), m.fullPath(dst.Name())
+		if from == to {
+			return nil
+		}
+		m.ensureDir(dst.Name())
+		if err := m.rename(from, to); err != nil {
+			return fmt.Errorf("could not rename %q err=%v: %w", from, err, cloudstorage.ErrNotImplemented)
+		}
+		return nil
+	})
+}
+
+// rename from over to.  Servers without the posix-rename extension refuse
+// to rename over an existing file, so to is removed first.
+func (m *Client) rename(from, to string) error {
+	err := m.client.PosixRename(from, to)
+	if err == nil {
+		return nil
+	}
+	gou.Debugf("posix rename of %q failed, falling back to remove and rename: %v", to, err)
+	if err := m.client.Remove(to); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return m.client.Rename(from, to)
+}
+
+// owns is true for the objects of this client.
+func (m *Client) owns(o cloudstorage.Object) bool {
+	so, ok := o.(*object)
+	return ok && so.client == m
+}
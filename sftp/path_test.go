@@ -0,0 +1,138 @@
+package sftp
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	ftp "github.com/pkg/sftp"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/conformance"
+)
+
+// newPipeClient returns a Client talking to an in memory sftp server whose
+// login directory is /home/user.
+func newPipeClient(t *testing.T, bucket string) *Client {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	server := ftp.NewRequestServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw}, ftp.InMemHandler(), ftp.WithStartDirectory("/home/user"))
+	go server.Serve()
+
+	fc, err := ftp.NewClientPipe(cr, cw)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		server.Close()
+		fc.Close()
+	})
+	require.NoError(t, fc.MkdirAll("/home/user"))
+
+	return &Client{
+		ID:        "test",
+		clientCtx: context.Background(),
+		client:    fc,
+		cachepath: t.TempDir(),
+		bucket:    bucket,
+		paths:     make(map[string]struct{}),
+	}
+}
+
+func TestPathResolution(t *testing.T) {
+	for _, tc := range []struct {
+		bucket, path string
+	}{
+		{"", "/home/user/a/b.txt"},
+		{"folder", "/home/user/folder/a/b.txt"},
+		{"Mixed/Case", "/home/user/Mixed/Case/a/b.txt"},
+		{"/srv/data/", "/srv/data/a/b.txt"},
+	} {
+		t.Run(tc.bucket, func(t *testing.T) {
+			ctx := context.Background()
+			c := newPipeClient(t, tc.bucket)
+			require.NoError(t, c.client.MkdirAll("/srv/data"))
+
+			require.False(t, c.Exists("a/b.txt"))
+			_, err := c.Get(ctx, "a/b.txt")
+			require.Equal(t, cloudstorage.ErrObjectNotFound, err)
+
+			w, err := c.NewWriterWithContext(ctx, "a/b.txt", nil)
+			require.NoError(t, err)
+			_, err = w.Write([]byte("hello"))
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+
+			_, err = c.client.Stat(tc.path)
+			require.NoError(t, err)
+			require.True(t, c.Exists("a/b.txt"))
+			require.True(t, c.Exists("/a/b.txt"))
+
+			obj, err := c.Get(ctx, "a/b.txt")
+			require.NoError(t, err)
+			require.Equal(t, "a/b.txt", obj.Name())
+
+			resp, err := c.List(ctx, cloudstorage.Query{Prefix: "a/"})
+			require.NoError(t, err)
+			require.Equal(t, 1, len(resp.Objects))
+			require.Equal(t, "a/b.txt", resp.Objects[0].Name())
+
+			rc, err := c.NewReaderWithContext(ctx, "a/b.txt")
+			require.NoError(t, err)
+			b, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			rc.Close()
+			require.Equal(t, "hello", string(b))
+
+			require.NoError(t, c.Delete(ctx, "a/b.txt"))
+			require.False(t, c.Exists("a/b.txt"))
+			_, err = c.client.Stat(tc.path)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestCompose(t *testing.T) {
+	ctx := context.Background()
+	c := newPipeClient(t, "folder")
+	for name, data := range map[string]string{"parts/0.csv": "a\n", "parts/1.csv": "b\n"} {
+		require.NoError(t, cloudstorage.Put(ctx, c, name, strings.NewReader(data), nil))
+	}
+
+	require.NoError(t, c.Compose(ctx, "out/all.csv", []string{"parts/0.csv", "parts/1.csv"}))
+	require.NoError(t, c.Compose(ctx, "out/all.csv", []string{"out/all.csv", "parts/0.csv"}))
+	b, err := cloudstorage.ReadAll(ctx, c, "out/all.csv")
+	require.NoError(t, err)
+	require.Equal(t, "a\nb\na\n", string(b))
+
+	require.Equal(t, cloudstorage.ErrObjectNotFound, c.Compose(ctx, "out/x.csv", []string{"parts/2.csv"}))
+}
+
+func TestEmptyObjects(t *testing.T) {
+	s := &conformance.Suite{Store: newPipeClient(t, "folder")}
+	s.EmptyObjects(t)
+}
+
+func TestMove(t *testing.T) {
+	c := newPipeClient(t, "folder")
+	s := &conformance.Suite{Store: c}
+	s.Move(t)
+
+	// the file is renamed on the server, over an existing dst
+	ctx := context.Background()
+	require.NoError(t, cloudstorage.Put(ctx, c, "in/a.csv", strings.NewReader("a,b"), nil))
+	src, err := c.Get(ctx, "in/a.csv")
+	require.NoError(t, err)
+	dst, err := c.Get(ctx, "to/testmove.txt")
+	require.NoError(t, err)
+	require.NoError(t, c.Move(ctx, src, dst))
+	b, err := cloudstorage.ReadAll(ctx, c, "to/testmove.txt")
+	require.NoError(t, err)
+	require.Equal(t, "a,b", string(b))
+	require.False(t, c.Exists("in/a.csv"))
+
+	require.Equal(t, cloudstorage.ErrObjectNotFound, c.Move(ctx, src, dst))
+}
@@ -1,12 +1,12 @@
 package sftp
 
 import (
-	"bytes"
 	"fmt"
 	"io"
 	"os"
-	"path"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/araddon/gou"
@@ -16,6 +16,7 @@ import (
 	"golang.org/x/net/context"
 
 	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/pathutil"
 )
 
 const (
@@ -43,6 +44,41 @@ const (
 	ConfKeyPort = "port"
 	// ConfKeyFolder config key name of the sftp folder
 	ConfKeyFolder = "folder"
+	// ConfKeyDialTimeout config key name of the connect and ssh handshake
+	// timeout, a duration string such as "30s".  Defaults to 5m.
+	ConfKeyDialTimeout = "dial_timeout"
+	// ConfKeyKeepAliveInterval config key name of the interval between ssh
+	// keepalive requests, a duration string.  A connection not answering
+	// within the interval is closed so pending operations fail rather than
+	// hang.  Off by default.
+	ConfKeyKeepAliveInterval = "keepalive_interval"
+	// ConfKeyTCPKeepAlive config key name of the tcp keepalive period, a
+	// duration string.  Defaults to the go net default.
+	ConfKeyTCPKeepAlive = "tcp_keepalive"
+	// ConfKeyJumpHost config key name of a bastion "host[:port]" the
+	// connection is tunneled through, ProxyJump style.
+	ConfKeyJumpHost = "jump_host"
+	// ConfKeyJumpUser config key name of the jump host user, defaults to user.
+	ConfKeyJumpUser = "jump_user"
+	// ConfKeyJumpPassword config key name of the jump host password.
+	ConfKeyJumpPassword = "jump_password"
+	// ConfKeyJumpPrivateKey config key name of the jump host private key,
+	// without a jump password or key the target's credentials are used.
+	ConfKeyJumpPrivateKey = "jump_privatekey"
+	// ConfKeyMaxPacket config key name of the largest sftp packet payload
+	// in bytes.  Defaults to 32768, the size every server must accept,
+	// larger values speed up transfers on servers that allow them.
+	ConfKeyMaxPacket = "max_packet"
+	// ConfKeyConcurrentRequests config key name of the number of requests
+	// in flight per file during concurrent reads and writes.  Defaults to 64.
+	ConfKeyConcurrentRequests = "concurrent_requests"
+	// ConfKeyConcurrentReads config key name of whether downloads issue
+	// concurrent reads.  Defaults to true, disable for "read once" servers
+	// that delete a file once it has been stat'ed.
+	ConfKeyConcurrentReads = "concurrent_reads"
+	// ConfKeyConcurrentWrites config key name of whether uploads issue
+	// concurrent writes.  Defaults to false.
+	ConfKeyConcurrentWrites = "concurrent_writes"
 )
 
 type (
@@ -69,12 +105,26 @@ type (
 		ID        string
 		clientCtx context.Context
 		client    *ftp.Client
-		cachepath string
-		host      string
-		port      int
-		bucket    string
-		files     []string
-		paths     map[string]struct{}
+		// sshClient is closed with client, jumpClient when tunneled through
+		// a jump host, done stops the keepalive loop.
+		sshClient  *ssh.Client
+		jumpClient *ssh.Client
+		done       chan struct{}
+		closeOnce  sync.Once
+		cachepath  string
+		host       string
+		port       int
+		bucket     string
+		files      []string
+		// paths created by ensureDir, guarded by pathsMu as the Client is
+		// shared by concurrent writers.
+		pathsMu sync.Mutex
+		paths   map[string]struct{}
+		// concurrentWrites partial uploads are removed as they may have holes.
+		concurrentWrites bool
+		// timeouts the sftp client takes no context, so operations run
+		// with cloudstorage.Run and give up on a wedged connection.
+		timeouts cloudstorage.Timeouts
 	}
 
 	// File represents sftp File
@@ -139,31 +189,52 @@ func NewClient(clientCtx context.Context, conf *cloudstorage.Config, host string
 		return nil, err
 	}
 
-	sshClient, err := ssh.Dial("tcp", target, config)
+	uid := uuid.NewUUID().String()
+	uid = strings.Replace(uid, "-", "", -1)
+	cachepath, err := cloudstorage.CacheDir(conf.TmpDir, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := newDialer(conf, config)
+	if err != nil {
+		return nil, err
+	}
+	sshClient, jumpClient, err := d.dial(clientCtx, target, config)
 	if err != nil {
 		gou.WarnCtx(clientCtx, "failed SFTP login for %s with error %s", config.User, err)
 		return nil, err
 	}
 
-	ftpClient, err := ftp.NewClient(sshClient)
+	c := NewSftpConfig(conf)
+	ftpClient, err := ftp.NewClient(sshClient, c.clientOptions()...)
 	if err != nil {
 		gou.WarnCtx(clientCtx, "failed creating SFTP client for %s with error %s", config.User, err)
 		sshClient.Close()
+		if jumpClient != nil {
+			jumpClient.Close()
+		}
 		return nil, err
 	}
 
-	uid := uuid.NewUUID().String()
-	uid = strings.Replace(uid, "-", "", -1)
-
 	client := &Client{
-		ID:        uid,
-		clientCtx: clientCtx,
-		client:    ftpClient,
-		host:      host,
-		port:      port,
-		cachepath: conf.TmpDir,
-		bucket:    folder,
-		paths:     make(map[string]struct{}),
+		ID:         uid,
+		clientCtx:  clientCtx,
+		client:     ftpClient,
+		sshClient:  sshClient,
+		jumpClient: jumpClient,
+		done:       make(chan struct{}),
+		host:       host,
+		port:       port,
+		cachepath:  cachepath,
+		bucket:     folder,
+		paths:      make(map[string]struct{}),
+
+		concurrentWrites: c.ConcurrentWrites,
+		timeouts:         conf.Timeouts(),
+	}
+	if d.keepAlive > 0 {
+		go keepAliveLoop(sshClient, d.keepAlive, client.done)
 	}
 
 	//gou.Infof("%p created sftp client %#v", client, ftpClient)
@@ -172,6 +243,9 @@ func NewClient(clientCtx context.Context, conf *cloudstorage.Config, host string
 }
 
 func NewStore(conf *cloudstorage.Config) (cloudstorage.Store, error) {
+	if err := NewSftpConfig(conf).Validate(); err != nil {
+		return nil, err
+	}
 	ctx := context.Background()
 	if conf.LogPrefix != "" {
 		ctx = gou.NewContext(ctx, conf.LogPrefix)
@@ -235,6 +309,27 @@ func (m *Client) Type() string {
 	return StoreType
 }
 
+// CleanCache removes stale cache files from the store's TmpDir, see
+// cloudstorage.CleanCache.
+func (m *Client) CleanCache(ctx context.Context, olderThan time.Duration) error {
+	return cloudstorage.CleanCache(ctx, m.cachepath, olderThan)
+}
+
+// CachePath is the cache directory of the store below its TmpDir.
+func (m *Client) CachePath() string {
+	return m.cachepath
+}
+
+// UpdatedGranularity of sftp, file attributes only have seconds.
+func (m *Client) UpdatedGranularity() time.Duration {
+	return time.Second
+}
+
+// Capabilities of sftp.
+func (m *Client) Capabilities() cloudstorage.Capabilities {
+	return cloudstorage.Capabilities{Concurrent: true}
+}
+
 // Client return underlying client
 func (m *Client) Client() interface{} {
 	return m.client
@@ -248,11 +343,17 @@ func (o *object) DisableCompression() {}
 
 // NewObject create a new object with given name.  Will not write to remote
 // sftp until Close is called.
-func (m *Client) NewObject(objectname string) (cloudstorage.Object, error) {
+func (m *Client) NewObject(objectname string, opts ...cloudstorage.Opts) (cloudstorage.Object, error) {
+	if len(opts) > 0 && opts[0].WriteThrough {
+		return cloudstorage.NewWriteThroughObject(m, objectname, opts[0])
+	}
 	obj, err := m.Get(context.Background(), objectname)
 	if err != nil && err != cloudstorage.ErrObjectNotFound {
 		return nil, err
 	} else if obj != nil {
+		if len(opts) > 0 && opts[0].Overwrite {
+			return obj, nil
+		}
 		return nil, cloudstorage.ErrObjectExists
 	}
 
@@ -271,16 +372,23 @@ func (m *Client) NewObject(objectname string) (cloudstorage.Object, error) {
 
 // Get opens a file for read or writing
 func (m *Client) Get(ctx context.Context, name string) (cloudstorage.Object, error) {
-	if !m.Exists(name) {
-		return nil, cloudstorage.ErrObjectNotFound
-	}
-	get := Concat(m.bucket, name)
-	//gou.DebugCtx(m.clientCtx, "getting file %s", get)
-	f, err := m.client.Stat(get)
+	ctx, cancel := cloudstorage.WithTimeout(ctx, m.timeouts.Read)
+	defer cancel()
+	var f os.FileInfo
+	err := cloudstorage.Run(ctx, func() error {
+		if !m.Exists(name) {
+			return cloudstorage.ErrObjectNotFound
+		}
+		get := m.fullPath(name)
+		//gou.DebugCtx(m.clientCtx, "getting file %s", get)
+		var err error
+		f, err = m.client.Stat(get)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-	return newObjectFromFile(m, get, f), nil
+	return newObjectFromFile(m, name, f), nil
 }
 
 /*
@@ -303,14 +411,18 @@ func (m *Client) Objects(ctx context.Context, q cloudstorage.Query) (cloudstorag
 }
 
 // Delete deletes a file
-func (m *Client) Delete(ctx context.Context, filename string) error {
-	if !m.Exists(filename) {
-		gou.Warnf("does not exist????? %q", filename)
-		return os.ErrNotExist
-	}
-	r := Concat(m.bucket, filename)
-	//gou.InfoCtx(m.clientCtx, "removing file %q", r)
-	return m.client.Remove(r)
+func (m *Client) Delete(ctx context.Context, filename string, opts ...cloudstorage.Opts) error {
+	ctx, cancel := cloudstorage.WithTimeout(ctx, m.timeouts.Write)
+	defer cancel()
+	return cloudstorage.Run(ctx, func() error {
+		if !m.Exists(filename) {
+			gou.Warnf("does not exist????? %q", filename)
+			return os.ErrNotExist
+		}
+		r := m.fullPath(filename)
+		//gou.InfoCtx(m.clientCtx, "removing file %q", r)
+		return m.client.Remove(r)
+	})
 }
 
 /*
@@ -329,7 +441,7 @@ func (m *Client) Rename(oldname, newname string) error {
 */
 // Exists checks to see if files exists
 func (m *Client) Exists(filename string) bool {
-	_, err := m.client.Stat(filename)
+	_, err := m.client.Stat(m.fullPath(filename))
 	if err == nil {
 		return true
 	}
@@ -356,18 +468,32 @@ func (m *Client) Exists(filename string) bool {
 	*/
 }
 
+// fullPath resolves an object name to its path on the server, below the
+// configured folder if there is one else relative to the login directory.
+// Every operation goes through it so names mean the same thing everywhere.
+func (m *Client) fullPath(name string) string {
+	return pathutil.JoinKey(m.bucket, pathutil.CleanKey(name))
+}
+
 func (m *Client) ensureDir(name string) {
 
-	name = Concat(m.bucket, name)
-	parts := strings.Split(strings.ToLower(name), "/")
+	name = m.fullPath(name)
+	parts := strings.Split(name, "/")
 	dir := ""
-	for _, dirPart := range parts[0 : len(parts)-1] {
-		if dir == "" {
+	for i, dirPart := range parts[0 : len(parts)-1] {
+		if i == 0 {
 			dir = dirPart
 		} else {
 			dir = strings.Join([]string{dir, dirPart}, "/")
 		}
-		if _, exists := m.paths[dir]; exists {
+		if dir == "" {
+			// leading "/" of an absolute folder
+			continue
+		}
+		m.pathsMu.Lock()
+		_, exists := m.paths[dir]
+		m.pathsMu.Unlock()
+		if exists {
 			continue
 		}
 
@@ -377,7 +503,9 @@ func (m *Client) ensureDir(name string) {
 				gou.Warn("Could not create directory for ftp", dir, err)
 			}
 		}
+		m.pathsMu.Lock()
 		m.paths[dir] = struct{}{}
+		m.pathsMu.Unlock()
 	}
 }
 
@@ -388,41 +516,56 @@ func (m *Client) List(ctx context.Context, q cloudstorage.Query) (*cloudstorage.
 		Objects: make(cloudstorage.Objects, 0),
 	}
 
-	err := m.listFiles(ctx, q, objs, m.bucket)
+	ctx, cancel := cloudstorage.WithTimeout(ctx, m.timeouts.List)
+	defer cancel()
+	err := cloudstorage.Run(ctx, func() error {
+		return m.listFiles(ctx, q, objs, "")
+	})
 	if err != nil {
 		gou.Warnf("fetch listFiles error %v", err)
 		return nil, err
 	}
+	// list in name order like the cloud stores, iterators resume by name
+	sort.Sort(objs.Objects)
 	objs.Objects = q.ApplyFilters(objs.Objects)
 	return objs, nil
 }
 
+// listFiles adds the files below path, an object name prefix relative to
+// the configured folder.
 func (m *Client) listFiles(ctx context.Context, q cloudstorage.Query, objs *cloudstorage.ObjectsResponse, path string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	fil, err := m.fetchFiles(path)
 	if err != nil {
 		gou.Warnf("fetch error %v %v", path, err)
 		return err
 	}
-	name := ""
 	for _, fi := range fil {
+		name := pathutil.JoinKey(path, fi.Name())
 		if fi.IsDir() {
-			err = m.listFiles(ctx, q, objs, strings.Join([]string{path, fi.Name()}, "/"))
+			dir := name
+			// with a "/" delimiter only descend towards the prefix's own
+			// level, sub-directories below it are left for Folders.
+			if prefix := dir + "/"; q.Delimiter == "/" && !strings.HasPrefix(q.Prefix, prefix) {
+				if strings.HasPrefix(prefix, q.Prefix) {
+					objs.Prefixes = append(objs.Prefixes, prefix)
+				}
+				continue
+			}
+			err = m.listFiles(ctx, q, objs, dir)
 			if err != nil {
 				gou.Warnf("could not get files %v  %v", fi.Name(), err)
 				return err
 			}
 		} else {
-
-			if path == "" {
-				name = fi.Name()
-			} else if strings.HasPrefix(path, "/") {
-				name = Concat(path[1:], fi.Name())
-			} else {
-				name = Concat(path, fi.Name())
-			}
 			if q.Prefix != "" && !strings.HasPrefix(name, q.Prefix) {
 				continue
 			}
+			if !q.Match(name, fi.Size()) {
+				continue
+			}
 			objs.Objects = append(objs.Objects, newObjectFromFile(m, name, fi))
 		}
 	}
@@ -460,27 +603,21 @@ func (m *Client) ListFiles(folder string, hidden bool) ([]string, error) {
 	return m.filterFileNames(folder, false, true, hidden)
 }
 */
-// Folders lists directories in a directory
+// Folders get folders list.
 func (m *Client) Folders(ctx context.Context, q cloudstorage.Query) ([]string, error) {
-	return m.listDirs(ctx, q.Prefix, "", q.ShowHidden)
-}
-
-func (m *Client) listDirs(ctx context.Context, folder, prefix string, hidden bool) ([]string, error) {
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	default:
-	}
-
-	dirs, err := m.filterFileNames(folder, true, false, hidden)
+	ctx, cancel := cloudstorage.WithTimeout(ctx, m.timeouts.List)
+	defer cancel()
+	iter, err := m.FolderIterator(ctx, q)
 	if err != nil {
 		return nil, err
 	}
-	var out []string
-	for _, d := range dirs {
-		out = append(out, fmt.Sprintf("%s/", path.Join(folder, d)))
-	}
-	return out, nil
+	defer iter.Close()
+	return cloudstorage.FoldersAll(iter)
+}
+
+// FolderIterator returns an iterator over the folders below the Query prefix.
+func (m *Client) FolderIterator(ctx context.Context, q cloudstorage.Query) (cloudstorage.FolderIterator, error) {
+	return cloudstorage.NewFolderPageIterator(ctx, m, q), nil
 }
 
 /*
@@ -496,12 +633,12 @@ func (m *Client) MkDir(dir string) error {
 			return nil
 		}
 	}
-	return m.client.Mkdir(Concat(m.Folder, dir))
+	return m.client.Mkdir(pathutil.JoinKey(m.Folder, dir))
 }
 
 // Cd changes the base dir
 func (m *Client) Cd(dir string) {
-	m.Folder = Concat(m.Folder, dir)
+	m.Folder = pathutil.JoinKey(m.Folder, dir)
 }
 
 func (m *Client) FilesAfter(t time.Time) ([]os.FileInfo, error) {
@@ -527,6 +664,17 @@ func (m *Client) FilesAfter(t time.Time) ([]os.FileInfo, error) {
 // Close closes underlying client connection
 func (m *Client) Close() {
 	m.client.Close()
+	m.closeOnce.Do(func() {
+		if m.done != nil {
+			close(m.done)
+		}
+		if m.sshClient != nil {
+			m.sshClient.Close()
+		}
+		if m.jumpClient != nil {
+			m.jumpClient.Close()
+		}
+	})
 }
 
 // NewReader create file reader.
@@ -536,17 +684,24 @@ func (m *Client) NewReader(o string) (io.ReadCloser, error) {
 
 // NewReaderWithContext create new File reader with context.
 func (m *Client) NewReaderWithContext(ctx context.Context, name string) (io.ReadCloser, error) {
-	if !m.Exists(name) {
-		return nil, cloudstorage.ErrObjectNotFound
-	}
-	get := Concat(m.bucket, name)
-	gou.DebugCtx(m.clientCtx, "NewReaderWithContext getting file %s", get)
-	f, err := m.client.Open(get)
+	ctx, cancel := cloudstorage.WithTimeout(ctx, m.timeouts.Read)
+	var f *ftp.File
+	err := cloudstorage.Run(ctx, func() error {
+		if !m.Exists(name) {
+			return cloudstorage.ErrObjectNotFound
+		}
+		get := m.fullPath(name)
+		gou.DebugCtx(m.clientCtx, "NewReaderWithContext getting file %s", get)
+		var err error
+		f, err = m.client.Open(get)
+		return err
+	})
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 
-	return f, nil
+	return cloudstorage.NewContextReader(ctx, f, cancel), nil
 }
 
 // NewWriter create Object Writer.
@@ -562,28 +717,39 @@ func (m *Client) NewWriterWithContext(ctx context.Context, name string, metadata
 
 	name = strings.Replace(name, " ", "+", -1)
 
-	//	NewWriter should override/truncate any existing file
-	if m.Exists(name) {
-		if err := m.Delete(ctx, name); err != nil {
-			gou.Errorf("failed to delete existing file %v %v", name, err)
-			return nil, err
+	ctx, cancel := cloudstorage.WithTimeout(ctx, m.timeouts.Write)
+	var o cloudstorage.Object
+	err := cloudstorage.Run(ctx, func() error {
+		//	NewWriter should override/truncate any existing file
+		if m.Exists(name) {
+			if err := m.Delete(ctx, name); err != nil {
+				gou.Errorf("failed to delete existing file %v %v", name, err)
+				return err
+			}
 		}
-	}
 
-	// pr, pw := io.Pipe()
-	// bw := csbufio.NewWriter(pw)
+		// pr, pw := io.Pipe()
+		// bw := csbufio.NewWriter(pw)
 
-	//o := &object{name: name}
-	o, err := m.NewObject(name)
-	if err != nil {
-		return nil, err
-	}
+		//o := &object{name: name}
+		var err error
+		o, err = m.NewObject(name)
+		if err != nil {
+			return err
+		}
 
-	if _, err = o.Open(cloudstorage.ReadWrite); err != nil {
-		gou.Errorf("could not open %v %v", name, err)
+		if _, err = o.Open(cloudstorage.ReadWrite); err != nil {
+			gou.Errorf("could not open %v %v", name, err)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		cancel()
 		return nil, err
 	}
-	return o, nil
+	// the upload happens on Close
+	return cloudstorage.NewResultWriter(cloudstorage.NewContextWriter(ctx, o, cancel), nil), nil
 }
 
 /*
@@ -602,7 +768,7 @@ func (m *Client) NewWriterWithContext(ctx context.Context, name string, metadata
 	}
 */
 func (m *Client) fetchFiles(f string) ([]os.FileInfo, error) {
-	folder := Concat(m.bucket, f)
+	folder := m.fullPath(f)
 	if folder == "" {
 		folder = "."
 	}
@@ -611,23 +777,14 @@ func (m *Client) fetchFiles(f string) ([]os.FileInfo, error) {
 		if err == os.ErrNotExist {
 			return nil, cloudstorage.ErrObjectNotFound
 		}
-		gou.WarnCtx(m.clientCtx, "failed to read directory %q with error: %v", m.bucket, err)
+		gou.WarnCtx(m.clientCtx, "failed to read directory %q with error: %v", folder, err)
 		return nil, err
 	}
 	return fi, nil
 }
 
-func (m *Client) filterFileNames(folder string, dirs, files, hidden bool) ([]string, error) {
-	fi, err := m.fetchFiles(folder)
-	if err != nil {
-		return nil, err
-	}
-
-	return filterFiles(fi, dirs, files, hidden), nil
-}
-
 func newObjectFromFile(c *Client, name string, f os.FileInfo) *object {
-	name = strings.TrimLeft(name, "/")
+	name = pathutil.CleanKey(name)
 	cf := cloudstorage.CachePathObj(c.cachepath, name, c.ID)
 	return &object{
 		client:    c,
@@ -642,7 +799,7 @@ func (o *object) upload(body io.Reader) (int64, error) {
 
 	o.client.ensureDir(o.name)
 
-	name := Concat(o.client.bucket, o.name)
+	name := o.client.fullPath(o.name)
 
 	//gou.Infof("upload %q", name)
 
@@ -674,6 +831,13 @@ func (o *object) upload(body io.Reader) (int64, error) {
 	wLength, err := f.ReadFrom(body)
 	if err != nil {
 		gou.Errorf("could not read file %v", err)
+		if o.client.concurrentWrites {
+			// concurrent writes may have landed past the failed one, don't
+			// leave a file with holes behind
+			if rerr := o.client.client.Remove(name); rerr != nil {
+				gou.Warnf("error removing partial upload %q %v", name, rerr)
+			}
+		}
 		return 0, err
 	}
 
@@ -733,7 +897,7 @@ func (o *object) Open(accesslevel cloudstorage.AccessLevel) (*os.File, error) {
 		//statinfo("new file statinfo", o.cachepath)
 	} else if o.fi != nil {
 		// existing file
-		get := Concat(o.client.bucket, o.name)
+		get := o.client.fullPath(o.name)
 		//gou.Debugf("existingfile, open %s", get)
 		f, err := o.client.client.Open(get)
 		if err != nil {
@@ -909,6 +1073,12 @@ func (o *object) MetaData() map[string]string {
 func (o *object) SetMetaData(meta map[string]string) {
 	//o.metadata = meta
 }
+func (o *object) Size() int64 {
+	if o.fi == nil {
+		return 0
+	}
+	return o.fi.Size()
+}
 func (o *object) StorageSource() string {
 	return StoreType
 }
@@ -920,7 +1090,7 @@ func (o *object) String() string {
 }
 func (o *object) Updated() time.Time {
 	if o.fi != nil {
-		return o.fi.ModTime()
+		return o.fi.ModTime().UTC()
 	}
 	return time.Time{}
 }
@@ -938,52 +1108,24 @@ func (a ByModTime) Less(i, j int) bool {
 	return ti.Before(tj)
 }
 
-func filterFiles(fi []os.FileInfo, dirs, files, hidden bool) []string {
-	var out []string
-	for _, f := range fi {
-		if f.IsDir() && !dirs {
-			continue
-		}
-		if !f.IsDir() && !files {
-			continue
-		}
-		name := f.Name()
-		if hidden || strings.Index(name, ".") != 0 {
-			out = append(out, name)
-		}
-	}
-	return out
-}
-
 // Concat concats strings with "/" but ignores empty strings
 // so an input of "portland", "", would yield "portland"
 // instead of "portland/"
+//
+// Deprecated: use pathutil.JoinKey.
 func Concat(strs ...string) string {
-	out := bytes.Buffer{}
-	for i, s := range strs {
-		if i == 0 {
-			out.WriteString(s)
-		} else if s != "" {
-			out.WriteByte('/')
-			out.WriteString(s)
-		}
-	}
-	return string(out.Bytes())
+	return pathutil.JoinKey(strs...)
 }
 
 // ConcatSlash concats strings and ensures ends with "/"
+//
+// Deprecated: use pathutil.JoinKey with a trailing "/".
 func ConcatSlash(strs ...string) string {
-	out := bytes.Buffer{}
-	for _, s := range strs {
-		if strings.HasSuffix(s, "/") {
-			out.WriteString(s)
-		} else {
-			out.WriteString(s)
-			out.WriteByte('/')
-		}
+	key := pathutil.JoinKey(strs...)
+	if !strings.HasSuffix(key, "/") {
+		key += "/"
 	}
-
-	return string(out.Bytes())
+	return key
 }
 
 // sftpAddr build sftp address
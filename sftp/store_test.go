@@ -96,3 +96,63 @@ func TestAll(t *testing.T) {
 	}
 	testutils.RunTests(t, store, config)
 }
+
+func TestSftpConfigValidate(t *testing.T) {
+	conf := &cloudstorage.Config{
+		Type:       sftp.StoreType,
+		AuthMethod: sftp.AuthUserPass,
+		TmpDir:     t.TempDir(),
+		Settings:   make(gou.JsonHelper),
+	}
+	conf.Settings[sftp.ConfKeyUser] = "user"
+	err := sftp.NewSftpConfig(conf).Validate()
+	require.Error(t, err)
+	cerr, ok := err.(*cloudstorage.ConfigError)
+	require.True(t, ok)
+	require.Equal(t, []string{"settings.host", "settings.port", "settings.password"}, cerr.Missing)
+
+	conf.Settings[sftp.ConfKeyHost] = "localhost"
+	conf.Settings[sftp.ConfKeyPort] = 22
+	conf.Settings[sftp.ConfKeyPassword] = "secret"
+	require.NoError(t, sftp.NewSftpConfig(conf).Validate())
+
+	conf.Settings[sftp.ConfKeyDialTimeout] = "30s"
+	conf.Settings[sftp.ConfKeyKeepAliveInterval] = "soon"
+	conf.Settings[sftp.ConfKeyTCPKeepAlive] = "-1s"
+	conf.Settings[sftp.ConfKeyJumpHost] = "bastion:2222"
+	conf.Settings[sftp.ConfKeyJumpPrivateKey] = "not a key"
+	err = sftp.NewSftpConfig(conf).Validate()
+	require.Error(t, err)
+	cerr = err.(*cloudstorage.ConfigError)
+	require.Equal(t, []string{
+		`settings.keepalive_interval="soon" is not a positive duration`,
+		`settings.tcp_keepalive="-1s" is not a positive duration`,
+		"settings.jump_privatekey is not a valid private key",
+	}, cerr.Invalid)
+
+	conf.Settings[sftp.ConfKeyKeepAliveInterval] = "15s"
+	conf.Settings[sftp.ConfKeyTCPKeepAlive] = "30s"
+	conf.Settings[sftp.ConfKeyJumpPrivateKey] = getKey()
+	require.NoError(t, sftp.NewSftpConfig(conf).Validate())
+
+	c := sftp.NewSftpConfig(conf)
+	require.True(t, c.ConcurrentReads)
+	require.False(t, c.ConcurrentWrites)
+	require.Equal(t, 0, c.MaxPacket)
+
+	conf.Settings[sftp.ConfKeyMaxPacket] = 262144
+	conf.Settings[sftp.ConfKeyConcurrentRequests] = "128"
+	conf.Settings[sftp.ConfKeyConcurrentReads] = "false"
+	conf.Settings[sftp.ConfKeyConcurrentWrites] = true
+	c = sftp.NewSftpConfig(conf)
+	require.NoError(t, c.Validate())
+	require.Equal(t, 262144, c.MaxPacket)
+	require.Equal(t, 128, c.ConcurrentRequests)
+	require.False(t, c.ConcurrentReads)
+	require.True(t, c.ConcurrentWrites)
+
+	conf.Settings[sftp.ConfKeyMaxPacket] = -1
+	err = sftp.NewSftpConfig(conf).Validate()
+	require.Error(t, err)
+	require.Equal(t, []string{"settings.max_packet=-1 must be positive"}, err.(*cloudstorage.ConfigError).Invalid)
+}
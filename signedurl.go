@@ -0,0 +1,30 @@
+package cloudstorage
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// SignedURL returns a url giving anyone holding it method (http.MethodGet
+// or http.MethodPut) access to object name for expires, on stores
+// implementing StoreSigner, others return ErrNotImplemented.  The object
+// isn't checked, urls can be signed for objects to be uploaded.
+//
+// s3 presigns the request with the store's credentials, gcs signs a V4 url
+// with the service account of its credentials.
+func SignedURL(ctx context.Context, s Store, name, method string, expires time.Duration) (string, error) {
+	switch method {
+	case "":
+		method = http.MethodGet
+	case http.MethodGet, http.MethodPut:
+	default:
+		return "", fmt.Errorf("unsupported signed url method %q", method)
+	}
+	if sg, ok := s.(StoreSigner); ok {
+		return sg.SignedURL(ctx, name, method, expires)
+	}
+	return "", ErrNotImplemented
+}
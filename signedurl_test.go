@@ -0,0 +1,23 @@
+package cloudstorage_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/mockstore"
+)
+
+func TestSignedURL(t *testing.T) {
+	ctx := context.Background()
+	store := mockstore.New()
+	_, err := cloudstorage.SignedURL(ctx, store, "a.csv", "", time.Hour)
+	require.Equal(t, cloudstorage.ErrNotImplemented, err)
+
+	_, err = cloudstorage.SignedURL(ctx, store, "a.csv", "DELETE", time.Hour)
+	require.Error(t, err)
+	require.NotEqual(t, cloudstorage.ErrNotImplemented, err)
+}
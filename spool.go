@@ -0,0 +1,368 @@
+package cloudstorage
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/araddon/gou"
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/net/context"
+)
+
+// SpoolDoneSuffix is appended to the name of an uploaded file for its done
+// marker, the object (with Spooler.DoneMarkers) or local file (with
+// SpoolKeep) written once the upload completed.
+const SpoolDoneSuffix = ".done"
+
+// SpoolAction is what a Spooler does with the local files it uploaded.
+type SpoolAction int
+
+const (
+	// SpoolKeep leaves uploaded files in place, a local done marker keeps
+	// them from being uploaded again.
+	SpoolKeep SpoolAction = iota
+	// SpoolRemove deletes uploaded files.
+	SpoolRemove
+	// SpoolArchive moves uploaded files to the ArchiveDir.
+	SpoolArchive
+)
+
+// Spooler watches a local spool directory and uploads the files written to
+// it to a Store.  Producers should write files elsewhere, or under a name
+// matched by Exclude, and rename them into the directory once complete, the
+// Settle time catches those that don't.
+//
+// The directory is scanned every Interval and whenever Notify is called,
+// which Watch does on the file system events of the directory.
+type Spooler struct {
+	Store Store
+	// Dir is the spool directory, files below it are uploaded as objects
+	// named Prefix + the slash separated path relative to Dir.
+	Dir    string
+	Prefix string
+	// Interval between scans of Dir, 0 is DefaultSpoolInterval.
+	Interval time.Duration
+	// Watch has Run follow the file system events (fsnotify) of Dir and
+	// its directories too, scanning on them and again once the changed
+	// files could have settled, rather than only every Interval.  Run
+	// fails if Dir can't be watched.
+	Watch bool
+	// Settle is the time a file must go unmodified to be uploaded.
+	Settle time.Duration
+	// Include and Exclude are glob patterns of the files to upload, as in
+	// UploadOpts.  Hidden files are never uploaded.
+	Include []string
+	Exclude []string
+	// Concurrency is the number of files uploaded at once, 0 or 1 uploads
+	// serially.
+	Concurrency int
+	// Retries of an upload failing with a transient error (see
+	// IsTransient) before it's left for the next scan, with RetryDelay
+	// doubling between tries (0 is a second).
+	Retries    int
+	RetryDelay time.Duration
+	// DoneMarkers writes an empty name + SpoolDoneSuffix object after each
+	// upload, so consumers of the store only pick up complete objects.
+	DoneMarkers bool
+	// After is what is done with the uploaded files, ArchiveDir is where
+	// SpoolArchive moves them to.
+	After      SpoolAction
+	ArchiveDir string
+	// OnUpload and OnError, if set, are called for each file uploaded, or
+	// failing to, from the goroutines uploading them.
+	OnUpload func(UploadedObject)
+	OnError  func(localPath string, err error)
+
+	notify chan struct{}
+	once   sync.Once
+}
+
+// DefaultSpoolInterval is the time between scans of a Spooler's directory.
+var DefaultSpoolInterval = 10 * time.Second
+
+// NewSpooler uploads the files of dir to store, named prefix + their
+// relative path.
+func NewSpooler(store Store, dir, prefix string) *Spooler {
+	return &Spooler{Store: store, Dir: dir, Prefix: prefix}
+}
+
+func (s *Spooler) init() {
+	s.once.Do(func() { s.notify = make(chan struct{}, 1) })
+}
+
+// Notify the running Spooler files changed, a scan follows.  It doesn't
+// block.
+func (s *Spooler) Notify() {
+	s.init()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Run scans the spool directory every Interval, and on Notify, until ctx
+// is done.  Failed scans are logged and retried at the next one.
+func (s *Spooler) Run(ctx context.Context) error {
+	s.init()
+	if err := s.validate(); err != nil {
+		return err
+	}
+	if s.Watch {
+		stop, err := s.watch()
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
+	interval := s.Interval
+	if interval <= 0 {
+		interval = DefaultSpoolInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.Scan(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			gou.Warnf("cloudstorage: spool scan of %s: %v", s.Dir, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case <-s.notify:
+		}
+	}
+}
+
+// watch calls Notify on the events of the spool directory, and a Settle
+// after the last of them, until stop is called.  Directories created in it
+// are watched too.
+func (s *Spooler) watch() (stop func(), err error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	add := func(dir string) error {
+		return filepath.WalkDir(dir, func(fpath string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && fpath != s.Dir {
+					return nil
+				}
+				return err
+			}
+			if !d.IsDir() {
+				return nil
+			}
+			if fpath != s.Dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return w.Add(fpath)
+		})
+	}
+	if err := add(s.Dir); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	settled := time.AfterFunc(time.Hour, s.Notify)
+	settled.Stop()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if ev.Op&fsnotify.Create != 0 {
+					if fi, err := os.Stat(ev.Name); err == nil && fi.IsDir() {
+						if err := add(ev.Name); err != nil {
+							gou.Warnf("cloudstorage: spool watch of %s: %v", ev.Name, err)
+						}
+					}
+				}
+				s.Notify()
+				if s.Settle > 0 {
+					settled.Reset(s.Settle)
+				}
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				gou.Warnf("cloudstorage: spool watch of %s: %v", s.Dir, err)
+			}
+		}
+	}()
+	return func() {
+		w.Close()
+		<-done
+		settled.Stop()
+	}, nil
+}
+
+func (s *Spooler) validate() error {
+	if s.Store == nil || s.Dir == "" {
+		return fmt.Errorf("invalid spooler: a store and directory are required")
+	}
+	if s.After == SpoolArchive && s.ArchiveDir == "" {
+		return fmt.Errorf("invalid spooler: SpoolArchive requires an ArchiveDir")
+	}
+	for _, pattern := range append(s.Include, s.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("bad pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Scan uploads the settled files of the spool directory once, returning
+// them sorted by name.  Files failing to upload are skipped, the first of
+// their errors is returned.
+func (s *Spooler) Scan(ctx context.Context) ([]UploadedObject, error) {
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	files, err := s.pending()
+	if err != nil {
+		return nil, err
+	}
+
+	concurrency := s.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+		manifest []UploadedObject
+	)
+	sem := make(chan struct{}, concurrency)
+	for _, rel := range files {
+		if err := ctx.Err(); err != nil {
+			break
+		}
+		rel := rel
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			uo, err := s.upload(ctx, rel)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if s.OnError != nil {
+					s.OnError(filepath.Join(s.Dir, rel), err)
+				}
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			if s.OnUpload != nil {
+				s.OnUpload(*uo)
+			}
+			manifest = append(manifest, *uo)
+		}()
+	}
+	wg.Wait()
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	sort.Slice(manifest, func(i, j int) bool { return manifest[i].Name < manifest[j].Name })
+	return manifest, firstErr
+}
+
+// pending are the relative paths of the settled files left to upload.
+func (s *Spooler) pending() ([]string, error) {
+	settled := time.Now().Add(-s.Settle)
+	opts := UploadOpts{Include: s.Include, Exclude: s.Exclude}
+	var files []string
+	err := filepath.WalkDir(s.Dir, func(fpath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && fpath != s.Dir {
+				// removed while scanning
+				return nil
+			}
+			return err
+		}
+		if fpath != s.Dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || strings.HasSuffix(fpath, SpoolDoneSuffix) {
+			return nil
+		}
+		rel, err := filepath.Rel(s.Dir, fpath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !uploadIncluded(rel, opts) || Exists(fpath+SpoolDoneSuffix) {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil || fi.ModTime().After(settled) {
+			return nil
+		}
+		files = append(files, rel)
+		return nil
+	})
+	return files, err
+}
+
+// upload the file at rel with retries, marking it done.
+func (s *Spooler) upload(ctx context.Context, rel string) (*UploadedObject, error) {
+	fpath := filepath.Join(s.Dir, filepath.FromSlash(rel))
+	name := s.Prefix + rel
+	delay := s.RetryDelay
+	if delay <= 0 {
+		delay = time.Second
+	}
+	var uo *UploadedObject
+	var err error
+	for try := 0; ; try++ {
+		if uo, err = uploadFile(ctx, s.Store, fpath, name); err == nil && s.DoneMarkers {
+			err = WriteAll(ctx, s.Store, name+SpoolDoneSuffix, nil, nil)
+		}
+		if try >= s.Retries || !retryable(ctx, s.Store, err) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay << try):
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return uo, s.finish(fpath, rel)
+}
+
+// finish does the After action to the uploaded file.
+func (s *Spooler) finish(fpath, rel string) error {
+	switch s.After {
+	case SpoolRemove:
+		return os.Remove(fpath)
+	case SpoolArchive:
+		dst := filepath.Join(s.ArchiveDir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(dst), 0775); err != nil {
+			return err
+		}
+		return os.Rename(fpath, dst)
+	default:
+		return os.WriteFile(fpath+SpoolDoneSuffix, nil, 0664)
+	}
+}
@@ -0,0 +1,163 @@
+package cloudstorage_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/mockstore"
+)
+
+func writeSpoolFile(t *testing.T, dir, rel, data string, age time.Duration) {
+	fpath := filepath.Join(dir, filepath.FromSlash(rel))
+	require.NoError(t, os.MkdirAll(filepath.Dir(fpath), 0775))
+	require.NoError(t, os.WriteFile(fpath, []byte(data), 0664))
+	mtime := time.Now().Add(-age)
+	require.NoError(t, os.Chtimes(fpath, mtime, mtime))
+}
+
+func TestSpoolerScan(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := mockstore.New()
+	store.TmpDir = t.TempDir()
+
+	writeSpoolFile(t, dir, "a.csv", "a,b\n", time.Minute)
+	writeSpoolFile(t, dir, "day/b.json", `{"b":1}`, time.Minute)
+	writeSpoolFile(t, dir, "c.csv", "still writing", 0)
+	writeSpoolFile(t, dir, "d.csv.tmp", "tmp", time.Minute)
+	writeSpoolFile(t, dir, ".hidden/e.csv", "e", time.Minute)
+
+	s := cloudstorage.NewSpooler(store, dir, "in/")
+	s.Settle = 10 * time.Second
+	s.Exclude = []string{"*.tmp"}
+	s.DoneMarkers = true
+	var uploaded []string
+	s.OnUpload = func(uo cloudstorage.UploadedObject) { uploaded = append(uploaded, uo.Name) }
+
+	manifest, err := s.Scan(ctx)
+	require.NoError(t, err)
+	require.Len(t, manifest, 2)
+	require.Equal(t, "in/a.csv", manifest[0].Name)
+	require.Equal(t, "in/day/b.json", manifest[1].Name)
+	require.Equal(t, "application/json", manifest[1].ContentType)
+	require.ElementsMatch(t, []string{"in/a.csv", "in/day/b.json"}, uploaded)
+	data, ok := store.Data("in/a.csv")
+	require.True(t, ok)
+	require.Equal(t, "a,b\n", string(data))
+	_, ok = store.Data("in/a.csv" + cloudstorage.SpoolDoneSuffix)
+	require.True(t, ok, "done marker")
+	require.FileExists(t, filepath.Join(dir, "a.csv"+cloudstorage.SpoolDoneSuffix))
+
+	// kept files aren't uploaded again, settled ones are
+	writeSpoolFile(t, dir, "c.csv", "c\n", time.Minute)
+	manifest, err = s.Scan(ctx)
+	require.NoError(t, err)
+	require.Len(t, manifest, 1)
+	require.Equal(t, "in/c.csv", manifest[0].Name)
+}
+
+func TestSpoolerRetryAndArchive(t *testing.T) {
+	ctx := context.Background()
+	dir, archive := t.TempDir(), t.TempDir()
+	store := mockstore.New()
+	store.TmpDir = t.TempDir()
+	writeSpoolFile(t, dir, "x/a.csv", "a\n", time.Minute)
+	writeSpoolFile(t, dir, "b.csv", "b\n", time.Minute)
+
+	errQuota := errors.New("quota exceeded")
+	store.Fail("NewWriter", "out/x/a.csv", errQuota, 2)
+	store.Fail("NewWriter", "out/b.csv", errQuota, 0)
+
+	s := cloudstorage.NewSpooler(store, dir, "out/")
+	s.Retries = 2
+	s.RetryDelay = time.Millisecond
+	s.Concurrency = 2
+	s.After = cloudstorage.SpoolArchive
+	s.ArchiveDir = archive
+	var failed []string
+	s.OnError = func(localPath string, err error) { failed = append(failed, localPath) }
+
+	manifest, err := s.Scan(ctx)
+	require.ErrorIs(t, err, errQuota)
+	require.Len(t, manifest, 1)
+	require.Equal(t, "out/x/a.csv", manifest[0].Name)
+	require.Equal(t, []string{filepath.Join(dir, "b.csv")}, failed)
+	require.FileExists(t, filepath.Join(archive, "x", "a.csv"))
+	require.NoFileExists(t, filepath.Join(dir, "x", "a.csv"))
+	require.FileExists(t, filepath.Join(dir, "b.csv"), "failed files are left for the next scan")
+
+	s.After = cloudstorage.SpoolArchive
+	s.ArchiveDir = ""
+	_, err = s.Scan(ctx)
+	require.Error(t, err)
+}
+
+func TestSpoolerRun(t *testing.T) {
+	dir := t.TempDir()
+	store := mockstore.New()
+	store.TmpDir = t.TempDir()
+
+	s := cloudstorage.NewSpooler(store, dir, "")
+	s.Interval = time.Hour
+	s.After = cloudstorage.SpoolRemove
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	writeSpoolFile(t, dir, "a.csv", "a\n", time.Minute)
+	s.Notify()
+	require.Eventually(t, func() bool {
+		_, ok := store.Data("a.csv")
+		return ok
+	}, 5*time.Second, time.Millisecond)
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(dir, "a.csv"))
+		return os.IsNotExist(err)
+	}, 5*time.Second, time.Millisecond)
+
+	cancel()
+	require.Equal(t, context.Canceled, <-done)
+}
+
+func TestSpoolerWatch(t *testing.T) {
+	dir := t.TempDir()
+	store := mockstore.New()
+	store.TmpDir = t.TempDir()
+
+	s := cloudstorage.NewSpooler(store, dir, "")
+	s.Interval = time.Hour
+	s.Settle = 50 * time.Millisecond
+	s.Watch = true
+	s.After = cloudstorage.SpoolRemove
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	// files written after the first scan are picked up from their events,
+	// once settled, without a Notify
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "x"), 0775))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.csv"), []byte("a\n"), 0664))
+	require.Eventually(t, func() bool {
+		_, ok := store.Data("a.csv")
+		return ok
+	}, 5*time.Second, time.Millisecond)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "x", "b.csv"), []byte("b\n"), 0664))
+	require.Eventually(t, func() bool {
+		_, ok := store.Data("x/b.csv")
+		return ok
+	}, 5*time.Second, time.Millisecond)
+
+	cancel()
+	require.Equal(t, context.Canceled, <-done)
+
+	s.Dir = filepath.Join(dir, "missing")
+	require.Error(t, s.Run(context.Background()))
+}
@@ -2,6 +2,7 @@ package cloudstorage
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -17,9 +18,18 @@ const (
 	StoreCacheFileExt = ".cache"
 	// ContentTypeKey
 	ContentTypeKey = "content_type"
+	// ContentLengthKey metadata key of the object size in bytes some stores
+	// (gcs) set, see SizeOf.
+	ContentLengthKey = "content_length"
 	// MaxResults default number of objects to retrieve during a list-objects request,
 	// if more objects exist, then they will need to be paged
 	MaxResults = 3000
+
+	// HashMD5 is the ObjectHasher key of hex encoded md5 digests.
+	HashMD5 = "md5"
+	// HashCRC32C is the ObjectHasher key of hex encoded (big-endian) crc32c
+	// checksums.
+	HashCRC32C = "crc32c"
 )
 
 // AccessLevel is the level of permissions on files
@@ -38,12 +48,81 @@ var (
 	ErrObjectExists = fmt.Errorf("object already exists in backing store (use store.Get)")
 	// ErrNotImplemented this feature is not implemented for this store
 	ErrNotImplemented = fmt.Errorf("Not implemented")
+	// ErrNotModified the object still has the Opts.IfNoneMatch etag.
+	ErrNotModified = fmt.Errorf("object not modified")
+	// ErrLeaseHeld another holder has an unexpired lease on the object.
+	ErrLeaseHeld = fmt.Errorf("lease is held by another owner")
+	// ErrLeaseLost the lease expired and was taken, or released, so it can
+	// no longer be renewed.
+	ErrLeaseLost = fmt.Errorf("lease was lost")
+	// ErrPreconditionFailed the object no longer matches Opts.IfMatch or
+	// Opts.VersionID.
+	ErrPreconditionFailed = fmt.Errorf("object precondition failed")
+	// ErrInvalidMetadata metadata not every store can write and read back
+	// as is, see NormalizeMetadata.
+	ErrInvalidMetadata = fmt.Errorf("invalid metadata")
+	// ErrWriteOnly reading an Opts.WriteThrough object, or writing it after
+	// its upload was finished.
+	ErrWriteOnly = fmt.Errorf("write-through object can only be written once")
 )
 
 type (
 	Opts struct {
 		IfNotExists        bool
 		DisableCompression bool
+		// ChunkSize (gcs only) overrides the store's upload chunk size for this
+		// writer.  Each writer buffers up to ChunkSize bytes in memory. 0 uses
+		// the store default, a negative value disables chunking and uploads the
+		// object in a single request (best for small objects).
+		ChunkSize int
+		// ChunkRetryDeadline (gcs only) overrides the per-chunk retry deadline
+		// for this writer.  0 uses the store default.
+		ChunkRetryDeadline time.Duration
+		// EncryptionKey (gcs only) is a customer-supplied AES-256 key (32 bytes)
+		// used to encrypt the object on write and decrypt it on read, overriding
+		// the store's key.  GetWithOpts, Copy and Move use it for both
+		// objects.
+		EncryptionKey []byte
+		// IfNoneMatch (gcs, s3, azure only) is a previously seen ETag of the
+		// object (see ObjectETagger, gcs also takes the generation), readers
+		// return ErrNotModified if the object hasn't changed since.
+		IfNoneMatch string
+		// IfMatch (gcs, s3, azure only) is the ETag (gcs also takes the
+		// generation) the object must still have for Delete to remove it,
+		// otherwise ErrPreconditionFailed is returned.
+		IfMatch string
+		// VersionID (gcs, s3 only) is the generation (gcs) or version id (s3)
+		// Delete removes, on gcs the delete fails with ErrPreconditionFailed
+		// if it is no longer the live generation.
+		VersionID string
+		// Overwrite makes NewObject return the existing object rather than
+		// ErrObjectExists, Open(ReadWrite) then holds its current content
+		// so the object can be upserted without a Get first.
+		Overwrite bool
+		// WriteThrough makes NewObject return an object written straight
+		// to the store's writer, without a local cached copy.  It starts
+		// empty, isn't readable and Sync or Close finish the upload, see
+		// NewWriteThroughObject.
+		WriteThrough bool
+		// Stream makes GetWithOpts, and NewObject with Overwrite (gcs, ftp
+		// and mockstore only), return an object read straight from the
+		// store rather than from the cached copy Open downloads, see
+		// NewStreamObject.
+		Stream bool
+		// CustomTime (gcs only) of the written object, for lifecycle rules
+		// on days since the custom time.  It can't be moved back once set.
+		CustomTime time.Time
+		// TemporaryHold (gcs only) places a temporary hold on the written
+		// object, it can't be deleted or overwritten until it is released.
+		TemporaryHold bool
+		// EventBasedHold (gcs only) places an event-based hold on the
+		// written object, its bucket retention period starts when the
+		// hold is released.
+		EventBasedHold bool
+		// CannedACL (s3 only) of the written object, ie
+		// "bucket-owner-full-control", overriding the store's canned_acl
+		// setting.
+		CannedACL string
 	}
 
 	// StoreReader interface to define the Storage Interface abstracting
@@ -55,7 +134,7 @@ type (
 		Client() interface{}
 		// Get returns an object (file) from the cloud store. The object
 		// isn't opened already, see Object.Open()
-		// ObjectNotFound will be returned if the object is not found.
+		// ErrObjectNotFound will be returned if the object is not found.
 		Get(ctx context.Context, o string) (Object, error)
 		// Objects returns an object Iterator to allow paging through object
 		// which keeps track of page cursors.  Query defines the specific set
@@ -64,8 +143,12 @@ type (
 		// List file/objects filter by given query.  This just wraps the object-iterator
 		// returning full list of objects.
 		List(ctx context.Context, q Query) (*ObjectsResponse, error)
-		// Folders creates list of folders
+		// Folders creates list of folders, it drains FolderIterator so
+		// prefer that for buckets with very many folders.
 		Folders(ctx context.Context, q Query) ([]string, error)
+		// FolderIterator returns a folder Iterator to allow paging through
+		// the folders directly below the Query prefix.
+		FolderIterator(ctx context.Context, q Query) (FolderIterator, error)
 		// NewReader creates a new Reader to read the contents of the object.
 		// ErrObjectNotFound will be returned if the object is not found.
 		NewReader(o string) (io.ReadCloser, error)
@@ -75,20 +158,204 @@ type (
 		String() string
 	}
 
+	// StoreReaderWithOpts Optional interface for stores honoring per call
+	// Opts (ie EncryptionKey, IfNoneMatch) when reading, see
+	// NewReaderWithOpts.
+	StoreReaderWithOpts interface {
+		// NewReaderWithOpts is NewReaderWithContext with opts.
+		NewReaderWithOpts(ctx context.Context, o string, opts ...Opts) (io.ReadCloser, error)
+	}
+
+	// StoreGetWithOpts Optional interface for stores honoring per call Opts
+	// (ie EncryptionKey) when getting objects, see GetWithOpts.  The
+	// objects keep using the opts when opened.
+	StoreGetWithOpts interface {
+		// GetWithOpts is Get with opts.
+		GetWithOpts(ctx context.Context, o string, opts ...Opts) (Object, error)
+	}
+
 	// StoreCopy Optional interface to fast path copy.  Many of the cloud providers
 	// don't actually copy bytes.  Rather they allow a "pointer" that is a fast copy.
+	// Returning ErrNotImplemented (wrapped or not) makes Copy stream the object.
 	StoreCopy interface {
 		// Copy from object, to object
 		Copy(ctx context.Context, src, dst Object) error
 	}
 
+	// StoreCopyWithOpts Optional interface for StoreCopy stores honoring per
+	// call Opts (ie EncryptionKey) in the fast path, see Copy.
+	StoreCopyWithOpts interface {
+		// CopyWithOpts is Copy with opts.
+		CopyWithOpts(ctx context.Context, src, dst Object, opts ...Opts) error
+	}
+
 	// StoreMove Optional interface to fast path move.  Many of the cloud providers
-	// don't actually copy bytes.
+	// don't actually copy bytes.  Returning ErrNotImplemented (wrapped or not)
+	// makes Move stream the object and delete the source.
 	StoreMove interface {
 		// Move from object location, to object location.
 		Move(ctx context.Context, src, dst Object) error
 	}
 
+	// StoreMoveWithOpts Optional interface for StoreMove stores honoring per
+	// call Opts (ie EncryptionKey) in the fast path, see Move.
+	StoreMoveWithOpts interface {
+		// MoveWithOpts is Move with opts.
+		MoveWithOpts(ctx context.Context, src, dst Object, opts ...Opts) error
+	}
+
+	// StorePut Optional interface for stores with a native way to atomically
+	// replace an object's content, used by Put.
+	StorePut interface {
+		Put(ctx context.Context, name string, r io.Reader, metadata map[string]string, opts ...Opts) error
+	}
+
+	// StoreComposer Optional interface for stores that concatenate objects
+	// server side, used by Compose.  Returning ErrNotImplemented (wrapped or
+	// not) makes Compose fall back to streaming the sources.
+	StoreComposer interface {
+		Compose(ctx context.Context, dst string, srcs []string) error
+	}
+
+	// StoreRangeReader Optional interface for stores reading byte ranges of
+	// objects, used by NewReaderAt.
+	StoreRangeReader interface {
+		// NewRangeReader reads length bytes of object name from offset, to
+		// the end of the object if length is negative.
+		NewRangeReader(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error)
+	}
+
+	// StoreErrorClassifier Optional interface for stores telling the errors
+	// a retry may fix from the ones it can't, used by the retry loops, see
+	// IsTransient.
+	StoreErrorClassifier interface {
+		// IsTransient is true for throttling, 5xx and network errors, false
+		// for errors such as a denied permission or a missing bucket.
+		IsTransient(err error) bool
+	}
+
+	// StoreBackoff Optional interface for stores with their own delays
+	// between retries, see BackoffProfileOf.
+	StoreBackoff interface {
+		BackoffProfile() BackoffProfile
+	}
+
+	// StoreTimestamps Optional interface for stores reporting the resolution
+	// of Object.Updated, see UpdatedGranularity.
+	StoreTimestamps interface {
+		// UpdatedGranularity is the resolution updated times are kept with.
+		UpdatedGranularity() time.Duration
+	}
+
+	// StoreCapabilities Optional interface for stores reporting their
+	// Capabilities, see CapabilitiesOf.
+	StoreCapabilities interface {
+		Capabilities() Capabilities
+	}
+
+	// StoreCacheCleaner Optional interface for stores keeping local cache
+	// files below Config.TmpDir, see CleanCache.
+	StoreCacheCleaner interface {
+		// CleanCache removes the caches of crashed stores sharing this
+		// store's TmpDir and cache files older than olderThan.
+		CleanCache(ctx context.Context, olderThan time.Duration) error
+	}
+
+	// StoreCachePath Optional interface for stores keeping local files in
+	// a cache directory of their own, see CacheDir.  Put spools to it
+	// rather than os.TempDir().
+	StoreCachePath interface {
+		// CachePath is the cache directory of the store.
+		CachePath() string
+	}
+
+	// ObjectSizer Optional interface for objects that know their size in
+	// bytes from the listing (or Get) without a further request.
+	ObjectSizer interface {
+		// Size of the object in the store when it was listed.
+		Size() int64
+	}
+
+	// ObjectETagger Optional interface for objects that know their ETag, a
+	// token changing whenever the object content changes.
+	ObjectETagger interface {
+		// ETag of the object when it was listed, without quotes.
+		ETag() string
+	}
+
+	// ObjectRecycler Optional interface for stores reusing the objects of
+	// their List pages, see Query.Reuse.  NewObjectPageIterator recycles
+	// each page of a Reuse listing once it moves on to the next.
+	ObjectRecycler interface {
+		// Recycle the objects of a List page, the caller doesn't use them
+		// afterwards.
+		Recycle(objects Objects)
+	}
+
+	// ObjectAttributer Optional interface for objects reporting the
+	// attributes the provider keeps of them, see AttrsOf.
+	ObjectAttributer interface {
+		// Attrs of the object when it was listed or fetched.
+		Attrs() ObjectAttributes
+	}
+
+	// ResultWriter Optional interface for the writers of NewWriterWithContext
+	// reporting the object they created, every store's writers implement it.
+	ResultWriter interface {
+		io.WriteCloser
+		// Result of the upload, only complete after Close returned nil.
+		Result() UploadResult
+	}
+
+	// ObjectHasher Optional interface for objects whose content hashes are
+	// reported by the store, see Query.IncludeHashes.
+	ObjectHasher interface {
+		// Hashes are hex encoded digests by algorithm (HashMD5, HashCRC32C),
+		// only the ones the store knows are included.
+		Hashes() map[string]string
+	}
+
+	// TaggedStore Optional interface for stores that can tag objects, ie for
+	// cost-allocation or retention rules.  s3 uses native object tagging,
+	// gcs, azure and localfs keep the tags in metadata (TagsMetadataKey).
+	TaggedStore interface {
+		// GetTags of the object.
+		GetTags(ctx context.Context, name string) (map[string]string, error)
+		// SetTags replaces all the tags of the object.
+		SetTags(ctx context.Context, name string, tags map[string]string) error
+	}
+
+	// StoreACLSetter Optional interface for stores that can make an object
+	// public or private, see SetObjectACL.
+	StoreACLSetter interface {
+		SetObjectACL(ctx context.Context, name string, acl ACL) error
+	}
+
+	// StoreSigner Optional interface for stores that can sign urls giving
+	// temporary access to an object, see SignedURL.
+	StoreSigner interface {
+		SignedURL(ctx context.Context, name, method string, expires time.Duration) (string, error)
+	}
+
+	// StoreLeaser Optional interface for stores that can lease an object
+	// name, so coordinating workers can claim it.  See AcquireLease.
+	StoreLeaser interface {
+		// AcquireLease claims name for ttl, returning ErrLeaseHeld if another
+		// owner holds an unexpired lease.  The object need not exist.
+		AcquireLease(ctx context.Context, name string, ttl time.Duration) (Lease, error)
+	}
+
+	// Lease is a claim on an object name held until it expires or is released.
+	Lease interface {
+		// ID of the lease.
+		ID() string
+		// Renew extends the lease by its ttl, ErrLeaseLost is returned if
+		// it expired and was taken by another owner.
+		Renew(ctx context.Context) error
+		// Release gives up the lease.
+		Release(ctx context.Context) error
+	}
+
 	// Store interface to define the Storage Interface abstracting
 	// the GCS, S3, LocalFile interfaces
 	Store interface {
@@ -108,10 +375,15 @@ type (
 		// NewObject creates a new empty object backed by the cloud store
 		// This new object isn't' synced/created in the backing store
 		// until the object is Closed/Sync'ed.
-		NewObject(o string) (Object, error)
-
-		// Delete removes the object from the cloud store.
-		Delete(ctx context.Context, o string) error
+		// By default (create only) ErrObjectExists is returned if the object
+		// exists, with Opts.Overwrite the existing object is returned instead
+		// ready to be opened for writing.
+		NewObject(o string, opts ...Opts) (Object, error)
+
+		// Delete removes the object from the cloud store.  Opts.IfMatch and
+		// Opts.VersionID make it conditional, stores without preconditions
+		// (the file system ones) ignore them.
+		Delete(ctx context.Context, o string, opts ...Opts) error
 	}
 
 	// Object is a handle to a cloud stored file/object.  Calling Open will pull the remote file onto
@@ -122,7 +394,7 @@ type (
 		Name() string
 		// String is default descriptor.
 		String() string
-		// Updated timestamp.
+		// Updated timestamp, in UTC.
 		Updated() time.Time
 		// MetaData is map of arbitrary name/value pairs about object.
 		MetaData() map[string]string
@@ -134,7 +406,8 @@ type (
 		DisableCompression()
 		// Open copies the remote file to a local cache and opens the cached version
 		// for read/writing.  Calling Close/Sync will push the copy back to the
-		// backing store.
+		// backing store.  To read without a cached copy use OpenStream, or
+		// get the object with Opts.Stream.
 		Open(readonly AccessLevel) (*os.File, error)
 		// Release will remove the locally cached copy of the file.  You most call Close
 		// before releasing.  Release will call os.Remove(local_copy_file) so opened
@@ -161,9 +434,32 @@ type (
 		Close()
 	}
 
+	// ResumableIterator Optional interface for ObjectIterators that can be
+	// checkpointed and resumed, ie after a restart, NewObjectPageIterator's
+	// iterators implement it.
+	ResumableIterator interface {
+		ObjectIterator
+		// Cursor of the position after the last object returned by Next.
+		Cursor() string
+		// Resume iterating after the position of the Cursor of an iterator
+		// of the same store and query.
+		Resume(cursor string) error
+	}
+
+	// FolderIterator interface to page through folders (common prefixes)
+	FolderIterator interface {
+		// Next gets next folder, returns google.golang.org/api/iterator iterator.Done error.
+		Next() (string, error)
+		// Close this down (and or context.Close)
+		Close()
+	}
+
 	// ObjectsResponse for paged object apis.
 	ObjectsResponse struct {
-		Objects    Objects
+		Objects Objects
+		// Prefixes are the common prefixes (sub-folders) found when listing
+		// with a Query.Delimiter, ie "photos/2023/" for prefix "photos/".
+		Prefixes   []string
 		NextMarker string
 	}
 	// Objects are just a collection of Object(s).
@@ -212,6 +508,23 @@ type (
 		// EnableCompression turns on transparent compression of objects
 		// Reading pre-existing non-compressed objects continues to work
 		EnableCompression bool `json:"enablecompression,omitempty"`
+		// CompressionCodec of EnableCompression, gzip (the default), zstd or
+		// snappy.  Objects of any codec are decompressed on read.
+		CompressionCodec string `json:"compressioncodec,omitempty"`
+		// CompressionLevel of the codec, 0 is the codec's default.
+		CompressionLevel int `json:"compressionlevel,omitempty"`
+		// ListTimeout, ReadTimeout and WriteTimeout bound the List/Folders,
+		// Get/NewReader and NewWriter/Delete calls of a store when the
+		// caller's context has no deadline, so a hung endpoint can't stall a
+		// job forever.  Readers and writers are bounded until closed.
+		// They are applied by the gcs, s3 and sftp stores, 0 is no timeout.
+		ListTimeout  time.Duration `json:"listtimeout,omitempty"`
+		ReadTimeout  time.Duration `json:"readtimeout,omitempty"`
+		WriteTimeout time.Duration `json:"writetimeout,omitempty"`
+		// KeyEncoder, if set, maps the object names used with the store to
+		// the keys it keeps, ie SafeKeyEncoder for names from user input or
+		// with characters some stores can't keep.  See NewKeyEncodedStore.
+		KeyEncoder KeyEncoder `json:"-"`
 	}
 
 	// JwtConf For use with google/google_jwttransporter.go
@@ -248,6 +561,9 @@ func NewStore(conf *Config) (Store, error) {
 	if !ok {
 		return nil, fmt.Errorf("config.Type=%q was not found", conf.Type)
 	}
+	if err := checkAuthProvider(conf); err != nil {
+		return nil, err
+	}
 
 	if conf.PageSize == 0 {
 		conf.PageSize = MaxResults
@@ -256,54 +572,232 @@ func NewStore(conf *Config) (Store, error) {
 	if conf.TmpDir == "" {
 		conf.TmpDir = os.TempDir()
 	}
-	return st(conf)
+	s, err := st(conf)
+	if err != nil || conf.KeyEncoder == nil {
+		return s, err
+	}
+	return NewKeyEncodedStore(s, conf.KeyEncoder), nil
+}
+
+// Copy source to destination, opts are used to read src and write des.
+func Copy(ctx context.Context, s Store, src, des Object, opts ...Opts) error {
+	return CopyWithProgress(ctx, s, src, des, nil, opts...)
 }
 
-// Copy source to destination.
-func Copy(ctx context.Context, s Store, src, des Object) error {
+// CopyWithProgress copies source to destination like Copy, calling progress
+// (if not nil) with the number of bytes copied so far as the bytes are
+// relayed.  A server side copy (see StoreCopy) reports no progress.  opts
+// are used to read src and write des, see StoreCopyWithOpts.
+func CopyWithProgress(ctx context.Context, s Store, src, des Object, progress func(copied int64), opts ...Opts) error {
 	// for Providers that offer fast path, and use the backend copier
 	if src.StorageSource() == des.StorageSource() {
-		if cp, ok := s.(StoreCopy); ok {
-			return cp.Copy(ctx, src, des)
+		if err := fastCopy(ctx, s, src, des, opts); !errors.Is(err, ErrNotImplemented) {
+			return err
+		}
+	}
+
+	// Slow path, stream an io.Reader from the source into an io.Writer to the
+	// destination, without local cache files.  This is considered a "slow
+	// path" because we have to act as a broker to relay bytes between the two
+	// objects.  Some stores support moving data using an API call.  A failed
+	// copy is retried from the start, progress starts over from 0.
+	bo := NewBackoffer(BackoffProfileOf(s))
+	var err error
+	for try := 0; try < Retries; try++ {
+		if try > 0 && !bo.Wait(ctx) {
+			break
 		}
+		err = streamCopy(ctx, s, src, des, progress, opts)
+		if !retryable(ctx, s, err) {
+			return err
+		}
+		gou.Warnf("Copy of %v to %v failed, try=%d err=%v", src.Name(), des.Name(), try, err)
 	}
+	return err
+}
 
-	// Slow path, open an io.Reader from the source and copy it to an
-	// io.Writer to the destination.  This is considered a "slow path" because we
-	// have to act as a broker to relay bytes between the two objects.  Some
-	// stores support moving data using an API call.
-	fout, err := s.NewWriterWithContext(ctx, des.Name(), src.MetaData())
+// streamCopy relays src to des, on error the write context is cancelled
+// before the writer is closed so the partial upload is abandoned.
+func streamCopy(ctx context.Context, s Store, src, des Object, progress func(int64), opts []Opts) error {
+	fin, err := NewReaderWithOpts(ctx, s, src.Name(), opts...)
 	if err != nil {
-		gou.Warnf("Move could not open destination %v", src.Name())
+		gou.Warnf("Copy could not open source %v err=%v", src.Name(), err)
 		return err
 	}
-	fin, err := s.NewReaderWithContext(ctx, src.Name())
+	defer fin.Close()
+
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	fout, err := s.NewWriterWithContext(wctx, des.Name(), src.MetaData(), opts...)
 	if err != nil {
-		gou.Warnf("Move could not open source %v err=%v", src.Name(), err)
+		gou.Warnf("Copy could not open destination %v err=%v", des.Name(), err)
 		return err
 	}
-	if _, err = io.Copy(fout, fin); err != nil {
+	var r io.Reader = fin
+	if progress != nil {
+		r = &progressReader{r: fin, progress: progress}
+	}
+	if _, err := io.Copy(fout, r); err != nil {
+		cancel()
+		fout.Close()
 		return err
 	}
-	if err := fin.Close(); err != nil {
+	return fout.Close() //this will flush and sync the file.
+}
+
+// progressReader reports the bytes read so far.
+type progressReader struct {
+	r        io.Reader
+	n        int64
+	progress func(int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.n += int64(n)
+		p.progress(p.n)
+	}
+	return n, err
+}
+
+// NewReaderWithOpts reads object o of s with the per call opts, stores not
+// implementing StoreReaderWithOpts read it without them.
+func NewReaderWithOpts(ctx context.Context, s StoreReader, o string, opts ...Opts) (io.ReadCloser, error) {
+	if r, ok := s.(StoreReaderWithOpts); ok && len(opts) > 0 {
+		return r.NewReaderWithOpts(ctx, o, opts...)
+	}
+	return s.NewReaderWithContext(ctx, o)
+}
+
+// GetWithOpts gets object o of s with the per call opts, stores not
+// implementing StoreGetWithOpts get it without them.  With Opts.Stream the
+// object is read through NewStreamObject.
+func GetWithOpts(ctx context.Context, s Store, o string, opts ...Opts) (Object, error) {
+	if len(opts) > 0 && opts[0].Stream {
+		ropts := opts[0]
+		ropts.Stream = false
+		obj, err := GetWithOpts(ctx, s, o, ropts)
+		if err != nil {
+			return nil, err
+		}
+		return NewStreamObject(s, obj, ropts), nil
+	}
+	if g, ok := s.(StoreGetWithOpts); ok && len(opts) > 0 {
+		return g.GetWithOpts(ctx, o, opts...)
+	}
+	return s.Get(ctx, o)
+}
+
+// Put replaces the content of object name with everything read from r,
+// creating it if needed.  A failed read of r leaves the previous content in
+// place.  Stores without a native implementation (see StorePut) get r
+// spooled to a temp file of the store's cache directory (see
+// StoreCachePath) first and then written through
+// NewWriterWithContext, which for the cloud stores only commits the object
+// once the writer is closed so readers never see a partial write; on error
+// the write context is cancelled before Close to abandon the upload.
+func Put(ctx context.Context, s Store, name string, r io.Reader, metadata map[string]string, opts ...Opts) error {
+	if sp, ok := s.(StorePut); ok {
+		return sp.Put(ctx, name, r, metadata, opts...)
+	}
+
+	var dir string
+	if cp, ok := s.(StoreCachePath); ok {
+		dir = cp.CachePath()
+	}
+	spool, err := os.CreateTemp(dir, "cloudstorage-put-*")
+	if err != nil {
 		return err
 	}
-	if err := fout.Close(); err != nil { //this will flush and sync the file.
+	defer func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}()
+	if _, err := io.Copy(spool, r); err != nil {
 		return err
 	}
-	return nil
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w, err := s.NewWriterWithContext(ctx, name, metadata, opts...)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, spool); err != nil {
+		cancel()
+		w.Close()
+		return err
+	}
+	return w.Close()
 }
 
-// Move source object to destination.
-func Move(ctx context.Context, s Store, src, des Object) error {
+// Compose writes the concatenation of srcs, in order, to dst replacing it
+// if it exists, dst may be one of the srcs to append to it.  Stores that
+// can (see StoreComposer) do so server side, the others stream each source
+// through this process into Put.  dst gets the metadata of the first source.
+func Compose(ctx context.Context, s Store, dst string, srcs []string) error {
+	if len(srcs) == 0 {
+		return fmt.Errorf("compose %q: no source objects", dst)
+	}
+	if c, ok := s.(StoreComposer); ok {
+		if err := c.Compose(ctx, dst, srcs); !errors.Is(err, ErrNotImplemented) {
+			return err
+		}
+	}
+
+	first, err := s.Get(ctx, srcs[0])
+	if err != nil {
+		return err
+	}
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go func() {
+		for _, src := range srcs {
+			rc, err := s.NewReaderWithContext(ctx, src)
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			_, err = io.Copy(pw, rc)
+			rc.Close()
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.Close()
+	}()
+	return Put(ctx, s, dst, pr, first.MetaData())
+}
+
+// fastCopy copies src to des server side, ErrNotImplemented if the store
+// can't.
+func fastCopy(ctx context.Context, s Store, src, des Object, opts []Opts) error {
+	src, des = unwrapStream(src), unwrapStream(des)
+	if cp, ok := s.(StoreCopyWithOpts); ok && len(opts) > 0 {
+		return cp.CopyWithOpts(ctx, src, des, opts...)
+	}
+	if cp, ok := s.(StoreCopy); ok {
+		return cp.Copy(ctx, src, des)
+	}
+	return ErrNotImplemented
+}
+
+// Move source object to destination, opts are used to read src and write
+// des, see StoreMoveWithOpts.
+func Move(ctx context.Context, s Store, src, des Object, opts ...Opts) error {
 	// take the fast path, and use the store provided mover if available
 	if src.StorageSource() == des.StorageSource() {
-		if sm, ok := s.(StoreMove); ok {
-			return sm.Move(ctx, src, des)
+		if err := fastMove(ctx, s, src, des, opts); !errors.Is(err, ErrNotImplemented) {
+			return err
 		}
 	}
 
-	if err := Copy(ctx, s, src, des); err != nil { // use Copy() to copy the files
+	if err := Copy(ctx, s, src, des, opts...); err != nil { // use Copy() to copy the files
 		return err
 	}
 
@@ -314,6 +808,19 @@ func Move(ctx context.Context, s Store, src, des Object) error {
 	return nil
 }
 
+// fastMove moves src to des server side, ErrNotImplemented if the store
+// can't.
+func fastMove(ctx context.Context, s Store, src, des Object, opts []Opts) error {
+	src, des = unwrapStream(src), unwrapStream(des)
+	if sm, ok := s.(StoreMoveWithOpts); ok && len(opts) > 0 {
+		return sm.MoveWithOpts(ctx, src, des, opts...)
+	}
+	if sm, ok := s.(StoreMove); ok {
+		return sm.Move(ctx, src, des)
+	}
+	return ErrNotImplemented
+}
+
 func NewObjectsResponse() *ObjectsResponse {
 	return &ObjectsResponse{
 		Objects: make(Objects, 0),
@@ -323,6 +830,47 @@ func (o Objects) Len() int           { return len(o) }
 func (o Objects) Less(i, j int) bool { return o[i].Name() < o[j].Name() }
 func (o Objects) Swap(i, j int)      { o[i], o[j] = o[j], o[i] }
 
+// ConfigError lists every missing or invalid setting found while validating
+// a provider config, so misconfiguration can be fixed in one pass.
+type ConfigError struct {
+	// Type is the StoreType of the config.
+	Type string
+	// Missing are the required fields or settings keys that are empty,
+	// ie "bucket" or "settings.access_key".
+	Missing []string
+	// Invalid describes the values that are set but not usable.
+	Invalid []string
+}
+
+// Require records key as missing when val is empty.
+func (e *ConfigError) Require(key, val string) {
+	if val == "" {
+		e.Missing = append(e.Missing, key)
+	}
+}
+
+// Invalidf records a description of an invalid value.
+func (e *ConfigError) Invalidf(format string, args ...interface{}) {
+	e.Invalid = append(e.Invalid, fmt.Sprintf(format, args...))
+}
+
+// Err returns the ConfigError if anything was recorded, else nil.
+func (e *ConfigError) Err() error {
+	if len(e.Missing) == 0 && len(e.Invalid) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *ConfigError) Error() string {
+	var problems []string
+	if len(e.Missing) > 0 {
+		problems = append(problems, "missing "+strings.Join(e.Missing, ", "))
+	}
+	problems = append(problems, e.Invalid...)
+	return fmt.Sprintf("invalid config for type=%q: %s", e.Type, strings.Join(problems, "; "))
+}
+
 // Validate that this is a valid jwt conf set of tokens
 func (j *JwtConf) Validate() error {
 	if j.PrivateKeyDeprecated != "" {
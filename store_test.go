@@ -2,12 +2,20 @@ package cloudstorage_test
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
 	"github.com/lytics/cloudstorage"
 	"github.com/lytics/cloudstorage/localfs"
-	"github.com/stretchr/testify/require"
+	"github.com/lytics/cloudstorage/mockstore"
+	"github.com/lytics/cloudstorage/testutils"
 )
 
 func TestStore(t *testing.T) {
@@ -89,3 +97,226 @@ func TestJwtConf(t *testing.T) {
 	require.Equal(t, "aGVsbG8td29ybGQ=", conf.JwtConf.PrivateKey)
 	require.Equal(t, "service_account", conf.JwtConf.Type)
 }
+
+// fastPathStore records its fast path calls and answers them with err.
+type fastPathStore struct {
+	cloudstorage.Store
+	err    error
+	copies int
+	moves  int
+}
+
+func (s *fastPathStore) Copy(ctx context.Context, src, des cloudstorage.Object) error {
+	s.copies++
+	return s.err
+}
+
+func (s *fastPathStore) Move(ctx context.Context, src, des cloudstorage.Object) error {
+	s.moves++
+	return s.err
+}
+
+func TestCopyMoveFastPath(t *testing.T) {
+	tmpDir := t.TempDir()
+	local, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "mockcloud"),
+		TmpDir:     filepath.Join(tmpDir, "localcache"),
+		Bucket:     "fastpath",
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, testutils.MockFile(local, "a.csv", "a"))
+	src, err := local.Get(ctx, "a.csv")
+	require.NoError(t, err)
+	des, err := local.NewObject("b.csv")
+	require.NoError(t, err)
+
+	// the store's copier and mover are used
+	store := &fastPathStore{Store: local}
+	require.NoError(t, cloudstorage.Copy(ctx, store, src, des))
+	require.NoError(t, cloudstorage.Move(ctx, store, src, des))
+	require.Equal(t, 1, store.copies)
+	require.Equal(t, 1, store.moves)
+	_, err = local.Get(ctx, "b.csv")
+	require.Equal(t, cloudstorage.ErrObjectNotFound, err)
+
+	// and their errors returned
+	store.err = cloudstorage.ErrObjectNotFound
+	require.Equal(t, cloudstorage.ErrObjectNotFound, cloudstorage.Copy(ctx, store, src, des))
+
+	// ErrNotImplemented falls back to streaming
+	store.err = fmt.Errorf("%w: too large", cloudstorage.ErrNotImplemented)
+	require.NoError(t, cloudstorage.Copy(ctx, store, src, des))
+	b, err := cloudstorage.ReadAll(ctx, local, "b.csv")
+	require.NoError(t, err)
+	require.Equal(t, "a", string(b))
+
+	require.NoError(t, local.Delete(ctx, "b.csv"))
+	require.NoError(t, cloudstorage.Move(ctx, store, src, des))
+	b, err = cloudstorage.ReadAll(ctx, local, "b.csv")
+	require.NoError(t, err)
+	require.Equal(t, "a", string(b))
+	_, err = local.Get(ctx, "a.csv")
+	require.Equal(t, cloudstorage.ErrObjectNotFound, err)
+}
+
+// keyStore records the opts of reads, writes and server side copies.
+type keyStore struct {
+	cloudstorage.Store
+	copyErr error
+	copies  []cloudstorage.Opts
+	reads   []cloudstorage.Opts
+	writes  []cloudstorage.Opts
+}
+
+func (s *keyStore) NewReaderWithOpts(ctx context.Context, name string, opts ...cloudstorage.Opts) (io.ReadCloser, error) {
+	s.reads = append(s.reads, opts...)
+	return s.Store.NewReaderWithContext(ctx, name)
+}
+
+func (s *keyStore) NewWriterWithContext(ctx context.Context, name string, metadata map[string]string, opts ...cloudstorage.Opts) (io.WriteCloser, error) {
+	s.writes = append(s.writes, opts...)
+	return s.Store.NewWriterWithContext(ctx, name, metadata, opts...)
+}
+
+func (s *keyStore) Copy(ctx context.Context, src, des cloudstorage.Object) error {
+	return s.CopyWithOpts(ctx, src, des)
+}
+
+func (s *keyStore) CopyWithOpts(ctx context.Context, src, des cloudstorage.Object, opts ...cloudstorage.Opts) error {
+	s.copies = append(s.copies, opts...)
+	return s.copyErr
+}
+
+func TestCopyMoveOpts(t *testing.T) {
+	ctx := context.Background()
+	mem := mockstore.New()
+	require.NoError(t, cloudstorage.WriteAll(ctx, mem, "a.csv", []byte("a,b"), nil))
+	key := []byte(strings.Repeat("k", 32))
+	opts := cloudstorage.Opts{EncryptionKey: key}
+	src, err := mem.Get(ctx, "a.csv")
+	require.NoError(t, err)
+	des, err := mem.NewObject("b.csv")
+	require.NoError(t, err)
+
+	// the fast path gets the opts
+	store := &keyStore{Store: mem}
+	require.NoError(t, cloudstorage.Copy(ctx, store, src, des, opts))
+	require.Equal(t, []cloudstorage.Opts{opts}, store.copies)
+	require.Empty(t, store.reads)
+
+	// as do the reads and writes of the streamed copy
+	store = &keyStore{Store: mem, copyErr: cloudstorage.ErrNotImplemented}
+	require.NoError(t, cloudstorage.Copy(ctx, store, src, des, opts))
+	require.Equal(t, []cloudstorage.Opts{opts}, store.reads)
+	require.Equal(t, []cloudstorage.Opts{opts}, store.writes)
+	b, err := cloudstorage.ReadAll(ctx, mem, "b.csv")
+	require.NoError(t, err)
+	require.Equal(t, "a,b", string(b))
+
+	// and of the copy a Move without a fast path makes
+	store = &keyStore{Store: mem, copyErr: cloudstorage.ErrNotImplemented}
+	des, err = mem.NewObject("c.csv")
+	require.NoError(t, err)
+	require.NoError(t, cloudstorage.Move(ctx, store, src, des, opts))
+	require.Equal(t, []cloudstorage.Opts{opts}, store.copies)
+	require.Equal(t, []cloudstorage.Opts{opts}, store.reads)
+	_, err = mem.Get(ctx, "a.csv")
+	require.ErrorIs(t, err, cloudstorage.ErrObjectNotFound)
+}
+
+type cachePathStore struct {
+	cloudstorage.Store
+	dir string
+}
+
+func (s *cachePathStore) CachePath() string { return s.dir }
+
+// spoolReader checks the Put spool file is in dir while it is read.
+type spoolReader struct {
+	t   *testing.T
+	r   io.Reader
+	dir string
+}
+
+func (r *spoolReader) Read(p []byte) (int, error) {
+	spools, err := filepath.Glob(filepath.Join(r.dir, "cloudstorage-put-*"))
+	require.NoError(r.t, err)
+	require.Equal(r.t, 1, len(spools))
+	return r.r.Read(p)
+}
+
+func TestPutSpoolsToCachePath(t *testing.T) {
+	tmpDir := t.TempDir()
+	local, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "mockcloud"),
+		TmpDir:     filepath.Join(tmpDir, "localcache"),
+		Bucket:     "put",
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// the wrapper hides localfs's own Put
+	store := &cachePathStore{Store: local, dir: dir}
+	r := &spoolReader{t: t, r: strings.NewReader("a,b"), dir: dir}
+	require.NoError(t, cloudstorage.Put(ctx, store, "a.csv", r, nil))
+	b, err := cloudstorage.ReadAll(ctx, local, "a.csv")
+	require.NoError(t, err)
+	require.Equal(t, "a,b", string(b))
+
+	// and the spool file removed
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(entries))
+}
+
+func TestCopyWithProgress(t *testing.T) {
+	tmpDir := t.TempDir()
+	local, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "mockcloud"),
+		TmpDir:     filepath.Join(tmpDir, "localcache"),
+		Bucket:     "progress",
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+	data := strings.Repeat("0123456789", 10000)
+	require.NoError(t, testutils.MockFile(local, "a.csv", data))
+	src, err := local.Get(ctx, "a.csv")
+	require.NoError(t, err)
+	des, err := local.NewObject("b.csv")
+	require.NoError(t, err)
+
+	// the first read fails and is retried
+	var copied []int64
+	err = cloudstorage.CopyWithProgress(ctx, &flakyStore{Store: local}, src, des, func(n int64) {
+		copied = append(copied, n)
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, copied)
+	require.Equal(t, int64(len(data)), copied[len(copied)-1])
+	b, err := cloudstorage.ReadAll(ctx, local, "b.csv")
+	require.NoError(t, err)
+	require.Equal(t, data, string(b))
+
+	// the cache dir holds no copies of either object
+	entries, err := os.ReadDir(filepath.Join(tmpDir, "localcache"))
+	require.NoError(t, err)
+	for _, e := range entries {
+		err := filepath.Walk(filepath.Join(tmpDir, "localcache", e.Name()), func(p string, fi os.FileInfo, err error) error {
+			require.NotEqual(t, cloudstorage.StoreCacheFileExt, filepath.Ext(p))
+			return err
+		})
+		require.NoError(t, err)
+	}
+
+	// a missing source isn't retried
+	require.NoError(t, local.Delete(ctx, "a.csv"))
+	require.Equal(t, cloudstorage.ErrObjectNotFound, cloudstorage.Copy(ctx, local, src, des))
+}
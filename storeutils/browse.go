@@ -0,0 +1,81 @@
+package storeutils
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/iterator"
+
+	"github.com/lytics/cloudstorage"
+)
+
+// Entry is a file or folder of a listing made by Browse.
+type Entry struct {
+	// Name is the full object name, or for folders the prefix ending in "/".
+	Name string
+	// Base is the last element of Name, without the folder's trailing "/".
+	Base     string
+	IsFolder bool
+	// Size and Updated of files, folders leave them zero.
+	Size    int64
+	Updated time.Time
+	// Children of a folder listed within the Browse depth, nil otherwise.
+	Children []*Entry
+}
+
+// Browse lists the folders and files directly below prefix ("" or a folder
+// ending in "/"), descending depth levels into the folders, depth 1 or
+// less only lists prefix itself.  Entries are sorted folders first, then
+// by name.  It combines Folders and a "/" delimited object listing so it
+// works the same on every store, files below the level are dropped for
+// stores that ignore the delimiter.
+func Browse(ctx context.Context, store cloudstorage.StoreReader, prefix string, depth int) ([]*Entry, error) {
+	folders, err := store.Folders(ctx, cloudstorage.NewQueryForFolders(prefix))
+	if err != nil {
+		return nil, err
+	}
+	var entries []*Entry
+	for _, f := range folders {
+		e := &Entry{Name: f, Base: path.Base(f), IsFolder: true}
+		if depth > 1 {
+			if e.Children, err = Browse(ctx, store, f, depth-1); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, e)
+	}
+
+	q := cloudstorage.NewQuery(prefix)
+	q.Delimiter = "/"
+	iter, err := store.Objects(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+	for {
+		o, err := iter.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		name := o.Name()
+		if rel := strings.TrimPrefix(name, prefix); rel == "" || strings.Contains(rel, "/") {
+			continue
+		}
+		e := &Entry{Name: name, Base: path.Base(name), Updated: o.Updated()}
+		e.Size, _ = cloudstorage.SizeOf(o)
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].IsFolder != entries[j].IsFolder {
+			return entries[i].IsFolder
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
@@ -0,0 +1,53 @@
+package storeutils_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/localfs"
+	"github.com/lytics/cloudstorage/storeutils"
+	"github.com/lytics/cloudstorage/testutils"
+)
+
+func TestBrowse(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "mockcloud"),
+		TmpDir:     filepath.Join(tmpDir, "localcache"),
+		Bucket:     "browse",
+	})
+	require.NoError(t, err)
+	for _, name := range []string{"data/z.csv", "data/a/1.csv", "data/a/b/2.csv", "data/c/3.csv"} {
+		require.NoError(t, testutils.MockFile(store, name, "x,y"))
+	}
+	ctx := context.Background()
+
+	entries, err := storeutils.Browse(ctx, store, "data/", 1)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(entries))
+	require.Equal(t, "data/a/", entries[0].Name)
+	require.Equal(t, "a", entries[0].Base)
+	require.True(t, entries[0].IsFolder)
+	require.Nil(t, entries[0].Children)
+	require.Equal(t, "data/c/", entries[1].Name)
+	require.Equal(t, "data/z.csv", entries[2].Name)
+	require.Equal(t, "z.csv", entries[2].Base)
+	require.False(t, entries[2].IsFolder)
+	require.Equal(t, int64(3), entries[2].Size)
+	require.False(t, entries[2].Updated.IsZero())
+
+	entries, err = storeutils.Browse(ctx, store, "data/", 2)
+	require.NoError(t, err)
+	a := entries[0].Children
+	require.Equal(t, 2, len(a))
+	require.Equal(t, "data/a/b/", a[0].Name)
+	require.Nil(t, a[0].Children)
+	require.Equal(t, "data/a/1.csv", a[1].Name)
+	require.Equal(t, 1, len(entries[1].Children))
+}
@@ -0,0 +1,132 @@
+package storeutils
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/iterator"
+
+	"github.com/lytics/cloudstorage"
+)
+
+// ExpiresAtKey metadata key of the RFC3339 time after which Expire deletes
+// an object.
+const ExpiresAtKey = "expires_at"
+
+// ExpireOpts optional settings for Expire.
+type ExpireOpts struct {
+	// TTL expires the objects without an ExpiresAtKey TTL after they were
+	// Updated, 0 only expires objects having the metadata.
+	TTL time.Duration
+	// DryRun reports the expired objects without deleting them.
+	DryRun bool
+	// DeletesPerSecond limits the rate of deletes, 0 is no limit.
+	DeletesPerSecond float64
+	// Stat gets every listed object for its metadata, for the stores not
+	// including it in listings (s3).
+	Stat bool
+	// Now is the time the expiry is checked against, time.Now if zero.
+	Now time.Time
+}
+
+// ExpireReport of the objects Expire found under a prefix.
+type ExpireReport struct {
+	Prefix  string
+	Scanned int64
+	// Expired are the names of the expired objects, deleted unless DryRun.
+	Expired []string
+	// Invalid are the names of objects with an ExpiresAtKey that isn't
+	// RFC3339, they are left alone.
+	Invalid []string
+}
+
+// Expire deletes the objects under prefix whose ExpiresAtKey metadata time
+// has passed, or with ExpireOpts.TTL that were last updated more than TTL
+// ago, for stores without lifecycle rules (localfs, sftp...).
+//
+// Stores with ETags only delete objects still having the listed ETag, an
+// object rewritten since it was listed is kept, as are objects already
+// deleted by someone else.
+func Expire(ctx context.Context, store cloudstorage.Store, prefix string, opts ...ExpireOpts) (*ExpireReport, error) {
+	var o ExpireOpts
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	now := o.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	var limit <-chan time.Time
+	if o.DeletesPerSecond > 0 && !o.DryRun {
+		t := time.NewTicker(time.Duration(float64(time.Second) / o.DeletesPerSecond))
+		defer t.Stop()
+		limit = t.C
+	}
+	etags := cloudstorage.CapabilitiesOf(store).ETags
+
+	iter, err := store.Objects(ctx, cloudstorage.NewQuery(prefix))
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	report := &ExpireReport{Prefix: prefix}
+	deleted := 0
+	for {
+		obj, err := iter.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			return report, err
+		}
+		report.Scanned++
+		if o.Stat {
+			if obj, err = store.Get(ctx, obj.Name()); err == cloudstorage.ErrObjectNotFound {
+				continue
+			} else if err != nil {
+				return report, err
+			}
+		}
+
+		var expiresAt time.Time
+		if v := obj.MetaData()[ExpiresAtKey]; v != "" {
+			if expiresAt, err = time.Parse(time.RFC3339, v); err != nil {
+				report.Invalid = append(report.Invalid, obj.Name())
+				continue
+			}
+		} else if o.TTL > 0 {
+			expiresAt = obj.Updated().Add(o.TTL)
+		} else {
+			continue
+		}
+		if now.Before(expiresAt) {
+			continue
+		}
+		if o.DryRun {
+			report.Expired = append(report.Expired, obj.Name())
+			continue
+		}
+
+		if limit != nil && deleted > 0 {
+			select {
+			case <-ctx.Done():
+				return report, ctx.Err()
+			case <-limit:
+			}
+		}
+		deleted++
+		var dopts cloudstorage.Opts
+		if et, ok := obj.(cloudstorage.ObjectETagger); ok && etags {
+			dopts.IfMatch = et.ETag()
+		}
+		err = store.Delete(ctx, obj.Name(), dopts)
+		if errors.Is(err, cloudstorage.ErrObjectNotFound) || errors.Is(err, cloudstorage.ErrPreconditionFailed) {
+			continue
+		} else if err != nil {
+			return report, err
+		}
+		report.Expired = append(report.Expired, obj.Name())
+	}
+	return report, nil
+}
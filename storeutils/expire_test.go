@@ -0,0 +1,59 @@
+package storeutils_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/mockstore"
+	"github.com/lytics/cloudstorage/storeutils"
+)
+
+func TestExpire(t *testing.T) {
+	ctx := context.Background()
+	store := mockstore.New()
+	now := time.Now()
+	past, future := now.Add(-time.Hour).Format(time.RFC3339), now.Add(time.Hour).Format(time.RFC3339)
+	store.Add("tmp/a.csv", nil, map[string]string{storeutils.ExpiresAtKey: past})
+	store.Add("tmp/b.csv", nil, map[string]string{storeutils.ExpiresAtKey: future})
+	store.Add("tmp/c.csv", nil, nil)
+	store.Add("tmp/d.csv", nil, map[string]string{storeutils.ExpiresAtKey: "tomorrow"})
+	store.Add("keep/e.csv", nil, map[string]string{storeutils.ExpiresAtKey: past})
+
+	report, err := storeutils.Expire(ctx, store, "tmp/", storeutils.ExpireOpts{DryRun: true})
+	require.NoError(t, err)
+	require.Equal(t, int64(4), report.Scanned)
+	require.Equal(t, []string{"tmp/a.csv"}, report.Expired)
+	require.Equal(t, []string{"tmp/d.csv"}, report.Invalid)
+	_, ok := store.Data("tmp/a.csv")
+	require.True(t, ok, "dry run deletes nothing")
+
+	// with a TTL objects without expires_at expire once old enough
+	report, err = storeutils.Expire(ctx, store, "tmp/", storeutils.ExpireOpts{TTL: time.Minute, Now: now.Add(2 * time.Minute)})
+	require.NoError(t, err)
+	require.Equal(t, []string{"tmp/a.csv", "tmp/c.csv"}, report.Expired)
+	for name, exists := range map[string]bool{"tmp/a.csv": false, "tmp/b.csv": true, "tmp/c.csv": false, "tmp/d.csv": true, "keep/e.csv": true} {
+		_, ok := store.Data(name)
+		require.Equal(t, exists, ok, name)
+	}
+
+	// rate limited
+	for _, name := range []string{"gc/a", "gc/b", "gc/c"} {
+		store.Add(name, nil, map[string]string{storeutils.ExpiresAtKey: past})
+	}
+	started := time.Now()
+	report, err = storeutils.Expire(ctx, store, "gc/", storeutils.ExpireOpts{DeletesPerSecond: 20})
+	require.NoError(t, err)
+	require.Len(t, report.Expired, 3)
+	require.GreaterOrEqual(t, time.Since(started), 90*time.Millisecond)
+
+	// objects rewritten since listed are kept
+	store.Add("race/a", nil, map[string]string{storeutils.ExpiresAtKey: past})
+	store.Fail("Delete", "race/a", cloudstorage.ErrPreconditionFailed, 1)
+	report, err = storeutils.Expire(ctx, store, "race/")
+	require.NoError(t, err)
+	require.Empty(t, report.Expired)
+}
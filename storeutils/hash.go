@@ -0,0 +1,125 @@
+package storeutils
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"sync"
+
+	"golang.org/x/net/context"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/api/iterator"
+
+	"github.com/lytics/cloudstorage"
+)
+
+const (
+	// HashSHA1 hex encoded sha1 digests, never reported by stores so always
+	// computed by HashObjects.
+	HashSHA1 = "sha1"
+	// HashSHA256 hex encoded sha256 digests, never reported by stores so
+	// always computed by HashObjects.
+	HashSHA256 = "sha256"
+)
+
+// HashOpts optional settings for HashObjects.
+type HashOpts struct {
+	// Concurrency is the number of objects read at once to compute hashes
+	// the store doesn't report.
+	Concurrency int
+}
+
+// HashObjects returns the hex digest by object name of the objects matching
+// q, algo is one of cloudstorage.HashMD5, cloudstorage.HashCRC32C,
+// HashSHA1 or HashSHA256.  Hashes reported by the store (see
+// cloudstorage.ObjectHasher) are used as is, the others are computed by
+// streaming the object.
+func HashObjects(ctx context.Context, store cloudstorage.StoreReader, q cloudstorage.Query, algo string, opts ...HashOpts) (map[string]string, error) {
+	if newHash(algo) == nil {
+		return nil, fmt.Errorf("unsupported hash algorithm %q", algo)
+	}
+	var o HashOpts
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = 1
+	}
+
+	q.IncludeHashes = true
+	iter, err := store.Objects(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	digests := make(map[string]string)
+	var mu sync.Mutex
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(o.Concurrency)
+	for {
+		obj, err := iter.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			g.Wait()
+			return nil, err
+		}
+		name := obj.Name()
+		if h, ok := obj.(cloudstorage.ObjectHasher); ok {
+			if digest, ok := h.Hashes()[algo]; ok {
+				mu.Lock()
+				digests[name] = digest
+				mu.Unlock()
+				continue
+			}
+		}
+		g.Go(func() error {
+			digest, err := readHash(gctx, store, name, algo)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			digests[name] = digest
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return digests, nil
+}
+
+// readHash computes the digest of an object by reading it.
+func readHash(ctx context.Context, store cloudstorage.StoreReader, name, algo string) (string, error) {
+	rc, err := store.NewReaderWithContext(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	h := newHash(algo)
+	if _, err := io.Copy(h, rc); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func newHash(algo string) hash.Hash {
+	switch algo {
+	case cloudstorage.HashMD5:
+		return md5.New()
+	case cloudstorage.HashCRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	case HashSHA1:
+		return sha1.New()
+	case HashSHA256:
+		return sha256.New()
+	}
+	return nil
+}
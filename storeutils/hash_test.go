@@ -0,0 +1,54 @@
+package storeutils_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/localfs"
+	"github.com/lytics/cloudstorage/storeutils"
+	"github.com/lytics/cloudstorage/testutils"
+)
+
+func TestHashObjects(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "mockcloud"),
+		TmpDir:     filepath.Join(tmpDir, "localcache"),
+		Bucket:     "hash",
+	})
+	require.NoError(t, err)
+	require.NoError(t, testutils.MockFile(store, "dedup/a.txt", "hello"))
+	require.NoError(t, testutils.MockFile(store, "dedup/b/c.txt", "hello"))
+	require.NoError(t, testutils.MockFile(store, "dedup/d.txt", "world"))
+
+	ctx := context.Background()
+	q := cloudstorage.NewQuery("dedup/")
+
+	// md5 is reported by the store when listing with IncludeHashes
+	digests, err := storeutils.HashObjects(ctx, store, q, cloudstorage.HashMD5)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"dedup/a.txt":   "5d41402abc4b2a76b9719d911017c592",
+		"dedup/b/c.txt": "5d41402abc4b2a76b9719d911017c592",
+		"dedup/d.txt":   "7d793037a0760186574b0282f2f435e7",
+	}, digests)
+
+	// others are computed by reading the objects
+	digests, err = storeutils.HashObjects(ctx, store, q, storeutils.HashSHA256, storeutils.HashOpts{Concurrency: 2})
+	require.NoError(t, err)
+	require.Len(t, digests, 3)
+	require.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", digests["dedup/a.txt"])
+
+	digests, err = storeutils.HashObjects(ctx, store, q, cloudstorage.HashCRC32C)
+	require.NoError(t, err)
+	require.Equal(t, "9a71bb4c", digests["dedup/a.txt"])
+
+	_, err = storeutils.HashObjects(ctx, store, q, "md4")
+	require.Error(t, err)
+}
@@ -0,0 +1,206 @@
+package storeutils
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/iterator"
+
+	"github.com/lytics/cloudstorage"
+)
+
+// InventoryFormat of the reports written by ExportInventory.
+type InventoryFormat string
+
+const (
+	// InventoryCSV is a csv report with a header row, metadata columns are
+	// named "metadata.<key>".
+	InventoryCSV InventoryFormat = "csv"
+	// InventoryJSON is a newline delimited json report, one object per line.
+	InventoryJSON InventoryFormat = "json"
+)
+
+// InventoryFlushEvery is the number of objects written between flushes of
+// an inventory, and advances of its cursor.
+var InventoryFlushEvery = 1000
+
+// InventoryOpts optional settings for ExportInventory.
+type InventoryOpts struct {
+	// MetadataKeys are the metadata of the objects reported, none if empty.
+	MetadataKeys []string
+	// OmitHeader skips the csv header row, for appending a resumed export.
+	OmitHeader bool
+}
+
+// inventoryRecord is an object of the inventory, Size is nil for objects
+// that don't know their size from the listing.
+type inventoryRecord struct {
+	Name     string            `json:"name"`
+	Size     *int64            `json:"size,omitempty"`
+	Updated  string            `json:"updated,omitempty"`
+	ETag     string            `json:"etag,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// ExportInventory streams a report of the objects of q, their name, size,
+// updated time, etag and metadata subset, to w in format.  Sizes and etags
+// are only reported for objects implementing cloudstorage.ObjectSizer and
+// cloudstorage.ObjectETagger.
+//
+// The returned cursor is the StartOffset of a query resuming the export after
+// the last object flushed to w, it is returned with the error of an export
+// that didn't finish.  Stores list objects in name order so the resumed
+// export continues where the first one stopped, repeating the objects
+// partially written after the cursor:
+//
+//	cursor, err := storeutils.ExportInventory(ctx, store, q, w, storeutils.InventoryCSV)
+//	if err != nil {
+//		q.StartOffset = cursor
+//		cursor, err = storeutils.ExportInventory(ctx, store, q, w, storeutils.InventoryCSV,
+//			storeutils.InventoryOpts{OmitHeader: true})
+//	}
+func ExportInventory(ctx context.Context, store cloudstorage.StoreReader, q cloudstorage.Query, w io.Writer,
+	format InventoryFormat, opts ...InventoryOpts) (string, error) {
+
+	var o InventoryOpts
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	cursor := q.StartOffset
+
+	var iw inventoryWriter
+	switch format {
+	case InventoryCSV:
+		ci := &csvInventory{w: csv.NewWriter(w), keys: o.MetadataKeys}
+		if !o.OmitHeader {
+			if err := ci.header(); err != nil {
+				return cursor, err
+			}
+		}
+		iw = ci
+	case InventoryJSON:
+		bw := bufio.NewWriter(w)
+		iw = &jsonInventory{bw: bw, enc: json.NewEncoder(bw)}
+	default:
+		return cursor, fmt.Errorf("unknown inventory format %q", format)
+	}
+
+	iter, err := store.Objects(ctx, q)
+	if err != nil {
+		return cursor, err
+	}
+	defer iter.Close()
+
+	var last string
+	pending := 0
+	for {
+		obj, err := iter.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			return cursor, err
+		}
+		if err := iw.write(newInventoryRecord(obj, o.MetadataKeys)); err != nil {
+			return cursor, err
+		}
+		last = obj.Name()
+		pending++
+		if pending >= InventoryFlushEvery {
+			if err := iw.flush(); err != nil {
+				return cursor, err
+			}
+			cursor, pending = nextName(last), 0
+		}
+	}
+	if err := iw.flush(); err != nil {
+		return cursor, err
+	}
+	if last != "" {
+		cursor = nextName(last)
+	}
+	return cursor, nil
+}
+
+// nextName is the first name sorting after name.
+func nextName(name string) string {
+	return name + "\x00"
+}
+
+func newInventoryRecord(obj cloudstorage.Object, keys []string) *inventoryRecord {
+	rec := &inventoryRecord{Name: obj.Name()}
+	if size, ok := cloudstorage.SizeOf(obj); ok {
+		rec.Size = &size
+	}
+	if updated := obj.Updated(); !updated.IsZero() {
+		rec.Updated = updated.UTC().Format(time.RFC3339Nano)
+	}
+	if et, ok := obj.(cloudstorage.ObjectETagger); ok {
+		rec.ETag = cloudstorage.CleanETag(et.ETag())
+	}
+	if len(keys) > 0 {
+		md := obj.MetaData()
+		for _, k := range keys {
+			if v, ok := md[k]; ok {
+				if rec.Metadata == nil {
+					rec.Metadata = make(map[string]string, len(keys))
+				}
+				rec.Metadata[k] = v
+			}
+		}
+	}
+	return rec
+}
+
+type inventoryWriter interface {
+	write(rec *inventoryRecord) error
+	flush() error
+}
+
+type csvInventory struct {
+	w    *csv.Writer
+	keys []string
+}
+
+func (c *csvInventory) header() error {
+	row := []string{"name", "size", "updated", "etag"}
+	for _, k := range c.keys {
+		row = append(row, "metadata."+k)
+	}
+	return c.w.Write(row)
+}
+
+func (c *csvInventory) write(rec *inventoryRecord) error {
+	size := ""
+	if rec.Size != nil {
+		size = strconv.FormatInt(*rec.Size, 10)
+	}
+	row := []string{rec.Name, size, rec.Updated, rec.ETag}
+	for _, k := range c.keys {
+		row = append(row, rec.Metadata[k])
+	}
+	return c.w.Write(row)
+}
+
+func (c *csvInventory) flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonInventory struct {
+	bw  *bufio.Writer
+	enc *json.Encoder
+}
+
+func (j *jsonInventory) write(rec *inventoryRecord) error {
+	return j.enc.Encode(rec)
+}
+
+func (j *jsonInventory) flush() error {
+	return j.bw.Flush()
+}
@@ -0,0 +1,111 @@
+package storeutils_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/mockstore"
+	"github.com/lytics/cloudstorage/storeutils"
+)
+
+// failWriter fails the writes after the first n.
+type failWriter struct {
+	bytes.Buffer
+	n int
+}
+
+func (w *failWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		return 0, errors.New("disk full")
+	}
+	w.n--
+	return w.Buffer.Write(p)
+}
+
+func TestExportInventory(t *testing.T) {
+	ctx := context.Background()
+	store := mockstore.New()
+	store.TmpDir = t.TempDir()
+	store.Add("inv/a.csv", []byte("a,b\n"), map[string]string{"owner": "etl", "team": "data"})
+	store.Add("inv/b.csv", []byte("c\n"), nil)
+	store.Add("inv/c.csv", []byte(""), map[string]string{"owner": "ml"})
+	store.Add("other/d.csv", []byte("d\n"), nil)
+
+	var buf bytes.Buffer
+	cursor, err := storeutils.ExportInventory(ctx, store, cloudstorage.NewQuery("inv/"), &buf, storeutils.InventoryCSV,
+		storeutils.InventoryOpts{MetadataKeys: []string{"owner"}})
+	require.NoError(t, err)
+	require.Equal(t, "inv/c.csv\x00", cursor)
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 4)
+	require.Equal(t, []string{"name", "size", "updated", "etag", "metadata.owner"}, rows[0])
+	require.Equal(t, "inv/a.csv", rows[1][0])
+	require.Equal(t, "4", rows[1][1])
+	require.NotEmpty(t, rows[1][2])
+	require.Len(t, rows[1][3], 32, "md5 etag")
+	require.Equal(t, "etl", rows[1][4])
+	require.Equal(t, "", rows[2][4])
+	require.Equal(t, "ml", rows[3][4])
+
+	buf.Reset()
+	_, err = storeutils.ExportInventory(ctx, store, cloudstorage.NewQuery("inv/"), &buf, storeutils.InventoryJSON,
+		storeutils.InventoryOpts{MetadataKeys: []string{"team"}})
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+	var rec struct {
+		Name     string            `json:"name"`
+		Size     int64             `json:"size"`
+		Metadata map[string]string `json:"metadata"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &rec))
+	require.Equal(t, "inv/a.csv", rec.Name)
+	require.Equal(t, int64(4), rec.Size)
+	require.Equal(t, map[string]string{"team": "data"}, rec.Metadata)
+
+	_, err = storeutils.ExportInventory(ctx, store, cloudstorage.NewQuery("inv/"), &buf, "xml")
+	require.Error(t, err)
+}
+
+func TestExportInventoryResume(t *testing.T) {
+	ctx := context.Background()
+	store := mockstore.New()
+	store.TmpDir = t.TempDir()
+	for _, name := range []string{"inv/a", "inv/b", "inv/c", "inv/d", "inv/e"} {
+		store.Add(name, []byte(name), nil)
+	}
+
+	flushEvery := storeutils.InventoryFlushEvery
+	storeutils.InventoryFlushEvery = 2
+	defer func() { storeutils.InventoryFlushEvery = flushEvery }()
+
+	// the first flush, of inv/a and inv/b, is written and the second fails.
+	w := &failWriter{n: 1}
+	q := cloudstorage.NewQuery("inv/")
+	cursor, err := storeutils.ExportInventory(ctx, store, q, w, storeutils.InventoryJSON)
+	require.Error(t, err)
+	require.Equal(t, "inv/b\x00", cursor)
+
+	var buf bytes.Buffer
+	q.StartOffset = cursor
+	cursor, err = storeutils.ExportInventory(ctx, store, q, &buf, storeutils.InventoryCSV,
+		storeutils.InventoryOpts{OmitHeader: true})
+	require.NoError(t, err)
+	require.Equal(t, "inv/e\x00", cursor)
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	var names []string
+	for _, row := range rows {
+		names = append(names, row[0])
+	}
+	require.Equal(t, []string{"inv/c", "inv/d", "inv/e"}, names)
+}
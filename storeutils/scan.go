@@ -0,0 +1,142 @@
+package storeutils
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/iterator"
+
+	"github.com/lytics/cloudstorage"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// OpenDecompressed opens object name for reading, content starting with
+// the gzip magic bytes is decompressed whatever the object's name or
+// metadata say.
+func OpenDecompressed(ctx context.Context, store cloudstorage.StoreReader, name string) (io.ReadCloser, error) {
+	rc, err := store.NewReaderWithContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(rc)
+	if magic, _ := br.Peek(len(gzipMagic)); !bytes.Equal(magic, gzipMagic) {
+		return &readCloser{Reader: br, closers: []io.Closer{rc}}, nil
+	}
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("could not read gzip object %q err=%v", name, err)
+	}
+	return &readCloser{Reader: gz, closers: []io.Closer{gz, rc}}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *readCloser) Close() error {
+	var err error
+	for _, c := range r.closers {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// CSVReader reads the records of a csv object, see OpenCSV.
+type CSVReader struct {
+	*csv.Reader
+	ctx context.Context
+	rc  io.ReadCloser
+}
+
+// OpenCSV opens object name as csv, gzip compressed content is detected
+// and decompressed.  The embedded csv.Reader may be configured (Comma,
+// FieldsPerRecord...) before the first Read.
+func OpenCSV(ctx context.Context, store cloudstorage.StoreReader, name string) (*CSVReader, error) {
+	rc, err := OpenDecompressed(ctx, store, name)
+	if err != nil {
+		return nil, err
+	}
+	return &CSVReader{Reader: csv.NewReader(rc), ctx: ctx, rc: rc}, nil
+}
+
+// Read the next record, io.EOF at the end of the object or the context's
+// error once it is done.
+func (r *CSVReader) Read() ([]string, error) {
+	if err := r.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return r.Reader.Read()
+}
+
+// Close the underlying object reader.
+func (r *CSVReader) Close() error {
+	return r.rc.Close()
+}
+
+// NDJSONIterator iterates over the lines of a newline delimited json
+// object, see OpenNDJSON.
+type NDJSONIterator struct {
+	ctx  context.Context
+	name string
+	rc   io.ReadCloser
+	r    *bufio.Reader
+	line int
+}
+
+// OpenNDJSON opens object name as newline delimited json, gzip compressed
+// content is detected and decompressed.
+func OpenNDJSON(ctx context.Context, store cloudstorage.StoreReader, name string) (*NDJSONIterator, error) {
+	rc, err := OpenDecompressed(ctx, store, name)
+	if err != nil {
+		return nil, err
+	}
+	return &NDJSONIterator{ctx: ctx, name: name, rc: rc, r: bufio.NewReader(rc)}, nil
+}
+
+// Next unmarshals the next non blank line into v.  It returns
+// iterator.Done at the end of the object and the context's error once it
+// is done.
+func (it *NDJSONIterator) Next(v interface{}) error {
+	for {
+		if err := it.ctx.Err(); err != nil {
+			return err
+		}
+		line, err := it.r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if len(line) > 0 {
+			it.line++
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			if jerr := json.Unmarshal(line, v); jerr != nil {
+				return fmt.Errorf("%s line %d: %w", it.name, it.line, jerr)
+			}
+			return nil
+		}
+		if err == io.EOF {
+			return iterator.Done
+		}
+	}
+}
+
+// Line is the line number of the last line read, starting at 1.
+func (it *NDJSONIterator) Line() int {
+	return it.line
+}
+
+// Close the underlying object reader.
+func (it *NDJSONIterator) Close() error {
+	return it.rc.Close()
+}
@@ -0,0 +1,92 @@
+package storeutils_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/iterator"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/localfs"
+	"github.com/lytics/cloudstorage/storeutils"
+)
+
+func gzipped(t *testing.T, s string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(s))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestScan(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "mockcloud"),
+		TmpDir:     filepath.Join(tmpDir, "localcache"),
+		Bucket:     "scan",
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	const csvData = "Year,Make,Model\n2003,VW,EuroVan\n2001,Ford,Ranger\n"
+	require.NoError(t, cloudstorage.WriteAll(ctx, store, "data/cars.csv", []byte(csvData), nil))
+	require.NoError(t, cloudstorage.WriteAll(ctx, store, "data/cars.csv.gz", gzipped(t, csvData), nil))
+	for _, name := range []string{"data/cars.csv", "data/cars.csv.gz"} {
+		r, err := storeutils.OpenCSV(ctx, store, name)
+		require.NoError(t, err)
+		var rows [][]string
+		for {
+			row, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			rows = append(rows, row)
+		}
+		require.NoError(t, r.Close())
+		require.Equal(t, [][]string{{"Year", "Make", "Model"}, {"2003", "VW", "EuroVan"}, {"2001", "Ford", "Ranger"}}, rows)
+	}
+
+	const ndjson = "{\"id\":1}\n\n{\"id\":2}\n{\"id\":3}"
+	require.NoError(t, cloudstorage.WriteAll(ctx, store, "data/events.json.gz", gzipped(t, ndjson), nil))
+	it, err := storeutils.OpenNDJSON(ctx, store, "data/events.json.gz")
+	require.NoError(t, err)
+	var ids []int
+	for {
+		var ev struct{ ID int }
+		err := it.Next(&ev)
+		if err == iterator.Done {
+			break
+		}
+		require.NoError(t, err)
+		ids = append(ids, ev.ID)
+	}
+	require.NoError(t, it.Close())
+	require.Equal(t, []int{1, 2, 3}, ids)
+
+	require.NoError(t, cloudstorage.WriteAll(ctx, store, "data/bad.json", []byte("{\"id\":1}\n{bad\n"), nil))
+	it, err = storeutils.OpenNDJSON(ctx, store, "data/bad.json")
+	require.NoError(t, err)
+	var v map[string]interface{}
+	require.NoError(t, it.Next(&v))
+	err = it.Next(&v)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "data/bad.json line 2")
+	require.NoError(t, it.Close())
+
+	cctx, cancel := context.WithCancel(ctx)
+	it, err = storeutils.OpenNDJSON(cctx, store, "data/events.json.gz")
+	require.NoError(t, err)
+	cancel()
+	require.Equal(t, context.Canceled, it.Next(&v))
+	it.Close()
+}
@@ -0,0 +1,143 @@
+// Package storeutils has helpers that work against any cloudstorage.Store,
+// see google/storeutils for gcs specific ones.
+package storeutils
+
+import (
+	"container/heap"
+	"io"
+	"sort"
+	"sync"
+
+	"golang.org/x/net/context"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/api/iterator"
+
+	"github.com/lytics/cloudstorage"
+)
+
+// Largest is the default number of largest objects kept by Usage.
+var Largest = 10
+
+// ObjectSize is an object name and its size in bytes.
+type ObjectSize struct {
+	Name string
+	Size int64
+}
+
+// UsageReport is the storage used under a prefix.
+type UsageReport struct {
+	Prefix  string
+	Bytes   int64
+	Objects int64
+	// Largest are the biggest objects, largest first.
+	Largest []ObjectSize
+}
+
+// UsageOpts optional settings for Usage.
+type UsageOpts struct {
+	// Largest is the number of largest objects to report, 0 uses Largest.
+	Largest int
+	// Concurrency is the number of objects sized at once when the store
+	// can't report sizes from the listing and objects must be read.
+	Concurrency int
+}
+
+// Usage streams the objects under prefix totalling their bytes and count.
+// Objects implementing cloudstorage.ObjectSizer are sized from the listing,
+// others are read through to count their bytes.
+func Usage(ctx context.Context, store cloudstorage.StoreReader, prefix string, opts ...UsageOpts) (*UsageReport, error) {
+	var o UsageOpts
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.Largest <= 0 {
+		o.Largest = Largest
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = 1
+	}
+
+	q := cloudstorage.NewQuery(prefix)
+	// only the names and sizes are needed
+	q.Lean = true
+	iter, err := store.Objects(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	report := &UsageReport{Prefix: prefix}
+	largest := &sizeHeap{}
+	var mu sync.Mutex
+	add := func(name string, size int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		report.Bytes += size
+		report.Objects++
+		heap.Push(largest, ObjectSize{Name: name, Size: size})
+		if largest.Len() > o.Largest {
+			heap.Pop(largest)
+		}
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(o.Concurrency)
+	for {
+		obj, err := iter.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			g.Wait()
+			return nil, err
+		}
+		if size, ok := cloudstorage.SizeOf(obj); ok {
+			add(obj.Name(), size)
+			continue
+		}
+		name := obj.Name()
+		g.Go(func() error {
+			size, err := readSize(gctx, store, name)
+			if err != nil {
+				return err
+			}
+			add(name, size)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	report.Largest = make([]ObjectSize, largest.Len())
+	copy(report.Largest, *largest)
+	sort.Slice(report.Largest, func(i, j int) bool {
+		return report.Largest[i].Size > report.Largest[j].Size
+	})
+	return report, nil
+}
+
+// readSize counts the bytes of an object by reading it.
+func readSize(ctx context.Context, store cloudstorage.StoreReader, name string) (int64, error) {
+	rc, err := store.NewReaderWithContext(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	return io.Copy(io.Discard, rc)
+}
+
+// sizeHeap is a min-heap of object sizes, keeping the smallest on top so
+// it can be popped once more than the wanted number of largest are held.
+type sizeHeap []ObjectSize
+
+func (h sizeHeap) Len() int            { return len(h) }
+func (h sizeHeap) Less(i, j int) bool  { return h[i].Size < h[j].Size }
+func (h sizeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *sizeHeap) Push(x interface{}) { *h = append(*h, x.(ObjectSize)) }
+func (h *sizeHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
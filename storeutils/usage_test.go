@@ -0,0 +1,69 @@
+package storeutils_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/localfs"
+	"github.com/lytics/cloudstorage/storeutils"
+	"github.com/lytics/cloudstorage/testutils"
+)
+
+// unsizedStore hides the ObjectSizer of listed objects so Usage has to
+// read them.
+type unsizedStore struct {
+	cloudstorage.Store
+}
+type unsizedIter struct {
+	cloudstorage.ObjectIterator
+}
+type unsizedObject struct {
+	cloudstorage.Object
+}
+
+func (s unsizedStore) Objects(ctx context.Context, q cloudstorage.Query) (cloudstorage.ObjectIterator, error) {
+	iter, err := s.Store.Objects(ctx, q)
+	return unsizedIter{iter}, err
+}
+func (it unsizedIter) Next() (cloudstorage.Object, error) {
+	o, err := it.ObjectIterator.Next()
+	if err != nil {
+		return nil, err
+	}
+	return unsizedObject{o}, nil
+}
+
+func TestUsage(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "mockcloud"),
+		TmpDir:     filepath.Join(tmpDir, "localcache"),
+		Bucket:     "usage",
+	})
+	require.NoError(t, err)
+
+	sizes := map[string]int{"usage/a.csv": 10, "usage/b/c.csv": 300, "usage/b/d.csv": 20, "usage/e.csv": 4000, "other/f.csv": 50000}
+	for name, size := range sizes {
+		require.NoError(t, testutils.MockFile(store, name, strings.Repeat("x", size)))
+	}
+
+	for _, s := range []cloudstorage.Store{store, unsizedStore{store}} {
+		report, err := storeutils.Usage(context.Background(), s, "usage/", storeutils.UsageOpts{Largest: 2, Concurrency: 3})
+		require.NoError(t, err)
+		require.Equal(t, int64(4330), report.Bytes)
+		require.Equal(t, int64(4), report.Objects)
+		require.Equal(t, []storeutils.ObjectSize{{Name: "usage/e.csv", Size: 4000}, {Name: "usage/b/c.csv", Size: 300}}, report.Largest)
+	}
+
+	report, err := storeutils.Usage(context.Background(), store, "missing/")
+	require.NoError(t, err)
+	require.Equal(t, int64(0), report.Objects)
+	require.Empty(t, report.Largest)
+}
@@ -0,0 +1,302 @@
+package cloudstorage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+
+	"golang.org/x/net/context"
+)
+
+// StreamReader reads an object straight from the store, without the full
+// cached copy Object.Open(ReadOnly) downloads first.  Sequential reads, and
+// seeks forward, stream from the store.  The first seek backwards or from
+// the end downloads the object into a spill file in tmpDir which serves
+// every read after that.
+type StreamReader struct {
+	ctx    context.Context
+	store  StoreReader
+	name   string
+	tmpDir string
+	opts   []Opts
+
+	rc    io.ReadCloser
+	pos   int64
+	spill *os.File
+}
+
+var _ io.ReadSeekCloser = (*StreamReader)(nil)
+
+// OpenStream opens object name of store for streaming reads, spilling to
+// tmpDir ("" is os.TempDir) only when needed, see StreamReader.  opts are
+// passed on to NewReaderWithOpts.
+func OpenStream(ctx context.Context, store StoreReader, name, tmpDir string, opts ...Opts) (*StreamReader, error) {
+	rc, err := NewReaderWithOpts(ctx, store, name, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &StreamReader{ctx: ctx, store: store, name: name, tmpDir: tmpDir, opts: opts, rc: rc}, nil
+}
+
+// Read implements io.Reader.
+func (r *StreamReader) Read(p []byte) (int, error) {
+	if r.spill != nil {
+		return r.spill.Read(p)
+	}
+	n, err := r.rc.Read(p)
+	r.pos += int64(n)
+	return n, err
+}
+
+// Seek implements io.Seeker.
+func (r *StreamReader) Seek(offset int64, whence int) (int64, error) {
+	if r.spill != nil {
+		return r.spill.Seek(offset, whence)
+	}
+	target := offset
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		target = r.pos + offset
+	case io.SeekEnd:
+		if err := r.spillFile(); err != nil {
+			return 0, err
+		}
+		return r.spill.Seek(offset, whence)
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if target < 0 {
+		return 0, errors.New("negative position")
+	}
+	if target >= r.pos {
+		// skip ahead in the stream, past the end reads return io.EOF
+		n, err := io.CopyN(io.Discard, r.rc, target-r.pos)
+		r.pos += n
+		if err != nil && err != io.EOF {
+			return r.pos, err
+		}
+		r.pos = target
+		return r.pos, nil
+	}
+	if err := r.spillFile(); err != nil {
+		return 0, err
+	}
+	return r.spill.Seek(target, io.SeekStart)
+}
+
+// spillFile downloads the whole object into a spill file, replacing the
+// stream.
+func (r *StreamReader) spillFile() error {
+	f, err := os.CreateTemp(r.tmpDir, "stream-*"+StoreCacheFileExt)
+	if err != nil {
+		return fmt.Errorf("unable to create spill file. tmpdir=%q err=%v", r.tmpDir, err)
+	}
+	if err := r.download(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	r.rc.Close()
+	r.spill = f
+	return nil
+}
+
+func (r *StreamReader) download(f *os.File) error {
+	rc, err := NewReaderWithOpts(r.ctx, r.store, r.name, r.opts...)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if _, err := io.Copy(f, rc); err != nil {
+		return fmt.Errorf("error downloading %s to spill file err=%v", r.name, err)
+	}
+	return nil
+}
+
+// Spilled is true once reads are served from a spill file.
+func (r *StreamReader) Spilled() bool {
+	return r.spill != nil
+}
+
+// Close the stream, removing the spill file if there is one.
+func (r *StreamReader) Close() error {
+	if r.spill == nil {
+		return r.rc.Close()
+	}
+	err := r.spill.Close()
+	if rerr := os.Remove(r.spill.Name()); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// streamObject reads an object of the store through a StreamReader rather
+// than the cached copy Open downloads, see NewStreamObject.
+type streamObject struct {
+	Object
+	store Store
+	opts  Opts
+
+	sr   *StreamReader
+	pr   *os.File
+	done chan error
+}
+
+// NewStreamObject returns obj, an object of store, read straight from the
+// store, the Object of GetWithOpts with Opts.Stream.  Open(ReadOnly)
+// returns the read end of a pipe streaming the object, without a cached
+// copy.  Without Open the object's own Read streams it too, and it is an
+// io.Seeker spilling it to the store's cache directory (see
+// StoreCachePath) only on a seek backwards or from the end, see
+// StreamReader.  Either the file of Open or the object is read, not both,
+// Close ends the stream so it can be opened again.
+//
+// Open(ReadWrite), Write, Sync and the other methods are obj's own.  opts
+// are passed on to NewReaderWithOpts.
+func NewStreamObject(store Store, obj Object, opts Opts) Object {
+	opts.Stream = false
+	so := &streamObject{Object: obj, store: store, opts: opts}
+	if s, ok := obj.(ObjectSizer); ok {
+		return &streamSizedObject{streamObject: so, sizer: s}
+	}
+	return so
+}
+
+// unwrapStream returns the store's object of o, for the store's Copy and
+// Move.
+func unwrapStream(o Object) Object {
+	switch so := o.(type) {
+	case *streamObject:
+		return so.Object
+	case *streamSizedObject:
+		return so.streamObject.Object
+	}
+	return o
+}
+
+func (o *streamObject) open() (*StreamReader, error) {
+	var tmpDir string
+	if cp, ok := o.store.(StoreCachePath); ok {
+		tmpDir = cp.CachePath()
+	}
+	return OpenStream(context.Background(), o.store, o.Name(), tmpDir, o.opts)
+}
+
+// Open(ReadOnly) streams the object through the read end of a pipe.
+func (o *streamObject) Open(accesslevel AccessLevel) (*os.File, error) {
+	if accesslevel != ReadOnly {
+		return o.Object.Open(accesslevel)
+	}
+	if o.sr != nil || o.pr != nil {
+		return nil, fmt.Errorf("the store object is already opened. %s", o.Name())
+	}
+	sr, err := o.open()
+	if err != nil {
+		return nil, err
+	}
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		sr.Close()
+		return nil, err
+	}
+	o.pr, o.done = pr, make(chan error, 1)
+	go func() {
+		_, err := io.Copy(pw, sr)
+		sr.Close()
+		pw.Close()
+		o.done <- err
+	}()
+	return pr, nil
+}
+
+// Read streams the object, unless it was opened.
+func (o *streamObject) Read(p []byte) (int, error) {
+	if o.pr != nil {
+		return o.pr.Read(p)
+	}
+	if o.sr == nil {
+		sr, err := o.open()
+		if err != nil {
+			return 0, err
+		}
+		o.sr = sr
+	}
+	return o.sr.Read(p)
+}
+
+// Seek implements io.Seeker, the object spills on a seek backwards or from
+// the end.  The file of Open can't seek.
+func (o *streamObject) Seek(offset int64, whence int) (int64, error) {
+	if o.pr != nil {
+		return 0, fmt.Errorf("the store object is opened as a stream. %s", o.Name())
+	}
+	if o.sr == nil {
+		sr, err := o.open()
+		if err != nil {
+			return 0, err
+		}
+		o.sr = sr
+	}
+	return o.sr.Seek(offset, whence)
+}
+
+// File is the read end of the pipe of Open, or the spill file once the
+// object spilled.
+func (o *streamObject) File() *os.File {
+	switch {
+	case o.pr != nil:
+		return o.pr
+	case o.sr != nil:
+		return o.sr.spill
+	}
+	return o.Object.File()
+}
+
+// Close ends the stream, the error of a stream cut short is returned.
+func (o *streamObject) Close() error {
+	switch {
+	case o.pr != nil:
+		o.pr.Close()
+		err := <-o.done
+		o.pr, o.done = nil, nil
+		if errors.Is(err, syscall.EPIPE) {
+			// the file was closed before the end
+			err = nil
+		}
+		return err
+	case o.sr != nil:
+		err := o.sr.Close()
+		o.sr = nil
+		return err
+	}
+	return o.Object.Close()
+}
+
+func (o *streamObject) ETag() string {
+	if et, ok := o.Object.(ObjectETagger); ok {
+		return et.ETag()
+	}
+	return ""
+}
+func (o *streamObject) Attrs() ObjectAttributes {
+	return AttrsOf(o.Object)
+}
+func (o *streamObject) Hashes() map[string]string {
+	if h, ok := o.Object.(ObjectHasher); ok {
+		return h.Hashes()
+	}
+	return nil
+}
+
+// streamSizedObject is the streamObject of an ObjectSizer.
+type streamSizedObject struct {
+	*streamObject
+	sizer ObjectSizer
+}
+
+func (o *streamSizedObject) Size() int64 {
+	return o.sizer.Size()
+}
@@ -0,0 +1,148 @@
+package cloudstorage_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/localfs"
+	"github.com/lytics/cloudstorage/mockstore"
+)
+
+func TestOpenStream(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "mockcloud"),
+		TmpDir:     filepath.Join(tmpDir, "localcache"),
+		Bucket:     "stream",
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+	spillDir := filepath.Join(tmpDir, "spill")
+	require.NoError(t, os.MkdirAll(spillDir, 0775))
+
+	data := "Year,Make,Model\n2003,VW,EuroVan\n2001,Ford,Ranger\n"
+	require.NoError(t, cloudstorage.WriteAll(ctx, store, "cars.csv", []byte(data), nil))
+
+	_, err = cloudstorage.OpenStream(ctx, store, "missing.csv", spillDir)
+	require.Equal(t, cloudstorage.ErrObjectNotFound, err)
+
+	// sequential reads and seeking forward stream
+	r, err := cloudstorage.OpenStream(ctx, store, "cars.csv", spillDir)
+	require.NoError(t, err)
+	p := make([]byte, 4)
+	_, err = io.ReadFull(r, p)
+	require.NoError(t, err)
+	require.Equal(t, "Year", string(p))
+	pos, err := r.Seek(12, io.SeekCurrent)
+	require.NoError(t, err)
+	require.Equal(t, int64(16), pos)
+	_, err = io.ReadFull(r, p)
+	require.NoError(t, err)
+	require.Equal(t, "2003", string(p))
+	require.False(t, r.Spilled())
+	entries, err := os.ReadDir(spillDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	// seeking back spills
+	pos, err = r.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), pos)
+	require.True(t, r.Spilled())
+	by, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, data, string(by))
+
+	pos, err = r.Seek(-7, io.SeekEnd)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)-7), pos)
+	by, err = io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "Ranger\n", string(by))
+
+	require.NoError(t, r.Close())
+	entries, err = os.ReadDir(spillDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestStreamObject(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "mockcloud"),
+		TmpDir:     filepath.Join(tmpDir, "localcache"),
+		Bucket:     "stream",
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+	cacheDir := store.(cloudstorage.StoreCachePath).CachePath()
+	cached := func() []string {
+		files, err := filepath.Glob(filepath.Join(cacheDir, "*"+cloudstorage.StoreCacheFileExt))
+		require.NoError(t, err)
+		return files
+	}
+
+	data := "Year,Make,Model\n2003,VW,EuroVan\n2001,Ford,Ranger\n"
+	require.NoError(t, cloudstorage.WriteAll(ctx, store, "cars.csv", []byte(data), nil))
+
+	// Open(ReadOnly) streams without a cached copy
+	obj, err := cloudstorage.GetWithOpts(ctx, store, "cars.csv", cloudstorage.Opts{Stream: true})
+	require.NoError(t, err)
+	size, ok := cloudstorage.SizeOf(obj)
+	require.True(t, ok)
+	require.Equal(t, int64(len(data)), size)
+	f, err := obj.Open(cloudstorage.ReadOnly)
+	require.NoError(t, err)
+	by, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.Equal(t, data, string(by))
+	require.Empty(t, cached())
+	require.NoError(t, obj.Close())
+
+	// the object reads and seeks itself, spilling on a seek back
+	rs, ok := obj.(io.ReadSeeker)
+	require.True(t, ok)
+	p := make([]byte, 4)
+	_, err = io.ReadFull(rs, p)
+	require.NoError(t, err)
+	require.Equal(t, "Year", string(p))
+	require.Nil(t, obj.File())
+	require.Empty(t, cached())
+	_, err = rs.Seek(-7, io.SeekEnd)
+	require.NoError(t, err)
+	require.NotNil(t, obj.File())
+	require.Len(t, cached(), 1)
+	by, err = io.ReadAll(rs)
+	require.NoError(t, err)
+	require.Equal(t, "Ranger\n", string(by))
+	require.NoError(t, obj.Close())
+	require.Empty(t, cached())
+
+	// the object is copied by the store like any other
+	dst, err := store.NewObject("copy.csv")
+	require.NoError(t, err)
+	require.NoError(t, cloudstorage.Copy(ctx, store, obj, dst))
+	by, err = cloudstorage.ReadAll(ctx, store, "copy.csv")
+	require.NoError(t, err)
+	require.Equal(t, data, string(by))
+
+	// and so is NewObject with Overwrite of the stores taking Stream
+	mstore := mockstore.New()
+	require.NoError(t, cloudstorage.WriteAll(ctx, mstore, "cars.csv", []byte(data), nil))
+	obj, err = mstore.NewObject("cars.csv", cloudstorage.Opts{Overwrite: true, Stream: true})
+	require.NoError(t, err)
+	by, err = io.ReadAll(obj)
+	require.NoError(t, err)
+	require.Equal(t, data, string(by))
+	require.NoError(t, obj.Close())
+}
@@ -0,0 +1,712 @@
+package swift
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/araddon/gou"
+	"github.com/ncw/swift"
+	"github.com/pborman/uuid"
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+const (
+	// StoreType = "swift" this is used to define the storage type to create
+	// from cloudstorage.NewStore(config)
+	StoreType = "swift"
+
+	// AuthKeystone is user/api-key (password) authentication, keystone v3
+	// unless Settings[ConfKeyAuthVersion] says otherwise.
+	AuthKeystone cloudstorage.AuthMethod = "keystone"
+	// AuthApplicationCredential is keystone v3 application credential
+	// authentication.
+	AuthApplicationCredential cloudstorage.AuthMethod = "application_credential"
+
+	// Configuration Keys.  These are the names of keys
+	// to look for in the json map[string]string to extract for config.
+
+	// ConfKeyAuthURL config key name of the keystone auth url
+	ConfKeyAuthURL = "auth_url"
+	// ConfKeyAuthVersion config key name of the auth version (1, 2 or 3), defaults to 3
+	ConfKeyAuthVersion = "auth_version"
+	// ConfKeyUser config key name of the user name
+	ConfKeyUser = "user"
+	// ConfKeyAPIKey config key name of the api key (password)
+	ConfKeyAPIKey = "api_key"
+	// ConfKeyDomain config key name of the user's domain
+	ConfKeyDomain = "domain"
+	// ConfKeyTenant config key name of the tenant (project) name
+	ConfKeyTenant = "tenant"
+	// ConfKeyTenantDomain config key name of the tenant's domain
+	ConfKeyTenantDomain = "tenant_domain"
+	// ConfKeyAppCredentialID config key name of the application credential id
+	ConfKeyAppCredentialID = "application_credential_id"
+	// ConfKeyAppCredentialSecret config key name of the application credential secret
+	ConfKeyAppCredentialSecret = "application_credential_secret"
+	// ConfKeySegmentSize config key name of the large object segment size in
+	// bytes, objects larger than this are uploaded as segmented large objects.
+	ConfKeySegmentSize = "segment_size"
+	// ConfKeySegmentContainer config key name of the container large object
+	// segments are written to, defaults to "<bucket>_segments".
+	ConfKeySegmentContainer = "segment_container"
+
+	// DefaultSegmentSize is the default large object segment size (100MB).
+	DefaultSegmentSize = 100 * 1024 * 1024
+	// MaxSegmentSize is the largest single object swift accepts (5GB).
+	MaxSegmentSize = 5 * 1024 * 1024 * 1024
+)
+
+var (
+	// Retries number of times to retry upon failures.
+	Retries = 3
+	// RetryBackoff delays between the Retries.
+	RetryBackoff = cloudstorage.DefaultBackoff
+	// PageSize is default page size
+	PageSize = 2000
+
+	// ErrNoAuthURL error for no settings.auth_url
+	ErrNoAuthURL = fmt.Errorf("no settings.auth_url")
+
+	// Ensure we implement the optional copier/mover
+	_ cloudstorage.StoreCopy = (*FS)(nil)
+	_ cloudstorage.StoreMove = (*FS)(nil)
+)
+
+func init() {
+	// Register this Driver (swift) in cloudstorage driver registry.
+	cloudstorage.Register(StoreType, func(conf *cloudstorage.Config) (cloudstorage.Store, error) {
+		conn, err := NewConnection(conf)
+		if err != nil {
+			return nil, err
+		}
+		return NewStore(conn, conf)
+	})
+}
+
+type (
+	// FS Simple wrapper for accessing swift containers, the config Bucket
+	// is the container.
+	FS struct {
+		PageSize         int
+		ID               string
+		conn             *swift.Connection
+		container        string
+		segmentContainer string
+		segmentSize      int64
+		cachepath        string
+	}
+
+	object struct {
+		fs         *FS
+		cachedcopy *os.File
+
+		name      string
+		updated   time.Time
+		metadata  map[string]string
+		size      int64
+		exists    bool
+		readonly  bool
+		opened    bool
+		cachepath string
+		// attrs the listing or Get returned beyond the above
+		attrs cloudstorage.ObjectAttributes
+		// ifNotExists uploads with If-None-Match: *, for Opts.IfNotExists
+		// writers.
+		ifNotExists bool
+	}
+)
+
+// NewConnection creates an authenticated swift connection from config.
+func NewConnection(conf *cloudstorage.Config) (*swift.Connection, error) {
+
+	conn := &swift.Connection{
+		AuthUrl:     conf.Settings.String(ConfKeyAuthURL),
+		AuthVersion: 3,
+		Region:      conf.Region,
+		Retries:     Retries,
+	}
+	if conn.AuthUrl == "" {
+		return nil, ErrNoAuthURL
+	}
+	if v, ok := conf.Settings.IntSafe(ConfKeyAuthVersion); ok && v > 0 {
+		conn.AuthVersion = v
+	}
+
+	switch conf.AuthMethod {
+	case AuthKeystone:
+		conn.UserName = conf.Settings.String(ConfKeyUser)
+		conn.ApiKey = conf.Settings.String(ConfKeyAPIKey)
+		conn.Domain = conf.Settings.String(ConfKeyDomain)
+		conn.Tenant = conf.Settings.String(ConfKeyTenant)
+		conn.TenantDomain = conf.Settings.String(ConfKeyTenantDomain)
+		if conn.UserName == "" || conn.ApiKey == "" {
+			return nil, fmt.Errorf("invalid config: missing settings.%s or settings.%s", ConfKeyUser, ConfKeyAPIKey)
+		}
+	case AuthApplicationCredential:
+		conn.ApplicationCredentialId = conf.Settings.String(ConfKeyAppCredentialID)
+		conn.ApplicationCredentialSecret = conf.Settings.String(ConfKeyAppCredentialSecret)
+		if conn.ApplicationCredentialId == "" || conn.ApplicationCredentialSecret == "" {
+			return nil, fmt.Errorf("invalid config: missing settings.%s or settings.%s", ConfKeyAppCredentialID, ConfKeyAppCredentialSecret)
+		}
+	default:
+		return nil, fmt.Errorf("invalid config.AuthMethod %q", conf.AuthMethod)
+	}
+
+	if err := conn.Authenticate(); err != nil {
+		return nil, fmt.Errorf("swift authentication failed auth_url=%q err=%v", conn.AuthUrl, err)
+	}
+	return conn, nil
+}
+
+// NewStore Create swift storage client of type cloudstorage.Store
+func NewStore(conn *swift.Connection, conf *cloudstorage.Config) (*FS, error) {
+
+	if conf.Bucket == "" {
+		return nil, fmt.Errorf("invalid config: Bucket (container) is required")
+	}
+	if conf.TmpDir == "" {
+		return nil, fmt.Errorf("unable to create cachepath. config.tmpdir=%q", conf.TmpDir)
+	}
+	if err := os.MkdirAll(conf.TmpDir, 0775); err != nil {
+		return nil, fmt.Errorf("unable to create cachepath. config.tmpdir=%q err=%v", conf.TmpDir, err)
+	}
+
+	segmentSize := int64(DefaultSegmentSize)
+	if ss, ok := conf.Settings.IntSafe(ConfKeySegmentSize); ok {
+		if ss <= 0 || int64(ss) > MaxSegmentSize {
+			return nil, fmt.Errorf("invalid config: %s=%d must be between 1 and %d", ConfKeySegmentSize, ss, int64(MaxSegmentSize))
+		}
+		segmentSize = int64(ss)
+	}
+	segmentContainer := conf.Settings.String(ConfKeySegmentContainer)
+	if segmentContainer == "" {
+		segmentContainer = conf.Bucket + "_segments"
+	}
+
+	uid := uuid.NewUUID().String()
+	uid = strings.Replace(uid, "-", "", -1)
+	cachepath, err := cloudstorage.CacheDir(conf.TmpDir, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FS{
+		conn:             conn,
+		container:        conf.Bucket,
+		segmentContainer: segmentContainer,
+		segmentSize:      segmentSize,
+		cachepath:        cachepath,
+		ID:               uid,
+		PageSize:         PageSize,
+	}, nil
+}
+
+// Type of store = "swift"
+func (f *FS) Type() string {
+	return StoreType
+}
+
+// CleanCache removes stale cache files from the store's TmpDir, see
+// cloudstorage.CleanCache.
+func (f *FS) CleanCache(ctx context.Context, olderThan time.Duration) error {
+	return cloudstorage.CleanCache(ctx, f.cachepath, olderThan)
+}
+
+// CachePath is the cache directory of the store below its TmpDir.
+func (f *FS) CachePath() string {
+	return f.cachepath
+}
+
+// UpdatedGranularity of swift, Last-Modified of a HEAD only has seconds.
+func (f *FS) UpdatedGranularity() time.Duration {
+	return time.Second
+}
+
+// Capabilities of swift.
+func (f *FS) Capabilities() cloudstorage.Capabilities {
+	return cloudstorage.Capabilities{IfNotExists: true, Concurrent: true}
+}
+
+// IsTransient is true for swift errors worth retrying: throttling, server
+// errors and network errors, not the 4xx of a denied permission or a
+// missing container.
+func (f *FS) IsTransient(err error) bool {
+	if !cloudstorage.DefaultIsTransient(err) {
+		return false
+	}
+	var serr *swift.Error
+	if errors.As(err, &serr) && serr.StatusCode != 0 {
+		return cloudstorage.IsTransientStatus(serr.StatusCode)
+	}
+	return true
+}
+
+// BackoffProfile of swift is RetryBackoff.
+func (f *FS) BackoffProfile() cloudstorage.BackoffProfile {
+	return RetryBackoff
+}
+
+// Client gets access to the underlying *swift.Connection.
+func (f *FS) Client() interface{} {
+	return f.conn
+}
+
+// String function to provide swift://..../file   path
+func (f *FS) String() string {
+	return fmt.Sprintf("swift://%s/", f.container)
+}
+
+// NewObject of Type swift.
+func (f *FS) NewObject(objectname string, opts ...cloudstorage.Opts) (cloudstorage.Object, error) {
+	if len(opts) > 0 && opts[0].WriteThrough {
+		return cloudstorage.NewWriteThroughObject(f, objectname, opts[0])
+	}
+	obj, err := f.Get(context.Background(), objectname)
+	if err != nil && err != cloudstorage.ErrObjectNotFound {
+		return nil, err
+	} else if obj != nil {
+		if len(opts) > 0 && opts[0].Overwrite {
+			return obj, nil
+		}
+		return nil, cloudstorage.ErrObjectExists
+	}
+
+	return &object{
+		fs:        f,
+		name:      objectname,
+		metadata:  map[string]string{cloudstorage.ContentTypeKey: cloudstorage.ContentType(objectname)},
+		cachepath: cloudstorage.CachePathObj(f.cachepath, objectname, f.ID),
+	}, nil
+}
+
+// Get a single File Object
+func (f *FS) Get(ctx context.Context, objectpath string) (cloudstorage.Object, error) {
+	info, headers, err := f.conn.Object(f.container, objectpath)
+	if err != nil {
+		if err == swift.ObjectNotFound {
+			return nil, cloudstorage.ErrObjectNotFound
+		}
+		return nil, err
+	}
+	obj := newObject(f, info)
+	obj.metadata = map[string]string(headers.ObjectMetadata())
+	obj.attrs.CustomMetadata = map[string]string(headers.ObjectMetadata())
+	if info.ContentType != "" {
+		obj.metadata[cloudstorage.ContentTypeKey] = info.ContentType
+	}
+	return obj, nil
+}
+
+// Objects returns an iterator over the objects in the container that match the Query q.
+func (f *FS) Objects(ctx context.Context, q cloudstorage.Query) (cloudstorage.ObjectIterator, error) {
+	return cloudstorage.NewObjectPageIterator(ctx, f, q), nil
+}
+
+// List objects from this store.
+func (f *FS) List(ctx context.Context, q cloudstorage.Query) (*cloudstorage.ObjectsResponse, error) {
+
+	limit := f.PageSize
+	if q.PageSize > 0 {
+		limit = q.PageSize
+	}
+
+	opts := &swift.ObjectsOpts{
+		Limit:  limit,
+		Marker: q.Marker,
+		Prefix: q.Prefix,
+	}
+	if q.Delimiter != "" {
+		opts.Delimiter = rune(q.Delimiter[0])
+	}
+	objs, err := f.conn.Objects(f.container, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := cloudstorage.NewObjectsResponse()
+	for _, o := range objs {
+		if o.PseudoDirectory {
+			resp.Prefixes = append(resp.Prefixes, o.Name)
+			continue
+		}
+		if !q.Match(o.Name, o.Bytes) {
+			continue
+		}
+		resp.Objects = append(resp.Objects, newObject(f, o))
+	}
+	if len(objs) == limit {
+		resp.NextMarker = objs[len(objs)-1].Name
+	}
+	resp.Objects = q.ApplyFilters(resp.Objects)
+	return resp, nil
+}
+
+// Folders get folders list.
+func (f *FS) Folders(ctx context.Context, q cloudstorage.Query) ([]string, error) {
+	iter, err := f.FolderIterator(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+	return cloudstorage.FoldersAll(iter)
+}
+
+// FolderIterator returns an iterator over the folders below the Query prefix.
+func (f *FS) FolderIterator(ctx context.Context, q cloudstorage.Query) (cloudstorage.FolderIterator, error) {
+	return cloudstorage.NewFolderPageIterator(ctx, f, q), nil
+}
+
+// Copy from src to destination, server side.
+func (f *FS) Copy(ctx context.Context, src, des cloudstorage.Object) error {
+	_, err := f.conn.ObjectCopy(f.container, src.Name(), f.container, des.Name(), nil)
+	return err
+}
+
+// Move which is a server side Copy & Delete
+func (f *FS) Move(ctx context.Context, src, des cloudstorage.Object) error {
+	if err := f.Copy(ctx, src, des); err != nil {
+		return err
+	}
+	return f.Delete(ctx, src.Name())
+}
+
+// NewReader create file reader.
+func (f *FS) NewReader(o string) (io.ReadCloser, error) {
+	return f.NewReaderWithContext(context.Background(), o)
+}
+
+// NewReaderWithContext create new File reader with context.
+func (f *FS) NewReaderWithContext(ctx context.Context, objectname string) (io.ReadCloser, error) {
+	file, _, err := f.conn.ObjectOpen(f.container, objectname, false, nil)
+	if err != nil {
+		if err == swift.ObjectNotFound {
+			return nil, cloudstorage.ErrObjectNotFound
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+// NewWriter create Object Writer.
+func (f *FS) NewWriter(objectName string, metadata map[string]string) (io.WriteCloser, error) {
+	return f.NewWriterWithContext(context.Background(), objectName, metadata)
+}
+
+// NewWriterWithContext create writer with provided context and metadata.  The
+// object is staged in the local cache so its size is known on Close, which
+// decides between a single upload or a segmented large object.
+func (f *FS) NewWriterWithContext(ctx context.Context, objectName string, metadata map[string]string, opts ...cloudstorage.Opts) (io.WriteCloser, error) {
+	if len(opts) > 0 && opts[0].IfNotExists {
+		if _, _, err := f.conn.Object(f.container, objectName); err == nil {
+			return nil, cloudstorage.ErrObjectExists
+		} else if err != swift.ObjectNotFound {
+			return nil, err
+		}
+	}
+
+	metadata, err := cloudstorage.NormalizeMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &object{
+		fs:          f,
+		name:        objectName,
+		metadata:    metadata,
+		cachepath:   cloudstorage.CachePathObj(f.cachepath, objectName, f.ID),
+		ifNotExists: len(opts) > 0 && opts[0].IfNotExists,
+	}
+	if _, err := o.Open(cloudstorage.ReadWrite); err != nil {
+		return nil, err
+	}
+	return cloudstorage.NewResultWriter(o, nil), nil
+}
+
+// Delete requested object path string, including large object segments.
+func (f *FS) Delete(ctx context.Context, obj string, opts ...cloudstorage.Opts) error {
+	err := f.conn.LargeObjectDelete(f.container, obj)
+	if err == swift.ObjectNotFound {
+		return cloudstorage.ErrObjectNotFound
+	}
+	return err
+}
+
+// upload the reader of size bytes, as a segmented static large object if
+// it is larger than the segment size (dynamic if the cluster has no SLO).
+// With ifNotExists the object, or the manifest of a large one, is put with
+// If-None-Match: * and an existing object fails with ErrObjectExists.
+func (f *FS) upload(name string, r io.Reader, size int64, metadata map[string]string, ifNotExists bool) error {
+	metadata, err := cloudstorage.NormalizeMetadata(metadata)
+	if err != nil {
+		return err
+	}
+
+	contentType := cloudstorage.ContentType(name)
+	meta := swift.Metadata{}
+	for k, v := range metadata {
+		if k == cloudstorage.ContentTypeKey {
+			contentType = v
+			continue
+		}
+		meta[k] = v
+	}
+	headers := meta.ObjectHeaders()
+	if ifNotExists {
+		headers["If-None-Match"] = "*"
+	}
+
+	if size <= f.segmentSize {
+		_, err := f.conn.ObjectPut(f.container, name, r, false, "", contentType, headers)
+		return existsError(err)
+	}
+
+	if ifNotExists {
+		// large object creation takes an existing object as its first
+		// segment, the manifest put still fails if one shows up meanwhile
+		if _, _, err := f.conn.Object(f.container, name); err == nil {
+			return cloudstorage.ErrObjectExists
+		} else if err != swift.ObjectNotFound {
+			return err
+		}
+	}
+
+	if err := f.conn.ContainerCreate(f.segmentContainer, nil); err != nil {
+		return fmt.Errorf("could not create segment container %q err=%v", f.segmentContainer, err)
+	}
+	lopts := &swift.LargeObjectOpts{
+		Container:        f.container,
+		ObjectName:       name,
+		ContentType:      contentType,
+		Headers:          headers,
+		ChunkSize:        f.segmentSize,
+		SegmentContainer: f.segmentContainer,
+	}
+	lo, err := f.conn.StaticLargeObjectCreate(lopts)
+	if err == swift.SLONotSupported {
+		lo, err = f.conn.DynamicLargeObjectCreate(lopts)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(lo, r); err != nil {
+		lo.Close()
+		return err
+	}
+	return existsError(lo.Close())
+}
+
+// existsError is ErrObjectExists for the 412 of an If-None-Match: * put.
+func existsError(err error) error {
+	var serr *swift.Error
+	if errors.As(err, &serr) && serr.StatusCode == http.StatusPreconditionFailed {
+		return cloudstorage.ErrObjectExists
+	}
+	return err
+}
+
+func newObject(f *FS, o swift.Object) *object {
+	return &object{
+		fs:        f,
+		name:      o.Name,
+		updated:   o.LastModified,
+		size:      o.Bytes,
+		exists:    true,
+		cachepath: cloudstorage.CachePathObj(f.cachepath, o.Name, f.ID),
+		attrs:     cloudstorage.ObjectAttributes{ContentType: o.ContentType, ETag: o.Hash},
+	}
+}
+
+func (o *object) Size() int64 {
+	return o.size
+}
+
+// Attrs of the object, listed objects have no metadata, it comes with Get.
+func (o *object) Attrs() cloudstorage.ObjectAttributes {
+	if o.attrs.ContentType == "" {
+		// not listed or fetched, ie written by NewObject
+		return cloudstorage.BasicAttrs(o)
+	}
+	a := o.attrs
+	a.Size, a.Updated = o.size, o.Updated()
+	return a
+}
+func (o *object) StorageSource() string {
+	return StoreType
+}
+func (o *object) Name() string {
+	return o.name
+}
+func (o *object) String() string {
+	return o.name
+}
+func (o *object) Updated() time.Time {
+	return o.updated.UTC()
+}
+func (o *object) MetaData() map[string]string {
+	return o.metadata
+}
+func (o *object) SetMetaData(meta map[string]string) {
+	o.metadata = meta
+}
+
+func (o *object) DisableCompression() {}
+
+func (o *object) Delete() error {
+	o.Release()
+	return o.fs.Delete(context.Background(), o.name)
+}
+
+// Open copies the object to the local cache for reading/writing.
+func (o *object) Open(accesslevel cloudstorage.AccessLevel) (*os.File, error) {
+	if o.opened {
+		return nil, fmt.Errorf("the store object is already opened. %s", o.name)
+	}
+
+	if err := cloudstorage.EnsureDir(o.cachepath); err != nil {
+		return nil, fmt.Errorf("error occurred creating cachedcopy's dir. cachepath=%s err=%v", o.cachepath, err)
+	}
+
+	cachedcopy, err := os.Create(o.cachepath)
+	if err != nil {
+		return nil, fmt.Errorf("error occurred creating file. local=%s err=%v", o.cachepath, err)
+	}
+
+	if o.exists {
+		var errs []error
+		bo := cloudstorage.NewBackoffer(RetryBackoff)
+		for try := 0; try < Retries; try++ {
+			if _, err = cachedcopy.Seek(0, io.SeekStart); err != nil {
+				cachedcopy.Close()
+				return nil, fmt.Errorf("error seeking to start of cachedcopy err=%v", err)
+			}
+			if err = cachedcopy.Truncate(0); err != nil {
+				cachedcopy.Close()
+				return nil, fmt.Errorf("error truncating cachedcopy err=%v", err)
+			}
+			_, err = o.fs.conn.ObjectGet(o.fs.container, o.name, cachedcopy, false, nil)
+			if err == nil {
+				break
+			}
+			errs = append(errs, err)
+			if !o.fs.IsTransient(err) || !bo.Wait(context.Background()) {
+				break
+			}
+		}
+		if err != nil {
+			cachedcopy.Close()
+			return nil, fmt.Errorf("fetch error: obj=%s tfile=%v errs:[%v]", o.name, o.cachepath, errs)
+		}
+		if _, err := cachedcopy.Seek(0, io.SeekStart); err != nil {
+			cachedcopy.Close()
+			return nil, fmt.Errorf("error seeking to start of cachedcopy err=%v", err)
+		}
+	}
+
+	o.cachedcopy = cachedcopy
+	o.readonly = accesslevel == cloudstorage.ReadOnly
+	o.opened = true
+	return o.cachedcopy, nil
+}
+
+// File get the current file handle for cached copy.
+func (o *object) File() *os.File {
+	return o.cachedcopy
+}
+
+// Read bytes from underlying/cached file
+func (o *object) Read(p []byte) (n int, err error) {
+	return o.cachedcopy.Read(p)
+}
+
+// Write bytes to local file, will be synced on close/sync.
+func (o *object) Write(p []byte) (n int, err error) {
+	if o.cachedcopy == nil {
+		_, err := o.Open(cloudstorage.ReadWrite)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return o.cachedcopy.Write(p)
+}
+
+// Sync syncs any changes in file up to swift.
+func (o *object) Sync() error {
+
+	if !o.opened {
+		return fmt.Errorf("object isn't opened object:%s", o.name)
+	}
+	if o.readonly {
+		return fmt.Errorf("trying to Sync a readonly object:%s", o.name)
+	}
+
+	cachedcopy, err := os.Open(o.cachepath)
+	if err != nil {
+		return fmt.Errorf("couldn't open localfile for sync'ing. local=%s err=%v", o.cachepath, err)
+	}
+	defer cachedcopy.Close()
+
+	fi, err := cachedcopy.Stat()
+	if err != nil {
+		return err
+	}
+
+	if err := o.fs.upload(o.name, cachedcopy, fi.Size(), o.metadata, o.ifNotExists); err != nil {
+		gou.Warnf("could not upload %v", err)
+		return fmt.Errorf("failed to upload file, %w", err)
+	}
+	// the object is ours now, later syncs overwrite it
+	o.ifNotExists = false
+	o.exists = true
+	return nil
+}
+
+// Close this object
+func (o *object) Close() error {
+	if !o.opened {
+		return nil
+	}
+	defer func() {
+		os.Remove(o.cachepath)
+		o.cachedcopy = nil
+		o.opened = false
+	}()
+
+	if !o.readonly {
+		if err := o.cachedcopy.Sync(); err != nil {
+			return err
+		}
+	}
+
+	if err := o.cachedcopy.Close(); err != nil {
+		if !strings.Contains(err.Error(), os.ErrClosed.Error()) {
+			return err
+		}
+	}
+
+	if !o.readonly {
+		if err := o.Sync(); err != nil {
+			gou.Errorf("error on sync %v err=%v", o.cachepath, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// Release this object, cleanup cached copy.
+func (o *object) Release() error {
+	if o.cachedcopy != nil {
+		o.cachedcopy.Close()
+		o.cachedcopy = nil
+		o.opened = false
+	}
+	// most likely this doesn't exist so don't return error
+	os.Remove(o.cachepath)
+	return nil
+}
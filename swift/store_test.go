@@ -0,0 +1,174 @@
+package swift_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/araddon/gou"
+	ncwswift "github.com/ncw/swift"
+	"github.com/ncw/swift/swifttest"
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/swift"
+	"github.com/lytics/cloudstorage/testutils"
+)
+
+func testConfig(t *testing.T) (*cloudstorage.Config, func()) {
+	srv, err := swifttest.NewSwiftServer("localhost")
+	require.NoError(t, err)
+
+	conf := &cloudstorage.Config{
+		Type:       swift.StoreType,
+		AuthMethod: swift.AuthKeystone,
+		Bucket:     "cloudstorage-tests",
+		TmpDir:     filepath.Join(t.TempDir(), "localcache", "swift"),
+		Settings: gou.JsonHelper{
+			swift.ConfKeyAuthURL:     srv.AuthURL,
+			swift.ConfKeyAuthVersion: 1,
+			swift.ConfKeyUser:        swifttest.TEST_ACCOUNT,
+			swift.ConfKeyAPIKey:      swifttest.TEST_ACCOUNT,
+		},
+	}
+	conn, err := swift.NewConnection(conf)
+	require.NoError(t, err)
+	require.NoError(t, conn.ContainerCreate(conf.Bucket, nil))
+	return conf, srv.Close
+}
+
+func TestConfig(t *testing.T) {
+	conf := &cloudstorage.Config{
+		Type:       swift.StoreType,
+		AuthMethod: swift.AuthKeystone,
+		Settings:   make(gou.JsonHelper),
+	}
+	_, err := cloudstorage.NewStore(conf)
+	require.Equal(t, swift.ErrNoAuthURL, err)
+
+	conf.Settings[swift.ConfKeyAuthURL] = "http://localhost:5000/v3"
+	_, err = cloudstorage.NewStore(conf)
+	require.Error(t, err)
+
+	conf.AuthMethod = swift.AuthApplicationCredential
+	_, err = cloudstorage.NewStore(conf)
+	require.Error(t, err)
+}
+
+func TestAll(t *testing.T) {
+	conf, done := testConfig(t)
+	defer done()
+
+	store, err := cloudstorage.NewStore(conf)
+	require.NoError(t, err)
+	testutils.RunTests(t, store, conf)
+}
+
+func TestLargeObject(t *testing.T) {
+	conf, done := testConfig(t)
+	defer done()
+	conf.Settings[swift.ConfKeySegmentSize] = 1024
+
+	store, err := cloudstorage.NewStore(conf)
+	require.NoError(t, err)
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 300)
+	w, err := store.NewWriter("large/object.txt", map[string]string{"owner": "tests"})
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	conn := store.Client().(*ncwswift.Connection)
+	_, segments, err := conn.LargeObjectGetSegments(conf.Bucket, "large/object.txt")
+	require.NoError(t, err)
+	require.Equal(t, 5, len(segments))
+
+	obj, err := store.Get(context.Background(), "large/object.txt")
+	require.NoError(t, err)
+	require.Equal(t, "tests", obj.MetaData()["owner"])
+
+	rc, err := store.NewReader("large/object.txt")
+	require.NoError(t, err)
+	got, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	require.Equal(t, data, got)
+}
+
+// ifNoneMatchProxy fronts the swifttest server, which ignores
+// If-None-Match, failing the puts of existing objects with 412 like swift.
+func ifNoneMatchProxy(t *testing.T, authURL string) string {
+	backend, err := url.Parse(authURL)
+	require.NoError(t, err)
+	backend.Path = ""
+	var front *httptest.Server
+	proxy := httputil.NewSingleHostReverseProxy(backend)
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		if u := resp.Header.Get("X-Storage-Url"); u != "" {
+			resp.Header.Set("X-Storage-Url", strings.Replace(u, backend.String(), front.URL, 1))
+		}
+		return nil
+	}
+	front = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && r.Header.Get("If-None-Match") == "*" {
+			head, err := http.NewRequest(http.MethodHead, backend.String()+r.URL.Path, nil)
+			require.NoError(t, err)
+			head.Header.Set("X-Auth-Token", r.Header.Get("X-Auth-Token"))
+			resp, err := http.DefaultClient.Do(head)
+			require.NoError(t, err)
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	t.Cleanup(front.Close)
+	return strings.Replace(authURL, backend.String(), front.URL, 1)
+}
+
+func TestIfNotExistsRace(t *testing.T) {
+	conf, done := testConfig(t)
+	defer done()
+	conf.Settings[swift.ConfKeyAuthURL] = ifNoneMatchProxy(t, conf.Settings.String(swift.ConfKeyAuthURL))
+	conf.Settings[swift.ConfKeySegmentSize] = 1024
+
+	store, err := cloudstorage.NewStore(conf)
+	require.NoError(t, err)
+	conn := store.Client().(*ncwswift.Connection)
+	ctx := context.Background()
+
+	// a single put and a large object
+	for name, size := range map[string]int{"small.txt": 10, "large.txt": 4096} {
+		w, err := store.NewWriterWithContext(ctx, name, nil, cloudstorage.Opts{IfNotExists: true})
+		require.NoError(t, err)
+		_, err = w.Write(bytes.Repeat([]byte("m"), size))
+		require.NoError(t, err)
+		// created by someone else after the writer was opened
+		require.NoError(t, conn.ObjectPutString(conf.Bucket, name, "theirs", "text/plain"))
+		require.ErrorIs(t, w.Close(), cloudstorage.ErrObjectExists, name)
+
+		got, err := conn.ObjectGetString(conf.Bucket, name)
+		require.NoError(t, err)
+		require.Equal(t, "theirs", got, name)
+	}
+
+	// without a conflict the object is created
+	w, err := store.NewWriterWithContext(ctx, "new.txt", nil, cloudstorage.Opts{IfNotExists: true})
+	require.NoError(t, err)
+	_, err = w.Write([]byte("mine"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	got, err := conn.ObjectGetString(conf.Bucket, "new.txt")
+	require.NoError(t, err)
+	require.Equal(t, "mine", got)
+}
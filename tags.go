@@ -0,0 +1,42 @@
+package cloudstorage
+
+import (
+	"net/url"
+)
+
+// TagsMetadataKey is the metadata key stores without native object tags
+// (gcs, azure, localfs) keep the TaggedStore tags under, url query encoded.
+const TagsMetadataKey = "cloudstorage_tags"
+
+// EncodeTags encodes tags for TagsMetadataKey.
+func EncodeTags(tags map[string]string) string {
+	v := make(url.Values, len(tags))
+	for k, val := range tags {
+		v.Set(k, val)
+	}
+	return v.Encode()
+}
+
+// DecodeTags decodes the tags of TagsMetadataKey, an unreadable value has
+// no tags.
+func DecodeTags(s string) map[string]string {
+	tags := make(map[string]string)
+	v, err := url.ParseQuery(s)
+	if err != nil {
+		return tags
+	}
+	for k := range v {
+		tags[k] = v.Get(k)
+	}
+	return tags
+}
+
+// MatchTags reports whether tags has every key and value of filter.
+func MatchTags(tags, filter map[string]string) bool {
+	for k, val := range filter {
+		if tv, ok := tags[k]; !ok || tv != val {
+			return false
+		}
+	}
+	return true
+}
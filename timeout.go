@@ -0,0 +1,157 @@
+package cloudstorage
+
+import (
+	"io"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Timeouts of store operations, see Config.ListTimeout, ReadTimeout and
+// WriteTimeout.  A zero timeout leaves the operation unbounded.
+type Timeouts struct {
+	List  time.Duration
+	Read  time.Duration
+	Write time.Duration
+}
+
+// Timeouts of the config's operations.
+func (c *Config) Timeouts() Timeouts {
+	return Timeouts{List: c.ListTimeout, Read: c.ReadTimeout, Write: c.WriteTimeout}
+}
+
+// WithTimeout returns a context bounded by timeout when ctx has no deadline
+// of its own, the caller's deadline always wins.  The cancel func must be
+// called once the operation is done.
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// Run calls fn, returning ctx.Err() as soon as ctx is done.  It is for
+// clients whose calls take no context and can block forever on a wedged
+// connection, fn keeps running in the background after ctx is done so it
+// must not touch state the caller reuses.
+func Run(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// NewCancelReader returns rc, calling cancel once rc is closed, so a
+// reader created with a WithTimeout context keeps it until then.
+func NewCancelReader(rc io.ReadCloser, cancel context.CancelFunc) io.ReadCloser {
+	return &cancelReader{ReadCloser: rc, cancel: cancel}
+}
+
+type cancelReader struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (r *cancelReader) Close() error {
+	defer r.cancel()
+	return r.ReadCloser.Close()
+}
+
+// NewCancelWriter returns wc, calling cancel once wc is closed.
+func NewCancelWriter(wc io.WriteCloser, cancel context.CancelFunc) io.WriteCloser {
+	return &cancelWriter{WriteCloser: wc, cancel: cancel}
+}
+
+type cancelWriter struct {
+	io.WriteCloser
+	cancel context.CancelFunc
+}
+
+func (w *cancelWriter) Close() error {
+	defer w.cancel()
+	return w.WriteCloser.Close()
+}
+
+// NewContextReader returns a reader of rc for clients whose reads take no
+// context, once ctx is done Read returns ctx.Err() even when a read of rc
+// is blocked.  Close closes rc and calls cancel.
+func NewContextReader(ctx context.Context, rc io.ReadCloser, cancel context.CancelFunc) io.ReadCloser {
+	return &contextReader{ctx: ctx, rc: rc, cancel: cancel}
+}
+
+type contextReader struct {
+	ctx    context.Context
+	rc     io.ReadCloser
+	cancel context.CancelFunc
+	buf    []byte
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if len(r.buf) < len(p) {
+		r.buf = make([]byte, len(p))
+	}
+	// an abandoned read may still fill buf, but after that every Read
+	// returns ctx.Err() so buf is never used again
+	buf := r.buf[:len(p)]
+	var n int
+	err := Run(r.ctx, func() error {
+		var err error
+		n, err = r.rc.Read(buf)
+		return err
+	})
+	if r.ctx.Err() != nil {
+		return 0, r.ctx.Err()
+	}
+	copy(p, buf[:n])
+	return n, err
+}
+
+func (r *contextReader) Close() error {
+	defer r.cancel()
+	return r.rc.Close()
+}
+
+// NewContextWriter returns a writer of wc for clients whose writes take no
+// context, once ctx is done Write and Close return ctx.Err() even when a
+// write or close of wc is blocked.  cancel is called on Close.
+func NewContextWriter(ctx context.Context, wc io.WriteCloser, cancel context.CancelFunc) io.WriteCloser {
+	return &contextWriter{ctx: ctx, wc: wc, cancel: cancel}
+}
+
+type contextWriter struct {
+	ctx    context.Context
+	wc     io.WriteCloser
+	cancel context.CancelFunc
+	buf    []byte
+}
+
+func (w *contextWriter) Write(p []byte) (int, error) {
+	// p belongs to the caller once Write returns, an abandoned write keeps
+	// going from a copy
+	w.buf = append(w.buf[:0], p...)
+	buf := w.buf
+	var n int
+	err := Run(w.ctx, func() error {
+		var err error
+		n, err = w.wc.Write(buf)
+		return err
+	})
+	if w.ctx.Err() != nil {
+		return 0, w.ctx.Err()
+	}
+	return n, err
+}
+
+func (w *contextWriter) Close() error {
+	defer w.cancel()
+	return Run(w.ctx, w.wc.Close)
+}
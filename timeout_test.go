@@ -0,0 +1,68 @@
+package cloudstorage_test
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+)
+
+func TestWithTimeout(t *testing.T) {
+	ctx, cancel := cloudstorage.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	require.True(t, ok)
+	require.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+
+	// the caller's deadline wins
+	parent, pcancel := context.WithTimeout(context.Background(), time.Hour)
+	defer pcancel()
+	ctx, cancel = cloudstorage.WithTimeout(parent, time.Minute)
+	defer cancel()
+	require.Equal(t, parent, ctx)
+
+	ctx, cancel = cloudstorage.WithTimeout(context.Background(), 0)
+	defer cancel()
+	_, ok = ctx.Deadline()
+	require.False(t, ok)
+}
+
+func TestRunTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	block := make(chan struct{})
+	defer close(block)
+	err := cloudstorage.Run(ctx, func() error {
+		<-block
+		return nil
+	})
+	require.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestContextReader(t *testing.T) {
+	pr, pw := io.Pipe()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	r := cloudstorage.NewContextReader(ctx, pr, cancel)
+	go pw.Write([]byte("hello"))
+
+	p := make([]byte, 5)
+	n, err := r.Read(p)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(p[:n]))
+
+	// nothing more is written, the read blocks until the deadline
+	_, err = r.Read(p)
+	require.Equal(t, context.DeadlineExceeded, err)
+	require.NoError(t, r.Close())
+
+	pr, pw = io.Pipe()
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	w := cloudstorage.NewContextWriter(ctx, pw, cancel)
+	_, err = w.Write([]byte("hello"))
+	require.Equal(t, context.DeadlineExceeded, err)
+	pr.Close()
+}
@@ -0,0 +1,34 @@
+package cloudstorage
+
+import (
+	"time"
+)
+
+// DefaultUpdatedGranularity is the granularity of Object.Updated assumed for
+// stores that don't implement StoreTimestamps.
+const DefaultUpdatedGranularity = time.Second
+
+// UpdatedGranularity is the resolution store keeps Object.Updated times
+// with, DefaultUpdatedGranularity when the store doesn't say.
+func UpdatedGranularity(s StoreReader) time.Duration {
+	if ts, ok := s.(StoreTimestamps); ok {
+		if g := ts.UpdatedGranularity(); g > 0 {
+			return g
+		}
+	}
+	return DefaultUpdatedGranularity
+}
+
+// UpdatedAtLeast reports whether o, of store s, was updated at or after t as
+// far as the store's granularity can tell, ie an object written after t
+// is never reported as older because the store dropped the sub-second part.
+func UpdatedAtLeast(s StoreReader, o Object, t time.Time) bool {
+	return !o.Updated().Before(t.Truncate(UpdatedGranularity(s)))
+}
+
+// UpdatedAfter reports whether o, of store s, was certainly updated after t,
+// ie in a later granule of the store's granularity.
+func UpdatedAfter(s StoreReader, o Object, t time.Time) bool {
+	g := UpdatedGranularity(s)
+	return o.Updated().Truncate(g).After(t.Truncate(g))
+}
@@ -0,0 +1,50 @@
+package cloudstorage_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/localfs"
+	"github.com/lytics/cloudstorage/testutils"
+)
+
+// plainStore hides the optional interfaces of the store it wraps.
+type plainStore struct {
+	cloudstorage.Store
+}
+
+func TestUpdatedGranularity(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "mockcloud"),
+		TmpDir:     filepath.Join(tmpDir, "localcache"),
+		Bucket:     "updated",
+	})
+	require.NoError(t, err)
+	require.Equal(t, time.Nanosecond, cloudstorage.UpdatedGranularity(store))
+	plain := plainStore{store}
+	require.Equal(t, cloudstorage.DefaultUpdatedGranularity, cloudstorage.UpdatedGranularity(plain))
+
+	require.NoError(t, testutils.MockFile(store, "a.csv", "a"))
+	obj, err := store.Get(context.Background(), "a.csv")
+	require.NoError(t, err)
+	updated := obj.Updated()
+	require.Equal(t, time.UTC, updated.Location())
+
+	later := updated.Add(time.Millisecond)
+	require.False(t, cloudstorage.UpdatedAtLeast(store, obj, later))
+	require.True(t, cloudstorage.UpdatedAtLeast(plain, obj, updated.Truncate(time.Second).Add(999*time.Millisecond)))
+	require.False(t, cloudstorage.UpdatedAtLeast(plain, obj, updated.Truncate(time.Second).Add(time.Second)))
+
+	require.True(t, cloudstorage.UpdatedAfter(store, obj, updated.Add(-time.Nanosecond)))
+	require.False(t, cloudstorage.UpdatedAfter(store, obj, updated))
+	require.False(t, cloudstorage.UpdatedAfter(plain, obj, updated.Truncate(time.Second)))
+	require.True(t, cloudstorage.UpdatedAfter(plain, obj, updated.Truncate(time.Second).Add(-time.Nanosecond)))
+}
@@ -0,0 +1,162 @@
+package cloudstorage
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"golang.org/x/net/context"
+	"golang.org/x/sync/errgroup"
+)
+
+// UploadOpts optional settings for UploadDir.
+type UploadOpts struct {
+	// Concurrency is the number of files uploaded at once, 0 or 1 uploads
+	// serially.
+	Concurrency int
+	// Include are glob patterns (see path.Match) of the files to upload,
+	// matched against the slash separated path relative to the directory
+	// and against the file name.  Empty includes every file.
+	Include []string
+	// Exclude are glob patterns of files to skip, matched as Include.
+	// Exclude wins over Include.
+	Exclude []string
+}
+
+// UploadedObject is a manifest entry of a file uploaded by UploadDir.
+type UploadedObject struct {
+	// Name of the object in the store.
+	Name string
+	// LocalPath of the uploaded file.
+	LocalPath   string
+	Size        int64
+	ContentType string
+}
+
+// UploadDir uploads the files below localDir to the store, each object is
+// named prefix + the slash separated path relative to localDir.  The
+// content type is found from the file extension, falling back to sniffing
+// the file's first bytes.  The returned manifest is sorted by name.
+func UploadDir(ctx context.Context, store Store, localDir, prefix string, opts ...UploadOpts) ([]UploadedObject, error) {
+	var o UploadOpts
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = 1
+	}
+	for _, pattern := range append(o.Include, o.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %w", pattern, err)
+		}
+	}
+
+	var (
+		mu       sync.Mutex
+		manifest []UploadedObject
+	)
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(o.Concurrency)
+	err := filepath.WalkDir(localDir, func(fpath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := gctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(localDir, fpath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !uploadIncluded(rel, o) {
+			return nil
+		}
+		g.Go(func() error {
+			uo, err := uploadFile(gctx, store, fpath, prefix+rel)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			manifest = append(manifest, *uo)
+			mu.Unlock()
+			return nil
+		})
+		return nil
+	})
+	if werr := g.Wait(); err == nil {
+		err = werr
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(manifest, func(i, j int) bool { return manifest[i].Name < manifest[j].Name })
+	return manifest, nil
+}
+
+// uploadIncluded reports whether the relative path rel passes the include
+// and exclude patterns.
+func uploadIncluded(rel string, o UploadOpts) bool {
+	match := func(patterns []string) bool {
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, rel); ok {
+				return true
+			}
+			if ok, _ := path.Match(p, path.Base(rel)); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if match(o.Exclude) {
+		return false
+	}
+	return len(o.Include) == 0 || match(o.Include)
+}
+
+func uploadFile(ctx context.Context, store Store, fpath, name string) (*UploadedObject, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ctype := ContentType(fpath)
+	if ctype == "application/octet-stream" {
+		// unknown extension, sniff the content instead
+		buf := make([]byte, 512)
+		n, err := io.ReadFull(f, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		if n > 0 {
+			ctype = http.DetectContentType(buf[:n])
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	w, err := store.NewWriterWithContext(ctx, name, map[string]string{ContentTypeKey: ctype})
+	if err != nil {
+		return nil, fmt.Errorf("could not upload %s to %q: %w", fpath, name, err)
+	}
+	n, err := io.Copy(w, f)
+	if err != nil {
+		w.Close()
+		return nil, fmt.Errorf("could not upload %s to %q: %w", fpath, name, err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("could not upload %s to %q: %w", fpath, name, err)
+	}
+	return &UploadedObject{Name: name, LocalPath: fpath, Size: n, ContentType: ctype}, nil
+}
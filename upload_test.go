@@ -0,0 +1,71 @@
+package cloudstorage_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/localfs"
+)
+
+func TestUploadDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "mockcloud"),
+		TmpDir:     filepath.Join(tmpDir, "localcache"),
+		Bucket:     "upload",
+	})
+	require.NoError(t, err)
+
+	src := filepath.Join(tmpDir, "src")
+	files := map[string]string{
+		"a.csv":        "a,b",
+		"b/c.json":     `{"c":1}`,
+		"b/skip.tmp":   "tmp",
+		"b/d/README":   "plain text",
+		"logs/out.log": "log",
+	}
+	for n, data := range files {
+		fpath := filepath.Join(src, filepath.FromSlash(n))
+		require.NoError(t, os.MkdirAll(filepath.Dir(fpath), 0775))
+		require.NoError(t, os.WriteFile(fpath, []byte(data), 0664))
+	}
+
+	ctx := context.Background()
+	manifest, err := cloudstorage.UploadDir(ctx, store, src, "deploy/", cloudstorage.UploadOpts{
+		Concurrency: 3,
+		Exclude:     []string{"*.tmp", "logs/*"},
+	})
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(manifest))
+	for _, uo := range manifest {
+		names = append(names, uo.Name)
+	}
+	require.Equal(t, []string{"deploy/a.csv", "deploy/b/c.json", "deploy/b/d/README"}, names)
+	require.Equal(t, "text/plain; charset=utf-8", manifest[2].ContentType)
+	require.Equal(t, int64(len("plain text")), manifest[2].Size)
+	require.Equal(t, filepath.Join(src, "b", "d", "README"), manifest[2].LocalPath)
+
+	rc, err := store.NewReaderWithContext(ctx, "deploy/b/c.json")
+	require.NoError(t, err)
+	by, err := io.ReadAll(rc)
+	rc.Close()
+	require.NoError(t, err)
+	require.Equal(t, files["b/c.json"], string(by))
+
+	manifest, err = cloudstorage.UploadDir(ctx, store, src, "csv/", cloudstorage.UploadOpts{Include: []string{"*.csv"}})
+	require.NoError(t, err)
+	require.Len(t, manifest, 1)
+	require.Equal(t, "csv/a.csv", manifest[0].Name)
+
+	_, err = cloudstorage.UploadDir(ctx, store, src, "bad/", cloudstorage.UploadOpts{Include: []string{"[a-"}})
+	require.Error(t, err)
+}
@@ -0,0 +1,130 @@
+package cloudstorage
+
+import (
+	"errors"
+	"path"
+	"sync"
+
+	"golang.org/x/net/context"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/api/iterator"
+)
+
+// SkipDir is used as a return value from a WalkFunc to indicate that the
+// remaining objects in the folder of the object in the call, including its
+// sub-folders, are to be skipped.  It is not returned as an error by Walk.
+var SkipDir = errors.New("skip this folder")
+
+// WalkFunc is the type of the function called by Walk for each object.
+// Returning SkipDir prunes the object's folder, any other error stops the
+// walk and is returned by Walk.
+type WalkFunc func(o Object) error
+
+// WalkOpts optional settings for Walk.
+type WalkOpts struct {
+	// Concurrency is the number of goroutines calling the WalkFunc, 0 or 1
+	// calls it serially in listing order.  With concurrency SkipDir is best
+	// effort, objects already handed to other goroutines are still visited.
+	Concurrency int
+	// PageSize overrides the store page size used when listing.
+	PageSize int
+	// Lean lists the objects without their metadata, see Query.Lean.
+	Lean bool
+}
+
+// Walk calls fn for every object below prefix, paging through the store's
+// object iterator so the full listing is never held in memory.
+func Walk(ctx context.Context, store StoreReader, prefix string, fn WalkFunc, opts ...WalkOpts) error {
+	var o WalkOpts
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	q := NewQuery(prefix)
+	q.PageSize = o.PageSize
+	q.Lean = o.Lean
+	// stores such as localfs don't list in lexical order, SkipDir relies on it
+	q.Sorted()
+	iter, err := store.Objects(ctx, q)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	w := &walker{skipped: make(map[string]struct{})}
+
+	if o.Concurrency <= 1 {
+		for {
+			obj, err := iter.Next()
+			if err == iterator.Done {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if err := w.visit(obj, fn); err != nil {
+				return err
+			}
+		}
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(o.Concurrency)
+	for {
+		select {
+		case <-gctx.Done():
+			return g.Wait()
+		default:
+		}
+		obj, err := iter.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			g.Wait()
+			return err
+		}
+		if w.isSkipped(obj.Name()) {
+			continue
+		}
+		g.Go(func() error {
+			return w.visit(obj, fn)
+		})
+	}
+	return g.Wait()
+}
+
+// walker tracks the folders pruned by SkipDir.
+type walker struct {
+	mu      sync.Mutex
+	skipped map[string]struct{}
+}
+
+func (w *walker) visit(obj Object, fn WalkFunc) error {
+	if w.isSkipped(obj.Name()) {
+		return nil
+	}
+	err := fn(obj)
+	if err == SkipDir {
+		w.mu.Lock()
+		w.skipped[path.Dir(obj.Name())] = struct{}{}
+		w.mu.Unlock()
+		return nil
+	}
+	return err
+}
+
+// isSkipped reports whether name is inside a folder pruned by SkipDir.
+func (w *walker) isSkipped(name string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.skipped) == 0 {
+		return false
+	}
+	for dir := path.Dir(name); ; dir = path.Dir(dir) {
+		if _, ok := w.skipped[dir]; ok {
+			return true
+		}
+		if dir == "." || dir == "/" {
+			return false
+		}
+	}
+}
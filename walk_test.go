@@ -0,0 +1,73 @@
+package cloudstorage_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/localfs"
+	"github.com/lytics/cloudstorage/testutils"
+)
+
+func TestWalk(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := cloudstorage.NewStore(&cloudstorage.Config{
+		Type:       localfs.StoreType,
+		AuthMethod: localfs.AuthFileSystem,
+		LocalFS:    filepath.Join(tmpDir, "mockcloud"),
+		TmpDir:     filepath.Join(tmpDir, "localcache"),
+		Bucket:     "walk",
+	})
+	require.NoError(t, err)
+
+	for _, n := range []string{"walk/a.csv", "walk/b/1.csv", "walk/b/2.csv", "walk/b/c/3.csv", "walk/d/4.csv", "other/5.csv"} {
+		require.NoError(t, testutils.MockFile(store, n, "data"))
+	}
+
+	walk := func(fn cloudstorage.WalkFunc, opts ...cloudstorage.WalkOpts) ([]string, error) {
+		var mu sync.Mutex
+		names := make([]string, 0)
+		err := cloudstorage.Walk(context.Background(), store, "walk/", func(o cloudstorage.Object) error {
+			mu.Lock()
+			names = append(names, o.Name())
+			mu.Unlock()
+			return fn(o)
+		}, opts...)
+		sort.Strings(names)
+		return names, err
+	}
+	all := []string{"walk/a.csv", "walk/b/1.csv", "walk/b/2.csv", "walk/b/c/3.csv", "walk/d/4.csv"}
+
+	names, err := walk(func(o cloudstorage.Object) error { return nil })
+	require.NoError(t, err)
+	require.Equal(t, all, names)
+
+	names, err = walk(func(o cloudstorage.Object) error { return nil }, cloudstorage.WalkOpts{Concurrency: 4})
+	require.NoError(t, err)
+	require.Equal(t, all, names)
+
+	// SkipDir prunes the rest of walk/b including walk/b/c
+	names, err = walk(func(o cloudstorage.Object) error {
+		if o.Name() == "walk/b/1.csv" {
+			return cloudstorage.SkipDir
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"walk/a.csv", "walk/b/1.csv", "walk/d/4.csv"}, names)
+
+	errStop := errors.New("stop")
+	_, err = walk(func(o cloudstorage.Object) error {
+		if o.Name() == "walk/b/2.csv" {
+			return errStop
+		}
+		return nil
+	}, cloudstorage.WalkOpts{Concurrency: 2})
+	require.Equal(t, errStop, err)
+}
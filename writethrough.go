@@ -0,0 +1,170 @@
+package cloudstorage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// writeThroughObject streams the writes of an object to a writer of the
+// store through a pipe, Open returns its write end so writes to the file
+// and to the object both go to the store.
+type writeThroughObject struct {
+	store    Store
+	name     string
+	opts     Opts
+	metadata map[string]string
+	updated  time.Time
+
+	pw       *os.File
+	done     chan error
+	finished bool
+	err      error
+}
+
+var _ Object = (*writeThroughObject)(nil)
+
+// NewWriteThroughObject returns the Object of NewObject with
+// Opts.WriteThrough, for write-only workloads that don't need the cached
+// copy Open downloads and Sync uploads.  Open(ReadWrite) starts a writer of
+// the store (with opts) and returns the write end of a pipe to it, the first
+// Sync or Close finishes the upload and later writes fail with ErrWriteOnly.
+// The object starts empty even with Opts.Overwrite and can't be read.
+//
+// Unless opts.Overwrite is set ErrObjectExists is returned for existing
+// objects, like NewObject.
+func NewWriteThroughObject(store Store, name string, opts Opts) (Object, error) {
+	if !opts.Overwrite {
+		_, err := store.Get(context.Background(), name)
+		if err == nil {
+			return nil, ErrObjectExists
+		} else if err != ErrObjectNotFound {
+			return nil, err
+		}
+	}
+	opts.WriteThrough, opts.Overwrite = false, false
+	return &writeThroughObject{
+		store:    store,
+		name:     name,
+		opts:     opts,
+		metadata: map[string]string{ContentTypeKey: ContentType(name)},
+	}, nil
+}
+
+func (o *writeThroughObject) Name() string {
+	return o.name
+}
+func (o *writeThroughObject) String() string {
+	return o.name
+}
+
+// Updated is the time the upload finished, zero until then.
+func (o *writeThroughObject) Updated() time.Time {
+	return o.updated
+}
+func (o *writeThroughObject) MetaData() map[string]string {
+	return o.metadata
+}
+
+// SetMetaData of the object, only before it is opened.
+func (o *writeThroughObject) SetMetaData(meta map[string]string) {
+	o.metadata = meta
+}
+func (o *writeThroughObject) StorageSource() string {
+	return o.store.Type()
+}
+func (o *writeThroughObject) DisableCompression() {
+	o.opts.DisableCompression = true
+}
+
+// Open starts the upload, the returned file is the write end of the pipe to
+// the store's writer.  ReadOnly objects return ErrWriteOnly.
+func (o *writeThroughObject) Open(accesslevel AccessLevel) (*os.File, error) {
+	if accesslevel == ReadOnly || o.finished {
+		return nil, ErrWriteOnly
+	}
+	if o.pw != nil {
+		return nil, fmt.Errorf("the store object is already opened. %s", o.name)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w, err := o.store.NewWriterWithContext(ctx, o.name, o.metadata, o.opts)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		cancel()
+		w.Close()
+		return nil, err
+	}
+	o.pw, o.done = pw, make(chan error, 1)
+	go func() {
+		defer cancel()
+		_, err := io.Copy(w, pr)
+		pr.Close()
+		if err != nil {
+			// abort the upload rather than commit part of it
+			cancel()
+			w.Close()
+			o.done <- err
+			return
+		}
+		o.done <- w.Close()
+	}()
+	return pw, nil
+}
+
+func (o *writeThroughObject) Release() error {
+	return nil
+}
+
+func (o *writeThroughObject) Read(p []byte) (int, error) {
+	return 0, ErrWriteOnly
+}
+
+func (o *writeThroughObject) Write(p []byte) (int, error) {
+	if o.finished {
+		return 0, ErrWriteOnly
+	}
+	if o.pw == nil {
+		return 0, fmt.Errorf("the store object is not opened. %s", o.name)
+	}
+	return o.pw.Write(p)
+}
+
+// Sync finishes the upload, returning its error.
+func (o *writeThroughObject) Sync() error {
+	if o.finished {
+		return o.err
+	}
+	if o.pw == nil {
+		return fmt.Errorf("the store object is not opened. %s", o.name)
+	}
+	o.finished = true
+	o.pw.Close()
+	if o.err = <-o.done; o.err == nil {
+		o.updated = time.Now().UTC()
+	}
+	return o.err
+}
+
+// Close finishes the upload if it was opened.
+func (o *writeThroughObject) Close() error {
+	if o.pw == nil {
+		return nil
+	}
+	return o.Sync()
+}
+
+// File is the write end of the pipe to the store's writer.
+func (o *writeThroughObject) File() *os.File {
+	return o.pw
+}
+
+func (o *writeThroughObject) Delete() error {
+	return o.store.Delete(context.Background(), o.name)
+}
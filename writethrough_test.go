@@ -0,0 +1,69 @@
+package cloudstorage_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/cloudstorage"
+	"github.com/lytics/cloudstorage/mockstore"
+)
+
+func TestWriteThroughObject(t *testing.T) {
+	ctx := context.Background()
+	store := mockstore.New()
+	store.TmpDir = t.TempDir()
+
+	obj, err := store.NewObject("out/a.csv", cloudstorage.Opts{WriteThrough: true})
+	require.NoError(t, err)
+	obj.SetMetaData(map[string]string{"owner": "etl"})
+	_, err = obj.Open(cloudstorage.ReadOnly)
+	require.Equal(t, cloudstorage.ErrWriteOnly, err)
+
+	f, err := obj.Open(cloudstorage.ReadWrite)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("a,b\n"))
+	require.NoError(t, err)
+	_, err = obj.Write([]byte("c,d\n"))
+	require.NoError(t, err)
+	_, ok := store.Data("out/a.csv")
+	require.False(t, ok, "uploaded on Close")
+	require.NoError(t, obj.Close())
+	require.False(t, obj.Updated().IsZero())
+
+	data, ok := store.Data("out/a.csv")
+	require.True(t, ok)
+	require.Equal(t, "a,b\nc,d\n", string(data))
+	got, err := store.Get(ctx, "out/a.csv")
+	require.NoError(t, err)
+	require.Equal(t, "etl", got.MetaData()["owner"])
+	_, err = obj.Write([]byte("e,f\n"))
+	require.Equal(t, cloudstorage.ErrWriteOnly, err)
+
+	// nothing was cached
+	entries, err := os.ReadDir(store.TmpDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	_, err = store.NewObject("out/a.csv", cloudstorage.Opts{WriteThrough: true})
+	require.Equal(t, cloudstorage.ErrObjectExists, err)
+	obj, err = store.NewObject("out/a.csv", cloudstorage.Opts{WriteThrough: true, Overwrite: true})
+	require.NoError(t, err)
+	_, err = obj.Open(cloudstorage.ReadWrite)
+	require.NoError(t, err)
+	_, err = obj.Write([]byte("g,h\n"))
+	require.NoError(t, err)
+	require.NoError(t, obj.Sync())
+	data, _ = store.Data("out/a.csv")
+	require.Equal(t, "g,h\n", string(data))
+
+	errQuota := errors.New("quota exceeded")
+	store.Fail("NewWriter", "out/b.csv", errQuota, 1)
+	obj, err = store.NewObject("out/b.csv", cloudstorage.Opts{WriteThrough: true})
+	require.NoError(t, err)
+	_, err = obj.Open(cloudstorage.ReadWrite)
+	require.Equal(t, errQuota, err)
+}